@@ -11,7 +11,11 @@ It has these top-level messages:
 	VersionRequest
 	VersionResponse
 	ParseRequest
+	ParseFilesRequest
+	ParseFilesResponse
 	ParseResponse
+	ValidateQueryRequest
+	ValidateQueryResponse
 	ListDriversRequest
 	ListDriversResponse
 	SQLRequest
@@ -25,6 +29,22 @@ It has these top-level messages:
 	UpdateDriverResponse
 	RemoveDriverRequest
 	RemoveDriverResponse
+	SetLogLevelRequest
+	SetLogLevelResponse
+	ParseLimits
+	SetParseLimitsRequest
+	SetParseLimitsResponse
+	GetEnvironmentStatusRequest
+	WatchEnvironmentStatusRequest
+	EnvironmentStatus
+	ComponentStatus
+	Address
+	Problem
+	Operation
+	OperationEvent
+	StartOperationRequest
+	GetOperationRequest
+	WatchOperationRequest
 */
 package api
 
@@ -48,6 +68,39 @@ var _ = math.Inf
 // proto package needs to be updated.
 const _ = proto.ProtoPackageIsVersion2 // please upgrade the proto package
 
+// Mode of the UAST returned by bblfsh.
+type Mode int32
+
+const (
+	// The UAST of the first version of the bblfsh protocol, which is the only
+	// one XPath queries can be applied to.
+	Mode_DEFAULT_MODE Mode = 0
+	// The native AST as returned by the parser.
+	Mode_NATIVE Mode = 1
+	// The native AST annotated with roles.
+	Mode_ANNOTATED Mode = 2
+	// The AST normalized to a unified structure where possible.
+	Mode_SEMANTIC Mode = 3
+)
+
+var Mode_name = map[int32]string{
+	0: "DEFAULT_MODE",
+	1: "NATIVE",
+	2: "ANNOTATED",
+	3: "SEMANTIC",
+}
+var Mode_value = map[string]int32{
+	"DEFAULT_MODE": 0,
+	"NATIVE":       1,
+	"ANNOTATED":    2,
+	"SEMANTIC":     3,
+}
+
+func (x Mode) String() string {
+	return proto.EnumName(Mode_name, int32(x))
+}
+func (Mode) EnumDescriptor() ([]byte, []int) { return fileDescriptor0, []int{0} }
+
 type ParseRequest_Kind int32
 
 const (
@@ -94,7 +147,176 @@ var ParseResponse_Kind_value = map[string]int32{
 func (x ParseResponse_Kind) String() string {
 	return proto.EnumName(ParseResponse_Kind_name, int32(x))
 }
-func (ParseResponse_Kind) EnumDescriptor() ([]byte, []int) { return fileDescriptor0, []int{3, 0} }
+func (ParseResponse_Kind) EnumDescriptor() ([]byte, []int) { return fileDescriptor0, []int{5, 0} }
+
+type ComponentStatus_State int32
+
+const (
+	ComponentStatus_STATE_UNKNOWN ComponentStatus_State = 0
+	ComponentStatus_RUNNING       ComponentStatus_State = 1
+	ComponentStatus_STOPPED       ComponentStatus_State = 2
+	ComponentStatus_NOT_CREATED   ComponentStatus_State = 3
+)
+
+var ComponentStatus_State_name = map[int32]string{
+	0: "STATE_UNKNOWN",
+	1: "RUNNING",
+	2: "STOPPED",
+	3: "NOT_CREATED",
+}
+var ComponentStatus_State_value = map[string]int32{
+	"STATE_UNKNOWN": 0,
+	"RUNNING":       1,
+	"STOPPED":       2,
+	"NOT_CREATED":   3,
+}
+
+func (x ComponentStatus_State) String() string {
+	return proto.EnumName(ComponentStatus_State_name, int32(x))
+}
+func (ComponentStatus_State) EnumDescriptor() ([]byte, []int) { return fileDescriptor0, []int{29, 0} }
+
+type ComponentStatus_Health int32
+
+const (
+	ComponentStatus_HEALTH_UNKNOWN ComponentStatus_Health = 0
+	// No health check, or not running.
+	ComponentStatus_NO_HEALTH_CHECK ComponentStatus_Health = 1
+	ComponentStatus_HEALTHY         ComponentStatus_Health = 2
+	ComponentStatus_UNHEALTHY       ComponentStatus_Health = 3
+	ComponentStatus_STARTING        ComponentStatus_Health = 4
+)
+
+var ComponentStatus_Health_name = map[int32]string{
+	0: "HEALTH_UNKNOWN",
+	1: "NO_HEALTH_CHECK",
+	2: "HEALTHY",
+	3: "UNHEALTHY",
+	4: "STARTING",
+}
+var ComponentStatus_Health_value = map[string]int32{
+	"HEALTH_UNKNOWN":  0,
+	"NO_HEALTH_CHECK": 1,
+	"HEALTHY":         2,
+	"UNHEALTHY":       3,
+	"STARTING":        4,
+}
+
+func (x ComponentStatus_Health) String() string {
+	return proto.EnumName(ComponentStatus_Health_name, int32(x))
+}
+func (ComponentStatus_Health) EnumDescriptor() ([]byte, []int) { return fileDescriptor0, []int{29, 1} }
+
+type Problem_Severity int32
+
+const (
+	Problem_SEVERITY_UNKNOWN Problem_Severity = 0
+	Problem_WARNING          Problem_Severity = 1
+	Problem_FAILURE          Problem_Severity = 2
+)
+
+var Problem_Severity_name = map[int32]string{
+	0: "SEVERITY_UNKNOWN",
+	1: "WARNING",
+	2: "FAILURE",
+}
+var Problem_Severity_value = map[string]int32{
+	"SEVERITY_UNKNOWN": 0,
+	"WARNING":          1,
+	"FAILURE":          2,
+}
+
+func (x Problem_Severity) String() string {
+	return proto.EnumName(Problem_Severity_name, int32(x))
+}
+func (Problem_Severity) EnumDescriptor() ([]byte, []int) { return fileDescriptor0, []int{31, 0} }
+
+type Operation_Kind int32
+
+const (
+	Operation_KIND_UNKNOWN Operation_Kind = 0
+	// Start the components enabled on init.
+	Operation_START_COMPONENTS Operation_Kind = 1
+	// Install the drivers given, or the recommended ones if none is.
+	Operation_INSTALL_DRIVERS Operation_Kind = 2
+	// Update the drivers given to the version given.
+	Operation_UPDATE_DRIVERS Operation_Kind = 3
+)
+
+var Operation_Kind_name = map[int32]string{
+	0: "KIND_UNKNOWN",
+	1: "START_COMPONENTS",
+	2: "INSTALL_DRIVERS",
+	3: "UPDATE_DRIVERS",
+}
+var Operation_Kind_value = map[string]int32{
+	"KIND_UNKNOWN":     0,
+	"START_COMPONENTS": 1,
+	"INSTALL_DRIVERS":  2,
+	"UPDATE_DRIVERS":   3,
+}
+
+func (x Operation_Kind) String() string {
+	return proto.EnumName(Operation_Kind_name, int32(x))
+}
+func (Operation_Kind) EnumDescriptor() ([]byte, []int) { return fileDescriptor0, []int{32, 0} }
+
+type Operation_State int32
+
+const (
+	Operation_STATE_UNKNOWN Operation_State = 0
+	Operation_RUNNING       Operation_State = 1
+	Operation_SUCCEEDED     Operation_State = 2
+	Operation_FAILED        Operation_State = 3
+)
+
+var Operation_State_name = map[int32]string{
+	0: "STATE_UNKNOWN",
+	1: "RUNNING",
+	2: "SUCCEEDED",
+	3: "FAILED",
+}
+var Operation_State_value = map[string]int32{
+	"STATE_UNKNOWN": 0,
+	"RUNNING":       1,
+	"SUCCEEDED":     2,
+	"FAILED":        3,
+}
+
+func (x Operation_State) String() string {
+	return proto.EnumName(Operation_State_name, int32(x))
+}
+func (Operation_State) EnumDescriptor() ([]byte, []int) { return fileDescriptor0, []int{32, 1} }
+
+type OperationEvent_Status int32
+
+const (
+	OperationEvent_STATUS_UNKNOWN OperationEvent_Status = 0
+	OperationEvent_STARTED        OperationEvent_Status = 1
+	OperationEvent_SUCCEEDED      OperationEvent_Status = 2
+	OperationEvent_FAILED         OperationEvent_Status = 3
+	OperationEvent_PROGRESS       OperationEvent_Status = 4
+)
+
+var OperationEvent_Status_name = map[int32]string{
+	0: "STATUS_UNKNOWN",
+	1: "STARTED",
+	2: "SUCCEEDED",
+	3: "FAILED",
+	4: "PROGRESS",
+}
+var OperationEvent_Status_value = map[string]int32{
+	"STATUS_UNKNOWN": 0,
+	"STARTED":        1,
+	"SUCCEEDED":      2,
+	"FAILED":         3,
+	"PROGRESS":       4,
+}
+
+func (x OperationEvent_Status) String() string {
+	return proto.EnumName(OperationEvent_Status_name, int32(x))
+}
+func (OperationEvent_Status) EnumDescriptor() ([]byte, []int) { return fileDescriptor0, []int{33, 0} }
 
 type VersionRequest struct {
 }
@@ -106,6 +328,9 @@ func (*VersionRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []
 
 type VersionResponse struct {
 	Version string `protobuf:"bytes,1,opt,name=version" json:"version,omitempty"`
+	// Version of the protocol, see ProtocolVersion. 0 for daemons older than
+	// the handshake.
+	Protocol int32 `protobuf:"varint,2,opt,name=protocol" json:"protocol,omitempty"`
 }
 
 func (m *VersionResponse) Reset()                    { *m = VersionResponse{} }
@@ -120,6 +345,13 @@ func (m *VersionResponse) GetVersion() string {
 	return ""
 }
 
+func (m *VersionResponse) GetProtocol() int32 {
+	if m != nil {
+		return m.Protocol
+	}
+	return 0
+}
+
 type ParseRequest struct {
 	Kind    ParseRequest_Kind `protobuf:"varint,1,opt,name=kind,enum=ParseRequest_Kind" json:"kind,omitempty"`
 	Name    string            `protobuf:"bytes,2,opt,name=name" json:"name,omitempty"`
@@ -127,6 +359,10 @@ type ParseRequest struct {
 	// used for UAST and Native only
 	Lang  string `protobuf:"bytes,4,opt,name=lang" json:"lang,omitempty"`
 	Query string `protobuf:"bytes,5,opt,name=query" json:"query,omitempty"`
+	Mode  Mode   `protobuf:"varint,6,opt,name=mode,enum=Mode" json:"mode,omitempty"`
+	// Fail with FailedPrecondition instead of installing the driver when
+	// there is none installed for the language.
+	NoInstall bool `protobuf:"varint,7,opt,name=no_install,json=noInstall" json:"no_install,omitempty"`
 }
 
 func (m *ParseRequest) Reset()                    { *m = ParseRequest{} }
@@ -169,17 +405,123 @@ func (m *ParseRequest) GetQuery() string {
 	return ""
 }
 
+func (m *ParseRequest) GetMode() Mode {
+	if m != nil {
+		return m.Mode
+	}
+	return Mode_DEFAULT_MODE
+}
+
+func (m *ParseRequest) GetNoInstall() bool {
+	if m != nil {
+		return m.NoInstall
+	}
+	return false
+}
+
+type ParseFilesRequest struct {
+	// Identifies the file in its response, chosen by the client.
+	Id int64 `protobuf:"varint,1,opt,name=id" json:"id,omitempty"`
+	// The options of the file are the ones of ParseRequest.
+	File *ParseRequest `protobuf:"bytes,2,opt,name=file" json:"file,omitempty"`
+	// Maximum time to parse the file in milliseconds, no limit if 0.
+	TimeoutMs int64 `protobuf:"varint,3,opt,name=timeout_ms,json=timeoutMs" json:"timeout_ms,omitempty"`
+	// Maximum number of files parsed at once, only read from the first
+	// message. The daemon chooses it if 0, and caps it.
+	Jobs int32 `protobuf:"varint,4,opt,name=jobs" json:"jobs,omitempty"`
+}
+
+func (m *ParseFilesRequest) Reset()                    { *m = ParseFilesRequest{} }
+func (m *ParseFilesRequest) String() string            { return proto.CompactTextString(m) }
+func (*ParseFilesRequest) ProtoMessage()               {}
+func (*ParseFilesRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{3} }
+
+func (m *ParseFilesRequest) GetId() int64 {
+	if m != nil {
+		return m.Id
+	}
+	return 0
+}
+
+func (m *ParseFilesRequest) GetFile() *ParseRequest {
+	if m != nil {
+		return m.File
+	}
+	return nil
+}
+
+func (m *ParseFilesRequest) GetTimeoutMs() int64 {
+	if m != nil {
+		return m.TimeoutMs
+	}
+	return 0
+}
+
+func (m *ParseFilesRequest) GetJobs() int32 {
+	if m != nil {
+		return m.Jobs
+	}
+	return 0
+}
+
+type ParseFilesResponse struct {
+	Id int64 `protobuf:"varint,1,opt,name=id" json:"id,omitempty"`
+	// The gRPC code of the error parsing the file, OK if it was parsed, like
+	// FailedPrecondition when the driver is not installed and no_install was
+	// given, or DeadlineExceeded when it timed out.
+	Code  int32  `protobuf:"varint,2,opt,name=code" json:"code,omitempty"`
+	Error string `protobuf:"bytes,3,opt,name=error" json:"error,omitempty"`
+	// The result of the file when it was parsed, with the FINAL kind.
+	Result *ParseResponse `protobuf:"bytes,4,opt,name=result" json:"result,omitempty"`
+}
+
+func (m *ParseFilesResponse) Reset()                    { *m = ParseFilesResponse{} }
+func (m *ParseFilesResponse) String() string            { return proto.CompactTextString(m) }
+func (*ParseFilesResponse) ProtoMessage()               {}
+func (*ParseFilesResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{4} }
+
+func (m *ParseFilesResponse) GetId() int64 {
+	if m != nil {
+		return m.Id
+	}
+	return 0
+}
+
+func (m *ParseFilesResponse) GetCode() int32 {
+	if m != nil {
+		return m.Code
+	}
+	return 0
+}
+
+func (m *ParseFilesResponse) GetError() string {
+	if m != nil {
+		return m.Error
+	}
+	return ""
+}
+
+func (m *ParseFilesResponse) GetResult() *ParseResponse {
+	if m != nil {
+		return m.Result
+	}
+	return nil
+}
+
 type ParseResponse struct {
 	Kind ParseResponse_Kind `protobuf:"varint,1,opt,name=kind,enum=ParseResponse_Kind" json:"kind,omitempty"`
 	Lang string             `protobuf:"bytes,2,opt,name=lang" json:"lang,omitempty"`
 	Uast [][]byte           `protobuf:"bytes,3,rep,name=uast,proto3" json:"uast,omitempty"`
 	Log  string             `protobuf:"bytes,4,opt,name=log" json:"log,omitempty"`
+	// Mode of the UAST. Nodes in DEFAULT_MODE are encoded as the v1 protocol
+	// uast.Node messages, the rest as the v2 protocol binary UAST.
+	Mode Mode `protobuf:"varint,5,opt,name=mode,enum=Mode" json:"mode,omitempty"`
 }
 
 func (m *ParseResponse) Reset()                    { *m = ParseResponse{} }
 func (m *ParseResponse) String() string            { return proto.CompactTextString(m) }
 func (*ParseResponse) ProtoMessage()               {}
-func (*ParseResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{3} }
+func (*ParseResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{5} }
 
 func (m *ParseResponse) GetKind() ParseResponse_Kind {
 	if m != nil {
@@ -209,13 +551,44 @@ func (m *ParseResponse) GetLog() string {
 	return ""
 }
 
+func (m *ParseResponse) GetMode() Mode {
+	if m != nil {
+		return m.Mode
+	}
+	return Mode_DEFAULT_MODE
+}
+
+type ValidateQueryRequest struct {
+	Query string `protobuf:"bytes,1,opt,name=query" json:"query,omitempty"`
+}
+
+func (m *ValidateQueryRequest) Reset()                    { *m = ValidateQueryRequest{} }
+func (m *ValidateQueryRequest) String() string            { return proto.CompactTextString(m) }
+func (*ValidateQueryRequest) ProtoMessage()               {}
+func (*ValidateQueryRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{6} }
+
+func (m *ValidateQueryRequest) GetQuery() string {
+	if m != nil {
+		return m.Query
+	}
+	return ""
+}
+
+type ValidateQueryResponse struct {
+}
+
+func (m *ValidateQueryResponse) Reset()                    { *m = ValidateQueryResponse{} }
+func (m *ValidateQueryResponse) String() string            { return proto.CompactTextString(m) }
+func (*ValidateQueryResponse) ProtoMessage()               {}
+func (*ValidateQueryResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{7} }
+
 type ListDriversRequest struct {
 }
 
 func (m *ListDriversRequest) Reset()                    { *m = ListDriversRequest{} }
 func (m *ListDriversRequest) String() string            { return proto.CompactTextString(m) }
 func (*ListDriversRequest) ProtoMessage()               {}
-func (*ListDriversRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{4} }
+func (*ListDriversRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{8} }
 
 type ListDriversResponse struct {
 	Drivers []*ListDriversResponse_DriverInfo `protobuf:"bytes,1,rep,name=drivers" json:"drivers,omitempty"`
@@ -224,7 +597,7 @@ type ListDriversResponse struct {
 func (m *ListDriversResponse) Reset()                    { *m = ListDriversResponse{} }
 func (m *ListDriversResponse) String() string            { return proto.CompactTextString(m) }
 func (*ListDriversResponse) ProtoMessage()               {}
-func (*ListDriversResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{5} }
+func (*ListDriversResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{9} }
 
 func (m *ListDriversResponse) GetDrivers() []*ListDriversResponse_DriverInfo {
 	if m != nil {
@@ -242,7 +615,7 @@ func (m *ListDriversResponse_DriverInfo) Reset()         { *m = ListDriversRespo
 func (m *ListDriversResponse_DriverInfo) String() string { return proto.CompactTextString(m) }
 func (*ListDriversResponse_DriverInfo) ProtoMessage()    {}
 func (*ListDriversResponse_DriverInfo) Descriptor() ([]byte, []int) {
-	return fileDescriptor0, []int{5, 0}
+	return fileDescriptor0, []int{9, 0}
 }
 
 func (m *ListDriversResponse_DriverInfo) GetLang() string {
@@ -266,7 +639,7 @@ type SQLRequest struct {
 func (m *SQLRequest) Reset()                    { *m = SQLRequest{} }
 func (m *SQLRequest) String() string            { return proto.CompactTextString(m) }
 func (*SQLRequest) ProtoMessage()               {}
-func (*SQLRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{6} }
+func (*SQLRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{10} }
 
 func (m *SQLRequest) GetQuery() string {
 	if m != nil {
@@ -283,7 +656,7 @@ type SQLResponse struct {
 func (m *SQLResponse) Reset()                    { *m = SQLResponse{} }
 func (m *SQLResponse) String() string            { return proto.CompactTextString(m) }
 func (*SQLResponse) ProtoMessage()               {}
-func (*SQLResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{7} }
+func (*SQLResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{11} }
 
 func (m *SQLResponse) GetHeader() *SQLResponse_Row {
 	if m != nil {
@@ -306,7 +679,7 @@ type SQLResponse_Row struct {
 func (m *SQLResponse_Row) Reset()                    { *m = SQLResponse_Row{} }
 func (m *SQLResponse_Row) String() string            { return proto.CompactTextString(m) }
 func (*SQLResponse_Row) ProtoMessage()               {}
-func (*SQLResponse_Row) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{7, 0} }
+func (*SQLResponse_Row) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{11, 0} }
 
 func (m *SQLResponse_Row) GetCell() []string {
 	if m != nil {
@@ -318,12 +691,26 @@ func (m *SQLResponse_Row) GetCell() []string {
 type StartComponentRequest struct {
 	Name string `protobuf:"bytes,1,opt,name=name" json:"name,omitempty"`
 	Port int32  `protobuf:"varint,2,opt,name=port" json:"port,omitempty"`
+	// bind_address is the address of the host the web clients are published
+	// on, the loopback when empty.
+	BindAddress string `protobuf:"bytes,3,opt,name=bind_address,json=bindAddress" json:"bind_address,omitempty"`
+	// tls_cert and tls_key are the certificate and key in PEM the web
+	// clients are served with over HTTPS, through a proxy in front of them.
+	// They are served over HTTP when empty.
+	TlsCert string `protobuf:"bytes,4,opt,name=tls_cert,json=tlsCert" json:"tls_cert,omitempty"`
+	TlsKey  string `protobuf:"bytes,5,opt,name=tls_key,json=tlsKey" json:"tls_key,omitempty"`
+	// web_token is the token the requests to the web clients must have,
+	// checked by the proxy in front of them. Anyone can use them when empty.
+	WebToken string `protobuf:"bytes,6,opt,name=web_token,json=webToken" json:"web_token,omitempty"`
+	// web_base_path is the path the web client is served under behind a
+	// reverse proxy, like /engine/sql, at the root when empty.
+	WebBasePath string `protobuf:"bytes,7,opt,name=web_base_path,json=webBasePath" json:"web_base_path,omitempty"`
 }
 
 func (m *StartComponentRequest) Reset()                    { *m = StartComponentRequest{} }
 func (m *StartComponentRequest) String() string            { return proto.CompactTextString(m) }
 func (*StartComponentRequest) ProtoMessage()               {}
-func (*StartComponentRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{8} }
+func (*StartComponentRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{12} }
 
 func (m *StartComponentRequest) GetName() string {
 	if m != nil {
@@ -339,13 +726,48 @@ func (m *StartComponentRequest) GetPort() int32 {
 	return 0
 }
 
+func (m *StartComponentRequest) GetBindAddress() string {
+	if m != nil {
+		return m.BindAddress
+	}
+	return ""
+}
+
+func (m *StartComponentRequest) GetTlsCert() string {
+	if m != nil {
+		return m.TlsCert
+	}
+	return ""
+}
+
+func (m *StartComponentRequest) GetTlsKey() string {
+	if m != nil {
+		return m.TlsKey
+	}
+	return ""
+}
+
+func (m *StartComponentRequest) GetWebToken() string {
+	if m != nil {
+		return m.WebToken
+	}
+	return ""
+}
+
+func (m *StartComponentRequest) GetWebBasePath() string {
+	if m != nil {
+		return m.WebBasePath
+	}
+	return ""
+}
+
 type StartComponentResponse struct {
 }
 
 func (m *StartComponentResponse) Reset()                    { *m = StartComponentResponse{} }
 func (m *StartComponentResponse) String() string            { return proto.CompactTextString(m) }
 func (*StartComponentResponse) ProtoMessage()               {}
-func (*StartComponentResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{9} }
+func (*StartComponentResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{13} }
 
 type StopComponentRequest struct {
 	Name string `protobuf:"bytes,1,opt,name=name" json:"name,omitempty"`
@@ -354,7 +776,7 @@ type StopComponentRequest struct {
 func (m *StopComponentRequest) Reset()                    { *m = StopComponentRequest{} }
 func (m *StopComponentRequest) String() string            { return proto.CompactTextString(m) }
 func (*StopComponentRequest) ProtoMessage()               {}
-func (*StopComponentRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{10} }
+func (*StopComponentRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{14} }
 
 func (m *StopComponentRequest) GetName() string {
 	if m != nil {
@@ -369,17 +791,20 @@ type StopComponentResponse struct {
 func (m *StopComponentResponse) Reset()                    { *m = StopComponentResponse{} }
 func (m *StopComponentResponse) String() string            { return proto.CompactTextString(m) }
 func (*StopComponentResponse) ProtoMessage()               {}
-func (*StopComponentResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{11} }
+func (*StopComponentResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{15} }
 
 type VersionedDriver struct {
 	Language string `protobuf:"bytes,1,opt,name=language" json:"language,omitempty"`
 	Version  string `protobuf:"bytes,2,opt,name=version" json:"version,omitempty"`
+	// Path, in the container of bblfshd, of a tarball of the image of the
+	// driver written by docker save, installed instead of pulling the image.
+	Archive string `protobuf:"bytes,3,opt,name=archive" json:"archive,omitempty"`
 }
 
 func (m *VersionedDriver) Reset()                    { *m = VersionedDriver{} }
 func (m *VersionedDriver) String() string            { return proto.CompactTextString(m) }
 func (*VersionedDriver) ProtoMessage()               {}
-func (*VersionedDriver) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{12} }
+func (*VersionedDriver) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{16} }
 
 func (m *VersionedDriver) GetLanguage() string {
 	if m != nil {
@@ -395,13 +820,37 @@ func (m *VersionedDriver) GetVersion() string {
 	return ""
 }
 
+func (m *VersionedDriver) GetArchive() string {
+	if m != nil {
+		return m.Archive
+	}
+	return ""
+}
+
 type InstallDriverResponse struct {
+	// Image reference and version of the installed driver.
+	Image   string `protobuf:"bytes,1,opt,name=image" json:"image,omitempty"`
+	Version string `protobuf:"bytes,2,opt,name=version" json:"version,omitempty"`
 }
 
 func (m *InstallDriverResponse) Reset()                    { *m = InstallDriverResponse{} }
 func (m *InstallDriverResponse) String() string            { return proto.CompactTextString(m) }
 func (*InstallDriverResponse) ProtoMessage()               {}
-func (*InstallDriverResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{13} }
+func (*InstallDriverResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{17} }
+
+func (m *InstallDriverResponse) GetImage() string {
+	if m != nil {
+		return m.Image
+	}
+	return ""
+}
+
+func (m *InstallDriverResponse) GetVersion() string {
+	if m != nil {
+		return m.Version
+	}
+	return ""
+}
 
 type UpdateDriverResponse struct {
 }
@@ -409,7 +858,7 @@ type UpdateDriverResponse struct {
 func (m *UpdateDriverResponse) Reset()                    { *m = UpdateDriverResponse{} }
 func (m *UpdateDriverResponse) String() string            { return proto.CompactTextString(m) }
 func (*UpdateDriverResponse) ProtoMessage()               {}
-func (*UpdateDriverResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{14} }
+func (*UpdateDriverResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{18} }
 
 type RemoveDriverRequest struct {
 	Language string `protobuf:"bytes,1,opt,name=language" json:"language,omitempty"`
@@ -418,7 +867,7 @@ type RemoveDriverRequest struct {
 func (m *RemoveDriverRequest) Reset()                    { *m = RemoveDriverRequest{} }
 func (m *RemoveDriverRequest) String() string            { return proto.CompactTextString(m) }
 func (*RemoveDriverRequest) ProtoMessage()               {}
-func (*RemoveDriverRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{15} }
+func (*RemoveDriverRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{19} }
 
 func (m *RemoveDriverRequest) GetLanguage() string {
 	if m != nil {
@@ -427,19 +876,633 @@ func (m *RemoveDriverRequest) GetLanguage() string {
 	return ""
 }
 
-type RemoveDriverResponse struct {
+type RemoveDriverResponse struct {
+}
+
+func (m *RemoveDriverResponse) Reset()                    { *m = RemoveDriverResponse{} }
+func (m *RemoveDriverResponse) String() string            { return proto.CompactTextString(m) }
+func (*RemoveDriverResponse) ProtoMessage()               {}
+func (*RemoveDriverResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{20} }
+
+type SetLogLevelRequest struct {
+	// Level like debug, info, warning or error.
+	Level string `protobuf:"bytes,1,opt,name=level" json:"level,omitempty"`
+}
+
+func (m *SetLogLevelRequest) Reset()                    { *m = SetLogLevelRequest{} }
+func (m *SetLogLevelRequest) String() string            { return proto.CompactTextString(m) }
+func (*SetLogLevelRequest) ProtoMessage()               {}
+func (*SetLogLevelRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{21} }
+
+func (m *SetLogLevelRequest) GetLevel() string {
+	if m != nil {
+		return m.Level
+	}
+	return ""
+}
+
+type SetLogLevelResponse struct {
+	Level    string `protobuf:"bytes,1,opt,name=level" json:"level,omitempty"`
+	Previous string `protobuf:"bytes,2,opt,name=previous" json:"previous,omitempty"`
+}
+
+func (m *SetLogLevelResponse) Reset()                    { *m = SetLogLevelResponse{} }
+func (m *SetLogLevelResponse) String() string            { return proto.CompactTextString(m) }
+func (*SetLogLevelResponse) ProtoMessage()               {}
+func (*SetLogLevelResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{22} }
+
+func (m *SetLogLevelResponse) GetLevel() string {
+	if m != nil {
+		return m.Level
+	}
+	return ""
+}
+
+func (m *SetLogLevelResponse) GetPrevious() string {
+	if m != nil {
+		return m.Previous
+	}
+	return ""
+}
+
+// Limits of the parse requests handled at once by the daemon. The ones
+// waiting for a slot are served taking turns between the clients, and
+// rejected with ResourceExhausted when the queue is full or they wait for
+// longer than the timeout, with a retry-after trailer in seconds.
+type ParseLimits struct {
+	// Maximum number of files parsed at once.
+	Concurrency int32 `protobuf:"varint,1,opt,name=concurrency" json:"concurrency,omitempty"`
+	// Maximum number of requests waiting for a slot.
+	Queue int32 `protobuf:"varint,2,opt,name=queue" json:"queue,omitempty"`
+	// Maximum time a request waits for a slot in milliseconds.
+	QueueTimeoutMs int64 `protobuf:"varint,3,opt,name=queue_timeout_ms,json=queueTimeoutMs" json:"queue_timeout_ms,omitempty"`
+}
+
+func (m *ParseLimits) Reset()                    { *m = ParseLimits{} }
+func (m *ParseLimits) String() string            { return proto.CompactTextString(m) }
+func (*ParseLimits) ProtoMessage()               {}
+func (*ParseLimits) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{23} }
+
+func (m *ParseLimits) GetConcurrency() int32 {
+	if m != nil {
+		return m.Concurrency
+	}
+	return 0
+}
+
+func (m *ParseLimits) GetQueue() int32 {
+	if m != nil {
+		return m.Queue
+	}
+	return 0
+}
+
+func (m *ParseLimits) GetQueueTimeoutMs() int64 {
+	if m != nil {
+		return m.QueueTimeoutMs
+	}
+	return 0
+}
+
+type SetParseLimitsRequest struct {
+	// The limits not given, 0, are kept.
+	Limits *ParseLimits `protobuf:"bytes,1,opt,name=limits" json:"limits,omitempty"`
+}
+
+func (m *SetParseLimitsRequest) Reset()                    { *m = SetParseLimitsRequest{} }
+func (m *SetParseLimitsRequest) String() string            { return proto.CompactTextString(m) }
+func (*SetParseLimitsRequest) ProtoMessage()               {}
+func (*SetParseLimitsRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{24} }
+
+func (m *SetParseLimitsRequest) GetLimits() *ParseLimits {
+	if m != nil {
+		return m.Limits
+	}
+	return nil
+}
+
+type SetParseLimitsResponse struct {
+	Limits   *ParseLimits `protobuf:"bytes,1,opt,name=limits" json:"limits,omitempty"`
+	Previous *ParseLimits `protobuf:"bytes,2,opt,name=previous" json:"previous,omitempty"`
+	// The requests being parsed and waiting for a slot now.
+	InFlight int32 `protobuf:"varint,3,opt,name=in_flight,json=inFlight" json:"in_flight,omitempty"`
+	Queued   int32 `protobuf:"varint,4,opt,name=queued" json:"queued,omitempty"`
+}
+
+func (m *SetParseLimitsResponse) Reset()                    { *m = SetParseLimitsResponse{} }
+func (m *SetParseLimitsResponse) String() string            { return proto.CompactTextString(m) }
+func (*SetParseLimitsResponse) ProtoMessage()               {}
+func (*SetParseLimitsResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{25} }
+
+func (m *SetParseLimitsResponse) GetLimits() *ParseLimits {
+	if m != nil {
+		return m.Limits
+	}
+	return nil
+}
+
+func (m *SetParseLimitsResponse) GetPrevious() *ParseLimits {
+	if m != nil {
+		return m.Previous
+	}
+	return nil
+}
+
+func (m *SetParseLimitsResponse) GetInFlight() int32 {
+	if m != nil {
+		return m.InFlight
+	}
+	return 0
+}
+
+func (m *SetParseLimitsResponse) GetQueued() int32 {
+	if m != nil {
+		return m.Queued
+	}
+	return 0
+}
+
+type GetEnvironmentStatusRequest struct {
+}
+
+func (m *GetEnvironmentStatusRequest) Reset()                    { *m = GetEnvironmentStatusRequest{} }
+func (m *GetEnvironmentStatusRequest) String() string            { return proto.CompactTextString(m) }
+func (*GetEnvironmentStatusRequest) ProtoMessage()               {}
+func (*GetEnvironmentStatusRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{26} }
+
+type WatchEnvironmentStatusRequest struct {
+}
+
+func (m *WatchEnvironmentStatusRequest) Reset()                    { *m = WatchEnvironmentStatusRequest{} }
+func (m *WatchEnvironmentStatusRequest) String() string            { return proto.CompactTextString(m) }
+func (*WatchEnvironmentStatusRequest) ProtoMessage()               {}
+func (*WatchEnvironmentStatusRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{27} }
+
+// The status of the environment of the daemon. All the fields are optional,
+// and the enums have an unknown zero value, so clients must expect more
+// fields and values to be added.
+type EnvironmentStatus struct {
+	// The working directory of srcd init, and the other directories with
+	// repositories mounted in gitbase.
+	Workdir string   `protobuf:"bytes,1,opt,name=workdir" json:"workdir,omitempty"`
+	Repos   []string `protobuf:"bytes,2,rep,name=repos" json:"repos,omitempty"`
+	// Version of the engine of the daemon, and of the protocol it speaks.
+	Version    string             `protobuf:"bytes,3,opt,name=version" json:"version,omitempty"`
+	Protocol   int32              `protobuf:"varint,4,opt,name=protocol" json:"protocol,omitempty"`
+	Components []*ComponentStatus `protobuf:"bytes,5,rep,name=components" json:"components,omitempty"`
+	Addresses  []*Address         `protobuf:"bytes,6,rep,name=addresses" json:"addresses,omitempty"`
+	Problems   []*Problem         `protobuf:"bytes,7,rep,name=problems" json:"problems,omitempty"`
+	// No problem was found.
+	Healthy bool `protobuf:"varint,8,opt,name=healthy" json:"healthy,omitempty"`
+}
+
+func (m *EnvironmentStatus) Reset()                    { *m = EnvironmentStatus{} }
+func (m *EnvironmentStatus) String() string            { return proto.CompactTextString(m) }
+func (*EnvironmentStatus) ProtoMessage()               {}
+func (*EnvironmentStatus) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{28} }
+
+func (m *EnvironmentStatus) GetWorkdir() string {
+	if m != nil {
+		return m.Workdir
+	}
+	return ""
+}
+
+func (m *EnvironmentStatus) GetRepos() []string {
+	if m != nil {
+		return m.Repos
+	}
+	return nil
+}
+
+func (m *EnvironmentStatus) GetVersion() string {
+	if m != nil {
+		return m.Version
+	}
+	return ""
+}
+
+func (m *EnvironmentStatus) GetProtocol() int32 {
+	if m != nil {
+		return m.Protocol
+	}
+	return 0
+}
+
+func (m *EnvironmentStatus) GetComponents() []*ComponentStatus {
+	if m != nil {
+		return m.Components
+	}
+	return nil
+}
+
+func (m *EnvironmentStatus) GetAddresses() []*Address {
+	if m != nil {
+		return m.Addresses
+	}
+	return nil
+}
+
+func (m *EnvironmentStatus) GetProblems() []*Problem {
+	if m != nil {
+		return m.Problems
+	}
+	return nil
+}
+
+func (m *EnvironmentStatus) GetHealthy() bool {
+	if m != nil {
+		return m.Healthy
+	}
+	return false
+}
+
+type ComponentStatus struct {
+	// Short name of the component, like gitbase.
+	Name  string `protobuf:"bytes,1,opt,name=name" json:"name,omitempty"`
+	Image string `protobuf:"bytes,2,opt,name=image" json:"image,omitempty"`
+	// Tag of the image of the container, or the one it would be created with.
+	Tag string `protobuf:"bytes,3,opt,name=tag" json:"tag,omitempty"`
+	// The image of the component is installed.
+	Installed bool                   `protobuf:"varint,4,opt,name=installed" json:"installed,omitempty"`
+	State     ComponentStatus_State  `protobuf:"varint,5,opt,name=state,enum=ComponentStatus_State" json:"state,omitempty"`
+	Health    ComponentStatus_Health `protobuf:"varint,6,opt,name=health,enum=ComponentStatus_Health" json:"health,omitempty"`
+	// Reference of the image replacing the default one, if any.
+	Override string `protobuf:"bytes,7,opt,name=override" json:"override,omitempty"`
+	// Unix time in milliseconds the container started at, 0 if it's not
+	// running.
+	StartedAtMs int64 `protobuf:"varint,8,opt,name=started_at_ms,json=startedAtMs" json:"started_at_ms,omitempty"`
+	// Ports published on the host, like 8080->80/tcp.
+	Ports []string `protobuf:"bytes,9,rep,name=ports" json:"ports,omitempty"`
+}
+
+func (m *ComponentStatus) Reset()                    { *m = ComponentStatus{} }
+func (m *ComponentStatus) String() string            { return proto.CompactTextString(m) }
+func (*ComponentStatus) ProtoMessage()               {}
+func (*ComponentStatus) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{29} }
+
+func (m *ComponentStatus) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *ComponentStatus) GetImage() string {
+	if m != nil {
+		return m.Image
+	}
+	return ""
+}
+
+func (m *ComponentStatus) GetTag() string {
+	if m != nil {
+		return m.Tag
+	}
+	return ""
+}
+
+func (m *ComponentStatus) GetInstalled() bool {
+	if m != nil {
+		return m.Installed
+	}
+	return false
+}
+
+func (m *ComponentStatus) GetState() ComponentStatus_State {
+	if m != nil {
+		return m.State
+	}
+	return ComponentStatus_STATE_UNKNOWN
+}
+
+func (m *ComponentStatus) GetHealth() ComponentStatus_Health {
+	if m != nil {
+		return m.Health
+	}
+	return ComponentStatus_HEALTH_UNKNOWN
+}
+
+func (m *ComponentStatus) GetOverride() string {
+	if m != nil {
+		return m.Override
+	}
+	return ""
+}
+
+func (m *ComponentStatus) GetStartedAtMs() int64 {
+	if m != nil {
+		return m.StartedAtMs
+	}
+	return 0
+}
+
+func (m *ComponentStatus) GetPorts() []string {
+	if m != nil {
+		return m.Ports
+	}
+	return nil
+}
+
+// Where a component running can be connected to.
+type Address struct {
+	Component string `protobuf:"bytes,1,opt,name=component" json:"component,omitempty"`
+	// What the address is for, like gitbase DSN.
+	Description string `protobuf:"bytes,2,opt,name=description" json:"description,omitempty"`
+	Address     string `protobuf:"bytes,3,opt,name=address" json:"address,omitempty"`
+}
+
+func (m *Address) Reset()                    { *m = Address{} }
+func (m *Address) String() string            { return proto.CompactTextString(m) }
+func (*Address) ProtoMessage()               {}
+func (*Address) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{30} }
+
+func (m *Address) GetComponent() string {
+	if m != nil {
+		return m.Component
+	}
+	return ""
+}
+
+func (m *Address) GetDescription() string {
+	if m != nil {
+		return m.Description
+	}
+	return ""
+}
+
+func (m *Address) GetAddress() string {
+	if m != nil {
+		return m.Address
+	}
+	return ""
+}
+
+type Problem struct {
+	// What was checked, like health or dependencies.
+	Check    string           `protobuf:"bytes,1,opt,name=check" json:"check,omitempty"`
+	Severity Problem_Severity `protobuf:"varint,2,opt,name=severity,enum=Problem_Severity" json:"severity,omitempty"`
+	Message  string           `protobuf:"bytes,3,opt,name=message" json:"message,omitempty"`
+	// How to fix it.
+	Hint string `protobuf:"bytes,4,opt,name=hint" json:"hint,omitempty"`
+}
+
+func (m *Problem) Reset()                    { *m = Problem{} }
+func (m *Problem) String() string            { return proto.CompactTextString(m) }
+func (*Problem) ProtoMessage()               {}
+func (*Problem) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{31} }
+
+func (m *Problem) GetCheck() string {
+	if m != nil {
+		return m.Check
+	}
+	return ""
+}
+
+func (m *Problem) GetSeverity() Problem_Severity {
+	if m != nil {
+		return m.Severity
+	}
+	return Problem_SEVERITY_UNKNOWN
+}
+
+func (m *Problem) GetMessage() string {
+	if m != nil {
+		return m.Message
+	}
+	return ""
+}
+
+func (m *Problem) GetHint() string {
+	if m != nil {
+		return m.Hint
+	}
+	return ""
+}
+
+// A long operation run by the daemon in the background, made of steps.
+type Operation struct {
+	Id    string          `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
+	Kind  Operation_Kind  `protobuf:"varint,2,opt,name=kind,enum=Operation_Kind" json:"kind,omitempty"`
+	State Operation_State `protobuf:"varint,3,opt,name=state,enum=Operation_State" json:"state,omitempty"`
+	// Why the operation failed.
+	Error string `protobuf:"bytes,4,opt,name=error" json:"error,omitempty"`
+	// Unix times in milliseconds the operation started and finished at, 0 if
+	// it's running.
+	StartedAtMs  int64             `protobuf:"varint,5,opt,name=started_at_ms,json=startedAtMs" json:"started_at_ms,omitempty"`
+	FinishedAtMs int64             `protobuf:"varint,6,opt,name=finished_at_ms,json=finishedAtMs" json:"finished_at_ms,omitempty"`
+	Events       []*OperationEvent `protobuf:"bytes,7,rep,name=events" json:"events,omitempty"`
+}
+
+func (m *Operation) Reset()                    { *m = Operation{} }
+func (m *Operation) String() string            { return proto.CompactTextString(m) }
+func (*Operation) ProtoMessage()               {}
+func (*Operation) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{32} }
+
+func (m *Operation) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+func (m *Operation) GetKind() Operation_Kind {
+	if m != nil {
+		return m.Kind
+	}
+	return Operation_KIND_UNKNOWN
+}
+
+func (m *Operation) GetState() Operation_State {
+	if m != nil {
+		return m.State
+	}
+	return Operation_STATE_UNKNOWN
+}
+
+func (m *Operation) GetError() string {
+	if m != nil {
+		return m.Error
+	}
+	return ""
+}
+
+func (m *Operation) GetStartedAtMs() int64 {
+	if m != nil {
+		return m.StartedAtMs
+	}
+	return 0
+}
+
+func (m *Operation) GetFinishedAtMs() int64 {
+	if m != nil {
+		return m.FinishedAtMs
+	}
+	return 0
+}
+
+func (m *Operation) GetEvents() []*OperationEvent {
+	if m != nil {
+		return m.Events
+	}
+	return nil
+}
+
+// An event of an operation, the same the CLI prints with --json-progress: a
+// step starting or finishing, or the progress of a step.
+type OperationEvent struct {
+	// Name of the step, empty in the last event of the operation.
+	Step   string                `protobuf:"bytes,1,opt,name=step" json:"step,omitempty"`
+	Status OperationEvent_Status `protobuf:"varint,2,opt,name=status,enum=OperationEvent_Status" json:"status,omitempty"`
+	// State of the operation after the event, SUCCEEDED or FAILED in the
+	// last one.
+	State Operation_State `protobuf:"varint,3,opt,name=state,enum=Operation_State" json:"state,omitempty"`
+	// Unix time in milliseconds of the event.
+	TimeMs int64 `protobuf:"varint,4,opt,name=time_ms,json=timeMs" json:"time_ms,omitempty"`
+	// Time the step took, or the operation in the last event.
+	DurationMs int64  `protobuf:"varint,5,opt,name=duration_ms,json=durationMs" json:"duration_ms,omitempty"`
+	Error      string `protobuf:"bytes,6,opt,name=error" json:"error,omitempty"`
+	// Last lines of the logs of the container involved in a step that failed.
+	Logs []string `protobuf:"bytes,7,rep,name=logs" json:"logs,omitempty"`
+	// Progress of the step, done out of total, in PROGRESS events.
+	Done  int64 `protobuf:"varint,8,opt,name=done" json:"done,omitempty"`
+	Total int64 `protobuf:"varint,9,opt,name=total" json:"total,omitempty"`
+}
+
+func (m *OperationEvent) Reset()                    { *m = OperationEvent{} }
+func (m *OperationEvent) String() string            { return proto.CompactTextString(m) }
+func (*OperationEvent) ProtoMessage()               {}
+func (*OperationEvent) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{33} }
+
+func (m *OperationEvent) GetStep() string {
+	if m != nil {
+		return m.Step
+	}
+	return ""
+}
+
+func (m *OperationEvent) GetStatus() OperationEvent_Status {
+	if m != nil {
+		return m.Status
+	}
+	return OperationEvent_STATUS_UNKNOWN
+}
+
+func (m *OperationEvent) GetState() Operation_State {
+	if m != nil {
+		return m.State
+	}
+	return Operation_STATE_UNKNOWN
+}
+
+func (m *OperationEvent) GetTimeMs() int64 {
+	if m != nil {
+		return m.TimeMs
+	}
+	return 0
+}
+
+func (m *OperationEvent) GetDurationMs() int64 {
+	if m != nil {
+		return m.DurationMs
+	}
+	return 0
+}
+
+func (m *OperationEvent) GetError() string {
+	if m != nil {
+		return m.Error
+	}
+	return ""
+}
+
+func (m *OperationEvent) GetLogs() []string {
+	if m != nil {
+		return m.Logs
+	}
+	return nil
+}
+
+func (m *OperationEvent) GetDone() int64 {
+	if m != nil {
+		return m.Done
+	}
+	return 0
+}
+
+func (m *OperationEvent) GetTotal() int64 {
+	if m != nil {
+		return m.Total
+	}
+	return 0
+}
+
+type StartOperationRequest struct {
+	Kind Operation_Kind `protobuf:"varint,1,opt,name=kind,enum=Operation_Kind" json:"kind,omitempty"`
+	// The drivers of INSTALL_DRIVERS and UPDATE_DRIVERS.
+	Drivers []*VersionedDriver `protobuf:"bytes,2,rep,name=drivers" json:"drivers,omitempty"`
+}
+
+func (m *StartOperationRequest) Reset()                    { *m = StartOperationRequest{} }
+func (m *StartOperationRequest) String() string            { return proto.CompactTextString(m) }
+func (*StartOperationRequest) ProtoMessage()               {}
+func (*StartOperationRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{34} }
+
+func (m *StartOperationRequest) GetKind() Operation_Kind {
+	if m != nil {
+		return m.Kind
+	}
+	return Operation_KIND_UNKNOWN
+}
+
+func (m *StartOperationRequest) GetDrivers() []*VersionedDriver {
+	if m != nil {
+		return m.Drivers
+	}
+	return nil
+}
+
+type GetOperationRequest struct {
+	Id string `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
+}
+
+func (m *GetOperationRequest) Reset()                    { *m = GetOperationRequest{} }
+func (m *GetOperationRequest) String() string            { return proto.CompactTextString(m) }
+func (*GetOperationRequest) ProtoMessage()               {}
+func (*GetOperationRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{35} }
+
+func (m *GetOperationRequest) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+type WatchOperationRequest struct {
+	Id string `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
 }
 
-func (m *RemoveDriverResponse) Reset()                    { *m = RemoveDriverResponse{} }
-func (m *RemoveDriverResponse) String() string            { return proto.CompactTextString(m) }
-func (*RemoveDriverResponse) ProtoMessage()               {}
-func (*RemoveDriverResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{16} }
+func (m *WatchOperationRequest) Reset()                    { *m = WatchOperationRequest{} }
+func (m *WatchOperationRequest) String() string            { return proto.CompactTextString(m) }
+func (*WatchOperationRequest) ProtoMessage()               {}
+func (*WatchOperationRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{36} }
+
+func (m *WatchOperationRequest) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
 
 func init() {
 	proto.RegisterType((*VersionRequest)(nil), "VersionRequest")
 	proto.RegisterType((*VersionResponse)(nil), "VersionResponse")
 	proto.RegisterType((*ParseRequest)(nil), "ParseRequest")
+	proto.RegisterType((*ParseFilesRequest)(nil), "ParseFilesRequest")
+	proto.RegisterType((*ParseFilesResponse)(nil), "ParseFilesResponse")
 	proto.RegisterType((*ParseResponse)(nil), "ParseResponse")
+	proto.RegisterType((*ValidateQueryRequest)(nil), "ValidateQueryRequest")
+	proto.RegisterType((*ValidateQueryResponse)(nil), "ValidateQueryResponse")
 	proto.RegisterType((*ListDriversRequest)(nil), "ListDriversRequest")
 	proto.RegisterType((*ListDriversResponse)(nil), "ListDriversResponse")
 	proto.RegisterType((*ListDriversResponse_DriverInfo)(nil), "ListDriversResponse.DriverInfo")
@@ -455,8 +1518,31 @@ func init() {
 	proto.RegisterType((*UpdateDriverResponse)(nil), "UpdateDriverResponse")
 	proto.RegisterType((*RemoveDriverRequest)(nil), "RemoveDriverRequest")
 	proto.RegisterType((*RemoveDriverResponse)(nil), "RemoveDriverResponse")
+	proto.RegisterType((*SetLogLevelRequest)(nil), "SetLogLevelRequest")
+	proto.RegisterType((*SetLogLevelResponse)(nil), "SetLogLevelResponse")
+	proto.RegisterType((*ParseLimits)(nil), "ParseLimits")
+	proto.RegisterType((*SetParseLimitsRequest)(nil), "SetParseLimitsRequest")
+	proto.RegisterType((*SetParseLimitsResponse)(nil), "SetParseLimitsResponse")
+	proto.RegisterType((*GetEnvironmentStatusRequest)(nil), "GetEnvironmentStatusRequest")
+	proto.RegisterType((*WatchEnvironmentStatusRequest)(nil), "WatchEnvironmentStatusRequest")
+	proto.RegisterType((*EnvironmentStatus)(nil), "EnvironmentStatus")
+	proto.RegisterType((*ComponentStatus)(nil), "ComponentStatus")
+	proto.RegisterType((*Address)(nil), "Address")
+	proto.RegisterType((*Problem)(nil), "Problem")
+	proto.RegisterType((*Operation)(nil), "Operation")
+	proto.RegisterType((*OperationEvent)(nil), "OperationEvent")
+	proto.RegisterType((*StartOperationRequest)(nil), "StartOperationRequest")
+	proto.RegisterType((*GetOperationRequest)(nil), "GetOperationRequest")
+	proto.RegisterType((*WatchOperationRequest)(nil), "WatchOperationRequest")
+	proto.RegisterEnum("Mode", Mode_name, Mode_value)
 	proto.RegisterEnum("ParseRequest_Kind", ParseRequest_Kind_name, ParseRequest_Kind_value)
 	proto.RegisterEnum("ParseResponse_Kind", ParseResponse_Kind_name, ParseResponse_Kind_value)
+	proto.RegisterEnum("ComponentStatus_State", ComponentStatus_State_name, ComponentStatus_State_value)
+	proto.RegisterEnum("ComponentStatus_Health", ComponentStatus_Health_name, ComponentStatus_Health_value)
+	proto.RegisterEnum("Problem_Severity", Problem_Severity_name, Problem_Severity_value)
+	proto.RegisterEnum("Operation_Kind", Operation_Kind_name, Operation_Kind_value)
+	proto.RegisterEnum("Operation_State", Operation_State_name, Operation_State_value)
+	proto.RegisterEnum("OperationEvent_Status", OperationEvent_Status_name, OperationEvent_Status_value)
 }
 
 // Reference imports to suppress errors if they are not otherwise used.
@@ -470,11 +1556,20 @@ const _ = grpc.SupportPackageIsVersion4
 // Client API for Engine service
 
 type EngineClient interface {
+	// The version of the daemon and of the protocol it speaks, called by the
+	// CLI when it connects to check they are compatible.
 	Version(ctx context.Context, in *VersionRequest, opts ...grpc.CallOption) (*VersionResponse, error)
 	// A single response with the parsing result.
 	Parse(ctx context.Context, in *ParseRequest, opts ...grpc.CallOption) (*ParseResponse, error)
 	// A stream of responses with logs and finally the parsing result.
 	ParseWithLogs(ctx context.Context, in *ParseRequest, opts ...grpc.CallOption) (Engine_ParseWithLogsClient, error)
+	// Parse many files over a single stream. The client sends the files, and
+	// the daemon sends back the result of every one as soon as it's parsed,
+	// with the same id, parsing several at once. Closing the client stream
+	// signals there are no more files.
+	ParseFiles(ctx context.Context, opts ...grpc.CallOption) (Engine_ParseFilesClient, error)
+	// Check that an XPath query is valid before parsing anything with it.
+	ValidateQuery(ctx context.Context, in *ValidateQueryRequest, opts ...grpc.CallOption) (*ValidateQueryResponse, error)
 	// Driver management.
 	// List all drivers.
 	ListDrivers(ctx context.Context, in *ListDriversRequest, opts ...grpc.CallOption) (*ListDriversResponse, error)
@@ -490,6 +1585,30 @@ type EngineClient interface {
 	StartComponent(ctx context.Context, in *StartComponentRequest, opts ...grpc.CallOption) (*StartComponentResponse, error)
 	// Stop a component.
 	StopComponent(ctx context.Context, in *StopComponentRequest, opts ...grpc.CallOption) (*StopComponentResponse, error)
+	// Change the level of the logs of the daemon until it's recreated, or
+	// only get it if the level requested is empty.
+	SetLogLevel(ctx context.Context, in *SetLogLevelRequest, opts ...grpc.CallOption) (*SetLogLevelResponse, error)
+	// Change the limits of the parse requests handled at once until the
+	// daemon is recreated, or only get them and the requests handled now if
+	// none is given.
+	SetParseLimits(ctx context.Context, in *SetParseLimitsRequest, opts ...grpc.CallOption) (*SetParseLimitsResponse, error)
+	// The status of the environment the daemon runs in, the same srcd status
+	// prints: the working directory, the state of every component, their
+	// addresses and the problems found.
+	GetEnvironmentStatus(ctx context.Context, in *GetEnvironmentStatusRequest, opts ...grpc.CallOption) (*EnvironmentStatus, error)
+	// A stream with the status of the environment now, and again every time
+	// the containers of the components change their state or health.
+	WatchEnvironmentStatus(ctx context.Context, in *WatchEnvironmentStatusRequest, opts ...grpc.CallOption) (Engine_WatchEnvironmentStatusClient, error)
+	// Start a long operation, like installing drivers, in the background and
+	// return it right away with its id. It goes on if the client disconnects.
+	StartOperation(ctx context.Context, in *StartOperationRequest, opts ...grpc.CallOption) (*Operation, error)
+	// The operation with the given id, with all its events so far. The ones
+	// finished are kept for a while, and then not found.
+	GetOperation(ctx context.Context, in *GetOperationRequest, opts ...grpc.CallOption) (*Operation, error)
+	// A stream with the events of the operation with the given id, the ones
+	// so far and then the new ones as they happen, until the last one of the
+	// operation succeeding or failing.
+	WatchOperation(ctx context.Context, in *WatchOperationRequest, opts ...grpc.CallOption) (Engine_WatchOperationClient, error)
 }
 
 type engineClient struct {
@@ -550,6 +1669,46 @@ func (x *engineParseWithLogsClient) Recv() (*ParseResponse, error) {
 	return m, nil
 }
 
+func (c *engineClient) ParseFiles(ctx context.Context, opts ...grpc.CallOption) (Engine_ParseFilesClient, error) {
+	stream, err := grpc.NewClientStream(ctx, &_Engine_serviceDesc.Streams[1], c.cc, "/Engine/ParseFiles", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &engineParseFilesClient{stream}
+	return x, nil
+}
+
+type Engine_ParseFilesClient interface {
+	Send(*ParseFilesRequest) error
+	Recv() (*ParseFilesResponse, error)
+	grpc.ClientStream
+}
+
+type engineParseFilesClient struct {
+	grpc.ClientStream
+}
+
+func (x *engineParseFilesClient) Send(m *ParseFilesRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *engineParseFilesClient) Recv() (*ParseFilesResponse, error) {
+	m := new(ParseFilesResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *engineClient) ValidateQuery(ctx context.Context, in *ValidateQueryRequest, opts ...grpc.CallOption) (*ValidateQueryResponse, error) {
+	out := new(ValidateQueryResponse)
+	err := grpc.Invoke(ctx, "/Engine/ValidateQuery", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *engineClient) ListDrivers(ctx context.Context, in *ListDriversRequest, opts ...grpc.CallOption) (*ListDriversResponse, error) {
 	out := new(ListDriversResponse)
 	err := grpc.Invoke(ctx, "/Engine/ListDrivers", in, out, c.cc, opts...)
@@ -613,14 +1772,132 @@ func (c *engineClient) StopComponent(ctx context.Context, in *StopComponentReque
 	return out, nil
 }
 
+func (c *engineClient) SetLogLevel(ctx context.Context, in *SetLogLevelRequest, opts ...grpc.CallOption) (*SetLogLevelResponse, error) {
+	out := new(SetLogLevelResponse)
+	err := grpc.Invoke(ctx, "/Engine/SetLogLevel", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *engineClient) SetParseLimits(ctx context.Context, in *SetParseLimitsRequest, opts ...grpc.CallOption) (*SetParseLimitsResponse, error) {
+	out := new(SetParseLimitsResponse)
+	err := grpc.Invoke(ctx, "/Engine/SetParseLimits", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *engineClient) GetEnvironmentStatus(ctx context.Context, in *GetEnvironmentStatusRequest, opts ...grpc.CallOption) (*EnvironmentStatus, error) {
+	out := new(EnvironmentStatus)
+	err := grpc.Invoke(ctx, "/Engine/GetEnvironmentStatus", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *engineClient) WatchEnvironmentStatus(ctx context.Context, in *WatchEnvironmentStatusRequest, opts ...grpc.CallOption) (Engine_WatchEnvironmentStatusClient, error) {
+	stream, err := grpc.NewClientStream(ctx, &_Engine_serviceDesc.Streams[2], c.cc, "/Engine/WatchEnvironmentStatus", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &engineWatchEnvironmentStatusClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Engine_WatchEnvironmentStatusClient interface {
+	Recv() (*EnvironmentStatus, error)
+	grpc.ClientStream
+}
+
+type engineWatchEnvironmentStatusClient struct {
+	grpc.ClientStream
+}
+
+func (x *engineWatchEnvironmentStatusClient) Recv() (*EnvironmentStatus, error) {
+	m := new(EnvironmentStatus)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *engineClient) StartOperation(ctx context.Context, in *StartOperationRequest, opts ...grpc.CallOption) (*Operation, error) {
+	out := new(Operation)
+	err := grpc.Invoke(ctx, "/Engine/StartOperation", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *engineClient) GetOperation(ctx context.Context, in *GetOperationRequest, opts ...grpc.CallOption) (*Operation, error) {
+	out := new(Operation)
+	err := grpc.Invoke(ctx, "/Engine/GetOperation", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *engineClient) WatchOperation(ctx context.Context, in *WatchOperationRequest, opts ...grpc.CallOption) (Engine_WatchOperationClient, error) {
+	stream, err := grpc.NewClientStream(ctx, &_Engine_serviceDesc.Streams[3], c.cc, "/Engine/WatchOperation", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &engineWatchOperationClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Engine_WatchOperationClient interface {
+	Recv() (*OperationEvent, error)
+	grpc.ClientStream
+}
+
+type engineWatchOperationClient struct {
+	grpc.ClientStream
+}
+
+func (x *engineWatchOperationClient) Recv() (*OperationEvent, error) {
+	m := new(OperationEvent)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // Server API for Engine service
 
 type EngineServer interface {
+	// The version of the daemon and of the protocol it speaks, called by the
+	// CLI when it connects to check they are compatible.
 	Version(context.Context, *VersionRequest) (*VersionResponse, error)
 	// A single response with the parsing result.
 	Parse(context.Context, *ParseRequest) (*ParseResponse, error)
 	// A stream of responses with logs and finally the parsing result.
 	ParseWithLogs(*ParseRequest, Engine_ParseWithLogsServer) error
+	// Parse many files over a single stream. The client sends the files, and
+	// the daemon sends back the result of every one as soon as it's parsed,
+	// with the same id, parsing several at once. Closing the client stream
+	// signals there are no more files.
+	ParseFiles(Engine_ParseFilesServer) error
+	// Check that an XPath query is valid before parsing anything with it.
+	ValidateQuery(context.Context, *ValidateQueryRequest) (*ValidateQueryResponse, error)
 	// Driver management.
 	// List all drivers.
 	ListDrivers(context.Context, *ListDriversRequest) (*ListDriversResponse, error)
@@ -636,6 +1913,30 @@ type EngineServer interface {
 	StartComponent(context.Context, *StartComponentRequest) (*StartComponentResponse, error)
 	// Stop a component.
 	StopComponent(context.Context, *StopComponentRequest) (*StopComponentResponse, error)
+	// Change the level of the logs of the daemon until it's recreated, or
+	// only get it if the level requested is empty.
+	SetLogLevel(context.Context, *SetLogLevelRequest) (*SetLogLevelResponse, error)
+	// Change the limits of the parse requests handled at once until the
+	// daemon is recreated, or only get them and the requests handled now if
+	// none is given.
+	SetParseLimits(context.Context, *SetParseLimitsRequest) (*SetParseLimitsResponse, error)
+	// The status of the environment the daemon runs in, the same srcd status
+	// prints: the working directory, the state of every component, their
+	// addresses and the problems found.
+	GetEnvironmentStatus(context.Context, *GetEnvironmentStatusRequest) (*EnvironmentStatus, error)
+	// A stream with the status of the environment now, and again every time
+	// the containers of the components change their state or health.
+	WatchEnvironmentStatus(*WatchEnvironmentStatusRequest, Engine_WatchEnvironmentStatusServer) error
+	// Start a long operation, like installing drivers, in the background and
+	// return it right away with its id. It goes on if the client disconnects.
+	StartOperation(context.Context, *StartOperationRequest) (*Operation, error)
+	// The operation with the given id, with all its events so far. The ones
+	// finished are kept for a while, and then not found.
+	GetOperation(context.Context, *GetOperationRequest) (*Operation, error)
+	// A stream with the events of the operation with the given id, the ones
+	// so far and then the new ones as they happen, until the last one of the
+	// operation succeeding or failing.
+	WatchOperation(*WatchOperationRequest, Engine_WatchOperationServer) error
 }
 
 func RegisterEngineServer(s *grpc.Server, srv EngineServer) {
@@ -699,6 +2000,50 @@ func (x *engineParseWithLogsServer) Send(m *ParseResponse) error {
 	return x.ServerStream.SendMsg(m)
 }
 
+func _Engine_ParseFiles_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(EngineServer).ParseFiles(&engineParseFilesServer{stream})
+}
+
+type Engine_ParseFilesServer interface {
+	Send(*ParseFilesResponse) error
+	Recv() (*ParseFilesRequest, error)
+	grpc.ServerStream
+}
+
+type engineParseFilesServer struct {
+	grpc.ServerStream
+}
+
+func (x *engineParseFilesServer) Send(m *ParseFilesResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *engineParseFilesServer) Recv() (*ParseFilesRequest, error) {
+	m := new(ParseFilesRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _Engine_ValidateQuery_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ValidateQueryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EngineServer).ValidateQuery(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Engine/ValidateQuery",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EngineServer).ValidateQuery(ctx, req.(*ValidateQueryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _Engine_ListDrivers_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(ListDriversRequest)
 	if err := dec(in); err != nil {
@@ -825,6 +2170,138 @@ func _Engine_StopComponent_Handler(srv interface{}, ctx context.Context, dec fun
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Engine_SetLogLevel_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetLogLevelRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EngineServer).SetLogLevel(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Engine/SetLogLevel",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EngineServer).SetLogLevel(ctx, req.(*SetLogLevelRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Engine_SetParseLimits_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetParseLimitsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EngineServer).SetParseLimits(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Engine/SetParseLimits",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EngineServer).SetParseLimits(ctx, req.(*SetParseLimitsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Engine_GetEnvironmentStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetEnvironmentStatusRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EngineServer).GetEnvironmentStatus(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Engine/GetEnvironmentStatus",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EngineServer).GetEnvironmentStatus(ctx, req.(*GetEnvironmentStatusRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Engine_WatchEnvironmentStatus_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchEnvironmentStatusRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(EngineServer).WatchEnvironmentStatus(m, &engineWatchEnvironmentStatusServer{stream})
+}
+
+type Engine_WatchEnvironmentStatusServer interface {
+	Send(*EnvironmentStatus) error
+	grpc.ServerStream
+}
+
+type engineWatchEnvironmentStatusServer struct {
+	grpc.ServerStream
+}
+
+func (x *engineWatchEnvironmentStatusServer) Send(m *EnvironmentStatus) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Engine_StartOperation_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StartOperationRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EngineServer).StartOperation(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Engine/StartOperation",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EngineServer).StartOperation(ctx, req.(*StartOperationRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Engine_GetOperation_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetOperationRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EngineServer).GetOperation(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Engine/GetOperation",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EngineServer).GetOperation(ctx, req.(*GetOperationRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Engine_WatchOperation_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchOperationRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(EngineServer).WatchOperation(m, &engineWatchOperationServer{stream})
+}
+
+type Engine_WatchOperationServer interface {
+	Send(*OperationEvent) error
+	grpc.ServerStream
+}
+
+type engineWatchOperationServer struct {
+	grpc.ServerStream
+}
+
+func (x *engineWatchOperationServer) Send(m *OperationEvent) error {
+	return x.ServerStream.SendMsg(m)
+}
+
 var _Engine_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "Engine",
 	HandlerType: (*EngineServer)(nil),
@@ -837,6 +2314,10 @@ var _Engine_serviceDesc = grpc.ServiceDesc{
 			MethodName: "Parse",
 			Handler:    _Engine_Parse_Handler,
 		},
+		{
+			MethodName: "ValidateQuery",
+			Handler:    _Engine_ValidateQuery_Handler,
+		},
 		{
 			MethodName: "ListDrivers",
 			Handler:    _Engine_ListDrivers_Handler,
@@ -865,6 +2346,26 @@ var _Engine_serviceDesc = grpc.ServiceDesc{
 			MethodName: "StopComponent",
 			Handler:    _Engine_StopComponent_Handler,
 		},
+		{
+			MethodName: "SetLogLevel",
+			Handler:    _Engine_SetLogLevel_Handler,
+		},
+		{
+			MethodName: "SetParseLimits",
+			Handler:    _Engine_SetParseLimits_Handler,
+		},
+		{
+			MethodName: "GetEnvironmentStatus",
+			Handler:    _Engine_GetEnvironmentStatus_Handler,
+		},
+		{
+			MethodName: "StartOperation",
+			Handler:    _Engine_StartOperation_Handler,
+		},
+		{
+			MethodName: "GetOperation",
+			Handler:    _Engine_GetOperation_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{
 		{
@@ -872,6 +2373,22 @@ var _Engine_serviceDesc = grpc.ServiceDesc{
 			Handler:       _Engine_ParseWithLogs_Handler,
 			ServerStreams: true,
 		},
+		{
+			StreamName:    "ParseFiles",
+			Handler:       _Engine_ParseFiles_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "WatchEnvironmentStatus",
+			Handler:       _Engine_WatchEnvironmentStatus_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "WatchOperation",
+			Handler:       _Engine_WatchOperation_Handler,
+			ServerStreams: true,
+		},
 	},
 	Metadata: "api.proto",
 }
@@ -879,49 +2396,140 @@ var _Engine_serviceDesc = grpc.ServiceDesc{
 func init() { proto.RegisterFile("api.proto", fileDescriptor0) }
 
 var fileDescriptor0 = []byte{
-	// 692 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x8c, 0x55, 0xdb, 0x6e, 0xd3, 0x4c,
-	0x10, 0xb6, 0x63, 0xa7, 0x69, 0x26, 0x87, 0x5a, 0x93, 0x43, 0xfd, 0xfb, 0xe6, 0xaf, 0x56, 0x88,
-	0x46, 0x20, 0xad, 0x20, 0x5c, 0xb5, 0x08, 0x41, 0xd4, 0x42, 0x15, 0x61, 0x15, 0xea, 0xd0, 0x72,
-	0x6d, 0x9a, 0x25, 0xb5, 0x48, 0x77, 0x5d, 0xdb, 0x69, 0xe1, 0x1d, 0x78, 0x03, 0x5e, 0x03, 0x89,
-	0xd7, 0x43, 0x5e, 0x1f, 0x6a, 0xa7, 0xa6, 0x70, 0x37, 0x3b, 0x33, 0x3b, 0xfb, 0xcd, 0x7c, 0xf3,
-	0xd9, 0xd0, 0x74, 0x7d, 0x8f, 0xfa, 0x81, 0x88, 0x04, 0x31, 0xa0, 0x7b, 0xc6, 0x82, 0xd0, 0x13,
-	0xdc, 0x61, 0x57, 0x2b, 0x16, 0x46, 0xe4, 0x31, 0x6c, 0xe5, 0x9e, 0xd0, 0x17, 0x3c, 0x64, 0x68,
-	0x42, 0xe3, 0x3a, 0x71, 0x99, 0xea, 0x8e, 0x3a, 0x6a, 0x3a, 0xd9, 0x91, 0xfc, 0x52, 0xa1, 0xfd,
-	0xde, 0x0d, 0x42, 0x96, 0xde, 0xc6, 0x87, 0xa0, 0x7f, 0xf1, 0xf8, 0x5c, 0xe6, 0x75, 0xc7, 0x48,
-	0x8b, 0x41, 0xfa, 0xd6, 0xe3, 0x73, 0x47, 0xc6, 0x11, 0x41, 0xe7, 0xee, 0x25, 0x33, 0x6b, 0xb2,
-	0x9e, 0xb4, 0xe3, 0x67, 0xce, 0x05, 0x8f, 0x18, 0x8f, 0x4c, 0x6d, 0x47, 0x1d, 0xb5, 0x9d, 0xec,
-	0x18, 0x67, 0x2f, 0x5d, 0xbe, 0x30, 0xf5, 0x24, 0x3b, 0xb6, 0xb1, 0x0f, 0xf5, 0xab, 0x15, 0x0b,
-	0xbe, 0x99, 0x75, 0xe9, 0x4c, 0x0e, 0x64, 0x17, 0xf4, 0xf8, 0x15, 0x6c, 0x41, 0x63, 0x7a, 0x7c,
-	0x36, 0xb1, 0xa7, 0x87, 0x86, 0x82, 0x9b, 0xa0, 0xdb, 0x93, 0xe3, 0x23, 0x43, 0x8d, 0xad, 0xd3,
-	0xc9, 0xec, 0x83, 0x51, 0x23, 0x3f, 0x54, 0xe8, 0xa4, 0xe0, 0xd2, 0x2e, 0x77, 0x4b, 0xd0, 0x7b,
-	0xb4, 0x14, 0x5d, 0xc3, 0x2e, 0xd1, 0xd4, 0x0a, 0x68, 0x10, 0xf4, 0x95, 0x1b, 0xc6, 0xc0, 0xb5,
-	0x51, 0xdb, 0x91, 0x36, 0x1a, 0xa0, 0x2d, 0x45, 0x06, 0x3a, 0x36, 0xab, 0xd1, 0x35, 0x40, 0xb3,
-	0xdf, 0xc5, 0xe0, 0x9a, 0x50, 0x7f, 0x33, 0x3d, 0x9e, 0xd8, 0x46, 0x8d, 0xf4, 0x01, 0x6d, 0x2f,
-	0x8c, 0x0e, 0x03, 0x2f, 0x9e, 0x74, 0x46, 0xcd, 0x77, 0x15, 0x7a, 0x25, 0x77, 0x8a, 0x7c, 0x0f,
-	0x1a, 0xf3, 0xc4, 0x65, 0xaa, 0x3b, 0xda, 0xa8, 0x35, 0xfe, 0x9f, 0x56, 0xa4, 0xd1, 0xe4, 0x3c,
-	0xe5, 0x9f, 0x85, 0x93, 0xe5, 0x5b, 0xfb, 0x00, 0xb7, 0xee, 0xbc, 0x33, 0xb5, 0xd0, 0x59, 0x81,
-	0xfc, 0x5a, 0x99, 0x7c, 0x02, 0x30, 0x3b, 0xb1, 0x33, 0xe6, 0x73, 0x3e, 0xd4, 0x22, 0x1f, 0x5f,
-	0xa1, 0x25, 0x73, 0x52, 0xa4, 0x23, 0xd8, 0xb8, 0x60, 0xee, 0x9c, 0x05, 0x32, 0xab, 0x35, 0x36,
-	0x68, 0x21, 0x4a, 0x1d, 0x71, 0xe3, 0xa4, 0x71, 0x7c, 0x00, 0x7a, 0x20, 0x6e, 0x42, 0xb3, 0x26,
-	0x1b, 0xba, 0x9b, 0x27, 0xa3, 0xd6, 0x7f, 0xa0, 0x39, 0xe2, 0x26, 0xc6, 0x7d, 0xce, 0x96, 0x4b,
-	0xd9, 0x7d, 0xd3, 0x91, 0x36, 0x79, 0x09, 0x83, 0x59, 0xe4, 0x06, 0xd1, 0x81, 0xb8, 0xf4, 0x05,
-	0x67, 0x3c, 0xca, 0x80, 0x66, 0xab, 0xa7, 0x16, 0x56, 0x0f, 0x41, 0xf7, 0x45, 0x10, 0xc9, 0x0e,
-	0xeb, 0x8e, 0xb4, 0x89, 0x09, 0xc3, 0xf5, 0x02, 0xc9, 0xfb, 0xe4, 0x11, 0xf4, 0x67, 0x91, 0xf0,
-	0xff, 0xa5, 0x32, 0xd9, 0x8e, 0x61, 0x94, 0x72, 0xd3, 0x22, 0x47, 0xb9, 0xce, 0xd8, 0x3c, 0xa1,
-	0x00, 0x2d, 0xd8, 0x8c, 0x47, 0xbe, 0x72, 0x17, 0x59, 0x8d, 0xfc, 0x7c, 0x0f, 0x0d, 0xdb, 0x30,
-	0x98, 0xf2, 0x30, 0x72, 0x97, 0xcb, 0xa4, 0x4c, 0xfe, 0xc2, 0x10, 0xfa, 0xa7, 0xfe, 0xdc, 0x8d,
-	0xd8, 0x9a, 0xff, 0x29, 0xf4, 0x1c, 0x76, 0x29, 0xae, 0x73, 0x7f, 0x82, 0xfe, 0x9e, 0xd7, 0xe3,
-	0x52, 0xe5, 0x2b, 0x49, 0xa9, 0xf1, 0x4f, 0x1d, 0x36, 0x5e, 0xf3, 0x85, 0xc7, 0x19, 0x52, 0x68,
-	0xa4, 0xfd, 0xe0, 0x16, 0x2d, 0x7f, 0x53, 0x2c, 0x83, 0xae, 0x7d, 0x52, 0x88, 0x82, 0x23, 0xa8,
-	0x4b, 0x85, 0x61, 0xa7, 0xf4, 0x91, 0xb0, 0xba, 0x65, 0xe1, 0x11, 0x05, 0xc7, 0xa9, 0x52, 0x3f,
-	0x7a, 0xd1, 0x85, 0x2d, 0x16, 0xe1, 0x5f, 0x6f, 0x3c, 0x51, 0x71, 0x1f, 0x5a, 0x05, 0x09, 0x60,
-	0x8f, 0xde, 0x95, 0x93, 0xd5, 0xaf, 0x52, 0x09, 0x51, 0xf0, 0x39, 0x74, 0x4a, 0x03, 0xc5, 0x1c,
-	0x7e, 0xc6, 0x94, 0x35, 0xa4, 0xd5, 0x23, 0x57, 0x70, 0x0f, 0xda, 0xc5, 0xa1, 0x57, 0xdc, 0x1d,
-	0xd0, 0x4a, 0x56, 0x14, 0x7c, 0x01, 0xed, 0xe2, 0x90, 0xb1, 0x4f, 0x2b, 0x68, 0xb2, 0x06, 0xb4,
-	0x8a, 0x09, 0xa2, 0x20, 0x01, 0x6d, 0x76, 0x62, 0x63, 0x8b, 0xde, 0x8a, 0xd2, 0x6a, 0x17, 0x75,
-	0x43, 0x14, 0x3c, 0x80, 0x6e, 0x79, 0xa7, 0x71, 0x48, 0x2b, 0x55, 0x62, 0x6d, 0xd3, 0x3f, 0x2c,
-	0xbf, 0x82, 0xaf, 0xa0, 0x53, 0x5a, 0x69, 0x1c, 0xd0, 0x2a, 0x39, 0x58, 0x43, 0x5a, 0xbd, 0xf9,
-	0xca, 0xa7, 0x0d, 0xf9, 0xf3, 0x79, 0xf6, 0x3b, 0x00, 0x00, 0xff, 0xff, 0x7c, 0xf0, 0xa9, 0xe1,
-	0x89, 0x06, 0x00, 0x00,
+	// 2155 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x8c, 0x58, 0xdd, 0x6e, 0xdb, 0xc8,
+	0x15, 0x16, 0xf5, 0xaf, 0x23, 0x59, 0x66, 0xc6, 0xb2, 0xa2, 0xd5, 0x26, 0x8d, 0x77, 0x36, 0x4d,
+	0x84, 0x60, 0x3b, 0x4d, 0x5d, 0xa0, 0xc0, 0x66, 0x11, 0xa0, 0x5a, 0x8b, 0x71, 0xd4, 0xc8, 0x92,
+	0x33, 0x92, 0x1d, 0x2c, 0x7a, 0x21, 0xd0, 0xd2, 0xc4, 0x62, 0x43, 0x91, 0x5a, 0x72, 0x64, 0x37,
+	0xef, 0x50, 0xf4, 0xa6, 0xd7, 0x7d, 0x8d, 0xa2, 0x0f, 0xd0, 0x77, 0xe8, 0x5d, 0xdf, 0xa1, 0x0f,
+	0x50, 0xa0, 0x98, 0xe1, 0x90, 0x22, 0x25, 0xc6, 0xc9, 0x95, 0xe6, 0xfc, 0x70, 0x66, 0xce, 0xdf,
+	0x37, 0xe7, 0x08, 0x2a, 0xe6, 0xca, 0x22, 0x2b, 0xcf, 0xe5, 0x2e, 0xd6, 0xa1, 0x7e, 0xc9, 0x3c,
+	0xdf, 0x72, 0x1d, 0xca, 0x7e, 0x5e, 0x33, 0x9f, 0xe3, 0x53, 0xd8, 0x8f, 0x38, 0xfe, 0xca, 0x75,
+	0x7c, 0x86, 0x5a, 0x50, 0xba, 0x09, 0x58, 0x2d, 0xed, 0x48, 0xeb, 0x54, 0x68, 0x48, 0xa2, 0x36,
+	0x94, 0xe5, 0x3e, 0x33, 0xd7, 0x6e, 0x65, 0x8f, 0xb4, 0x4e, 0x81, 0x46, 0x34, 0xfe, 0xaf, 0x06,
+	0xb5, 0x73, 0xd3, 0xf3, 0x99, 0xda, 0x19, 0x3d, 0x81, 0xfc, 0x07, 0xcb, 0x99, 0xcb, 0x3d, 0xea,
+	0xc7, 0x88, 0xc4, 0x85, 0xe4, 0x8d, 0xe5, 0xcc, 0xa9, 0x94, 0x23, 0x04, 0x79, 0xc7, 0x5c, 0x32,
+	0xb9, 0x61, 0x85, 0xca, 0xb5, 0xb8, 0xc2, 0xcc, 0x75, 0x38, 0x73, 0x78, 0x2b, 0x77, 0xa4, 0x75,
+	0x6a, 0x34, 0x24, 0x85, 0xb6, 0x6d, 0x3a, 0xd7, 0xad, 0x7c, 0xa0, 0x2d, 0xd6, 0xa8, 0x01, 0x85,
+	0x9f, 0xd7, 0xcc, 0xfb, 0xd8, 0x2a, 0x48, 0x66, 0x40, 0xa0, 0xaf, 0x20, 0xbf, 0x74, 0xe7, 0xac,
+	0x55, 0x94, 0xe7, 0x17, 0xc8, 0x99, 0x3b, 0x67, 0x54, 0xb2, 0xd0, 0x43, 0x00, 0xc7, 0x9d, 0x5a,
+	0x8e, 0xcf, 0x4d, 0xdb, 0x6e, 0x95, 0x8e, 0xb4, 0x4e, 0x99, 0x56, 0x1c, 0xb7, 0x1f, 0x30, 0xf0,
+	0x53, 0xc8, 0x8b, 0xfb, 0xa1, 0x2a, 0x94, 0xfa, 0xc3, 0xcb, 0xee, 0xa0, 0xdf, 0xd3, 0x33, 0xa8,
+	0x0c, 0xf9, 0x41, 0x77, 0x78, 0xaa, 0x6b, 0x62, 0x75, 0xd1, 0x1d, 0x4f, 0xf4, 0x2c, 0xfe, 0x08,
+	0xf7, 0xa4, 0x55, 0xaf, 0x2c, 0x9b, 0xf9, 0xa1, 0xdd, 0x75, 0xc8, 0x5a, 0x81, 0xd5, 0x39, 0x9a,
+	0xb5, 0xe6, 0xe8, 0x1b, 0xc8, 0xbf, 0xb7, 0xec, 0xc0, 0xbe, 0xea, 0xf1, 0x5e, 0xc2, 0x0f, 0x54,
+	0x8a, 0xc4, 0x7d, 0xb8, 0xb5, 0x64, 0xee, 0x9a, 0x4f, 0x97, 0xbe, 0xb4, 0x38, 0x47, 0x2b, 0x8a,
+	0x73, 0xe6, 0x0b, 0x9b, 0xff, 0xe4, 0x5e, 0xf9, 0xd2, 0xe6, 0x02, 0x95, 0x6b, 0x7c, 0x03, 0x28,
+	0x7e, 0xb4, 0x0a, 0xdd, 0xf6, 0xd9, 0x08, 0xf2, 0x33, 0x77, 0x1e, 0x9c, 0x5d, 0xa0, 0x72, 0x2d,
+	0xbc, 0xc5, 0x3c, 0xcf, 0xf5, 0xe4, 0x39, 0x15, 0x1a, 0x10, 0xe8, 0x09, 0x14, 0x3d, 0xe6, 0xaf,
+	0x6d, 0x2e, 0x4f, 0xa9, 0x1e, 0xd7, 0xc3, 0x7b, 0x06, 0x3b, 0x53, 0x25, 0xc5, 0xff, 0xd0, 0x60,
+	0x2f, 0x21, 0x41, 0x4f, 0x13, 0x71, 0x3e, 0x48, 0x7e, 0xb7, 0x15, 0x68, 0x19, 0xba, 0x6c, 0x2c,
+	0x74, 0x08, 0xf2, 0x6b, 0xd3, 0x17, 0x51, 0xce, 0x75, 0x6a, 0x54, 0xae, 0x91, 0x0e, 0x39, 0xdb,
+	0x0d, 0x23, 0x2c, 0x96, 0x51, 0x28, 0x0b, 0x3b, 0xa1, 0x4c, 0x8f, 0x55, 0x09, 0x72, 0x83, 0x91,
+	0x08, 0x55, 0x05, 0x0a, 0xaf, 0xfa, 0xc3, 0xee, 0x40, 0xcf, 0xe2, 0xef, 0xa0, 0x71, 0x69, 0xda,
+	0xd6, 0xdc, 0xe4, 0xec, 0xad, 0xc8, 0x8f, 0x30, 0x5c, 0x51, 0xf2, 0x68, 0xb1, 0xe4, 0xc1, 0xf7,
+	0xe1, 0x70, 0x4b, 0x3b, 0xb0, 0x07, 0x37, 0x00, 0x0d, 0x2c, 0x9f, 0xf7, 0x3c, 0x4b, 0x14, 0x45,
+	0x58, 0x45, 0x7f, 0xd1, 0xe0, 0x20, 0xc1, 0x56, 0xbe, 0xf9, 0x1e, 0x4a, 0xf3, 0x80, 0xd5, 0xd2,
+	0x8e, 0x72, 0x9d, 0xea, 0xf1, 0x23, 0x92, 0xa2, 0x46, 0x02, 0xba, 0xef, 0xbc, 0x77, 0x69, 0xa8,
+	0xdf, 0x7e, 0x01, 0xb0, 0x61, 0x47, 0xbe, 0xd3, 0x62, 0xbe, 0x8b, 0xd5, 0x69, 0x36, 0x51, 0xa7,
+	0x18, 0x03, 0x8c, 0xdf, 0x0e, 0xee, 0xb6, 0xf0, 0xcf, 0x50, 0x95, 0x3a, 0xea, 0xa6, 0x1d, 0x28,
+	0x2e, 0x98, 0x39, 0x67, 0x9e, 0xd4, 0xaa, 0x1e, 0xeb, 0x24, 0x26, 0x25, 0xd4, 0xbd, 0xa5, 0x4a,
+	0x8e, 0x1e, 0x43, 0xde, 0x73, 0x6f, 0xfd, 0x56, 0xf6, 0x28, 0x97, 0xaa, 0x27, 0xa5, 0xed, 0xaf,
+	0x20, 0x47, 0xdd, 0x5b, 0x99, 0x80, 0xcc, 0xb6, 0xa5, 0xf5, 0x15, 0x2a, 0xd7, 0xf8, 0xdf, 0x1a,
+	0x1c, 0x8e, 0xb9, 0xe9, 0xf1, 0x13, 0x77, 0xb9, 0x72, 0x1d, 0xe6, 0xf0, 0xf0, 0xa6, 0x21, 0x14,
+	0x68, 0x31, 0x28, 0x40, 0x90, 0x5f, 0xb9, 0x1e, 0x0f, 0x53, 0x58, 0xac, 0xd1, 0x37, 0x50, 0xbb,
+	0xb2, 0x9c, 0xf9, 0xd4, 0x9c, 0xcf, 0x3d, 0xe6, 0xfb, 0x2a, 0x93, 0xab, 0x82, 0xd7, 0x0d, 0x58,
+	0xe8, 0x2b, 0x28, 0x73, 0xdb, 0x9f, 0xce, 0x98, 0xc7, 0x55, 0x26, 0x95, 0xb8, 0xed, 0x9f, 0x30,
+	0x8f, 0xa3, 0xfb, 0x20, 0x96, 0xd3, 0x0f, 0x2c, 0x04, 0x8c, 0x22, 0xb7, 0xfd, 0x37, 0xec, 0x23,
+	0xfa, 0x1a, 0x2a, 0xb7, 0xec, 0x6a, 0xca, 0xdd, 0x0f, 0xcc, 0x91, 0xb0, 0x51, 0xa1, 0xe5, 0x5b,
+	0x76, 0x35, 0x11, 0x34, 0xc2, 0xb0, 0x27, 0x84, 0x57, 0xa6, 0xcf, 0xa6, 0x2b, 0x93, 0x2f, 0x24,
+	0x6c, 0x54, 0x68, 0xf5, 0x96, 0x5d, 0xfd, 0x68, 0xfa, 0xec, 0xdc, 0xe4, 0x0b, 0xdc, 0x82, 0xe6,
+	0xb6, 0x61, 0x2a, 0x6d, 0x9e, 0x41, 0x63, 0xcc, 0xdd, 0xd5, 0x97, 0x58, 0x2c, 0x72, 0x6f, 0x4b,
+	0x57, 0x6d, 0x62, 0x46, 0x58, 0xcd, 0xe6, 0x41, 0x6e, 0x08, 0x44, 0x16, 0xb9, 0xb0, 0x36, 0xaf,
+	0xc3, 0x3d, 0x22, 0xfa, 0xd3, 0xf9, 0x21, 0x24, 0xa6, 0x37, 0x5b, 0x58, 0x37, 0x4c, 0xb9, 0x2e,
+	0x24, 0xf1, 0x29, 0x1c, 0x2a, 0x14, 0x0c, 0x0e, 0x88, 0xf2, 0xa3, 0x01, 0x05, 0x6b, 0xb9, 0x39,
+	0x25, 0x20, 0xee, 0x48, 0xc1, 0x26, 0x34, 0x2e, 0x56, 0xa2, 0x7c, 0x92, 0xfb, 0xe0, 0xdf, 0xc0,
+	0x01, 0x65, 0x4b, 0xf7, 0x26, 0xe2, 0x07, 0x7e, 0xb8, 0xc3, 0x0e, 0xb1, 0x55, 0xf2, 0x93, 0xc8,
+	0xa7, 0x68, 0xcc, 0xf8, 0xc0, 0xbd, 0x1e, 0xb0, 0x1b, 0x66, 0xc7, 0xb2, 0xdd, 0x16, 0x74, 0x78,
+	0x51, 0x49, 0xe0, 0x53, 0x38, 0x48, 0xe8, 0x6e, 0xac, 0xda, 0x55, 0x0e, 0x9e, 0x39, 0x76, 0x63,
+	0xb9, 0x6b, 0x5f, 0x99, 0x15, 0xd1, 0xd8, 0x85, 0xaa, 0x04, 0xb8, 0x81, 0xb5, 0xb4, 0xb8, 0x8f,
+	0x8e, 0xa0, 0x3a, 0x73, 0x9d, 0xd9, 0xda, 0xf3, 0x98, 0x33, 0x0b, 0x2a, 0xac, 0x40, 0xe3, 0x2c,
+	0x55, 0x7d, 0xeb, 0x10, 0x83, 0x03, 0x02, 0x75, 0x40, 0x97, 0x8b, 0xe9, 0x0e, 0xee, 0xd7, 0x25,
+	0x7f, 0x12, 0x82, 0x3f, 0x7e, 0x09, 0x87, 0x63, 0xc6, 0x63, 0x67, 0x86, 0x86, 0x3e, 0x86, 0xa2,
+	0x2d, 0x19, 0xaa, 0x62, 0x6b, 0x24, 0xae, 0xa4, 0x64, 0xf8, 0xef, 0x1a, 0x34, 0xb7, 0xbf, 0x57,
+	0xc6, 0x7f, 0xd1, 0x06, 0xa8, 0xb3, 0xe5, 0x8c, 0x6d, 0xbd, 0x48, 0x2a, 0xca, 0xc7, 0x72, 0xa6,
+	0xef, 0x6d, 0xeb, 0x7a, 0x11, 0x3c, 0xdb, 0x05, 0x5a, 0xb6, 0x9c, 0x57, 0x92, 0x46, 0x4d, 0x28,
+	0x4a, 0xc3, 0xe6, 0xea, 0x15, 0x53, 0x14, 0x7e, 0x08, 0x5f, 0x9f, 0x32, 0x6e, 0x38, 0x37, 0x96,
+	0xe7, 0x3a, 0x4b, 0xe6, 0xf0, 0x31, 0x37, 0xf9, 0x3a, 0x02, 0xd6, 0x47, 0xf0, 0xf0, 0x9d, 0xc9,
+	0x67, 0x8b, 0x4f, 0x2a, 0xfc, 0x2d, 0x0b, 0xf7, 0x76, 0x84, 0x22, 0x2f, 0x6f, 0x5d, 0xef, 0xc3,
+	0xdc, 0xf2, 0xc2, 0x16, 0x46, 0x91, 0x22, 0x1c, 0x1e, 0x5b, 0xb9, 0x01, 0x7c, 0x55, 0x68, 0x40,
+	0xc4, 0xf3, 0x38, 0xf7, 0xe9, 0x96, 0x27, 0x9f, 0x6c, 0x79, 0xd0, 0x73, 0x80, 0x59, 0x58, 0xa4,
+	0x7e, 0xab, 0xa0, 0xf0, 0x30, 0xaa, 0x5b, 0x75, 0xd1, 0x98, 0x0e, 0x7a, 0x02, 0x15, 0x85, 0x59,
+	0xcc, 0x6f, 0x15, 0xe5, 0x07, 0x65, 0xa2, 0x20, 0x8b, 0x6e, 0x44, 0xe8, 0xb1, 0x3c, 0xf5, 0xca,
+	0x66, 0x4b, 0xbf, 0x55, 0x52, 0x6a, 0xe7, 0x01, 0x83, 0x46, 0x12, 0x71, 0xeb, 0x05, 0x33, 0x6d,
+	0xbe, 0xf8, 0xd8, 0x2a, 0xcb, 0x1e, 0x26, 0x24, 0xf1, 0xbf, 0x72, 0xb0, 0xbf, 0x75, 0x8f, 0x54,
+	0x70, 0x8d, 0xaa, 0x3a, 0x1b, 0xaf, 0x6a, 0x1d, 0x72, 0xdc, 0xbc, 0x56, 0x9e, 0x10, 0x4b, 0xf4,
+	0x40, 0x84, 0x56, 0xc2, 0x82, 0x0a, 0x60, 0x99, 0x6e, 0x18, 0xe8, 0x3b, 0x28, 0xf8, 0xdc, 0xe4,
+	0xe1, 0xfb, 0xdc, 0xdc, 0x76, 0x01, 0x11, 0x3f, 0x8c, 0x06, 0x4a, 0xe8, 0xd7, 0xf2, 0xa5, 0xb1,
+	0xf9, 0x42, 0x75, 0x66, 0xf7, 0x77, 0xd4, 0x5f, 0x4b, 0x31, 0x55, 0x6a, 0x22, 0x04, 0xee, 0x0d,
+	0xf3, 0x3c, 0x6b, 0xce, 0x14, 0xe8, 0x46, 0xb4, 0x40, 0x65, 0x5f, 0x20, 0x2e, 0x9b, 0x4f, 0x4d,
+	0x59, 0x44, 0x65, 0x59, 0x44, 0x55, 0xc5, 0xec, 0x8a, 0xf6, 0xa9, 0x01, 0x05, 0xf1, 0x6a, 0xf8,
+	0xad, 0x4a, 0x10, 0x72, 0x49, 0x60, 0x03, 0x0a, 0xf2, 0x5a, 0xe8, 0x1e, 0xec, 0x8d, 0x27, 0xdd,
+	0x89, 0x31, 0xbd, 0x18, 0xbe, 0x19, 0x8e, 0xde, 0x0d, 0xf5, 0x8c, 0x68, 0x26, 0xe8, 0xc5, 0x70,
+	0xd8, 0x97, 0xed, 0x5e, 0x15, 0x4a, 0xe3, 0xc9, 0xe8, 0xfc, 0xdc, 0xe8, 0xe9, 0x59, 0xb4, 0x0f,
+	0xd5, 0xe1, 0x68, 0x32, 0x3d, 0xa1, 0x46, 0x77, 0x62, 0xf4, 0xf4, 0x1c, 0xfe, 0x23, 0x14, 0x83,
+	0xeb, 0x22, 0x04, 0xf5, 0xd7, 0x46, 0x77, 0x30, 0x79, 0x1d, 0xdb, 0xe8, 0x00, 0xf6, 0x87, 0xa3,
+	0xa9, 0x62, 0x9f, 0xbc, 0x36, 0x4e, 0xde, 0x04, 0x1b, 0x06, 0x9c, 0x9f, 0xf4, 0x2c, 0xda, 0x83,
+	0xca, 0xc5, 0x30, 0x24, 0x73, 0xa8, 0x06, 0xe5, 0xf1, 0xa4, 0x4b, 0x27, 0xe2, 0xe8, 0x3c, 0x9e,
+	0x41, 0x29, 0x7c, 0xcf, 0x1e, 0x40, 0x25, 0xca, 0x23, 0x15, 0xc2, 0x0d, 0x43, 0xc0, 0xd0, 0x9c,
+	0xf9, 0x33, 0xcf, 0x5a, 0xf1, 0x0d, 0x16, 0xc7, 0x59, 0x12, 0xf2, 0x13, 0xaf, 0x65, 0x48, 0xe2,
+	0x7f, 0x6a, 0x50, 0x52, 0xb9, 0x25, 0x5c, 0x35, 0x5b, 0xb0, 0xd9, 0x87, 0x10, 0x0f, 0x25, 0x81,
+	0x7e, 0x05, 0x65, 0x9f, 0xdd, 0x30, 0xcf, 0xe2, 0x1f, 0xe5, 0xd6, 0xf5, 0xe3, 0x7b, 0x61, 0x36,
+	0x92, 0xb1, 0x12, 0xd0, 0x48, 0x45, 0x1c, 0xb5, 0x64, 0xbe, 0x2f, 0xd2, 0x4a, 0x1d, 0xa5, 0x48,
+	0x91, 0x82, 0x0b, 0xcb, 0x09, 0x1f, 0x64, 0xb9, 0xc6, 0x2f, 0xa0, 0x1c, 0xee, 0x81, 0x1a, 0xa0,
+	0x8f, 0x8d, 0x4b, 0x83, 0xf6, 0x27, 0x3f, 0x25, 0xa3, 0xf1, 0xae, 0x4b, 0x37, 0xd1, 0x78, 0xd5,
+	0xed, 0x0f, 0x2e, 0xa8, 0xa1, 0x67, 0xf1, 0x5f, 0x73, 0x50, 0x19, 0xad, 0x98, 0x67, 0x4a, 0x13,
+	0x37, 0xcd, 0x6f, 0x45, 0x36, 0xbf, 0xdf, 0xaa, 0xc6, 0x34, 0xb8, 0xf2, 0x3e, 0x89, 0x34, 0xe3,
+	0x4d, 0xe9, 0x93, 0x30, 0x77, 0x73, 0x52, 0x4b, 0x8f, 0x69, 0x25, 0xb2, 0x36, 0xea, 0x9a, 0xf3,
+	0xf1, 0xae, 0x79, 0x27, 0xfd, 0x0a, 0xbb, 0xe9, 0xf7, 0x18, 0xea, 0xef, 0x2d, 0xc7, 0xf2, 0x17,
+	0x91, 0x52, 0x51, 0x2a, 0xd5, 0x42, 0xae, 0xd4, 0x7a, 0x0a, 0x45, 0x76, 0x23, 0x71, 0x24, 0xa8,
+	0xf7, 0xd8, 0x75, 0x0d, 0xc1, 0xa7, 0x4a, 0x8c, 0xdf, 0xa9, 0x86, 0x57, 0x87, 0xda, 0x9b, 0xfe,
+	0xb0, 0x17, 0xf3, 0x93, 0xf0, 0x9e, 0xc8, 0x9d, 0xe9, 0xc9, 0xe8, 0xec, 0x7c, 0x34, 0x34, 0x86,
+	0x93, 0xb1, 0xae, 0x89, 0x14, 0xec, 0x0f, 0xc7, 0x93, 0xee, 0x60, 0x30, 0xed, 0xd1, 0xfe, 0xa5,
+	0x41, 0xc7, 0x7a, 0x56, 0xe4, 0xea, 0xc5, 0x79, 0x4f, 0x24, 0x7d, 0xc8, 0xcb, 0xe1, 0x1f, 0xbf,
+	0xb4, 0x20, 0xf6, 0xa0, 0x32, 0xbe, 0x38, 0x39, 0x31, 0x8c, 0x9e, 0x2c, 0x09, 0x80, 0xa2, 0x88,
+	0x88, 0xac, 0x86, 0xff, 0x64, 0xa1, 0x9e, 0xbc, 0xb7, 0x88, 0xb9, 0xcf, 0xd9, 0x2a, 0x84, 0x1d,
+	0xb1, 0x46, 0x04, 0x8a, 0xbe, 0x2c, 0x75, 0x15, 0x9b, 0xe6, 0x96, 0xb1, 0x44, 0x41, 0xa7, 0xd2,
+	0xfa, 0xe2, 0x20, 0x89, 0xce, 0xce, 0x5a, 0x32, 0xe1, 0xe3, 0xbc, 0xf4, 0x71, 0x51, 0x90, 0x67,
+	0x3e, 0x7a, 0x04, 0xd5, 0xf9, 0x3a, 0xf8, 0x62, 0x13, 0x25, 0x08, 0x59, 0x01, 0x46, 0x04, 0xe1,
+	0x2d, 0xc6, 0xc3, 0x2b, 0xba, 0x6e, 0xf7, 0x3a, 0x08, 0x89, 0xe8, 0xba, 0xdd, 0x6b, 0x09, 0xa3,
+	0x73, 0xd7, 0x61, 0x0a, 0x68, 0xe4, 0x5a, 0x7c, 0xcd, 0x5d, 0x6e, 0xda, 0xad, 0x8a, 0x64, 0x06,
+	0x04, 0xa6, 0x50, 0x8c, 0xa0, 0xb7, 0x2e, 0x3c, 0x7a, 0x31, 0x4e, 0xba, 0x54, 0x46, 0xcb, 0xe8,
+	0xdd, 0xe9, 0x52, 0x81, 0x08, 0xe7, 0x74, 0x74, 0x4a, 0x8d, 0xf1, 0x58, 0xcf, 0xe3, 0x85, 0x6a,
+	0x9d, 0x23, 0x07, 0x84, 0xdd, 0xc0, 0xb7, 0x89, 0x29, 0xec, 0x13, 0xc9, 0xfe, 0x6c, 0x33, 0x8e,
+	0x84, 0xdd, 0xfb, 0x56, 0x43, 0x19, 0xcd, 0x1f, 0xf8, 0x97, 0x70, 0x70, 0xca, 0x76, 0xcf, 0xd9,
+	0x2a, 0x32, 0xfc, 0x14, 0x0e, 0xe5, 0x03, 0xfd, 0x39, 0xc5, 0x67, 0x5d, 0xc8, 0x8b, 0xb1, 0x4d,
+	0xe4, 0x6d, 0xcf, 0x78, 0xd5, 0xbd, 0x18, 0x4c, 0xa6, 0x67, 0xa3, 0x9e, 0xa1, 0x67, 0x84, 0xb5,
+	0xc3, 0xee, 0xa4, 0x7f, 0x69, 0x04, 0x8e, 0xe8, 0x0e, 0x87, 0xa3, 0x89, 0x44, 0xd7, 0xac, 0x84,
+	0x43, 0xe3, 0xac, 0x3b, 0x9c, 0xf4, 0x4f, 0xf4, 0xdc, 0xf1, 0xff, 0xca, 0x50, 0x34, 0x9c, 0x6b,
+	0xcb, 0x61, 0x88, 0x40, 0x49, 0xdd, 0x1c, 0xed, 0x93, 0xe4, 0x5f, 0x1a, 0x6d, 0x9d, 0x6c, 0xfd,
+	0xa3, 0x81, 0x33, 0xa8, 0x03, 0x05, 0xd9, 0xb4, 0xa0, 0xe4, 0xfc, 0xdd, 0xde, 0x1a, 0x73, 0x71,
+	0x06, 0x1d, 0xab, 0xf9, 0xf6, 0x9d, 0xc5, 0x17, 0x03, 0x11, 0xf0, 0xcf, 0x7d, 0xf1, 0x5c, 0x43,
+	0x3f, 0x00, 0x6c, 0x86, 0x71, 0x84, 0xc8, 0x86, 0x08, 0xbf, 0x3a, 0x20, 0xbb, 0xd3, 0x3a, 0xce,
+	0x74, 0xb4, 0xe7, 0x1a, 0xfa, 0x3d, 0xec, 0x25, 0x46, 0x4d, 0x74, 0x48, 0xd2, 0x06, 0xd5, 0x76,
+	0x93, 0xa4, 0x4f, 0xa4, 0x19, 0xf4, 0x02, 0xaa, 0xb1, 0xa9, 0x12, 0x1d, 0x90, 0xdd, 0x09, 0xb5,
+	0xdd, 0x48, 0x1b, 0x3c, 0x71, 0x06, 0xfd, 0x00, 0x7b, 0x89, 0x86, 0x1f, 0xed, 0xa4, 0x44, 0xbb,
+	0x49, 0x52, 0x47, 0x02, 0x9c, 0x41, 0xdf, 0x43, 0x2d, 0xde, 0xe4, 0xa7, 0x7c, 0x7b, 0x48, 0x52,
+	0xa7, 0x80, 0x0c, 0x7a, 0x09, 0xb5, 0x78, 0x53, 0x8f, 0x1a, 0x24, 0x65, 0x2c, 0x68, 0x1f, 0x92,
+	0xd4, 0xce, 0x3f, 0x83, 0x30, 0xe4, 0xc6, 0x6f, 0x07, 0xa8, 0x4a, 0x36, 0x73, 0x6e, 0xbb, 0x16,
+	0x1f, 0x45, 0x71, 0x06, 0x9d, 0x40, 0x3d, 0x39, 0x8d, 0xa1, 0x26, 0x49, 0x9d, 0x3b, 0xdb, 0xf7,
+	0xc9, 0x27, 0xc6, 0xb6, 0x8c, 0x88, 0x4e, 0x62, 0x18, 0x43, 0x87, 0x24, 0x6d, 0x90, 0x6b, 0x37,
+	0x49, 0xfa, 0xcc, 0x26, 0xa3, 0x13, 0x1b, 0x3d, 0xd0, 0x01, 0xd9, 0x1d, 0x5a, 0xda, 0x0d, 0x92,
+	0x32, 0x9d, 0x28, 0x13, 0x12, 0xcd, 0xbb, 0x30, 0x21, 0x6d, 0x1a, 0x68, 0xdf, 0xdf, 0xe1, 0x47,
+	0x9b, 0xfc, 0x01, 0x1a, 0x69, 0x2d, 0x36, 0x7a, 0x40, 0xee, 0xe8, 0xbc, 0xdb, 0x88, 0xec, 0x88,
+	0x70, 0x06, 0x9d, 0x43, 0x33, 0xbd, 0x1f, 0x47, 0xbf, 0x20, 0x77, 0x36, 0xea, 0xe9, 0xfb, 0x3d,
+	0xd7, 0xd0, 0xef, 0x54, 0x94, 0x36, 0xef, 0x78, 0x93, 0x24, 0x19, 0xe1, 0x0e, 0xb0, 0x01, 0x35,
+	0x59, 0xa7, 0xb5, 0x38, 0x3e, 0xa1, 0x06, 0x39, 0x65, 0x9f, 0xfb, 0xe6, 0x25, 0xd4, 0x93, 0x60,
+	0x85, 0x9a, 0x24, 0x15, 0xbd, 0xda, 0xdb, 0xcf, 0xaf, 0xb8, 0xea, 0x55, 0x51, 0x76, 0xfe, 0xbf,
+	0xfd, 0xff, 0x00, 0xbc, 0xe4, 0x90, 0x96, 0x51, 0x15, 0x00, 0x00,
 }
@@ -0,0 +1,37 @@
+package api
+
+// ProtocolVersion is the version of the protocol between the CLI and the
+// daemon, returned by Version. It must be increased whenever a change breaks
+// the compatibility with the daemons of older versions, like adding a call the
+// CLI uses, removing one or changing the meaning of a field, so the CLI
+// recreates them.
+const ProtocolVersion = 6
+
+// RequestIDMetadata is the key of the metadata of the calls to the daemon
+// with their ID, sent by the CLI and logged by the daemon with the call, so
+// a failure reported by the CLI can be found in the logs of the daemon.
+const RequestIDMetadata = "x-request-id"
+
+// ClientIDMetadata is the key of the metadata of the calls to the daemon with
+// the ID of the client, the same for all the calls of a process of the CLI,
+// so the daemon takes turns between the clients with parse requests waiting.
+const ClientIDMetadata = "x-client-id"
+
+// RetryAfterMetadata is the key of the trailer of the calls rejected with
+// ResourceExhausted with the seconds to wait before sending them again.
+const RetryAfterMetadata = "retry-after"
+
+// Services of the grpc.health.v1 health checks of the daemon: the daemon
+// itself, also reported as the empty service of the whole server as the
+// protocol expects, and the connectivity to the components it depends on.
+// The ones of the components disabled on init are not found.
+const (
+	HealthDaemon  = "daemon"
+	HealthGitbase = "gitbase"
+	HealthBblfshd = "bblfshd"
+	HealthPilosa  = "pilosa"
+)
+
+// HealthServices are the services of the health checks, in the order they are
+// reported.
+var HealthServices = []string{HealthDaemon, HealthGitbase, HealthBblfshd, HealthPilosa}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"strings"
+
+	grpc "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// serverOptions returns the options of the server checking the token of the
+// calls, if it's not empty, and using TLS with the given certificate and key
+// in PEM, if they are not empty. Every call is logged with its request ID
+// and, with metrics, recorded in them, including the ones rejected. The calls
+// are cancelled when the shutdown is over.
+func serverOptions(token, cert, key string, withMetrics bool, sd *shutdown) ([]grpc.ServerOption, error) {
+	unary := []grpc.UnaryServerInterceptor{logUnaryInterceptor}
+	stream := []grpc.StreamServerInterceptor{logStreamInterceptor}
+	if withMetrics {
+		unary = append(unary, metricsUnaryInterceptor)
+		stream = append(stream, metricsStreamInterceptor)
+	}
+
+	unary = append(unary, sd.unaryInterceptor)
+	stream = append(stream, sd.streamInterceptor)
+
+	if token != "" {
+		unary = append(unary, tokenUnaryInterceptor(token))
+		stream = append(stream, tokenStreamInterceptor(token))
+	}
+
+	opts := []grpc.ServerOption{
+		grpc.UnaryInterceptor(chainUnary(unary)),
+		grpc.StreamInterceptor(chainStream(stream)),
+	}
+
+	if cert != "" || key != "" {
+		pair, err := tls.X509KeyPair([]byte(cert), []byte(key))
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, grpc.Creds(credentials.NewServerTLSFromCert(&pair)))
+	}
+	return opts, nil
+}
+
+// chainUnary runs the interceptors in order, as the server only takes one.
+func chainUnary(interceptors []grpc.UnaryServerInterceptor) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		next := handler
+		for i := len(interceptors) - 1; i >= 0; i-- {
+			interceptor, h := interceptors[i], next
+			next = func(ctx context.Context, req interface{}) (interface{}, error) {
+				return interceptor(ctx, req, info, h)
+			}
+		}
+		return next(ctx, req)
+	}
+}
+
+// chainStream runs the interceptors in order, as the server only takes one.
+func chainStream(interceptors []grpc.StreamServerInterceptor) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		next := handler
+		for i := len(interceptors) - 1; i >= 0; i-- {
+			interceptor, h := interceptors[i], next
+			next = func(srv interface{}, ss grpc.ServerStream) error {
+				return interceptor(srv, ss, info, h)
+			}
+		}
+		return next(srv, ss)
+	}
+}
+
+// checkToken fails if the call doesn't have the token as its bearer token.
+func checkToken(ctx context.Context, token string) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, v := range md.Get("authorization") {
+		if strings.HasPrefix(v, "Bearer ") &&
+			subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(v, "Bearer ")), []byte(token)) == 1 {
+			return nil
+		}
+	}
+	return status.Error(codes.Unauthenticated, "invalid or missing token of the daemon, "+
+		"give it with --daemon-token or SRCD_DAEMON_TOKEN")
+}
+
+// tokenUnaryInterceptor rejects the calls without the token before running
+// their handlers.
+func tokenUnaryInterceptor(token string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := checkToken(ctx, token); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// tokenStreamInterceptor rejects the streams without the token before running
+// their handlers.
+func tokenStreamInterceptor(token string) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := checkToken(ss.Context(), token); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	grpc "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestTokenUnaryInterceptor(t *testing.T) {
+	testCases := []struct {
+		name     string
+		md       metadata.MD
+		expected codes.Code
+	}{
+		{"valid", metadata.Pairs("authorization", "Bearer secret"), codes.OK},
+		{"missing", metadata.MD{}, codes.Unauthenticated},
+		{"wrong token", metadata.Pairs("authorization", "Bearer other"), codes.Unauthenticated},
+		{"not bearer", metadata.Pairs("authorization", "secret"), codes.Unauthenticated},
+	}
+
+	interceptor := tokenUnaryInterceptor("secret")
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var called bool
+			handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+				called = true
+				return nil, nil
+			}
+
+			ctx := metadata.NewIncomingContext(context.Background(), tc.md)
+			_, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{}, handler)
+			if got := status.Code(err); got != tc.expected {
+				t.Errorf("expected: %s, got: %s", tc.expected, got)
+			}
+
+			if called != (tc.expected == codes.OK) {
+				t.Errorf("expected the handler to run only with a valid token, ran: %v", called)
+			}
+		})
+	}
+}
+
+func TestChainUnary(t *testing.T) {
+	var calls []string
+	interceptor := func(name string) grpc.UnaryServerInterceptor {
+		return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			calls = append(calls, name)
+			return handler(ctx, req)
+		}
+	}
+
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		calls = append(calls, "handler")
+		return req, nil
+	}
+
+	chain := chainUnary([]grpc.UnaryServerInterceptor{interceptor("metrics"), interceptor("token")})
+	res, err := chain(context.Background(), "req", &grpc.UnaryServerInfo{}, handler)
+	if err != nil || res != "req" {
+		t.Fatalf("unexpected result: %v, %v", res, err)
+	}
+
+	expected := "metrics token handler"
+	if got := strings.Join(calls, " "); got != expected {
+		t.Errorf("expected: %s, got: %s", expected, got)
+	}
+}
@@ -0,0 +1,118 @@
+package engine
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	bblfsh "gopkg.in/bblfsh/client-go.v2"
+)
+
+// errClosed is returned when a call needs a connection to a component after
+// the server was closed.
+var errClosed = status.Errorf(codes.Unavailable, "the daemon is shutting down")
+
+// clients are the connections to bblfshd and gitbase, shared by all the
+// calls and opened on the first one needing them. They reconnect on their
+// own when the components are restarted.
+type clients struct {
+	mu      sync.Mutex
+	closed  bool
+	drivers *grpc.ClientConn
+	parse   *bblfsh.Client
+	gitbase *sql.DB
+}
+
+// driversConn returns the connection to the management API of bblfshd.
+func (c *clients) driversConn() (*grpc.ClientConn, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return nil, errClosed
+	}
+
+	if c.drivers == nil {
+		addr := fmt.Sprintf("%s:%d", bblfshd.Name, bblfshControlPort)
+		componentLogger(bblfshd.Name).Debugf("connecting to the management API on %s", addr)
+		conn, err := grpc.Dial(addr, grpc.WithInsecure())
+		if err != nil {
+			return nil, errors.Wrap(err, "could not connect to bblfsh drivers")
+		}
+		c.drivers = conn
+	}
+	return c.drivers, nil
+}
+
+// parseClient returns the client of the parsing API of bblfshd.
+func (c *clients) parseClient() (*bblfsh.Client, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return nil, errClosed
+	}
+
+	if c.parse == nil {
+		addr := fmt.Sprintf("%s:%d", bblfshd.Name, bblfshParsePort)
+		componentLogger(bblfshd.Name).Debugf("connecting to bblfsh parsing on %s", addr)
+		client, err := bblfsh.NewClient(addr)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not connect to bblfsh")
+		}
+		c.parse = client
+	}
+	return c.parse, nil
+}
+
+// gitbaseDB returns the pool of connections to gitbase, opened with the given
+// credentials.
+func (c *clients) gitbaseDB(user, password string) (*sql.DB, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return nil, errClosed
+	}
+
+	if c.gitbase == nil {
+		// The password is never logged.
+		componentLogger(gitbase.Name).Debugf("connecting to mysql %q", gitbaseDSN(user, ""))
+		db, err := sql.Open("mysql", gitbaseDSN(user, password))
+		if err != nil {
+			return nil, errors.Wrap(err, "could not connect to gitbase")
+		}
+		c.gitbase = db
+	}
+	return c.gitbase, nil
+}
+
+// close closes the connections opened, and makes the next calls needing
+// them fail. It returns the first error closing them.
+func (c *clients) close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.closed = true
+	var errs []error
+	if c.drivers != nil {
+		errs = append(errs, errors.Wrap(c.drivers.Close(), "could not close the connection to bblfsh drivers"))
+	}
+	if c.parse != nil {
+		errs = append(errs, errors.Wrap(c.parse.Close(), "could not close the connection to bblfsh"))
+	}
+	if c.gitbase != nil {
+		errs = append(errs, errors.Wrap(c.gitbase.Close(), "could not close the connections to gitbase"))
+	}
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
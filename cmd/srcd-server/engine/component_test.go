@@ -1,6 +1,14 @@
 package engine
 
-import "testing"
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/src-d/engine/components"
+	"github.com/src-d/engine/docker"
+)
 
 func TestJoin(t *testing.T) {
 	testCases := []struct {
@@ -21,3 +29,134 @@ func TestJoin(t *testing.T) {
 		})
 	}
 }
+
+func TestHiddenPaths(t *testing.T) {
+	mounts := []components.RepoMount{
+		{Host: "/home/me/work", Container: "/opt/repos/work"},
+		{Host: "/mnt/data/oss/", Container: "/opt/repos/oss"},
+	}
+
+	paths := hiddenPaths(mounts, []string{
+		"/home/me/work/app/vendor/lib/.git",
+		"/mnt/data/oss/bare.git",
+		"/home/me/workspace/other.git",
+	})
+
+	expected := []string{
+		"/opt/repos/work/app/vendor/lib/.git",
+		"/opt/repos/oss/bare.git",
+	}
+
+	if len(paths) != len(expected) {
+		t.Fatalf("expected: %v, got: %v", expected, paths)
+	}
+
+	for i, p := range paths {
+		if p != expected[i] {
+			t.Errorf("expected: %s, got: %s", expected[i], p)
+		}
+	}
+}
+
+// TestPilosaEndpoint checks gitbase is given the address pilosa is served on,
+// whatever its port, as the containers would be created.
+func TestPilosaEndpoint(t *testing.T) {
+	testCases := []struct {
+		name     string
+		opts     Options
+		bind     string
+		endpoint string
+		exposed  string
+	}{
+		{"default", Options{}, "0.0.0.0:10101", "srcd-cli-pilosa:10101", ""},
+		{"port", Options{PilosaPort: 10102}, "0.0.0.0:10102", "srcd-cli-pilosa:10102", ""},
+		{"exposed", Options{PilosaPort: 10102, PilosaExpose: "127.0.0.1"},
+			"0.0.0.0:10102", "srcd-cli-pilosa:10102", "127.0.0.1:10102"},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewServer("dev", "/home/me/work", "/home/me/.srcd", tt.opts)
+
+			pilosaConfig, pilosaHost := &container.Config{}, &container.HostConfig{}
+			docker.ApplyOptions(pilosaConfig, pilosaHost, s.pilosaConfig()...)
+			gitbaseConfig := &container.Config{}
+			docker.ApplyOptions(gitbaseConfig, &container.HostConfig{}, s.gitbaseConfig()...)
+
+			bind := envValue(pilosaConfig.Env, components.PilosaBindEnv)
+			if bind != tt.bind {
+				t.Errorf("expected: %s, got: %s", tt.bind, bind)
+			}
+
+			endpoint := envValue(gitbaseConfig.Env, components.GitbasePilosaEnv)
+			if endpoint != tt.endpoint {
+				t.Errorf("expected: %s, got: %s", tt.endpoint, endpoint)
+			}
+
+			_, bindPort, _ := net.SplitHostPort(bind)
+			_, endpointPort, _ := net.SplitHostPort(endpoint)
+			if bindPort != endpointPort {
+				t.Errorf("expected gitbase to reach pilosa on port %s, got: %s", bindPort, endpointPort)
+			}
+
+			var exposed string
+			for _, bindings := range pilosaHost.PortBindings {
+				for _, b := range bindings {
+					exposed = net.JoinHostPort(b.HostIP, b.HostPort)
+				}
+			}
+			if exposed != tt.exposed {
+				t.Errorf("expected: %q, got: %q", tt.exposed, exposed)
+			}
+		})
+	}
+}
+
+func envValue(env []string, key string) string {
+	for _, kv := range env {
+		if strings.HasPrefix(kv, key+"=") {
+			return strings.TrimPrefix(kv, key+"=")
+		}
+	}
+	return ""
+}
+
+// TestWorkdirMount checks the working directory is mounted in gitbase from
+// the volume it's synced into, if any, instead of the directory.
+func TestWorkdirMount(t *testing.T) {
+	testCases := []struct {
+		name     string
+		opts     Options
+		expected string
+	}{
+		{"directory", Options{}, "bind /home/me/work ro"},
+		{"writable directory", Options{WritableWorkdir: true}, "bind /home/me/work rw"},
+		{"volume", Options{WorkdirVolume: "srcd-cli-workdir"}, "volume srcd-cli-workdir ro"},
+		{"writable volume", Options{WorkdirVolume: "srcd-cli-workdir", WritableWorkdir: true}, "volume srcd-cli-workdir rw"},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewServer("dev", "/home/me/work", "/home/me/.srcd", tt.opts)
+
+			host := &container.HostConfig{}
+			docker.ApplyOptions(&container.Config{}, host, s.gitbaseConfig()...)
+
+			var result string
+			for _, m := range host.Mounts {
+				if m.Target != gitbaseMountPath {
+					continue
+				}
+
+				mode := "rw"
+				if m.ReadOnly {
+					mode = "ro"
+				}
+				result = strings.Join([]string{string(m.Type), m.Source, mode}, " ")
+			}
+			if result != tt.expected {
+				t.Errorf("expected: %s, got: %s", tt.expected, result)
+			}
+		})
+	}
+}
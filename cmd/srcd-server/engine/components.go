@@ -3,11 +3,15 @@ package engine
 import (
 	"context"
 	"fmt"
+	"strconv"
 	"strings"
 
+	"github.com/docker/go-units"
 	"github.com/src-d/engine/api"
 	"github.com/src-d/engine/components"
 	"github.com/src-d/engine/docker"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 // Component to be run.
@@ -49,79 +53,452 @@ func (s *Server) StartComponent(
 	ctx context.Context,
 	r *api.StartComponentRequest,
 ) (*api.StartComponentResponse, error) {
-	return &api.StartComponentResponse{}, s.startComponentAtPort(r.Name, int(r.Port))
+	return &api.StartComponentResponse{}, s.startComponentWith(r.Name, webOptions{
+		port:  int(r.Port),
+		bind:  r.BindAddress,
+		cert:  r.TlsCert,
+		key:   r.TlsKey,
+		token: r.WebToken,
+		base:  r.WebBasePath,
+	})
 }
 
 func (s *Server) StopComponent(
 	ctx context.Context,
 	r *api.StopComponentRequest,
 ) (*api.StopComponentResponse, error) {
+	switch r.Name {
+	case gitbaseWeb.Name, bblfshWeb.Name:
+		if err := docker.Kill(components.WebProxyName(r.Name)); err != nil && err != docker.ErrNotFound {
+			return nil, err
+		}
+	}
 	return &api.StopComponentResponse{}, docker.Kill(r.Name)
 }
 
 func (s *Server) startComponent(name string) error {
-	return s.startComponentAtPort(name, -1)
+	return s.startComponentWith(name, webOptions{port: -1})
 }
 
-func (s *Server) startComponentAtPort(name string, port int) error {
+func (s *Server) startComponentWith(name string, web webOptions) error {
+	if !s.enabled(name) {
+		return s.errDisabled(name)
+	}
+
+	switch name {
+	case gitbaseWeb.Name, bblfshWeb.Name:
+		if err := removeWebClientAtOtherPort(name, web); err != nil {
+			return err
+		}
+	}
+
 	switch name {
 	case gitbaseWeb.Name:
-		return Run(Component{
+		opts, err := web.clientOptions(*gitbaseWeb, gitbaseWebPrivatePort)
+		if err != nil {
+			return err
+		}
+
+		err = Run(Component{
 			Name:         gitbaseWeb.Name,
-			Start:        createGitbaseWeb(docker.WithPort(port, gitbaseWebPrivatePort)),
+			Start:        createGitbaseWeb(s.gitbaseUser(), s.opts.GitbasePassword, opts...),
 			Dependencies: []Component{s.gitbaseComponent()},
 		})
+		if err != nil {
+			return err
+		}
+		return runWebProxy(*gitbaseWeb, gitbaseWebPrivatePort, web)
 	case bblfshWeb.Name:
-		return Run(Component{
+		opts, err := web.clientOptions(*bblfshWeb, bblfshWebPrivatePort)
+		if err != nil {
+			return err
+		}
+
+		err = Run(Component{
 			Name:         bblfshWeb.Name,
-			Start:        createBblfshWeb(docker.WithPort(port, bblfshWebPrivatePort)),
+			Start:        createBblfshWeb(opts...),
 			Dependencies: []Component{s.bblfshComponent()},
 		})
+		if err != nil {
+			return err
+		}
+		return runWebProxy(*bblfshWeb, bblfshWebPrivatePort, web)
 	case bblfshd.Name:
 		return Run(s.bblfshComponent())
 	case gitbase.Name:
 		return Run(s.gitbaseComponent())
+	case pilosa.Name:
+		return Run(s.pilosaComponent())
 	default:
 		return fmt.Errorf("can't start unknown component %s", name)
 	}
 }
 
+// webOptions are how a web client is published: on the port of the host, or
+// on one chosen by docker if it's not positive, on the address of the host,
+// the loopback if it's empty, and through a proxy over HTTPS if the
+// certificate and key in PEM are given, only to the requests with the token
+// if it's given, and under the base path if it's given.
+type webOptions struct {
+	port  int
+	bind  string
+	cert  string
+	key   string
+	token string
+	base  string
+}
+
+// proxied reports whether the web client is served by its proxy.
+func (w webOptions) proxied() bool {
+	return w.cert != "" || w.token != ""
+}
+
+// options returns the options of the container of the web client, publishing
+// it on the host unless it's served by its proxy instead, and recording how
+// in its labels.
+func (w webOptions) options(private int) []docker.ConfigOption {
+	var label string
+	if w.port > 0 {
+		label = strconv.Itoa(w.port)
+	}
+	bind := w.bind
+	if bind == "" {
+		bind = components.WebDefaultBind
+	}
+
+	opts := []docker.ConfigOption{
+		docker.WithLabel(components.WebPortLabel, label),
+		docker.WithLabel(components.WebBindLabel, bind),
+		docker.WithLabel(components.WebTLSLabel, components.SecretFingerprint(w.cert)),
+		docker.WithLabel(components.WebAuthLabel, components.SecretFingerprint(w.token)),
+		docker.WithLabel(components.WebBasePathLabel, w.base),
+	}
+	if !w.proxied() {
+		opts = append(opts, docker.WithHostPort(bind, w.port, private))
+	}
+	return opts
+}
+
+// clientOptions returns the options of the container of the web client
+// itself, telling it its base path, if any, which fails if it can't be
+// served under one.
+func (w webOptions) clientOptions(c components.Component, private int) ([]docker.ConfigOption, error) {
+	opts := w.options(private)
+	if w.base == "" {
+		return opts, nil
+	}
+
+	b, ok := c.WebBasePath()
+	if !ok {
+		return nil, fmt.Errorf("%s can't be served under a base path", c.ShortName())
+	}
+	return append(opts, docker.WithEnv(b.Env, w.base)), nil
+}
+
+// removeWebClientAtOtherPort removes the container of the web client, and the
+// one of its proxy, if it was published on a port or an address of the host
+// other than the given ones, or with another certificate, token or base path,
+// so it's created again with the new ones. Without a port or an address, as
+// when it's started as a dependency, any one is fine. The containers created
+// before the address was recorded are created again when one is given.
+func removeWebClientAtOtherPort(name string, web webOptions) error {
+	if web.port <= 0 && web.bind == "" {
+		return nil
+	}
+
+	for _, n := range []string{name, components.WebProxyName(name)} {
+		c, err := docker.Info(n)
+		if err == docker.ErrNotFound {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		if reason, ok := webDrift(c, web); ok {
+			componentLogger(n).Infof("%s, creating it again", reason)
+			if err := docker.Kill(n); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// webDrift returns why the container of a web client, or of its proxy, is not
+// published as asked, or false if it is.
+func webDrift(c *docker.Container, web webOptions) (string, bool) {
+	if current, ok := components.WebPort(c); web.port > 0 && !(ok && current == web.port) {
+		return fmt.Sprintf("published on another port than %d", web.port), true
+	}
+
+	if current := c.Labels[components.WebBindLabel]; web.bind != "" && current != web.bind {
+		return "published on another address than " + web.bind, true
+	}
+
+	current, fp := c.Labels[components.WebTLSLabel], components.SecretFingerprint(web.cert)
+	switch {
+	case current == fp:
+	case fp == "":
+		return "served over HTTPS", true
+	case current == "":
+		return "served over HTTP", true
+	default:
+		return "served with another certificate", true
+	}
+
+	current, fp = c.Labels[components.WebAuthLabel], components.SecretFingerprint(web.token)
+	switch {
+	case current == fp:
+	case fp == "":
+		return "served with a token", true
+	case current == "":
+		return "served without a token", true
+	default:
+		return "served with another token", true
+	}
+
+	if current := c.Labels[components.WebBasePathLabel]; current != web.base {
+		return "served under another base path than " + valueOrRoot(web.base), true
+	}
+	return "", false
+}
+
+// valueOrRoot returns the base path, or / for the root.
+func valueOrRoot(base string) string {
+	if base == "" {
+		return "/"
+	}
+	return base
+}
+
+// runWebProxy starts the proxy serving the web client on the port of the
+// host given, if it's given a certificate or a token, or removes it
+// otherwise.
+func runWebProxy(c components.Component, private int, web webOptions) error {
+	name := components.WebProxyName(c.Name)
+	if !web.proxied() {
+		if err := docker.Kill(name); err != nil && err != docker.ErrNotFound {
+			return err
+		}
+		return nil
+	}
+
+	_, err := docker.InfoOrStart(name, createWebProxy(c, private, web))
+	return err
+}
+
 func (s *Server) gitbaseComponent() Component {
-	indexDir := join(s.datadir, "gitbase", s.workdirHash)
+	deps := []Component{s.bblfshComponent()}
+	if s.enabled(pilosa.Name) {
+		deps = append(deps, s.pilosaComponent())
+	}
 
 	return Component{
-		Name: gitbase.Name,
-		Start: createGitbase(
-			docker.WithSharedDirectory(s.workdir, gitbaseMountPath),
-			docker.WithSharedDirectory(indexDir, gitbaseIndexMountPath),
-			docker.WithPort(gitbasePort, gitbasePort),
-		),
-		Dependencies: []Component{
-			s.bblfshComponent(),
-			s.pilosaComponent(),
-		},
+		Name:         gitbase.Name,
+		Start:        createGitbase(s.gitbaseConfig()...),
+		Dependencies: deps,
 	}
 }
 
+// gitbaseConfig returns the options of the container of gitbase.
+func (s *Server) gitbaseConfig() []docker.ConfigOption {
+	indexDir := join(s.datadir, "gitbase", s.workdirHash)
+
+	endpoint := components.PilosaEndpoint(s.pilosaPort())
+	if !s.enabled(pilosa.Name) {
+		endpoint = components.PilosaDisabledEndpoint
+	}
+
+	opts := []docker.ConfigOption{
+		docker.WithSharedDirectory(indexDir, gitbaseIndexMountPath),
+		docker.WithPort(s.publicPort(gitbasePort), gitbasePort),
+		docker.WithEnv(components.GitbasePilosaEnv, endpoint),
+	}
+
+	for _, env := range s.opts.Gitbase.Env() {
+		kv := strings.SplitN(env, "=", 2)
+		opts = append(opts, docker.WithEnv(kv[0], kv[1]))
+	}
+
+	if s.opts.Gitbase.Metrics {
+		opts = append(opts, docker.WithLoopbackPort(
+			s.publicPort(components.GitbaseMetricsPort), components.GitbaseMetricsPort))
+	}
+
+	// Without credentials, gitbase keeps the ones of its image.
+	if s.opts.GitbaseUser != "" || s.opts.GitbasePassword != "" {
+		opts = append(opts,
+			docker.WithEnv(components.GitbaseUserEnv, s.gitbaseUser()),
+			docker.WithEnv(components.GitbasePasswordEnv, s.opts.GitbasePassword))
+	}
+
+	mounts := components.RepoMounts(s.workdir, s.opts.Repos)
+
+	// The working directory is the first one, the other directories are
+	// always read-only. When it's synced into a volume, the volume is
+	// mounted instead, and the paths hidden are still the ones of the
+	// directory.
+	for i, m := range mounts {
+		switch {
+		case i == 0 && s.opts.WorkdirVolume != "" && s.opts.WritableWorkdir:
+			opts = append(opts, docker.WithVolume(s.opts.WorkdirVolume, m.Container))
+		case i == 0 && s.opts.WorkdirVolume != "":
+			opts = append(opts, docker.WithReadOnlyVolume(s.opts.WorkdirVolume, m.Container))
+		case i == 0 && s.opts.WritableWorkdir:
+			opts = append(opts, docker.WithSharedDirectory(m.Host, m.Container))
+		default:
+			opts = append(opts, docker.WithReadOnlySharedDirectory(m.Host, m.Container))
+		}
+	}
+
+	for _, path := range hiddenPaths(mounts, s.opts.Hidden) {
+		opts = append(opts, docker.WithTmpfs(path))
+	}
+
+	if s.opts.Format == sivaFormat {
+		opts = append(opts, docker.WithCmd(gitbaseSivaCmd(s.gitbaseUser(), s.opts.GitbasePassword)...))
+	}
+	return opts
+}
+
 func (s *Server) bblfshComponent() Component {
+	opts := []docker.ConfigOption{
+		docker.WithVolume(components.BblfshVolume, bblfshMountPath),
+		docker.WithPort(s.publicPort(bblfshParsePort), bblfshParsePort),
+		docker.WithMemoryLimit(s.opts.BblfshMemory),
+	}
+
+	if s.opts.BblfshMaxDrivers > 0 {
+		opts = append(opts, docker.WithEnv(
+			bblfshMaxDriversEnv,
+			fmt.Sprint(s.opts.BblfshMaxDrivers),
+		))
+	}
+
 	return Component{
-		Name: bblfshd.Name,
-		Start: createBbblfshd(
-			s.installStableDrivers,
-			docker.WithVolume(components.BblfshVolume, bblfshMountPath),
-			docker.WithPort(bblfshParsePort, bblfshParsePort),
-		),
+		Name:  bblfshd.Name,
+		Start: createBbblfshd(s.volumeDevice(components.BblfshVolume), s.installStableDrivers, opts...),
 	}
 }
 
+// pilosaComponent returns pilosa with its data in the pilosa volume, bound to
+// the directory of the working directory in the data directory, so the same
+// data is used again when pilosa is created again, like on upgrades.
 func (s *Server) pilosaComponent() Component {
 	datadir := join(s.datadir, "pilosa", s.workdirHash)
 	return Component{
-		Name: pilosa.Name,
-		Start: createPilosa(
-			docker.WithSharedDirectory(datadir, pilosaMountPath),
-		),
+		Name:  pilosa.Name,
+		Start: createPilosa(datadir, s.pilosaConfig()...),
+	}
+}
+
+// pilosaMaxRestarts is how many times in a row docker starts pilosa again
+// when it crashes.
+const pilosaMaxRestarts = 5
+
+// pilosaConfig returns the options of the container of pilosa, served on the
+// port gitbase is given by gitbaseConfig, and published on the host if it's
+// exposed. docker starts it again when it crashes, see WatchCrashes.
+func (s *Server) pilosaConfig() []docker.ConfigOption {
+	port := s.pilosaPort()
+	opts := []docker.ConfigOption{
+		docker.WithVolume(components.PilosaVolume, pilosaMountPath),
+		docker.WithEnv(components.PilosaBindEnv, components.PilosaBind(port)),
+		docker.WithRestartPolicy(pilosaMaxRestarts),
+		docker.WithMemoryLimit(s.opts.PilosaMemory),
+	}
+
+	if s.opts.PilosaCacheSize > 0 {
+		opts = append(opts, docker.WithEnv(components.PilosaCacheSizeEnv,
+			strconv.FormatInt(s.opts.PilosaCacheSize/units.MiB, 10)))
+	}
+
+	if s.opts.PilosaExpose != "" {
+		opts = append(opts, docker.WithHostPort(s.opts.PilosaExpose, s.publicPort(port), port))
+	}
+	return opts
+}
+
+// pilosaPort returns the port pilosa is served on.
+func (s *Server) pilosaPort() int {
+	if s.opts.PilosaPort == 0 {
+		return components.PilosaDefaultPort
+	}
+	return s.opts.PilosaPort
+}
+
+// publicPort returns the port of the host a component is published on: the
+// given one in the default environment, and one chosen by docker in the
+// others, so several environments can run at once.
+func (s *Server) publicPort(port int) int {
+	if s.opts.Environment != "" && s.opts.Environment != docker.DefaultEnvironment {
+		return 0
+	}
+	return port
+}
+
+// volumeDevice returns the directory of the host where the volume with the
+// given name is kept, or an empty string to let docker decide.
+func (s *Server) volumeDevice(name string) string {
+	if s.opts.VolumesDir == "" {
+		return ""
+	}
+	return join(s.opts.VolumesDir, name)
+}
+
+// enabled reports whether the component was enabled on init. All of them are
+// enabled unless some were given.
+func (s *Server) enabled(name string) bool {
+	if len(s.opts.Components) == 0 {
+		return true
+	}
+
+	for _, c := range s.opts.Components {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
+
+// errDisabled returns the error for using a disabled component, telling how
+// to enable it.
+func (s *Server) errDisabled(name string) error {
+	c, ok := components.ByName(name)
+	if !ok {
+		c = components.Component{Name: name}
+	}
+
+	var enable []string
+	for _, e := range components.All {
+		if s.enabled(e.Name) {
+			enable = append(enable, e.ShortName())
+		}
+	}
+	enable = append(enable, c.ShortName())
+
+	return status.Error(codes.Unavailable,
+		components.DisabledMessage(c, strings.Join(enable, ",")))
+}
+
+// hiddenPaths returns the paths of the container where the given paths of the
+// host are mounted, ignoring the ones outside the mounts.
+func hiddenPaths(mounts []components.RepoMount, hidden []string) []string {
+	var paths []string
+	for _, h := range hidden {
+		sep := inferSeparator(h)
+		for _, m := range mounts {
+			prefix := strings.TrimRight(m.Host, sep) + sep
+			if !strings.HasPrefix(h, prefix) {
+				continue
+			}
+
+			rel := strings.Split(strings.TrimPrefix(h, prefix), sep)
+			paths = append(paths, m.Container+"/"+strings.Join(rel, "/"))
+			break
+		}
 	}
+	return paths
 }
 
 func inferSeparator(path string) string {
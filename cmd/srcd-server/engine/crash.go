@@ -0,0 +1,90 @@
+package engine
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/src-d/engine/components"
+	"github.com/src-d/engine/docker"
+)
+
+const (
+	// crashLogLines is how many of the last lines of the logs of a component
+	// are logged when it crashes.
+	crashLogLines = 20
+	// crashWatchRetry is how long to wait before watching the crashes again
+	// when docker can't be reached.
+	crashWatchRetry = 10 * time.Second
+)
+
+// WatchCrashes logs the crashes of pilosa, with the last lines of its logs,
+// until the context is done. docker starts it again, with its restart policy,
+// and gitbase reconnects to it.
+func (s *Server) WatchCrashes(ctx context.Context) {
+	d := newCrashDetector()
+	for {
+		err := docker.WatchContainers(ctx, pilosa.Name, func(e docker.ContainerEvent) {
+			if d.crashed(e) {
+				s.logCrash(ctx, e)
+			}
+		})
+		if err == nil {
+			return
+		}
+
+		componentLogger(pilosa.Name).WithError(err).Debug("could not watch the crashes of the component")
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(crashWatchRetry):
+		}
+	}
+}
+
+// logCrash logs the crash of the container, telling how to avoid it when it
+// was killed for running out of memory.
+func (s *Server) logCrash(ctx context.Context, e docker.ContainerEvent) {
+	logger := componentLogger(e.Name).WithField("exit_code", e.ExitCode)
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	if info, err := docker.Inspect(ctx, e.Name); err == nil && info.State != nil && info.State.OOMKilled {
+		logger.WithField("memory", components.PilosaContainerSettings(info)["memory"]).Error(
+			"pilosa was OOM-killed; consider raising --pilosa-memory or resetting indexes with srcd prune --reset-indexes")
+		return
+	}
+
+	lines, err := docker.Logs(ctx, e.Name, crashLogLines)
+	if err != nil {
+		logger.WithError(err).Error("the component crashed, and its logs could not be read")
+		return
+	}
+	logger.Errorf("the component crashed, the last lines of its logs:\n%s", strings.Join(lines, "\n"))
+}
+
+// crashDetector tells the containers dying on their own, crashes, from the
+// ones stopped or killed on purpose, like by srcd stop, which docker reports
+// before they die.
+type crashDetector struct {
+	stopping map[string]bool
+}
+
+func newCrashDetector() *crashDetector {
+	return &crashDetector{stopping: make(map[string]bool)}
+}
+
+// crashed reports whether the event is the one of a container crashing.
+func (d *crashDetector) crashed(e docker.ContainerEvent) bool {
+	switch e.Action {
+	case "kill", "stop":
+		d.stopping[e.Name] = true
+	case "start":
+		delete(d.stopping, e.Name)
+	case "die":
+		stopping := d.stopping[e.Name]
+		delete(d.stopping, e.Name)
+		return !stopping && e.ExitCode != "0"
+	}
+	return false
+}
@@ -0,0 +1,43 @@
+package engine
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/src-d/engine/docker"
+)
+
+func TestCrashDetector(t *testing.T) {
+	event := func(action, exitCode string) docker.ContainerEvent {
+		return docker.ContainerEvent{Name: "srcd-cli-pilosa", Action: action, ExitCode: exitCode}
+	}
+
+	testCases := []struct {
+		name     string
+		events   []docker.ContainerEvent
+		expected []bool
+	}{
+		{"crash", []docker.ContainerEvent{event("start", ""), event("die", "2")}, []bool{false, true}},
+		{"stopped", []docker.ContainerEvent{event("kill", ""), event("die", "137"), event("stop", "")},
+			[]bool{false, false, false}},
+		{"exited", []docker.ContainerEvent{event("die", "0")}, []bool{false}},
+		{"crash after restart", []docker.ContainerEvent{
+			event("kill", ""), event("die", "143"), event("start", ""), event("die", "1"),
+		}, []bool{false, false, false, true}},
+		{"oom", []docker.ContainerEvent{event("oom", ""), event("die", "137")}, []bool{false, true}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			d := newCrashDetector()
+			var crashed []bool
+			for _, e := range tc.events {
+				crashed = append(crashed, d.crashed(e))
+			}
+
+			if fmt.Sprint(crashed) != fmt.Sprint(tc.expected) {
+				t.Errorf("expected: %v, got: %v", tc.expected, crashed)
+			}
+		})
+	}
+}
@@ -9,9 +9,8 @@ import (
 
 	drivers "github.com/bblfsh/bblfshd/daemon/protocol"
 	"github.com/pkg/errors"
-	"github.com/sirupsen/logrus"
 	"github.com/src-d/engine/api"
-	"google.golang.org/grpc"
+	"github.com/src-d/engine/docker"
 	"gopkg.in/bblfsh/sdk.v1/manifest/discovery"
 )
 
@@ -22,11 +21,9 @@ func (s *Server) bblfshDriverClient() (drivers.ProtocolServiceClient, error) {
 		return nil, err
 	}
 
-	addr := fmt.Sprintf("%s:%d", bblfshd.Name, bblfshControlPort)
-	logrus.Infof("connecting to bblfsh management on %s", addr)
-	conn, err := grpc.Dial(addr, grpc.WithInsecure())
+	conn, err := s.clients.driversConn()
 	if err != nil {
-		return nil, errors.Wrap(err, "could not connect to bblfsh drivers")
+		return nil, err
 	}
 
 	return drivers.NewProtocolServiceClient(conn), nil
@@ -63,8 +60,26 @@ func (s *Server) InstallDriver(
 		return nil, err
 	}
 
-	err = s.installDriver(ctx, client, r.Language, r.Version, false)
-	return new(api.InstallDriverResponse), err
+	ref := driverImage(r.Language, r.Version)
+	if r.Archive != "" {
+		ref = "docker-archive:" + r.Archive
+	}
+
+	if err := s.installDriverImage(ctx, client, r.Language, ref, false); err != nil {
+		return nil, err
+	}
+
+	state, err := driverState(ctx, client, r.Language)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &api.InstallDriverResponse{Image: driverImage(r.Language, r.Version)}
+	if state != nil {
+		resp.Image = state.Reference
+		resp.Version = state.Version
+	}
+	return resp, nil
 }
 
 func (s *Server) UpdateDriver(
@@ -93,6 +108,26 @@ func (s *Server) RemoveDriver(
 	return new(api.RemoveDriverResponse), err
 }
 
+// driverState returns the state of the driver installed for the given
+// language, or nil if there is none.
+func driverState(
+	ctx context.Context,
+	client drivers.ProtocolServiceClient,
+	lang string,
+) (*drivers.DriverImageState, error) {
+	res, err := client.DriverStates(ctx, &drivers.DriverStatesRequest{})
+	if err != nil {
+		return nil, errors.Wrap(err, "could not list drivers from bblfsh")
+	}
+
+	for _, state := range res.State {
+		if strings.EqualFold(state.Language, lang) {
+			return state, nil
+		}
+	}
+	return nil, nil
+}
+
 var (
 	driverCache struct {
 		sync.Once
@@ -114,7 +149,7 @@ func getOfficialDrivers() ([]discovery.Driver, error) {
 }
 
 func (s *Server) installStableDrivers() error {
-	logrus.Info("installing all recommended drivers")
+	componentLogger(bblfshd.Name).Info("installing all recommended drivers")
 
 	drivers, err := getOfficialDrivers()
 	if err != nil {
@@ -139,7 +174,8 @@ func (s *Server) installStableDrivers() error {
 			version = driver.Version
 		}
 
-		logrus.Infof("installing %s driver version %s", driver.Language, version)
+		componentLogger(bblfshd.Name).WithField("language", driver.Language).
+			Infof("installing the driver version %s", version)
 
 		err := s.installDriver(ctx, client, driver.Language, version, false)
 		if err != nil && err != ErrDriverAlreadyInstalled {
@@ -155,6 +191,18 @@ func (s *Server) installDriver(
 	client drivers.ProtocolServiceClient,
 	lang, version string,
 	update bool,
+) error {
+	return s.installDriverImage(ctx, client, lang, driverImage(lang, version), update)
+}
+
+// installDriverImage installs the driver for the language from the image with
+// the given reference, in any of the transports of bblfshd, like docker:// or
+// docker-archive:.
+func (s *Server) installDriverImage(
+	ctx context.Context,
+	client drivers.ProtocolServiceClient,
+	lang, ref string,
+	update bool,
 ) error {
 	if update {
 		_, err := client.RemoveDriver(ctx, &drivers.RemoveDriverRequest{Language: lang})
@@ -165,7 +213,7 @@ func (s *Server) installDriver(
 
 	resp, err := client.InstallDriver(ctx, &drivers.InstallDriverRequest{
 		Language:       lang,
-		ImageReference: driverImage(lang, version),
+		ImageReference: ref,
 		Update:         update,
 	})
 	if err != nil {
@@ -183,6 +231,8 @@ func (s *Server) installDriver(
 	return nil
 }
 
+// driverImage returns the image bblfshd pulls the driver from, in the
+// registry mirror if there's one.
 func driverImage(lang, version string) string {
-	return fmt.Sprintf("docker://bblfsh/%s-driver:%s", lang, version)
+	return fmt.Sprintf("docker://%s:%s", docker.MirrorImage("bblfsh/"+lang+"-driver"), version)
 }
@@ -4,8 +4,10 @@ import (
 	"context"
 	"crypto/sha1"
 	"encoding/hex"
+	"time"
 
 	api "github.com/src-d/engine/api"
+	"github.com/src-d/engine/components"
 )
 
 var _ api.EngineServer = new(Server)
@@ -15,18 +17,89 @@ type Server struct {
 	workdir     string
 	datadir     string
 	workdirHash string
+	opts        Options
+	limiter     *parseLimiter
+	operations  *operations
+	clients     clients
 }
 
-func NewServer(version, workdir, datadir string) *Server {
+// Options configure the components created by the server.
+type Options struct {
+	// BblfshMemory is the memory limit of bblfshd in bytes, 0 for no limit.
+	BblfshMemory int64
+	// BblfshMaxDrivers is the maximum number of instances of every driver
+	// bblfshd runs in parallel, 0 for the bblfshd default.
+	BblfshMaxDrivers int
+	// Repos are more directories with repositories to be mounted in gitbase
+	// along with the working directory.
+	Repos []string
+	// Format of the repositories read by gitbase, git or siva.
+	Format string
+	// Gitbase are the settings of gitbase, like its squashed tables or the
+	// size of its cache.
+	Gitbase components.GitbaseSettings
+	// Hidden are paths of the host inside the directories with repositories
+	// hidden from gitbase, like nested or bare repositories.
+	Hidden []string
+	// GitbaseUser and GitbasePassword are the credentials of the clients of
+	// gitbase, the daemon included. Without them, gitbase accepts the
+	// default user with no password.
+	GitbaseUser     string
+	GitbasePassword string
+	// WritableWorkdir mounts the working directory writable in gitbase,
+	// which only reads it, instead of read-only.
+	WritableWorkdir bool
+	// WorkdirVolume is the docker volume with a copy of the working
+	// directory, synced from the client when docker runs on another host,
+	// which is mounted in gitbase instead of the directory.
+	WorkdirVolume string
+	// PilosaPort is the port pilosa is served on, in its container and in
+	// the host if it's exposed, components.PilosaDefaultPort if it's 0.
+	PilosaPort int
+	// PilosaExpose is the address of the host pilosa is published on, like
+	// 127.0.0.1, empty to only reach it from the other components.
+	PilosaExpose string
+	// PilosaMemory is the memory limit of pilosa in bytes, 0 for no limit.
+	PilosaMemory int64
+	// PilosaCacheSize is the size of the caches of pilosa in bytes, 0 for
+	// its default.
+	PilosaCacheSize int64
+	// Components are the names of the components enabled on init. Empty
+	// means all of them.
+	Components []string
+	// VolumesDir is the directory of the host where the docker volumes are
+	// kept, if not the default of docker.
+	VolumesDir string
+	// ParseLimits limit the parse requests handled at once. They can be
+	// changed later with SetParseLimits.
+	ParseLimits ParseLimits
+	// OperationRetention is how long the operations finished are kept,
+	// DefaultOperationRetention if it's 0.
+	OperationRetention time.Duration
+	// Environment is the name of the environment of the components, empty
+	// for the default one. See components.SetEnvironment.
+	Environment string
+}
+
+func NewServer(version, workdir, datadir string, opts Options) *Server {
 	h := sha1.Sum([]byte(workdir))
 	return &Server{
 		version:     version,
 		workdir:     workdir,
 		datadir:     datadir,
 		workdirHash: hex.EncodeToString(h[:]),
+		opts:        opts,
+		limiter:     newParseLimiter(opts.ParseLimits.withDefaults(opts.BblfshMaxDrivers)),
+		operations:  newOperations(opts.OperationRetention),
 	}
 }
 
+// Close closes the connections to the components. The calls made after it
+// needing them fail.
+func (s *Server) Close() error {
+	return s.clients.close()
+}
+
 func (s *Server) Version(ctx context.Context, req *api.VersionRequest) (*api.VersionResponse, error) {
-	return &api.VersionResponse{Version: s.version}, nil
+	return &api.VersionResponse{Version: s.version, Protocol: api.ProtocolVersion}, nil
 }
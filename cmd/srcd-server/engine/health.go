@@ -0,0 +1,154 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/src-d/engine/api"
+	"github.com/src-d/engine/components"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// ProbeOptions configure how often the components are probed for the health
+// checks, and how long every probe can take.
+type ProbeOptions struct {
+	Interval time.Duration
+	Timeout  time.Duration
+}
+
+// MinProbeInterval is the shortest interval the components can be probed
+// with, so the probes don't load them.
+const MinProbeInterval = time.Second
+
+// healthProbes check the connectivity to the components the daemon depends
+// on, once their containers are running and healthy.
+var healthProbes = []struct {
+	service   string
+	component string
+	probe     func(*Server, context.Context) error
+}{
+	{api.HealthGitbase, gitbase.Name, (*Server).pingGitbase},
+	{api.HealthBblfshd, bblfshd.Name, (*Server).dialBblfshd},
+	{api.HealthPilosa, pilosa.Name, (*Server).pingPilosa},
+}
+
+// Health returns the grpc.health.v1 service of the daemon, with the statuses
+// of the components updated by probing them every interval until the context
+// is done. They are unknown until the first probe finishes.
+func (s *Server) Health(ctx context.Context, opts ProbeOptions) *health.Server {
+	hs := health.NewServer()
+	hs.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+	hs.SetServingStatus(api.HealthDaemon, healthpb.HealthCheckResponse_SERVING)
+	for _, p := range healthProbes {
+		if s.enabled(p.component) {
+			hs.SetServingStatus(p.service, healthpb.HealthCheckResponse_UNKNOWN)
+		}
+	}
+
+	go s.watchHealth(ctx, hs, opts)
+	return hs
+}
+
+func (s *Server) watchHealth(ctx context.Context, hs *health.Server, opts ProbeOptions) {
+	t := time.NewTicker(opts.Interval)
+	defer t.Stop()
+
+	for {
+		s.probe(ctx, hs, opts.Timeout)
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// probe updates the health of the components in the metrics, and the status
+// of the services of the components enabled.
+func (s *Server) probe(ctx context.Context, hs *health.Server, timeout time.Duration) {
+	statuses := make(map[string]*components.Status)
+	for _, c := range components.All {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		st, err := components.GetStatus(ctx, c, false)
+		cancel()
+		if err != nil {
+			componentLogger(c.Name).WithError(err).Debug("could not get the status of the component")
+			continue
+		}
+
+		var healthy float64
+		if st.Healthy() {
+			healthy = 1
+		}
+		componentHealthy.Set(healthy, st.Name)
+		statuses[c.Name] = st
+	}
+
+	for _, p := range healthProbes {
+		if !s.enabled(p.component) {
+			continue
+		}
+
+		serving := healthpb.HealthCheckResponse_NOT_SERVING
+		if st := statuses[p.component]; st != nil && st.Healthy() {
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			err := p.probe(s, ctx)
+			cancel()
+			if err == nil {
+				serving = healthpb.HealthCheckResponse_SERVING
+			} else {
+				componentLogger(p.component).WithError(err).Debug("could not reach the component")
+			}
+		}
+		hs.SetServingStatus(p.service, serving)
+	}
+
+	if s.opts.Gitbase.Metrics {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		s.scrapeGitbase(ctx, statuses[gitbase.Name])
+		cancel()
+	}
+}
+
+// scrapeGitbase updates the metrics of gitbase with the ones it exports.
+func (s *Server) scrapeGitbase(ctx context.Context, st *components.Status) {
+	if st == nil || !st.Healthy() {
+		gitbaseMetricsUp.Set(0)
+		return
+	}
+
+	addr := fmt.Sprintf("%s:%d", gitbase.Name, components.GitbaseMetricsPort)
+	m, err := components.ScrapeGitbaseMetrics(ctx, addr)
+	if err != nil {
+		componentLogger(gitbase.Name).WithError(err).Debug("could not scrape the metrics of the component")
+		gitbaseMetricsUp.Set(0)
+		return
+	}
+
+	gitbaseMetricsUp.Set(1)
+	gitbaseActiveQueries.Set(float64(m.ActiveQueries))
+	gitbaseSlowQueries.Set(float64(m.SlowQueries))
+	if m.CacheHitRatio != nil {
+		gitbaseCacheHitRatio.Set(*m.CacheHitRatio)
+	}
+}
+
+func (s *Server) pingGitbase(ctx context.Context) error {
+	return components.ProbeGitbase(ctx, gitbaseAddress(), s.gitbaseUser(), s.opts.GitbasePassword)
+}
+
+func (s *Server) pingPilosa(ctx context.Context) error {
+	return components.ProbePilosa(ctx, components.PilosaEndpoint(s.pilosaPort()))
+}
+
+func (s *Server) dialBblfshd(ctx context.Context) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", fmt.Sprintf("%s:%d", bblfshd.Name, bblfshParsePort))
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
@@ -0,0 +1,335 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/src-d/engine/api"
+	"github.com/src-d/engine/cmd/srcd-server/metrics"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// ParseLimits limit the parse requests handled at once, so many concurrent
+// requests don't exhaust the memory of the daemon and bblfshd.
+type ParseLimits struct {
+	// Concurrency is the maximum number of files parsed at once, the
+	// maximum number of drivers of bblfshd if it's 0.
+	Concurrency int
+	// Queue is the maximum number of requests waiting for a slot, the ones
+	// above it are rejected.
+	Queue int
+	// QueueTimeout is how long a request can wait for a slot before it's
+	// rejected.
+	QueueTimeout time.Duration
+}
+
+// Defaults of ParseLimits.
+const (
+	defaultParseQueue        = 128
+	defaultParseQueueTimeout = 30 * time.Second
+)
+
+// withDefaults returns the limits with the defaults for the ones not given.
+// bblfshd runs as many instances of every driver as CPUs by default.
+func (l ParseLimits) withDefaults(maxDrivers int) ParseLimits {
+	if l.Concurrency <= 0 {
+		l.Concurrency = maxDrivers
+	}
+	if l.Concurrency <= 0 {
+		l.Concurrency = runtime.NumCPU()
+	}
+	if l.Queue <= 0 {
+		l.Queue = defaultParseQueue
+	}
+	if l.QueueTimeout <= 0 {
+		l.QueueTimeout = defaultParseQueueTimeout
+	}
+	return l
+}
+
+func (l ParseLimits) proto() *api.ParseLimits {
+	return &api.ParseLimits{
+		Concurrency:    int32(l.Concurrency),
+		Queue:          int32(l.Queue),
+		QueueTimeoutMs: int64(l.QueueTimeout / time.Millisecond),
+	}
+}
+
+// Bounds of the hint of how long to wait before sending again a rejected
+// request.
+const (
+	minRetryAfter = time.Second
+	maxRetryAfter = time.Minute
+)
+
+var (
+	parseInFlight = metrics.NewGauge("srcd_parse_in_flight",
+		"Parse requests being handled.")
+	parseQueueDepth = metrics.NewGauge("srcd_parse_queue_depth",
+		"Parse requests waiting for a slot.")
+	parseRejections = metrics.NewCounter("srcd_parse_rejections_total",
+		"Parse requests rejected by reason: queue_full or queue_timeout.", "reason")
+)
+
+// parseLimiter hands out the slots to parse files. The requests waiting for
+// one are queued by client, and the clients take turns, so one sending many
+// requests at once doesn't make the others wait for all of them.
+type parseLimiter struct {
+	mu       sync.Mutex
+	limits   ParseLimits
+	inFlight int
+	waiting  int
+	queues   map[string][]*parseWaiter
+	// clients with requests waiting, in the order they take turns.
+	clients []string
+	// avg is the moving average of how long the requests hold their slot.
+	avg time.Duration
+}
+
+type parseWaiter struct {
+	ready   chan struct{}
+	granted bool
+}
+
+func newParseLimiter(limits ParseLimits) *parseLimiter {
+	return &parseLimiter{limits: limits, queues: make(map[string][]*parseWaiter)}
+}
+
+// acquire waits for a slot for the client, and returns the function that
+// frees it. The requests are rejected with ResourceExhausted when the queue
+// is full or they wait for longer than its timeout.
+func (l *parseLimiter) acquire(ctx context.Context, client string) (func(), error) {
+	l.mu.Lock()
+	if l.inFlight < l.limits.Concurrency && l.waiting == 0 {
+		l.inFlight++
+		l.updateMetrics()
+		l.mu.Unlock()
+		return l.releaser(), nil
+	}
+
+	if l.waiting >= l.limits.Queue {
+		retry := l.retryAfter()
+		l.mu.Unlock()
+		return nil, rejected(ctx, "queue_full", "too many parse requests waiting", retry)
+	}
+
+	w := &parseWaiter{ready: make(chan struct{})}
+	if len(l.queues[client]) == 0 {
+		l.clients = append(l.clients, client)
+	}
+	l.queues[client] = append(l.queues[client], w)
+	l.waiting++
+	l.updateMetrics()
+	timeout := l.limits.QueueTimeout
+	l.mu.Unlock()
+
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+	select {
+	case <-w.ready:
+		return l.releaser(), nil
+	case <-t.C:
+	case <-ctx.Done():
+	}
+
+	l.mu.Lock()
+	if w.granted {
+		// The slot was given meanwhile.
+		l.mu.Unlock()
+		release := l.releaser()
+		if err := ctx.Err(); err != nil {
+			release()
+			return nil, status.FromContextError(err).Err()
+		}
+		return release, nil
+	}
+
+	l.remove(client, w)
+	retry := l.retryAfter()
+	l.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, status.FromContextError(err).Err()
+	}
+	return nil, rejected(ctx, "queue_timeout",
+		fmt.Sprintf("no slot to parse the file in %s", timeout), retry)
+}
+
+// releaser returns the function freeing a slot, once.
+func (l *parseLimiter) releaser() func() {
+	start := time.Now()
+	var once sync.Once
+	return func() {
+		once.Do(func() { l.release(time.Since(start)) })
+	}
+}
+
+func (l *parseLimiter) release(took time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.avg == 0 {
+		l.avg = took
+	} else {
+		l.avg = (4*l.avg + took) / 5
+	}
+
+	l.inFlight--
+	l.grant()
+}
+
+// grant gives the free slots to the clients waiting, taking turns.
+func (l *parseLimiter) grant() {
+	for l.inFlight < l.limits.Concurrency && len(l.clients) > 0 {
+		client := l.clients[0]
+		l.clients = l.clients[1:]
+
+		queue := l.queues[client]
+		w := queue[0]
+		if len(queue) > 1 {
+			l.queues[client] = queue[1:]
+			l.clients = append(l.clients, client)
+		} else {
+			delete(l.queues, client)
+		}
+
+		l.waiting--
+		l.inFlight++
+		w.granted = true
+		close(w.ready)
+	}
+	l.updateMetrics()
+}
+
+// remove takes the waiter out of the queue of the client.
+func (l *parseLimiter) remove(client string, w *parseWaiter) {
+	queue := l.queues[client]
+	for i, other := range queue {
+		if other == w {
+			queue = append(queue[:i], queue[i+1:]...)
+			break
+		}
+	}
+	l.waiting--
+
+	if len(queue) > 0 {
+		l.queues[client] = queue
+	} else {
+		delete(l.queues, client)
+		for i, c := range l.clients {
+			if c == client {
+				l.clients = append(l.clients[:i], l.clients[i+1:]...)
+				break
+			}
+		}
+	}
+	l.updateMetrics()
+}
+
+// retryAfter estimates how long the requests waiting take to be handled.
+func (l *parseLimiter) retryAfter() time.Duration {
+	wait := l.avg * time.Duration(l.waiting+1) / time.Duration(l.limits.Concurrency)
+	switch {
+	case wait < minRetryAfter:
+		return minRetryAfter
+	case wait > maxRetryAfter:
+		return maxRetryAfter
+	default:
+		return wait
+	}
+}
+
+// setLimits changes the limits given, the ones not positive are kept, and
+// returns the previous ones.
+func (l *parseLimiter) setLimits(limits ParseLimits) (current, previous ParseLimits, inFlight, waiting int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	previous = l.limits
+	if limits.Concurrency > 0 {
+		l.limits.Concurrency = limits.Concurrency
+	}
+	if limits.Queue > 0 {
+		l.limits.Queue = limits.Queue
+	}
+	if limits.QueueTimeout > 0 {
+		l.limits.QueueTimeout = limits.QueueTimeout
+	}
+
+	// The requests waiting get the new slots, the ones above a lower
+	// concurrency finish first.
+	l.grant()
+	return l.limits, previous, l.inFlight, l.waiting
+}
+
+func (l *parseLimiter) updateMetrics() {
+	parseInFlight.Set(float64(l.inFlight))
+	parseQueueDepth.Set(float64(l.waiting))
+}
+
+// rejected returns the error of a request rejected, setting the trailer with
+// the seconds to wait before sending it again.
+func rejected(ctx context.Context, reason, msg string, retry time.Duration) error {
+	parseRejections.Inc(reason)
+	seconds := int(math.Ceil(retry.Seconds()))
+	grpc.SetTrailer(ctx, metadata.Pairs(api.RetryAfterMetadata, strconv.Itoa(seconds)))
+	return status.Errorf(codes.ResourceExhausted, "%s, retry after %ds", msg, seconds)
+}
+
+// clientID returns the ID the client sends with its calls or, if there's
+// none, its address.
+func clientID(ctx context.Context) string {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if ids := md.Get(api.ClientIDMetadata); len(ids) > 0 && ids[0] != "" {
+			return ids[0]
+		}
+	}
+
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		return p.Addr.String()
+	}
+	return ""
+}
+
+// SetParseLimits changes the limits of the parse requests handled at once
+// until the daemon is recreated, and returns the previous ones.
+func (s *Server) SetParseLimits(ctx context.Context, req *api.SetParseLimitsRequest) (*api.SetParseLimitsResponse, error) {
+	var limits ParseLimits
+	if l := req.Limits; l != nil {
+		if l.Concurrency < 0 || l.Queue < 0 || l.QueueTimeoutMs < 0 {
+			return nil, status.Errorf(codes.InvalidArgument, "the parse limits can't be negative")
+		}
+
+		limits = ParseLimits{
+			Concurrency:  int(l.Concurrency),
+			Queue:        int(l.Queue),
+			QueueTimeout: time.Duration(l.QueueTimeoutMs) * time.Millisecond,
+		}
+	}
+
+	current, previous, inFlight, waiting := s.limiter.setLimits(limits)
+	if current != previous {
+		Logger(ctx).WithFields(logrus.Fields{
+			"concurrency":   current.Concurrency,
+			"queue":         current.Queue,
+			"queue_timeout": current.QueueTimeout.String(),
+		}).Info("parse limits changed")
+	}
+
+	return &api.SetParseLimitsResponse{
+		Limits:   current.proto(),
+		Previous: previous.proto(),
+		InFlight: int32(inFlight),
+		Queued:   int32(waiting),
+	}, nil
+}
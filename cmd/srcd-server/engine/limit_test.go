@@ -0,0 +1,129 @@
+package engine
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/src-d/engine/api"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// waitQueued waits until the limiter has n requests waiting.
+func waitQueued(t *testing.T, l *parseLimiter, n int) {
+	for i := 0; i < 1000; i++ {
+		l.mu.Lock()
+		waiting := l.waiting
+		l.mu.Unlock()
+		if waiting == n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("expected: %d requests waiting", n)
+}
+
+func TestParseLimiterFairness(t *testing.T) {
+	l := newParseLimiter(ParseLimits{Concurrency: 1, Queue: 10, QueueTimeout: time.Minute})
+	release, err := l.acquire(context.Background(), "greedy")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	order := make(chan string, 4)
+	acquire := func(client string) {
+		r, err := l.acquire(context.Background(), client)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+			order <- ""
+			return
+		}
+		order <- client
+		r()
+	}
+
+	for i := 0; i < 3; i++ {
+		go acquire("greedy")
+		waitQueued(t, l, i+1)
+	}
+	go acquire("cli")
+	waitQueued(t, l, 4)
+
+	release()
+	first, second := <-order, <-order
+	if first != "greedy" || second != "cli" {
+		t.Errorf("expected: greedy then cli, got: %s then %s", first, second)
+	}
+	<-order
+	<-order
+}
+
+func TestParseLimiterQueueFull(t *testing.T) {
+	l := newParseLimiter(ParseLimits{Concurrency: 1, Queue: 1, QueueTimeout: time.Minute})
+	release, _ := l.acquire(context.Background(), "a")
+	defer release()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go l.acquire(ctx, "b")
+	waitQueued(t, l, 1)
+
+	_, err := l.acquire(context.Background(), "c")
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("expected: %s, got: %v", codes.ResourceExhausted, err)
+	}
+}
+
+func TestParseLimiterQueueTimeout(t *testing.T) {
+	l := newParseLimiter(ParseLimits{Concurrency: 1, Queue: 10, QueueTimeout: 10 * time.Millisecond})
+	release, _ := l.acquire(context.Background(), "a")
+	defer release()
+
+	_, err := l.acquire(context.Background(), "b")
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("expected: %s, got: %v", codes.ResourceExhausted, err)
+	}
+
+	if l.waiting != 0 || len(l.clients) != 0 || len(l.queues) != 0 {
+		t.Errorf("expected: an empty queue, got: %d waiting, clients %v", l.waiting, l.clients)
+	}
+}
+
+func TestParseLimiterSetLimits(t *testing.T) {
+	l := newParseLimiter(ParseLimits{Concurrency: 1, Queue: 10, QueueTimeout: time.Minute})
+	release, _ := l.acquire(context.Background(), "a")
+	defer release()
+
+	done := make(chan error)
+	go func() {
+		r, err := l.acquire(context.Background(), "b")
+		if err == nil {
+			r()
+		}
+		done <- err
+	}()
+	waitQueued(t, l, 1)
+
+	current, previous, _, _ := l.setLimits(ParseLimits{Concurrency: 2})
+	if err := <-done; err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if current.Concurrency != 2 || current.Queue != 10 || previous.Concurrency != 1 {
+		t.Errorf("unexpected limits: %+v, previous: %+v", current, previous)
+	}
+}
+
+func TestClientID(t *testing.T) {
+	md := metadata.Pairs(api.ClientIDMetadata, "cli-1")
+	ctx := metadata.NewIncomingContext(context.Background(), md)
+	if got := clientID(ctx); got != "cli-1" {
+		t.Errorf("expected: cli-1, got: %s", got)
+	}
+
+	if got := clientID(context.Background()); got != "" {
+		t.Errorf("expected: no client, got: %s", got)
+	}
+}
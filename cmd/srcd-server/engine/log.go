@@ -0,0 +1,77 @@
+package engine
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/sirupsen/logrus"
+	"github.com/src-d/engine/api"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+type loggerKey struct{}
+
+// WithRequestLogger returns a context with the logger of the call to the
+// method, with its request ID: the one sent by the CLI or a generated one,
+// which is sent back in the header of the response.
+func WithRequestLogger(ctx context.Context, method string) (context.Context, *logrus.Entry) {
+	var id string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if ids := md.Get(api.RequestIDMetadata); len(ids) > 0 {
+			id = ids[0]
+		}
+	}
+
+	if id == "" {
+		id = newRequestID()
+		grpc.SetHeader(ctx, metadata.Pairs(api.RequestIDMetadata, id))
+	}
+
+	log := logrus.WithFields(logrus.Fields{"rpc": method, "request_id": id})
+	return context.WithValue(ctx, loggerKey{}, log), log
+}
+
+// Logger returns the logger of the call of the context, with its request ID,
+// or the standard one if there's none.
+func Logger(ctx context.Context) *logrus.Entry {
+	if log, ok := ctx.Value(loggerKey{}).(*logrus.Entry); ok {
+		return log
+	}
+	return logrus.NewEntry(logrus.StandardLogger())
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
+
+// componentLogger returns the logger of the operations on the component with
+// the given name.
+func componentLogger(name string) *logrus.Entry {
+	return logrus.WithField("component", name)
+}
+
+// SetLogLevel changes the level of the logs of the daemon, and returns the
+// previous one.
+func (s *Server) SetLogLevel(ctx context.Context, req *api.SetLogLevelRequest) (*api.SetLogLevelResponse, error) {
+	previous := logrus.GetLevel()
+	if req.Level == "" {
+		return &api.SetLogLevelResponse{Level: previous.String(), Previous: previous.String()}, nil
+	}
+
+	level, err := logrus.ParseLevel(req.Level)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid log level %q, it must be debug, info, warning or error", req.Level)
+	}
+
+	logrus.SetLevel(level)
+	Logger(ctx).WithField("previous", previous.String()).Infof("log level changed to %s", level)
+	return &api.SetLogLevelResponse{Level: level.String(), Previous: previous.String()}, nil
+}
@@ -0,0 +1,60 @@
+package engine
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/src-d/engine/api"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestWithRequestLogger(t *testing.T) {
+	md := metadata.Pairs(api.RequestIDMetadata, "0123abcd")
+	ctx := metadata.NewIncomingContext(context.Background(), md)
+
+	ctx, log := WithRequestLogger(ctx, "/Engine/Parse")
+	if got := log.Data["request_id"]; got != "0123abcd" {
+		t.Errorf("expected: 0123abcd, got: %v", got)
+	}
+
+	if got := log.Data["rpc"]; got != "/Engine/Parse" {
+		t.Errorf("expected: /Engine/Parse, got: %v", got)
+	}
+
+	if Logger(ctx) != log {
+		t.Errorf("expected: the logger of the call, got: %v", Logger(ctx).Data)
+	}
+
+	_, log = WithRequestLogger(context.Background(), "/Engine/SQL")
+	if id, _ := log.Data["request_id"].(string); len(id) != 16 {
+		t.Errorf("expected: a generated request ID, got: %q", id)
+	}
+}
+
+func TestSetLogLevel(t *testing.T) {
+	defer logrus.SetLevel(logrus.GetLevel())
+	logrus.SetLevel(logrus.InfoLevel)
+
+	s := &Server{}
+	res, err := s.SetLogLevel(context.Background(), &api.SetLogLevelRequest{})
+	if err != nil || res.Level != "info" {
+		t.Fatalf("expected: info, got: %v, %v", res, err)
+	}
+
+	res, err = s.SetLogLevel(context.Background(), &api.SetLogLevelRequest{Level: "debug"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if res.Level != "debug" || res.Previous != "info" || logrus.GetLevel() != logrus.DebugLevel {
+		t.Errorf("expected: debug from info, got: %s from %s", res.Level, res.Previous)
+	}
+
+	_, err = s.SetLogLevel(context.Background(), &api.SetLogLevelRequest{Level: "loud"})
+	if got := status.Code(err); got != codes.InvalidArgument {
+		t.Errorf("expected: %s, got: %s", codes.InvalidArgument, got)
+	}
+}
@@ -0,0 +1,45 @@
+package engine
+
+import (
+	"time"
+
+	"github.com/src-d/engine/cmd/srcd-server/metrics"
+	"github.com/src-d/engine/docker"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	parseRequests = metrics.NewCounter("srcd_parse_requests_total",
+		"Parse requests by language and status.", "language", "status")
+	sqlQueries = metrics.NewCounter("srcd_sql_queries_total",
+		"SQL queries run in gitbase by status.", "status")
+	componentHealthy = metrics.NewGauge("srcd_component_healthy",
+		"Whether the component is running and healthy, 1, or not, 0.", "component")
+	gitbaseMetricsUp = metrics.NewGauge("srcd_gitbase_metrics_up",
+		"Whether the metrics of gitbase could be scraped, 1, or not, 0.")
+	gitbaseActiveQueries = metrics.NewGauge("srcd_gitbase_active_queries",
+		"Queries running in gitbase, from its metrics.")
+	gitbaseSlowQueries = metrics.NewGauge("srcd_gitbase_slow_queries",
+		"Slow queries run in gitbase since it started, from its metrics.")
+	gitbaseCacheHitRatio = metrics.NewGauge("srcd_gitbase_cache_hit_ratio",
+		"Fraction of the git objects gitbase read from its cache, from its metrics.")
+	imagePullDuration = metrics.NewHistogram("srcd_image_pull_duration_seconds",
+		"How long pulling the images of the components took, by image and status.",
+		[]float64{1, 5, 10, 30, 60, 120, 300, 600}, "image", "status")
+)
+
+// StatusLabel returns the value of the status label of the metrics for the
+// call that returned the error: ok, or its gRPC code, like Unavailable.
+func StatusLabel(err error) string {
+	if err == nil {
+		return "ok"
+	}
+	return status.Code(err).String()
+}
+
+// ObservePulls records how long the image pulls take in the metrics.
+func ObservePulls() {
+	docker.OnPull = func(ref string, took time.Duration, err error) {
+		imagePullDuration.Observe(took.Seconds(), ref, StatusLabel(err))
+	}
+}
@@ -0,0 +1,356 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	drivers "github.com/bblfsh/bblfshd/daemon/protocol"
+	"github.com/sirupsen/logrus"
+	"github.com/src-d/engine/api"
+	"github.com/src-d/engine/docker"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// DefaultOperationRetention is how long the operations finished are kept by
+// default, to be found by the clients that were not watching them.
+const DefaultOperationRetention = time.Hour
+
+const (
+	// operationStepTimeout is how long every step of an operation can take.
+	operationStepTimeout = 5 * time.Minute
+	// operationLogLines is the number of lines of the logs of a container
+	// in the event of a step involving it that failed.
+	operationLogLines = 20
+)
+
+// operation is a long operation run in the background, independent of the
+// call that started it.
+type operation struct {
+	mu       sync.Mutex
+	id       string
+	kind     api.Operation_Kind
+	state    api.Operation_State
+	err      string
+	started  time.Time
+	finished time.Time
+	events   []*api.OperationEvent
+	// changed is closed, and replaced, whenever an event is added.
+	changed chan struct{}
+}
+
+func unixMs(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+// add appends the event with the current state of the operation.
+func (op *operation) add(e *api.OperationEvent) {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+
+	e.State = op.state
+	e.TimeMs = unixMs(time.Now())
+	op.events = append(op.events, e)
+	close(op.changed)
+	op.changed = make(chan struct{})
+}
+
+// since returns the events after the first n, and the channel closed when
+// there are more.
+func (op *operation) since(n int) ([]*api.OperationEvent, <-chan struct{}) {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	return op.events[n:], op.changed
+}
+
+// step runs a step of the operation, with the events of it starting and
+// finishing. If it fails, the last lines of the logs of the container with
+// the given name, if any, are in the event.
+func (op *operation) step(name, container string, run func(ctx context.Context) error) error {
+	op.add(&api.OperationEvent{Step: name, Status: api.OperationEvent_STARTED})
+
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), operationStepTimeout)
+	err := run(ctx)
+	cancel()
+
+	e := &api.OperationEvent{
+		Step:       name,
+		Status:     api.OperationEvent_SUCCEEDED,
+		DurationMs: int64(time.Since(start) / time.Millisecond),
+	}
+
+	if err != nil {
+		e.Status = api.OperationEvent_FAILED
+		e.Error = err.Error()
+		if container != "" {
+			ctx, cancel := context.WithTimeout(context.Background(), statusTimeout)
+			e.Logs, _ = docker.Logs(ctx, container, operationLogLines)
+			cancel()
+		}
+	}
+
+	op.add(e)
+	return err
+}
+
+// progress adds an event with the progress of the step.
+func (op *operation) progress(step string, done, total int64) {
+	op.add(&api.OperationEvent{
+		Step:   step,
+		Status: api.OperationEvent_PROGRESS,
+		Done:   done,
+		Total:  total,
+	})
+}
+
+// finish sets the result of the operation, and adds its last event.
+func (op *operation) finish(err error) {
+	e := &api.OperationEvent{Status: api.OperationEvent_SUCCEEDED}
+
+	op.mu.Lock()
+	op.finished = time.Now()
+	op.state = api.Operation_SUCCEEDED
+	if err != nil {
+		op.state = api.Operation_FAILED
+		op.err = err.Error()
+		e.Status = api.OperationEvent_FAILED
+		e.Error = op.err
+	}
+	e.DurationMs = int64(op.finished.Sub(op.started) / time.Millisecond)
+	op.mu.Unlock()
+
+	op.add(e)
+}
+
+func (op *operation) proto() *api.Operation {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+
+	return &api.Operation{
+		Id:           op.id,
+		Kind:         op.kind,
+		State:        op.state,
+		Error:        op.err,
+		StartedAtMs:  unixMs(op.started),
+		FinishedAtMs: unixMs(op.finished),
+		Events:       append([]*api.OperationEvent(nil), op.events...),
+	}
+}
+
+// operations are the operations running, and the ones finished within the
+// retention window.
+type operations struct {
+	mu        sync.Mutex
+	retention time.Duration
+	byID      map[string]*operation
+}
+
+func newOperations(retention time.Duration) *operations {
+	if retention <= 0 {
+		retention = DefaultOperationRetention
+	}
+	return &operations{retention: retention, byID: make(map[string]*operation)}
+}
+
+// start runs the operation in the background, and returns it.
+func (o *operations) start(kind api.Operation_Kind, run func(op *operation) error) *operation {
+	op := &operation{
+		// The ids are random like the ones of the requests.
+		id:      newRequestID(),
+		kind:    kind,
+		state:   api.Operation_RUNNING,
+		started: time.Now(),
+		changed: make(chan struct{}),
+	}
+
+	o.mu.Lock()
+	o.collect()
+	o.byID[op.id] = op
+	o.mu.Unlock()
+
+	go func() {
+		log := logrus.WithFields(logrus.Fields{"operation": op.id, "kind": kind.String()})
+		err := run(op)
+		op.finish(err)
+		if err != nil {
+			log.Errorf("operation failed: %v", err)
+		} else {
+			log.Info("operation succeeded")
+		}
+	}()
+	return op
+}
+
+// get returns the operation with the given id, or a NotFound error.
+func (o *operations) get(id string) (*operation, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.collect()
+	op, ok := o.byID[id]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound,
+			"operation %q not found, it never existed or it finished more than %s ago", id, o.retention)
+	}
+	return op, nil
+}
+
+// collect removes the operations finished before the retention window. It
+// must be called with the lock held.
+func (o *operations) collect() {
+	deadline := time.Now().Add(-o.retention)
+	for id, op := range o.byID {
+		op.mu.Lock()
+		expired := !op.finished.IsZero() && op.finished.Before(deadline)
+		op.mu.Unlock()
+
+		if expired {
+			delete(o.byID, id)
+		}
+	}
+}
+
+func (s *Server) StartOperation(ctx context.Context, req *api.StartOperationRequest) (*api.Operation, error) {
+	var run func(op *operation) error
+	switch req.Kind {
+	case api.Operation_START_COMPONENTS:
+		run = s.startComponentsOperation
+	case api.Operation_INSTALL_DRIVERS:
+		run = func(op *operation) error { return s.driversOperation(op, req.Drivers, false) }
+	case api.Operation_UPDATE_DRIVERS:
+		if len(req.Drivers) == 0 {
+			return nil, status.Errorf(codes.InvalidArgument, "the drivers to update must be given")
+		}
+		run = func(op *operation) error { return s.driversOperation(op, req.Drivers, true) }
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "unknown kind of operation %s", req.Kind)
+	}
+
+	op := s.operations.start(req.Kind, run)
+	Logger(ctx).WithFields(logrus.Fields{"operation": op.id, "kind": req.Kind.String()}).
+		Info("operation started")
+	return op.proto(), nil
+}
+
+func (s *Server) GetOperation(ctx context.Context, req *api.GetOperationRequest) (*api.Operation, error) {
+	op, err := s.operations.get(req.Id)
+	if err != nil {
+		return nil, err
+	}
+	return op.proto(), nil
+}
+
+func (s *Server) WatchOperation(req *api.WatchOperationRequest, stream api.Engine_WatchOperationServer) error {
+	op, err := s.operations.get(req.Id)
+	if err != nil {
+		return err
+	}
+
+	var sent int
+	for {
+		events, changed := op.since(sent)
+		for _, e := range events {
+			if err := stream.Send(e); err != nil {
+				return err
+			}
+		}
+
+		sent += len(events)
+		// Only the last event has the operation finished.
+		if len(events) > 0 && events[len(events)-1].State != api.Operation_RUNNING {
+			return nil
+		}
+
+		select {
+		case <-changed:
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
+}
+
+// startComponentsOperation starts the components enabled that srcd init
+// starts, with their dependencies.
+func (s *Server) startComponentsOperation(op *operation) error {
+	for _, c := range requiredComponents() {
+		if !s.enabled(c.Name) {
+			continue
+		}
+
+		name := c.Name
+		err := op.step("start "+c.ShortName(), name, func(context.Context) error {
+			return s.startComponent(name)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// driversOperation installs or updates the drivers given, or installs the
+// recommended ones if none is, in a step each, with the progress of all of
+// them after every one.
+func (s *Server) driversOperation(op *operation, list []*api.VersionedDriver, update bool) error {
+	var client drivers.ProtocolServiceClient
+	err := op.step("start "+bblfshd.ShortName(), bblfshd.Name, func(context.Context) error {
+		var err error
+		client, err = s.bblfshDriverClient()
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(list) == 0 {
+		err := op.step("list recommended drivers", "", func(context.Context) error {
+			official, err := getOfficialDrivers()
+			if err != nil {
+				return err
+			}
+
+			for _, d := range official {
+				if d.IsRecommended() {
+					list = append(list, &api.VersionedDriver{Language: d.Language, Version: d.Version})
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	verb := "install"
+	if update {
+		verb = "update"
+	}
+
+	for i, d := range list {
+		version := d.Version
+		if version == "" {
+			version = "latest"
+		}
+
+		lang := d.Language
+		err := op.step(fmt.Sprintf("%s %s driver", verb, lang), bblfshd.Name, func(ctx context.Context) error {
+			err := s.installDriver(ctx, client, lang, version, update)
+			if err == ErrDriverAlreadyInstalled {
+				return nil
+			}
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		op.progress(verb+" drivers", int64(i+1), int64(len(list)))
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/src-d/engine/api"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// waitOperation returns the events of the operation once it finishes.
+func waitOperation(t *testing.T, op *operation) []*api.OperationEvent {
+	for {
+		events, changed := op.since(0)
+		if len(events) > 0 && events[len(events)-1].State != api.Operation_RUNNING {
+			return events
+		}
+
+		select {
+		case <-changed:
+		case <-time.After(5 * time.Second):
+			t.Fatal("the operation did not finish")
+		}
+	}
+}
+
+func eventString(events []*api.OperationEvent) string {
+	var result []string
+	for _, e := range events {
+		s := fmt.Sprintf("%s %s %s", e.Step, e.Status, e.State)
+		if e.Status == api.OperationEvent_PROGRESS {
+			s += fmt.Sprintf(" %d/%d", e.Done, e.Total)
+		}
+		result = append(result, strings.TrimSpace(s))
+	}
+	return strings.Join(result, ", ")
+}
+
+func TestOperations(t *testing.T) {
+	testCases := []struct {
+		name     string
+		run      func(op *operation) error
+		state    api.Operation_State
+		expected string
+	}{
+		{
+			"succeeded",
+			func(op *operation) error {
+				if err := op.step("one", "", func(context.Context) error { return nil }); err != nil {
+					return err
+				}
+				op.progress("all", 1, 2)
+				return op.step("two", "", func(context.Context) error { return nil })
+			},
+			api.Operation_SUCCEEDED,
+			"one STARTED RUNNING, one SUCCEEDED RUNNING, all PROGRESS RUNNING 1/2, " +
+				"two STARTED RUNNING, two SUCCEEDED RUNNING, SUCCEEDED SUCCEEDED",
+		},
+		{
+			"failed",
+			func(op *operation) error {
+				return op.step("one", "", func(context.Context) error { return fmt.Errorf("broken") })
+			},
+			api.Operation_FAILED,
+			"one STARTED RUNNING, one FAILED RUNNING, FAILED FAILED",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ops := newOperations(time.Hour)
+			op := ops.start(api.Operation_START_COMPONENTS, tc.run)
+
+			got := eventString(waitOperation(t, op))
+			if got != tc.expected {
+				t.Errorf("expected: %s, got: %s", tc.expected, got)
+			}
+
+			found, err := ops.get(op.id)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			p := found.proto()
+			if p.State != tc.state || p.FinishedAtMs == 0 || eventString(p.Events) != tc.expected {
+				t.Errorf("expected: %s operation finished, got: %s", tc.state, p)
+			}
+		})
+	}
+}
+
+func TestOperationsRetention(t *testing.T) {
+	ops := newOperations(time.Minute)
+	op := ops.start(api.Operation_START_COMPONENTS, func(*operation) error { return nil })
+	waitOperation(t, op)
+
+	if _, err := ops.get(op.id); err != nil {
+		t.Fatalf("expected: the operation found, got: %v", err)
+	}
+
+	op.mu.Lock()
+	op.finished = time.Now().Add(-2 * time.Minute)
+	op.mu.Unlock()
+
+	_, err := ops.get(op.id)
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("expected: %s, got: %v", codes.NotFound, err)
+	}
+}
+
+func TestStartOperationInvalid(t *testing.T) {
+	s := NewServer("v1.0.0", "/repos", "/data", Options{})
+	testCases := []struct {
+		name string
+		req  *api.StartOperationRequest
+	}{
+		{"unknown kind", &api.StartOperationRequest{}},
+		{"no drivers to update", &api.StartOperationRequest{Kind: api.Operation_UPDATE_DRIVERS}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := s.StartOperation(context.Background(), tc.req)
+			if status.Code(err) != codes.InvalidArgument {
+				t.Errorf("expected: %s, got: %v", codes.InvalidArgument, err)
+			}
+		})
+	}
+}
@@ -3,7 +3,9 @@ package engine
 import (
 	"context"
 	"fmt"
+	"io"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/docker/docker/api/types/container"
@@ -12,6 +14,8 @@ import (
 	"github.com/src-d/engine/api"
 	"github.com/src-d/engine/components"
 	"github.com/src-d/engine/docker"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	bblfsh "gopkg.in/bblfsh/client-go.v2"
 	"gopkg.in/bblfsh/client-go.v2/tools"
 	"gopkg.in/bblfsh/sdk.v1/uast"
@@ -22,21 +26,24 @@ const (
 	bblfshMountPath   = "/var/lib/bblfshd"
 	bblfshParsePort   = 9432
 	bblfshControlPort = 9433
+	// bblfshMaxDriversEnv sets the maximum number of instances of each driver.
+	bblfshMaxDriversEnv = "BBLFSHD_MAX_DRIVER_INSTANCES"
 )
 
-var bblfshd = components.Bblfshd
+var bblfshd = &components.Bblfshd
 
 type logf func(format string, args ...interface{})
 
 func (s *Server) ParseWithLogs(req *api.ParseRequest, stream api.Engine_ParseWithLogsServer) error {
+	logger := Logger(stream.Context())
 	log := func(format string, args ...interface{}) {
-		logrus.Infof(format, args...)
+		logger.Infof(format, args...)
 		err := stream.Send(&api.ParseResponse{
 			Kind: api.ParseResponse_LOG,
 			Log:  fmt.Sprintf(format, args...),
 		})
 		if err != nil {
-			logrus.Errorf("could not stream log: %v", err)
+			logger.WithError(err).Error("could not stream log")
 		}
 	}
 
@@ -48,20 +55,137 @@ func (s *Server) ParseWithLogs(req *api.ParseRequest, stream api.Engine_ParseWit
 }
 
 func (s *Server) Parse(ctx context.Context, req *api.ParseRequest) (*api.ParseResponse, error) {
-	return s.parse(ctx, req, logrus.Infof)
+	return s.parse(ctx, req, Logger(ctx).Infof)
 }
 
-func (s *Server) parse(ctx context.Context, req *api.ParseRequest, log logf) (*api.ParseResponse, error) {
+// maxParseFilesJobs caps the files parsed at once by ParseFiles, so one
+// client doesn't flood bblfshd with more requests than it has drivers for.
+const maxParseFilesJobs = 16
+
+// ParseFiles parses the files received on the stream with a bounded number of
+// them at once, sending the result of each one as soon as it's done. It
+// returns once the client closes its side and every file was sent back, or
+// when the stream is canceled, aborting the files being parsed.
+func (s *Server) ParseFiles(stream api.Engine_ParseFilesServer) error {
+	ctx, cancel := context.WithCancel(stream.Context())
+	defer cancel()
+	logger := Logger(ctx)
+
+	var (
+		wg      sync.WaitGroup
+		sendMu  sync.Mutex
+		sendErr error
+		slots   chan struct{}
+	)
+	defer wg.Wait()
+
+	send := func(res *api.ParseFilesResponse) {
+		sendMu.Lock()
+		defer sendMu.Unlock()
+		if sendErr != nil {
+			return
+		}
+
+		if sendErr = stream.Send(res); sendErr != nil {
+			cancel()
+		}
+	}
+
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		if slots == nil {
+			slots = make(chan struct{}, parseFilesJobs(int(req.Jobs)))
+		}
+
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		wg.Add(1)
+		go func(req *api.ParseFilesRequest) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			send(s.parseFile(ctx, req, logger))
+		}(req)
+	}
+
+	wg.Wait()
+	sendMu.Lock()
+	defer sendMu.Unlock()
+	return sendErr
+}
+
+func parseFilesJobs(requested int) int {
+	if requested <= 0 || requested > maxParseFilesJobs {
+		return maxParseFilesJobs
+	}
+	return requested
+}
+
+// parseFile parses a file of ParseFiles, with its timeout.
+func (s *Server) parseFile(ctx context.Context, req *api.ParseFilesRequest, logger *logrus.Entry) *api.ParseFilesResponse {
+	if req.TimeoutMs > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(req.TimeoutMs)*time.Millisecond)
+		defer cancel()
+	}
+
+	file := req.File
+	if file == nil {
+		file = &api.ParseRequest{}
+	}
+
+	log := logger.WithField("file", file.Name).Debugf
+	res, err := s.parse(ctx, file, log)
+	if err == nil {
+		return &api.ParseFilesResponse{Id: req.Id, Code: int32(codes.OK), Result: res}
+	}
+
+	code := status.Code(err)
+	if ctx.Err() == context.DeadlineExceeded {
+		code = codes.DeadlineExceeded
+	}
+	return &api.ParseFilesResponse{Id: req.Id, Code: int32(code), Error: status.Convert(err).Message()}
+}
+
+// ValidateQuery checks the given XPath query applying it to an empty node, so
+// clients can reject invalid queries before parsing any file.
+func (s *Server) ValidateQuery(
+	ctx context.Context,
+	req *api.ValidateQueryRequest,
+) (*api.ValidateQueryResponse, error) {
+	if _, err := tools.Filter(uast.NewNode(), req.Query); err != nil {
+		return nil, errors.Wrapf(err, "invalid query %s", req.Query)
+	}
+	return &api.ValidateQueryResponse{}, nil
+}
+
+func (s *Server) parse(ctx context.Context, req *api.ParseRequest, log logf) (_ *api.ParseResponse, err error) {
 	log("got parse request")
 	lang := req.Lang
 	if lang == "" {
 		lang = enry.GetLanguage(req.Name, req.Content)
 	}
 	lang = strings.ToLower(lang)
+	defer func() { parseRequests.Inc(lang, StatusLabel(err)) }()
 	if req.Kind == api.ParseRequest_LANG {
 		return &api.ParseResponse{Lang: lang}, nil
 	}
 
+	release, err := s.limiter.acquire(ctx, clientID(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
 	// TODO(campoy): this should be a bit more flexible, might need to a table somewhere.
 
 	if err := s.startComponent(bblfshd.Name); err != nil {
@@ -73,18 +197,31 @@ func (s *Server) parse(ctx context.Context, req *api.ParseRequest, log logf) (*a
 		return nil, err
 	}
 
-	err = s.installDriver(ctx, dclient, lang, "latest", false)
-	if err == ErrDriverAlreadyInstalled {
-		log("driver was already installed")
-	} else if err != nil {
-		return nil, err
+	if req.NoInstall {
+		state, err := driverState(ctx, dclient, lang)
+		if err != nil {
+			return nil, err
+		}
+
+		if state == nil {
+			return nil, status.Errorf(codes.FailedPrecondition, "%s driver is not installed", lang)
+		}
+	} else {
+		err = s.installDriver(ctx, dclient, lang, "latest", false)
+		if err == ErrDriverAlreadyInstalled {
+			log("driver was already installed")
+		} else if err != nil {
+			return nil, err
+		}
 	}
 
-	addr := fmt.Sprintf("%s:%d", bblfshd.Name, bblfshParsePort)
-	log("connecting to bblfsh parsing on %s", addr)
-	client, err := bblfsh.NewClient(addr)
+	client, err := s.clients.parseClient()
 	if err != nil {
-		return nil, errors.Wrap(err, "could not connect to bblfsh")
+		return nil, err
+	}
+
+	if req.Mode != api.Mode_DEFAULT_MODE {
+		return parseWithMode(ctx, client, req, lang)
 	}
 
 	res, err := client.NewParseRequest().
@@ -116,23 +253,80 @@ func (s *Server) parse(ctx context.Context, req *api.ParseRequest, log logf) (*a
 	return resp, nil
 }
 
-func createBbblfshd(setupFunc func() error, opts ...docker.ConfigOption) docker.StartFunc {
+var bblfshModes = map[api.Mode]bblfsh.Mode{
+	api.Mode_NATIVE:    bblfsh.Native,
+	api.Mode_ANNOTATED: bblfsh.Annotated,
+	api.Mode_SEMANTIC:  bblfsh.Semantic,
+}
+
+// parseWithMode parses using the v2 protocol of bblfsh, which supports
+// choosing the UAST mode. The binary UAST is returned as is.
+func parseWithMode(
+	ctx context.Context,
+	client *bblfsh.Client,
+	req *api.ParseRequest,
+	lang string,
+) (*api.ParseResponse, error) {
+	mode, ok := bblfshModes[req.Mode]
+	if !ok {
+		return nil, fmt.Errorf("unknown UAST mode %s", req.Mode)
+	}
+
+	if req.Query != "" {
+		return nil, fmt.Errorf("queries can't be applied to UASTs in %s mode", modeName(req.Mode))
+	}
+
+	res, err := client.NewParseRequestV2().
+		Language(lang).
+		Content(string(req.Content)).
+		Filename(req.Name).
+		Mode(mode).
+		DoContext(ctx)
+	if status.Code(err) == codes.Unimplemented {
+		return nil, fmt.Errorf("%s driver does not support parsing in %s mode", lang, modeName(req.Mode))
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "%s driver could not parse in %s mode", lang, modeName(req.Mode))
+	}
+
+	if len(res.Errors) > 0 {
+		var msgs []string
+		for _, e := range res.Errors {
+			msgs = append(msgs, e.Text)
+		}
+		return nil, fmt.Errorf("%s driver could not parse in %s mode: %s",
+			lang, modeName(req.Mode), strings.Join(msgs, "; "))
+	}
+
+	return &api.ParseResponse{
+		Kind: api.ParseResponse_FINAL,
+		Lang: lang,
+		Uast: [][]byte{res.Uast},
+		Mode: req.Mode,
+	}, nil
+}
+
+func modeName(m api.Mode) string {
+	return strings.ToLower(m.String())
+}
+
+func createBbblfshd(volumeDevice string, setupFunc func() error, opts ...docker.ConfigOption) docker.StartFunc {
 	return func() error {
-		if err := docker.EnsureInstalled(bblfshd.Image, ""); err != nil {
+		if err := docker.EnsureInstalled(bblfshd.ImageName(), bblfshd.Tag()); err != nil {
 			return err
 		}
 
-		if err := docker.CreateVolume(context.Background(), components.BblfshVolume); err != nil {
+		err := docker.CreateVolume(context.Background(), components.BblfshVolume, volumeDevice, nil)
+		if err != nil {
 			return err
 		}
 
-		logrus.Infof("starting bblfshd daemon")
+		componentLogger(bblfshd.Name).Info("starting")
 
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
 
 		config := &container.Config{
-			Image: bblfshd.Image,
+			Image: bblfshd.Ref(),
 			Cmd:   []string{"-ctl-address=0.0.0.0:9433", "-ctl-network=tcp"},
 		}
 
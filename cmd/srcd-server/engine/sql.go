@@ -2,55 +2,104 @@ package engine
 
 import (
 	"context"
+	"database/sql/driver"
 	"fmt"
+	"net"
+	"regexp"
 	"time"
 
-	"database/sql"
-
 	"github.com/docker/docker/api/types/container"
 	"github.com/go-sql-driver/mysql"
 	"github.com/pkg/errors"
-	"github.com/sirupsen/logrus"
 	"github.com/src-d/engine/api"
 	"github.com/src-d/engine/components"
 	"github.com/src-d/engine/docker"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 const (
-	gitbasePort           = 3306
-	gitbaseMountPath      = "/opt/repos"
+	gitbasePort           = components.GitbasePort
+	gitbaseMountPath      = components.GitbaseReposPath
 	gitbaseIndexMountPath = "/var/lib/gitbase/index"
 	pilosaMountPath       = "/data"
-	pilosaPort            = 10101
 )
 
+// queryLimitMargin is how long after the query timeout of gitbase the daemon
+// gives up on a query, in case gitbase doesn't answer once it cancels it.
+const queryLimitMargin = 5 * time.Second
+
+// createIndexRegexp matches the statements creating indexes, which need
+// pilosa.
+var createIndexRegexp = regexp.MustCompile(`(?is)^\s*CREATE\s+INDEX\b`)
+
+// sivaFormat is the format of the repositories in siva files.
+const sivaFormat = "siva"
+
+// gitbaseSivaCmd returns the command running gitbase to read siva files
+// instead of git repositories, with the given credentials.
+func gitbaseSivaCmd(user, password string) []string {
+	cmd := []string{
+		"gitbase", "server", "-v",
+		"--host=0.0.0.0",
+		fmt.Sprintf("--port=%d", gitbasePort),
+		"--user=" + user,
+		"--directories=" + gitbaseMountPath,
+		"--index=" + gitbaseIndexMountPath,
+		"--format=" + sivaFormat,
+	}
+	if password != "" {
+		cmd = append(cmd, "--password="+password)
+	}
+	return cmd
+}
+
+// The components are pointers, as they are renamed for the environment of
+// the daemon.
 var (
-	gitbase = components.Gitbase
-	pilosa  = components.Pilosa
+	gitbase = &components.Gitbase
+	pilosa  = &components.Pilosa
 )
 
-func (s *Server) SQL(ctx context.Context, req *api.SQLRequest) (*api.SQLResponse, error) {
-	err := s.startComponent(gitbase.Name)
+func (s *Server) SQL(ctx context.Context, req *api.SQLRequest) (_ *api.SQLResponse, err error) {
+	defer func() { sqlQueries.Inc(StatusLabel(err)) }()
+
+	if !s.enabled(pilosa.Name) && createIndexRegexp.MatchString(req.Query) {
+		return nil, status.Errorf(codes.FailedPrecondition,
+			"pilosa is disabled, so indexes can't be created; re-run init with --components +pilosa to enable it")
+	}
+
+	err = s.startComponent(gitbase.Name)
 	if err != nil {
 		return nil, err
 	}
 
-	cfg := mysql.Config{
-		User:                 "root",
-		Net:                  "tcp",
-		Addr:                 gitbase.Name,
-		AllowNativePasswords: true,
-		MaxAllowedPacket:     32 * (2 << 10),
-	}
-	logrus.Infof("connecting to mysql %q", cfg.FormatDSN())
-	db, err := sql.Open("mysql", cfg.FormatDSN())
+	db, err := s.clients.gitbaseDB(s.gitbaseUser(), s.opts.GitbasePassword)
 	if err != nil {
-		return nil, errors.Wrap(err, "could not connect to gitbase")
+		return nil, err
+	}
+
+	limit := s.opts.Gitbase.QueryTimeout
+	if limit > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, limit+queryLimitMargin)
+		defer cancel()
+	}
+
+	start := time.Now()
+	rows, err := db.QueryContext(ctx, req.Query)
+	if err != nil && isConnectionError(err) {
+		// gitbase could still be starting, the query is tried again once
+		// it's ready.
+		if werr := s.waitForGitbase(ctx); werr == nil {
+			start = time.Now()
+			rows, err = db.QueryContext(ctx, req.Query)
+		}
 	}
-	rows, err := db.Query(req.Query)
 	if err != nil {
-		return nil, errors.Wrap(err, "SQL query failed")
+		return nil, queryError(err, "SQL query failed", limit, time.Since(start))
 	}
+	defer rows.Close()
 	columns, err := rows.Columns()
 	if err != nil {
 		return nil, errors.Wrap(err, "could not fetch columns")
@@ -74,12 +123,73 @@ func (s *Server) SQL(ctx context.Context, req *api.SQLRequest) (*api.SQLResponse
 		res.Rows = append(res.Rows, row)
 	}
 
-	return res, errors.Wrap(rows.Err(), "closing row iterator")
+	if err := rows.Err(); err != nil {
+		return nil, queryError(err, "closing row iterator", limit, time.Since(start))
+	}
+	return res, nil
+}
+
+// queryError returns the error of a query that failed after running for the
+// given time. Gitbase drops the connection of the queries running for longer
+// than its limit, so their errors are replaced by one saying so instead of a
+// generic connection error.
+func queryError(err error, msg string, limit, elapsed time.Duration) error {
+	if limit > 0 && elapsed >= limit {
+		return status.Errorf(codes.DeadlineExceeded,
+			"query exceeded the server limit of %s", components.ShortDuration(limit))
+	}
+	return errors.Wrap(err, msg)
+}
+
+// gitbaseUser returns the user the daemon connects to gitbase with.
+func (s *Server) gitbaseUser() string {
+	if s.opts.GitbaseUser == "" {
+		return components.DefaultGitbaseUser
+	}
+	return s.opts.GitbaseUser
+}
+
+// gitbaseDSN returns the data source name gitbase is reached with from the
+// network of the components, with the given credentials.
+func gitbaseDSN(user, password string) string {
+	return components.GitbaseDSN(gitbaseAddress(), user, password)
+}
+
+// gitbaseAddress returns the address gitbase is reached at from the network
+// of the components.
+func gitbaseAddress() string {
+	return fmt.Sprintf("%s:%d", gitbase.Name, gitbasePort)
+}
+
+// gitbaseConnectTimeout is how long a query waits for gitbase to be ready
+// when it couldn't connect to it, like right after starting it.
+const gitbaseConnectTimeout = time.Minute
+
+// isConnectionError reports whether the error of a query is about the
+// connection to gitbase, not the query itself.
+func isConnectionError(err error) bool {
+	if err == driver.ErrBadConn || err == mysql.ErrInvalidConn {
+		return true
+	}
+
+	_, ok := err.(net.Error)
+	return ok
+}
+
+// waitForGitbase waits until gitbase is ready, with the same probe as the
+// health check.
+func (s *Server) waitForGitbase(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, gitbaseConnectTimeout)
+	defer cancel()
+
+	return components.WaitForGitbase(ctx, s.pingGitbase, func(err error) {
+		componentLogger(gitbase.Name).WithError(err).Debug("waiting for the component to be ready")
+	})
 }
 
 func createGitbase(opts ...docker.ConfigOption) docker.StartFunc {
 	return func() error {
-		if err := docker.EnsureInstalled(gitbase.Image, ""); err != nil {
+		if err := docker.EnsureInstalled(gitbase.ImageName(), gitbase.Tag()); err != nil {
 			return err
 		}
 
@@ -87,10 +197,9 @@ func createGitbase(opts ...docker.ConfigOption) docker.StartFunc {
 		defer cancel()
 
 		config := &container.Config{
-			Image: gitbase.Image,
+			Image: gitbase.Ref(),
 			Env: []string{
 				fmt.Sprintf("BBLFSH_ENDPOINT=%s:%d", bblfshd.Name, bblfshParsePort),
-				fmt.Sprintf("PILOSA_ENDPOINT=%s:%d", pilosa.Name, pilosaPort),
 			},
 		}
 		host := &container.HostConfig{}
@@ -100,17 +209,21 @@ func createGitbase(opts ...docker.ConfigOption) docker.StartFunc {
 	}
 }
 
-func createPilosa(opts ...docker.ConfigOption) docker.StartFunc {
+func createPilosa(datadir string, opts ...docker.ConfigOption) docker.StartFunc {
 	return func() error {
-		if err := docker.EnsureInstalled(pilosa.Image, pilosa.Version); err != nil {
+		if err := docker.EnsureInstalled(pilosa.ImageName(), pilosa.Tag()); err != nil {
 			return err
 		}
 
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
 
+		if err := ensurePilosaVolume(ctx, datadir); err != nil {
+			return err
+		}
+
 		config := &container.Config{
-			Image: pilosa.Image + ":" + pilosa.Version,
+			Image: pilosa.Ref(),
 		}
 		host := &container.HostConfig{}
 		docker.ApplyOptions(config, host, opts...)
@@ -118,3 +231,23 @@ func createPilosa(opts ...docker.ConfigOption) docker.StartFunc {
 		return docker.Start(ctx, config, host, pilosa.Name)
 	}
 }
+
+// ensurePilosaVolume creates the pilosa volume bound to the given directory,
+// labeled as an index volume so it's only pruned when asked to. The one of
+// another working directory is created again, as pilosa is not using it.
+func ensurePilosaVolume(ctx context.Context, datadir string) error {
+	device, err := docker.VolumeDevice(ctx, components.PilosaVolume)
+	switch {
+	case err == docker.ErrNotFound:
+	case err != nil:
+		return err
+	case device != datadir:
+		if err := docker.RemoveVolume(ctx, components.PilosaVolume); err != nil {
+			return errors.Wrapf(err, "could not remove the pilosa volume of %s", device)
+		}
+	}
+
+	labels := map[string]string{components.VolumeClassLabel: string(components.IndexVolume)}
+	err = docker.CreateVolume(ctx, components.PilosaVolume, datadir, labels)
+	return errors.Wrap(err, "could not create the pilosa volume")
+}
@@ -0,0 +1,39 @@
+package engine
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestQueryError(t *testing.T) {
+	errConn := fmt.Errorf("invalid connection")
+
+	testCases := []struct {
+		name     string
+		limit    time.Duration
+		elapsed  time.Duration
+		code     codes.Code
+		expected string
+	}{
+		{"no limit", 0, time.Hour, codes.Unknown, "SQL query failed: invalid connection"},
+		{"before the limit", 10 * time.Minute, time.Minute, codes.Unknown, "SQL query failed: invalid connection"},
+		{"at the limit", 10 * time.Minute, 10 * time.Minute, codes.DeadlineExceeded, "query exceeded the server limit of 10m"},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			err := queryError(errConn, "SQL query failed", tt.limit, tt.elapsed)
+			s := status.Convert(err)
+			if s.Code() != tt.code {
+				t.Errorf("expected: %s, got: %s", tt.code, s.Code())
+			}
+			if s.Message() != tt.expected {
+				t.Errorf("expected: %s, got: %s", tt.expected, s.Message())
+			}
+		})
+	}
+}
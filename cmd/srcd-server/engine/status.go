@@ -0,0 +1,238 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/golang/protobuf/proto"
+	"github.com/src-d/engine/api"
+	"github.com/src-d/engine/components"
+	"github.com/src-d/engine/docker"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// statusTimeout is how long getting the status of every component can
+	// take.
+	statusTimeout = 5 * time.Second
+	// statusDebounce is how long a watch waits after an event of the
+	// containers for more before sending the status, so the several events
+	// of a restart send only one.
+	statusDebounce = 500 * time.Millisecond
+)
+
+// requiredComponents returns the components started by srcd init, required
+// to be healthy when they are enabled, along with the daemon. It's not a
+// variable, as they are renamed for the environment.
+func requiredComponents() []components.Component {
+	return []components.Component{
+		components.Bblfshd,
+		components.Pilosa,
+		components.Gitbase,
+	}
+}
+
+var componentStates = map[string]api.ComponentStatus_State{
+	components.StateRunning:    api.ComponentStatus_RUNNING,
+	components.StateStopped:    api.ComponentStatus_STOPPED,
+	components.StateNotCreated: api.ComponentStatus_NOT_CREATED,
+}
+
+var componentHealths = map[string]api.ComponentStatus_Health{
+	components.HealthNone: api.ComponentStatus_NO_HEALTH_CHECK,
+	types.Healthy:         api.ComponentStatus_HEALTHY,
+	types.Unhealthy:       api.ComponentStatus_UNHEALTHY,
+	types.Starting:        api.ComponentStatus_STARTING,
+}
+
+func (s *Server) GetEnvironmentStatus(
+	ctx context.Context,
+	req *api.GetEnvironmentStatusRequest,
+) (*api.EnvironmentStatus, error) {
+	return s.environmentStatus(ctx), nil
+}
+
+// WatchEnvironmentStatus sends the status of the environment, and again
+// whenever docker reports a change of the containers of the components that
+// changes it, until the client cancels the call.
+func (s *Server) WatchEnvironmentStatus(
+	req *api.WatchEnvironmentStatusRequest,
+	stream api.Engine_WatchEnvironmentStatusServer,
+) error {
+	ctx := stream.Context()
+
+	// The watch starts before the first status, so no change is missed.
+	changed := make(chan struct{}, 1)
+	watchErr := make(chan error, 1)
+	go func() {
+		watchErr <- docker.WatchContainers(ctx, components.Prefix(), func(docker.ContainerEvent) {
+			select {
+			case changed <- struct{}{}:
+			default:
+			}
+		})
+	}()
+
+	var last *api.EnvironmentStatus
+	send := func() error {
+		st := s.environmentStatus(ctx)
+		if last != nil && proto.Equal(last, st) {
+			return nil
+		}
+
+		last = st
+		return stream.Send(st)
+	}
+
+	if err := send(); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-changed:
+			select {
+			case <-time.After(statusDebounce):
+			case <-ctx.Done():
+				return nil
+			}
+
+			select {
+			case <-changed:
+			default:
+			}
+
+			if err := send(); err != nil {
+				return err
+			}
+		case err := <-watchErr:
+			if err == nil {
+				return nil
+			}
+			return status.Errorf(codes.Unavailable, "%v", err)
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// environmentStatus gets the status of every component at the same time.
+func (s *Server) environmentStatus(ctx context.Context) *api.EnvironmentStatus {
+	cmps := append([]components.Component{components.Daemon}, components.All...)
+	statuses := make([]*components.Status, len(cmps))
+	errs := make([]error, len(cmps))
+
+	var wg sync.WaitGroup
+	for i, c := range cmps {
+		wg.Add(1)
+		go func(i int, c components.Component) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, statusTimeout)
+			defer cancel()
+			statuses[i], errs[i] = components.GetStatus(ctx, c, false)
+		}(i, c)
+	}
+	wg.Wait()
+
+	return s.newEnvironmentStatus(cmps, statuses, errs)
+}
+
+// newEnvironmentStatus returns the status of the environment with the ones of
+// the components, and the problems found in them. The statuses of the
+// components with an error are not used.
+func (s *Server) newEnvironmentStatus(
+	cmps []components.Component,
+	statuses []*components.Status,
+	errs []error,
+) *api.EnvironmentStatus {
+	env := &api.EnvironmentStatus{
+		Workdir:  s.workdir,
+		Repos:    s.opts.Repos,
+		Version:  s.version,
+		Protocol: api.ProtocolVersion,
+	}
+
+	var known []*components.Status
+	for i, c := range cmps {
+		if errs[i] != nil {
+			env.Components = append(env.Components, &api.ComponentStatus{
+				Name:  c.ShortName(),
+				Image: c.ImageName(),
+				Tag:   c.Tag(),
+			})
+			env.Problems = append(env.Problems, &api.Problem{
+				Check:    c.ShortName(),
+				Severity: api.Problem_FAILURE,
+				Message:  fmt.Sprintf("could not get the status of %s: %v", c.ShortName(), errs[i]),
+				Hint:     "make sure docker is running",
+			})
+			continue
+		}
+
+		known = append(known, statuses[i])
+		env.Components = append(env.Components, componentStatus(statuses[i]))
+	}
+
+	required := map[string]bool{components.Daemon.ShortName(): true}
+	for _, c := range requiredComponents() {
+		required[c.ShortName()] = s.enabled(c.Name)
+	}
+
+	unhealthy := components.Unhealthy(known, func(name string) bool { return required[name] })
+	if len(unhealthy) > 0 {
+		env.Problems = append(env.Problems, &api.Problem{
+			Check:    "health",
+			Severity: api.Problem_FAILURE,
+			Message:  "required components not healthy: " + strings.Join(unhealthy, ", "),
+			Hint:     "start them with srcd restart " + strings.Join(unhealthy, " "),
+		})
+	}
+
+	for _, u := range components.UnmetRequirements(known) {
+		env.Problems = append(env.Problems, &api.Problem{
+			Check:    "dependencies",
+			Severity: api.Problem_WARNING,
+			Message: fmt.Sprintf("%s is running, but %s, which it requires, is not",
+				u.Name, strings.Join(u.Stopped, ", ")),
+			Hint: "start them with srcd restart " + strings.Join(u.Stopped, " "),
+		})
+	}
+
+	// The socket of the daemon is only known by the CLI.
+	for _, a := range components.Addresses(known, "", "") {
+		env.Addresses = append(env.Addresses, &api.Address{
+			Component:   a.Component,
+			Description: a.Description,
+			Address:     a.Address,
+		})
+	}
+
+	env.Healthy = len(env.Problems) == 0
+	return env
+}
+
+func componentStatus(s *components.Status) *api.ComponentStatus {
+	c := &api.ComponentStatus{
+		Name:      s.Name,
+		Image:     s.Image,
+		Tag:       s.Tag,
+		Installed: s.Installed,
+		State:     componentStates[s.State],
+		Health:    componentHealths[s.Health],
+		Ports:     s.Ports,
+	}
+
+	if s.Override != nil {
+		c.Override = *s.Override
+	}
+
+	if s.StartedAt != nil {
+		c.StartedAtMs = s.StartedAt.UnixNano() / int64(time.Millisecond)
+	}
+	return c
+}
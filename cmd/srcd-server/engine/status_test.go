@@ -0,0 +1,118 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/src-d/engine/api"
+	"github.com/src-d/engine/components"
+)
+
+func TestNewEnvironmentStatus(t *testing.T) {
+	started := time.Unix(1500000000, 0)
+	running := func(c components.Component, ports ...string) *components.Status {
+		return &components.Status{Name: c.ShortName(), State: components.StateRunning,
+			Health: components.HealthNone, StartedAt: &started, Ports: ports}
+	}
+	stopped := func(c components.Component) *components.Status {
+		return &components.Status{Name: c.ShortName(), State: components.StateStopped,
+			Health: components.HealthNone}
+	}
+
+	cmps := []components.Component{components.Daemon, components.Bblfshd,
+		components.Pilosa, components.Gitbase, components.GitbaseWeb}
+
+	testCases := []struct {
+		name     string
+		enabled  []string
+		statuses []*components.Status
+		errs     []error
+		problems string
+	}{
+		{
+			"healthy",
+			nil,
+			[]*components.Status{running(components.Daemon), running(components.Bblfshd),
+				running(components.Pilosa), running(components.Gitbase, "3306->3306/tcp"),
+				stopped(components.GitbaseWeb)},
+			make([]error, len(cmps)),
+			"",
+		},
+		{
+			"stopped dependency",
+			nil,
+			[]*components.Status{running(components.Daemon), stopped(components.Bblfshd),
+				running(components.Pilosa), running(components.Gitbase, "3306->3306/tcp"),
+				stopped(components.GitbaseWeb)},
+			make([]error, len(cmps)),
+			"FAILURE health,WARNING dependencies",
+		},
+		{
+			"disabled",
+			[]string{components.Bblfshd.Name},
+			[]*components.Status{running(components.Daemon), running(components.Bblfshd),
+				stopped(components.Pilosa), stopped(components.Gitbase), stopped(components.GitbaseWeb)},
+			make([]error, len(cmps)),
+			"",
+		},
+		{
+			"error",
+			nil,
+			[]*components.Status{running(components.Daemon), nil,
+				running(components.Pilosa), stopped(components.Gitbase), stopped(components.GitbaseWeb)},
+			[]error{nil, fmt.Errorf("docker is gone"), nil, nil, nil},
+			"FAILURE bblfshd,FAILURE health",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := NewServer("v1.0.0", "/repos", "/data", Options{Components: tc.enabled})
+			env := s.newEnvironmentStatus(cmps, tc.statuses, tc.errs)
+
+			var problems []string
+			for _, p := range env.Problems {
+				problems = append(problems, p.Severity.String()+" "+p.Check)
+			}
+
+			got := strings.Join(problems, ",")
+			if got != tc.problems {
+				t.Errorf("expected: %s, got: %s", tc.problems, got)
+			}
+
+			if env.Healthy != (tc.problems == "") {
+				t.Errorf("expected healthy: %v, got: %v", tc.problems == "", env.Healthy)
+			}
+
+			if len(env.Components) != len(cmps) {
+				t.Fatalf("expected: %d components, got: %d", len(cmps), len(env.Components))
+			}
+		})
+	}
+}
+
+func TestComponentStatus(t *testing.T) {
+	started := time.Unix(1500000000, 0)
+	override := "me/gitbase:dev"
+	c := componentStatus(&components.Status{
+		Name: "gitbase", Image: "srcd/gitbase", Tag: "v0.19.0", Installed: true,
+		State: components.StateRunning, Health: "starting", Override: &override,
+		StartedAt: &started, Ports: []string{"3306->3306/tcp"},
+	})
+
+	expected := &api.ComponentStatus{
+		Name: "gitbase", Image: "srcd/gitbase", Tag: "v0.19.0", Installed: true,
+		State: api.ComponentStatus_RUNNING, Health: api.ComponentStatus_STARTING,
+		Override: override, StartedAtMs: 1500000000000, Ports: []string{"3306->3306/tcp"},
+	}
+	if c.String() != expected.String() {
+		t.Errorf("expected: %s, got: %s", expected, c)
+	}
+
+	c = componentStatus(&components.Status{Name: "pilosa", State: "paused", Health: "unknown"})
+	if c.State != api.ComponentStatus_STATE_UNKNOWN || c.Health != api.ComponentStatus_HEALTH_UNKNOWN {
+		t.Errorf("expected: unknown state and health, got: %s and %s", c.State, c.Health)
+	}
+}
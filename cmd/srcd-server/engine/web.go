@@ -6,7 +6,6 @@ import (
 	"time"
 
 	"github.com/docker/docker/api/types/container"
-	"github.com/sirupsen/logrus"
 	"github.com/src-d/engine/components"
 	"github.com/src-d/engine/docker"
 )
@@ -18,23 +17,23 @@ const (
 )
 
 var (
-	gitbaseWeb = components.GitbaseWeb
-	bblfshWeb  = components.BblfshWeb
+	gitbaseWeb = &components.GitbaseWeb
+	bblfshWeb  = &components.BblfshWeb
 )
 
 func createBblfshWeb(opts ...docker.ConfigOption) docker.StartFunc {
 	return func() error {
-		if err := docker.EnsureInstalled(bblfshWeb.Image, ""); err != nil {
+		if err := docker.EnsureInstalled(bblfshWeb.ImageName(), bblfshWeb.Tag()); err != nil {
 			return err
 		}
 
-		logrus.Infof("starting bblfshd web")
+		componentLogger(bblfshWeb.Name).Info("starting")
 
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
 
 		config := &container.Config{
-			Image: bblfshWeb.Image,
+			Image: bblfshWeb.Ref(),
 			Cmd:   []string{fmt.Sprintf("-bblfsh-addr=%s:%d", bblfshd.Name, bblfshParsePort)},
 		}
 		host := &container.HostConfig{
@@ -49,21 +48,28 @@ func createBblfshWeb(opts ...docker.ConfigOption) docker.StartFunc {
 	}
 }
 
-func createGitbaseWeb(opts ...docker.ConfigOption) docker.StartFunc {
+// createGitbaseWeb returns the function creating gitbase-web, connecting to
+// gitbase with the given credentials.
+func createGitbaseWeb(user, password string, opts ...docker.ConfigOption) docker.StartFunc {
 	return func() error {
-		if err := docker.EnsureInstalled(gitbaseWeb.Image, ""); err != nil {
+		if err := docker.EnsureInstalled(gitbaseWeb.ImageName(), gitbaseWeb.Tag()); err != nil {
 			return err
 		}
 
-		logrus.Infof("starting gitbase web")
+		componentLogger(gitbaseWeb.Name).Info("starting")
 
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
 
+		creds := user
+		if password != "" {
+			creds += ":" + password
+		}
+
 		config := &container.Config{
-			Image: gitbaseWeb.Image,
+			Image: gitbaseWeb.Ref(),
 			Env: []string{
-				fmt.Sprintf("GITBASEPG_DB_CONNECTION=root@tcp(%s)/none?maxAllowedPacket=4194304", gitbase.Name),
+				fmt.Sprintf("GITBASEPG_DB_CONNECTION=%s@tcp(%s)/none?maxAllowedPacket=4194304", creds, gitbase.Name),
 				fmt.Sprintf("GITBASEPG_BBLFSH_SERVER_URL=%s:%d", bblfshd.Name, bblfshParsePort),
 				fmt.Sprintf("GITBASEPG_PORT=%d", gitbaseWebPrivatePort),
 				fmt.Sprintf("GITBASEPG_SELECT_LIMIT=%d", gitbaseWebSelectLimit),
@@ -75,3 +81,41 @@ func createGitbaseWeb(opts ...docker.ConfigOption) docker.StartFunc {
 		return docker.Start(ctx, config, host, gitbaseWeb.Name)
 	}
 }
+
+// createWebProxy returns the function creating the proxy serving the web
+// client, published as given, with the same labels so it's created again
+// along with it.
+func createWebProxy(c components.Component, private int, web webOptions) docker.StartFunc {
+	return func() error {
+		proxy := components.WebProxy
+		if err := docker.EnsureInstalled(proxy.ImageName(), proxy.Tag()); err != nil {
+			return err
+		}
+
+		name := components.WebProxyName(c.Name)
+		componentLogger(name).Info("starting")
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		config := &container.Config{
+			Image: proxy.Ref(),
+			Cmd:   components.WebProxyCmd,
+			Env: []string{
+				components.WebTLSCertEnv + "=" + web.cert,
+				components.WebTLSKeyEnv + "=" + web.key,
+				components.WebProxyConfigEnv + "=" + components.WebProxyConfig(fmt.Sprintf("%s:%d", c.Name, private), web.cert != "", web.token),
+			},
+		}
+		host := &container.HostConfig{}
+
+		bind := web.bind
+		if bind == "" {
+			bind = components.WebDefaultBind
+		}
+		opts := append(web.options(private), docker.WithHostPort(bind, web.port, components.WebProxyPort))
+		docker.ApplyOptions(config, host, opts...)
+
+		return docker.Start(ctx, config, host, name)
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/src-d/engine/cmd/srcd-server/engine"
+	grpc "google.golang.org/grpc"
+)
+
+// logUnaryInterceptor gives the calls a logger with their request ID, and
+// logs them when they finish.
+func logUnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, log := engine.WithRequestLogger(ctx, info.FullMethod)
+	start := time.Now()
+	res, err := handler(ctx, req)
+	logCall(log, start, err)
+	return res, err
+}
+
+// logStreamInterceptor gives the streams a logger with their request ID, and
+// logs them when they are closed.
+func logStreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, log := engine.WithRequestLogger(ss.Context(), info.FullMethod)
+	start := time.Now()
+	err := handler(srv, &loggedStream{ss, ctx})
+	logCall(log, start, err)
+	return err
+}
+
+// loggedStream is a stream whose context has the logger of the call.
+type loggedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *loggedStream) Context() context.Context { return s.ctx }
+
+func logCall(log *logrus.Entry, start time.Time, err error) {
+	log = log.WithField("duration", time.Since(start).String())
+	if err != nil {
+		log.WithError(err).Error("call failed")
+		return
+	}
+	log.Debug("call finished")
+}
@@ -1,23 +1,81 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"net"
+	"os"
+	"os/signal"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
+	units "github.com/docker/go-units"
 	flags "github.com/jessevdk/go-flags"
 	"github.com/sirupsen/logrus"
 	api "github.com/src-d/engine/api"
 	"github.com/src-d/engine/cmd/srcd-server/engine"
+	"github.com/src-d/engine/components"
+	"github.com/src-d/engine/docker"
 	grpc "google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 )
 
 var version = "undefined"
 
 func main() {
 	var options struct {
-		Addr    string `long:"address" short:"a" default:"0.0.0.0:4242"`
-		Workdir string `long:"workdir" short:"w" default:""`
-		Data    string `long:"data" short:"d" default:""`
+		Addr             string        `long:"address" short:"a" default:"0.0.0.0:4242"`
+		Socket           string        `long:"socket" default:"" description:"unix socket to serve on instead of the address"`
+		SocketOwner      string        `long:"socket-owner" default:"" description:"uid:gid of the owner of the socket"`
+		Token            string        `long:"token" env:"SRCD_DAEMON_TOKEN" description:"bearer token the calls must have"`
+		TLSCert          string        `long:"tls-cert" env:"SRCD_DAEMON_TLS_CERT" description:"TLS certificate in PEM to serve with"`
+		TLSKey           string        `long:"tls-key" env:"SRCD_DAEMON_TLS_KEY" description:"key of the TLS certificate in PEM"`
+		Workdir          string        `long:"workdir" short:"w" default:""`
+		Data             string        `long:"data" short:"d" default:""`
+		BblfshMemory     string        `long:"bblfsh-memory" default:"" description:"memory limit of bblfshd, e.g. 2g"`
+		BblfshMaxDrivers int           `long:"bblfsh-max-drivers" default:"0" description:"maximum number of instances of every driver"`
+		Repos            []string      `long:"repos" description:"more directories with repositories to mount in gitbase"`
+		Format           string        `long:"format" default:"git" description:"format of the repositories read by gitbase: git or siva"`
+		GitbaseSquash    bool          `long:"gitbase-squash" description:"enable the squashed tables of gitbase"`
+		GitbaseCacheSize string        `long:"gitbase-cache-size" default:"" description:"size of the cache of git objects of gitbase, e.g. 512m, the default of gitbase if empty"`
+		GitbaseMaxMemory string        `long:"gitbase-max-memory" default:"" description:"memory the joins of gitbase can use, e.g. 2g, the default of gitbase if empty"`
+		GitbaseTimeout   time.Duration `long:"gitbase-conn-timeout" default:"0" description:"how long the connections to gitbase can be idle, the default of gitbase if 0"`
+		GitbaseQueryTime time.Duration `long:"gitbase-query-timeout" default:"0" description:"how long every query to gitbase can run, the default of gitbase if 0"`
+		GitbaseMaxConns  int           `long:"gitbase-max-connections" default:"0" description:"maximum number of connections to gitbase open at once, the default of gitbase if 0"`
+		GitbaseParallel  int           `long:"gitbase-parallelism" default:"0" description:"number of repositories gitbase reads at once, the default of gitbase if 0"`
+		GitbaseUser      string        `long:"gitbase-user" default:"" description:"user the clients of gitbase connect with, root if empty"`
+		GitbasePassword  string        `long:"gitbase-password" env:"SRCD_GITBASE_PASSWORD" default:"" description:"password of the user of gitbase, none if empty"`
+		GitbaseLogLevel  string        `long:"gitbase-log-level" default:"" description:"level of the logs of gitbase: error, warn, info, debug or trace, the default of gitbase if empty"`
+		GitbaseMetrics   bool          `long:"gitbase-metrics" description:"enable the metrics of gitbase, published on the loopback of the host"`
+		WritableWorkdir  bool          `long:"writable-workdir" description:"mount the working directory writable in gitbase instead of read-only"`
+		WorkdirVolume    string        `long:"workdir-volume" description:"docker volume with a copy of the working directory to mount in gitbase instead of it"`
+		Hide             []string      `long:"hide" description:"paths of the host hidden from gitbase inside the directories with repositories"`
+		PilosaPort       int           `long:"pilosa-port" default:"10101" description:"port pilosa is served on, in its container and in the host if it's exposed"`
+		PilosaExpose     string        `long:"expose-pilosa" default:"" description:"address of the host pilosa is published on, like 127.0.0.1, not published if empty"`
+		PilosaMemory     string        `long:"pilosa-memory" default:"" description:"memory limit of pilosa, e.g. 2g"`
+		PilosaCacheSize  string        `long:"pilosa-cache-size" default:"" description:"size of the caches of pilosa, e.g. 512m"`
+		Components       []string      `long:"components" description:"components that can be started, all of them if none is given"`
+		Images           []string      `long:"image" description:"images replacing the default ones of the components, like srcd-cli-gitbase=srcd/gitbase:dev"`
+		VolumesDir       string        `long:"volumes-dir" default:"" description:"directory of the host where the docker volumes are kept"`
+		LogLevel         string        `long:"log-level" env:"SRCD_LOG_LEVEL" default:"info" description:"level of the logs: debug, info, warning or error"`
+		LogFormat        string        `long:"log-format" env:"SRCD_LOG_FORMAT" default:"text" description:"format of the logs: text or json"`
+		MetricsAddr      string        `long:"metrics-address" default:"" description:"address to serve the metrics on /metrics, disabled if empty"`
+		HealthInterval   time.Duration `long:"health-interval" env:"SRCD_HEALTH_INTERVAL" default:"15s" description:"how often the components are probed for the health checks"`
+		HealthTimeout    time.Duration `long:"health-timeout" env:"SRCD_HEALTH_TIMEOUT" default:"5s" description:"how long every probe of the health checks can take"`
+		ParseConcurrency int           `long:"parse-concurrency" env:"SRCD_PARSE_CONCURRENCY" default:"0" description:"maximum number of files parsed at once, the maximum number of drivers of bblfshd if 0"`
+		ParseQueue       int           `long:"parse-queue" env:"SRCD_PARSE_QUEUE" default:"128" description:"maximum number of parse requests waiting for a slot"`
+		ParseQueueTime   time.Duration `long:"parse-queue-timeout" env:"SRCD_PARSE_QUEUE_TIMEOUT" default:"30s" description:"how long a parse request can wait for a slot"`
+		OpRetention      time.Duration `long:"operation-retention" env:"SRCD_OPERATION_RETENTION" default:"1h" description:"how long the operations finished are kept"`
+		Environment      string        `long:"environment" env:"SRCD_ENVIRONMENT" default:"" description:"name of the environment of the components, empty for the default one"`
+		DrainTimeout     time.Duration `long:"drain-timeout" env:"SRCD_DRAIN_TIMEOUT" default:"20s" description:"how long the calls in flight are given to finish on SIGTERM or SIGINT"`
+		RequireNative    bool          `long:"require-native" env:"SRCD_REQUIRE_NATIVE" description:"fail to pull and run the images without a variant for the platform of docker instead of using the ones for amd64"`
+		Platform         string        `long:"platform" env:"SRCD_PLATFORM" description:"platforms to pull and run the images for instead of the one of docker, like linux/amd64 or bblfshd=linux/amd64, separated by commas"`
+		HTTPProxy        string        `long:"http-proxy" env:"SRCD_HTTP_PROXY" description:"proxy of the requests to Docker Hub and GitHub"`
+		CACerts          string        `long:"ca-certs" env:"SRCD_CA_CERTS" description:"certificates in PEM of the CAs to trust along with the ones of the system"`
+		RegistryMirror   string        `long:"registry-mirror" env:"SRCD_REGISTRY_MIRROR" description:"registry with the path the images of Docker Hub are mirrored under, like registry.corp/dockerhub"`
+		RegistryAuth     string        `long:"registry-auth" env:"SRCD_REGISTRY_AUTH" description:"encoded credentials of the registry mirror, as the API of docker takes them"`
 	}
 
 	_, err := flags.Parse(&options)
@@ -25,6 +83,22 @@ func main() {
 		logrus.Fatal(err)
 	}
 
+	level, err := logrus.ParseLevel(options.LogLevel)
+	if err != nil {
+		logrus.Fatalf("invalid log level: %v", err)
+	}
+	logrus.SetLevel(level)
+
+	switch options.LogFormat {
+	case "text":
+		logrus.SetFormatter(&logrus.TextFormatter{FullTimestamp: true})
+	case "json":
+		logrus.SetFormatter(&logrus.JSONFormatter{})
+	default:
+		logrus.Fatalf("invalid log format %q, it must be text or json", options.LogFormat)
+	}
+	logPreviousRun()
+
 	workdir := strings.TrimSpace(options.Workdir)
 	if workdir == "" {
 		logrus.Fatal("No work directory provided!")
@@ -35,16 +109,241 @@ func main() {
 		logrus.Fatal("No data directory provided!")
 	}
 
-	l, err := net.Listen("tcp", options.Addr)
+	if options.HealthInterval < engine.MinProbeInterval {
+		logrus.Fatalf("invalid health interval %s, it must be at least %s", options.HealthInterval, engine.MinProbeInterval)
+	}
+
+	if options.HealthTimeout <= 0 {
+		logrus.Fatalf("invalid health timeout %s, it must be positive", options.HealthTimeout)
+	}
+
+	if options.OpRetention <= 0 {
+		logrus.Fatalf("invalid operation retention %s, it must be positive", options.OpRetention)
+	}
+
+	if options.DrainTimeout <= 0 {
+		logrus.Fatalf("invalid drain timeout %s, it must be positive", options.DrainTimeout)
+	}
+
+	docker.RequireNative = options.RequireNative
+	if err := docker.ConfigureHTTP(options.HTTPProxy, []byte(options.CACerts)); err != nil {
+		logrus.Fatal(err)
+	}
+	if err := docker.ConfigureMirror(options.RegistryMirror, options.RegistryAuth); err != nil {
+		logrus.Fatal(err)
+	}
+
+	// The components must be renamed before their images are replaced, as
+	// they are by name.
+	if err := components.SetEnvironment(options.Environment); err != nil {
+		logrus.Fatal(err)
+	}
+
+	images := make(map[string]string)
+	for _, image := range options.Images {
+		parts := strings.SplitN(image, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			logrus.Fatalf("invalid image %q, it must be like name=reference", image)
+		}
+		images[parts[0]] = parts[1]
+	}
+	components.SetOverrides(images)
+
+	platforms, err := components.ParsePlatforms(strings.Split(options.Platform, ","))
+	if err != nil {
+		logrus.Fatalf("invalid platform: %v", err)
+	}
+	components.SetPlatforms(platforms)
+
+	opts := engine.Options{
+		BblfshMaxDrivers: options.BblfshMaxDrivers,
+		Repos:            options.Repos,
+		Hidden:           options.Hide,
+		WritableWorkdir:  options.WritableWorkdir,
+		WorkdirVolume:    strings.TrimSpace(options.WorkdirVolume),
+		GitbaseUser:      options.GitbaseUser,
+		GitbasePassword:  options.GitbasePassword,
+		Format:           options.Format,
+		Gitbase: components.GitbaseSettings{
+			Squash:         options.GitbaseSquash,
+			ConnTimeout:    options.GitbaseTimeout,
+			QueryTimeout:   options.GitbaseQueryTime,
+			MaxConnections: options.GitbaseMaxConns,
+			Parallelism:    options.GitbaseParallel,
+			Metrics:        options.GitbaseMetrics,
+			LogLevel:       options.GitbaseLogLevel,
+		},
+		PilosaPort:   options.PilosaPort,
+		PilosaExpose: options.PilosaExpose,
+		Components:   options.Components,
+		VolumesDir:   strings.TrimSpace(options.VolumesDir),
+		ParseLimits: engine.ParseLimits{
+			Concurrency:  options.ParseConcurrency,
+			Queue:        options.ParseQueue,
+			QueueTimeout: options.ParseQueueTime,
+		},
+		OperationRetention: options.OpRetention,
+		Environment:        options.Environment,
+	}
+	if options.BblfshMemory != "" {
+		opts.BblfshMemory, err = units.RAMInBytes(options.BblfshMemory)
+		if err != nil {
+			logrus.Fatalf("invalid bblfsh memory limit: %v", err)
+		}
+	}
+	if options.PilosaMemory != "" {
+		opts.PilosaMemory, err = units.RAMInBytes(options.PilosaMemory)
+		if err != nil {
+			logrus.Fatalf("invalid pilosa memory limit: %v", err)
+		}
+	}
+	if options.PilosaCacheSize != "" {
+		opts.PilosaCacheSize, err = units.RAMInBytes(options.PilosaCacheSize)
+		if err != nil {
+			logrus.Fatalf("invalid pilosa cache size: %v", err)
+		}
+	}
+	if options.GitbaseCacheSize != "" {
+		opts.Gitbase.CacheSize, err = units.RAMInBytes(options.GitbaseCacheSize)
+		if err != nil {
+			logrus.Fatalf("invalid gitbase cache size: %v", err)
+		}
+	}
+	if options.GitbaseMaxMemory != "" {
+		opts.Gitbase.MaxMemory, err = units.RAMInBytes(options.GitbaseMaxMemory)
+		if err != nil {
+			logrus.Fatalf("invalid gitbase max memory: %v", err)
+		}
+	}
+
+	l, addr, err := listen(options.Addr, options.Socket, options.SocketOwner)
 	if err != nil {
 		logrus.Fatal(err)
 	}
 
-	srv := grpc.NewServer()
-	api.RegisterEngineServer(srv, engine.NewServer(version, workdir, datadir))
+	sd := newShutdown(options.DrainTimeout)
+	serverOpts, err := serverOptions(options.Token, options.TLSCert, options.TLSKey, options.MetricsAddr != "", sd)
+	if err != nil {
+		logrus.Fatalf("invalid TLS certificate: %v", err)
+	}
+
+	if options.MetricsAddr != "" {
+		if err := serveMetrics(options.MetricsAddr); err != nil {
+			logrus.Fatalf("could not serve the metrics: %v", err)
+		}
+	}
+
+	srv := grpc.NewServer(serverOpts...)
+	server := engine.NewServer(version, workdir, datadir, opts)
+	api.RegisterEngineServer(srv, server)
+	healthpb.RegisterHealthServer(srv, server.Health(context.Background(), engine.ProbeOptions{
+		Interval: options.HealthInterval,
+		Timeout:  options.HealthTimeout,
+	}))
+	go server.WatchCrashes(context.Background())
+
+	logrus.WithFields(logrus.Fields{
+		"address": addr,
+		"token":   options.Token != "",
+		"tls":     options.TLSCert != "",
+		"version": version,
+	}).Info("listening")
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	served := make(chan error, 1)
+	go func() { served <- srv.Serve(l) }()
 
-	logrus.Infof("listening on %s", options.Addr)
-	if err := srv.Serve(l); err != nil {
+	select {
+	case err := <-served:
 		logrus.Fatal(err)
+	case sig := <-signals:
+		logrus.Infof("received %s, draining the calls in flight for up to %s", sig, options.DrainTimeout)
+	}
+
+	if !sd.stop(srv) {
+		logrus.Warn("the calls still running at the end of the drain window were cancelled")
+	}
+
+	if err := server.Close(); err != nil {
+		logrus.Warnf("could not close the connections to the components: %v", err)
+	}
+	logrus.Info("shut down")
+}
+
+// logPreviousRun logs why the daemon was stopped before, if it was started
+// again in the same container: by docker, after exiting with an error, or by
+// the CLI. Docker resets the exit code of the container when it starts it,
+// so the CLI logs it when it's the one starting it.
+func logPreviousRun() {
+	// The hostname of a container is its short ID.
+	id, err := os.Hostname()
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	info, err := docker.Inspect(ctx, id)
+	if err != nil {
+		logrus.Debugf("could not inspect the container of the daemon: %v", err)
+		return
+	}
+
+	finished, err := time.Parse(time.RFC3339Nano, info.State.FinishedAt)
+	if err != nil || finished.IsZero() {
+		return
+	}
+
+	if info.RestartCount > 0 {
+		logrus.Warnf("restarted by docker %d times, the last run exited with an error at %s",
+			info.RestartCount, finished.Format(time.RFC3339))
+		return
+	}
+	logrus.Infof("started again, the last run stopped at %s", finished.Format(time.RFC3339))
+}
+
+// listen listens on the unix socket, if it's given, or on the TCP address
+// otherwise. The socket can only be used by its owner, given as uid:gid, as
+// the daemon runs as root.
+func listen(addr, socket, owner string) (net.Listener, string, error) {
+	if socket == "" {
+		l, err := net.Listen("tcp", addr)
+		return l, addr, err
+	}
+
+	if err := os.Remove(socket); err != nil && !os.IsNotExist(err) {
+		return nil, "", fmt.Errorf("could not remove the old socket: %v", err)
+	}
+
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if err := os.Chmod(socket, 0600); err != nil {
+		l.Close()
+		return nil, "", fmt.Errorf("could not restrict the permissions of the socket: %v", err)
+	}
+
+	if owner != "" {
+		parts := strings.SplitN(owner, ":", 2)
+		uid, err := strconv.Atoi(parts[0])
+		gid := -1
+		if err == nil && len(parts) == 2 {
+			gid, err = strconv.Atoi(parts[1])
+		}
+
+		if err != nil {
+			l.Close()
+			return nil, "", fmt.Errorf("invalid owner of the socket %q, it must be like uid:gid", owner)
+		}
+
+		if err := os.Chown(socket, uid, gid); err != nil {
+			l.Close()
+			return nil, "", fmt.Errorf("could not change the owner of the socket: %v", err)
+		}
 	}
+	return l, "unix://" + socket, nil
 }
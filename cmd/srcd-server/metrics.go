@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/src-d/engine/cmd/srcd-server/engine"
+	"github.com/src-d/engine/cmd/srcd-server/metrics"
+	grpc "google.golang.org/grpc"
+)
+
+var (
+	rpcCalls = metrics.NewCounter("srcd_rpc_calls_total",
+		"Calls to the daemon by method and status.", "method", "status")
+	rpcDuration = metrics.NewHistogram("srcd_rpc_duration_seconds",
+		"How long the calls to the daemon took by method.", metrics.DefaultBuckets, "method")
+)
+
+// serveMetrics serves the metrics on /metrics of the given address, and
+// starts collecting the ones not recorded by the calls.
+func serveMetrics(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	engine.ObservePulls()
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	go func() {
+		if err := http.Serve(l, mux); err != nil {
+			logrus.Errorf("could not serve the metrics: %v", err)
+		}
+	}()
+
+	logrus.Infof("serving the metrics on http://%s/metrics", addr)
+	return nil
+}
+
+// observeCall records the call to the method in the metrics.
+func observeCall(method string, start time.Time, err error) {
+	rpcCalls.Inc(method, engine.StatusLabel(err))
+	rpcDuration.Observe(time.Since(start).Seconds(), method)
+}
+
+// metricsUnaryInterceptor records the calls in the metrics.
+func metricsUnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	res, err := handler(ctx, req)
+	observeCall(info.FullMethod, start, err)
+	return res, err
+}
+
+// metricsStreamInterceptor records the streams in the metrics, once they are
+// closed.
+func metricsStreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+	err := handler(srv, ss)
+	observeCall(info.FullMethod, start, err)
+	return err
+}
@@ -0,0 +1,285 @@
+// Package metrics keeps the metrics of the daemon and exports them in the
+// text format of Prometheus.
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are the upper bounds, in seconds, of the buckets of the
+// histograms of durations of the calls.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60}
+
+// metric is a family of metrics with the same name, one for every
+// combination of the values of its labels.
+type metric interface {
+	write(w io.Writer) error
+}
+
+var (
+	mu      sync.Mutex
+	metrics []metric
+)
+
+func register(m metric) {
+	mu.Lock()
+	defer mu.Unlock()
+	metrics = append(metrics, m)
+}
+
+// family has what all the types of metrics have in common.
+type family struct {
+	name   string
+	help   string
+	typ    string
+	labels []string
+}
+
+func (f *family) header(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.name, escapeHelp(f.help), f.name, f.typ)
+	return err
+}
+
+// key joins the values of the labels to index the series of the family.
+func (f *family) key(values []string) string {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("metric %s has %d labels, got %d values", f.name, len(f.labels), len(values)))
+	}
+	return strings.Join(values, "\xff")
+}
+
+// series returns the labels of a series, like {method="Parse"}, with the
+// given extra label, if not empty.
+func (f *family) series(key string, extra ...string) string {
+	var pairs []string
+	if len(f.labels) > 0 {
+		for i, v := range strings.Split(key, "\xff") {
+			pairs = append(pairs, fmt.Sprintf(`%s="%s"`, f.labels[i], escapeValue(v)))
+		}
+	}
+
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, extra[i], extra[i+1]))
+	}
+
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// Counter is a value that only goes up, like the number of calls, by labels.
+type Counter struct {
+	family
+	sync.Mutex
+	values map[string]float64
+}
+
+// NewCounter registers a counter with the given labels.
+func NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{family: family{name, help, "counter", labels}, values: make(map[string]float64)}
+	register(c)
+	return c
+}
+
+// Inc adds one to the counter with the given values of the labels.
+func (c *Counter) Inc(values ...string) {
+	k := c.key(values)
+	c.Lock()
+	c.values[k]++
+	c.Unlock()
+}
+
+func (c *Counter) write(w io.Writer) error {
+	c.Lock()
+	defer c.Unlock()
+	return writeValues(w, &c.family, c.values)
+}
+
+// Gauge is a value that can go up and down, like whether a component is
+// healthy, by labels.
+type Gauge struct {
+	family
+	sync.Mutex
+	values map[string]float64
+}
+
+// NewGauge registers a gauge with the given labels.
+func NewGauge(name, help string, labels ...string) *Gauge {
+	g := &Gauge{family: family{name, help, "gauge", labels}, values: make(map[string]float64)}
+	register(g)
+	return g
+}
+
+// Set sets the gauge with the given values of the labels.
+func (g *Gauge) Set(v float64, values ...string) {
+	k := g.key(values)
+	g.Lock()
+	g.values[k] = v
+	g.Unlock()
+}
+
+func (g *Gauge) write(w io.Writer) error {
+	g.Lock()
+	defer g.Unlock()
+	return writeValues(w, &g.family, g.values)
+}
+
+func writeValues(w io.Writer, f *family, values map[string]float64) error {
+	if err := f.header(w); err != nil {
+		return err
+	}
+
+	for _, k := range sortedKeys(values) {
+		if _, err := fmt.Fprintf(w, "%s%s %s\n", f.name, f.series(k), formatValue(values[k])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Histogram counts the values observed, like durations, in buckets, by
+// labels.
+type Histogram struct {
+	family
+	sync.Mutex
+	buckets []float64
+	values  map[string]*histogramValues
+}
+
+type histogramValues struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// NewHistogram registers a histogram with the given upper bounds of its
+// buckets, sorted, and labels.
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	h := &Histogram{
+		family:  family{name, help, "histogram", labels},
+		buckets: buckets,
+		values:  make(map[string]*histogramValues),
+	}
+	register(h)
+	return h
+}
+
+// Observe adds the value to the histogram with the given values of the
+// labels.
+func (h *Histogram) Observe(v float64, values ...string) {
+	k := h.key(values)
+	h.Lock()
+	defer h.Unlock()
+
+	hv, ok := h.values[k]
+	if !ok {
+		hv = &histogramValues{counts: make([]uint64, len(h.buckets))}
+		h.values[k] = hv
+	}
+
+	for i, b := range h.buckets {
+		if v <= b {
+			hv.counts[i]++
+		}
+	}
+	hv.count++
+	hv.sum += v
+}
+
+func (h *Histogram) write(w io.Writer) error {
+	h.Lock()
+	defer h.Unlock()
+
+	if err := h.header(w); err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(h.values))
+	for k := range h.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		hv := h.values[k]
+		for i, b := range h.buckets {
+			if _, err := fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.series(k, "le", formatValue(b)), hv.counts[i]); err != nil {
+				return err
+			}
+		}
+
+		_, err := fmt.Fprintf(w, "%s_bucket%s %d\n%s_sum%s %s\n%s_count%s %d\n",
+			h.name, h.series(k, "le", "+Inf"), hv.count,
+			h.name, h.series(k), formatValue(hv.sum),
+			h.name, h.series(k), hv.count)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Write writes all the metrics registered in the text format of Prometheus.
+func Write(w io.Writer) error {
+	mu.Lock()
+	ms := append([]metric(nil), metrics...)
+	mu.Unlock()
+
+	for _, m := range ms {
+		if err := m.write(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Handler serves the metrics registered to be scraped by Prometheus.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var buf bytes.Buffer
+		if err := Write(&buf); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		buf.WriteTo(w)
+	})
+}
+
+func sortedKeys(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	valueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
+func escapeValue(s string) string { return valueEscaper.Replace(s) }
@@ -0,0 +1,65 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWrite(t *testing.T) {
+	metrics = nil
+
+	c := NewCounter("test_calls_total", "Calls by method.", "method")
+	c.Inc("Parse")
+	c.Inc("Parse")
+	c.Inc(`quote"d`)
+
+	g := NewGauge("test_healthy", "Whether it's healthy.")
+	g.Set(1)
+
+	h := NewHistogram("test_duration_seconds", "How long it took.", []float64{.1, 1}, "method")
+	h.Observe(.05, "SQL")
+	h.Observe(.5, "SQL")
+	h.Observe(2, "SQL")
+
+	var buf bytes.Buffer
+	if err := Write(&buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := `# HELP test_calls_total Calls by method.
+# TYPE test_calls_total counter
+test_calls_total{method="Parse"} 2
+test_calls_total{method="quote\"d"} 1
+# HELP test_healthy Whether it's healthy.
+# TYPE test_healthy gauge
+test_healthy 1
+# HELP test_duration_seconds How long it took.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{method="SQL",le="0.1"} 1
+test_duration_seconds_bucket{method="SQL",le="1"} 2
+test_duration_seconds_bucket{method="SQL",le="+Inf"} 3
+test_duration_seconds_sum{method="SQL"} 2.55
+test_duration_seconds_count{method="SQL"} 3
+`
+	if got := buf.String(); got != expected {
+		t.Errorf("expected: %s, got: %s", expected, got)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	metrics = nil
+	NewCounter("test_total", "Test.").Inc()
+
+	w := httptest.NewRecorder()
+	Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("expected: the text format, got: %s", ct)
+	}
+
+	if !strings.Contains(w.Body.String(), "test_total 1\n") {
+		t.Errorf("expected: test_total 1, got: %s", w.Body.String())
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	grpc "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// shutdownGrace is how long the calls cancelled at the end of the drain
+// window are given to return before the connections are closed.
+const shutdownGrace = 2 * time.Second
+
+// shutdown stops the server gracefully, giving the calls in flight the drain
+// window to finish, and cancelling the ones that don't.
+type shutdown struct {
+	drain time.Duration
+	// ctx is cancelled when the drain window is over.
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func newShutdown(drain time.Duration) *shutdown {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &shutdown{drain: drain, ctx: ctx, cancel: cancel}
+}
+
+// stop stops accepting calls, and waits for the ones in flight for the drain
+// window. It returns whether all of them finished in it.
+func (s *shutdown) stop(srv *grpc.Server) bool {
+	stopped := make(chan struct{})
+	go func() {
+		srv.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		return true
+	case <-time.After(s.drain):
+	}
+
+	s.cancel()
+	select {
+	case <-stopped:
+	case <-time.After(shutdownGrace):
+		srv.Stop()
+	}
+	return false
+}
+
+// wrap returns the context of a call, cancelled at the end of the drain
+// window, and the function that returns its error, the one of the shutdown
+// if it was cancelled by it.
+func (s *shutdown) wrap(ctx context.Context) (context.Context, func(error) error) {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-s.ctx.Done():
+			cancel()
+		case <-done:
+		}
+	}()
+
+	return ctx, func(err error) error {
+		close(done)
+		cancelled := ctx.Err() != nil && s.ctx.Err() != nil
+		cancel()
+		if cancelled {
+			return status.Errorf(codes.Unavailable,
+				"the daemon is shutting down, the call did not finish in the drain window of %s", s.drain)
+		}
+		return err
+	}
+}
+
+// unaryInterceptor cancels the calls still running at the end of the drain
+// window.
+func (s *shutdown) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, finish := s.wrap(ctx)
+	res, err := handler(ctx, req)
+	if err = finish(err); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// streamInterceptor cancels the streams still open at the end of the drain
+// window.
+func (s *shutdown) streamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, finish := s.wrap(ss.Context())
+	return finish(handler(srv, &loggedStream{ss, ctx}))
+}
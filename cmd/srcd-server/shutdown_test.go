@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	grpc "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestShutdownUnaryInterceptor(t *testing.T) {
+	testCases := []struct {
+		name     string
+		handler  grpc.UnaryHandler
+		expected codes.Code
+	}{
+		{
+			"finished",
+			func(ctx context.Context, req interface{}) (interface{}, error) { return "ok", nil },
+			codes.OK,
+		},
+		{
+			"failed",
+			func(ctx context.Context, req interface{}) (interface{}, error) {
+				return nil, status.Errorf(codes.NotFound, "not found")
+			},
+			codes.NotFound,
+		},
+		{
+			"cancelled",
+			func(ctx context.Context, req interface{}) (interface{}, error) {
+				<-ctx.Done()
+				return nil, fmt.Errorf("could not parse: %v", ctx.Err())
+			},
+			codes.Unavailable,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			sd := newShutdown(time.Second)
+			time.AfterFunc(10*time.Millisecond, sd.cancel)
+
+			_, err := sd.unaryInterceptor(context.Background(), nil, &grpc.UnaryServerInfo{}, tc.handler)
+			if got := status.Code(err); got != tc.expected {
+				t.Errorf("expected: %s, got: %s", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestShutdownCallerCancelled(t *testing.T) {
+	sd := newShutdown(time.Second)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := sd.unaryInterceptor(ctx, nil, &grpc.UnaryServerInfo{},
+		func(ctx context.Context, req interface{}) (interface{}, error) { return nil, ctx.Err() })
+	if err != context.Canceled {
+		t.Errorf("expected: %v, got: %v", context.Canceled, err)
+	}
+}
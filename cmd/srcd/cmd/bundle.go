@@ -0,0 +1,291 @@
+package cmd
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/src-d/engine/api"
+	"github.com/src-d/engine/cmd/srcd/daemon"
+	"github.com/src-d/engine/components"
+	"github.com/src-d/engine/docker"
+)
+
+// imageBundleTimeout is how long creating or installing a bundle of the
+// images can take.
+const imageBundleTimeout = time.Hour
+
+// bundleDriversDir is the directory of the container of bblfshd the drivers
+// of a bundle are copied to, to be installed from there.
+const bundleDriversDir = "/tmp"
+
+// driverLanguageRegexp matches the languages of the drivers.
+var driverLanguageRegexp = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+var bundleCmd = &cobra.Command{
+	Use:   "bundle",
+	Short: "Package the engine to install it on machines without network",
+}
+
+var bundleCreateCmd = &cobra.Command{
+	Use:   "create <file>",
+	Short: "Write a bundle with the images of the engine and drivers",
+	Long: `Write a bundle with the images of the engine and drivers
+
+The images of the daemon and all the components, at the versions and with the
+images the engine uses, and the ones of the drivers of bblfshd given with
+--drivers, like python or go:v2.5.1, at their pinned versions if none is
+given, are pulled if they are not installed and written to a tarball, along
+with a manifest with their digests and the version of the engine.
+
+Install it with srcd bundle install on a machine with the same version of the
+engine, which doesn't need any network then.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		values, _ := cmd.Flags().GetStringSlice("drivers")
+		drivers, err := bundleDrivers(values, driverPins())
+		if err != nil {
+			return err
+		}
+
+		output := args[0]
+		if force, _ := cmd.Flags().GetBool("force"); !force {
+			if _, err := os.Stat(output); err == nil {
+				return usageErrorf("%s already exists; give --force to overwrite it", output)
+			}
+		}
+
+		m := components.NewBundleManifest(drivers)
+		refs := m.Refs()
+
+		ctx, cancel := context.WithTimeout(context.Background(), imageBundleTimeout)
+		defer cancel()
+
+		display := newPullDisplay(os.Stderr, decorated(os.Stderr) && !quiet, refs)
+		results, err := components.InstallAll(ctx, refs, display.progress)
+		display.stop()
+		if err != nil {
+			return err
+		}
+
+		for _, r := range results {
+			if r.Err != nil {
+				return operationFailed(fmt.Errorf("could not install %s: %v", r.Ref, r.Err))
+			}
+		}
+
+		// The bundle is written next to its final path and renamed once
+		// it's complete, so there's never a partial one there.
+		tmp := output + ".tmp"
+		f, err := os.Create(tmp)
+		if err != nil {
+			return fmt.Errorf("could not create the bundle: %v", err)
+		}
+		defer os.Remove(tmp)
+
+		err = components.WriteBundle(ctx, f, m, filepath.Dir(output), func(img *components.BundleImage) {
+			logrus.Infof("saving %s", img.Ref)
+		})
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return operationFailed(fmt.Errorf("could not write the bundle: %v", err))
+		}
+
+		if err := os.Rename(tmp, output); err != nil {
+			return fmt.Errorf("could not write the bundle: %v", err)
+		}
+
+		logrus.Infof("bundle of the engine %s with %d images and %d drivers written to %s",
+			m.EngineVersion, len(m.Images), len(m.Drivers), output)
+		return nil
+	},
+}
+
+var bundleInstallCmd = &cobra.Command{
+	Use:   "install <file>",
+	Short: "Install the images and drivers of a bundle",
+	Long: `Install the images and drivers of a bundle
+
+The bundle written by srcd bundle create is read whole first, checking it's
+complete and every image has the digest of its manifest, so nothing is
+loaded from a partial or corrupted bundle. Its images are then loaded into
+docker, and its drivers installed into the volume of bblfshd, which starts
+the daemon. srcd init runs then without any network.
+
+The bundle must have been created by the same version of the engine, as the
+images of the components depend on it.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, cancel := context.WithTimeout(context.Background(), imageBundleTimeout)
+		defer cancel()
+
+		installer := &bundleDriverInstaller{}
+		m, err := installBundle(ctx, args[0], func(img *components.BundleImage, r io.Reader) error {
+			return installer.install(ctx, img, r)
+		})
+		if err != nil {
+			return err
+		}
+
+		logrus.Infof("%d images and %d drivers installed, the engine is ready for srcd init",
+			len(m.Images), len(m.Drivers))
+		return nil
+	},
+}
+
+// installBundle verifies the bundle in the given file and loads its images,
+// calling driver with each one of its drivers.
+func installBundle(ctx context.Context, file string, driver func(img *components.BundleImage, r io.Reader) error) (*components.BundleManifest, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, usageErrorf("could not open the bundle: %v", err)
+	}
+	defer f.Close()
+
+	logrus.Infof("verifying %s", file)
+	m, err := components.VerifyBundle(f)
+	if err != nil {
+		return nil, operationFailed(err)
+	}
+
+	if m.EngineVersion != components.Daemon.Version {
+		return nil, usageErrorf("the bundle was created by the engine %s, not %s like this srcd; "+
+			"create it with this version", m.EngineVersion, components.Daemon.Version)
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("could not read the bundle: %v", err)
+	}
+
+	var i int
+	err = components.LoadBundle(ctx, f, m, func(img *components.BundleImage) {
+		i++
+		logrus.Infof("[%d/%d] loading %s", i, len(m.Images), img.Ref)
+	}, driver)
+	if err != nil {
+		return nil, operationFailed(err)
+	}
+	return m, nil
+}
+
+// bundleDrivers returns the drivers to add to a bundle given with --drivers,
+// like python or go:v2.5.1, at their pinned versions if none is given.
+func bundleDrivers(values []string, pins map[string]string) ([]components.BundleDriver, error) {
+	var drivers []components.BundleDriver
+	seen := make(map[string]bool)
+	for _, v := range values {
+		lang, version, err := parseDriverWithVersion(strings.TrimSpace(v))
+		if err != nil {
+			return nil, usageErrorf("invalid driver %q, it must be a language, like python, or a language and a version, like go:v2.5.1", v)
+		}
+
+		if !driverLanguageRegexp.MatchString(lang) {
+			return nil, usageErrorf("invalid language %q of --drivers", lang)
+		}
+
+		if seen[lang] {
+			continue
+		}
+		seen[lang] = true
+
+		if version, err = driverVersion(lang, version, pins, false); err != nil {
+			return nil, usageErrorf("%v", err)
+		}
+		drivers = append(drivers, components.BundleDriver{Language: lang, Version: version})
+	}
+	return drivers, nil
+}
+
+// bundleDriverInstaller installs the drivers of a bundle into bblfshd, with
+// the daemon started with the first one.
+type bundleDriverInstaller struct {
+	client    api.EngineClient
+	installed map[string]string
+}
+
+// install copies the tarball of the image of the driver into the container
+// of bblfshd and installs it from there, unless a driver of the language is
+// already installed.
+func (b *bundleDriverInstaller) install(ctx context.Context, img *components.BundleImage, r io.Reader) error {
+	if b.client == nil {
+		c, err := daemon.Client()
+		if err != nil {
+			return fmt.Errorf("could not get daemon client: %v", err)
+		}
+
+		// Starts bblfshd.
+		drivers, err := c.ListDrivers(ctx, &api.ListDriversRequest{})
+		if err != nil {
+			return fmt.Errorf("could not list drivers: %v", err)
+		}
+
+		b.client = c
+		b.installed = make(map[string]string)
+		for _, d := range drivers.Drivers {
+			b.installed[strings.ToLower(d.Lang)] = d.Version
+		}
+	}
+
+	if version, ok := b.installed[img.Language]; ok {
+		logrus.Infof("%s driver version %s is already installed", img.Language, version)
+		return nil
+	}
+
+	logrus.Infof("installing %s driver version %s", img.Language, img.Version)
+
+	name := "srcd-bundle-" + path.Base(img.File)
+	pr, pw := io.Pipe()
+	go func() {
+		tw := tar.NewWriter(pw)
+		err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: img.Size, Typeflag: tar.TypeReg})
+		if err == nil {
+			_, err = io.Copy(tw, r)
+		}
+		if err == nil {
+			err = tw.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+
+	err := docker.CopyToContainer(ctx, components.Bblfshd.Name, bundleDriversDir, pr)
+	pr.CloseWithError(err)
+	if err != nil {
+		return err
+	}
+
+	archive := path.Join(bundleDriversDir, name)
+	defer func() {
+		if err := docker.Exec(ctx, components.Bblfshd.Name, "rm", "-f", archive); err != nil {
+			logrus.Warnf("could not remove %s from bblfshd: %v", archive, err)
+		}
+	}()
+
+	_, err = b.client.InstallDriver(ctx, &api.VersionedDriver{
+		Language: img.Language,
+		Version:  img.Version,
+		Archive:  archive,
+	})
+	if err != nil {
+		return fmt.Errorf("could not install %s driver: %v", img.Language, err)
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(bundleCmd)
+	bundleCmd.AddCommand(bundleCreateCmd)
+	bundleCmd.AddCommand(bundleInstallCmd)
+	bundleCreateCmd.Flags().StringSlice("drivers", nil, "drivers of bblfshd to add, like python or go:v2.5.1, at their pinned versions if none is given")
+	bundleCreateCmd.Flags().Bool("force", false, "overwrite the bundle if it exists")
+}
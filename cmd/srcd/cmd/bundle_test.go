@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestBundleDrivers(t *testing.T) {
+	pins := map[string]string{"go": "v2.5.1"}
+	testCases := []struct {
+		name     string
+		values   []string
+		expected string
+		err      string
+	}{
+		{name: "none", expected: "[]"},
+		{name: "latest", values: []string{"python"}, expected: "[{python latest}]"},
+		{name: "pinned", values: []string{"Go", "python", "go"}, expected: "[{go v2.5.1} {python latest}]"},
+		{name: "version", values: []string{"python:v2.8.0"}, expected: "[{python v2.8.0}]"},
+		{name: "other than pinned", values: []string{"go:v2.6.0"},
+			err: "go driver is pinned to version v2.5.1, use --ignore-pins to use version v2.6.0"},
+		{name: "invalid", values: []string{"go:v2:v3"},
+			err: `invalid driver "go:v2:v3", it must be a language, like python, or a language and a version, like go:v2.5.1`},
+		{name: "invalid language", values: []string{"../go"}, err: `invalid language "../go" of --drivers`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			drivers, err := bundleDrivers(tc.values, pins)
+			var errMsg string
+			if err != nil {
+				errMsg = err.Error()
+			}
+			if errMsg != tc.err {
+				t.Fatalf("expected: %s, got: %s", tc.err, errMsg)
+			}
+
+			if result := fmt.Sprint(drivers); err == nil && result != tc.expected {
+				t.Errorf("expected: %s, got: %s", tc.expected, result)
+			}
+		})
+	}
+}
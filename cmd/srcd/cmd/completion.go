@@ -0,0 +1,407 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	api "github.com/src-d/engine/api"
+	"github.com/src-d/engine/cmd/srcd/daemon"
+	"github.com/src-d/engine/components"
+	"gopkg.in/bblfsh/sdk.v1/manifest/discovery"
+)
+
+// completionTimeout is how long the dynamic completions can take before
+// falling back to the static ones.
+const completionTimeout = 2 * time.Second
+
+// fallbackDriverLanguages are suggested for the drivers when the official
+// ones can't be listed.
+var fallbackDriverLanguages = []string{
+	"bash", "cpp", "csharp", "go", "java", "javascript", "php", "python", "ruby", "typescript",
+}
+
+// completionShells are the shells srcd completion generates scripts for.
+var completionShells = map[string]string{
+	"bash": bashCompletion,
+	"zsh":  zshCompletion,
+	"fish": fishCompletion,
+}
+
+var completionCmd = &cobra.Command{
+	Use:   "completion bash|zsh|fish",
+	Short: "Print the script completing the commands in the given shell",
+	Long: `Print the script completing the commands in the given shell
+
+Besides the commands and flags, the arguments are completed with what's there
+when <TAB> is pressed: the components running for srcd stop, the images
+installed for srcd components remove, or the languages with a driver for srcd
+parse drivers install. When docker or the daemon can't be reached, all the
+component names or the usual languages are suggested instead.
+
+To load it in the current shell:
+
+  source <(srcd completion bash)
+  source <(srcd completion zsh)
+  srcd completion fish | source
+
+Or add the line to ~/.bashrc, ~/.zshrc or ~/.config/fish/config.fish.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		script, ok := completionShells[args[0]]
+		if !ok {
+			return usageErrorf("unknown shell %s, it must be bash, zsh or fish", args[0])
+		}
+
+		fmt.Print(script)
+		return nil
+	},
+}
+
+const bashCompletion = `# bash completion for srcd
+_srcd() {
+    local cur="${COMP_WORDS[COMP_CWORD]}" out
+    if out=$(srcd __complete "${COMP_WORDS[@]:1:COMP_CWORD}" 2>/dev/null); then
+        local IFS=$'\n'
+        COMPREPLY=($out)
+    else
+        compopt -o filenames 2>/dev/null
+        COMPREPLY=($(compgen -f -- "$cur"))
+    fi
+}
+complete -F _srcd srcd
+`
+
+const zshCompletion = `#compdef srcd
+_srcd() {
+    local out
+    if out=$(srcd __complete "${(@)words[2,CURRENT]}" 2>/dev/null); then
+        [[ -n $out ]] && compadd -- "${(@f)out}"
+    else
+        _files
+    fi
+}
+if [[ "${funcstack[1]}" == "_srcd" ]]; then
+    _srcd "$@"
+else
+    compdef _srcd srcd
+fi
+`
+
+const fishCompletion = `# fish completion for srcd
+function __srcd_complete
+    set -l tokens (commandline -opc)
+    set -e tokens[1]
+    set -l cur (commandline -ct)
+    srcd __complete $tokens "$cur" 2>/dev/null
+    or __fish_complete_path "$cur"
+end
+complete -c srcd -f -a '(__srcd_complete)'
+`
+
+// completeCmd is called by the completion scripts with the words typed, the
+// last one being the one to complete, and prints the candidates one per line.
+// It fails if the shell has to complete file names instead. Nothing is ever
+// printed to stderr, not to mess up the terminal while completing.
+var completeCmd = &cobra.Command{
+	Use:                "__complete",
+	Hidden:             true,
+	DisableFlagParsing: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		logrus.SetOutput(ioutil.Discard)
+		if len(args) == 0 {
+			args = []string{""}
+		}
+
+		candidates, files := completions(rootCmd, args)
+		if files {
+			return exitStatus(exitError)
+		}
+
+		for _, c := range candidates {
+			fmt.Println(c)
+		}
+		return nil
+	},
+}
+
+// completionFunc returns the candidates for the next argument of a command,
+// given the ones already there.
+type completionFunc func(ctx context.Context, args []string) []string
+
+// argCompletions are the dynamic completions of the arguments by command.
+var argCompletions = make(map[*cobra.Command]completionFunc)
+
+// completeArgs completes the arguments of cmd with f.
+func completeArgs(cmd *cobra.Command, f completionFunc) {
+	argCompletions[cmd] = f
+}
+
+// completions returns the candidates for the last of the words, which can be
+// empty, typed after srcd, sorted and starting with it. It reports whether the
+// shell has to complete file names instead.
+func completions(root *cobra.Command, words []string) ([]string, bool) {
+	toComplete := words[len(words)-1]
+	cmd, rest, _ := root.Find(words[:len(words)-1])
+	args := positionalArgs(cmd, rest)
+
+	var candidates []string
+	complete, dynamic := argCompletions[cmd]
+	switch {
+	case strings.HasPrefix(toComplete, "-"):
+		candidates = flagNames(cmd)
+	case cmd.HasAvailableSubCommands() && len(args) == 0:
+		for _, c := range cmd.Commands() {
+			if c.IsAvailableCommand() {
+				candidates = append(candidates, c.Name())
+			}
+		}
+	case dynamic:
+		ctx, cancel := context.WithTimeout(context.Background(), completionTimeout)
+		defer cancel()
+		candidates = without(complete(ctx, args), args)
+	default:
+		return nil, true
+	}
+
+	var result []string
+	for _, c := range candidates {
+		if strings.HasPrefix(c, toComplete) {
+			result = append(result, c)
+		}
+	}
+
+	sort.Strings(result)
+	return result, false
+}
+
+// positionalArgs returns the arguments that are not flags, or their values.
+func positionalArgs(cmd *cobra.Command, args []string) []string {
+	var result []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			result = append(result, arg)
+			continue
+		}
+
+		if strings.Contains(arg, "=") {
+			continue
+		}
+
+		var f *pflag.Flag
+		if strings.HasPrefix(arg, "--") {
+			f = cmd.Flags().Lookup(arg[2:])
+		} else if len(arg) == 2 {
+			f = cmd.Flags().ShorthandLookup(arg[1:])
+		}
+
+		// The value of the flag is the next argument.
+		if f != nil && f.NoOptDefVal == "" {
+			i++
+		}
+	}
+	return result
+}
+
+// flagNames returns the flags of the command, including the inherited ones.
+func flagNames(cmd *cobra.Command) []string {
+	var names []string
+	add := func(f *pflag.Flag) {
+		if f.Hidden {
+			return
+		}
+
+		names = append(names, "--"+f.Name)
+		if f.Shorthand != "" {
+			names = append(names, "-"+f.Shorthand)
+		}
+	}
+
+	cmd.LocalFlags().VisitAll(add)
+	cmd.InheritedFlags().VisitAll(add)
+	return names
+}
+
+// without returns the candidates not given yet.
+func without(candidates, given []string) []string {
+	seen := make(map[string]bool, len(given))
+	for _, g := range given {
+		seen[g] = true
+	}
+
+	var result []string
+	for _, c := range candidates {
+		if !seen[c] {
+			result = append(result, c)
+		}
+	}
+	return result
+}
+
+// withFallback returns the result of f, or fallback if it fails or doesn't
+// finish before the context is done. The calls to docker can't all be
+// cancelled, so it's left running then.
+func withFallback(ctx context.Context, fallback []string, f func(context.Context) ([]string, error)) []string {
+	done := make(chan []string, 1)
+	go func() {
+		result, err := f(ctx)
+		if err != nil {
+			result = fallback
+		}
+		done <- result
+	}()
+
+	select {
+	case result := <-done:
+		return result
+	case <-ctx.Done():
+		return fallback
+	}
+}
+
+// onlyOne completes only the first argument with f.
+func onlyOne(f completionFunc) completionFunc {
+	return func(ctx context.Context, args []string) []string {
+		if len(args) > 0 {
+			return nil
+		}
+		return f(ctx, args)
+	}
+}
+
+func staticCompletion(candidates ...string) completionFunc {
+	return func(context.Context, []string) []string { return candidates }
+}
+
+func componentNames(context.Context, []string) []string {
+	return components.Names()
+}
+
+// imageCompletion completes with the components of the images keep returns
+// true for, or with all the component names if docker can't be reached.
+func imageCompletion(keep func(*components.Image) bool) completionFunc {
+	return func(ctx context.Context, _ []string) []string {
+		return withFallback(ctx, components.Names(), func(ctx context.Context) ([]string, error) {
+			imgs, err := components.Images(ctx)
+			if err != nil {
+				return nil, err
+			}
+
+			seen := make(map[string]bool)
+			var names []string
+			for _, img := range imgs {
+				if img.Component != nil && keep(img) && !seen[*img.Component] {
+					seen[*img.Component] = true
+					names = append(names, *img.Component)
+				}
+			}
+			return names, nil
+		})
+	}
+}
+
+var (
+	runningComponentNames   = imageCompletion(func(img *components.Image) bool { return img.Running })
+	installedComponentNames = imageCompletion(func(img *components.Image) bool { return img.Installed })
+)
+
+// installableImages completes with the images of the components at the
+// versions the engine uses that are not installed yet.
+func installableImages(ctx context.Context, _ []string) []string {
+	var refs []string
+	for _, c := range append([]components.Component{components.Daemon}, components.All...) {
+		refs = append(refs, c.Ref())
+	}
+
+	return withFallback(ctx, refs, func(ctx context.Context) ([]string, error) {
+		imgs, err := components.Images(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		var installed []string
+		for _, img := range imgs {
+			if img.Installed {
+				installed = append(installed, img.Image+":"+img.Tag)
+			}
+		}
+		return without(refs, installed), nil
+	})
+}
+
+// officialDriverCompletion completes with the languages with an official
+// driver.
+func officialDriverCompletion(ctx context.Context, _ []string) []string {
+	return withFallback(ctx, fallbackDriverLanguages, func(ctx context.Context) ([]string, error) {
+		drivers, err := discovery.OfficialDrivers(ctx, &discovery.Options{
+			NamesOnly:     true,
+			NoMaintainers: true,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		var langs []string
+		for _, d := range drivers {
+			langs = append(langs, strings.ToLower(d.Language))
+		}
+		return langs, nil
+	})
+}
+
+// installedDriverCompletion completes with the languages of the drivers
+// installed. The daemon is not started for it.
+func installedDriverCompletion(ctx context.Context, _ []string) []string {
+	return withFallback(ctx, fallbackDriverLanguages, func(ctx context.Context) ([]string, error) {
+		if running, err := daemon.IsRunning(); err != nil || !running {
+			return nil, fmt.Errorf("the daemon is not running")
+		}
+
+		c, err := daemon.Client()
+		if err != nil {
+			return nil, err
+		}
+
+		res, err := c.ListDrivers(ctx, &api.ListDriversRequest{})
+		if err != nil {
+			return nil, err
+		}
+
+		var langs []string
+		for _, d := range res.Drivers {
+			langs = append(langs, strings.ToLower(d.Lang))
+		}
+		return langs, nil
+	})
+}
+
+func init() {
+	rootCmd.AddCommand(completionCmd, completeCmd)
+
+	completeArgs(completionCmd, onlyOne(staticCompletion("bash", "zsh", "fish")))
+	completeArgs(stopCmd, runningComponentNames)
+	completeArgs(webStopCmd, onlyOne(staticCompletion("sql", "parse")))
+	completeArgs(restartCmd, componentNames)
+	completeArgs(logsCmd, runningComponentNames)
+	completeArgs(statsCmd, componentNames)
+	completeArgs(logLevelCmd, onlyOne(staticCompletion(logLevels...)))
+	completeArgs(daemonHealthCmd, onlyOne(staticCompletion(api.HealthServices...)))
+	completeArgs(componentsStatusCmd, onlyOne(componentNames))
+	completeArgs(componentsInspectCmd, onlyOne(componentNames))
+	completeArgs(composeExportCmd, componentNames)
+	completeArgs(k8sExportCmd, componentNames)
+	completeArgs(componentsSetImageCmd, onlyOne(componentNames))
+	completeArgs(componentsInstallCmd, installableImages)
+	completeArgs(componentsRemoveCmd, installedComponentNames)
+	completeArgs(componentsUpgradeCmd, onlyOne(installedComponentNames))
+	completeArgs(parseDriversInstallCmd, officialDriverCompletion)
+	completeArgs(parseDriversUpdateCmd, installedDriverCompletion)
+	completeArgs(parseDriversRemoveCmd, installedDriverCompletion)
+}
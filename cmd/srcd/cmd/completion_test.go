@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestCompletions(t *testing.T) {
+	root := &cobra.Command{Use: "srcd"}
+	root.PersistentFlags().CountP("verbose", "v", "")
+	stop := &cobra.Command{Use: "stop", Run: func(*cobra.Command, []string) {}}
+	stop.Flags().Duration("timeout", 0, "")
+	stop.Flags().Bool("force", false, "")
+	components := &cobra.Command{Use: "components"}
+	list := &cobra.Command{Use: "list", Run: func(*cobra.Command, []string) {}}
+	hidden := &cobra.Command{Use: "hidden", Hidden: true, Run: func(*cobra.Command, []string) {}}
+	lang := &cobra.Command{Use: "lang", Run: func(*cobra.Command, []string) {}}
+	components.AddCommand(list)
+	root.AddCommand(stop, components, hidden, lang)
+
+	defer func(c map[*cobra.Command]completionFunc) { argCompletions = c }(argCompletions)
+	argCompletions = make(map[*cobra.Command]completionFunc)
+	completeArgs(stop, staticCompletion("bblfshd", "gitbase", "pilosa"))
+
+	testCases := []struct {
+		words    []string
+		expected string
+	}{
+		{[]string{""}, "[components lang stop]"},
+		{[]string{"s"}, "[stop]"},
+		{[]string{"components", ""}, "[list]"},
+		{[]string{"stop", ""}, "[bblfshd gitbase pilosa]"},
+		{[]string{"stop", "g"}, "[gitbase]"},
+		{[]string{"stop", "gitbase", ""}, "[bblfshd pilosa]"},
+		{[]string{"stop", "--timeout", "1s", "pilosa", ""}, "[bblfshd gitbase]"},
+		{[]string{"stop", "--force", "pilosa", ""}, "[bblfshd gitbase]"},
+		{[]string{"stop", "--"}, "[--force --timeout --verbose]"},
+		{[]string{"-v", "stop", "b"}, "[bblfshd]"},
+		{[]string{"components", "list", ""}, "files"},
+		{[]string{"lang", ""}, "files"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(fmt.Sprint(tc.words), func(t *testing.T) {
+			candidates, files := completions(root, tc.words)
+			got := fmt.Sprint(candidates)
+			if files {
+				got = "files"
+			}
+
+			if got != tc.expected {
+				t.Errorf("expected: %s, got: %s", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestWithFallback(t *testing.T) {
+	fallback := []string{"fallback"}
+	testCases := []struct {
+		name     string
+		f        func(context.Context) ([]string, error)
+		expected string
+	}{
+		{"ok", func(context.Context) ([]string, error) { return []string{"ok"}, nil }, "[ok]"},
+		{"error", func(context.Context) ([]string, error) { return nil, fmt.Errorf("unreachable") }, "[fallback]"},
+		{"timeout", func(ctx context.Context) ([]string, error) {
+			<-make(chan struct{})
+			return nil, nil
+		}, "[fallback]"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			if tc.name == "timeout" {
+				cancel()
+			}
+			defer cancel()
+
+			got := fmt.Sprint(withFallback(ctx, fallback, tc.f))
+			if got != tc.expected {
+				t.Errorf("expected: %s, got: %s", tc.expected, got)
+			}
+		})
+	}
+}
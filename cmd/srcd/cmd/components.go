@@ -17,10 +17,15 @@ package cmd
 import (
 	"context"
 	"fmt"
-	"log"
+	"io"
 	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
 
+	units "github.com/docker/go-units"
 	"github.com/spf13/cobra"
+	"github.com/src-d/engine/cmd/srcd/daemon"
 	"github.com/src-d/engine/components"
 )
 
@@ -34,52 +39,275 @@ var componentsCmd = &cobra.Command{
 var componentsListCmd = &cobra.Command{
 	Use:   "list",
 	Short: "List source{d} components",
-	Run: func(cmd *cobra.Command, args []string) {
-		imgs, err := components.List(context.Background())
+	Long: `List source{d} components
+
+The images of the components installed are listed with their tag, digest in
+Docker Hub, size, creation date, and whether a container of the engine is
+running them, with its uptime and the ports it publishes. The components not
+installed are listed too.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		out, err := outputFormat(cmd)
 		if err != nil {
-			log.Printf("could not list images: %v", err)
-			os.Exit(1)
+			return err
 		}
 
-		for _, img := range imgs {
-			fmt.Println(img)
+		imgs, err := components.Images(context.Background())
+		if err != nil {
+			return fmt.Errorf("could not list images: %v", err)
 		}
+
+		err = out.print(os.Stdout, "image", imgs, func(w io.Writer) error { return printImages(w, imgs) })
+		return err
 	},
 }
 
-// componentsCmd represents the components install command
-var componentsInstallCmd = &cobra.Command{
-	Use:   "install",
-	Short: "Install source{d} component",
-	Run: func(cmd *cobra.Command, args []string) {
-		for _, arg := range args {
-			ok, err := components.IsInstalled(context.Background(), arg)
-			if err != nil {
-				if err == components.ErrNotSrcd {
-					log.Printf("can't install %s, docker image from unknown organization", arg)
-				} else {
-					log.Printf("could not check if %s is installed: %v", arg, err)
-				}
-				os.Exit(1)
-			}
+func printImages(w io.Writer, imgs []*components.Image) error {
+	tw := new(tabwriter.Writer)
+	tw.Init(w, 0, 8, 5, '\t', 0)
+	fmt.Fprintln(tw, "COMPONENT\tIMAGE\tTAG\tSTATE\tUPTIME\tPORTS\tDIGEST\tSIZE\tCREATED")
+	fmt.Fprintln(tw, "----------\t----------\t----------\t----------\t----------\t----------\t----------\t----------\t----------")
+	for _, img := range imgs {
+		fmt.Fprintln(tw, strings.Join(imageRow(img, time.Now()), "\t"))
+	}
+	return tw.Flush()
+}
+
+// imageRow returns the columns of the table of components list for the image.
+func imageRow(img *components.Image, now time.Time) []string {
+	row := []string{"-", img.Image, img.Tag, "not installed", "-", "-", "-", "-", "-"}
+	if img.Component != nil {
+		row[0] = *img.Component
+	}
+
+	if !img.Installed {
+		return row
+	}
+
+	row[3] = "installed"
+	if img.Running {
+		row[3] = "running"
+	}
+
+	if img.StartedAt != nil {
+		row[4] = units.HumanDuration(now.Sub(*img.StartedAt))
+	}
+
+	row[5] = orDash(strings.Join(img.Ports, ","))
+	if img.Digest != nil {
+		row[6] = shortDigest(*img.Digest)
+	}
+
+	if img.Size != nil {
+		row[7] = humanSize(*img.Size)
+	}
+
+	if img.Created != nil {
+		row[8] = units.HumanDuration(now.Sub(*img.Created)) + " ago"
+	}
+	return row
+}
+
+// componentsStatusCmd represents the components status command
+var componentsStatusCmd = &cobra.Command{
+	Use:   "status [name]",
+	Short: "Show the status of source{d} components",
+	Long: `Show the status of source{d} components
 
-			if ok {
-				log.Printf("%q is already installed", arg)
-				continue
+Every component is listed with whether its image is installed, the state of its
+container, its health, uptime, published ports and version. Given the name of a
+component, its mounts, environment, restart count and last lines of logs are
+printed too.
+
+It exits with a non-zero code if any of the components required by the last
+srcd init is not running or is unhealthy: the daemon, and bblfshd, pilosa and
+gitbase unless they were disabled.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmps := append([]components.Component{components.Daemon}, components.All...)
+		if len(args) > 0 {
+			c, ok := components.ByName(args[0])
+			if !ok {
+				return usageErrorf("unknown component %s", args[0])
 			}
+			cmps = []components.Component{c}
+		}
+
+		out, err := outputFormat(cmd)
+		if err != nil {
+			return err
+		}
+
+		cfg, err := daemon.Running()
+		if err != nil {
+			return err
+		}
 
-			log.Printf("installing %s", arg)
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
 
-			if err := components.Install(context.Background(), arg); err != nil {
-				log.Printf("could not install %s: %v", arg, err)
-				os.Exit(1)
+		var statuses []*components.Status
+		for _, c := range cmps {
+			s, err := components.GetStatus(ctx, c, len(args) > 0)
+			if err != nil {
+				return err
 			}
+			statuses = append(statuses, s)
+		}
+		markDisabled(statuses, cfg)
+
+		if len(args) > 0 {
+			err = out.print(os.Stdout, "status", statuses[0], func(w io.Writer) error {
+				return printStatusDetail(w, statuses[0])
+			})
+		} else {
+			err = out.print(os.Stdout, "status", statuses, func(w io.Writer) error {
+				return printStatusTable(w, statuses)
+			})
 		}
+		if err != nil {
+			return err
+		}
+
+		if unhealthy := unhealthyComponents(statuses, cfg); len(unhealthy) > 0 {
+			return notRunningErrorf("required components not healthy: %s", strings.Join(unhealthy, ", "))
+		}
+		return nil
 	},
 }
 
+// markDisabled sets the state of the components disabled on init that are
+// not running to disabled.
+func markDisabled(statuses []*components.Status, cfg *daemon.Config) {
+	if cfg == nil {
+		return
+	}
+
+	for _, s := range statuses {
+		c, ok := components.ByName(s.Name)
+		if ok && !cfg.Enabled(c.Name) && c.Name != components.Daemon.Name && s.State != components.StateRunning {
+			s.State = components.StateDisabled
+		}
+	}
+}
+
+// unhealthyComponents returns the names of the components required by the
+// configuration given that are not healthy. Without a configuration, the
+// engine is not initialized and all of them are required.
+func unhealthyComponents(statuses []*components.Status, cfg *daemon.Config) []string {
+	required := map[string]bool{components.Daemon.ShortName(): true}
+	for _, c := range initComponentsOrder() {
+		required[c.ShortName()] = cfg == nil || cfg.Enabled(c.Name)
+	}
+	return components.Unhealthy(statuses, func(name string) bool { return required[name] })
+}
+
+func printStatusTable(w io.Writer, statuses []*components.Status) error {
+	tw := new(tabwriter.Writer)
+	tw.Init(w, 0, 8, 5, '\t', 0)
+	fmt.Fprintln(tw, "NAME\tSTATE\tHEALTH\tUPTIME\tPORTS\tTAG\tINSTALLED")
+	fmt.Fprintln(tw, "----------\t----------\t----------\t----------\t----------\t----------\t----------")
+	for _, s := range statuses {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			s.Name, s.State, s.Health, uptime(s), orDash(strings.Join(s.Ports, ",")),
+			s.Tag, yesNo(s.Installed))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	printOverrides(w, statuses)
+	return nil
+}
+
+// printOverrides prints the components whose images are overridden, as they
+// don't run the images the engine is tested with.
+func printOverrides(w io.Writer, statuses []*components.Status) {
+	var overrides []string
+	for _, s := range statuses {
+		if s.Override != nil {
+			overrides = append(overrides, fmt.Sprintf("%s: %s", s.Name, *s.Override))
+		}
+	}
+	printList(w, "image overrides, reset them with srcd components set-image <component> --reset", overrides)
+
+	var pinned []string
+	for _, s := range statuses {
+		if s.PinnedVersion != nil {
+			pinned = append(pinned, pinnedVersionItem(s.Name, *s.PinnedVersion))
+		}
+	}
+	printList(w, "pinned versions, unpin them with srcd init --<component>-version default", pinned)
+
+	var emulated []string
+	for _, s := range statuses {
+		if s.Emulated && s.Platform != nil {
+			emulated = append(emulated, fmt.Sprintf("%s: %s", s.Name, *s.Platform))
+		}
+	}
+	printList(w, "running emulated, for another platform than the one of docker", emulated)
+}
+
+// pinnedVersionItem returns the item of the list of pinned versions of the
+// component, telling how to unpin pilosa, which has no flag in srcd init.
+func pinnedVersionItem(name, version string) string {
+	if name == components.Pilosa.ShortName() {
+		return fmt.Sprintf("%s: %s, unpin it with srcd components upgrade pilosa --to default", name, version)
+	}
+	return fmt.Sprintf("%s: %s", name, version)
+}
+
+func printStatusDetail(w io.Writer, s *components.Status) error {
+	tw := new(tabwriter.Writer)
+	tw.Init(w, 0, 8, 1, ' ', 0)
+	fmt.Fprintf(tw, "name:\t%s\n", s.Name)
+	fmt.Fprintf(tw, "state:\t%s\n", s.State)
+	fmt.Fprintf(tw, "health:\t%s\n", s.Health)
+	fmt.Fprintf(tw, "uptime:\t%s\n", uptime(s))
+	fmt.Fprintf(tw, "ports:\t%s\n", orDash(strings.Join(s.Ports, ", ")))
+	fmt.Fprintf(tw, "image:\t%s\n", s.Image)
+	fmt.Fprintf(tw, "tag:\t%s\n", s.Tag)
+	if s.Override != nil {
+		fmt.Fprintf(tw, "override:\t%s\n", *s.Override)
+	}
+	if s.PinnedVersion != nil {
+		fmt.Fprintf(tw, "pinned version:\t%s\n", *s.PinnedVersion)
+	}
+	fmt.Fprintf(tw, "installed:\t%s\n", yesNo(s.Installed))
+	fmt.Fprintf(tw, "restarts:\t%d\n", s.RestartCount)
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	printList(w, "mounts", s.Mounts)
+	printList(w, "environment", s.Env)
+	printList(w, "logs", s.Logs)
+	return nil
+}
+
+func printList(w io.Writer, title string, items []string) {
+	if len(items) == 0 {
+		return
+	}
+
+	fmt.Fprintf(w, "\n%s:\n", title)
+	for _, item := range items {
+		fmt.Fprintf(w, "  %s\n", item)
+	}
+}
+
+func uptime(s *components.Status) string {
+	if s.StartedAt == nil {
+		return "-"
+	}
+	return units.HumanDuration(s.Uptime())
+}
+
 func init() {
 	rootCmd.AddCommand(componentsCmd)
 	componentsCmd.AddCommand(componentsListCmd)
-	componentsCmd.AddCommand(componentsInstallCmd)
+	componentsCmd.AddCommand(componentsStatusCmd)
+
+	addOutputFlags(componentsListCmd, false)
+	addOutputFlags(componentsStatusCmd, true)
 }
@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/src-d/engine/components"
+	yaml "gopkg.in/yaml.v2"
+)
+
+var componentsInspectCmd = &cobra.Command{
+	Use:   "inspect name",
+	Short: "Print the details of the image and container of a component",
+	Long: `Print the details of the image and container of a component
+
+The details docker has of the image and the container of the component, like
+gitbase or bblfshd, are printed together: digests, environment, mounts,
+networks, health checks and restarts, among others. The values of the
+environment variables that look like credentials, like the token of the daemon
+or the password of gitbase, are redacted. The image is shown even if the
+container doesn't exist.
+
+The details are printed as YAML, or as JSON with --format json.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c, ok := components.ByName(args[0])
+		if !ok {
+			return usageErrorf("unknown component %s", args[0])
+		}
+
+		out, err := outputFormat(cmd)
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		details, err := components.Inspect(ctx, c)
+		cancel()
+		if err != nil {
+			return err
+		}
+
+		if details.Container == nil {
+			logrus.Infof("there's no container of %s", c.ShortName())
+		}
+		if details.Image == nil {
+			logrus.Infof("the image %s is not installed", c.Ref())
+		}
+
+		return out.print(os.Stdout, "inspection", details, func(w io.Writer) error {
+			return printInspection(w, details)
+		})
+	},
+}
+
+// printInspection prints the details as YAML, with null for the container or
+// the image if they are absent.
+func printInspection(w io.Writer, details *components.Inspection) error {
+	content, err := yaml.Marshal(details)
+	if err != nil {
+		return fmt.Errorf("could not encode the details: %v", err)
+	}
+
+	_, err = w.Write(content)
+	return err
+}
+
+func init() {
+	componentsCmd.AddCommand(componentsInspectCmd)
+	addOutputFlags(componentsInspectCmd, true)
+}
@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/src-d/engine/components"
+)
+
+func TestPrintInspection(t *testing.T) {
+	details := &components.Inspection{
+		Name: "gitbase",
+		Image: &components.ImageDetails{
+			Ref:     "srcd/gitbase:latest",
+			Digests: []string{"srcd/gitbase@sha256:0123"},
+			Env:     []string{"GITBASE_USER=root", "GITBASE_PASSWORD="},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := printInspection(&buf, details); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{
+		"name: gitbase\n",
+		"  ref: srcd/gitbase:latest\n",
+		"  - srcd/gitbase@sha256:0123\n",
+		"  - GITBASE_PASSWORD=\n",
+		"container: null\n",
+	} {
+		if !strings.Contains(buf.String(), expected) {
+			t.Errorf("expected: %q in the output, got: %s", expected, buf.String())
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	units "github.com/docker/go-units"
+	"github.com/spf13/cobra"
+	"github.com/src-d/engine/components"
+)
+
+// componentsInstallCmd represents the components install command
+var componentsInstallCmd = &cobra.Command{
+	Use:   "install [image...]",
+	Short: "Install source{d} components",
+	Long: `Install source{d} components
+
+The images given, like srcd/gitbase or pilosa/pilosa:v0.9.0, or the ones of all
+the components at the versions the engine uses with --all, are pulled at the
+same time. The images already installed are skipped.
+
+It exits with a non-zero code if any of the images could not be installed.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		all, _ := cmd.Flags().GetBool("all")
+		refs, err := installRefs(args, all)
+		if err != nil {
+			return err
+		}
+
+		display := newPullDisplay(os.Stderr, decorated(os.Stderr) && !quiet, refs)
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+		results, err := components.InstallAll(ctx, refs, display.progress)
+		cancel()
+		display.stop()
+		if err != nil {
+			return err
+		}
+
+		err = newRecordWriter(os.Stdout).write("install", installRecords(results), func(w io.Writer) error {
+			printInstallResults(w, results)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		if failed := failedInstalls(results); failed > 0 {
+			return operationFailed(fmt.Errorf("%d of %d images could not be installed", failed, len(results)))
+		}
+		return nil
+	},
+}
+
+// installRefs returns the images to install given in the arguments, or the
+// ones of all the components with all.
+func installRefs(args []string, all bool) ([]string, error) {
+	switch {
+	case all && len(args) > 0:
+		return nil, usageErrorf("give either the images to install or --all")
+	case all:
+		var refs []string
+		for _, c := range append([]components.Component{components.Daemon}, components.All...) {
+			refs = append(refs, c.Ref())
+		}
+		return refs, nil
+	case len(args) == 0:
+		return nil, fmt.Errorf("give the images to install, or --all to install all the components")
+	default:
+		return args, nil
+	}
+}
+
+// printInstallResults prints whether every image was installed and returns
+// the number that failed.
+func printInstallResults(w io.Writer, results []components.InstallResult) int {
+	var failed int
+	for _, r := range results {
+		switch {
+		case r.Err != nil:
+			failed++
+			fmt.Fprintf(w, "✗ %s: %v\n", r.Ref, r.Err)
+		case r.UpToDate:
+			fmt.Fprintf(w, "✓ %s up to date\n", r.Ref)
+		default:
+			fmt.Fprintf(w, "✓ %s installed\n", r.Ref)
+		}
+	}
+	return failed
+}
+
+// installRecord is the result of installing an image with --output-mode json.
+type installRecord struct {
+	Image string `json:"image"`
+	// Status is installed, up to date or failed.
+	Status string  `json:"status"`
+	Error  *string `json:"error"`
+}
+
+func installRecords(results []components.InstallResult) []installRecord {
+	var records []installRecord
+	for _, r := range results {
+		record := installRecord{Image: r.Ref, Status: "installed"}
+		switch {
+		case r.Err != nil:
+			msg := r.Err.Error()
+			record.Status = "failed"
+			record.Error = &msg
+		case r.UpToDate:
+			record.Status = "up to date"
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func failedInstalls(results []components.InstallResult) int {
+	var failed int
+	for _, r := range results {
+		if r.Err != nil {
+			failed++
+		}
+	}
+	return failed
+}
+
+// pullDisplay shows the bytes downloaded of the images pulled at the same
+// time, one line for each, refreshed in place on terminals. Elsewhere it
+// shows nothing, as the results are printed once all of them finish.
+type pullDisplay struct {
+	w   io.Writer
+	tty bool
+
+	mu     sync.Mutex
+	refs   []string
+	status map[string]string
+	drawn  bool
+	last   time.Time
+}
+
+func newPullDisplay(w io.Writer, tty bool, refs []string) *pullDisplay {
+	return &pullDisplay{w: w, tty: tty, refs: refs, status: make(map[string]string)}
+}
+
+// progress records the bytes downloaded of the image. It can be called from
+// several goroutines.
+func (d *pullDisplay) progress(ref string, done, total int64) {
+	if !d.tty {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.status[normalizeRef(ref)] = fmt.Sprintf("%s / %s",
+		units.HumanSize(float64(done)), units.HumanSize(float64(total)))
+	if time.Since(d.last) >= progressTTYInterval {
+		d.draw()
+	}
+}
+
+// draw must be called with the lock held.
+func (d *pullDisplay) draw() {
+	if d.drawn {
+		fmt.Fprintf(d.w, "\033[%dA", len(d.refs))
+	}
+
+	for _, ref := range d.refs {
+		fmt.Fprintf(d.w, "\r\033[K%s: %s\n", ref, orDash(d.status[normalizeRef(ref)]))
+	}
+	d.drawn = true
+	d.last = time.Now()
+}
+
+// stop clears the lines drawn.
+func (d *pullDisplay) stop() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.drawn {
+		fmt.Fprintf(d.w, "\033[%dA\033[J", len(d.refs))
+		d.drawn = false
+	}
+}
+
+// normalizeRef adds the latest tag to references without one.
+func normalizeRef(ref string) string {
+	if strings.Contains(ref[strings.LastIndex(ref, "/")+1:], ":") {
+		return ref
+	}
+	return ref + ":latest"
+}
+
+func init() {
+	componentsCmd.AddCommand(componentsInstallCmd)
+	componentsInstallCmd.Flags().Bool("all", false, "install all the components at the versions used by the engine")
+}
@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/src-d/engine/components"
+)
+
+func TestInstallRefs(t *testing.T) {
+	testCases := []struct {
+		name     string
+		args     []string
+		all      bool
+		expected int
+		err      bool
+	}{
+		{"given", []string{"srcd/gitbase", "pilosa/pilosa:v0.9.0"}, false, 2, false},
+		{"all", nil, true, len(components.All) + 1, false},
+		{"none", nil, false, 0, true},
+		{"both", []string{"srcd/gitbase"}, true, 0, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			refs, err := installRefs(tc.args, tc.all)
+			if tc.err {
+				if err == nil {
+					t.Errorf("expected error, got: %v", refs)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if len(refs) != tc.expected {
+				t.Errorf("expected: %d images, got: %d", tc.expected, len(refs))
+			}
+		})
+	}
+}
+
+func TestPrintInstallResults(t *testing.T) {
+	results := []components.InstallResult{
+		{Ref: "srcd/gitbase:latest", UpToDate: true},
+		{Ref: "bblfsh/bblfshd:latest"},
+		{Ref: "pilosa/pilosa:v0.9.0", Err: errors.New("timeout")},
+	}
+
+	var buf bytes.Buffer
+	if failed := printInstallResults(&buf, results); failed != 1 {
+		t.Errorf("expected: 1 failed, got: %d", failed)
+	}
+
+	expected := strings.Join([]string{
+		"✓ srcd/gitbase:latest up to date",
+		"✓ bblfsh/bblfshd:latest installed",
+		"✗ pilosa/pilosa:v0.9.0: timeout",
+	}, "\n") + "\n"
+	if buf.String() != expected {
+		t.Errorf("expected: %s, got: %s", expected, buf.String())
+	}
+}
+
+func TestNormalizeRef(t *testing.T) {
+	testCases := []struct {
+		ref      string
+		expected string
+	}{
+		{"srcd/gitbase", "srcd/gitbase:latest"},
+		{"pilosa/pilosa:v0.9.0", "pilosa/pilosa:v0.9.0"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.ref, func(t *testing.T) {
+			if got := normalizeRef(tc.ref); got != tc.expected {
+				t.Errorf("expected: %s, got: %s", tc.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/src-d/engine/cmd/srcd/daemon"
+	"github.com/src-d/engine/components"
+)
+
+var componentsRemoveCmd = &cobra.Command{
+	Use:   "remove [name|image...]",
+	Short: "Remove the images of source{d} components",
+	Long: `Remove the images of source{d} components
+
+The components can be given by name, like gitbase or bblfshd, or by image, like
+srcd/gitbase:latest. With --all the images of all of them are removed, after
+asking for confirmation unless --yes is given, which is lighter than srcd kill
+as the volumes are kept. The images are downloaded again the next time the
+components are started.
+
+Images used by running containers are not removed, unless --force is given,
+which stops them first. The volumes of the components are only removed with
+--volumes, including cache volumes like the one with the drivers of bblfshd.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		all, _ := cmd.Flags().GetBool("all")
+		cmps, err := removeComponents(args, all)
+		if err != nil {
+			return err
+		}
+
+		var opts components.UninstallOptions
+		opts.Force, _ = cmd.Flags().GetBool("force")
+		opts.Volumes, _ = cmd.Flags().GetBool("volumes")
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		plan, err := components.UninstallPlan(ctx, cmps, opts)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("could not list the resources to remove: %v", err)
+		}
+
+		if plan.Empty() {
+			logrus.Info("nothing to remove, the components are not installed")
+			return nil
+		}
+
+		cfg, err := daemon.Running()
+		if err != nil {
+			return err
+		}
+		warnRequiredBy(cmps, cfg)
+
+		if err := printPurgeTable(os.Stdout, plan); err != nil {
+			return err
+		}
+
+		if yes, _ := cmd.Flags().GetBool("yes"); all && !yes {
+			if !isTerminal(os.Stdin) {
+				return usageErrorf("refusing to remove all the components without confirmation, use --yes")
+			}
+
+			if !askYesNo(bufio.NewReader(os.Stdin), os.Stderr, "Remove the above?") {
+				logrus.Info("nothing removed")
+				return nil
+			}
+		}
+
+		ctx, cancel = context.WithTimeout(context.Background(), 10*time.Minute)
+		err = components.Uninstall(ctx, plan, opts)
+		cancel()
+		if errors.Cause(err) == components.ErrInUse {
+			return fmt.Errorf("%v; stop them first, or use --force", err)
+		} else if err != nil {
+			return err
+		}
+
+		fmt.Printf("space freed: %s\n", humanSize(plan.Size()))
+		return nil
+	},
+}
+
+// removeComponents returns the components with the given names or images, or
+// nil with all, meaning all of them.
+func removeComponents(args []string, all bool) ([]components.Component, error) {
+	switch {
+	case all && len(args) > 0:
+		return nil, usageErrorf("give either the components to remove or --all")
+	case all:
+		return nil, nil
+	case len(args) == 0:
+		return nil, fmt.Errorf("give the components to remove, or --all to remove all of them")
+	}
+
+	var cmps []components.Component
+	for _, arg := range args {
+		c, ok := components.ByName(arg)
+		if !ok {
+			c, ok = components.ByImage(arg)
+		}
+
+		if !ok {
+			return nil, usageErrorf("unknown component %s", arg)
+		}
+		cmps = append(cmps, c)
+	}
+	return cmps, nil
+}
+
+// warnRequiredBy warns about the components removed that others enabled in
+// the configuration given, if any, depend on.
+func warnRequiredBy(cmps []components.Component, cfg *daemon.Config) {
+	if cfg == nil || len(cmps) == 0 {
+		return
+	}
+
+	removed := make(map[string]bool)
+	for _, c := range cmps {
+		removed[c.Name] = true
+	}
+
+	for _, c := range cmps {
+		for _, other := range components.RequiredBy(c) {
+			if !removed[other.Name] && cfg.Enabled(other.Name) {
+				logrus.Warnf("%s is used by %s, it will be downloaded again when %s starts",
+					c.ShortName(), other.ShortName(), other.ShortName())
+			}
+		}
+	}
+}
+
+func init() {
+	componentsCmd.AddCommand(componentsRemoveCmd)
+
+	flags := componentsRemoveCmd.Flags()
+	flags.Bool("all", false, "remove the images of all the components")
+	flags.Bool("force", false, "stop the containers using the images to remove")
+	flags.Bool("volumes", false, "remove the volumes of the components too")
+	flags.BoolP("yes", "y", false, "with --all, remove without asking for confirmation")
+}
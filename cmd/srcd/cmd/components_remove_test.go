@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRemoveComponents(t *testing.T) {
+	testCases := []struct {
+		name     string
+		args     []string
+		all      bool
+		expected []string
+		err      bool
+	}{
+		{"names", []string{"gitbase", "bblfshd"}, false, []string{"gitbase", "bblfshd"}, false},
+		{"images", []string{"srcd/gitbase:latest", "pilosa/pilosa"}, false, []string{"gitbase", "pilosa"}, false},
+		{"all", nil, true, nil, false},
+		{"none", nil, false, nil, true},
+		{"both", []string{"gitbase"}, true, nil, true},
+		{"unknown", []string{"mysql"}, false, nil, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cmps, err := removeComponents(tc.args, tc.all)
+			if tc.err {
+				if err == nil {
+					t.Errorf("expected error, got: %v", cmps)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var names []string
+			for _, c := range cmps {
+				names = append(names, c.ShortName())
+			}
+
+			if strings.Join(names, ",") != strings.Join(tc.expected, ",") {
+				t.Errorf("expected: %v, got: %v", tc.expected, names)
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/src-d/engine/components"
+)
+
+// imagesKey is the section of the config file with the images overriding the
+// default ones of the components, by component name.
+const imagesKey = "components.images"
+
+var componentsSetImageCmd = &cobra.Command{
+	Use:   "set-image name [reference]",
+	Short: "Run a component with another image",
+	Long: `Run a component with another image
+
+The image given, like srcd/gitbase:dev-mybranch or a locally built
+localhost:5000/fork/gitbase:x, replaces the default one of the component. It's
+recorded in the components.images section of the config file, so every command
+uses it: it's the one installed, checked and started, and srcd init recreates
+the containers whose images changed. Images outside the srcd namespaces are
+installed too, with a warning.
+
+With --reset the default image is used again. The image of the daemon can't be
+replaced, as it's the one of the CLI.`,
+	Args: cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c, ok := components.ByName(args[0])
+		if !ok {
+			return usageErrorf("unknown component %s", args[0])
+		}
+
+		if c.Name == components.Daemon.Name {
+			return usageErrorf("the image of the daemon can't be replaced, it's the one of the CLI")
+		}
+
+		reset, _ := cmd.Flags().GetBool("reset")
+		switch {
+		case reset && len(args) == 2:
+			return usageErrorf("give either the reference of the image or --reset")
+		case !reset && len(args) == 1:
+			return usageErrorf("give the reference of the image, or --reset to use the default one")
+		}
+
+		path, err := configFilePath()
+		if err != nil {
+			return err
+		}
+
+		key := imagesKey + "." + c.ShortName()
+		if reset {
+			if err := setConfigFileValue(path, key, nil); err != nil {
+				return err
+			}
+			logrus.Infof("%s uses its default image %s again; run srcd init to recreate it", c.ShortName(), c.DefaultRef())
+			return nil
+		}
+
+		ref := strings.TrimSpace(args[1])
+		if !components.InSrcdNamespace(ref) {
+			logrus.Warnf("%s is not in the srcd namespaces, it will be installed anyway as the image of %s", ref, c.ShortName())
+		}
+
+		if err := setConfigFileValue(path, key, ref); err != nil {
+			return err
+		}
+		logrus.Infof("%s uses %s instead of its default image; run srcd init to recreate it", c.ShortName(), ref)
+		return nil
+	},
+}
+
+// imageOverrides returns the images overriding the default ones of the
+// components in the config file, by component name.
+func imageOverrides() (map[string]string, error) {
+	refs := make(map[string]string)
+	for name, ref := range viper.GetStringMapString(imagesKey) {
+		c, ok := components.ByName(name)
+		switch {
+		case !ok:
+			return nil, fmt.Errorf("unknown component %s in %s", name, imagesKey)
+		case c.Name == components.Daemon.Name:
+			return nil, fmt.Errorf("the image of the daemon can't be replaced in %s", imagesKey)
+		case strings.TrimSpace(ref) == "":
+			return nil, fmt.Errorf("empty image of %s in %s", name, imagesKey)
+		}
+		refs[c.Name] = strings.TrimSpace(ref)
+	}
+	return refs, nil
+}
+
+func init() {
+	componentsCmd.AddCommand(componentsSetImageCmd)
+	componentsSetImageCmd.Flags().Bool("reset", false, "use the default image of the component again")
+	addConfigSection(imagesKey)
+}
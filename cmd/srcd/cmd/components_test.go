@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/src-d/engine/cmd/srcd/daemon"
+	"github.com/src-d/engine/components"
+)
+
+func TestUnhealthyComponents(t *testing.T) {
+	running := func(name, health string) *components.Status {
+		return &components.Status{Name: name, State: components.StateRunning, Health: health}
+	}
+	stopped := func(name string) *components.Status {
+		return &components.Status{Name: name, State: components.StateStopped, Health: components.HealthNone}
+	}
+
+	testCases := []struct {
+		name     string
+		statuses []*components.Status
+		cfg      *daemon.Config
+		expected []string
+	}{
+		{
+			"all healthy",
+			[]*components.Status{
+				running("daemon", "-"), running("bblfshd", "healthy"),
+				running("pilosa", "-"), running("gitbase", "-"),
+			},
+			&daemon.Config{},
+			nil,
+		},
+		{
+			"web clients are not required",
+			[]*components.Status{running("daemon", "-"), stopped("gitbase-web"), stopped("bblfsh-web")},
+			&daemon.Config{},
+			nil,
+		},
+		{
+			"unhealthy",
+			[]*components.Status{running("daemon", "-"), running("bblfshd", "unhealthy"), running("gitbase", "starting")},
+			&daemon.Config{},
+			[]string{"bblfshd", "gitbase"},
+		},
+		{
+			"disabled",
+			[]*components.Status{running("daemon", "-"), stopped("pilosa")},
+			&daemon.Config{Components: []string{components.Bblfshd.Name, components.Gitbase.Name}},
+			nil,
+		},
+		{
+			"not initialized",
+			[]*components.Status{stopped("daemon"), stopped("pilosa")},
+			nil,
+			[]string{"daemon", "pilosa"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := unhealthyComponents(tc.statuses, tc.cfg)
+			if strings.Join(got, ",") != strings.Join(tc.expected, ",") {
+				t.Errorf("expected: %v, got: %v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestImageRow(t *testing.T) {
+	now := time.Date(2019, 1, 10, 12, 0, 0, 0, time.UTC)
+	started := now.Add(-3 * time.Hour)
+	created := now.Add(-48 * time.Hour)
+	name := "gitbase"
+	digest := "sha256:0123456789abcdef"
+	size := int64(2000000)
+
+	testCases := []struct {
+		name     string
+		img      *components.Image
+		expected string
+	}{
+		{
+			"running",
+			&components.Image{
+				Component: &name, Image: "srcd/gitbase", Tag: "latest", Installed: true,
+				Digest: &digest, Size: &size, Created: &created, Running: true,
+				StartedAt: &started, Ports: []string{"3306->3306/tcp"},
+			},
+			"gitbase|srcd/gitbase|latest|running|3 hours|3306->3306/tcp|0123456789ab|2MB|2 days ago",
+		},
+		{
+			"installed",
+			&components.Image{
+				Component: &name, Image: "srcd/gitbase", Tag: "latest", Installed: true,
+				Size: &size, Created: &created,
+			},
+			"gitbase|srcd/gitbase|latest|installed|-|-|-|2MB|2 days ago",
+		},
+		{
+			"not installed",
+			&components.Image{Component: &name, Image: "srcd/gitbase", Tag: "latest"},
+			"gitbase|srcd/gitbase|latest|not installed|-|-|-|-|-",
+		},
+		{
+			"other image",
+			&components.Image{Image: "srcd/other", Tag: "v1", Installed: true, Size: &size, Created: &created},
+			"-|srcd/other|v1|installed|-|-|-|2MB|2 days ago",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := strings.Join(imageRow(tc.img, now), "|")
+			if got != tc.expected {
+				t.Errorf("expected: %s, got: %s", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestMarkDisabled(t *testing.T) {
+	statuses := []*components.Status{
+		runningStatus(components.Daemon),
+		runningStatus(components.Gitbase),
+		{Name: components.Pilosa.ShortName(), State: components.StateNotCreated, Health: components.HealthNone},
+		runningStatus(components.Bblfshd),
+	}
+
+	cfg := &daemon.Config{Components: []string{components.Gitbase.Name}}
+	markDisabled(statuses, cfg)
+
+	expected := []string{components.StateRunning, components.StateRunning,
+		components.StateDisabled, components.StateRunning}
+	for i, s := range statuses {
+		if s.State != expected[i] {
+			t.Errorf("expected: %s, got: %s for %s", expected[i], s.State, s.Name)
+		}
+	}
+}
@@ -0,0 +1,470 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	units "github.com/docker/go-units"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/src-d/engine/api"
+	"github.com/src-d/engine/cmd/srcd/daemon"
+	"github.com/src-d/engine/components"
+	"github.com/src-d/engine/docker"
+)
+
+// healthyTimeout is how long upgrade waits for a component recreated to be
+// healthy.
+const healthyTimeout = time.Minute
+
+var componentsUpgradeCmd = &cobra.Command{
+	Use:   "upgrade [name]",
+	Short: "Upgrade source{d} components to the images published",
+	Long: `Upgrade source{d} components to the images published
+
+The images installed of the given component, or of all of them with --all, are
+compared with the ones published in Docker Hub with the same tag. The ones with
+updates are pulled, after asking for confirmation unless --yes is given, and
+their running containers are recreated with the same configuration, waiting
+for them to be healthy. With --cleanup, the images replaced are removed.
+
+Pinned components, like pilosa, are only upgraded with --allow-pinned, as a
+new image could not read the data written by the old one. So are the ones
+whose version is pinned with srcd init --gitbase-version and the like, which
+are upgraded to the image published with the pinned version.
+
+To move pilosa to another version, like one published later, use --to v1.2.0.
+As the new one may not read its indexes, it refuses to run while there are
+some unless --backup-first writes them to a tar in the backups directory of
+the data directory first, or --reset-indexes removes them, along with the
+metadata gitbase has of them, to create them again later. The version is
+recorded in the components.versions section of the config file, and --to
+default goes back to the one the engine ships with.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if to, _ := cmd.Flags().GetString("to"); to != "" {
+			return upgradePilosa(cmd, args, to)
+		}
+
+		all, _ := cmd.Flags().GetBool("all")
+		cmps, err := upgradeCandidates(args, all)
+		if err != nil {
+			return err
+		}
+
+		out, err := outputFormat(cmd)
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		updates, err := components.CheckUpdates(ctx, cmps)
+		cancel()
+		if err != nil {
+			return err
+		}
+
+		err = out.print(os.Stdout, "update", updates, func(w io.Writer) error { return printUpdates(w, updates) })
+		if err != nil {
+			return err
+		}
+
+		allowPinned, _ := cmd.Flags().GetBool("allow-pinned")
+		selected, skipped := selectUpdates(updates, allowPinned)
+		for _, u := range skipped {
+			logrus.Warnf("%s is pinned to %s and has an update; use --allow-pinned to upgrade it",
+				u.Component.ShortName(), u.Component.Tag())
+		}
+
+		if len(selected) == 0 {
+			logrus.Info("nothing to upgrade")
+			return nil
+		}
+
+		for _, u := range selected {
+			if u.Component.Pinned {
+				logrus.Warnf("upgrading %s, which is pinned: the new image could fail to read "+
+					"the data written by the one installed; remove it with srcd prune if it does",
+					u.Component.ShortName())
+			}
+		}
+
+		if dryRun, _ := cmd.Flags().GetBool("dry-run"); dryRun {
+			return nil
+		}
+
+		if yes, _ := cmd.Flags().GetBool("yes"); !yes {
+			if !isTerminal(os.Stdin) {
+				return usageErrorf("use --yes to upgrade the components without confirmation")
+			}
+
+			question := fmt.Sprintf("upgrade %d components?", len(selected))
+			if !askYesNo(bufio.NewReader(os.Stdin), os.Stderr, question) {
+				return nil
+			}
+		}
+
+		cfg, err := daemon.Running()
+		if err != nil {
+			return err
+		}
+
+		cleanup, _ := cmd.Flags().GetBool("cleanup")
+		steps, err := upgradeSteps(cfg, selected, cleanup)
+		if err != nil {
+			return err
+		}
+
+		reporter := commandStepReporter()
+		if r, ok := reporter.(*ttyStepReporter); ok {
+			logrus.SetOutput(r)
+			defer logrus.SetOutput(os.Stderr)
+		}
+
+		return runSteps(reporter, steps)
+	},
+}
+
+// upgradeCandidates returns the component with the given name, or the daemon
+// and all the components with all.
+func upgradeCandidates(names []string, all bool) ([]components.Component, error) {
+	switch {
+	case all && len(names) > 0:
+		return nil, usageErrorf("give either the name of a component or --all")
+	case all:
+		return append([]components.Component{components.Daemon}, components.All...), nil
+	case len(names) == 0:
+		return nil, fmt.Errorf("give the name of a component, or --all to upgrade all of them")
+	}
+
+	c, ok := components.ByName(names[0])
+	if !ok {
+		return nil, usageErrorf("unknown component %s", names[0])
+	}
+	return []components.Component{c}, nil
+}
+
+// selectUpdates returns the updates available to upgrade, and the ones of
+// pinned components skipped unless allowPinned is true.
+func selectUpdates(updates []*components.Update, allowPinned bool) (selected, skipped []*components.Update) {
+	for _, u := range updates {
+		switch {
+		case !u.Available():
+		case u.Component.IsPinned() && !allowPinned:
+			skipped = append(skipped, u)
+		default:
+			selected = append(selected, u)
+		}
+	}
+	return selected, skipped
+}
+
+func printUpdates(w io.Writer, updates []*components.Update) error {
+	tw := new(tabwriter.Writer)
+	tw.Init(w, 0, 8, 5, '\t', 0)
+	fmt.Fprintln(tw, "NAME\tTAG\tLOCAL\tREMOTE\tUPDATE")
+	fmt.Fprintln(tw, "----------\t----------\t----------\t----------\t----------")
+	for _, u := range updates {
+		update := yesNo(u.Available())
+		if u.Local == "" {
+			update = "not installed"
+		} else if u.Available() && u.Component.IsPinned() {
+			update += " (pinned)"
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", u.Component.ShortName(), u.Component.Tag(),
+			shortDigest(u.Local), shortDigest(u.Remote), update)
+	}
+	return tw.Flush()
+}
+
+// shortDigest returns the first 12 characters of the hash of a digest, like
+// docker does with ids, or a dash if it's empty.
+func shortDigest(digest string) string {
+	hash := digest[strings.Index(digest, ":")+1:]
+	if len(hash) > 12 {
+		hash = hash[:12]
+	}
+	return orDash(hash)
+}
+
+// upgradeSteps returns the steps to pull the images of the updates and
+// recreate the containers running with the configuration given, removing the
+// images replaced if cleanup is true.
+func upgradeSteps(cfg *daemon.Config, updates []*components.Update, cleanup bool) ([]initStep, error) {
+	var steps []initStep
+	var replaced []string
+	var running []string
+	webClients := make(map[string]webRestart)
+	for _, u := range updates {
+		c := u.Component
+		steps = append(steps, initStep{
+			name: "pull " + c.Ref(),
+			run: func() error {
+				ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+				defer cancel()
+
+				old, err := components.Upgrade(ctx, c, pullProgress(c.Ref()))
+				if old != "" {
+					replaced = append(replaced, old)
+				}
+				return err
+			},
+		})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		info, err := docker.Inspect(ctx, c.Name)
+		cancel()
+		if err == docker.ErrNotFound || (err == nil && !info.State.Running) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		if isWebClient(c) {
+			var labels map[string]string
+			if info.Config != nil {
+				labels = info.Config.Labels
+			}
+			webClients[c.Name] = webRestartOf(labels, publishedPort(info))
+			continue
+		}
+		running = append(running, c.Name)
+	}
+
+	if len(running) > 0 {
+		if cfg == nil {
+			return nil, fmt.Errorf("the daemon is not running, so the configuration of the " +
+				"containers to recreate is unknown; run srcd init to start it")
+		}
+
+		cmps, err := restartComponents(running, cfg)
+		if err != nil {
+			return nil, err
+		}
+
+		steps = append(steps, restartSteps(cfg, cmps)...)
+		for _, c := range cmps {
+			if c.Name == components.Gitbase.Name || c.Name == components.Daemon.Name {
+				continue
+			}
+
+			c := c
+			steps = append(steps, initStep{
+				name: "wait for " + c.ShortName(),
+				run:  func() error { return waitForHealthy(c) },
+				logs: containerLogs(c.Name),
+			})
+		}
+	}
+
+	for _, c := range []components.Component{components.GitbaseWeb, components.BblfshWeb} {
+		w, ok := webClients[c.Name]
+		if !ok {
+			continue
+		}
+
+		c := c
+		steps = append(steps, initStep{
+			name: "restart " + c.ShortName(),
+			run:  func() error { return restartWebClient(c, w) },
+			logs: containerLogs(c.Name),
+		})
+	}
+
+	if cleanup {
+		steps = append(steps, initStep{
+			name: "remove old images",
+			run:  func() error { return removeImages(replaced) },
+		})
+	}
+
+	return steps, nil
+}
+
+func isWebClient(c components.Component) bool {
+	return c.Name == components.GitbaseWeb.Name || c.Name == components.BblfshWeb.Name
+}
+
+// publishedPort returns the first port of the container published on the
+// host, or 0 if there's none.
+func publishedPort(info *types.ContainerJSON) int {
+	for _, bindings := range info.NetworkSettings.Ports {
+		for _, b := range bindings {
+			if port, err := strconv.Atoi(b.HostPort); err == nil {
+				return port
+			}
+		}
+	}
+	return 0
+}
+
+// pullProgress returns a function logging the bytes downloaded of the image
+// every quarter of its size.
+func pullProgress(ref string) func(done, total int64) {
+	var logged int64
+	return func(done, total int64) {
+		if total == 0 {
+			return
+		}
+
+		quarter := done * 4 / total
+		if quarter > logged {
+			logged = quarter
+			logrus.Infof("%s: downloaded %s of %s", ref,
+				units.HumanSize(float64(done)), units.HumanSize(float64(total)))
+		}
+	}
+}
+
+// waitForHealthy waits until the component is running and its health check,
+// if it has one, passes.
+func waitForHealthy(c components.Component) error {
+	deadline := time.Now().Add(healthyTimeout)
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		s, err := components.GetStatus(ctx, c, false)
+		cancel()
+		if err != nil {
+			return err
+		}
+
+		if s.Healthy() {
+			return nil
+		}
+		logrus.Debugf("%s not healthy yet: %s", c.ShortName(), stateOf(s))
+
+		if s.State != components.StateRunning || s.Health == types.Unhealthy {
+			return fmt.Errorf("%s is %s", c.ShortName(), stateOf(s))
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%s not healthy after %s", c.ShortName(), healthyTimeout)
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+func stateOf(s *components.Status) string {
+	if s.State == components.StateRunning {
+		return s.Health
+	}
+	return s.State
+}
+
+// webRestart is how a web client running was started, to start it again the
+// same way.
+type webRestart struct {
+	port int
+	// bind is the address of the host it's published on, the loopback if
+	// it's empty.
+	bind string
+	// tls and auth are whether it's served over HTTPS and with a token.
+	tls  bool
+	auth bool
+	// base is the path it's served under behind a reverse proxy, empty for
+	// the root.
+	base string
+}
+
+// webRestartOf returns how the web client with the container with the given
+// labels was started, at the port of its labels or, without one, at the one
+// it's published on.
+func webRestartOf(labels map[string]string, published int) webRestart {
+	w := webRestart{
+		port: published,
+		bind: labels[components.WebBindLabel],
+		tls:  labels[components.WebTLSLabel] != "",
+		auth: labels[components.WebAuthLabel] != "",
+		base: labels[components.WebBasePathLabel],
+	}
+	if port, err := strconv.Atoi(labels[components.WebPortLabel]); err == nil && port > 0 {
+		w.port = port
+	}
+	return w
+}
+
+// restartWebClient stops the web client and starts it again as it was.
+func restartWebClient(c components.Component, w webRestart) error {
+	if err := stopComponent(c, c.GracePeriod()); err != nil && err != docker.ErrNotFound {
+		return err
+	}
+	return startWebClientAs(c, w)
+}
+
+// startWebClientAs starts the web client as given, reading its certificate
+// and token again, so they can have changed. The daemon creates it again if
+// it was started another way.
+func startWebClientAs(c components.Component, w webRestart) error {
+	creds := &webTLS{}
+	if w.tls {
+		var err error
+		if creds, err = loadWebTLS(w.bind); err != nil {
+			return err
+		}
+	}
+
+	var token string
+	if w.auth {
+		var err error
+		if token, err = webToken(false); err != nil {
+			return err
+		}
+	}
+
+	client, err := daemon.Client()
+	if err != nil {
+		return fmt.Errorf("could not get daemon client: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+	_, err = client.StartComponent(ctx, &api.StartComponentRequest{
+		Name:        c.Name,
+		Port:        int32(w.port),
+		BindAddress: w.bind,
+		TlsCert:     creds.cert,
+		TlsKey:      creds.key,
+		WebToken:    token,
+		WebBasePath: w.base,
+	})
+	return err
+}
+
+// removeImages removes the images with the given ids. The ones that can't be
+// removed, because they are used by other containers, are kept with a
+// warning.
+func removeImages(ids []string) error {
+	for _, id := range ids {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		err := docker.RemoveImage(ctx, id)
+		cancel()
+		if err != nil {
+			logrus.Warnf("could not remove image %s: %v", id, err)
+		}
+	}
+	return nil
+}
+
+func init() {
+	componentsCmd.AddCommand(componentsUpgradeCmd)
+
+	flags := componentsUpgradeCmd.Flags()
+	flags.Bool("all", false, "upgrade all the components")
+	flags.Bool("allow-pinned", false, "upgrade pinned components too, like pilosa or the ones whose version is pinned")
+	flags.Bool("cleanup", false, "remove the images replaced")
+	flags.String("to", "", "version to upgrade pilosa to, like v1.2.0, or default for the one of the engine")
+	flags.Bool("backup-first", false, "with --to, back up the indexes of pilosa to a tar in the data directory first")
+	flags.Bool("reset-indexes", false, "with --to, remove the indexes of pilosa and gitbase, to create them again later")
+	flags.Bool("dry-run", false, "print the updates available without upgrading anything")
+	flags.BoolP("yes", "y", false, "upgrade without asking for confirmation")
+	addOutputFlags(componentsUpgradeCmd, false)
+}
@@ -0,0 +1,436 @@
+package cmd
+
+import (
+	"archive/tar"
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/src-d/engine/cmd/srcd/daemon"
+	"github.com/src-d/engine/components"
+	"github.com/src-d/engine/docker"
+)
+
+// pilosaUpgrade is an upgrade of pilosa to another version with --to, which
+// changes how its indexes are kept on disk.
+type pilosaUpgrade struct {
+	from    string
+	version string
+	// indexes are the directories with the data of pilosa that has some.
+	indexes []string
+	// metadata are the directories with the metadata of the indexes of
+	// gitbase.
+	metadata []string
+	backup   string
+	reset    bool
+}
+
+// upgradePilosa upgrades pilosa to the version given with --to, refusing to
+// do it while it has indexes unless they are backed up or reset.
+func upgradePilosa(cmd *cobra.Command, args []string, version string) error {
+	if len(args) != 1 {
+		return usageErrorf("--to can only be given with pilosa")
+	}
+
+	c, ok := components.ByName(args[0])
+	switch {
+	case !ok:
+		return usageErrorf("unknown component %s", args[0])
+	case c.Name != components.Pilosa.Name && isPinnable(c):
+		return usageErrorf("--to is only for pilosa; pin the version of %s with srcd init --%s-version %s",
+			c.ShortName(), c.ShortName(), version)
+	case c.Name != components.Pilosa.Name:
+		return usageErrorf("--to is only for pilosa")
+	}
+
+	if version == versionDefault {
+		version = c.ValidatedVersions()[0]
+	}
+
+	if !versionRegexp.MatchString(version) {
+		return usageErrorf("invalid value of --to %q: it must be the tag of an image, like v1.2.0", version)
+	}
+
+	if version == c.Tag() {
+		logrus.Infof("pilosa is already at version %s", version)
+		return nil
+	}
+
+	if !c.Validated(version) {
+		logrus.Warnf("the engine is only tested with pilosa %s; gitbase may not work with %s",
+			strings.Join(c.ValidatedVersions(), ", "), version)
+	}
+
+	if err := checkPublishedVersion(c, version); err != nil {
+		return err
+	}
+
+	cfg, err := daemon.Running()
+	if err != nil {
+		return err
+	}
+
+	datadir := daemon.DataDir
+	if cfg != nil {
+		datadir = cfg.DataDir
+	}
+	if datadir, err = daemon.ResolveDataDir(datadir); err != nil {
+		return err
+	}
+
+	u := &pilosaUpgrade{from: c.Tag(), version: version}
+	u.reset, _ = cmd.Flags().GetBool("reset-indexes")
+	if u.metadata, u.indexes, err = indexDirectories(datadir); err != nil {
+		return err
+	}
+
+	backup, _ := cmd.Flags().GetBool("backup-first")
+	switch {
+	case len(u.indexes) == 0:
+		logrus.Infof("pilosa has no indexes, nothing to back up or reset")
+		u.reset = false
+	case !backup && !u.reset:
+		return usageErrorf("pilosa has indexes in %s, which pilosa %s may not read and gitbase may fail with; "+
+			"give --backup-first to back them up to a tar first, --reset-indexes to remove them "+
+			"and create them again later with srcd sql index create, or both",
+			strings.Join(u.indexes, ", "), version)
+	case backup:
+		u.backup = filepath.Join(datadir, "backups",
+			fmt.Sprintf("pilosa-%s-%s.tar", u.from, time.Now().Format("20060102-150405")))
+	}
+
+	if dryRun, _ := cmd.Flags().GetBool("dry-run"); dryRun {
+		logrus.Infof("pilosa would be upgraded from %s to %s", u.from, version)
+		return nil
+	}
+
+	if yes, _ := cmd.Flags().GetBool("yes"); !yes {
+		if !isTerminal(os.Stdin) {
+			return usageErrorf("use --yes to upgrade pilosa without confirmation")
+		}
+
+		question := fmt.Sprintf("upgrade pilosa from %s to %s?", u.from, version)
+		if u.reset {
+			question = fmt.Sprintf("upgrade pilosa from %s to %s, removing its indexes?", u.from, version)
+		}
+		if !askYesNo(bufio.NewReader(os.Stdin), os.Stderr, question) {
+			return nil
+		}
+	}
+
+	reporter := commandStepReporter()
+	if r, ok := reporter.(*ttyStepReporter); ok {
+		logrus.SetOutput(r)
+		defer logrus.SetOutput(os.Stderr)
+	}
+
+	if err := runSteps(reporter, pilosaUpgradeSteps(cfg, u)); err != nil {
+		return err
+	}
+
+	if u.backup != "" {
+		logrus.Infof("the indexes of pilosa %s are backed up in %s", u.from, u.backup)
+	}
+	if u.reset {
+		logrus.Infof("the indexes were removed, create them again with srcd sql index create")
+	}
+	return nil
+}
+
+// indexDirectories returns the directories with the metadata of the indexes
+// of gitbase, and the ones with the data of pilosa that has some.
+func indexDirectories(datadir string) (metadata, indexes []string, err error) {
+	metadata, dirs, err := daemon.IndexDirectories(datadir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, dir := range dirs {
+		ok, err := hasPilosaIndexes(dir)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if ok {
+			indexes = append(indexes, dir)
+		}
+	}
+	return metadata, indexes, nil
+}
+
+// hasPilosaIndexes reports whether the data directory of pilosa has indexes,
+// which are its directories. The files, like .id, are created when it starts.
+func hasPilosaIndexes(dir string) (bool, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return false, fmt.Errorf("could not read the data directory of pilosa: %v", err)
+	}
+
+	for _, e := range entries {
+		if e.IsDir() && !strings.HasPrefix(e.Name(), ".") {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// pilosaUpgradeSteps returns the steps to stop pilosa, back up or reset its
+// indexes, pin its new version and start it again, along with the daemon.
+// With the indexes reset, gitbase is restarted too, without their metadata,
+// so it doesn't look for them in pilosa.
+func pilosaUpgradeSteps(cfg *daemon.Config, u *pilosaUpgrade) []initStep {
+	stopped := []components.Component{components.Daemon, components.Pilosa}
+	if u.reset {
+		stopped = append(stopped, components.Gitbase)
+	}
+
+	var steps []initStep
+	for _, c := range stopped {
+		c := c
+		steps = append(steps, initStep{
+			name: "stop " + c.ShortName(),
+			run: func() error {
+				err := stopComponent(c, gracePeriod(c))
+				if err == docker.ErrNotFound {
+					return nil
+				}
+				return err
+			},
+		})
+	}
+
+	if u.backup != "" {
+		steps = append(steps, initStep{
+			name: "back up the indexes of pilosa",
+			run:  func() error { return backupDirectories(u.backup, u.indexes, copyFromDirectory) },
+		})
+	}
+
+	if u.reset {
+		steps = append(steps, initStep{
+			name: "remove the indexes",
+			run: func() error {
+				// Written by the containers, they may only be removable by
+				// root, so they are emptied by a container too.
+				for _, dir := range append(u.indexes, u.metadata...) {
+					if err := docker.EmptyDirectory(context.Background(), dir, components.Daemon.Ref()); err != nil {
+						return fmt.Errorf("could not remove %s: %v", dir, err)
+					}
+				}
+				return nil
+			},
+		})
+	}
+
+	steps = append(steps, initStep{
+		name: "pin pilosa to " + u.version,
+		run:  func() error { return pinPilosa(u.version) },
+	})
+
+	if cfg == nil {
+		return steps
+	}
+
+	newCfg := *cfg
+	steps = append(steps, initStep{
+		name: "start daemon",
+		run: func() error {
+			newCfg.Images = components.Overrides()
+			return daemon.Start(&newCfg)
+		},
+		logs: func() ([]string, error) { return daemon.Logs(initLogLines) },
+	})
+
+	for _, c := range stopped[1:] {
+		if !cfg.Enabled(c.Name) {
+			continue
+		}
+
+		c := c
+		steps = append(steps, initStep{
+			name: "start " + c.ShortName(),
+			run:  func() error { return startComponent(c) },
+			logs: containerLogs(c.Name),
+		})
+	}
+
+	steps = append(steps, initStep{
+		name: "wait for pilosa",
+		run:  func() error { return waitForHealthy(components.Pilosa) },
+		logs: containerLogs(components.Pilosa.Name),
+	})
+	if u.reset && cfg.Enabled(components.Gitbase.Name) {
+		steps = append(steps, initStep{
+			name: "wait for gitbase",
+			run:  waitForGitbase(&newCfg),
+			logs: containerLogs(components.Gitbase.Name),
+		})
+	}
+	return steps
+}
+
+// pinPilosa records the version of pilosa in the config file, or removes it
+// if it's the default one, and uses it from then on.
+func pinPilosa(version string) error {
+	path, err := configFilePath()
+	if err != nil {
+		return err
+	}
+
+	pins, err := versionPins()
+	if err != nil {
+		return err
+	}
+
+	key := versionsKey + "." + components.Pilosa.ShortName()
+	if version == components.Pilosa.Version {
+		err = setConfigFileValue(path, key, nil)
+		delete(pins, components.Pilosa.Name)
+	} else {
+		err = setConfigFileValue(path, key, version)
+		pins[components.Pilosa.Name] = version
+	}
+	if err != nil {
+		return err
+	}
+
+	components.SetPins(pins)
+	return nil
+}
+
+// copyDirectoryFunc calls f with a tarball with the files of the directory,
+// with their paths relative to it.
+type copyDirectoryFunc func(dir string, f func(tr *tar.Reader) error) error
+
+// copyFromDirectory reads the directory through a container, as the files
+// written by pilosa and gitbase may only be readable by root.
+func copyFromDirectory(dir string, f func(tr *tar.Reader) error) error {
+	return docker.CopyFromDirectory(context.Background(), dir, components.Daemon.Ref(), f)
+}
+
+// backupDirectories writes the content of the directories, read with
+// copyDir, to a tar at path, every one of them in a directory named after it.
+func backupDirectories(path string, dirs []string, copyDir copyDirectoryFunc) (err error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("could not create the directory of the backup: %v", err)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("could not create the backup: %v", err)
+	}
+	defer func() {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(path)
+		}
+	}()
+
+	tw := tar.NewWriter(f)
+	for _, dir := range dirs {
+		if err := backupDirectory(tw, dir, copyDir); err != nil {
+			return fmt.Errorf("could not back up %s: %v", dir, err)
+		}
+	}
+	return tw.Close()
+}
+
+// backupDirectory writes the directory and its files, read with copyDir, to
+// tw in a directory named after it.
+func backupDirectory(tw *tar.Writer, dir string, copyDir copyDirectoryFunc) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+
+	hdr, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+
+	prefix := filepath.Base(dir)
+	hdr.Name = prefix + "/"
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+
+	return copyDir(dir, func(tr *tar.Reader) error {
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				return nil
+			} else if err != nil {
+				return err
+			}
+
+			// The directory itself is already written.
+			if path.Clean(hdr.Name) == "." {
+				continue
+			}
+
+			hdr.Name = path.Join(prefix, hdr.Name)
+			if hdr.Typeflag == tar.TypeDir {
+				hdr.Name += "/"
+			}
+
+			if err := tw.WriteHeader(hdr); err != nil {
+				return err
+			}
+			if _, err := io.Copy(tw, tr); err != nil {
+				return err
+			}
+		}
+	})
+}
+
+// tarDirectory writes the files of the directory to tw, with their paths
+// relative to it in prefix.
+func tarDirectory(tw *tar.Writer, dir, prefix string) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		hdr, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(filepath.Join(prefix, rel))
+		if info.IsDir() {
+			hdr.Name += "/"
+		}
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		content, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer content.Close()
+
+		_, err = io.Copy(tw, content)
+		return err
+	})
+}
@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestHasPilosaIndexes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "srcd-pilosa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := ioutil.WriteFile(filepath.Join(dir, ".id"), []byte("node"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ok, err := hasPilosaIndexes(dir)
+	if err != nil || ok {
+		t.Errorf("expected: no indexes, got: %t %v", ok, err)
+	}
+
+	if err := os.Mkdir(filepath.Join(dir, "files"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	ok, err = hasPilosaIndexes(dir)
+	if err != nil || !ok {
+		t.Errorf("expected: indexes, got: %t %v", ok, err)
+	}
+
+	if _, err := hasPilosaIndexes(filepath.Join(dir, "missing")); err == nil {
+		t.Errorf("expected an error for a missing directory")
+	}
+}
+
+func TestBackupDirectories(t *testing.T) {
+	dir, err := ioutil.TempDir("", "srcd-pilosa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	data := filepath.Join(dir, "pilosa", "0a1b")
+	if err := os.MkdirAll(filepath.Join(data, "files"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(data, "files", "0"), []byte("fragment"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "backups", "pilosa.tar")
+	if err := backupDirectories(path, []string{data}, copyLocalDirectory); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var names []string
+	var content string
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+
+		names = append(names, hdr.Name)
+		if hdr.Name == "0a1b/files/0" {
+			b, _ := ioutil.ReadAll(tr)
+			content = string(b)
+		}
+	}
+
+	sort.Strings(names)
+	expected := "0a1b/ 0a1b/files/ 0a1b/files/0"
+	if got := strings.Join(names, " "); got != expected {
+		t.Errorf("expected: %s, got: %s", expected, got)
+	}
+	if content != "fragment" {
+		t.Errorf("expected: fragment, got: %s", content)
+	}
+}
+
+// copyLocalDirectory reads the directory from the host instead of through a
+// container.
+func copyLocalDirectory(dir string, f func(tr *tar.Reader) error) error {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	if err := tarDirectory(tw, dir, ""); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return f(tar.NewReader(&buf))
+}
@@ -0,0 +1,155 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/src-d/engine/components"
+)
+
+func TestSelectUpdates(t *testing.T) {
+	updates := []*components.Update{
+		{Component: components.Gitbase, Local: "sha256:a", Remote: "sha256:b"},
+		{Component: components.Bblfshd, Local: "sha256:c", Remote: "sha256:c"},
+		{Component: components.Pilosa, Local: "sha256:d", Remote: "sha256:e"},
+		{Component: components.GitbaseWeb, Remote: "sha256:f"},
+	}
+
+	testCases := []struct {
+		name        string
+		allowPinned bool
+		selected    []string
+		skipped     []string
+	}{
+		{"pinned skipped", false, []string{"gitbase"}, []string{"pilosa"}},
+		{"pinned allowed", true, []string{"gitbase", "pilosa"}, nil},
+	}
+
+	names := func(updates []*components.Update) []string {
+		var result []string
+		for _, u := range updates {
+			result = append(result, u.Component.ShortName())
+		}
+		return result
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			selected, skipped := selectUpdates(updates, tc.allowPinned)
+			if got := names(selected); strings.Join(got, ",") != strings.Join(tc.selected, ",") {
+				t.Errorf("expected selected: %v, got: %v", tc.selected, got)
+			}
+			if got := names(skipped); strings.Join(got, ",") != strings.Join(tc.skipped, ",") {
+				t.Errorf("expected skipped: %v, got: %v", tc.skipped, got)
+			}
+		})
+	}
+}
+
+func TestSelectUpdatesPinnedVersion(t *testing.T) {
+	components.SetPins(map[string]string{components.Gitbase.Name: "v0.24.0"})
+	defer components.SetPins(nil)
+
+	updates := []*components.Update{
+		{Component: components.Gitbase, Local: "sha256:a", Remote: "sha256:b"},
+		{Component: components.GitbaseWeb, Local: "sha256:c", Remote: "sha256:d"},
+	}
+
+	selected, skipped := selectUpdates(updates, false)
+	if len(selected) != 1 || selected[0].Component.Name != components.GitbaseWeb.Name {
+		t.Errorf("expected selected: gitbase-web, got: %v", selected)
+	}
+	if len(skipped) != 1 || skipped[0].Component.Name != components.Gitbase.Name {
+		t.Errorf("expected skipped: gitbase, got: %v", skipped)
+	}
+
+	if selected, _ := selectUpdates(updates, true); len(selected) != 2 {
+		t.Errorf("expected 2 selected with --allow-pinned, got: %d", len(selected))
+	}
+}
+
+func TestUpgradeCandidates(t *testing.T) {
+	testCases := []struct {
+		name     string
+		names    []string
+		all      bool
+		expected int
+		err      bool
+	}{
+		{"one", []string{"gitbase"}, false, 1, false},
+		{"all", nil, true, len(components.All) + 1, false},
+		{"none", nil, false, 0, true},
+		{"both", []string{"gitbase"}, true, 0, true},
+		{"unknown", []string{"spark"}, false, 0, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cmps, err := upgradeCandidates(tc.names, tc.all)
+			if tc.err {
+				if err == nil {
+					t.Errorf("expected error, got: %v", cmps)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if len(cmps) != tc.expected {
+				t.Errorf("expected: %d components, got: %d", tc.expected, len(cmps))
+			}
+		})
+	}
+}
+
+func TestShortDigest(t *testing.T) {
+	testCases := []struct {
+		digest   string
+		expected string
+	}{
+		{"", "-"},
+		{"sha256:0123456789abcdef0123", "0123456789ab"},
+		{"sha256:0123", "0123"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.digest, func(t *testing.T) {
+			if got := shortDigest(tc.digest); got != tc.expected {
+				t.Errorf("expected: %s, got: %s", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestWebRestartOf(t *testing.T) {
+	testCases := []struct {
+		name      string
+		labels    map[string]string
+		published int
+		expected  webRestart
+	}{
+		{"old container", nil, 8080, webRestart{port: 8080}},
+		{"labels", map[string]string{
+			components.WebPortLabel:     "8088",
+			components.WebBindLabel:     "0.0.0.0",
+			components.WebTLSLabel:      "ab12",
+			components.WebAuthLabel:     "cd34",
+			components.WebBasePathLabel: "/engine/sql",
+		}, 0, webRestart{port: 8088, bind: "0.0.0.0", tls: true, auth: true, base: "/engine/sql"}},
+		{"port chosen by docker", map[string]string{
+			components.WebPortLabel: "",
+			components.WebBindLabel: "127.0.0.1",
+		}, 32768, webRestart{port: 32768, bind: "127.0.0.1"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := webRestartOf(tc.labels, tc.published)
+			if got != tc.expected {
+				t.Errorf("expected: %+v, got: %+v", tc.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,183 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/src-d/engine/cmd/srcd/daemon"
+	"github.com/src-d/engine/components"
+	"github.com/src-d/engine/docker"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// composeHeader is written at the top of the compose files exported.
+const composeHeader = `# Exported by srcd compose export. Stop the engine with srcd stop first, as
+# the containers have the same names, then run:
+#
+#   docker-compose --compatibility up -d
+#
+# --compatibility applies the limits of memory and CPUs. The values of the
+# variables are in the .env next to this file. The drivers of bblfshd are kept
+# in its volume; if it's a new one, install them with:
+#
+#   docker-compose exec bblfshd bblfshctl driver install --recommended
+`
+
+var composeCmd = &cobra.Command{
+	Use:   "compose",
+	Short: "Export how the engine runs its components to docker-compose",
+}
+
+var composeExportCmd = &cobra.Command{
+	Use:   "export [component...]",
+	Short: "Write a docker-compose file running the components as the engine does",
+	Long: `Write a docker-compose file running the components as the engine does
+
+The containers of the components running, or of the ones given along with the
+ones they require, are written as the services of a compose file: their exact
+images, environment, mounts, ports, networks, volumes, health checks and
+limits. The daemon is left out, so docker-compose up runs them without it.
+
+The paths of the host are replaced with variables, SRCD_WORKDIR and
+SRCD_DATA_DIR for the working and data directories, and the password of
+gitbase with SRCD_GITBASE_PASSWORD, with their values written to a .env next
+to the compose file. Nothing is overwritten unless --force is given.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := daemon.Running()
+		if err != nil {
+			return err
+		}
+		if cfg == nil {
+			return notRunningErrorf("the daemon is not running; run srcd init first")
+		}
+
+		cmps, err := exportComponents(cfg, args, docker.IsRunning)
+		if err != nil {
+			return err
+		}
+
+		datadir, err := daemon.ResolveDataDir(cfg.DataDir)
+		if err != nil {
+			return err
+		}
+
+		output, _ := cmd.Flags().GetString("output")
+		envPath := filepath.Join(filepath.Dir(output), ".env")
+		if force, _ := cmd.Flags().GetBool("force"); !force {
+			for _, path := range []string{output, envPath} {
+				if _, err := os.Stat(path); err == nil {
+					return usageErrorf("%s already exists; give --force to overwrite it", path)
+				}
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		compose, err := components.ExportCompose(ctx, cmps, []components.ComposeVariable{
+			{Name: "SRCD_WORKDIR", Value: cfg.Workdir},
+			{Name: "SRCD_DATA_DIR", Value: datadir},
+		})
+		if err != nil {
+			return err
+		}
+
+		content, err := yaml.Marshal(compose.File)
+		if err != nil {
+			return fmt.Errorf("could not encode the compose file: %v", err)
+		}
+
+		if err := ioutil.WriteFile(output, append([]byte(composeHeader+"\n"), content...), 0644); err != nil {
+			return fmt.Errorf("could not write the compose file: %v", err)
+		}
+
+		// The .env can have the password of gitbase.
+		if err := ioutil.WriteFile(envPath, composeEnv(compose.Variables), 0600); err != nil {
+			return fmt.Errorf("could not write the variables of the compose file: %v", err)
+		}
+
+		for _, w := range compose.Warnings {
+			logrus.Warn(w)
+		}
+
+		var names []string
+		for _, c := range cmps {
+			names = append(names, c.ShortName())
+		}
+		logrus.Infof("%s exported to %s, with its variables in %s", strings.Join(names, ", "), output, envPath)
+		return nil
+	},
+}
+
+// exportComponents returns the components to export: the given ones along
+// with the ones they require, or all the enabled ones running.
+func exportComponents(cfg *daemon.Config, args []string, running func(name string) (bool, error)) ([]components.Component, error) {
+	if len(args) == 0 {
+		var cmps []components.Component
+		for _, c := range components.All {
+			if !cfg.Enabled(c.Name) {
+				continue
+			}
+
+			ok, err := running(c.Name)
+			if err != nil {
+				return nil, err
+			}
+
+			if ok {
+				cmps = append(cmps, c)
+			}
+		}
+
+		if len(cmps) == 0 {
+			return nil, notRunningErrorf("no component is running; run srcd init first")
+		}
+		return cmps, nil
+	}
+
+	var given []components.Component
+	seen := make(map[string]bool)
+	for _, name := range args {
+		c, ok := components.ByName(name)
+		switch {
+		case !ok:
+			return nil, usageErrorf("unknown component %s", name)
+		case c.Name == components.Daemon.Name:
+			return nil, usageErrorf("the daemon can't be exported, the components run without it")
+		case !cfg.Enabled(c.Name):
+			return nil, disabledErrorf(c)
+		}
+
+		if !seen[c.Name] {
+			seen[c.Name] = true
+			given = append(given, c)
+		}
+	}
+
+	return append(components.Requirements(given...), given...), nil
+}
+
+// composeEnv returns the content of the .env of a compose file with the
+// values of its variables.
+func composeEnv(vars []components.ComposeVariable) []byte {
+	var buf bytes.Buffer
+	for _, v := range vars {
+		fmt.Fprintf(&buf, "%s=%s\n", v.Name, v.Value)
+	}
+	return buf.Bytes()
+}
+
+func init() {
+	rootCmd.AddCommand(composeCmd)
+	composeCmd.AddCommand(composeExportCmd)
+	composeExportCmd.Flags().StringP("output", "o", "docker-compose.yml", "file to write the compose file to, with the .env next to it")
+	composeExportCmd.Flags().Bool("force", false, "overwrite the compose file and the .env if they exist")
+}
@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/src-d/engine/cmd/srcd/daemon"
+	"github.com/src-d/engine/components"
+)
+
+func TestExportComponents(t *testing.T) {
+	running := map[string]bool{
+		components.Bblfshd.Name: true,
+		components.Gitbase.Name: true,
+		components.Pilosa.Name:  true,
+	}
+
+	testCases := []struct {
+		name     string
+		cfg      *daemon.Config
+		args     []string
+		expected string
+		err      string
+	}{
+		{name: "running", cfg: &daemon.Config{}, expected: "bblfshd, gitbase, pilosa"},
+		{
+			name:     "running enabled",
+			cfg:      &daemon.Config{Components: []string{components.Bblfshd.Name}},
+			expected: "bblfshd",
+		},
+		{
+			name:     "given with requirements",
+			cfg:      &daemon.Config{},
+			args:     []string{"web-sql", "gitbase-web"},
+			expected: "bblfshd, gitbase, gitbase-web",
+		},
+		{name: "unknown", cfg: &daemon.Config{}, args: []string{"foo"}, err: "unknown component foo"},
+		{
+			name: "daemon",
+			cfg:  &daemon.Config{},
+			args: []string{"daemon"},
+			err:  "the daemon can't be exported, the components run without it",
+		},
+		{
+			name: "disabled",
+			cfg:  &daemon.Config{Components: []string{components.Bblfshd.Name}},
+			args: []string{"gitbase"},
+			err:  "gitbase is disabled; re-run init with --components +gitbase to enable it",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cmps, err := exportComponents(tc.cfg, tc.args, func(name string) (bool, error) {
+				return running[name], nil
+			})
+
+			var errMsg string
+			if err != nil {
+				errMsg = err.Error()
+			}
+			if errMsg != tc.err {
+				t.Fatalf("expected: %s, got: %s", tc.err, errMsg)
+			}
+
+			var names []string
+			for _, c := range cmps {
+				names = append(names, c.ShortName())
+			}
+			if result := strings.Join(names, ", "); result != tc.expected {
+				t.Errorf("expected: %s, got: %s", tc.expected, result)
+			}
+		})
+	}
+}
+
+func TestComposeEnv(t *testing.T) {
+	env := composeEnv([]components.ComposeVariable{
+		{Name: "SRCD_WORKDIR", Value: "/home/user/repos"},
+		{Name: "SRCD_GITBASE_PASSWORD", Value: "pa$s"},
+	})
+
+	expected := "SRCD_WORKDIR=/home/user/repos\nSRCD_GITBASE_PASSWORD=pa$s\n"
+	if string(env) != expected {
+		t.Errorf("expected: %s, got: %s", expected, env)
+	}
+}
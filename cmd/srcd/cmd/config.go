@@ -0,0 +1,580 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	units "github.com/docker/go-units"
+	homedir "github.com/mitchellh/go-homedir"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"github.com/src-d/engine/cmd/srcd/daemon"
+	"github.com/src-d/engine/components"
+	"github.com/src-d/engine/docker"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// envPrefix is prepended to the environment variables overriding the
+// settings, like SRCD_BBLFSH_MEMORY for bblfsh.memory.
+const envPrefix = "srcd"
+
+// configSetting is one of the settings of the config file.
+type configSetting struct {
+	key string
+	// flag overriding the setting, nil for sections.
+	flag *pflag.Flag
+	// check validates the values given in the environment or the config
+	// file, which are not parsed by the flag. It can be nil.
+	check func(string) error
+	// section settings are maps with keys chosen by the user, like the
+	// versions of the drivers pinned by language. They can only be set in
+	// the config file.
+	section bool
+	// secret settings, like tokens, are redacted by srcd config show.
+	secret bool
+}
+
+// configSettings is the schema of the config file, built from the flags bound
+// to the settings, so every new flag bound gets its environment variable and
+// is shown by srcd config show. Keys not found here are rejected, so typos
+// don't go unnoticed.
+var configSettings []configSetting
+
+// bindConfig makes flag override the setting with the given key. The values
+// of the setting given in the environment or the config file are validated
+// with the type of the flag and the given check, if any.
+func bindConfig(key string, flag *pflag.Flag, check ...func(string) error) {
+	s := configSetting{key: key, flag: flag}
+	if len(check) > 0 {
+		s.check = check[0]
+	}
+
+	configSettings = append(configSettings, s)
+	viper.BindPFlag(key, flag)
+}
+
+// bindSecretConfig binds a setting whose value is redacted when shown.
+func bindSecretConfig(key string, flag *pflag.Flag) {
+	bindConfig(key, flag)
+	configSettings[len(configSettings)-1].secret = true
+}
+
+// addConfigSection adds a section to the config file. See configSetting.
+func addConfigSection(key string) {
+	configSettings = append(configSettings, configSetting{key: key, section: true})
+}
+
+// configValues are the values read from the config file, nil if there's none.
+var configValues map[string]interface{}
+
+// defaultConfigFile returns the path of the config file used if none is given
+// with --config, ~/.srcd/config.yml. The old ~/.srcd.yaml is still read if
+// it's the only one found.
+func defaultConfigFile() (string, error) {
+	home, err := homedir.Dir()
+	if err != nil {
+		return "", errors.Wrap(err, "unable to get home dir")
+	}
+
+	path := filepath.Join(home, ".srcd", "config.yml")
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+
+	legacy := filepath.Join(home, ".srcd.yaml")
+	if _, err := os.Stat(legacy); err == nil {
+		logrus.Warnf("%s is deprecated, move it to %s", legacy, path)
+		return legacy, nil
+	}
+
+	return path, nil
+}
+
+// readConfigFile reads the config file at path. It's not an error if it
+// doesn't exist, unless required is true.
+func readConfigFile(path string, required bool) error {
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) && !required {
+		return nil
+	} else if err != nil {
+		return errors.Wrap(err, "could not read config file")
+	}
+
+	values := make(map[string]interface{})
+	if err := yaml.Unmarshal(content, &values); err != nil {
+		return errors.Wrapf(err, "invalid config file %s", path)
+	}
+
+	if unknown := unknownConfigKeys(values, ""); len(unknown) > 0 {
+		return fmt.Errorf("unknown settings in config file %s: %s",
+			path, strings.Join(unknown, ", "))
+	}
+
+	viper.SetConfigFile(path)
+	if err := viper.ReadInConfig(); err != nil {
+		return errors.Wrapf(err, "invalid config file %s", path)
+	}
+
+	configValues = values
+	return nil
+}
+
+// configFilePath returns the path of the config file, the one given with
+// --config or the default one, even if it doesn't exist.
+func configFilePath() (string, error) {
+	if cfgFile != "" {
+		return cfgFile, nil
+	}
+	return defaultConfigFile()
+}
+
+// setConfigFileValue sets the setting with the given key, like
+// components.images.gitbase, in the config file at path, which is created if
+// it doesn't exist. A nil value removes it, along with the sections left
+// empty. The order of the rest of the settings is kept, their comments are
+// not.
+func setConfigFileValue(path, key string, value interface{}) error {
+	var values yaml.MapSlice
+	content, err := ioutil.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return errors.Wrap(err, "could not read config file")
+	default:
+		if err := yaml.Unmarshal(content, &values); err != nil {
+			return errors.Wrapf(err, "invalid config file %s", path)
+		}
+	}
+
+	content, err = yaml.Marshal(setMapValue(values, strings.Split(key, "."), value))
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return errors.Wrap(err, "could not create config file")
+	}
+
+	if err := ioutil.WriteFile(path, content, 0644); err != nil {
+		return errors.Wrap(err, "could not write config file")
+	}
+	return nil
+}
+
+// setMapValue sets the value nested under the given keys, found case
+// insensitively as when the config file is read, or removes it if it's nil.
+func setMapValue(values yaml.MapSlice, keys []string, value interface{}) yaml.MapSlice {
+	for i, item := range values {
+		if !strings.EqualFold(fmt.Sprint(item.Key), keys[0]) {
+			continue
+		}
+
+		if len(keys) > 1 {
+			nested, _ := item.Value.(yaml.MapSlice)
+			value = setMapValue(nested, keys[1:], value)
+			if len(value.(yaml.MapSlice)) == 0 {
+				value = nil
+			}
+		}
+
+		if value == nil {
+			return append(values[:i:i], values[i+1:]...)
+		}
+		values[i].Value = value
+		return values
+	}
+
+	if value == nil {
+		return values
+	}
+
+	for i := len(keys) - 1; i > 0; i-- {
+		value = yaml.MapSlice{{Key: keys[i], Value: value}}
+	}
+	return append(values, yaml.MapItem{Key: keys[0], Value: value})
+}
+
+// unknownConfigKeys returns the keys of the values, nested under prefix, that
+// are not in the schema, sorted.
+func unknownConfigKeys(values map[string]interface{}, prefix string) []string {
+	var unknown []string
+	for k, v := range values {
+		key := strings.ToLower(prefix + k)
+		s, ok := findSetting(key)
+		switch {
+		case ok && (s.key == key || s.section):
+			continue
+		case ok:
+			if m, ok := toStringMap(v); ok {
+				unknown = append(unknown, unknownConfigKeys(m, key+".")...)
+				continue
+			}
+		}
+
+		unknown = append(unknown, key)
+	}
+
+	sort.Strings(unknown)
+	return unknown
+}
+
+// findSetting returns the setting with the given key, a section containing
+// it, or the first one nested under it.
+func findSetting(key string) (configSetting, bool) {
+	for _, s := range configSettings {
+		if s.key == key || strings.HasPrefix(s.key, key+".") ||
+			(s.section && strings.HasPrefix(key, s.key+".")) {
+			return s, true
+		}
+	}
+	return configSetting{}, false
+}
+
+// toStringMap converts the maps decoded from YAML, which can have keys of any
+// type.
+func toStringMap(v interface{}) (map[string]interface{}, bool) {
+	switch m := v.(type) {
+	case map[string]interface{}:
+		return m, true
+	case map[interface{}]interface{}:
+		result := make(map[string]interface{}, len(m))
+		for k, v := range m {
+			result[fmt.Sprint(k)] = v
+		}
+		return result, true
+	default:
+		return nil, false
+	}
+}
+
+// inConfigFile reports whether the setting with the given key is in the
+// config file.
+func inConfigFile(key string) bool {
+	values := configValues
+	parts := strings.Split(key, ".")
+	for i, part := range parts {
+		var found bool
+		for k, v := range values {
+			if strings.ToLower(k) != part {
+				continue
+			}
+
+			if i == len(parts)-1 {
+				return true
+			}
+
+			values, found = toStringMap(v)
+			break
+		}
+
+		if !found {
+			return false
+		}
+	}
+	return false
+}
+
+// envVar returns the environment variable overriding the setting.
+func envVar(key string) string {
+	r := strings.NewReplacer(".", "_", "-", "_")
+	return strings.ToUpper(r.Replace(envPrefix + "_" + key))
+}
+
+// stringSliceSetting returns a list setting. Items can be separated by commas
+// or spaces, so lists are easy to give in environment variables.
+func stringSliceSetting(key string) []string {
+	var result []string
+	for _, item := range viper.GetStringSlice(key) {
+		for _, s := range strings.Split(item, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				result = append(result, s)
+			}
+		}
+	}
+	return result
+}
+
+// checkSettings validates the values of the settings given in the
+// environment or the config file, naming the variable or key of the invalid
+// ones.
+func checkSettings() error {
+	for _, s := range configSettings {
+		if s.section {
+			continue
+		}
+
+		if env := envVar(s.key); os.Getenv(env) != "" {
+			value := os.Getenv(env)
+			if err := checkSettingValue(s, value); err != nil {
+				return fmt.Errorf("invalid value %q of %s: %v", value, env, err)
+			}
+			continue
+		}
+
+		if inConfigFile(s.key) {
+			value := viper.GetString(s.key)
+			if err := checkSettingValue(s, value); err != nil {
+				return fmt.Errorf("invalid value %q of %s in config file %s: %v",
+					value, s.key, viper.ConfigFileUsed(), err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func checkSettingValue(s configSetting, value string) error {
+	var err error
+	switch s.flag.Value.Type() {
+	case "int":
+		_, err = strconv.Atoi(value)
+	case "uint":
+		_, err = strconv.ParseUint(value, 10, 0)
+	case "bool":
+		_, err = strconv.ParseBool(value)
+	case "duration":
+		_, err = time.ParseDuration(value)
+	}
+
+	if err != nil {
+		return fmt.Errorf("it must be a %s", s.flag.Value.Type())
+	}
+
+	if s.check != nil {
+		return s.check(value)
+	}
+	return nil
+}
+
+// checkSize validates sizes like 512m or 2g.
+func checkSize(value string) error {
+	if value == "" {
+		return nil
+	}
+
+	_, err := units.RAMInBytes(value)
+	return err
+}
+
+// checkOnOff validates the settings that are on or off.
+func checkOnOff(value string) error {
+	if value != "on" && value != "off" {
+		return fmt.Errorf("it must be on or off")
+	}
+	return nil
+}
+
+// checkPort validates port numbers.
+func checkPort(value string) error {
+	port, err := strconv.Atoi(value)
+	if err != nil || port < 1 || port > 65535 {
+		return fmt.Errorf("it must be a port between 1 and 65535")
+	}
+	return nil
+}
+
+// checkOptionalPort validates port numbers that can be 0 to choose one.
+func checkOptionalPort(value string) error {
+	if value == "0" {
+		return nil
+	}
+
+	if err := checkPort(value); err != nil {
+		return fmt.Errorf("it must be a port between 1 and 65535, or 0 to choose one")
+	}
+	return nil
+}
+
+// checkMetricsAddress validates the addresses of the metrics of the daemon.
+func checkMetricsAddress(value string) error {
+	_, err := daemon.ParseMetricsAddress(value)
+	return err
+}
+
+// checkProxy validates the proxy of the HTTP clients of the engine.
+func checkProxy(value string) error {
+	if value == "" {
+		return nil
+	}
+
+	_, err := docker.ParseProxy(value)
+	return err
+}
+
+// checkRegistryMirror validates the registry mirror of the images.
+func checkRegistryMirror(value string) error {
+	if value == "" {
+		return nil
+	}
+
+	_, err := docker.ParseMirror(value)
+	return err
+}
+
+// checkPlatforms validates the platforms forced for the images.
+func checkPlatforms(value string) error {
+	_, err := components.ParsePlatforms(strings.Split(value, ","))
+	return err
+}
+
+// checkLogLevel validates the levels of the logs of the daemon.
+func checkLogLevel(value string) error {
+	if value == "" {
+		return nil
+	}
+
+	_, err := logrus.ParseLevel(value)
+	return err
+}
+
+// checkLogFormat validates the formats of the logs of the daemon.
+func checkLogFormat(value string) error {
+	if value != "text" && value != "json" {
+		return fmt.Errorf("it must be text or json")
+	}
+	return nil
+}
+
+// minHealthInterval is the shortest interval the daemon can probe the
+// components with, so the probes don't load them.
+const minHealthInterval = time.Second
+
+// checkHealthInterval validates the intervals of the probes of the health
+// checks of the daemon.
+func checkHealthInterval(value string) error {
+	d, err := time.ParseDuration(value)
+	if err != nil || d < minHealthInterval {
+		return fmt.Errorf("it must be at least %s", minHealthInterval)
+	}
+	return nil
+}
+
+// checkPositiveDuration validates durations that must be positive.
+func checkPositiveDuration(value string) error {
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return fmt.Errorf("it must be positive")
+	}
+	return nil
+}
+
+// checkNotNegative validates numbers that can't be negative.
+func checkNotNegative(value string) error {
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return fmt.Errorf("it can't be negative")
+	}
+	return nil
+}
+
+// Sources of the values of the settings, from highest to lowest precedence.
+const (
+	sourceFlag       = "flag"
+	sourceEnv        = "env"
+	sourceConfigFile = "config file"
+	sourceDefault    = "default"
+)
+
+// settingSource returns where the value of the setting comes from, along
+// with the flag or environment variable setting it.
+func settingSource(s configSetting) string {
+	if s.flag != nil && s.flag.Changed {
+		return fmt.Sprintf("%s --%s", sourceFlag, s.flag.Name)
+	}
+
+	if env := envVar(s.key); !s.section && os.Getenv(env) != "" {
+		return fmt.Sprintf("%s %s", sourceEnv, env)
+	}
+
+	if inConfigFile(s.key) {
+		return sourceConfigFile
+	}
+	return sourceDefault
+}
+
+// settingValue formats the value of a setting to be printed.
+func settingValue(v interface{}) string {
+	if m, ok := toStringMap(v); ok {
+		var pairs []string
+		for k, v := range m {
+			pairs = append(pairs, fmt.Sprintf("%s=%v", k, v))
+		}
+		sort.Strings(pairs)
+		return strings.Join(pairs, ",")
+	}
+
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case []string:
+		return strings.Join(v, ",")
+	case []interface{}:
+		var items []string
+		for _, item := range v {
+			items = append(items, fmt.Sprint(item))
+		}
+		return strings.Join(items, ",")
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Manage the configuration of the CLI",
+}
+
+var configShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Print the effective configuration",
+	Long: `Print the effective configuration
+
+Every setting is printed with its value and where it comes from, from highest
+to lowest precedence: a flag, an environment variable, the config file or the
+default.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return printConfig(os.Stdout)
+	},
+}
+
+func printConfig(w io.Writer) error {
+	file := viper.ConfigFileUsed()
+	if configValues == nil {
+		file = "none"
+	}
+	fmt.Fprintf(w, "config file: %s\n\n", file)
+
+	tw := new(tabwriter.Writer)
+	tw.Init(w, 0, 8, 5, '\t', 0)
+	fmt.Fprintln(tw, "KEY\tVALUE\tSOURCE")
+	fmt.Fprintln(tw, "----------\t----------\t----------")
+	settings := make([]configSetting, len(configSettings))
+	copy(settings, configSettings)
+	sort.Slice(settings, func(i, j int) bool { return settings[i].key < settings[j].key })
+	for _, s := range settings {
+		value := settingValue(viper.Get(s.key))
+		// Secrets are not shown, only whether they are set.
+		if s.secret && value != "" {
+			value = "[redacted]"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", s.key, orDash(value), settingSource(s))
+	}
+	return tw.Flush()
+}
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configShowCmd)
+}
@@ -0,0 +1,179 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/spf13/pflag"
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestUnknownConfigKeys(t *testing.T) {
+	testCases := []struct {
+		name     string
+		config   string
+		expected []string
+	}{
+		{"empty", ``, nil},
+		{"known", "data-dir: /data\nbblfsh:\n  memory: 2g\n", nil},
+		{"sections", "drivers:\n  python: v2.8.0\nparse:\n  map-lang:\n    .inc: php\n", nil},
+		{"case insensitive", "Bblfsh:\n  Max-Drivers: 2\n", nil},
+		{"typo", "bblfsh:\n  memroy: 2g\n", []string{"bblfsh.memroy"}},
+		{"unknown section", "port: 8080\nregistry:\n  mirror: x\n", []string{"port", "registry"}},
+		{"scalar section", "web: 8080\n", []string{"web"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			values := make(map[string]interface{})
+			if err := yaml.Unmarshal([]byte(tc.config), &values); err != nil {
+				t.Fatal(err)
+			}
+
+			unknown := unknownConfigKeys(values, "")
+			if strings.Join(unknown, ",") != strings.Join(tc.expected, ",") {
+				t.Errorf("expected: %v, got: %v", tc.expected, unknown)
+			}
+		})
+	}
+}
+
+func TestInConfigFile(t *testing.T) {
+	defer func(values map[string]interface{}) { configValues = values }(configValues)
+
+	configValues = make(map[string]interface{})
+	if err := yaml.Unmarshal([]byte("data-dir: /data\nWeb:\n  sql:\n    port: 9000\n"), &configValues); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		key      string
+		expected bool
+	}{
+		{"data-dir", true},
+		{"web.sql.port", true},
+		{"web.parse.port", false},
+		{"bblfsh.memory", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.key, func(t *testing.T) {
+			if got := inConfigFile(tc.key); got != tc.expected {
+				t.Errorf("expected: %v, got: %v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestEnvVar(t *testing.T) {
+	expected := "SRCD_BBLFSH_MAX_DRIVERS"
+	if got := envVar("bblfsh.max-drivers"); got != expected {
+		t.Errorf("expected: %s, got: %s", expected, got)
+	}
+}
+
+func TestSettingValue(t *testing.T) {
+	testCases := []struct {
+		name     string
+		value    interface{}
+		expected string
+	}{
+		{"nil", nil, ""},
+		{"int", 8080, "8080"},
+		{"strings", []string{"go", "python"}, "go,python"},
+		{"list", []interface{}{"go", 1}, "go,1"},
+		{"map", map[string]interface{}{"python": "v2.8.0", "go": "v2.5.1"}, "go=v2.5.1,python=v2.8.0"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := settingValue(tc.value); got != tc.expected {
+				t.Errorf("expected: %s, got: %s", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestCheckSettingValue(t *testing.T) {
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	flags.Uint("port", 8080, "")
+	flags.String("memory", "", "")
+	flags.Int("drivers", 0, "")
+	flags.String("mirror", "", "")
+	flags.String("platform", "", "")
+
+	testCases := []struct {
+		name  string
+		s     configSetting
+		value string
+		valid bool
+	}{
+		{"port", configSetting{flag: flags.Lookup("port"), check: checkPort}, "9000", true},
+		{"port not a number", configSetting{flag: flags.Lookup("port"), check: checkPort}, "http", false},
+		{"port out of range", configSetting{flag: flags.Lookup("port"), check: checkPort}, "70000", false},
+		{"size", configSetting{flag: flags.Lookup("memory"), check: checkSize}, "2g", true},
+		{"invalid size", configSetting{flag: flags.Lookup("memory"), check: checkSize}, "2 lots", false},
+		{"int", configSetting{flag: flags.Lookup("drivers")}, "4", true},
+		{"not an int", configSetting{flag: flags.Lookup("drivers")}, "four", false},
+		{"negative", configSetting{flag: flags.Lookup("drivers"), check: checkNotNegative}, "-1", false},
+		{"mirror", configSetting{flag: flags.Lookup("mirror"), check: checkRegistryMirror}, "registry.corp/dockerhub", true},
+		{"mirror with https", configSetting{flag: flags.Lookup("mirror"), check: checkRegistryMirror}, "https://registry.corp:5000/dockerhub/", true},
+		{"mirror without host", configSetting{flag: flags.Lookup("mirror"), check: checkRegistryMirror}, "dockerhub/srcd", false},
+		{"mirror over http", configSetting{flag: flags.Lookup("mirror"), check: checkRegistryMirror}, "http://registry.corp", false},
+		{"platform", configSetting{flag: flags.Lookup("platform"), check: checkPlatforms}, "linux/amd64", true},
+		{"platform of a component", configSetting{flag: flags.Lookup("platform"), check: checkPlatforms}, "linux/arm64,bblfshd=linux/amd64", true},
+		{"unknown platform", configSetting{flag: flags.Lookup("platform"), check: checkPlatforms}, "windows/amd64", false},
+		{"platform of unknown component", configSetting{flag: flags.Lookup("platform"), check: checkPlatforms}, "mysql=linux/amd64", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := checkSettingValue(tc.s, tc.value)
+			if tc.valid && err != nil {
+				t.Errorf("expected valid value, got: %v", err)
+			} else if !tc.valid && err == nil {
+				t.Errorf("expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestSetMapValue(t *testing.T) {
+	testCases := []struct {
+		name     string
+		config   string
+		key      string
+		value    interface{}
+		expected string
+	}{
+		{"new", "data-dir: /data\n", "components.images.gitbase", "srcd/gitbase:dev",
+			"data-dir: /data\ncomponents:\n  images:\n    gitbase: srcd/gitbase:dev\n"},
+		{"new in section", "components:\n  enabled: [gitbase]\n", "components.images.gitbase", "srcd/gitbase:dev",
+			"components:\n  enabled:\n  - gitbase\n  images:\n    gitbase: srcd/gitbase:dev\n"},
+		{"replace", "Components:\n  Images:\n    gitbase: srcd/gitbase:a\n", "components.images.gitbase", "srcd/gitbase:b",
+			"Components:\n  Images:\n    gitbase: srcd/gitbase:b\n"},
+		{"remove", "components:\n  images:\n    gitbase: srcd/gitbase:a\n    bblfshd: bblfsh/bblfshd:b\n", "components.images.gitbase", nil,
+			"components:\n  images:\n    bblfshd: bblfsh/bblfshd:b\n"},
+		{"remove empty sections", "data-dir: /data\ncomponents:\n  images:\n    gitbase: srcd/gitbase:a\n", "components.images.gitbase", nil,
+			"data-dir: /data\n"},
+		{"remove missing", "data-dir: /data\n", "components.images.gitbase", nil, "data-dir: /data\n"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var values yaml.MapSlice
+			if err := yaml.Unmarshal([]byte(tc.config), &values); err != nil {
+				t.Fatal(err)
+			}
+
+			content, err := yaml.Marshal(setMapValue(values, strings.Split(tc.key, "."), tc.value))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(content) != tc.expected {
+				t.Errorf("expected: %s, got: %s", tc.expected, content)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/src-d/engine/api"
+	"github.com/src-d/engine/cmd/srcd/daemon"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// healthCheckTimeout is how long srcd daemon health waits for the daemon.
+const healthCheckTimeout = 5 * time.Second
+
+// healthDisabled is the status of the services of the components disabled
+// on init, which the daemon doesn't know.
+const healthDisabled = "DISABLED"
+
+var daemonCmd = &cobra.Command{
+	Use:   "daemon",
+	Short: "Manage the daemon of the engine",
+}
+
+var daemonHealthCmd = &cobra.Command{
+	Use:   "health [service]",
+	Short: "Check whether the daemon and the components it depends on are ready",
+	Long: `Check whether the daemon and the components it depends on are ready
+
+Asks the running daemon, with the standard gRPC health checking protocol, for
+the status of the daemon itself and of its connectivity to gitbase, bblfshd
+and pilosa, at its status endpoint, or only of the given service. It doesn't
+start the daemon or any component. The daemon probes the components in the
+background every daemon.health-interval, so the statuses can be that old.
+
+Exits with 0 if all of them are SERVING, the components disabled on init
+aside, and with 4 if the daemon is not running or any of them is not ready
+yet. See srcd help exit-codes.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		services := api.HealthServices
+		if len(args) > 0 {
+			if !validHealthService(args[0]) {
+				return usageErrorf("unknown service %q, it must be one of %s",
+					args[0], strings.Join(api.HealthServices, ", "))
+			}
+			services = args[:1]
+		}
+
+		running, err := daemon.IsRunning()
+		if err != nil {
+			return err
+		}
+
+		if !running {
+			return notRunningErrorf("the daemon is not running; run srcd init first")
+		}
+
+		c, err := daemon.HealthClient()
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), healthCheckTimeout)
+		defer cancel()
+
+		var results []healthResult
+		for _, service := range services {
+			res, err := checkHealth(ctx, c, service)
+			if err != nil {
+				return err
+			}
+			results = append(results, res)
+		}
+
+		err = newRecordWriter(os.Stdout).write("health", results, func(w io.Writer) error {
+			return printHealth(w, results)
+		})
+		if err != nil {
+			return err
+		}
+
+		if !healthy(results) {
+			return exitStatus(exitNotRunning)
+		}
+		return nil
+	},
+}
+
+// healthResult is the status of a service of the health checks.
+type healthResult struct {
+	Service string `json:"service"`
+	Status  string `json:"status"`
+}
+
+func validHealthService(name string) bool {
+	for _, s := range api.HealthServices {
+		if s == name {
+			return true
+		}
+	}
+	return false
+}
+
+func checkHealth(ctx context.Context, c healthpb.HealthClient, service string) (healthResult, error) {
+	res, err := c.Check(ctx, &healthpb.HealthCheckRequest{Service: service})
+	switch status.Code(err) {
+	case codes.OK:
+		return healthResult{service, res.Status.String()}, nil
+	case codes.NotFound:
+		return healthResult{service, healthDisabled}, nil
+	case codes.Unimplemented:
+		return healthResult{}, fmt.Errorf("the daemon doesn't have health checks; " +
+			"run srcd init to recreate it with this version")
+	default:
+		return healthResult{}, err
+	}
+}
+
+// healthy reports whether all the services are serving, the disabled ones
+// aside.
+func healthy(results []healthResult) bool {
+	for _, r := range results {
+		if r.Status != healthDisabled && r.Status != healthpb.HealthCheckResponse_SERVING.String() {
+			return false
+		}
+	}
+	return true
+}
+
+func printHealth(w io.Writer, results []healthResult) error {
+	tw := new(tabwriter.Writer)
+	tw.Init(w, 0, 8, 5, '\t', 0)
+	fmt.Fprintln(tw, "SERVICE\tSTATUS")
+	fmt.Fprintln(tw, "----------\t----------")
+	for _, r := range results {
+		fmt.Fprintf(tw, "%s\t%s\n", r.Service, r.Status)
+	}
+	return tw.Flush()
+}
+
+func init() {
+	rootCmd.AddCommand(daemonCmd)
+	daemonCmd.AddCommand(daemonHealthCmd)
+}
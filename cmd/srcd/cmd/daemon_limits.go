@@ -0,0 +1,125 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/src-d/engine/api"
+	"github.com/src-d/engine/cmd/srcd/daemon"
+)
+
+var daemonLimitsCmd = &cobra.Command{
+	Use:   "limits",
+	Short: "Show or change the limits of the parse requests handled by the daemon",
+	Long: `Show or change the limits of the parse requests handled by the daemon
+
+Prints how many files the running daemon parses at once, how many requests
+can wait for a slot and for how long, along with the requests being parsed
+and waiting now. The requests waiting are served taking turns between the
+clients, and rejected once the queue is full or they wait for too long.
+
+The limits given with the flags are changed until the daemon is recreated,
+without restarting it.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		concurrency, _ := cmd.Flags().GetInt("parse-concurrency")
+		queue, _ := cmd.Flags().GetInt("parse-queue")
+		timeout, _ := cmd.Flags().GetDuration("parse-queue-timeout")
+		if concurrency < 0 || queue < 0 || timeout < 0 {
+			return usageErrorf("the limits can't be negative")
+		}
+
+		running, err := daemon.IsRunning()
+		if err != nil {
+			return err
+		}
+
+		if !running {
+			return notRunningErrorf("the daemon is not running; run srcd init first")
+		}
+
+		c, err := daemon.RunningClient()
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		res, err := c.SetParseLimits(ctx, &api.SetParseLimitsRequest{Limits: &api.ParseLimits{
+			Concurrency:    int32(concurrency),
+			Queue:          int32(queue),
+			QueueTimeoutMs: int64(timeout / time.Millisecond),
+		}})
+		if err != nil {
+			return err
+		}
+
+		record := newParseLimitsRecord(res)
+		return newRecordWriter(os.Stdout).write("limits", record, func(w io.Writer) error {
+			return printParseLimits(w, record)
+		})
+	},
+}
+
+// parseLimitsRecord are the limits of the parse requests of the daemon, with
+// the queue timeout in seconds.
+type parseLimitsRecord struct {
+	Concurrency  int     `json:"concurrency"`
+	Queue        int     `json:"queue"`
+	QueueTimeout float64 `json:"queue_timeout"`
+	InFlight     int     `json:"in_flight"`
+	Queued       int     `json:"queued"`
+	// Changed is whether the limits given changed any.
+	Changed bool `json:"changed"`
+}
+
+func newParseLimitsRecord(res *api.SetParseLimitsResponse) *parseLimitsRecord {
+	l := res.Limits
+	if l == nil {
+		l = &api.ParseLimits{}
+	}
+
+	return &parseLimitsRecord{
+		Concurrency:  int(l.Concurrency),
+		Queue:        int(l.Queue),
+		QueueTimeout: queueTimeout(l).Seconds(),
+		InFlight:     int(res.InFlight),
+		Queued:       int(res.Queued),
+		Changed:      res.Previous != nil && !sameParseLimits(res.Previous, l),
+	}
+}
+
+func sameParseLimits(a, b *api.ParseLimits) bool {
+	return a.Concurrency == b.Concurrency && a.Queue == b.Queue && a.QueueTimeoutMs == b.QueueTimeoutMs
+}
+
+func queueTimeout(l *api.ParseLimits) time.Duration {
+	return time.Duration(l.QueueTimeoutMs) * time.Millisecond
+}
+
+func printParseLimits(w io.Writer, r *parseLimitsRecord) error {
+	if r.Changed {
+		fmt.Fprintln(w, "the parse limits of the daemon changed")
+	}
+
+	tw := new(tabwriter.Writer)
+	tw.Init(w, 0, 8, 1, ' ', 0)
+	fmt.Fprintf(tw, "concurrency:\t%d\n", r.Concurrency)
+	fmt.Fprintf(tw, "queue:\t%d\n", r.Queue)
+	fmt.Fprintf(tw, "queue timeout:\t%s\n", time.Duration(r.QueueTimeout*float64(time.Second)))
+	fmt.Fprintf(tw, "in flight:\t%d\n", r.InFlight)
+	fmt.Fprintf(tw, "queued:\t%d\n", r.Queued)
+	return tw.Flush()
+}
+
+func init() {
+	daemonCmd.AddCommand(daemonLimitsCmd)
+	daemonLimitsCmd.Flags().Int("parse-concurrency", 0, "maximum number of files parsed at once")
+	daemonLimitsCmd.Flags().Int("parse-queue", 0, "maximum number of parse requests waiting for a slot")
+	daemonLimitsCmd.Flags().Duration("parse-queue-timeout", 0, "how long a parse request can wait for a slot")
+}
@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/src-d/engine/api"
+)
+
+func TestPrintParseLimits(t *testing.T) {
+	limits := &api.ParseLimits{Concurrency: 4, Queue: 128, QueueTimeoutMs: 30000}
+	testCases := []struct {
+		name     string
+		previous *api.ParseLimits
+		expected string
+	}{
+		{"unchanged", limits, "concurrency:   4\nqueue:         128\nqueue timeout: 30s\nin flight:     2\nqueued:        1\n"},
+		{"changed", &api.ParseLimits{Concurrency: 2, Queue: 128, QueueTimeoutMs: 30000},
+			"the parse limits of the daemon changed\nconcurrency:   4\nqueue:         128\nqueue timeout: 30s\nin flight:     2\nqueued:        1\n"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := newParseLimitsRecord(&api.SetParseLimitsResponse{
+				Limits:   limits,
+				Previous: tc.previous,
+				InFlight: 2,
+				Queued:   1,
+			})
+
+			var buf bytes.Buffer
+			if err := printParseLimits(&buf, r); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got := buf.String(); got != tc.expected {
+				t.Errorf("expected: %q, got: %q", tc.expected, got)
+			}
+		})
+	}
+}
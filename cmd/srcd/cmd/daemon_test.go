@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// fakeHealthClient returns the statuses of the services, or the error if
+// it's set.
+type fakeHealthClient struct {
+	statuses map[string]healthpb.HealthCheckResponse_ServingStatus
+	err      error
+}
+
+func (c *fakeHealthClient) Check(
+	ctx context.Context,
+	req *healthpb.HealthCheckRequest,
+	opts ...grpc.CallOption,
+) (*healthpb.HealthCheckResponse, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+
+	s, ok := c.statuses[req.Service]
+	if !ok {
+		return nil, status.Error(codes.NotFound, "unknown service")
+	}
+	return &healthpb.HealthCheckResponse{Status: s}, nil
+}
+
+func TestCheckHealth(t *testing.T) {
+	c := &fakeHealthClient{statuses: map[string]healthpb.HealthCheckResponse_ServingStatus{
+		"daemon":  healthpb.HealthCheckResponse_SERVING,
+		"bblfshd": healthpb.HealthCheckResponse_NOT_SERVING,
+	}}
+
+	testCases := []struct {
+		service  string
+		expected string
+	}{
+		{"daemon", "SERVING"},
+		{"bblfshd", "NOT_SERVING"},
+		{"gitbase", healthDisabled},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.service, func(t *testing.T) {
+			res, err := checkHealth(context.Background(), c, tc.service)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if res.Status != tc.expected {
+				t.Errorf("expected: %s, got: %s", tc.expected, res.Status)
+			}
+		})
+	}
+
+	c.err = status.Error(codes.Unimplemented, "unknown service grpc.health.v1.Health")
+	if _, err := checkHealth(context.Background(), c, "daemon"); err == nil {
+		t.Error("expected an error for a daemon without health checks")
+	}
+}
+
+func TestHealthy(t *testing.T) {
+	testCases := []struct {
+		name     string
+		results  []healthResult
+		expected bool
+	}{
+		{"serving", []healthResult{{"daemon", "SERVING"}, {"gitbase", "SERVING"}}, true},
+		{"disabled", []healthResult{{"daemon", "SERVING"}, {"gitbase", healthDisabled}}, true},
+		{"not serving", []healthResult{{"daemon", "SERVING"}, {"bblfshd", "NOT_SERVING"}}, false},
+		{"unknown", []healthResult{{"gitbase", "UNKNOWN"}}, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := healthy(tc.results); got != tc.expected {
+				t.Errorf("expected: %v, got: %v", tc.expected, got)
+			}
+		})
+	}
+}
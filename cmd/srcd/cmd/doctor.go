@@ -0,0 +1,930 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	units "github.com/docker/go-units"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/src-d/engine/api"
+	"github.com/src-d/engine/cmd/srcd/daemon"
+	"github.com/src-d/engine/components"
+	"github.com/src-d/engine/docker"
+)
+
+// Statuses of the results of the checks of srcd doctor.
+const (
+	checkPass = "PASS"
+	checkWarn = "WARN"
+	checkFail = "FAIL"
+)
+
+// checkResult is the result of one of the checks of srcd doctor.
+type checkResult struct {
+	Check   string `json:"check"`
+	Status  string `json:"status"`
+	Message string `json:"message"`
+	// Hint tells how to fix what was found, empty if the check passed.
+	Hint string `json:"hint"`
+}
+
+func pass(format string, args ...interface{}) checkResult {
+	return checkResult{Status: checkPass, Message: fmt.Sprintf(format, args...)}
+}
+
+func warn(hint, format string, args ...interface{}) checkResult {
+	return checkResult{Status: checkWarn, Message: fmt.Sprintf(format, args...), Hint: hint}
+}
+
+func fail(hint, format string, args ...interface{}) checkResult {
+	return checkResult{Status: checkFail, Message: fmt.Sprintf(format, args...), Hint: hint}
+}
+
+// doctorCheck is one of the checks of srcd doctor. They don't depend on each
+// other, except the ones that need docker, which are skipped if it can't be
+// reached. To add one, write a function returning its result from what it
+// gathers, which can be tested without docker, and add it here.
+type doctorCheck struct {
+	name        string
+	needsDocker bool
+	run         func() checkResult
+}
+
+var doctorChecks = []doctorCheck{
+	{"docker", false, func() checkResult { return checkDocker(docker.Version()) }},
+	{"security options", true, func() checkResult { return checkSecurityOptions(docker.SecurityOptions()) }},
+	{"disk space", true, runDiskSpaceCheck},
+	{"ports", true, runPortsCheck},
+	{"working directory", true, runWorkdirCheck},
+	{"topology", true, runTopologyCheck},
+	{"components", true, runComponentsCheck},
+	{"architecture", true, runArchitectureCheck},
+	{"proxy and TLS", true, runTLSCheck},
+	{"registry mirror", false, runRegistryMirrorCheck},
+	{"web clients", true, runWebClientsCheck},
+	{"pilosa", true, runPilosaCheck},
+	{"daemon version", true, runDaemonVersionCheck},
+	{"daemon endpoint", true, func() checkResult { return checkDaemonEndpoint(daemon.RunningEndpoint()) }},
+	{"daemon port", true, runDaemonPortCheck},
+	{"gitbase settings", true, func() checkResult { return checkGitbaseSettings(gitbaseSettings()) }},
+}
+
+// daemonDialTimeout is how long the check of the port of the daemon waits to
+// connect to it.
+const daemonDialTimeout = 2 * time.Second
+
+// minDockerAPIVersion is the oldest version of the API of docker the engine
+// works with, the one of docker 1.13.
+const minDockerAPIVersion = "1.25"
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check the environment the engine runs in",
+	Long: `Check the environment the engine runs in
+
+A number of checks are run to find the most common problems: docker can't be
+reached or is too old, there's not enough disk space, the ports of the engine
+are taken, the working directory can't be shared with the containers or is
+mounted slowly from the other side of WSL, whose topology is printed, the
+containers of the components are not running their images or run them
+emulated, for another architecture than the one of docker, unless given with
+--platform, and docker can't run the one given, a proxy intercepts
+TLS with a CA that's not trusted, or docker can't reach Docker Hub, the
+registry mirror doesn't serve the images of the engine, the web clients
+are published on every interface by an older version of the engine, or pilosa
+doesn't answer at its status endpoint.
+
+Every check passes (PASS), finds something that could be a problem (WARN) or
+that is one (FAIL), with a hint about how to fix it. It exits with a non-zero
+code if any check fails.
+
+With --bundle, a tarball to attach to bug reports is written too, with the
+report, the versions, the status and details of the components, the end of
+the logs of their containers, the configuration and docker info. Credentials
+are redacted from it, and with --anonymize the home directory is replaced with
+~. What can't be collected, like the logs of the components down, is listed
+in errors.txt inside it.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		bundle, _ := cmd.Flags().GetString("bundle")
+		logSize, _ := cmd.Flags().GetInt("bundle-log-size")
+		anonymize, _ := cmd.Flags().GetBool("anonymize")
+		if logSize <= 0 {
+			return usageErrorf("invalid log size %d, it must be positive", logSize)
+		}
+
+		results := runDoctorChecks(doctorChecks)
+
+		var err error
+		if asJSON, _ := cmd.Flags().GetBool("json"); asJSON {
+			err = printJSON(os.Stdout, results)
+		} else {
+			err = newRecordWriter(os.Stdout).write("check", results, func(w io.Writer) error {
+				return printCheckResults(w, results)
+			})
+		}
+		if err != nil {
+			return err
+		}
+
+		if bundle != "" {
+			if err := saveBundle(bundle, results, logSize<<10, anonymize); err != nil {
+				return err
+			}
+			logrus.Infof("diagnostics bundle written to %s", bundle)
+		}
+
+		for _, r := range results {
+			if r.Status == checkFail {
+				return exitStatus(exitError)
+			}
+		}
+		return nil
+	},
+}
+
+// runDoctorChecks runs the checks in order. The ones that need docker are
+// skipped, with a warning, if the first one, checking docker, fails.
+func runDoctorChecks(checks []doctorCheck) []checkResult {
+	var results []checkResult
+	dockerOK := true
+	for i, c := range checks {
+		var r checkResult
+		if c.needsDocker && !dockerOK {
+			r = warn("fix the problems with docker first", "skipped, docker can't be reached")
+		} else {
+			r = c.run()
+		}
+
+		if i == 0 && !c.needsDocker && r.Status == checkFail {
+			dockerOK = false
+		}
+
+		r.Check = c.name
+		results = append(results, r)
+	}
+	return results
+}
+
+func printCheckResults(w io.Writer, results []checkResult) error {
+	for _, r := range results {
+		if _, err := fmt.Fprintf(w, "%s  %s: %s\n", r.Status, r.Check, r.Message); err != nil {
+			return err
+		}
+
+		if r.Hint != "" {
+			if _, err := fmt.Fprintf(w, "      hint: %s\n", r.Hint); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkDocker checks the version of the API of docker, which can't be pinged
+// if err is not nil.
+func checkDocker(apiVersion string, err error) checkResult {
+	if err != nil {
+		return fail("make sure docker is running and DOCKER_HOST, if set, points to it",
+			"docker can't be reached: %v", err)
+	}
+
+	if compareVersions(apiVersion, minDockerAPIVersion) < 0 {
+		return fail("upgrade docker to 1.13 or newer",
+			"the API of docker is %s, older than %s", apiVersion, minDockerAPIVersion)
+	}
+	return pass("docker is reachable, with API %s", apiVersion)
+}
+
+// compareVersions compares versions like 1.25 numerically, returning -1, 0 or
+// 1 if a is older, the same or newer than b.
+func compareVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+	}
+	return 0
+}
+
+// checkSecurityOptions warns about the options of docker that can keep the
+// containers from reading the repositories.
+func checkSecurityOptions(opts []string, err error) checkResult {
+	if err != nil {
+		return warn("", "could not get the security options of docker: %v", err)
+	}
+
+	for _, opt := range opts {
+		switch {
+		case strings.Contains(opt, "name=selinux"):
+			return warn("if gitbase can't read the repositories, label them with chcon -Rt svirt_sandbox_file_t <workdir>",
+				"SELinux is enabled in docker")
+		case strings.Contains(opt, "name=userns"):
+			return warn("the repositories must be readable by anyone, as the containers run as an unprivileged user",
+				"docker runs the containers in a user namespace")
+		}
+	}
+	return pass("no security options keeping the containers from reading the repositories")
+}
+
+// Thresholds of the disk space available for the images and volumes.
+const (
+	minFreeSpace  = 1 << 30
+	warnFreeSpace = 5 << 30
+)
+
+func runDiskSpaceCheck() checkResult {
+	dir, err := docker.RootDir()
+	if err != nil {
+		return warn("", "could not get the directory of docker: %v", err)
+	}
+
+	// The directory of docker is in a virtual machine with Docker Desktop,
+	// and it's usually not readable by users in linux, unlike its parents.
+	if runtime.GOOS != "linux" {
+		dir = os.TempDir()
+	}
+
+	var free uint64
+	var ok bool
+	for ; !ok && dir != filepath.Dir(dir); dir = filepath.Dir(dir) {
+		free, ok = freeSpace(dir)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	imgs, err := components.Images(ctx)
+	cancel()
+	if err != nil {
+		return warn("", "could not list the images of the components: %v", err)
+	}
+
+	var used int64
+	for _, img := range imgs {
+		if img.Size != nil {
+			used += *img.Size
+		}
+	}
+
+	return checkDiskSpace(dir, free, ok, used)
+}
+
+// checkDiskSpace checks the free bytes in the directory, if ok, given the
+// bytes used by the images of the components installed.
+func checkDiskSpace(dir string, free uint64, ok bool, used int64) checkResult {
+	if !ok {
+		return warn("", "could not get the disk space available")
+	}
+
+	msg := fmt.Sprintf("%s free in %s, the images installed use %s",
+		units.HumanSize(float64(free)), dir, units.HumanSize(float64(used)))
+	switch {
+	case free < minFreeSpace:
+		return fail("free some space, for example with docker system prune", msg)
+	case free < warnFreeSpace:
+		return warn("the images and indexes could need more space; free some with docker system prune", msg)
+	default:
+		return pass(msg)
+	}
+}
+
+// doctorPort is one of the ports of the host used by the engine.
+type doctorPort struct {
+	port  int
+	owner components.Component
+	// required is false for the ports of the web clients, which can be
+	// changed with --web-sql-port and --web-parse-port.
+	required bool
+}
+
+func standardPorts() []doctorPort {
+	ports := []doctorPort{
+		{3306, components.Gitbase, true},
+		{9432, components.Bblfshd, true},
+		{viper.GetInt("web.sql.port"), components.GitbaseWeb, false},
+		{viper.GetInt("web.parse.port"), components.BblfshWeb, false},
+	}
+
+	// The daemon is served on a unix socket, but on Windows. Another port
+	// is chosen when the default one is taken, unless one is configured.
+	if port := daemon.ConfiguredPort(); port != 0 {
+		ports = append([]doctorPort{{port, components.Daemon, true}}, ports...)
+	}
+	return ports
+}
+
+func runPortsCheck() checkResult {
+	engine, err := enginePorts()
+	if err != nil {
+		return warn("", "%v", err)
+	}
+
+	busy := make(map[int]bool)
+	for _, p := range standardPorts() {
+		if _, ok := engine[p.port]; !ok && portTaken(p.port) {
+			busy[p.port] = true
+		}
+	}
+
+	return checkPorts(standardPorts(), busy, engine)
+}
+
+// enginePorts returns the names of the containers of the engine by the ports
+// of the host they are published on, which are taken by them.
+func enginePorts() (map[int]string, error) {
+	containers, err := docker.List()
+	if err != nil {
+		return nil, fmt.Errorf("could not list the containers: %v", err)
+	}
+
+	engine := make(map[int]string)
+	for _, c := range containers {
+		if len(c.Names) == 0 || !strings.HasPrefix(c.Names[0], "/srcd-cli-") {
+			continue
+		}
+
+		for _, p := range c.Ports {
+			if p.PublicPort != 0 {
+				engine[int(p.PublicPort)] = strings.TrimPrefix(c.Names[0], "/")
+			}
+		}
+	}
+	return engine, nil
+}
+
+// portTaken reports whether the port of the host can't be listened on, as
+// another program, or a container, uses it.
+func portTaken(port int) bool {
+	l, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return true
+	}
+	l.Close()
+	return false
+}
+
+// checkPorts checks that none of the ports is busy, unless it's taken by a
+// container of the engine.
+func checkPorts(ports []doctorPort, busy map[int]bool, engine map[int]string) checkResult {
+	var required, optional []string
+	for _, p := range ports {
+		if _, ok := engine[p.port]; ok || !busy[p.port] {
+			continue
+		}
+
+		taken := fmt.Sprintf("%d (%s)", p.port, p.owner.ShortName())
+		if p.required {
+			required = append(required, taken)
+		} else {
+			optional = append(optional, taken)
+		}
+	}
+
+	switch {
+	case len(required) > 0:
+		return fail("stop the programs using them, like a local MySQL for 3306",
+			"ports taken by other programs: %s", strings.Join(append(required, optional...), ", "))
+	case len(optional) > 0:
+		return warn("choose other ones with srcd init --web-sql-port and --web-parse-port, or use --auto-ports",
+			"ports taken by other programs: %s", strings.Join(optional, ", "))
+	default:
+		var ns []string
+		for _, p := range ports {
+			ns = append(ns, strconv.Itoa(p.port))
+		}
+		return pass("ports %s are free or used by the engine", strings.Join(ns, ", "))
+	}
+}
+
+func runWorkdirCheck() checkResult {
+	cfg, err := daemon.Running()
+	if err != nil {
+		return warn("", "could not get the configuration of the daemon: %v", err)
+	}
+
+	if cfg == nil || cfg.Workdir == "" {
+		return warn("run srcd init", "the engine is not initialized")
+	}
+
+	shared, ok := dockerDesktopSharedPaths()
+	return checkWorkdir(cfg.Workdir, shared, ok)
+}
+
+// checkWorkdir checks that the working directory can be read and mounted into
+// the containers, given the paths shared by Docker Desktop, if known.
+func checkWorkdir(dir string, shared []string, sharedKnown bool) checkResult {
+	f, err := os.Open(dir)
+	if os.IsNotExist(err) {
+		return fail("run srcd init with the new working directory, or srcd workdir set",
+			"the working directory %s doesn't exist", dir)
+	} else if err != nil {
+		return fail("make it readable, for example with chmod -R a+rX "+dir,
+			"the working directory %s can't be read: %v", dir, err)
+	}
+	f.Close()
+
+	if fs, ok := networkFilesystem(dir); ok {
+		return fail("move the repositories to a local disk",
+			"the working directory %s is in a network share (%s), which can't be mounted", dir, fs)
+	}
+
+	if sharedKnown && !inPaths(dir, shared) {
+		return fail("add it in Docker Desktop, in Preferences > File Sharing",
+			"the working directory %s is not shared with Docker Desktop", dir)
+	}
+	return pass("the working directory %s can be mounted", dir)
+}
+
+func runTopologyCheck() checkResult {
+	var workdir string
+	if cfg, err := daemon.Running(); err == nil && cfg != nil {
+		workdir = cfg.Workdir
+	}
+
+	distro, _ := daemon.WSLDistro()
+	return checkTopology(daemon.DetectTopology(), distro, workdir)
+}
+
+// checkTopology tells where srcd and docker run, the topology detected, and
+// checks the working directory, if any, is on the same side of WSL as docker.
+func checkTopology(t daemon.Topology, distro, workdir string) checkResult {
+	if warning := daemon.CrossingWarning(workdir, t); warning != "" {
+		return warn("move the repositories and run srcd init there",
+			"%s (%s): the working directory %s", t, t.Describe(distro), warning)
+	}
+	return pass("%s (%s)", t, t.Describe(distro))
+}
+
+// componentState is what's checked of each component.
+type componentState struct {
+	name string
+	// created is false if there's no container.
+	created bool
+	running bool
+	// containerImage is the id of the image of the container.
+	containerImage string
+	// installedImage is the id of the image installed the container would be
+	// created from, empty if it's not installed.
+	installedImage string
+}
+
+func runComponentsCheck() checkResult {
+	states, err := componentStates()
+	if err != nil {
+		return warn("", "%v", err)
+	}
+	return checkComponents(states)
+}
+
+// componentStates inspects the containers and the images installed of the
+// daemon and all the components.
+func componentStates() ([]componentState, error) {
+	var states []componentState
+	for _, c := range append([]components.Component{components.Daemon}, components.All...) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		s := componentState{name: c.ShortName()}
+		info, err := docker.Inspect(ctx, c.Name)
+		if err == nil {
+			s.created = true
+			s.running = info.State.Running
+			s.containerImage = info.Image
+		} else if err != docker.ErrNotFound {
+			cancel()
+			return nil, fmt.Errorf("could not inspect %s: %v", c.ShortName(), err)
+		}
+
+		s.installedImage, _ = docker.ImageID(ctx, c.Ref())
+		cancel()
+		states = append(states, s)
+	}
+	return states, nil
+}
+
+// checkComponents warns about containers stopped, or running an image that's
+// not the one installed, as happens after pulling a newer one.
+func checkComponents(states []componentState) checkResult {
+	var stopped, outdated []string
+	for _, s := range states {
+		switch {
+		case !s.created:
+		case !s.running:
+			stopped = append(stopped, s.name)
+		case s.containerImage != s.installedImage:
+			outdated = append(outdated, s.name)
+		}
+	}
+
+	sort.Strings(stopped)
+	sort.Strings(outdated)
+	switch {
+	case len(outdated) > 0:
+		return warn("recreate them with srcd restart "+strings.Join(outdated, " "),
+			"containers running an image that's not the one installed: %s", strings.Join(outdated, ", "))
+	case len(stopped) > 0:
+		return warn("start them again with srcd restart "+strings.Join(stopped, " "),
+			"containers stopped: %s", strings.Join(stopped, ", "))
+	default:
+		return pass("the containers of the components are running the images installed")
+	}
+}
+
+// componentPlatform is the platform of the image installed of a component,
+// and the one forced for it with --platform, if any.
+type componentPlatform struct {
+	name     string
+	platform docker.Platform
+	forced   *docker.Platform
+}
+
+func runArchitectureCheck() checkResult {
+	ctx, cancel := context.WithTimeout(context.Background(), statusTimeout)
+	defer cancel()
+
+	host, err := docker.HostPlatform(ctx)
+	if err != nil {
+		return warn("", "%v", err)
+	}
+
+	var platforms []componentPlatform
+	for _, c := range append([]components.Component{components.Daemon}, components.All...) {
+		var forced *docker.Platform
+		if p, ok := c.Platform(); ok {
+			if err := docker.ValidatePlatform(ctx, p); err != nil {
+				return fail("", "%v", err)
+			}
+			forced = &p
+		}
+
+		img, err := docker.InspectImage(ctx, c.Ref())
+		switch {
+		case err == docker.ErrImageNotFound:
+			continue
+		case err != nil:
+			return warn("", "could not inspect the image of %s: %v", c.ShortName(), err)
+		}
+		platforms = append(platforms, componentPlatform{c.ShortName(), docker.ImagePlatform(img), forced})
+	}
+	return checkArchitectures(host, platforms)
+}
+
+// checkArchitectures warns about the images installed for another platform
+// than the one of docker, which run emulated and slower, as the ones pulled
+// for amd64 when there's no image for arm64, unless it's the one forced with
+// --platform, and about the ones installed for another platform than the one
+// forced.
+func checkArchitectures(host docker.Platform, platforms []componentPlatform) checkResult {
+	var emulated, chosen, mismatched []string
+	for _, p := range platforms {
+		item := fmt.Sprintf("%s (%s)", p.name, p.platform)
+		switch {
+		case p.forced != nil && !p.platform.Runs(*p.forced):
+			mismatched = append(mismatched, fmt.Sprintf("%s (%s, not %s)", p.name, p.platform, *p.forced))
+		case p.platform.Runs(host):
+		case p.forced != nil:
+			chosen = append(chosen, item)
+		default:
+			emulated = append(emulated, item)
+		}
+	}
+
+	switch {
+	case len(mismatched) > 0:
+		return warn("srcd init pulls them again for the platform given",
+			"images installed for another platform than the one given with --platform: %s",
+			strings.Join(mismatched, ", "))
+	case len(emulated) > 0:
+		return warn("they have no image for this platform yet; give --require-native to fail instead of using them",
+			"images for another platform than %s, the one of docker, which run emulated: %s",
+			host, strings.Join(emulated, ", "))
+	case len(chosen) > 0:
+		return pass("the images installed are for %s, the platform of docker, except the ones for the "+
+			"platform given with --platform, which run emulated: %s", host, strings.Join(chosen, ", "))
+	}
+	return pass("the images installed are for %s, the platform of docker", host)
+}
+
+func runTLSCheck() checkResult {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var probes []docker.TLSProbe
+	for _, host := range docker.TLSHosts() {
+		probes = append(probes, docker.ProbeTLS(ctx, host))
+	}
+
+	// The images are not pulled from Docker Hub with a mirror, see
+	// runRegistryMirrorCheck.
+	var dockerErr error
+	if docker.RegistryMirror == "" {
+		dockerErr = docker.SearchHub(ctx)
+	}
+	return checkTLS(probes, dockerErr)
+}
+
+func runRegistryMirrorCheck() checkResult {
+	if docker.RegistryMirror == "" {
+		return checkRegistryMirrorServes("", "", nil)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	ref := components.Daemon.Ref()
+	_, err := docker.RemoteManifestOf(ctx, components.Daemon.ImageName(), components.Daemon.Tag())
+	return checkRegistryMirrorServes(docker.RegistryMirror, ref, err)
+}
+
+// checkRegistryMirrorServes checks the registry mirror, if there's one,
+// serves the manifest of the image with the given reference, one of the
+// engine, so it can be reached with its credentials and mirrors Docker Hub.
+func checkRegistryMirrorServes(mirror, ref string, err error) checkResult {
+	switch {
+	case mirror == "":
+		return pass("no registry mirror, the images are pulled from Docker Hub")
+	case err != nil:
+		return fail("check registry-mirror is the registry with the path Docker Hub is mirrored under, "+
+			"and give its credentials with docker login",
+			"the registry mirror %s doesn't serve %s: %v", mirror, ref, err)
+	}
+	return pass("the registry mirror %s serves %s", mirror, ref)
+}
+
+// checkTLS fails if the certificates of the hosts the engine reaches are not
+// trusted, as when a proxy intercepts TLS with its own CA, or if the CLI
+// reaches Docker Hub but docker doesn't, so it's docker, with its own proxy
+// and CAs, failing to pull the images.
+func checkTLS(probes []docker.TLSProbe, dockerErr error) checkResult {
+	var unreachable, untrusted, intercepted []string
+	for _, p := range probes {
+		switch {
+		case p.Err != nil:
+			unreachable = append(unreachable, fmt.Sprintf("%s (%v)", p.Host, p.Err))
+		case !p.Trusted:
+			untrusted = append(untrusted, fmt.Sprintf("%s, issued by %s", p.Host, p.Issuer))
+		case !p.SystemTrusted:
+			intercepted = append(intercepted, p.Host)
+		}
+	}
+
+	switch {
+	case len(untrusted) > 0:
+		return fail("set http.ca-bundle in the config file, or give --ca-bundle, with the certificate of the CA of the proxy",
+			"the certificates of %s are not issued by a CA trusted, as when a proxy intercepts TLS",
+			strings.Join(untrusted, "; "))
+	case len(unreachable) > 0:
+		return warn("if there's a proxy, set http.proxy in the config file, or give --http-proxy",
+			"the CLI can't reach %s", strings.Join(unreachable, ", "))
+	case dockerErr != nil:
+		return fail("configure the proxy and CAs of docker itself, which the engine can't, and restart it",
+			"the CLI reaches Docker Hub, but docker doesn't, so it's docker, not the CLI, that fails to pull the images: %v",
+			dockerErr)
+	case len(intercepted) > 0:
+		return pass("%s are reached through a proxy intercepting TLS, whose CA is trusted with http.ca-bundle",
+			strings.Join(intercepted, ", "))
+	default:
+		return pass("Docker Hub and GitHub are reached by the CLI and docker with certificates of trusted CAs")
+	}
+}
+
+func runWebClientsCheck() checkResult {
+	var containers []*docker.Container
+	for _, c := range []components.Component{components.GitbaseWeb, components.BblfshWeb} {
+		info, err := docker.Info(c.Name)
+		if err == docker.ErrNotFound {
+			continue
+		} else if err != nil {
+			return warn("", "could not inspect %s: %v", c.ShortName(), err)
+		}
+		containers = append(containers, info)
+	}
+	return checkWebClients(containers)
+}
+
+// checkWebClients warns about the containers of the web clients published on
+// every interface without the address being recorded in their labels, as
+// they were created before the web clients were kept on the loopback unless
+// exposed with --expose-web.
+func checkWebClients(containers []*docker.Container) checkResult {
+	var legacy, exposed []string
+	for _, c := range containers {
+		var name string
+		if len(c.Names) > 0 {
+			name = strings.TrimPrefix(c.Names[0], "/")
+		}
+		if cmp, ok := components.ByName(name); ok {
+			name = cmp.ShortName()
+		}
+
+		if bind, ok := c.Labels[components.WebBindLabel]; ok {
+			if !components.IsLoopback(bind) {
+				exposed = append(exposed, fmt.Sprintf("%s (%s)", name, components.BindDescription(bind)))
+			}
+			continue
+		}
+
+		for _, p := range c.Ports {
+			if p.PublicPort != 0 && !components.IsLoopback(p.IP) {
+				legacy = append(legacy, name)
+				break
+			}
+		}
+	}
+
+	sort.Strings(legacy)
+	sort.Strings(exposed)
+	switch {
+	case len(legacy) > 0:
+		return warn("start them again with srcd web sql or srcd web parse to publish them on the loopback only, "+
+			"or with --expose-web to keep them exposed",
+			"web clients without authentication published on every interface by an older version: %s",
+			strings.Join(legacy, ", "))
+	case len(exposed) > 0:
+		return pass("web clients exposed with --expose-web: %s", strings.Join(exposed, ", "))
+	default:
+		return pass("the web clients are only published on the loopback")
+	}
+}
+
+func runDaemonVersionCheck() checkResult {
+	running, err := daemon.IsRunning()
+	if err != nil || !running {
+		return checkDaemonVersion(running, nil, err)
+	}
+
+	c, err := daemon.RunningClient()
+	if err != nil {
+		return checkDaemonVersion(true, nil, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	res, err := c.Version(ctx, &api.VersionRequest{})
+	if err != nil {
+		return checkDaemonVersion(true, nil, err)
+	}
+	return checkDaemonVersion(true, res, nil)
+}
+
+// checkDaemonVersion compares the version of the daemon, and of the protocol
+// it speaks, with the ones of the CLI.
+func checkDaemonVersion(running bool, res *api.VersionResponse, err error) checkResult {
+	switch {
+	case err != nil:
+		return fail("recreate it with srcd init --force", "could not get the version of the daemon: %v", err)
+	case !running:
+		return warn("run srcd init", "the daemon is not running")
+	case res.Protocol != api.ProtocolVersion:
+		return fail("recreate it with srcd init --force, or run any command to do it",
+			"the daemon %s speaks the protocol %d, not %d like the CLI", res.Version, res.Protocol, api.ProtocolVersion)
+	case res.Version != version:
+		return warn("recreate it with srcd init --force",
+			"the version of the daemon, %s, is not the one of the CLI, %s", res.Version, version)
+	default:
+		return pass("the daemon has the version of the CLI, %s", version)
+	}
+}
+
+// checkDaemonEndpoint checks the daemon can't be used by anyone reaching it:
+// it's served on a unix socket, on localhost or with TLS.
+func checkDaemonEndpoint(e *daemon.Endpoint, err error) checkResult {
+	switch {
+	case err != nil:
+		return warn("recreate it with srcd init --force", "could not find where the daemon is served: %v", err)
+	case e == nil:
+		return warn("run srcd init", "the daemon is not running")
+	case e.Network == "unix":
+		return pass("the daemon is served on the unix socket %s", e.Address)
+	case e.Public && !e.TLS:
+		return warn("enable TLS with daemon.tls: true in the config file, or SRCD_DAEMON_TLS=1, and run srcd init",
+			"THE DAEMON IS SERVED ON %s WITHOUT TLS: its token can be read by anyone on the network, who can then use the engine", e.Address)
+	case e.TLS:
+		return pass("the daemon is served on %s with TLS", e.Address)
+	default:
+		return pass("the daemon is served on %s, only reachable from this host", e.Address)
+	}
+}
+
+func runDaemonPortCheck() checkResult {
+	r, err := daemon.RunningPort()
+	if err != nil || r == nil {
+		return checkDaemonPort(r, err, nil)
+	}
+
+	conn, dialErr := net.DialTimeout("tcp", net.JoinHostPort(r.Host, strconv.Itoa(r.Port)), daemonDialTimeout)
+	if dialErr == nil {
+		conn.Close()
+	}
+	return checkDaemonPort(r, nil, dialErr)
+}
+
+// checkDaemonPort checks that the daemon served on a TCP port is published on
+// the port the CLI looks for it on, the one in its labels, and that it
+// listens on it, given the error connecting to it.
+func checkDaemonPort(r *daemon.PortReport, err, dialErr error) checkResult {
+	if err != nil {
+		return warn("", "could not inspect the daemon: %v", err)
+	}
+
+	if r == nil {
+		return pass("the daemon is not running, or it's served on a unix socket")
+	}
+
+	var published []string
+	found := false
+	for _, p := range r.Published {
+		published = append(published, strconv.Itoa(p))
+		found = found || p == r.Port
+	}
+
+	switch {
+	case len(published) == 0:
+		return fail("recreate it with srcd init --force",
+			"the CLI looks for the daemon on the port %d, but it's not published on any", r.Port)
+	case !found:
+		return fail("recreate it with srcd init --force",
+			"the CLI looks for the daemon on the port %d, but it's published on %s", r.Port, strings.Join(published, ", "))
+	case dialErr != nil:
+		return fail("check why with srcd logs daemon",
+			"the daemon is published on the port %d, but it can't be reached on %s: %v", r.Port, r.Host, dialErr)
+	default:
+		return pass("the daemon is published and listening on the port %d", r.Port)
+	}
+}
+
+// gitbaseSettings returns the settings of gitbase, like squash: off: the
+// ones its container runs with, or the ones the daemon creates it with if
+// there's none, or nil if the engine is not initialized.
+func gitbaseSettings() (map[string]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), statusTimeout)
+	defer cancel()
+
+	info, err := docker.Inspect(ctx, components.Gitbase.Name)
+	switch {
+	case err == docker.ErrNotFound:
+	case err != nil:
+		return nil, err
+	default:
+		return components.GitbaseContainerSettings(info), nil
+	}
+
+	cfg, err := daemon.Running()
+	if err != nil || cfg == nil {
+		return nil, err
+	}
+
+	settings, err := cfg.Gitbase.Settings()
+	if err != nil {
+		return nil, err
+	}
+
+	m := settings.Map()
+	m["workdir-mount"] = components.WorkdirMode(cfg.Gitbase.WritableWorkdir)
+	return m, nil
+}
+
+// checkGitbaseSettings reports the settings of gitbase, as they change a lot
+// how fast the queries are, like squash, which can also give other results.
+func checkGitbaseSettings(settings map[string]string, err error) checkResult {
+	switch {
+	case err != nil:
+		return warn("", "could not get the settings of gitbase: %v", err)
+	case settings == nil:
+		return pass("the engine is not initialized, gitbase uses its default settings")
+	}
+
+	var values []string
+	for _, k := range sortedSettings(settings) {
+		values = append(values, k+" "+settings[k])
+	}
+	return pass("gitbase runs with %s", strings.Join(values, ", "))
+}
+
+func init() {
+	rootCmd.AddCommand(doctorCmd)
+	doctorCmd.Flags().Bool("json", false, "print the results as JSON")
+	doctorCmd.Flags().String("bundle", "", "write a tarball with everything needed to debug the engine to the given file, like srcd.tar.gz")
+	doctorCmd.Flags().Int("bundle-log-size", 256, "KB of the end of the logs of every component kept in the bundle")
+	doctorCmd.Flags().Bool("anonymize", false, "replace the home directory with ~ in the bundle")
+}
@@ -0,0 +1,266 @@
+package cmd
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	homedir "github.com/mitchellh/go-homedir"
+	"github.com/src-d/engine/components"
+	"github.com/src-d/engine/docker"
+)
+
+// bundleDir is the directory the files of the diagnostics bundle are in.
+const bundleDir = "srcd-diagnostics"
+
+// bundleTimeout is how long the collection of every part of the bundle can
+// take, so the components down don't keep it from finishing.
+const bundleTimeout = 30 * time.Second
+
+// bundleFile is a file of the diagnostics bundle.
+type bundleFile struct {
+	name    string
+	content []byte
+}
+
+// bundleCollector collects the files of the bundle, along with the errors
+// found collecting them, which are written to errors.txt instead of stopping
+// the collection.
+type bundleCollector struct {
+	mu     sync.Mutex
+	files  []bundleFile
+	errors []string
+}
+
+func (b *bundleCollector) add(name string, content []byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.files = append(b.files, bundleFile{name, content})
+}
+
+func (b *bundleCollector) addJSON(name string, v interface{}) {
+	content, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		b.fail("could not encode %s: %v", name, err)
+		return
+	}
+	b.add(name, append(content, '\n'))
+}
+
+func (b *bundleCollector) fail(format string, args ...interface{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.errors = append(b.errors, fmt.Sprintf(format, args...))
+}
+
+// collectBundle collects the doctor report, the versions, the status and
+// details of the components, the last logSize bytes of the logs of their
+// containers, the configuration and docker info. What can't be collected, as
+// when docker can't be reached, is listed in errors.txt.
+func collectBundle(results []checkResult, logSize int) []bundleFile {
+	b := &bundleCollector{}
+
+	var report bytes.Buffer
+	if err := printCheckResults(&report, results); err != nil {
+		b.fail("could not print the doctor report: %v", err)
+	}
+	b.add("doctor.txt", report.Bytes())
+	b.addJSON("doctor.json", results)
+
+	var config bytes.Buffer
+	if err := printConfig(&config); err != nil {
+		b.fail("could not print the configuration: %v", err)
+	}
+	b.add("config.txt", config.Bytes())
+
+	var wg sync.WaitGroup
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		b.addJSON("version.json", collectVersions())
+	}()
+	go func() {
+		defer wg.Done()
+		b.addJSON("status.json", checkEnvironment())
+	}()
+	go func() {
+		defer wg.Done()
+		if info, err := docker.SystemInfo(); err != nil {
+			b.fail("%v", err)
+		} else {
+			b.addJSON("docker-info.json", info)
+		}
+	}()
+
+	for _, c := range append([]components.Component{components.Daemon}, components.All...) {
+		wg.Add(1)
+		go func(c components.Component) {
+			defer wg.Done()
+			collectComponent(b, c, logSize)
+		}(c)
+	}
+	wg.Wait()
+
+	if len(b.errors) > 0 {
+		sort.Strings(b.errors)
+		b.add("errors.txt", []byte(strings.Join(b.errors, "\n")+"\n"))
+	}
+
+	sort.Slice(b.files, func(i, j int) bool { return b.files[i].name < b.files[j].name })
+	return b.files
+}
+
+// collectComponent collects the details of the component and the logs of its
+// container, if there's one.
+func collectComponent(b *bundleCollector, c components.Component, logSize int) {
+	ctx, cancel := context.WithTimeout(context.Background(), bundleTimeout)
+	defer cancel()
+
+	name := c.ShortName()
+	i, err := components.Inspect(ctx, c)
+	if err != nil {
+		b.fail("could not inspect %s: %v", name, err)
+		return
+	}
+
+	b.addJSON("components/"+name+".json", i)
+
+	if i.Container == nil {
+		return
+	}
+
+	logs := &lastBytes{max: logSize}
+	if err := docker.StreamLogs(ctx, c.Name, docker.LogsOptions{Tail: "all", Timestamps: true}, logs); err != nil {
+		b.fail("could not get the logs of %s: %v", name, err)
+	}
+
+	content := logs.Bytes()
+	if c.Name == components.Gitbase.Name {
+		level := gitbaseLogLevelNote(components.ParseGitbaseEnv(i.Container.Env).LogLevel)
+		content = append([]byte(level), content...)
+	}
+	b.add("logs/"+name+".log", content)
+}
+
+// gitbaseLogLevelNote returns the first line of the logs of gitbase in the
+// bundle, with their level, so it's known whether the debug lines are there.
+func gitbaseLogLevelNote(level string) string {
+	if level == "" {
+		level = components.DefaultGitbaseLogLevel + ", the default"
+	}
+	return fmt.Sprintf("# logs of gitbase at level %s, change it with srcd init --gitbase-log-level\n", level)
+}
+
+// lastBytes is a writer keeping only the last max bytes written.
+type lastBytes struct {
+	max int
+	buf []byte
+}
+
+func (w *lastBytes) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	if extra := len(w.buf) - w.max; extra > 0 {
+		w.buf = append(w.buf[:0], w.buf[extra:]...)
+	}
+	return len(p), nil
+}
+
+// Bytes returns the bytes kept, starting with the first full line.
+func (w *lastBytes) Bytes() []byte {
+	if len(w.buf) < w.max {
+		return w.buf
+	}
+
+	if i := bytes.IndexByte(w.buf, '\n'); i >= 0 {
+		return w.buf[i+1:]
+	}
+	return w.buf
+}
+
+// bundleRedactor removes the credentials from the files of the bundle and,
+// if home is not empty, replaces the home directory with ~.
+type bundleRedactor struct {
+	home string
+}
+
+func newBundleRedactor(anonymize bool) (*bundleRedactor, error) {
+	if !anonymize {
+		return &bundleRedactor{}, nil
+	}
+
+	home, err := homedir.Dir()
+	if err != nil {
+		return nil, fmt.Errorf("could not get the home directory to anonymize: %v", err)
+	}
+	return &bundleRedactor{home: strings.TrimRight(home, string(os.PathSeparator))}, nil
+}
+
+func (r *bundleRedactor) redact(content []byte) []byte {
+	s := redact(string(content))
+	if r.home != "" && r.home != string(os.PathSeparator) {
+		s = strings.Replace(s, r.home, "~", -1)
+	}
+	return []byte(s)
+}
+
+// writeBundle writes the files, redacted, as a gzipped tarball to w.
+func writeBundle(w io.Writer, files []bundleFile, r *bundleRedactor) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	now := time.Now()
+	for _, f := range files {
+		content := r.redact(f.content)
+		err := tw.WriteHeader(&tar.Header{
+			Name:     bundleDir + "/" + f.name,
+			Mode:     0644,
+			Size:     int64(len(content)),
+			ModTime:  now,
+			Typeflag: tar.TypeReg,
+		})
+		if err != nil {
+			return err
+		}
+
+		if _, err := tw.Write(content); err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// saveBundle collects the diagnostics bundle and writes it to path.
+func saveBundle(path string, results []checkResult, logSize int, anonymize bool) error {
+	r, err := newBundleRedactor(anonymize)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("could not create the bundle: %v", err)
+	}
+
+	err = writeBundle(f, collectBundle(results, logSize), r)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return fmt.Errorf("could not write the bundle: %v", err)
+	}
+	return nil
+}
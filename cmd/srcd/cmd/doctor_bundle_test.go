@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestLastBytes(t *testing.T) {
+	testCases := []struct {
+		name     string
+		writes   []string
+		expected string
+	}{
+		{"fits", []string{"a\n", "b\n"}, "a\nb\n"},
+		{"cut at a line", []string{"first line\n", "second\n", "third\n"}, "third\n"},
+		{"no lines", []string{"0123456789", "abcdef"}, "6789abcdef"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := &lastBytes{max: 10}
+			for _, s := range tc.writes {
+				w.Write([]byte(s))
+			}
+
+			if got := string(w.Bytes()); got != tc.expected {
+				t.Errorf("expected: %q, got: %q", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestGitbaseLogLevelNote(t *testing.T) {
+	expected := "# logs of gitbase at level info, the default, change it with srcd init --gitbase-log-level\n"
+	if got := gitbaseLogLevelNote(""); got != expected {
+		t.Errorf("expected: %q, got: %q", expected, got)
+	}
+
+	expected = "# logs of gitbase at level debug, change it with srcd init --gitbase-log-level\n"
+	if got := gitbaseLogLevelNote("debug"); got != expected {
+		t.Errorf("expected: %q, got: %q", expected, got)
+	}
+}
+
+func TestWriteBundle(t *testing.T) {
+	files := []bundleFile{
+		{"config.txt", []byte("workdir /home/user/repos\n")},
+		{"logs/gitbase.log", []byte("pulling with Authorization: Bearer abc123\n")},
+	}
+
+	var buf bytes.Buffer
+	if err := writeBundle(&buf, files, &bundleRedactor{home: "/home/user"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	gz, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var got []string
+	tr := tar.NewReader(gz)
+	for {
+		h, err := tr.Next()
+		if err != nil {
+			break
+		}
+
+		content, err := ioutil.ReadAll(tr)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		got = append(got, h.Name+": "+string(content))
+	}
+
+	expected := "srcd-diagnostics/config.txt: workdir ~/repos\n" +
+		"srcd-diagnostics/logs/gitbase.log: pulling with Authorization: Bearer [redacted]\n"
+	if strings.Join(got, "") != expected {
+		t.Errorf("expected: %s, got: %s", expected, strings.Join(got, ""))
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package cmd
+
+// freeSpace can't get the space available in this platform.
+func freeSpace(dir string) (uint64, bool) {
+	return 0, false
+}
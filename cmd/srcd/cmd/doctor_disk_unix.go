@@ -0,0 +1,17 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package cmd
+
+import "syscall"
+
+// freeSpace returns the bytes available to unprivileged users in the
+// filesystem of the directory.
+func freeSpace(dir string) (uint64, bool) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return 0, false
+	}
+
+	return uint64(st.Bavail) * uint64(st.Bsize), true
+}
@@ -0,0 +1,495 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/src-d/engine/api"
+	"github.com/src-d/engine/cmd/srcd/daemon"
+	"github.com/src-d/engine/components"
+	"github.com/src-d/engine/docker"
+)
+
+func TestRunDoctorChecks(t *testing.T) {
+	var ran []string
+	check := func(name, status string, needsDocker bool) doctorCheck {
+		return doctorCheck{name, needsDocker, func() checkResult {
+			ran = append(ran, name)
+			return checkResult{Status: status}
+		}}
+	}
+
+	results := runDoctorChecks([]doctorCheck{
+		check("docker", checkFail, false),
+		check("ports", checkPass, true),
+		check("other", checkPass, false),
+	})
+
+	expected := []string{"docker", "other"}
+	if fmt.Sprint(ran) != fmt.Sprint(expected) {
+		t.Errorf("expected: %v, got: %v", expected, ran)
+	}
+
+	statuses := []string{results[0].Status, results[1].Status, results[2].Status}
+	expected = []string{checkFail, checkWarn, checkPass}
+	if fmt.Sprint(statuses) != fmt.Sprint(expected) {
+		t.Errorf("expected: %v, got: %v", expected, statuses)
+	}
+
+	if results[1].Check != "ports" {
+		t.Errorf("expected: ports, got: %s", results[1].Check)
+	}
+}
+
+func TestCheckDocker(t *testing.T) {
+	testCases := []struct {
+		name     string
+		version  string
+		err      error
+		expected string
+	}{
+		{"unreachable", "", fmt.Errorf("could not ping docker"), checkFail},
+		{"old", "1.24", nil, checkFail},
+		{"minimum", "1.25", nil, checkPass},
+		{"newer", "1.40", nil, checkPass},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := checkDocker(tc.version, tc.err)
+			if r.Status != tc.expected {
+				t.Errorf("expected: %s, got: %s", tc.expected, r.Status)
+			}
+		})
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	testCases := []struct {
+		a, b     string
+		expected int
+	}{
+		{"1.25", "1.25", 0},
+		{"1.9", "1.25", -1},
+		{"1.40", "1.25", 1},
+		{"2", "1.25", 1},
+		{"1.25.1", "1.25", 1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.a+"-"+tc.b, func(t *testing.T) {
+			if got := compareVersions(tc.a, tc.b); got != tc.expected {
+				t.Errorf("expected: %d, got: %d", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestCheckSecurityOptions(t *testing.T) {
+	testCases := []struct {
+		name     string
+		opts     []string
+		expected string
+	}{
+		{"none", nil, checkPass},
+		{"seccomp", []string{"name=seccomp,profile=default"}, checkPass},
+		{"selinux", []string{"name=seccomp,profile=default", "name=selinux"}, checkWarn},
+		{"userns", []string{"name=userns"}, checkWarn},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := checkSecurityOptions(tc.opts, nil)
+			if r.Status != tc.expected {
+				t.Errorf("expected: %s, got: %s", tc.expected, r.Status)
+			}
+		})
+	}
+}
+
+func TestCheckDiskSpace(t *testing.T) {
+	testCases := []struct {
+		name     string
+		free     uint64
+		ok       bool
+		expected string
+	}{
+		{"unknown", 0, false, checkWarn},
+		{"full", 100 << 20, true, checkFail},
+		{"low", 2 << 30, true, checkWarn},
+		{"enough", 50 << 30, true, checkPass},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := checkDiskSpace("/var/lib/docker", tc.free, tc.ok, 3<<30)
+			if r.Status != tc.expected {
+				t.Errorf("expected: %s, got: %s", tc.expected, r.Status)
+			}
+		})
+	}
+}
+
+func TestCheckPorts(t *testing.T) {
+	ports := []doctorPort{
+		{3306, components.Gitbase, true},
+		{8080, components.GitbaseWeb, false},
+	}
+
+	testCases := []struct {
+		name     string
+		busy     map[int]bool
+		engine   map[int]string
+		expected string
+	}{
+		{"free", nil, nil, checkPass},
+		{"engine", map[int]bool{3306: true}, map[int]string{3306: "srcd-cli-gitbase"}, checkPass},
+		{"required", map[int]bool{3306: true}, nil, checkFail},
+		{"web", map[int]bool{8080: true}, nil, checkWarn},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := checkPorts(ports, tc.busy, tc.engine)
+			if r.Status != tc.expected {
+				t.Errorf("expected: %s, got: %s (%s)", tc.expected, r.Status, r.Message)
+			}
+		})
+	}
+}
+
+func TestCheckWorkdir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "srcd-doctor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	testCases := []struct {
+		name        string
+		dir         string
+		shared      []string
+		sharedKnown bool
+		expected    string
+	}{
+		{"ok", dir, nil, false, checkPass},
+		{"missing", filepath.Join(dir, "missing"), nil, false, checkFail},
+		{"shared", dir, []string{filepath.Dir(dir)}, true, checkPass},
+		{"not shared", dir, []string{"/Users"}, true, checkFail},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := checkWorkdir(tc.dir, tc.shared, tc.sharedKnown)
+			if r.Status != tc.expected {
+				t.Errorf("expected: %s, got: %s (%s)", tc.expected, r.Status, r.Message)
+			}
+		})
+	}
+}
+
+func TestCheckTopology(t *testing.T) {
+	testCases := []struct {
+		name     string
+		topology daemon.Topology
+		workdir  string
+		expected string
+	}{
+		{"native", daemon.TopologyNative, "/home/me/repos", checkPass},
+		{"wsl in distro", daemon.TopologyWSLDesktop, "/home/me/repos", checkPass},
+		{"wsl in windows filesystem", daemon.TopologyWSLDesktop, "/mnt/c/Users/me/repos", checkWarn},
+		{"windows wsl 2 backend", daemon.TopologyWindowsWSL2, `C:\Users\me\repos`, checkWarn},
+		{"not initialized", daemon.TopologyWSL, "", checkPass},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := checkTopology(tc.topology, "Ubuntu", tc.workdir)
+			if r.Status != tc.expected {
+				t.Errorf("expected: %s, got: %s (%s)", tc.expected, r.Status, r.Message)
+			}
+		})
+	}
+}
+
+func TestCheckRegistryMirrorServes(t *testing.T) {
+	testCases := []struct {
+		name     string
+		mirror   string
+		err      error
+		expected string
+	}{
+		{"no mirror", "", nil, checkPass},
+		{"serves", "registry.corp/dockerhub", nil, checkPass},
+		{"unreachable", "registry.corp/dockerhub", fmt.Errorf("could not reach the registry mirror"), checkFail},
+		{"not found", "registry.corp/dockerhub", fmt.Errorf("404 Not Found"), checkFail},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := checkRegistryMirrorServes(tc.mirror, "srcd/cli-daemon:v0.1.0", tc.err)
+			if r.Status != tc.expected {
+				t.Errorf("expected: %s, got: %s (%s)", tc.expected, r.Status, r.Message)
+			}
+		})
+	}
+}
+
+func TestCheckComponents(t *testing.T) {
+	testCases := []struct {
+		name     string
+		states   []componentState
+		expected string
+	}{
+		{"not created", []componentState{{name: "gitbase", installedImage: "sha256:a"}}, checkPass},
+		{"up to date", []componentState{
+			{name: "gitbase", created: true, running: true, containerImage: "sha256:a", installedImage: "sha256:a"},
+		}, checkPass},
+		{"stopped", []componentState{
+			{name: "gitbase", created: true, containerImage: "sha256:a", installedImage: "sha256:a"},
+		}, checkWarn},
+		{"outdated", []componentState{
+			{name: "gitbase", created: true, running: true, containerImage: "sha256:a", installedImage: "sha256:b"},
+		}, checkWarn},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := checkComponents(tc.states)
+			if r.Status != tc.expected {
+				t.Errorf("expected: %s, got: %s (%s)", tc.expected, r.Status, r.Message)
+			}
+		})
+	}
+}
+
+func TestCheckArchitectures(t *testing.T) {
+	arm64 := docker.Platform{OS: "linux", Architecture: "arm64"}
+	amd64 := docker.Platform{OS: "linux", Architecture: "amd64"}
+
+	testCases := []struct {
+		name      string
+		host      docker.Platform
+		platforms []componentPlatform
+		expected  string
+	}{
+		{"none installed", arm64, nil, checkPass},
+		{"native", arm64, []componentPlatform{{"gitbase", arm64, nil}, {"bblfshd", arm64, nil}}, checkPass},
+		{"emulated", arm64, []componentPlatform{{"gitbase", arm64, nil}, {"bblfshd", amd64, nil}}, checkWarn},
+		{"variant", docker.Platform{OS: "linux", Architecture: "arm", Variant: "v7"},
+			[]componentPlatform{{"gitbase", docker.Platform{OS: "linux", Architecture: "arm"}, nil}}, checkPass},
+		{"forced emulated", arm64, []componentPlatform{{"gitbase", arm64, nil}, {"bblfshd", amd64, &amd64}}, checkPass},
+		{"forced native", arm64, []componentPlatform{{"bblfshd", arm64, &arm64}}, checkPass},
+		{"installed for another than forced", arm64, []componentPlatform{{"bblfshd", arm64, &amd64}}, checkWarn},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := checkArchitectures(tc.host, tc.platforms)
+			if r.Status != tc.expected {
+				t.Errorf("expected: %s, got: %s (%s)", tc.expected, r.Status, r.Message)
+			}
+		})
+	}
+}
+
+func TestCheckTLS(t *testing.T) {
+	trusted := docker.TLSProbe{Host: "registry-1.docker.io", Issuer: "Amazon", SystemTrusted: true, Trusted: true}
+	intercepted := docker.TLSProbe{Host: "registry-1.docker.io", Issuer: "Proxy CA", Trusted: true}
+	untrusted := docker.TLSProbe{Host: "registry-1.docker.io", Issuer: "Proxy CA"}
+	unreachable := docker.TLSProbe{Host: "registry-1.docker.io", Err: fmt.Errorf("timeout")}
+
+	testCases := []struct {
+		name      string
+		probes    []docker.TLSProbe
+		dockerErr error
+		expected  string
+	}{
+		{"trusted", []docker.TLSProbe{trusted}, nil, checkPass},
+		{"intercepted with the CA", []docker.TLSProbe{intercepted}, nil, checkPass},
+		{"intercepted", []docker.TLSProbe{trusted, untrusted}, nil, checkFail},
+		{"unreachable", []docker.TLSProbe{unreachable}, nil, checkWarn},
+		{"docker fails", []docker.TLSProbe{trusted}, fmt.Errorf("x509: certificate signed by unknown authority"), checkFail},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := checkTLS(tc.probes, tc.dockerErr)
+			if r.Status != tc.expected {
+				t.Errorf("expected: %s, got: %s (%s)", tc.expected, r.Status, r.Message)
+			}
+		})
+	}
+}
+
+func TestCheckWebClients(t *testing.T) {
+	web := func(ip string, labels map[string]string) *docker.Container {
+		return &docker.Container{
+			Names:  []string{"/" + components.GitbaseWeb.Name},
+			Ports:  []types.Port{{IP: ip, PrivatePort: 8080, PublicPort: 8080, Type: "tcp"}},
+			Labels: labels,
+		}
+	}
+
+	testCases := []struct {
+		name       string
+		containers []*docker.Container
+		expected   string
+	}{
+		{"none", nil, checkPass},
+		{"loopback", []*docker.Container{
+			web("127.0.0.1", map[string]string{components.WebBindLabel: "127.0.0.1"}),
+		}, checkPass},
+		{"exposed", []*docker.Container{
+			web("0.0.0.0", map[string]string{components.WebBindLabel: "0.0.0.0"}),
+		}, checkPass},
+		{"old binding", []*docker.Container{web("0.0.0.0", nil)}, checkWarn},
+		{"old loopback", []*docker.Container{web("127.0.0.1", nil)}, checkPass},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := checkWebClients(tc.containers)
+			if r.Status != tc.expected {
+				t.Errorf("expected: %s, got: %s (%s)", tc.expected, r.Status, r.Message)
+			}
+		})
+	}
+}
+
+func TestCheckDaemonVersion(t *testing.T) {
+	testCases := []struct {
+		name     string
+		running  bool
+		res      *api.VersionResponse
+		err      error
+		expected string
+	}{
+		{"error", false, nil, fmt.Errorf("could not connect"), checkFail},
+		{"not running", false, nil, nil, checkWarn},
+		{"other protocol", true, &api.VersionResponse{Version: "0.0.0"}, nil, checkFail},
+		{"other version", true, &api.VersionResponse{Version: "0.0.0", Protocol: api.ProtocolVersion}, nil, checkWarn},
+		{"same version", true, &api.VersionResponse{Version: version, Protocol: api.ProtocolVersion}, nil, checkPass},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := checkDaemonVersion(tc.running, tc.res, tc.err)
+			if r.Status != tc.expected {
+				t.Errorf("expected: %s, got: %s", tc.expected, r.Status)
+			}
+		})
+	}
+}
+
+func TestCheckDaemonEndpoint(t *testing.T) {
+	testCases := []struct {
+		name     string
+		endpoint *daemon.Endpoint
+		err      error
+		expected string
+	}{
+		{"error", nil, fmt.Errorf("no socket"), checkWarn},
+		{"not running", nil, nil, checkWarn},
+		{"socket", &daemon.Endpoint{Network: "unix", Address: "/home/user/.srcd/run/daemon.sock"}, nil, checkPass},
+		{"localhost", &daemon.Endpoint{Network: "tcp", Address: "127.0.0.1:4242"}, nil, checkPass},
+		{"public with TLS", &daemon.Endpoint{Network: "tcp", Address: "10.0.0.2:4242", Public: true, TLS: true}, nil, checkPass},
+		{"public without TLS", &daemon.Endpoint{Network: "tcp", Address: "10.0.0.2:4242", Public: true}, nil, checkWarn},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := checkDaemonEndpoint(tc.endpoint, tc.err)
+			if r.Status != tc.expected {
+				t.Errorf("expected: %s, got: %s", tc.expected, r.Status)
+			}
+		})
+	}
+}
+
+func TestCheckDaemonPort(t *testing.T) {
+	testCases := []struct {
+		name     string
+		report   *daemon.PortReport
+		err      error
+		dialErr  error
+		expected string
+	}{
+		{"error", nil, fmt.Errorf("docker is gone"), nil, checkWarn},
+		{"socket", nil, nil, nil, checkPass},
+		{"listening", &daemon.PortReport{Host: "127.0.0.1", Port: 4243, Published: []int{4243}}, nil, nil, checkPass},
+		{"not published", &daemon.PortReport{Host: "127.0.0.1", Port: 4242}, nil, nil, checkFail},
+		{"other port", &daemon.PortReport{Host: "127.0.0.1", Port: 4242, Published: []int{4243}}, nil, nil, checkFail},
+		{"not listening", &daemon.PortReport{Host: "127.0.0.1", Port: 4242, Published: []int{4242}},
+			nil, fmt.Errorf("connection refused"), checkFail},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := checkDaemonPort(tc.report, tc.err, tc.dialErr)
+			if r.Status != tc.expected {
+				t.Errorf("expected: %s, got: %s", tc.expected, r.Status)
+			}
+		})
+	}
+}
+
+func TestCheckGitbaseSettings(t *testing.T) {
+	testCases := []struct {
+		name     string
+		settings map[string]string
+		err      error
+		expected string
+		message  string
+	}{
+		{"error", nil, fmt.Errorf("no docker"), checkWarn, "could not get the settings of gitbase: no docker"},
+		{"not initialized", nil, nil, checkPass, "the engine is not initialized, gitbase uses its default settings"},
+		{
+			"settings",
+			map[string]string{"squash": "on", "cache-size": "4GiB", "max-memory": "default"},
+			nil, checkPass, "gitbase runs with cache-size 4GiB, max-memory default, squash on",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := checkGitbaseSettings(tc.settings, tc.err)
+			if r.Status != tc.expected {
+				t.Errorf("expected: %s, got: %s", tc.expected, r.Status)
+			}
+			if r.Message != tc.message {
+				t.Errorf("expected: %s, got: %s", tc.message, r.Message)
+			}
+		})
+	}
+}
+
+func TestCheckPilosa(t *testing.T) {
+	testCases := []struct {
+		name     string
+		running  bool
+		res      healthResult
+		err      error
+		expected string
+	}{
+		{"error", true, healthResult{}, fmt.Errorf("could not connect"), checkWarn},
+		{"not running", false, healthResult{}, nil, checkWarn},
+		{"disabled", true, healthResult{api.HealthPilosa, healthDisabled}, nil, checkPass},
+		{"serving", true, healthResult{api.HealthPilosa, "SERVING"}, nil, checkPass},
+		{"not serving", true, healthResult{api.HealthPilosa, "NOT_SERVING"}, nil, checkFail},
+		{"not probed yet", true, healthResult{api.HealthPilosa, "UNKNOWN"}, nil, checkWarn},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := checkPilosa(tc.running, tc.res, tc.err)
+			if r.Status != tc.expected {
+				t.Errorf("expected: %s, got: %s", tc.expected, r.Status)
+			}
+		})
+	}
+}
@@ -10,6 +10,7 @@ import (
 
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 	api "github.com/src-d/engine/api"
 	"github.com/src-d/engine/cmd/srcd/daemon"
 )
@@ -17,10 +18,10 @@ import (
 var parseDriversListCmd = &cobra.Command{
 	Use:   "list",
 	Short: "List installed language drivers.",
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		c, err := daemon.Client()
 		if err != nil {
-			logrus.Fatalf("could not get daemon client: %v", err)
+			return fmt.Errorf("could not get daemon client: %v", err)
 		}
 
 		// Might need to pull the image
@@ -29,31 +30,48 @@ var parseDriversListCmd = &cobra.Command{
 
 		drivers, err := c.ListDrivers(ctx, &api.ListDriversRequest{})
 		if err != nil {
-			logrus.Fatalf("could not list drivers: %v", err)
+			return fmt.Errorf("could not list drivers: %v", err)
 		}
 
+		pins := driverPins()
+
 		w := new(tabwriter.Writer)
 		defer w.Flush()
 		w.Init(os.Stdout, 0, 8, 5, '\t', 0)
-		fmt.Fprintln(w, "LANGUAGE\tVERSION")
-		fmt.Fprintln(w, "----------\t----------")
+		fmt.Fprintln(w, "LANGUAGE\tVERSION\tPINNED")
+		fmt.Fprintln(w, "----------\t----------\t----------")
 		for _, driver := range drivers.Drivers {
-			fmt.Fprintf(w, "%s\t%s\n", driver.Lang, driver.Version)
+			pin, ok := pins[strings.ToLower(driver.Lang)]
+			switch {
+			case !ok:
+				pin = "-"
+			case !sameVersion(pin, driver.Version):
+				pin += " (differs)"
+			}
+
+			fmt.Fprintf(w, "%s\t%s\t%s\n", driver.Lang, driver.Version, pin)
 		}
+		return nil
 	},
 }
 
 var parseDriversInstallCmd = &cobra.Command{
 	Use:   "install",
 	Short: "Install language drivers.",
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		c, err := daemon.Client()
 		if err != nil {
-			logrus.Fatalf("could not get daemon client: %v", err)
+			return fmt.Errorf("could not get daemon client: %v", err)
 		}
 
+		pins := driverPins()
+		ignorePins, _ := cmd.Flags().GetBool("ignore-pins")
 		for _, arg := range args {
 			lang, version, err := parseDriverWithVersion(arg)
+			if err == nil {
+				version, err = driverVersion(lang, version, pins, ignorePins)
+			}
+
 			if err != nil {
 				logrus.Error(err)
 				continue
@@ -71,20 +89,27 @@ var parseDriversInstallCmd = &cobra.Command{
 				logrus.Errorf("unable to install version %s of %s driver: %s", version, lang, err)
 			}
 		}
+		return nil
 	},
 }
 
 var parseDriversUpdateCmd = &cobra.Command{
 	Use:   "update",
 	Short: "Update installed language drivers.",
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		c, err := daemon.Client()
 		if err != nil {
-			logrus.Fatalf("could not get daemon client: %v", err)
+			return fmt.Errorf("could not get daemon client: %v", err)
 		}
 
+		pins := driverPins()
+		ignorePins, _ := cmd.Flags().GetBool("ignore-pins")
 		for _, arg := range args {
 			lang, version, err := parseDriverWithVersion(arg)
+			if err == nil {
+				version, err = driverVersion(lang, version, pins, ignorePins)
+			}
+
 			if err != nil {
 				logrus.Error(err)
 				continue
@@ -102,16 +127,17 @@ var parseDriversUpdateCmd = &cobra.Command{
 				logrus.Errorf("unable to update %s driver to version %s: %s", lang, version, err)
 			}
 		}
+		return nil
 	},
 }
 
 var parseDriversRemoveCmd = &cobra.Command{
 	Use:   "remove",
 	Short: "Remove installed language drivers.",
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		c, err := daemon.Client()
 		if err != nil {
-			logrus.Fatalf("could not get daemon client: %v", err)
+			return fmt.Errorf("could not get daemon client: %v", err)
 		}
 
 		for _, lang := range args {
@@ -120,9 +146,10 @@ var parseDriversRemoveCmd = &cobra.Command{
 			_, err = c.RemoveDriver(ctx, &api.RemoveDriverRequest{Language: lang})
 			cancel()
 			if err != nil {
-				logrus.Fatalf("unable to remove drivers: %s", err)
+				return fmt.Errorf("unable to remove drivers: %s", err)
 			}
 		}
+		return nil
 	},
 }
 
@@ -137,11 +164,46 @@ func parseDriverWithVersion(arg string) (lang, version string, err error) {
 		return "", "", fmt.Errorf("invalid argument format: %s", arg)
 	}
 
+	return
+}
+
+// driverPins returns the driver versions pinned in the drivers section of the
+// config file, by language:
+//
+//	drivers:
+//	  python: v2.8.0
+//	  go: v2.5.1
+func driverPins() map[string]string {
+	pins := make(map[string]string)
+	for lang, version := range viper.GetStringMapString("drivers") {
+		pins[strings.ToLower(lang)] = strings.TrimSpace(version)
+	}
+	return pins
+}
+
+// driverVersion returns the version of a driver to install or update to. If no
+// version is given the pinned one is used, or latest if it's not pinned. A
+// version other than the pinned one is only allowed with ignorePins.
+func driverVersion(lang, version string, pins map[string]string, ignorePins bool) (string, error) {
+	pin, ok := pins[lang]
+	switch {
+	case !ok || ignorePins:
+	case version == "":
+		return pin, nil
+	case !sameVersion(version, pin):
+		return "", fmt.Errorf("%s driver is pinned to version %s, use --ignore-pins to use version %s", lang, pin, version)
+	}
+
 	if version == "" {
 		version = "latest"
 	}
+	return version, nil
+}
 
-	return
+// sameVersion reports whether both versions are the same, with or without
+// the v prefix.
+func sameVersion(a, b string) bool {
+	return strings.TrimPrefix(a, "v") == strings.TrimPrefix(b, "v")
 }
 
 func init() {
@@ -149,4 +211,8 @@ func init() {
 	parseDriversCmd.AddCommand(parseDriversInstallCmd)
 	parseDriversCmd.AddCommand(parseDriversUpdateCmd)
 	parseDriversCmd.AddCommand(parseDriversRemoveCmd)
+
+	parseDriversInstallCmd.Flags().Bool("ignore-pins", false, "ignore the driver versions pinned in the config file")
+	parseDriversUpdateCmd.Flags().Bool("ignore-pins", false, "ignore the driver versions pinned in the config file")
+	addConfigSection("drivers")
 }
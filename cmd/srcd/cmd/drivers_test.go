@@ -0,0 +1,44 @@
+package cmd
+
+import "testing"
+
+func TestDriverVersion(t *testing.T) {
+	pins := map[string]string{"python": "v2.8.0"}
+
+	testCases := []struct {
+		name       string
+		lang       string
+		version    string
+		ignorePins bool
+		expected   string
+		err        bool
+	}{
+		{"not pinned", "go", "", false, "latest", false},
+		{"not pinned with version", "go", "v2.5.1", false, "v2.5.1", false},
+		{"pinned", "python", "", false, "v2.8.0", false},
+		{"pinned same version", "python", "2.8.0", false, "2.8.0", false},
+		{"pinned other version", "python", "v2.9.0", false, "", true},
+		{"ignore pins", "python", "v2.9.0", true, "v2.9.0", false},
+		{"ignore pins without version", "python", "", true, "latest", false},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := driverVersion(tt.lang, tt.version, pins, tt.ignorePins)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("expected an error, got version %s", result)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if result != tt.expected {
+				t.Errorf("expected: %s, got: %s", tt.expected, result)
+			}
+		})
+	}
+}
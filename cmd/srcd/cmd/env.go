@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/src-d/engine/cmd/srcd/daemon"
+	"github.com/src-d/engine/docker"
+)
+
+// envListTimeout is how long srcd env list can take to get the resources used
+// by the environments.
+const envListTimeout = 30 * time.Second
+
+var envCmd = &cobra.Command{
+	Use:   "env",
+	Short: "Manage the environments of the engine",
+	Long: `Manage the environments of the engine
+
+An environment is a daemon with its own components, network, volumes and
+ports, for a working directory. The commands act on the one given with --name,
+or on the default one, so several unrelated working directories can be
+analyzed at once, like with srcd init --name clientA ~/work/clientA and then
+srcd --name clientA sql.`,
+}
+
+var envListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the environments with their working directories and resources",
+	Long: `List the environments with their working directories and resources
+
+Shows every environment with containers or volumes of the engine, with the
+working directory of its daemon, the number of its containers running, the
+memory they use and the disk space used by its volumes. The current one, the
+one given with --name, is marked with *.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		out, err := outputFormat(cmd)
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), envListTimeout)
+		defer cancel()
+
+		envs, err := daemon.Environments(ctx)
+		if err != nil {
+			return fmt.Errorf("could not list the environments: %v", err)
+		}
+
+		list := environmentList(ctx, envs)
+		return out.print(os.Stdout, "environment", list, func(w io.Writer) error {
+			return printEnvironments(w, list)
+		})
+	},
+}
+
+// environment is an environment as printed by srcd env list.
+type environment struct {
+	Name       string `json:"name"`
+	Current    bool   `json:"current"`
+	Workdir    string `json:"workdir"`
+	Containers int    `json:"containers"`
+	Running    int    `json:"running"`
+	// Memory is the memory used by the containers running in bytes.
+	Memory uint64 `json:"memory"`
+	// Disk is the disk space used by the volumes in bytes.
+	Disk int64 `json:"disk"`
+}
+
+// environmentList returns the environments with the memory used by their
+// containers running, got at the same time.
+func environmentList(ctx context.Context, envs []*daemon.Environment) []*environment {
+	list := make([]*environment, len(envs))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i, env := range envs {
+		e := &environment{
+			Name:       env.Name,
+			Current:    env.Name == docker.Environment(),
+			Workdir:    env.Workdir,
+			Containers: len(env.Containers),
+			Running:    len(env.Running),
+			Disk:       env.VolumesSize,
+		}
+		list[i] = e
+
+		for _, name := range env.Running {
+			wg.Add(1)
+			go func(name string) {
+				defer wg.Done()
+				err := docker.StreamStats(ctx, name, false, func(s *docker.Stats) {
+					mu.Lock()
+					e.Memory += memoryUsage(s)
+					mu.Unlock()
+				})
+				if err != nil && err != docker.ErrNotFound {
+					logrus.Debugf("could not get the stats of %s: %v", name, err)
+				}
+			}(name)
+		}
+	}
+	wg.Wait()
+	return list
+}
+
+func printEnvironments(w io.Writer, envs []*environment) error {
+	tw := new(tabwriter.Writer)
+	tw.Init(w, 0, 8, 5, '\t', 0)
+	fmt.Fprintln(tw, "NAME\tWORKDIR\tRUNNING\tMEMORY\tVOLUMES")
+	fmt.Fprintln(tw, "----------\t----------\t----------\t----------\t----------")
+	for _, e := range envs {
+		name := e.Name
+		if e.Current {
+			name += " *"
+		}
+
+		workdir := e.Workdir
+		if workdir == "" {
+			workdir = "-"
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%d/%d\t%s\t%s\n", name, workdir, e.Running, e.Containers,
+			bytesSize(e.Memory), humanSize(e.Disk))
+	}
+	return tw.Flush()
+}
+
+func init() {
+	rootCmd.AddCommand(envCmd)
+	envCmd.AddCommand(envListCmd)
+	addOutputFlags(envListCmd, false)
+}
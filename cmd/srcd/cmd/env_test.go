@@ -0,0 +1,26 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPrintEnvironments(t *testing.T) {
+	envs := []*environment{
+		{Name: "clientA", Current: true, Workdir: "/home/user/work/clientA", Containers: 3, Running: 2, Memory: 512 * 1024 * 1024, Disk: 2300000000},
+		{Name: "default", Containers: 0},
+	}
+
+	var buf bytes.Buffer
+	if err := printEnvironments(&buf, envs); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "NAME\t\tWORKDIR\t\t\t\tRUNNING\t\tMEMORY\t\tVOLUMES\n" +
+		"----------\t----------\t\t\t----------\t----------\t----------\n" +
+		"clientA *\t/home/user/work/clientA\t\t2/3\t\t512MiB\t\t2.3GB\n" +
+		"default\t\t-\t\t\t\t0/0\t\t0B\t\t0B\n"
+	if buf.String() != expected {
+		t.Errorf("expected: %s, got: %s", expected, buf.String())
+	}
+}
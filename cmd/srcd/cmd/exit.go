@@ -0,0 +1,216 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/docker/docker/client"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/src-d/engine/components"
+	"github.com/src-d/engine/docker"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Exit codes of srcd, so the scripts wrapping it can tell the errors apart.
+const (
+	exitOK = 0
+	// exitError is any error not covered by the others.
+	exitError       = 1
+	exitUsage       = 2
+	exitDocker      = 3
+	exitNotRunning  = 4
+	exitFailed      = 5
+	exitInterrupted = 130
+)
+
+// exitCodes documents the exit codes, printed by srcd help exit-codes.
+var exitCodes = []struct {
+	code        int
+	description string
+}{
+	{exitOK, "success"},
+	{exitError, "any other error"},
+	{exitUsage, "invalid usage: unknown command or flag, invalid arguments or configuration"},
+	{exitDocker, "docker can't be reached"},
+	{exitNotRunning, "the engine is not initialized, or a component needed is not installed or running"},
+	{exitFailed, "an operation failed: pulling an image, parsing or querying"},
+	{exitInterrupted, "interrupted with Ctrl+C"},
+}
+
+// codedError is an error with the exit code it maps to.
+type codedError struct {
+	code int
+	err  error
+}
+
+func (e *codedError) Error() string { return e.err.Error() }
+
+// Cause returns the wrapped error, for errors.Cause.
+func (e *codedError) Cause() error { return e.err }
+
+// usageErrorf returns an error for invalid arguments found by a command.
+func usageErrorf(format string, args ...interface{}) error {
+	return &codedError{exitUsage, fmt.Errorf(format, args...)}
+}
+
+// notRunningErrorf returns an error for the engine, or a component, not
+// initialized or not running.
+func notRunningErrorf(format string, args ...interface{}) error {
+	return &codedError{exitNotRunning, fmt.Errorf(format, args...)}
+}
+
+// disabledErrorf returns the error for using a component disabled on init,
+// telling how to enable it.
+func disabledErrorf(c components.Component) error {
+	return notRunningErrorf("%s", components.DisabledMessage(c, "+"+c.ShortName()))
+}
+
+// operationFailed marks the error of an operation that failed, like pulling
+// an image.
+func operationFailed(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &codedError{exitFailed, err}
+}
+
+// exitStatus is returned by the commands that already printed why they
+// failed, like srcd doctor, to exit with its code printing nothing else.
+type exitStatus int
+
+func (e exitStatus) Error() string { return fmt.Sprintf("exit status %d", int(e)) }
+
+// runError is an error returned by a command when it runs, unlike the usage
+// errors found by cobra before.
+type runError struct {
+	err error
+}
+
+func (e *runError) Error() string { return e.err.Error() }
+
+// markRunErrors wraps the errors returned by the commands when they run in
+// runError, so the ones found by cobra before are known to be usage errors.
+func markRunErrors(c *cobra.Command) {
+	if run := c.RunE; run != nil {
+		c.RunE = func(cmd *cobra.Command, args []string) error {
+			if err := run(cmd, args); err != nil {
+				return &runError{err}
+			}
+			return nil
+		}
+	}
+
+	for _, sub := range c.Commands() {
+		markRunErrors(sub)
+	}
+}
+
+// exitCode returns the exit code the error returned by Execute maps to.
+func exitCode(err error) int {
+	if err == nil {
+		return exitOK
+	}
+
+	if run, ok := err.(*runError); ok {
+		err = run.err
+	} else if !hasCode(err) {
+		return exitUsage
+	}
+
+	// The codes given explicitly go first, and the first one found while
+	// unwrapping the error wins.
+	for e := err; e != nil; {
+		switch c := e.(type) {
+		case *codedError:
+			return c.code
+		case exitStatus:
+			return int(c)
+		}
+
+		cause, ok := e.(interface{ Cause() error })
+		if !ok {
+			break
+		}
+		e = cause.Cause()
+	}
+
+	cause := errors.Cause(err)
+	switch {
+	case cause == context.Canceled:
+		return exitInterrupted
+	case client.IsErrConnectionFailed(err):
+		return exitDocker
+	case cause == components.ErrNotSrcd:
+		return exitUsage
+	case cause == docker.ErrNotFound || cause == docker.ErrImageNotFound:
+		return exitNotRunning
+	case cause == components.ErrInUse:
+		return exitFailed
+	}
+
+	if s, ok := status.FromError(cause); ok && s.Code() != codes.OK {
+		switch s.Code() {
+		case codes.Unavailable:
+			return exitNotRunning
+		case codes.InvalidArgument:
+			return exitUsage
+		case codes.Canceled:
+			return exitInterrupted
+		default:
+			return exitFailed
+		}
+	}
+
+	return exitError
+}
+
+// cobraError reports whether the error was found by cobra before running the
+// command, like an unknown flag.
+func cobraError(err error) bool {
+	_, ok := err.(*runError)
+	return !ok && !hasCode(err)
+}
+
+func hasCode(err error) bool {
+	switch err.(type) {
+	case *codedError, exitStatus:
+		return true
+	default:
+		return false
+	}
+}
+
+// silent reports whether the error was already printed by the command.
+func silent(err error) bool {
+	if run, ok := err.(*runError); ok {
+		err = run.err
+	}
+	_, ok := err.(exitStatus)
+	return ok
+}
+
+// exitCodesCmd is a help topic, shown by srcd help exit-codes.
+var exitCodesCmd = &cobra.Command{
+	Use:   "exit-codes",
+	Short: "The exit codes of the commands",
+	Long:  exitCodesHelp(),
+}
+
+func exitCodesHelp() string {
+	var b strings.Builder
+	b.WriteString("The exit codes of the commands\n\n")
+	b.WriteString("Every command exits with one of these codes, so the scripts using srcd can\n")
+	b.WriteString("tell the errors apart. When a command fails with any other error and docker\n")
+	fmt.Fprintf(&b, "can't be reached, it exits with %d.\n\n", exitDocker)
+	for _, c := range exitCodes {
+		fmt.Fprintf(&b, "  %3d  %s\n", c.code, c.description)
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+func init() {
+	rootCmd.AddCommand(exitCodesCmd)
+}
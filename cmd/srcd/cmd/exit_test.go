@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/client"
+	"github.com/pkg/errors"
+	"github.com/src-d/engine/components"
+	"github.com/src-d/engine/docker"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestExitCode(t *testing.T) {
+	testCases := []struct {
+		name     string
+		err      error
+		expected int
+	}{
+		{"no error", nil, exitOK},
+		{"unknown flag", fmt.Errorf("unknown flag: --foo"), exitUsage},
+		{"usage", &runError{usageErrorf("unknown component %s", "foo")}, exitUsage},
+		{"config", &codedError{exitUsage, fmt.Errorf("invalid config")}, exitUsage},
+		{"not srcd", &runError{components.ErrNotSrcd}, exitUsage},
+		{"docker unreachable", &runError{errors.Wrap(client.ErrorConnectionFailed("unix:///var/run/docker.sock"), "could not list containers")}, exitDocker},
+		{"not running", &runError{notRunningErrorf("the engine is not initialized")}, exitNotRunning},
+		{"disabled", &runError{disabledErrorf(components.Gitbase)}, exitNotRunning},
+		{"container not found", &runError{errors.Wrap(docker.ErrNotFound, "could not inspect")}, exitNotRunning},
+		{"daemon unavailable", &runError{status.Error(codes.Unavailable, "connection refused")}, exitNotRunning},
+		{"invalid argument", &runError{status.Error(codes.InvalidArgument, "bad query")}, exitUsage},
+		{"sql error", &runError{status.Error(codes.Unknown, "table not found")}, exitFailed},
+		{"pull failed", &runError{operationFailed(fmt.Errorf("could not pull"))}, exitFailed},
+		{"in use", &runError{components.ErrInUse}, exitFailed},
+		{"interrupted", &runError{errors.Wrap(context.Canceled, "could not parse")}, exitInterrupted},
+		{"exit status", &runError{exitStatus(exitNotRunning)}, exitNotRunning},
+		{"outer code wins", &runError{&codedError{exitUsage, operationFailed(fmt.Errorf("could not pull"))}}, exitUsage},
+		{"other", &runError{fmt.Errorf("something went wrong")}, exitError},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := exitCode(tc.err); got != tc.expected {
+				t.Errorf("expected: %d, got: %d", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestExitCodesHelp(t *testing.T) {
+	help := exitCodesHelp()
+	for _, c := range exitCodes {
+		line := fmt.Sprintf("%3d  %s", c.code, c.description)
+		if !strings.Contains(help, line) {
+			t.Errorf("expected: %s, got: %s", line, help)
+		}
+	}
+}
@@ -15,62 +15,1179 @@
 package cmd
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
+	"github.com/docker/docker/api/types"
+	units "github.com/docker/go-units"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	api "github.com/src-d/engine/api"
 	"github.com/src-d/engine/cmd/srcd/daemon"
+	"github.com/src-d/engine/components"
+	"github.com/src-d/engine/docker"
 )
 
 // initCmd represents the init command
 var initCmd = &cobra.Command{
-	Use:   "init",
+	Use:   "init [workdir] [dir...]",
 	Short: "Starts the daemon or restarts it if already running.",
-	Run: func(cmd *cobra.Command, args []string) {
-		if len(args) > 1 {
-			logrus.Fatal("invalid number of arguments given, expecting 0 or 1")
+	Long: `Starts the daemon or restarts it if already running.
+
+If the daemon is already running for the same working directory and with the
+same options, the running components are kept along with their caches, and
+only the ones not running, like the ones stopped with srcd stop, are started.
+The ones whose container exited or is unhealthy are created again. If only
+the bblfshd options changed, only the daemon and bblfshd are restarted. If
+only --pilosa-port, --expose-pilosa, --pilosa-memory or --pilosa-cache-size
+changed, the daemon, pilosa and gitbase, which is given the address of
+pilosa, are. Without --pilosa-memory and --pilosa-cache-size, pilosa is
+limited to a quarter of the memory of docker, and its caches to a quarter of
+its limit.
+
+Use --force to get out of a broken state: all the containers of the engine,
+running or not, and their network are removed and everything is started fresh
+from the existing images. Unlike srcd kill, images and data are kept, so
+nothing is downloaded again and the installed drivers and indexes survive,
+unless --reset-data is also given, which removes the bblfsh drivers volume and
+the gitbase and pilosa indexes of the working directory too.
+
+More than one directory with repositories can be given, as arguments or with
+--repos. The first one is the working directory. When there's more than one,
+each of them is mounted read-only into gitbase in a subdirectory named after
+it, so the repositories of all of them can be queried together. Changing the
+directories on a later init recreates the containers.
+
+The working directory is mounted read-only too, as gitbase only reads the
+repositories, and init checks gitbase can still list them. --writable-workdir
+mounts it writable instead; changing it recreates the daemon and gitbase.
+Pilosa only mounts its own data directory.
+
+When DOCKER_HOST is another machine, a bind mount would be a directory of that
+host, so init asks whether to copy the working directory into the volume
+srcd-cli-workdir there instead, mounted in gitbase in its place, or warns
+without a terminal. --sync-workdir on or off answers it, and can be set in the
+config file. Every later init copies only the files whose size or modification
+time changed, and removes the ones removed, as srcd workdir sync does, logging
+the progress of big copies. The addresses printed at the end are the ones of
+that host.
+
+The directories are resolved to their real path, following symlinks, as
+that's what docker mounts. Directories in network shares are rejected, and on
+macOS a warning is shown for those not shared with Docker Desktop.
+
+Before starting, the directories are scanned looking for git repositories
+(worktrees, bare repositories and siva files), warning if none is found as
+gitbase would have no data, and checking gitbase will be able to read them
+given how docker runs the containers. With --strict init fails instead.
+
+The repositories rarely queried, like huge mirrors, can be hidden from gitbase
+with --exclude-repo and a pattern like in .gitignore, relative to the working
+directory, like --exclude-repo 'mirrors/' or --exclude-repo '*-mirror'. Init
+tells how many repositories every pattern excluded, and srcd status lists
+them.
+
+The version of gitbase, bblfshd, gitbase-web and bblfsh-web can be pinned
+with --gitbase-version v0.24.0 and the like. Init checks the version is
+published before removing anything, records it in the components.versions
+section of the config file, so every command installs and runs it, and
+recreates the container. --gitbase-version default unpins it.
+
+Only some of the components can be enabled with --components, or some left
+out with --without, like --without pilosa. The components required by the
+enabled ones are enabled too: gitbase-web and gitbase need gitbase and
+bblfshd, and bblfsh-web needs bblfshd. Using a disabled component later fails
+telling how to enable it. Components can also be added to or removed from the
+ones enabled on the last init, like --components +pilosa, which only creates
+the daemon and the components added or removed again, along with gitbase when
+it's pilosa, keeping the rest running. Without pilosa, gitbase refuses to
+create indexes instead of waiting for it.
+
+Init runs in steps: checking docker, pulling the images, starting the daemon
+and every enabled component, waiting for the daemon to report pilosa healthy
+and for gitbase to accept queries, and installing the drivers. gitbase is
+ready once it answers a SELECT 1 at its port, which can take minutes with
+thousands of repositories; meanwhile its progress loading them is printed. If
+it's not ready --init-timeout after init started, 15m by default, init fails
+showing the last lines of its logs. The web clients are not started, srcd web
+does it. Every step is printed as it finishes with the time it took, and if
+any fails the last lines of the logs of its container are shown. With
+--json-progress a JSON event is printed instead when every step starts and
+finishes.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		timeout, _ := cmd.Flags().GetDuration("init-timeout")
+		if timeout <= 0 {
+			return usageErrorf("invalid value of --init-timeout %s: it must be positive", timeout)
+		}
+		initDeadline = time.Now().Add(timeout)
+
+		repos, _ := cmd.Flags().GetStringSlice("repos")
+		dirs, err := initDirectories(append(args, repos...))
+		if err != nil {
+			return err
+		}
+		workdir := dirs[0]
+
+		opts := daemon.Options{
+			BblfshMemory:     viper.GetString("bblfsh.memory"),
+			BblfshMaxDrivers: viper.GetInt("bblfsh.max-drivers"),
+		}
+
+		if opts.BblfshMemory != "" {
+			if _, err := units.RAMInBytes(opts.BblfshMemory); err != nil {
+				return usageErrorf("invalid bblfsh memory limit: %v", err)
+			}
+		}
+
+		if opts.BblfshMaxDrivers < 0 {
+			return usageErrorf("invalid number of bblfsh drivers %d", opts.BblfshMaxDrivers)
+		}
+
+		gitbaseOpts, err := gitbaseOptions()
+		if err != nil {
+			return err
+		}
+
+		pilosaOpts, err := pilosaOptions()
+		if err != nil {
+			return err
+		}
+		gitbaseOpts.WritableWorkdir, _ = cmd.Flags().GetBool("writable-workdir")
+		gitbaseOpts.Metrics = viper.GetBool("gitbase.metrics")
+
+		cmps, err := initComponents(cmd)
+		if err != nil {
+			return err
+		}
+
+		// The versions are checked before anything is removed, so a typo
+		// doesn't leave the engine down.
+		if err := applyVersionFlags(cmd); err != nil {
+			return err
+		}
+
+		if err := applyWebPortFlags(cmd); err != nil {
+			return err
+		}
+
+		force, _ := cmd.Flags().GetBool("force")
+		resetData, _ := cmd.Flags().GetBool("reset-data")
+		if resetData && !force {
+			return usageErrorf("--reset-data can only be used along with --force")
+		}
+
+		syncValue := viper.GetString("workdir.sync")
+		if err := checkSyncWorkdir(syncValue); err != nil {
+			return usageErrorf("invalid --sync-workdir %s: %v", syncValue, err)
 		}
 
-		ok, err := daemon.IsRunning()
+		strict, _ := cmd.Flags().GetBool("strict")
+		format, _ := cmd.Flags().GetString("format")
+		values, _ := cmd.Flags().GetStringArray("exclude-repo")
+		excludes, err := parseRepoPatterns(values)
 		if err != nil {
-			logrus.Fatal(err)
+			return err
 		}
 
-		if ok {
+		scan, format, err := checkRepositories(dirs, format, strict, excludes)
+		if err != nil {
+			return err
+		}
+
+		skipNested, _ := cmd.Flags().GetBool("skip-nested")
+		includeBare, _ := cmd.Flags().GetBool("include-bare")
+		policy := daemon.RepoPolicy{SkipNested: skipNested, IncludeBare: includeBare}
+
+		var hidden []string
+		if format == repoFormatGit {
+			hidden = append(excludedPaths(scan), applyRepoPolicy(scan, policy)...)
+		}
+
+		jsonProgress, _ := cmd.Flags().GetBool("json-progress")
+		// With --json-progress, or --output-mode json, the events are printed to
+		// stdout, so anything else is moved to stderr.
+		reporter := commandStepReporter()
+		out := io.Writer(os.Stdout)
+		if jsonProgress || machineOutput() {
+			reporter = newStepReporter(os.Stdout, false, true)
+			out = os.Stderr
+		}
+
+		if r, ok := reporter.(*ttyStepReporter); ok {
+			logrus.SetOutput(r)
+			defer logrus.SetOutput(os.Stderr)
+		}
+
+		err = runSteps(reporter, []initStep{{
+			name: "check docker",
+			run: func() error {
+				_, err := daemon.DockerVersion()
+				return err
+			},
+		}})
+		if err != nil {
+			return err
+		}
+
+		// Docker is needed to know how many CPUs gitbase will have.
+		if gitbaseOpts.Parallelism == 0 {
+			gitbaseOpts.Parallelism = defaultGitbaseParallelism()
+		}
+
+		datadir, err := daemon.ResolveDataDir(daemon.DataDir)
+		if err != nil {
+			return usageErrorf("invalid data directory: %v", err)
+		}
+
+		gitbaseOpts.Password, err = resolveGitbasePassword(datadir, gitbaseOpts.Password)
+		if err != nil {
+			return err
+		}
+
+		cfg := &daemon.Config{
+			Workdir:        workdir,
+			Repos:          dirs[1:],
+			Format:         format,
+			Gitbase:        gitbaseOpts,
+			Pilosa:         pilosaOpts,
+			Components:     cmps,
+			DataDir:        datadir,
+			RepoPolicy:     policy,
+			Hidden:         hidden,
+			Excluded:       values,
+			Images:         components.Overrides(),
+			Options:        opts,
+			TLS:            daemon.Auth.TLS && !daemon.UsesSocket(),
+			Port:           daemon.ConfiguredPort(),
+			MetricsAddress: daemon.MetricsAddress,
+			LogFormat:      daemon.LogFormat,
+			Probes:         daemon.Probes,
+			DrainTimeout:   daemon.DrainTimeout,
+		}
+		running, err := daemon.Running()
+		if err != nil {
+			return err
+		}
+
+		remote := daemon.RemoteDockerHost()
+		sync, ask, err := resolveWorkdirSync(syncValue, remote, running != nil && running.WorkdirVolume != "")
+		if err != nil {
+			return err
+		}
+		if ask {
+			sync = askWorkdirSync(remote, workdir)
+		}
+
+		if sync {
+			if len(cfg.Repos) > 0 {
+				return usageErrorf("only the working directory is synced into a volume, " +
+					"move the directories given with --repos into it, or use --sync-workdir off")
+			}
+			cfg.WorkdirVolume = components.WorkdirVolume
+		}
+
+		// Daemons started before the data directory was configurable don't
+		// have it in their labels, they use the default one.
+		if running != nil && running.DataDir != "" && running.DataDir != datadir && !force {
+			return fmt.Errorf("the engine keeps its data in %s; move it to %s and "+
+				"re-run init with --force, or keep using --data-dir %s",
+				running.DataDir, datadir, running.DataDir)
+		}
+
+		if err := cfg.CheckVolumes(); err != nil {
+			return err
+		}
+
+		// Recorded so the daemon isn't recreated later with the default one
+		// when it's not in the config file.
+		if err := daemon.RecordDataDir(datadir); err != nil {
+			return err
+		}
+
+		var steps []initStep
+		switch {
+		case force:
+			logrus.Infof("removing all the containers to start them fresh")
+			steps = append(steps, initStep{name: "remove containers and network", run: daemon.KillAll})
+			if resetData {
+				steps = append(steps, initStep{
+					name: "remove data",
+					run:  func() error { return daemon.ResetData(cfg) },
+				})
+			}
+		case running == nil:
+		case !running.SameDirectories(cfg):
 			logrus.Infof("daemon already running, killing it first")
-			if err := daemon.Kill(); err != nil {
-				logrus.Fatal(err)
+			steps = append(steps, initStep{name: "remove running containers", run: daemon.Kill})
+		case !running.SameComponents(cfg):
+			changed := componentsToRecreate(running, cfg)
+			logrus.Infof("enabled components changed, recreating the daemon%s", andNames(shortNames(changed)))
+			steps = append(steps, initStep{
+				name: "remove daemon" + andNames(shortNames(changed)),
+				run:  func() error { return daemon.KillComponents(changed) },
+			})
+		case len(running.ChangedImages(cfg)) > 0:
+			changed := running.ChangedImages(cfg)
+			names := strings.Join(shortNames(changed), ", ")
+			logrus.Infof("images of %s changed, recreating them and the daemon", names)
+			steps = append(steps, initStep{
+				name: "remove daemon and " + names,
+				run:  func() error { return daemon.KillComponents(changed) },
+			})
+		case running.Gitbase != cfg.Gitbase:
+			logrus.Infof("gitbase options or the mount of the working directory changed, recreating the daemon and gitbase")
+			// gitbase-web connects to gitbase with its credentials.
+			steps = append(steps, initStep{
+				name: "remove daemon, gitbase and gitbase-web",
+				run: func() error {
+					return daemon.KillComponents([]string{components.Gitbase.Name, components.GitbaseWeb.Name})
+				},
+			})
+		case !running.SamePilosa(cfg):
+			logrus.Infof("pilosa port, exposure or memory changed, recreating the daemon, pilosa and gitbase")
+			// gitbase is given the address of pilosa when it's created.
+			steps = append(steps, initStep{
+				name: "remove daemon, pilosa and gitbase",
+				run: func() error {
+					return daemon.KillComponents([]string{components.Pilosa.Name, components.Gitbase.Name})
+				},
+			})
+		case running.Options != opts:
+			logrus.Infof("bblfshd options changed, restarting the daemon and bblfshd")
+			steps = append(steps, initStep{name: "remove daemon and bblfshd", run: daemon.KillBblfshd})
+		case running.TLS != cfg.TLS || !running.SamePort(cfg):
+			logrus.Infof("TLS or port of the daemon changed, recreating the daemon")
+			steps = append(steps, initStep{
+				name: "remove daemon",
+				run:  func() error { return daemon.KillComponents(nil) },
+			})
+		case running.MetricsAddress != cfg.MetricsAddress || !running.SameLogFormat(cfg) ||
+			!running.SameProbes(cfg) || !running.SameDrainTimeout(cfg):
+			logrus.Infof("metrics endpoint, log format, health checks or drain timeout of the daemon changed, recreating the daemon")
+			steps = append(steps, initStep{
+				name: "remove daemon",
+				run:  func() error { return daemon.KillComponents(nil) },
+			})
+		default:
+			logrus.Infof("already initialized for %s, only starting the components not running", workdir)
+			if step := syncWorkdirStep(cfg); step != nil {
+				steps = append(steps, *step)
+			}
+			steps = append(steps, componentSteps(cfg, true)...)
+			if step := installDriversStep(cmd, workdir, out); step != nil {
+				steps = append(steps, *step)
+			}
+
+			if err := runSteps(reporter, steps); err != nil {
+				return err
 			}
+			return printInitAddresses(out, cfg)
 		}
 
-		var workdir string
-		if len(args) > 0 {
-			workdir = args[0]
+		logrus.Infof("starting daemon with working directory: %s", workdir)
+		for _, repo := range cfg.Repos {
+			logrus.Infof("mounting repositories directory: %s", repo)
+		}
+		if format == repoFormatSiva {
+			logrus.Infof("repositories: siva files")
+		} else {
+			logrus.Infof("repositories: %s", policy)
 		}
+		if settings, err := gitbaseOpts.Settings(); err == nil {
+			m := settings.Map()
+			logrus.Infof("gitbase squash: %s, cache size: %s, max memory: %s, connection timeout: %s",
+				m["squash"], m["cache-size"], m["max-memory"], m["conn-timeout"])
+			logrus.Infof("gitbase query timeout: %s, max connections: %s, parallelism: %s, metrics: %s, log level: %s",
+				m["query-timeout"], m["max-connections"], m["parallelism"], m["metrics"], m["log-level"])
+		}
+		if cfg.WorkdirVolume != "" {
+			logrus.Infof("working directory synced into volume %s of %s, mounted %s in gitbase",
+				cfg.WorkdirVolume, valueOrDefault(remote, "this machine"), components.WorkdirMode(gitbaseOpts.WritableWorkdir))
+		} else {
+			logrus.Infof("working directory mounted %s in gitbase",
+				components.WorkdirMode(gitbaseOpts.WritableWorkdir))
+		}
+		if gitbaseOpts.Password != "" {
+			logrus.Infof("gitbase user: %s, password stored in %s",
+				valueOrDefault(gitbaseOpts.User, components.DefaultGitbaseUser), daemon.GitbasePasswordFile(datadir))
+		}
+		logrus.Infof("bblfshd memory limit: %s, max drivers: %s",
+			valueOrDefault(opts.BblfshMemory, "none"),
+			valueOrDefault(fmt.Sprint(opts.BblfshMaxDrivers), "default"))
+		logrus.Infof("pilosa port: %d, exposed on: %s, memory limit: %s, cache size: %s",
+			pilosaOpts.EffectivePort(), valueOrDefault(pilosaOpts.Expose, "none"),
+			valueOrDefault(pilosaOpts.Memory, "none"), valueOrDefault(pilosaOpts.CacheSize, "default"))
 
-		workdir = strings.TrimSpace(workdir)
-		if workdir == "" {
-			workdir, err = os.Getwd()
-			if err != nil {
-				logrus.Fatal(err)
+		steps = append(steps, startSteps(cfg)...)
+		if step := installDriversStep(cmd, workdir, out); step != nil {
+			steps = append(steps, *step)
+		}
+
+		if err := runSteps(reporter, steps); err != nil {
+			return err
+		}
+		return printInitAddresses(out, cfg)
+	},
+}
+
+// printInitAddresses prints the addresses of the components started, like
+// the DSN of gitbase, to w, or as address records to stdout with
+// --output-mode json.
+func printInitAddresses(w io.Writer, cfg *daemon.Config) error {
+	var statuses []*components.Status
+	for _, c := range enabledComponents(cfg) {
+		ctx, cancel := context.WithTimeout(context.Background(), statusTimeout)
+		s, err := components.GetStatus(ctx, c, false)
+		cancel()
+		if err != nil {
+			logrus.Warnf("could not get the address of %s: %v", c.ShortName(), err)
+			continue
+		}
+		statuses = append(statuses, s)
+	}
+
+	if machineOutput() {
+		w = os.Stdout
+	}
+
+	addresses := components.Addresses(statuses, daemon.RemoteDockerHost(), "")
+	return newRecordWriter(w).write("address", addresses, func(w io.Writer) error {
+		for _, a := range addresses {
+			fmt.Fprintf(w, "%s: %s\n", a.Description, a.Address)
+		}
+		return nil
+	})
+}
+
+// shortNames returns the short names of the components with the given names.
+func shortNames(names []string) []string {
+	var result []string
+	for _, name := range names {
+		if c, ok := components.ByName(name); ok {
+			name = c.ShortName()
+		}
+		result = append(result, name)
+	}
+	return result
+}
+
+// andNames returns the given names after " and ", to add them to a message,
+// or nothing if there are none.
+func andNames(names []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	return " and " + strings.Join(names, ", ")
+}
+
+// componentsToRecreate returns the names of the components enabled in only
+// one of the configurations, which are removed or started, and gitbase when
+// it's pilosa, as gitbase is told where pilosa is when it's created.
+func componentsToRecreate(running, cfg *daemon.Config) []string {
+	var names []string
+	for _, c := range components.All {
+		if running.Enabled(c.Name) != cfg.Enabled(c.Name) {
+			names = append(names, c.Name)
+		}
+	}
+
+	pilosa := running.Enabled(components.Pilosa.Name) != cfg.Enabled(components.Pilosa.Name)
+	if pilosa && running.Enabled(components.Gitbase.Name) && cfg.Enabled(components.Gitbase.Name) {
+		names = append(names, components.Gitbase.Name)
+	}
+	return names
+}
+
+// initComponentsOrder returns the order the components are started by init.
+// The web clients are not, they are started on demand at the port given then.
+func initComponentsOrder() []components.Component {
+	return []components.Component{
+		components.Bblfshd,
+		components.Pilosa,
+		components.Gitbase,
+	}
+}
+
+// gitbaseReadyTimeout is how long the commands restarting gitbase wait for
+// it to be ready, and init checks it reads the working directory.
+const gitbaseReadyTimeout = 10 * time.Minute
+
+// defaultInitTimeout is the default of --init-timeout.
+const defaultInitTimeout = 15 * time.Minute
+
+// gitbaseProbeTimeout is how long every probe of gitbase can take.
+const gitbaseProbeTimeout = 10 * time.Second
+
+// gitbaseHintLines is how many lines of the logs of gitbase are read looking
+// for its progress loading the repositories.
+const gitbaseHintLines = 20
+
+// initDeadline is when init gives up waiting for gitbase, set with
+// --init-timeout. It's zero for the other commands.
+var initDeadline time.Time
+
+// enabledComponents returns the components started by init enabled in the
+// configuration, in the order they are started.
+func enabledComponents(cfg *daemon.Config) []components.Component {
+	var cmps []components.Component
+	for _, c := range initComponentsOrder() {
+		if cfg.Enabled(c.Name) {
+			cmps = append(cmps, c)
+		}
+	}
+	return cmps
+}
+
+// mixedPlatformsWarning returns a warning about the components running for
+// different platforms, the one of docker, host, for the ones none is forced
+// for, or an empty string if they all run for the same one. Mixing them is
+// allowed, but bblfshd pulls and runs its drivers for its own platform.
+func mixedPlatformsWarning(host docker.Platform, cmps []components.Component) string {
+	var order []docker.Platform
+	names := make(map[docker.Platform][]string)
+	var bblfshd *docker.Platform
+	for _, c := range cmps {
+		p, ok := c.Platform()
+		if !ok {
+			p = host
+		}
+		if c.Name == components.Bblfshd.Name {
+			bblfshd = &p
+		}
+
+		if _, seen := names[p]; !seen {
+			order = append(order, p)
+		}
+		names[p] = append(names[p], c.ShortName())
+	}
+
+	if len(order) < 2 {
+		return ""
+	}
+
+	var items []string
+	for _, p := range order {
+		items = append(items, fmt.Sprintf("%s for %s", strings.Join(names[p], ", "), p))
+	}
+
+	warning := "the components run for different platforms: " + strings.Join(items, "; ")
+	if bblfshd != nil {
+		warning += fmt.Sprintf("; the drivers of bblfshd run for %s, the one of bblfshd", *bblfshd)
+	}
+	return warning
+}
+
+// startSteps returns the steps to install and start the daemon and the
+// enabled components.
+func startSteps(cfg *daemon.Config) []initStep {
+	cmps := enabledComponents(cfg)
+	steps := []initStep{
+		{
+			name: "pull images",
+			run: func() error {
+				if host, err := docker.HostPlatform(context.Background()); err == nil {
+					if w := mixedPlatformsWarning(host, cmps); w != "" {
+						logrus.Warn(w)
+					}
+				}
+
+				if err := daemon.EnsureInstalled(); err != nil {
+					return err
+				}
+
+				for _, c := range cmps {
+					if err := docker.EnsureInstalled(c.ImageName(), c.Tag()); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+	}
+
+	if step := syncWorkdirStep(cfg); step != nil {
+		steps = append(steps, *step)
+	}
+
+	steps = append(steps, initStep{
+		name: "start daemon",
+		run:  func() error { return daemon.Start(cfg) },
+		logs: func() ([]string, error) { return daemon.Logs(initLogLines) },
+	})
+	return append(steps, componentSteps(cfg, false)...)
+}
+
+// componentSteps returns the steps to start the enabled components. With
+// onlyStopped the ones already running are left out, so the ones stopped
+// with srcd stop are started again without touching the rest.
+func componentSteps(cfg *daemon.Config, onlyStopped bool) []initStep {
+	var steps []initStep
+	var gitbaseStarted, pilosaStarted bool
+	for _, c := range enabledComponents(cfg) {
+		c := c
+		if onlyStopped {
+			status, err := components.GetStatus(context.Background(), c, false)
+			if err == nil && keepComponent(status) {
+				continue
+			}
+
+			// The container stopped, or unhealthy, is created again.
+			if err == nil && status.State != components.StateNotCreated {
+				logrus.Infof("%s is %s, recreating it", c.ShortName(), componentCondition(status))
+				steps = append(steps, initStep{
+					name: "remove " + c.ShortName(),
+					run:  func() error { return docker.RemoveContainer(context.Background(), c.Name) },
+				})
+			}
+		}
+
+		steps = append(steps, initStep{
+			name: "start " + c.ShortName(),
+			run:  func() error { return startComponent(c) },
+			logs: containerLogs(c.Name),
+		})
+		gitbaseStarted = gitbaseStarted || c.Name == components.Gitbase.Name
+		pilosaStarted = pilosaStarted || c.Name == components.Pilosa.Name
+	}
+
+	if pilosaStarted {
+		steps = append(steps, initStep{
+			name: "wait for pilosa",
+			run:  waitForPilosa,
+			logs: containerLogs(components.Pilosa.Name),
+		})
+	}
+
+	if gitbaseStarted {
+		steps = append(steps, initStep{
+			name: "wait for gitbase",
+			run:  waitForGitbase(cfg),
+			logs: containerLogs(components.Gitbase.Name),
+		})
+
+		if !cfg.Gitbase.WritableWorkdir {
+			steps = append(steps, initStep{
+				name: "check gitbase reads the read-only working directory",
+				run:  checkGitbaseReads,
+				logs: containerLogs(components.Gitbase.Name),
+			})
+		}
+	}
+
+	return steps
+}
+
+// keepComponent reports whether init keeps the container of a component as
+// it is when it's re-run: it's running and not unhealthy. The ones still
+// starting are kept, whether they become healthy is waited for.
+func keepComponent(s *components.Status) bool {
+	return s.State == components.StateRunning && s.Health != types.Unhealthy
+}
+
+// componentCondition describes why a component not kept by init is recreated.
+func componentCondition(s *components.Status) string {
+	if s.State == components.StateRunning {
+		return s.Health
+	}
+	return s.State
+}
+
+func startComponent(cmp components.Component) error {
+	c, err := daemon.Client()
+	if err != nil {
+		return fmt.Errorf("could not get daemon client: %v", err)
+	}
+
+	// Might have to create the volumes and network.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+	_, err = c.StartComponent(ctx, &api.StartComponentRequest{Name: cmp.Name})
+	return err
+}
+
+// waitForGitbase returns a function waiting until gitbase, started with the
+// given configuration, answers queries at the port published on the host,
+// logging its progress loading the repositories. It waits until the
+// deadline of init, or gitbaseReadyTimeout outside of it.
+func waitForGitbase(cfg *daemon.Config) func() error {
+	return func() error {
+		deadline, limit := initDeadline, "--init-timeout"
+		if deadline.IsZero() {
+			deadline, limit = time.Now().Add(gitbaseReadyTimeout), gitbaseReadyTimeout.String()
+		}
+
+		ctx, cancel := context.WithDeadline(context.Background(), deadline)
+		defer cancel()
+
+		info, err := docker.Inspect(ctx, components.Gitbase.Name)
+		if err != nil {
+			return err
+		}
+
+		addr, ok := components.GitbaseAddress(info, daemon.RemoteDockerHost())
+		if !ok {
+			return fmt.Errorf("the port of gitbase is not published")
+		}
+
+		user := valueOrDefault(cfg.Gitbase.User, components.DefaultGitbaseUser)
+		probe := func(ctx context.Context) error {
+			ctx, cancel := context.WithTimeout(ctx, gitbaseProbeTimeout)
+			defer cancel()
+			return components.ProbeGitbase(ctx, addr, user, cfg.Gitbase.Password)
+		}
+
+		var progress string
+		err = components.WaitForGitbase(ctx, probe, func(err error) {
+			logrus.Debugf("gitbase not ready yet: %v", err)
+
+			lines, lerr := docker.Logs(ctx, components.Gitbase.Name, gitbaseHintLines)
+			if lerr != nil {
+				return
+			}
+
+			if p, ok := components.GitbaseStartupProgress(lines); ok && p != progress {
+				progress = p
+				logrus.Infof("gitbase is starting: %s", p)
 			}
+		})
+		if err != nil {
+			return fmt.Errorf("gitbase not ready within %s: %v", limit, err)
+		}
+		return nil
+	}
+}
+
+// checkGitbaseReads checks that gitbase can list the repositories of the
+// working directory, mounted read-only.
+func checkGitbaseReads() error {
+	c, err := daemon.Client()
+	if err != nil {
+		return fmt.Errorf("could not get daemon client: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), gitbaseReadyTimeout)
+	defer cancel()
+	_, err = c.SQL(ctx, &api.SQLRequest{Query: "SELECT COUNT(*) FROM repositories"})
+	if err != nil {
+		return fmt.Errorf("gitbase could not read the read-only working directory, "+
+			"re-run init with --writable-workdir: %v", err)
+	}
+	return nil
+}
+
+// containerLogs returns a function returning the last lines of the logs of
+// the given container.
+func containerLogs(name string) func() ([]string, error) {
+	return func() ([]string, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		return docker.Logs(ctx, name, initLogLines)
+	}
+}
+
+// initComponents returns the names of the components enabled with
+// --components and --without, or nil if all of them are.
+func initComponents(cmd *cobra.Command) ([]string, error) {
+	names := stringSliceSetting("components.enabled")
+	without := stringSliceSetting("components.disabled")
+	if len(names) == 0 && len(without) == 0 {
+		return nil, nil
+	}
+
+	if isRelativeComponents(names) {
+		running, err := daemon.Running()
+		if err != nil {
+			return nil, err
+		}
+
+		var enabled []string
+		if running != nil {
+			enabled = running.Components
+		}
+
+		names, without, err = relativeComponents(enabled, names, without)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	cmps, err := components.Enable(names, without)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(cmps) == len(components.All) {
+		return nil, nil
+	}
+
+	var enabled, disabled []string
+	for _, c := range components.All {
+		if containsComponent(cmps, c) {
+			enabled = append(enabled, c.Name)
 		} else {
-			workdir, err = filepath.Abs(workdir)
+			disabled = append(disabled, c.ShortName())
+		}
+	}
+
+	logrus.Infof("disabled components: %s", strings.Join(disabled, ", "))
+	return enabled, nil
+}
+
+// isRelativeComponents reports whether the components given with
+// --components are added to or removed from the enabled ones, like +pilosa
+// or -bblfsh-web, instead of replacing them.
+func isRelativeComponents(names []string) bool {
+	for _, name := range names {
+		if strings.HasPrefix(name, "+") || strings.HasPrefix(name, "-") {
+			return true
+		}
+	}
+	return false
+}
+
+// relativeComponents returns the components to enable and disable given the
+// ones enabled, all of them if none is, and the ones added with + and removed
+// with - with --components.
+func relativeComponents(enabled, names, without []string) ([]string, []string, error) {
+	var result []string
+	if len(enabled) == 0 {
+		for _, c := range components.All {
+			result = append(result, c.Name)
+		}
+	} else {
+		result = append(result, enabled...)
+	}
+
+	for _, name := range names {
+		if !strings.HasPrefix(name, "+") && !strings.HasPrefix(name, "-") {
+			return nil, nil, usageErrorf("invalid value of --components %q: "+
+				"the components must all be added with + or removed with -, or none of them", name)
+		}
+
+		c, ok := components.ByName(name[1:])
+		if !ok {
+			return nil, nil, usageErrorf("unknown component %s", name[1:])
+		}
+
+		kept := result[:0]
+		for _, n := range result {
+			if n != c.Name {
+				kept = append(kept, n)
+			}
+		}
+		result = kept
+
+		if name[0] == '+' {
+			result = append(result, c.Name)
+		} else {
+			without = append(without, c.Name)
+		}
+	}
+	return result, without, nil
+}
+
+func containsComponent(cmps []components.Component, c components.Component) bool {
+	for _, cmp := range cmps {
+		if cmp.Name == c.Name {
+			return true
+		}
+	}
+	return false
+}
+
+// installDriversStep returns the step installing the drivers given with
+// --with-drivers, if any, which fails only with --strict. The summary of the
+// drivers is printed to out.
+func installDriversStep(cmd *cobra.Command, workdir string, out io.Writer) *initStep {
+	withDrivers := stringSliceSetting("bblfsh.with-drivers")
+	if len(withDrivers) == 0 {
+		return nil
+	}
+
+	strict, _ := cmd.Flags().GetBool("strict")
+	return &initStep{
+		name: "install drivers",
+		run: func() error {
+			langs, err := initDriverLanguages(withDrivers, workdir)
+			if err != nil {
+				return err
+			}
+
+			c, err := daemon.Client()
 			if err != nil {
-				logrus.Fatal(err)
+				return fmt.Errorf("could not get daemon client: %v", err)
 			}
+
+			failed := installInitDrivers(c, langs, out)
+			if strict && failed > 0 {
+				return fmt.Errorf("could not install %d of %d drivers", failed, len(langs))
+			}
+			return nil
+		},
+		logs: containerLogs(components.Bblfshd.Name),
+	}
+}
+
+// checkRepositories warns if there are no git repositories in the given
+// directories, as gitbase would have no data, or if gitbase can't read some
+// of them. With strict it fails instead. It returns the result of the scan,
+// nil if it failed, and the format of the repositories, the one given or the
+// one detected if it's empty. Only siva files are counted in siva format.
+func checkRepositories(dirs []string, format string, strict bool, excludes []repoPattern) (*repoScan, string, error) {
+	scan, err := scanRepositories(dirs, repoScanDepth, repoScanTimeout)
+	if err != nil {
+		logrus.Warnf("could not look for git repositories: %v", err)
+		if len(excludes) > 0 {
+			logrus.Warnf("no repositories are excluded, as they could not be found")
 		}
+		if format == "" {
+			format = repoFormatGit
+		}
+		return nil, format, nil
+	}
 
-		logrus.Infof("starting daemon with working directory: %s", workdir)
+	detected, err := repoFormat(scan, format)
+	if err != nil {
+		return nil, "", &codedError{exitUsage, err}
+	}
 
-		if err := daemon.Start(workdir); err != nil {
-			logrus.Errorf("could not start daemon: %s", err)
+	if detected == repoFormatSiva {
+		if format == "" {
+			logrus.Infof("found only siva files, gitbase will read them in siva format; " +
+				"use --format git to override")
 		}
-	},
+		if len(excludes) > 0 {
+			logrus.Warnf("--exclude-repo is ignored for siva files, move them out of the working directory instead")
+		}
+		return scan, detected, checkSivaFiles(dirs, scan, strict)
+	}
+
+	excludeRepositories(scan, excludes)
+
+	unreadable := unreadableRepositories(scan.found, detectRepoAccess())
+	if len(unreadable) > 0 {
+		for _, r := range unreadable {
+			logrus.Warnf("gitbase won't be able to read %s: %s is not readable", r.path, r.denied)
+		}
+
+		msg := fmt.Sprintf("%d git repositories can't be read by gitbase; make them readable "+
+			"with chmod -R o+rX, configure the user namespace mapping of docker "+
+			"so the containers run with your uid, or run the gitbase container as your "+
+			"user with the user option of the container, --user %d:%d",
+			len(unreadable), os.Getuid(), os.Getgid())
+		if strict {
+			return nil, "", errors.New(msg)
+		}
+		logrus.Warn(msg)
+	}
+
+	repos := scan.repositories - len(unreadable)
+	if scan.incomplete {
+		logrus.Infof("found at least %d git repositories, stopped looking for more after %s",
+			repos, repoScanTimeout)
+		return scan, detected, nil
+	}
+
+	if repos > 0 {
+		logrus.Infof("found %d git repositories", repos)
+		return scan, detected, nil
+	}
+
+	msg := fmt.Sprintf("no git repositories found under %s, gitbase will have no data",
+		strings.Join(dirs, ", "))
+	if strict {
+		return nil, "", errors.New(msg)
+	}
+	logrus.Warn(msg)
+	return scan, detected, nil
+}
+
+// checkSivaFiles logs the number of siva files found, or warns if there are
+// none. With strict it fails instead.
+func checkSivaFiles(dirs []string, scan *repoScan, strict bool) error {
+	sivas := len(scan.ofKind(repoSiva))
+	switch {
+	case scan.incomplete:
+		logrus.Infof("found at least %d siva files, stopped looking for more after %s",
+			sivas, repoScanTimeout)
+	case sivas > 0:
+		logrus.Infof("found %d siva files", sivas)
+	default:
+		msg := fmt.Sprintf("no siva files found under %s, gitbase will have no data",
+			strings.Join(dirs, ", "))
+		if strict {
+			return errors.New(msg)
+		}
+		logrus.Warn(msg)
+	}
+	return nil
+}
+
+// applyRepoPolicy warns about the nested and bare repositories found, telling
+// what gitbase will do with them given the policy, and returns the paths to
+// hide from gitbase.
+func applyRepoPolicy(scan *repoScan, policy daemon.RepoPolicy) []string {
+	if scan == nil {
+		return nil
+	}
+
+	nested, bare := scan.ofKind(repoNested), scan.ofKind(repoBare)
+	if len(nested) == 0 && len(bare) == 0 {
+		return nil
+	}
+
+	logrus.Warnf("found %d nested and %d bare git repositories:", len(nested), len(bare))
+
+	var hidden []string
+	for _, r := range nested {
+		gitDir := filepath.Join(r.path, ".git")
+		fi, err := os.Stat(gitDir)
+		switch {
+		case !policy.SkipNested:
+			logrus.Warnf("  nested %s in %s: indexed as a separate repository, use --skip-nested to hide it",
+				r.path, r.parent)
+		case err != nil || !fi.IsDir():
+			logrus.Warnf("  nested %s in %s: indexed, its .git is not a directory so it can't be hidden",
+				r.path, r.parent)
+		default:
+			logrus.Warnf("  nested %s in %s: hidden from gitbase", r.path, r.parent)
+			hidden = append(hidden, gitDir)
+		}
+	}
+
+	for _, r := range bare {
+		if policy.IncludeBare {
+			logrus.Warnf("  bare %s: indexed", r.path)
+			continue
+		}
+
+		logrus.Warnf("  bare %s: hidden from gitbase, use --include-bare to index it", r.path)
+		hidden = append(hidden, r.path)
+	}
+
+	return hidden
+}
+
+// initDirectories returns the canonical paths of the directories with
+// repositories, without duplicates, failing if any can't be mounted. The
+// first one is the working directory, which is the current directory if none
+// is given.
+func initDirectories(args []string) ([]string, error) {
+	var dirs []string
+	seen := make(map[string]bool)
+	for _, arg := range args {
+		arg = strings.TrimSpace(arg)
+		if arg == "" {
+			continue
+		}
+
+		dir, err := canonicalPath(arg)
+		if err != nil {
+			return nil, err
+		}
+
+		if !seen[dir] {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+
+	if len(dirs) == 0 {
+		wd, err := os.Getwd()
+		if err != nil {
+			return nil, err
+		}
+		dir, err := canonicalPath(wd)
+		if err != nil {
+			return nil, err
+		}
+		dirs = append(dirs, dir)
+	}
+
+	for _, dir := range dirs {
+		if err := checkMountable(dir); err != nil {
+			return nil, err
+		}
+	}
+
+	return dirs, nil
+}
+
+func valueOrDefault(value, def string) string {
+	if value == "" || value == "0" {
+		return def
+	}
+	return value
 }
 
 func init() {
 	rootCmd.AddCommand(initCmd)
+
+	initCmd.Flags().StringSlice("repos", nil, "more directories with repositories to mount in gitbase, can be repeated")
+	initCmd.Flags().Bool("force", false, "remove all the containers and their network and start them fresh, keeping images and data")
+	initCmd.Flags().Bool("reset-data", false, "with --force, also remove the installed drivers and the gitbase and pilosa indexes")
+	initCmd.Flags().StringSlice("components", nil, "components to enable, all of them if none is given: bblfshd, bblfsh-web, gitbase, gitbase-web, pilosa")
+	initCmd.Flags().StringSlice("without", nil, "components to disable")
+	initCmd.Flags().String("bblfsh-memory", "", "memory limit of bblfshd, like 512m or 2g")
+	initCmd.Flags().Int("bblfsh-max-drivers", 0, "maximum number of instances of every driver run by bblfshd")
+	initCmd.Flags().String("gitbase-squash", "off", "on to enable the squashed tables of gitbase, which change a lot how fast the queries are, off as in gitbase by default")
+	initCmd.Flags().String("gitbase-preset", "", "settings of gitbase for the memory of the machine: laptop, workstation or server; the ones given on their own replace them")
+	initCmd.Flags().String("gitbase-cache-size", "", "size of the cache of git objects of gitbase, like 512m or 4g")
+	initCmd.Flags().String("gitbase-max-memory", "", "memory the joins of gitbase can use before spilling to disk, like 2g")
+	initCmd.Flags().Duration("gitbase-conn-timeout", 0, "how long the connections to gitbase can be idle, like 1h")
+	initCmd.Flags().Duration("gitbase-query-timeout", 0, "how long every query to gitbase can run before it's canceled, like 10m")
+	initCmd.Flags().Int("gitbase-max-connections", 0, "maximum number of connections to gitbase open at once")
+	initCmd.Flags().Int("gitbase-parallelism", 0, "number of repositories gitbase reads at once, like 2 for spinning disks or 16 for NVMe; "+
+		"the number of CPUs of docker if 0. Each of them needs memory, raise --gitbase-max-memory along with it")
+	initCmd.Flags().Int("pilosa-port", components.PilosaDefaultPort, "port pilosa is served on, to gitbase and in the host if it's exposed")
+	initCmd.Flags().String("expose-pilosa", "", "publish pilosa on the host for external tools, on the loopback unless an address like 0.0.0.0 is given")
+	initCmd.Flags().Lookup("expose-pilosa").NoOptDefVal = "127.0.0.1"
+	initCmd.Flags().String("pilosa-memory", "", "memory limit of pilosa, like 2g, or 0 for none; a quarter of the memory of docker by default")
+	initCmd.Flags().String("pilosa-cache-size", "", "size of the caches of pilosa, like 512m; a quarter of its memory limit by default")
+	initCmd.Flags().StringSlice("with-drivers", nil, "drivers to install once bblfshd is started, or auto to install the ones for the languages in the working directory")
+	initCmd.Flags().String("format", "", "format of the repositories: git or siva, detected if not given")
+	initCmd.Flags().String("gitbase-user", "", "user the clients of gitbase connect with, root by default")
+	initCmd.Flags().String("gitbase-password", "", "password of the user of gitbase, or auto to generate one, none by default")
+	initCmd.Flags().String("gitbase-log-level", "", "level of the logs of gitbase: error, warn, info, debug or trace, info by default")
+	initCmd.Flags().Bool("enable-metrics", false, "enable the metrics of gitbase, published on the loopback of the host and shown by srcd stats")
+	initCmd.Flags().Bool("writable-workdir", false, "mount the working directory writable in gitbase, which only reads it, instead of read-only")
+	initCmd.Flags().String("sync-workdir", syncWorkdirAuto, "copy the working directory into a volume mounted in gitbase, syncing it on every init, for docker hosts other than this machine: "+
+		"on, off, or auto to ask when docker is remote")
+	initCmd.Flags().StringArray("exclude-repo", nil, "pattern of the repositories to hide from gitbase, like in .gitignore and relative to the working directory, can be repeated")
+	initCmd.Flags().Bool("skip-nested", false, "hide from gitbase the repositories nested in others, which are not submodules")
+	initCmd.Flags().Bool("include-bare", false, "index the bare repositories, which are hidden from gitbase otherwise")
+	initCmd.Flags().Duration("init-timeout", defaultInitTimeout, "how long init can take until gitbase answers queries before failing, like 30m for huge working directories")
+	initCmd.Flags().Bool("json-progress", false, "print the progress of every step as a JSON event per line")
+	initCmd.Flags().Bool("strict", false, "fail if there are no git repositories, some can't be read by gitbase, or any of the drivers given with --with-drivers can't be installed")
+	initCmd.Flags().String("data-dir", "", "directory where the engine keeps the drivers and indexes (default is $HOME/.srcd)")
+	bindConfig("components.enabled", initCmd.Flags().Lookup("components"))
+	bindConfig("components.disabled", initCmd.Flags().Lookup("without"))
+	bindConfig("data-dir", initCmd.Flags().Lookup("data-dir"))
+	bindConfig("workdir.sync", initCmd.Flags().Lookup("sync-workdir"), checkSyncWorkdir)
+	bindConfig("bblfsh.memory", initCmd.Flags().Lookup("bblfsh-memory"), checkSize)
+	bindConfig("bblfsh.max-drivers", initCmd.Flags().Lookup("bblfsh-max-drivers"), checkNotNegative)
+	bindConfig("bblfsh.with-drivers", initCmd.Flags().Lookup("with-drivers"))
+	bindConfig("pilosa.port", initCmd.Flags().Lookup("pilosa-port"), checkPort)
+	bindConfig("pilosa.expose", initCmd.Flags().Lookup("expose-pilosa"), checkPilosaExpose)
+	bindConfig("pilosa.memory", initCmd.Flags().Lookup("pilosa-memory"), checkSize)
+	bindConfig("pilosa.cache-size", initCmd.Flags().Lookup("pilosa-cache-size"), checkSize)
+	bindConfig("gitbase.squash", initCmd.Flags().Lookup("gitbase-squash"), checkOnOff)
+	bindConfig("gitbase.preset", initCmd.Flags().Lookup("gitbase-preset"), checkGitbasePreset)
+	bindConfig("gitbase.cache-size", initCmd.Flags().Lookup("gitbase-cache-size"), checkGitbaseSize)
+	bindConfig("gitbase.max-memory", initCmd.Flags().Lookup("gitbase-max-memory"), checkGitbaseSize)
+	bindConfig("gitbase.conn-timeout", initCmd.Flags().Lookup("gitbase-conn-timeout"), checkGitbaseTimeout)
+	bindConfig("gitbase.query-timeout", initCmd.Flags().Lookup("gitbase-query-timeout"), checkGitbaseTimeout)
+	bindConfig("gitbase.max-connections", initCmd.Flags().Lookup("gitbase-max-connections"), checkGitbaseConnections)
+	bindConfig("gitbase.parallelism", initCmd.Flags().Lookup("gitbase-parallelism"), checkGitbaseParallelism)
+	bindConfig("gitbase.user", initCmd.Flags().Lookup("gitbase-user"), checkGitbaseUser)
+	bindSecretConfig("gitbase.password", initCmd.Flags().Lookup("gitbase-password"))
+	bindConfig("gitbase.metrics", initCmd.Flags().Lookup("enable-metrics"))
+	bindConfig("gitbase.log-level", initCmd.Flags().Lookup("gitbase-log-level"), checkGitbaseLogLevel)
 }
@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/src-d/engine/docker"
+)
+
+// repoAccess is how the containers access the files of the host, which tells
+// which repositories gitbase can read.
+type repoAccess int
+
+const (
+	// accessRoot means the containers read the files as the root user of
+	// the host, so they can read anything.
+	accessRoot repoAccess = iota
+	// accessUser means the files are read as the user running docker, as
+	// with rootless docker or Docker Desktop.
+	accessUser
+	// accessOther means the containers run in a user namespace, as an
+	// unprivileged user of the host that can only read what anyone can.
+	accessOther
+)
+
+// detectRepoAccess finds out how the containers access the files of the
+// host from the options of the docker daemon.
+func detectRepoAccess() repoAccess {
+	if runtime.GOOS != "linux" {
+		return accessUser
+	}
+
+	opts, err := docker.SecurityOptions()
+	if err != nil {
+		return accessRoot
+	}
+
+	for _, opt := range opts {
+		switch {
+		case strings.Contains(opt, "name=rootless"):
+			return accessUser
+		case strings.Contains(opt, "name=userns"):
+			return accessOther
+		}
+	}
+	return accessRoot
+}
+
+// unreadableRepository is a repository gitbase wouldn't be able to read.
+type unreadableRepository struct {
+	path string
+	// denied is the file or directory that can't be read.
+	denied string
+}
+
+// unreadableRepositories returns the repositories found that can't be read
+// with the given access.
+func unreadableRepositories(found []foundRepository, access repoAccess) []unreadableRepository {
+	var result []unreadableRepository
+	for _, r := range found {
+		if denied := deniedPath(r, access); denied != "" {
+			result = append(result, unreadableRepository{r.path, denied})
+		}
+	}
+	return result
+}
+
+// deniedPath returns the first path that can't be read to get to the data of
+// the repository, or an empty string if it's readable. Only the directories
+// under the mounted one matter, as the ones above it are not seen by the
+// containers.
+func deniedPath(r foundRepository, access repoAccess) string {
+	if access == accessRoot {
+		return ""
+	}
+
+	var paths []string
+	if rel, err := filepath.Rel(r.root, filepath.Dir(r.path)); err == nil && rel != "." {
+		dir := r.root
+		for _, part := range strings.Split(rel, string(filepath.Separator)) {
+			dir = filepath.Join(dir, part)
+			paths = append(paths, dir)
+		}
+	}
+
+	paths = append(paths, r.path)
+	gitDir := r.path
+	if fi, err := os.Stat(filepath.Join(r.path, ".git")); err == nil && fi.IsDir() {
+		gitDir = filepath.Join(r.path, ".git")
+		paths = append(paths, gitDir)
+	}
+
+	// Siva files are files, the rest are directories with objects.
+	if fi, err := os.Stat(r.path); err == nil && fi.IsDir() {
+		paths = append(paths, filepath.Join(gitDir, "objects"))
+	}
+
+	for _, p := range paths {
+		if !readable(p, access) {
+			return p
+		}
+	}
+	return ""
+}
+
+// readable reports whether the file can be read, or the directory listed
+// and traversed, with the given access.
+func readable(path string, access repoAccess) bool {
+	fi, err := os.Stat(path)
+	if err != nil {
+		// Files that don't exist, like the objects of an empty repository,
+		// can't be unreadable.
+		return !os.IsPermission(err)
+	}
+
+	if access == accessOther {
+		perm := fi.Mode().Perm()
+		if fi.IsDir() {
+			return perm&0005 == 0005
+		}
+		return perm&0004 != 0
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	if fi.IsDir() {
+		_, err = f.Readdirnames(1)
+		return err == nil || err == io.EOF
+	}
+	return true
+}
@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUnreadableRepositories(t *testing.T) {
+	dir, err := ioutil.TempDir("", "srcd-init")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	dirs := map[string]os.FileMode{
+		"public/.git/objects":  0755,
+		"private/.git/objects": 0755,
+		"hidden/repo/objects":  0755,
+		"objects/bare/objects": 0755,
+	}
+	for p, mode := range dirs {
+		if err := os.MkdirAll(filepath.Join(dir, p), mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for p, mode := range map[string]os.FileMode{
+		"private/.git/objects": 0700,
+		"hidden":               0700,
+		"objects/bare/objects": 0751,
+	} {
+		if err := os.Chmod(filepath.Join(dir, p), mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer os.Chmod(filepath.Join(dir, "hidden"), 0755)
+
+	var found []foundRepository
+	for _, p := range []string{"public", "private", "hidden/repo", "objects/bare"} {
+		found = append(found, foundRepository{root: dir, path: filepath.Join(dir, p)})
+	}
+
+	if result := unreadableRepositories(found, accessRoot); len(result) != 0 {
+		t.Errorf("expected all repositories to be readable as root, got: %v", result)
+	}
+
+	expected := []unreadableRepository{
+		{filepath.Join(dir, "private"), filepath.Join(dir, "private/.git/objects")},
+		{filepath.Join(dir, "hidden/repo"), filepath.Join(dir, "hidden")},
+		{filepath.Join(dir, "objects/bare"), filepath.Join(dir, "objects/bare/objects")},
+	}
+
+	result := unreadableRepositories(found, accessOther)
+	if len(result) != len(expected) {
+		t.Fatalf("expected: %v, got: %v", expected, result)
+	}
+
+	for i := range expected {
+		if result[i] != expected[i] {
+			t.Errorf("expected: %v, got: %v", expected[i], result[i])
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	api "github.com/src-d/engine/api"
+)
+
+// autoDrivers is the value of --with-drivers that installs the drivers for the
+// languages found in the working directory.
+const autoDrivers = "auto"
+
+// Outcomes of installing a driver during init.
+const (
+	driverInstalled      = "installed"
+	driverAlreadyPresent = "already present"
+	driverFailed         = "failed"
+)
+
+// initDriverLanguages returns the languages whose drivers must be installed
+// given the --with-drivers values. With auto the working directory is scanned
+// and only the languages with an official driver are returned.
+func initDriverLanguages(values []string, workdir string) ([]string, error) {
+	seen := make(map[string]bool)
+	var langs []string
+	add := func(lang string) {
+		lang = strings.ToLower(strings.TrimSpace(lang))
+		if lang != "" && !seen[lang] {
+			seen[lang] = true
+			langs = append(langs, lang)
+		}
+	}
+
+	for _, v := range values {
+		if strings.ToLower(strings.TrimSpace(v)) != autoDrivers {
+			add(v)
+			continue
+		}
+
+		found, err := scanLanguages(workdir)
+		if err != nil {
+			return nil, fmt.Errorf("could not scan %s: %v", workdir, err)
+		}
+
+		official := officialDriverLanguages()
+		var detected []string
+		for lang := range found {
+			if official == nil || official[lang] {
+				detected = append(detected, lang)
+			}
+		}
+
+		sort.Strings(detected)
+		logrus.Infof("languages with drivers found in %s: %s", workdir, strings.Join(detected, ", "))
+		for _, lang := range detected {
+			add(lang)
+		}
+	}
+
+	return langs, nil
+}
+
+// installInitDrivers installs the drivers for the given languages, skipping
+// the ones already installed, and prints a summary of what happened with each
+// of them to out. It returns the number of drivers that failed to install.
+func installInitDrivers(c api.EngineClient, langs []string, out io.Writer) int {
+	// Might need to pull the image of bblfshd.
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	drivers, err := c.ListDrivers(ctx, &api.ListDriversRequest{})
+	cancel()
+	if err != nil {
+		logrus.Errorf("could not list drivers: %v", err)
+		return len(langs)
+	}
+
+	installed := make(map[string]string)
+	for _, d := range drivers.Drivers {
+		installed[strings.ToLower(d.Lang)] = d.Version
+	}
+
+	pins := driverPins()
+	outcomes := make(map[string]string)
+	versions := make(map[string]string)
+	var failed int
+	for i, lang := range langs {
+		if version, ok := installed[lang]; ok {
+			outcomes[lang] = driverAlreadyPresent
+			versions[lang] = version
+			continue
+		}
+
+		version, err := driverVersion(lang, "", pins, false)
+		if err != nil {
+			logrus.Warn(err)
+			outcomes[lang] = driverFailed
+			failed++
+			continue
+		}
+
+		logrus.Infof("[%d/%d] installing %s driver version %s", i+1, len(langs), lang, version)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+		resp, err := c.InstallDriver(ctx, &api.VersionedDriver{Language: lang, Version: version})
+		cancel()
+		if err != nil {
+			logrus.Warnf("unable to install %s driver: %v", lang, err)
+			outcomes[lang] = driverFailed
+			failed++
+			continue
+		}
+
+		logrus.WithFields(logrus.Fields{
+			"language": lang,
+			"image":    resp.Image,
+			"version":  resp.Version,
+		}).Info("installed driver")
+		outcomes[lang] = driverInstalled
+		versions[lang] = resp.Version
+	}
+
+	w := new(tabwriter.Writer)
+	defer w.Flush()
+	w.Init(out, 0, 8, 5, '\t', 0)
+	fmt.Fprintln(w, "LANGUAGE\tDRIVER\tVERSION")
+	fmt.Fprintln(w, "----------\t----------\t----------")
+	for _, lang := range langs {
+		version := versions[lang]
+		if version == "" {
+			version = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", lang, outcomes[lang], version)
+	}
+
+	return failed
+}
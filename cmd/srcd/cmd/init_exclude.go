@@ -0,0 +1,181 @@
+package cmd
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// repoPattern is a pattern of the repositories excluded with --exclude-repo,
+// like in a .gitignore file: * doesn't match /, ** matches any number of
+// directories, a leading / anchors it to the directory with repositories,
+// and it matches at any depth if it has no other /. Patterns starting with !
+// include again the repositories excluded by the ones before them.
+type repoPattern struct {
+	value    string
+	negated  bool
+	anchored bool
+	segments []string
+}
+
+func parseRepoPattern(value string) (repoPattern, error) {
+	p := repoPattern{value: value}
+	s := strings.TrimSpace(value)
+	if strings.HasPrefix(s, "!") {
+		p.negated = true
+		s = s[1:]
+	}
+
+	// Repositories are directories, so a trailing / changes nothing.
+	s = strings.TrimSuffix(s, "/")
+	if strings.HasPrefix(s, "/") {
+		p.anchored = true
+		s = s[1:]
+	} else if strings.Contains(s, "/") {
+		p.anchored = true
+	}
+
+	if s == "" {
+		return p, fmt.Errorf("it must match some paths")
+	}
+
+	p.segments = strings.Split(s, "/")
+	for _, seg := range p.segments {
+		if _, err := path.Match(seg, ""); err != nil {
+			return p, fmt.Errorf("invalid pattern %s", seg)
+		}
+	}
+
+	if !p.anchored {
+		p.segments = append([]string{"**"}, p.segments...)
+	}
+	return p, nil
+}
+
+// parseRepoPatterns parses the values of --exclude-repo.
+func parseRepoPatterns(values []string) ([]repoPattern, error) {
+	var patterns []repoPattern
+	for _, v := range values {
+		p, err := parseRepoPattern(v)
+		if err != nil {
+			return nil, usageErrorf("invalid value of --exclude-repo %q: %v", v, err)
+		}
+		patterns = append(patterns, p)
+	}
+	return patterns, nil
+}
+
+// matches reports whether the pattern matches the path, relative to the
+// directory with repositories, or any of its parent directories.
+func (p repoPattern) matches(rel string) bool {
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	for i := 1; i <= len(parts); i++ {
+		if matchSegments(p.segments, parts[:i]) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchSegments(pattern, parts []string) bool {
+	if len(pattern) == 0 {
+		return len(parts) == 0
+	}
+
+	if pattern[0] == "**" {
+		for i := 0; i <= len(parts); i++ {
+			if matchSegments(pattern[1:], parts[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(parts) == 0 {
+		return false
+	}
+
+	ok, _ := path.Match(pattern[0], parts[0])
+	return ok && matchSegments(pattern[1:], parts[1:])
+}
+
+// excludedBy returns the pattern the repository with the given relative path
+// is excluded by, the last one matching it, or false if it's not excluded.
+func excludedBy(patterns []repoPattern, rel string) (string, bool) {
+	var by string
+	var excluded bool
+	for _, p := range patterns {
+		if p.matches(rel) {
+			by, excluded = p.value, !p.negated
+		}
+	}
+	return by, excluded
+}
+
+// excludeRepositories moves the git repositories of the scan matched by the
+// patterns to its excluded ones, logging how many every pattern excluded.
+// The directories with repositories themselves can't be excluded, as they
+// are mounted in gitbase.
+func excludeRepositories(scan *repoScan, patterns []repoPattern) {
+	if len(patterns) == 0 {
+		return
+	}
+
+	counts := make(map[string]int)
+	var kept []foundRepository
+	for _, r := range scan.found {
+		rel, err := filepath.Rel(r.root, r.path)
+		if err != nil || rel == "." || r.kind == repoSubmodule {
+			kept = append(kept, r)
+			continue
+		}
+
+		by, ok := excludedBy(patterns, rel)
+		if !ok {
+			kept = append(kept, r)
+			continue
+		}
+
+		counts[by]++
+		scan.repositories--
+		scan.excluded = append(scan.excluded, r)
+	}
+	scan.found = kept
+
+	logrus.Infof("excluded %d of the %d git repositories found from gitbase:",
+		len(scan.excluded), scan.repositories+len(scan.excluded))
+	for _, p := range patterns {
+		if p.negated {
+			continue
+		}
+
+		if n := counts[p.value]; n > 0 {
+			logrus.Infof("  %s: %d repositories", p.value, n)
+		} else {
+			logrus.Warnf("  %s: no repositories, check it's relative to the working directory", p.value)
+		}
+	}
+
+	if scan.incomplete {
+		logrus.Warnf("the repositories not found before the scan stopped are not excluded")
+	}
+}
+
+// excludedPaths returns the paths of the repositories excluded, to hide from
+// gitbase, without the ones inside others already hidden.
+func excludedPaths(scan *repoScan) []string {
+	if scan == nil {
+		return nil
+	}
+
+	var paths []string
+	for _, r := range scan.excluded {
+		if enclosingWorktree(paths, r.path) == "" {
+			paths = append(paths, r.path)
+		}
+	}
+	return paths
+}
@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRepoPatternMatches(t *testing.T) {
+	testCases := []struct {
+		pattern  string
+		path     string
+		expected bool
+	}{
+		{"mirror", "mirror", true},
+		{"mirror", "group/mirror", true},
+		{"mirror", "mirror/nested", true},
+		{"mirror", "mirrors", false},
+		{"*-mirror", "group/linux-mirror", true},
+		{"mirrors/", "mirrors/linux", true},
+		{"/linux", "linux", true},
+		{"/linux", "mirrors/linux", false},
+		{"mirrors/linux", "mirrors/linux", true},
+		{"mirrors/linux", "group/mirrors/linux", false},
+		{"mirrors/*", "mirrors/linux", true},
+		{"mirrors/*", "mirrors", false},
+		{"**/linux", "a/b/linux", true},
+		{"a/**/linux", "a/linux", true},
+		{"a/**/linux", "a/b/c/linux", true},
+		{"lin?x", "linux", true},
+		{"[a-c]*", "chromium", true},
+		{"[a-c]*", "linux", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.pattern+" "+tc.path, func(t *testing.T) {
+			p, err := parseRepoPattern(tc.pattern)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got := p.matches(tc.path); got != tc.expected {
+				t.Errorf("expected: %t, got: %t", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestParseRepoPatterns(t *testing.T) {
+	for _, values := range [][]string{{"/"}, {"!"}, {"mirrors/[a-"}} {
+		if _, err := parseRepoPatterns(values); err == nil {
+			t.Errorf("expected an error for %v", values)
+		}
+	}
+}
+
+func TestExcludeRepositories(t *testing.T) {
+	root := filepath.FromSlash("/home/user/repos")
+	repo := func(rel, kind string) foundRepository {
+		return foundRepository{root: root, path: filepath.Join(root, filepath.FromSlash(rel)), kind: kind}
+	}
+
+	scan := &repoScan{}
+	for _, r := range []foundRepository{
+		{root: root, path: root, kind: repoWorktree},
+		repo("engine", repoWorktree),
+		repo("mirrors/linux", repoWorktree),
+		repo("mirrors/linux/tools/nested", repoNested),
+		repo("mirrors/chromium", repoWorktree),
+		repo("mirrors/keep", repoWorktree),
+		repo("old.git", repoBare),
+	} {
+		scan.add(r)
+	}
+
+	patterns, err := parseRepoPatterns([]string{"mirrors/", "!mirrors/keep", "*.git", "unused"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	excludeRepositories(scan, patterns)
+	if scan.repositories != 3 {
+		t.Errorf("expected: 3 repositories, got: %d", scan.repositories)
+	}
+
+	var hidden []string
+	for _, p := range excludedPaths(scan) {
+		rel, _ := filepath.Rel(root, p)
+		hidden = append(hidden, filepath.ToSlash(rel))
+	}
+
+	expected := "mirrors/linux mirrors/chromium old.git"
+	if got := strings.Join(hidden, " "); got != expected {
+		t.Errorf("expected: %s, got: %s", expected, got)
+	}
+}
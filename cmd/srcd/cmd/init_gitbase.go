@@ -0,0 +1,271 @@
+package cmd
+
+import (
+	"fmt"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	units "github.com/docker/go-units"
+	"github.com/spf13/viper"
+	"github.com/src-d/engine/cmd/srcd/daemon"
+	"github.com/src-d/engine/components"
+	"github.com/src-d/engine/docker"
+)
+
+// gitbasePresets are the settings of gitbase given with --gitbase-preset, for
+// the memory of the machine. The ones given on their own replace them.
+var gitbasePresets = map[string]daemon.GitbaseOptions{
+	"laptop":      {CacheSize: "256m", MaxMemory: "512m"},
+	"workstation": {CacheSize: "4g", MaxMemory: "8g"},
+	"server":      {CacheSize: "16g", MaxMemory: "32g", ConnTimeout: time.Hour},
+}
+
+func gitbasePresetNames() []string {
+	var names []string
+	for name := range gitbasePresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func checkGitbasePreset(value string) error {
+	if _, ok := gitbasePresets[value]; value != "" && !ok {
+		return fmt.Errorf("it must be one of %s", strings.Join(gitbasePresetNames(), ", "))
+	}
+	return nil
+}
+
+// checkGitbaseSize validates the sizes of gitbase, which reads them in MB.
+func checkGitbaseSize(value string) error {
+	if value == "" {
+		return nil
+	}
+
+	size, err := units.RAMInBytes(value)
+	if err != nil {
+		return err
+	}
+
+	if size < units.MiB {
+		return fmt.Errorf("it must be at least 1m")
+	}
+	return nil
+}
+
+// checkGitbaseTimeout validates the timeouts of gitbase, which reads them in
+// seconds.
+func checkGitbaseTimeout(value string) error {
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+
+	if d != 0 && d < time.Second {
+		return fmt.Errorf("it must be at least 1s, or 0 for the default of gitbase")
+	}
+	return nil
+}
+
+// checkGitbaseConnections validates the maximum number of connections to
+// gitbase.
+func checkGitbaseConnections(value string) error {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return fmt.Errorf("it must be a number")
+	}
+
+	if n < 0 {
+		return fmt.Errorf("it can't be negative, use 0 for the default of gitbase")
+	}
+	return nil
+}
+
+// checkGitbaseParallelism validates the number of repositories gitbase reads
+// at once.
+func checkGitbaseParallelism(value string) error {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return fmt.Errorf("it must be a number")
+	}
+
+	if n < 0 {
+		return fmt.Errorf("it can't be negative, use 0 for the number of CPUs")
+	}
+	return nil
+}
+
+// defaultGitbaseParallelism returns the number of repositories gitbase reads
+// at once when none is given: the number of CPUs docker runs the containers
+// with, which on macOS and Windows is the one of its virtual machine, or the
+// one of the host if docker doesn't tell.
+func defaultGitbaseParallelism() int {
+	if info, err := docker.SystemInfo(); err == nil && info.NCPU > 0 {
+		return info.NCPU
+	}
+	return runtime.NumCPU()
+}
+
+// gitbasePasswordAuto is the value of --gitbase-password generating the
+// password, or keeping the one already generated.
+const gitbasePasswordAuto = "auto"
+
+// gitbaseUserRegexp matches the users of gitbase that can be given in its DSN
+// as they are.
+var gitbaseUserRegexp = regexp.MustCompile(`^[a-zA-Z0-9_.-]+$`)
+
+func checkGitbaseLogLevel(value string) error {
+	if value == "" {
+		return nil
+	}
+
+	for _, l := range components.GitbaseLogLevels {
+		if value == l {
+			return nil
+		}
+	}
+	return fmt.Errorf("it must be one of %s", strings.Join(components.GitbaseLogLevels, ", "))
+}
+
+func checkGitbaseUser(value string) error {
+	if value != "" && !gitbaseUserRegexp.MatchString(value) {
+		return fmt.Errorf("it can only have letters, digits, '_', '.' and '-'")
+	}
+	return nil
+}
+
+// resolveGitbasePassword returns the password of gitbase given, or with auto
+// the one kept in the data directory, generating it if there's none.
+func resolveGitbasePassword(datadir, value string) (string, error) {
+	if value != gitbasePasswordAuto {
+		return value, nil
+	}
+
+	password, err := daemon.StoredGitbasePassword(datadir)
+	if err != nil || password != "" {
+		return password, err
+	}
+	return daemon.GenerateGitbasePassword()
+}
+
+// gitbaseOptions returns the options of gitbase given with the flags or the
+// config file.
+func gitbaseOptions() (daemon.GitbaseOptions, error) {
+	return gitbaseOptionsOf(gitbaseValues{
+		preset:         viper.GetString("gitbase.preset"),
+		squash:         viper.GetString("gitbase.squash"),
+		cacheSize:      viper.GetString("gitbase.cache-size"),
+		maxMemory:      viper.GetString("gitbase.max-memory"),
+		connTimeout:    viper.GetString("gitbase.conn-timeout"),
+		queryTimeout:   viper.GetString("gitbase.query-timeout"),
+		maxConnections: viper.GetString("gitbase.max-connections"),
+		parallelism:    viper.GetString("gitbase.parallelism"),
+		logLevel:       viper.GetString("gitbase.log-level"),
+		user:           viper.GetString("gitbase.user"),
+		password:       viper.GetString("gitbase.password"),
+	})
+}
+
+// gitbaseValues are the values given of the options of gitbase, empty if
+// they are not given.
+type gitbaseValues struct {
+	preset         string
+	squash         string
+	cacheSize      string
+	maxMemory      string
+	connTimeout    string
+	queryTimeout   string
+	maxConnections string
+	parallelism    string
+	logLevel       string
+	user           string
+	// password is kept as given, auto included. See resolveGitbasePassword.
+	password string
+}
+
+// gitbaseOptionsOf returns the options of gitbase with the values given, the
+// ones of the preset for those not given.
+func gitbaseOptionsOf(v gitbaseValues) (daemon.GitbaseOptions, error) {
+	if err := checkGitbasePreset(v.preset); err != nil {
+		return daemon.GitbaseOptions{}, usageErrorf("invalid gitbase preset %q: %v", v.preset, err)
+	}
+	opts := gitbasePresets[v.preset]
+
+	if err := checkOnOff(v.squash); err != nil {
+		return opts, usageErrorf("invalid gitbase squash %q: %v", v.squash, err)
+	}
+	opts.Squash = v.squash == "on"
+
+	sizes := []struct {
+		name  string
+		value string
+		opt   *string
+	}{
+		{"cache size", v.cacheSize, &opts.CacheSize},
+		{"max memory", v.maxMemory, &opts.MaxMemory},
+	}
+	for _, s := range sizes {
+		if s.value == "" {
+			continue
+		}
+
+		if err := checkGitbaseSize(s.value); err != nil {
+			return opts, usageErrorf("invalid gitbase %s %q: %v", s.name, s.value, err)
+		}
+		*s.opt = s.value
+	}
+
+	timeouts := []struct {
+		name  string
+		value string
+		opt   *time.Duration
+	}{
+		{"connection timeout", v.connTimeout, &opts.ConnTimeout},
+		{"query timeout", v.queryTimeout, &opts.QueryTimeout},
+	}
+	for _, t := range timeouts {
+		if t.value == "" {
+			continue
+		}
+
+		if err := checkGitbaseTimeout(t.value); err != nil {
+			return opts, usageErrorf("invalid gitbase %s %q: %v", t.name, t.value, err)
+		}
+
+		if d, _ := time.ParseDuration(t.value); d > 0 {
+			*t.opt = d
+		}
+	}
+
+	if v.maxConnections != "" {
+		if err := checkGitbaseConnections(v.maxConnections); err != nil {
+			return opts, usageErrorf("invalid gitbase max connections %q: %v", v.maxConnections, err)
+		}
+
+		if n, _ := strconv.Atoi(v.maxConnections); n > 0 {
+			opts.MaxConnections = n
+		}
+	}
+
+	if v.parallelism != "" {
+		if err := checkGitbaseParallelism(v.parallelism); err != nil {
+			return opts, usageErrorf("invalid gitbase parallelism %q: %v", v.parallelism, err)
+		}
+		opts.Parallelism, _ = strconv.Atoi(v.parallelism)
+	}
+
+	if err := checkGitbaseLogLevel(v.logLevel); err != nil {
+		return opts, usageErrorf("invalid gitbase log level %q: %v", v.logLevel, err)
+	}
+	opts.LogLevel = v.logLevel
+
+	if err := checkGitbaseUser(v.user); err != nil {
+		return opts, usageErrorf("invalid gitbase user %q: %v", v.user, err)
+	}
+	opts.User, opts.Password = v.user, v.password
+	return opts, nil
+}
@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/src-d/engine/cmd/srcd/daemon"
+)
+
+func TestGitbaseOptions(t *testing.T) {
+	testCases := []struct {
+		name     string
+		values   gitbaseValues
+		expected daemon.GitbaseOptions
+		err      string
+	}{
+		{"defaults", gitbaseValues{squash: "off", connTimeout: "0s"}, daemon.GitbaseOptions{}, ""},
+		{"squash", gitbaseValues{squash: "on"}, daemon.GitbaseOptions{Squash: true}, ""},
+		{"preset", gitbaseValues{preset: "laptop", squash: "off"},
+			daemon.GitbaseOptions{CacheSize: "256m", MaxMemory: "512m"}, ""},
+		{"preset overridden", gitbaseValues{preset: "server", squash: "off", cacheSize: "8g", connTimeout: "30s"},
+			daemon.GitbaseOptions{CacheSize: "8g", MaxMemory: "32g", ConnTimeout: 30 * time.Second}, ""},
+		{"unknown preset", gitbaseValues{preset: "desktop", squash: "off"}, daemon.GitbaseOptions{},
+			`invalid gitbase preset "desktop": it must be one of laptop, server, workstation`},
+		{"invalid squash", gitbaseValues{squash: "yes"}, daemon.GitbaseOptions{},
+			`invalid gitbase squash "yes": it must be on or off`},
+		{"invalid size", gitbaseValues{squash: "off", cacheSize: "lots"}, daemon.GitbaseOptions{},
+			`invalid gitbase cache size "lots": invalid size: 'lots'`},
+		{"small size", gitbaseValues{squash: "off", maxMemory: "512k"}, daemon.GitbaseOptions{},
+			`invalid gitbase max memory "512k": it must be at least 1m`},
+		{"short timeout", gitbaseValues{squash: "off", connTimeout: "10ms"}, daemon.GitbaseOptions{},
+			`invalid gitbase connection timeout "10ms": it must be at least 1s, or 0 for the default of gitbase`},
+		{"limits", gitbaseValues{squash: "off", queryTimeout: "10m", maxConnections: "20"},
+			daemon.GitbaseOptions{QueryTimeout: 10 * time.Minute, MaxConnections: 20}, ""},
+		{"default limits", gitbaseValues{squash: "off", queryTimeout: "0s", maxConnections: "0"}, daemon.GitbaseOptions{}, ""},
+		{"short query timeout", gitbaseValues{squash: "off", queryTimeout: "500ms"}, daemon.GitbaseOptions{},
+			`invalid gitbase query timeout "500ms": it must be at least 1s, or 0 for the default of gitbase`},
+		{"credentials", gitbaseValues{squash: "off", user: "analyst", password: "auto"},
+			daemon.GitbaseOptions{User: "analyst", Password: "auto"}, ""},
+		{"invalid user", gitbaseValues{squash: "off", user: "me@home"}, daemon.GitbaseOptions{},
+			`invalid gitbase user "me@home": it can only have letters, digits, '_', '.' and '-'`},
+		{"log level", gitbaseValues{squash: "off", logLevel: "debug"}, daemon.GitbaseOptions{LogLevel: "debug"}, ""},
+		{"parallelism", gitbaseValues{squash: "off", parallelism: "4"}, daemon.GitbaseOptions{Parallelism: 4}, ""},
+		{"negative parallelism", gitbaseValues{squash: "off", parallelism: "-2"}, daemon.GitbaseOptions{},
+			`invalid gitbase parallelism "-2": it can't be negative, use 0 for the number of CPUs`},
+		{"invalid log level", gitbaseValues{squash: "off", logLevel: "verbose"}, daemon.GitbaseOptions{},
+			`invalid gitbase log level "verbose": it must be one of error, warn, info, debug, trace`},
+		{"negative connections", gitbaseValues{squash: "off", maxConnections: "-1"}, daemon.GitbaseOptions{},
+			`invalid gitbase max connections "-1": it can't be negative, use 0 for the default of gitbase`},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			opts, err := gitbaseOptionsOf(tt.values)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("expected error: %s, got: %v", tt.err, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if opts != tt.expected {
+				t.Errorf("expected: %+v, got: %+v", tt.expected, opts)
+			}
+		})
+	}
+}
+
+func TestResolveGitbasePassword(t *testing.T) {
+	dir, err := ioutil.TempDir("", "srcd-gitbase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, value := range []string{"", "secret"} {
+		password, err := resolveGitbasePassword(dir, value)
+		if err != nil || password != value {
+			t.Errorf("expected: %q, got: %q %v", value, password, err)
+		}
+	}
+
+	generated, err := resolveGitbasePassword(dir, "auto")
+	if err != nil || len(generated) != 64 {
+		t.Errorf("expected a password of 64 characters, got: %q %v", generated, err)
+	}
+
+	file := daemon.GitbasePasswordFile(dir)
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(file, []byte("stored\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	password, err := resolveGitbasePassword(dir, "auto")
+	if err != nil || password != "stored" {
+		t.Errorf("expected: stored, got: %q %v", password, err)
+	}
+}
@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	homedir "github.com/mitchellh/go-homedir"
+	"github.com/sirupsen/logrus"
+	"github.com/src-d/engine/cmd/srcd/daemon"
+)
+
+// dockerDesktopSettings is where Docker Desktop for Mac keeps its settings,
+// relative to the home directory.
+const dockerDesktopSettings = "Library/Group Containers/group.com.docker/settings.json"
+
+// canonicalPath returns the absolute path of the directory with all the
+// symlinks resolved, which is the one docker can mount, translated first if
+// it's one of the other side of WSL.
+func canonicalPath(dir string) (string, error) {
+	dir, err := daemon.TranslatePath(dir)
+	if err != nil {
+		return "", err
+	}
+
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+
+	resolved, err := filepath.EvalSymlinks(abs)
+	if os.IsNotExist(err) {
+		return "", fmt.Errorf("directory %s does not exist", abs)
+	} else if err != nil {
+		return "", err
+	}
+
+	fi, err := os.Stat(resolved)
+	if err != nil {
+		return "", err
+	}
+
+	if !fi.IsDir() {
+		return "", fmt.Errorf("%s is not a directory", abs)
+	}
+
+	return resolved, nil
+}
+
+// checkMountable fails if the directory is in a network share, which would be
+// mounted empty, and warns if docker is known not to share it with the
+// containers, or to mount it slowly from the other side of WSL.
+func checkMountable(dir string) error {
+	if fs, ok := networkFilesystem(dir); ok {
+		return fmt.Errorf("%s is in a network share (%s), which can't be mounted "+
+			"into the containers; move the repositories to a local disk", dir, fs)
+	}
+
+	if shared, ok := dockerDesktopSharedPaths(); ok && !inPaths(dir, shared) {
+		logrus.Warnf("%s is not shared with Docker Desktop, so gitbase won't see it; "+
+			"add it in Preferences > File Sharing. Shared paths: %s",
+			dir, strings.Join(shared, ", "))
+	}
+
+	if warning := daemon.CrossingWarning(dir, daemon.DetectTopology()); warning != "" {
+		logrus.Warn(warning)
+	}
+
+	return nil
+}
+
+// dockerDesktopSharedPaths returns the paths shared with the containers in
+// the settings of Docker Desktop for Mac, if they can be found.
+func dockerDesktopSharedPaths() ([]string, bool) {
+	if runtime.GOOS != "darwin" {
+		return nil, false
+	}
+
+	home, err := homedir.Dir()
+	if err != nil {
+		return nil, false
+	}
+
+	content, err := ioutil.ReadFile(filepath.Join(home, dockerDesktopSettings))
+	if err != nil {
+		return nil, false
+	}
+
+	var settings struct {
+		FilesharingDirectories []string `json:"filesharingDirectories"`
+	}
+
+	if err := json.Unmarshal(content, &settings); err != nil || len(settings.FilesharingDirectories) == 0 {
+		return nil, false
+	}
+
+	// The shared paths can be symlinks too, like /tmp.
+	var paths []string
+	for _, p := range settings.FilesharingDirectories {
+		paths = append(paths, p)
+		if resolved, err := filepath.EvalSymlinks(p); err == nil && resolved != p {
+			paths = append(paths, resolved)
+		}
+	}
+
+	return paths, true
+}
+
+// inPaths reports whether the directory is any of the paths or inside them.
+func inPaths(dir string, paths []string) bool {
+	for _, p := range paths {
+		rel, err := filepath.Rel(p, dir)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
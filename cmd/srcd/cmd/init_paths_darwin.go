@@ -0,0 +1,32 @@
+package cmd
+
+import "syscall"
+
+// networkFilesystems are the names of the network filesystems returned by
+// statfs.
+var networkFilesystems = map[string]bool{
+	"nfs":    true,
+	"smbfs":  true,
+	"afpfs":  true,
+	"webdav": true,
+}
+
+// networkFilesystem returns the type of network filesystem the directory is
+// in, if it's in one.
+func networkFilesystem(dir string) (string, bool) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return "", false
+	}
+
+	var name []byte
+	for _, c := range st.Fstypename {
+		if c == 0 {
+			break
+		}
+		name = append(name, byte(c))
+	}
+
+	fs := string(name)
+	return fs, networkFilesystems[fs]
+}
@@ -0,0 +1,24 @@
+package cmd
+
+import "syscall"
+
+// networkFilesystems are the magic numbers of the network filesystems
+// returned by statfs.
+var networkFilesystems = map[int64]string{
+	0x6969:     "nfs",
+	0xFF534D42: "cifs",
+	0x517B:     "smb",
+	0xFE534D42: "smb2",
+}
+
+// networkFilesystem returns the type of network filesystem the directory is
+// in, if it's in one.
+func networkFilesystem(dir string) (string, bool) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return "", false
+	}
+
+	fs, ok := networkFilesystems[int64(st.Type)]
+	return fs, ok
+}
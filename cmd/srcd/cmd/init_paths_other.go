@@ -0,0 +1,9 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package cmd
+
+// networkFilesystem can't detect network filesystems in this platform.
+func networkFilesystem(dir string) (string, bool) {
+	return "", false
+}
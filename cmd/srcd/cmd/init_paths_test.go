@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCanonicalPath(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "srcd-init")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	tmp, err = filepath.EvalSymlinks(tmp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	real := filepath.Join(tmp, "real")
+	link := filepath.Join(tmp, "link")
+	if err := os.Mkdir(real, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Symlink(real, link); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := canonicalPath(link)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if result != real {
+		t.Errorf("expected: %s, got: %s", real, result)
+	}
+
+	if _, err := canonicalPath(filepath.Join(tmp, "missing")); err == nil {
+		t.Errorf("expected error for a missing directory")
+	}
+}
+
+func TestInPaths(t *testing.T) {
+	shared := []string{"/Users", "/private", "/tmp"}
+	testCases := []struct {
+		dir      string
+		expected bool
+	}{
+		{"/Users/me/src", true},
+		{"/private/tmp/work", true},
+		{"/tmp", true},
+		{"/opt/src", false},
+		{"/Users2/src", false},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.dir, func(t *testing.T) {
+			if result := inPaths(tt.dir, shared); result != tt.expected {
+				t.Errorf("expected: %v, got: %v", tt.expected, result)
+			}
+		})
+	}
+}
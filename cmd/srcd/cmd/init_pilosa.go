@@ -0,0 +1,205 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/docker/go-units"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"github.com/src-d/engine/api"
+	"github.com/src-d/engine/cmd/srcd/daemon"
+	"github.com/src-d/engine/components"
+	"github.com/src-d/engine/docker"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// pilosaReadyTimeout is how long the commands starting pilosa wait for the
+// daemon to report it healthy, outside of init.
+const pilosaReadyTimeout = 2 * time.Minute
+
+// pilosaMemoryShare is the fraction of the memory of docker pilosa is
+// limited to when no --pilosa-memory is given, and pilosaCacheShare the one
+// of its limit its caches take when no --pilosa-cache-size is.
+const (
+	pilosaMemoryShare = 4
+	pilosaCacheShare  = 4
+)
+
+// pilosaUnhealthyHint tells how to find why pilosa is not healthy.
+const pilosaUnhealthyHint = "check why with srcd logs pilosa, and start it again with srcd restart pilosa"
+
+// checkPilosaExpose validates the addresses of the host pilosa is published
+// on.
+func checkPilosaExpose(value string) error {
+	_, err := components.ParsePilosaExpose(value)
+	return err
+}
+
+// pilosaOptions returns the options of pilosa given with the flags or the
+// config file.
+func pilosaOptions() (daemon.PilosaOptions, error) {
+	port := viper.GetInt("pilosa.port")
+	if err := checkPort(viper.GetString("pilosa.port")); err != nil {
+		return daemon.PilosaOptions{}, usageErrorf("invalid pilosa port %d: %v", port, err)
+	}
+
+	expose, err := components.ParsePilosaExpose(viper.GetString("pilosa.expose"))
+	if err != nil {
+		return daemon.PilosaOptions{}, usageErrorf("invalid value of --expose-pilosa: %v", err)
+	}
+
+	memory, cacheSize := viper.GetString("pilosa.memory"), viper.GetString("pilosa.cache-size")
+	if err := checkSize(memory); err != nil {
+		return daemon.PilosaOptions{}, usageErrorf("invalid pilosa memory limit: %v", err)
+	}
+	if err := checkSize(cacheSize); err != nil {
+		return daemon.PilosaOptions{}, usageErrorf("invalid pilosa cache size: %v", err)
+	}
+
+	if memory == "" || cacheSize == "" {
+		var total int64
+		if info, err := docker.SystemInfo(); err == nil {
+			total = info.MemTotal
+		}
+		memory, cacheSize = pilosaMemoryDefaults(total, memory, cacheSize)
+	}
+	return daemon.PilosaOptions{Port: port, Expose: expose, Memory: memory, CacheSize: cacheSize}, nil
+}
+
+// pilosaMemoryDefaults returns the memory limit and the cache size of pilosa
+// with the empty ones scaled from the bytes of memory of docker, which on
+// macOS and Windows is the one of its virtual machine. Nothing is scaled if
+// the memory is not known, 0. The cache is scaled from the limit given, or
+// from the memory of docker without one.
+func pilosaMemoryDefaults(total int64, memory, cacheSize string) (string, string) {
+	if total <= 0 {
+		return memory, cacheSize
+	}
+
+	if memory == "" {
+		memory = fmt.Sprintf("%dm", total/pilosaMemoryShare/units.MiB)
+	}
+
+	if cacheSize == "" {
+		limit, _ := units.RAMInBytes(memory)
+		if limit <= 0 {
+			limit = total
+		}
+		cacheSize = fmt.Sprintf("%dm", limit/pilosaCacheShare/units.MiB)
+	}
+	return memory, cacheSize
+}
+
+// pilosaSettings returns the settings of pilosa, like memory: 2GiB: the ones
+// its container runs with, or the ones the daemon creates it with if there's
+// none, or nil if the engine is not initialized.
+func pilosaSettings() (map[string]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), statusTimeout)
+	defer cancel()
+
+	info, err := docker.Inspect(ctx, components.Pilosa.Name)
+	switch {
+	case err == docker.ErrNotFound:
+	case err != nil:
+		return nil, err
+	default:
+		return components.PilosaContainerSettings(info), nil
+	}
+
+	cfg, err := daemon.Running()
+	if err != nil || cfg == nil {
+		return nil, err
+	}
+
+	memory, _ := units.RAMInBytes(valueOrDefault(cfg.Pilosa.Memory, "0"))
+	cacheSize, _ := units.RAMInBytes(valueOrDefault(cfg.Pilosa.CacheSize, "0"))
+	return components.PilosaSettings(memory, cacheSize), nil
+}
+
+// pilosaHealth asks the running daemon whether pilosa answers at its status
+// endpoint.
+func pilosaHealth() (healthResult, error) {
+	c, err := daemon.HealthClient()
+	if err != nil {
+		return healthResult{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), healthCheckTimeout)
+	defer cancel()
+	return checkHealth(ctx, c, api.HealthPilosa)
+}
+
+// waitForPilosa waits until the daemon reports pilosa healthy, or disabled.
+// It waits until the deadline of init, or pilosaReadyTimeout outside of it.
+// The daemon probes it every daemon.health-interval.
+func waitForPilosa() error {
+	deadline, limit := initDeadline, "--init-timeout"
+	if deadline.IsZero() {
+		deadline, limit = time.Now().Add(pilosaReadyTimeout), pilosaReadyTimeout.String()
+	}
+
+	for {
+		res, err := pilosaHealth()
+		if err != nil {
+			return err
+		}
+
+		switch res.Status {
+		case healthpb.HealthCheckResponse_SERVING.String(), healthDisabled:
+			return nil
+		}
+		logrus.Debugf("pilosa not healthy yet: %s", res.Status)
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("pilosa not healthy within %s, the daemon reports it %s", limit, res.Status)
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// checkPilosaServing fails if the daemon reports pilosa doesn't answer, so
+// creating an index fails at once instead of when gitbase can't reach
+// pilosa. It doesn't fail if the daemon can't tell, as gitbase does then.
+func checkPilosaServing() error {
+	res, err := pilosaHealth()
+	if err != nil {
+		logrus.Debugf("could not check the health of pilosa: %v", err)
+		return nil
+	}
+
+	if res.Status == healthpb.HealthCheckResponse_NOT_SERVING.String() {
+		return fmt.Errorf("pilosa, which keeps the indexes, is not healthy; " + pilosaUnhealthyHint)
+	}
+	return nil
+}
+
+func runPilosaCheck() checkResult {
+	running, err := daemon.IsRunning()
+	if err != nil || !running {
+		return checkPilosa(running, healthResult{}, err)
+	}
+
+	res, err := pilosaHealth()
+	return checkPilosa(true, res, err)
+}
+
+// checkPilosa checks pilosa answers at its status endpoint, as the daemon
+// reports it.
+func checkPilosa(running bool, res healthResult, err error) checkResult {
+	switch {
+	case err != nil:
+		return warn("check the daemon with srcd daemon health", "could not get the health of pilosa: %v", err)
+	case !running:
+		return warn("run srcd init", "the daemon is not running, so the health of pilosa is not known")
+	case res.Status == healthDisabled:
+		return pass("pilosa is disabled")
+	case res.Status == healthpb.HealthCheckResponse_SERVING.String():
+		return pass("pilosa answers at its status endpoint")
+	case res.Status == healthpb.HealthCheckResponse_NOT_SERVING.String():
+		return fail(pilosaUnhealthyHint, "pilosa doesn't answer at its status endpoint")
+	default:
+		return warn("check again in a while", "the daemon didn't probe pilosa yet")
+	}
+}
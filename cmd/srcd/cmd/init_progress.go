@@ -0,0 +1,251 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// initLogLines is the number of lines of the logs of a container shown when
+// the step starting it fails.
+const initLogLines = 20
+
+// spinnerFrames are shown in turns next to the step running on terminals.
+var spinnerFrames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+// initStep is one of the steps of init.
+type initStep struct {
+	name string
+	run  func() error
+	// logs returns the last lines of the logs of the container involved in
+	// the step, shown if it fails. It can be nil.
+	logs func() ([]string, error)
+}
+
+// stepReporter reports the progress of the steps of init.
+type stepReporter interface {
+	start(step string)
+	finish(step string, elapsed time.Duration, err error, logs []string)
+}
+
+// runSteps runs the steps in order, stopping at the first one that fails.
+func runSteps(r stepReporter, steps []initStep) error {
+	for _, s := range steps {
+		r.start(s.name)
+		start := time.Now()
+		err := s.run()
+
+		var logs []string
+		if err != nil && s.logs != nil {
+			logs, _ = s.logs()
+		}
+
+		r.finish(s.name, time.Since(start), err, logs)
+		if err != nil {
+			return fmt.Errorf("%s failed: %v", s.name, err)
+		}
+	}
+
+	return nil
+}
+
+// newStepReporter returns a reporter writing to w, with a spinner if it's a
+// terminal, or one JSON event per line if asJSON is true.
+func newStepReporter(w io.Writer, tty, asJSON bool) stepReporter {
+	switch {
+	case asJSON:
+		return &jsonStepReporter{records: &jsonRecordWriter{w: w}}
+	case tty:
+		return &ttyStepReporter{w: w}
+	default:
+		return &plainStepReporter{w: w}
+	}
+}
+
+// commandStepReporter returns the reporter of the steps of the commands, with
+// step records on stdout with --output-mode json, or on stderr otherwise,
+// only for the steps failing with --quiet.
+func commandStepReporter() stepReporter {
+	switch {
+	case machineOutput():
+		return newStepReporter(os.Stdout, false, true)
+	case quiet:
+		return &quietStepReporter{w: os.Stderr}
+	default:
+		return newStepReporter(os.Stderr, isTerminal(os.Stderr), false)
+	}
+}
+
+// quietStepReporter only prints the steps that fail.
+type quietStepReporter struct {
+	w io.Writer
+}
+
+func (r *quietStepReporter) start(step string) {}
+
+func (r *quietStepReporter) finish(step string, elapsed time.Duration, err error, logs []string) {
+	if err != nil {
+		printStepResult(r.w, step, elapsed, err, logs)
+	}
+}
+
+// plainStepReporter prints a line when every step starts and another one when
+// it finishes, for outputs that are not terminals, like CI logs.
+type plainStepReporter struct {
+	w io.Writer
+}
+
+func (r *plainStepReporter) start(step string) {
+	fmt.Fprintf(r.w, "%s...\n", step)
+}
+
+func (r *plainStepReporter) finish(step string, elapsed time.Duration, err error, logs []string) {
+	printStepResult(r.w, step, elapsed, err, logs)
+}
+
+func printStepResult(w io.Writer, step string, elapsed time.Duration, err error, logs []string) {
+	elapsed = elapsed.Round(100 * time.Millisecond)
+	if err == nil {
+		fmt.Fprintf(w, "✓ %s (%s)\n", step, elapsed)
+		return
+	}
+
+	fmt.Fprintf(w, "✗ %s (%s): %v\n", step, elapsed, err)
+	if len(logs) > 0 {
+		fmt.Fprintln(w, "  last lines of the logs:")
+		for _, l := range logs {
+			fmt.Fprintf(w, "    %s\n", l)
+		}
+	}
+}
+
+// ttyStepReporter shows a spinner with the elapsed time next to the step
+// running, refreshed in place. It's also an io.Writer, so the logs printed
+// while a step runs don't get mixed with the spinner.
+type ttyStepReporter struct {
+	w io.Writer
+
+	mu      sync.Mutex
+	step    string
+	started time.Time
+	frame   int
+
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+func (r *ttyStepReporter) start(step string) {
+	r.mu.Lock()
+	r.step = step
+	r.started = time.Now()
+	r.frame = 0
+	r.draw()
+	r.mu.Unlock()
+
+	r.stop = make(chan struct{})
+	r.stopped = make(chan struct{})
+	go r.run()
+}
+
+func (r *ttyStepReporter) run() {
+	defer close(r.stopped)
+
+	ticker := time.NewTicker(progressTTYInterval / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			r.mu.Lock()
+			r.frame++
+			r.draw()
+			r.mu.Unlock()
+		case <-r.stop:
+			return
+		}
+	}
+}
+
+// draw must be called with the lock held.
+func (r *ttyStepReporter) draw() {
+	fmt.Fprintf(r.w, "\r\033[K%s %s (%s)",
+		spinnerFrames[r.frame%len(spinnerFrames)], r.step,
+		time.Since(r.started).Round(time.Second))
+}
+
+func (r *ttyStepReporter) finish(step string, elapsed time.Duration, err error, logs []string) {
+	close(r.stop)
+	<-r.stopped
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.step = ""
+	fmt.Fprint(r.w, "\r\033[K")
+	printStepResult(r.w, step, elapsed, err, logs)
+}
+
+// Write clears the spinner before writing p, which is drawn again after it.
+func (r *ttyStepReporter) Write(p []byte) (int, error) {
+	// Entries only written to the log file are formatted as nothing.
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.step == "" {
+		return r.w.Write(p)
+	}
+
+	fmt.Fprint(r.w, "\r\033[K")
+	n, err := r.w.Write(p)
+	r.draw()
+	return n, err
+}
+
+// Status of the events of --json-progress.
+const (
+	stepStarted   = "started"
+	stepSucceeded = "succeeded"
+	stepFailed    = "failed"
+)
+
+// stepEvent is printed by --json-progress when a step starts or finishes.
+type stepEvent struct {
+	Step   string `json:"step"`
+	Status string `json:"status"`
+	// Duration is the time the step took in seconds.
+	Duration float64  `json:"duration,omitempty"`
+	Error    string   `json:"error,omitempty"`
+	Logs     []string `json:"logs,omitempty"`
+}
+
+// jsonStepReporter prints one JSON event per line, step records, so GUIs can
+// show the progress of init.
+type jsonStepReporter struct {
+	records recordWriter
+}
+
+func (r *jsonStepReporter) start(step string) {
+	r.records.write("step", stepEvent{Step: step, Status: stepStarted}, nil)
+}
+
+func (r *jsonStepReporter) finish(step string, elapsed time.Duration, err error, logs []string) {
+	e := stepEvent{
+		Step:     step,
+		Status:   stepSucceeded,
+		Duration: elapsed.Round(time.Millisecond).Seconds(),
+	}
+
+	if err != nil {
+		e.Status = stepFailed
+		e.Error = err.Error()
+		e.Logs = logs
+	}
+
+	r.records.write("step", e, nil)
+}
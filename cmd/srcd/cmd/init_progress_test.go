@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPlainStepReporter(t *testing.T) {
+	var buf bytes.Buffer
+	r := newStepReporter(&buf, false, false)
+	r.start("pull images")
+	r.finish("pull images", 1520*time.Millisecond, nil, nil)
+	r.start("start gitbase")
+	r.finish("start gitbase", 3*time.Second, errors.New("exited"), []string{"panic: oops", "exit 2"})
+
+	expected := `pull images...
+✓ pull images (1.5s)
+start gitbase...
+✗ start gitbase (3s): exited
+  last lines of the logs:
+    panic: oops
+    exit 2
+`
+	if buf.String() != expected {
+		t.Errorf("expected: %s, got: %s", expected, buf.String())
+	}
+}
+
+func TestQuietStepReporter(t *testing.T) {
+	var buf bytes.Buffer
+	r := &quietStepReporter{w: &buf}
+	r.start("pull images")
+	r.finish("pull images", 1520*time.Millisecond, nil, nil)
+	r.start("start gitbase")
+	r.finish("start gitbase", 3*time.Second, errors.New("exited"), []string{"exit 2"})
+
+	expected := `✗ start gitbase (3s): exited
+  last lines of the logs:
+    exit 2
+`
+	if buf.String() != expected {
+		t.Errorf("expected: %s, got: %s", expected, buf.String())
+	}
+}
+
+func TestJSONStepReporter(t *testing.T) {
+	var buf bytes.Buffer
+	r := newStepReporter(&buf, true, true)
+	r.start("start daemon")
+	r.finish("start daemon", 2500*time.Millisecond, nil, nil)
+	r.finish("start bblfshd", time.Second, errors.New("oops"), []string{"line"})
+
+	expected := `{"type":"step","step":"start daemon","status":"started"}
+{"type":"step","step":"start daemon","status":"succeeded","duration":2.5}
+{"type":"step","step":"start bblfshd","status":"failed","duration":1,"error":"oops","logs":["line"]}
+`
+	if buf.String() != expected {
+		t.Errorf("expected: %s, got: %s", expected, buf.String())
+	}
+}
+
+func TestRunSteps(t *testing.T) {
+	var ran []string
+	step := func(name string, err error) initStep {
+		return initStep{
+			name: name,
+			run: func() error {
+				ran = append(ran, name)
+				return err
+			},
+			logs: func() ([]string, error) { return []string{name + " logs"}, nil },
+		}
+	}
+
+	var buf bytes.Buffer
+	err := runSteps(newStepReporter(&buf, false, true), []initStep{
+		step("one", nil),
+		step("two", errors.New("oops")),
+		step("three", nil),
+	})
+
+	if err == nil || err.Error() != "two failed: oops" {
+		t.Errorf("expected error: two failed: oops, got: %v", err)
+	}
+
+	if result := strings.Join(ran, ","); result != "one,two" {
+		t.Errorf("expected: one,two, got: %s", result)
+	}
+
+	if !strings.Contains(buf.String(), `"logs":["two logs"]`) {
+		t.Errorf("expected the logs of the failed step, got: %s", buf.String())
+	}
+}
@@ -0,0 +1,223 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Bounds of the scan looking for repositories in the working directory, so
+// init stays fast on huge directories.
+const (
+	repoScanDepth   = 4
+	repoScanTimeout = 5 * time.Second
+)
+
+var errScanTimeout = errors.New("scan timed out")
+
+// Kinds of the repositories found.
+const (
+	repoWorktree  = "worktree"
+	repoBare      = "bare"
+	repoSiva      = "siva"
+	repoNested    = "nested"
+	repoSubmodule = "submodule"
+)
+
+// Formats of the repositories read by gitbase.
+const (
+	repoFormatGit  = "git"
+	repoFormatSiva = "siva"
+)
+
+// repoFormat returns the format of the repositories found, checking the one
+// given, if any, or detecting it otherwise. Directories with only siva files
+// use the siva format. Both formats can't be mixed, as gitbase reads only one
+// of them.
+func repoFormat(scan *repoScan, format string) (string, error) {
+	if format != "" && format != repoFormatGit && format != repoFormatSiva {
+		return "", fmt.Errorf("unknown repository format %s, it must be %s or %s",
+			format, repoFormatGit, repoFormatSiva)
+	}
+
+	sivas := len(scan.ofKind(repoSiva))
+	repos := scan.repositories - sivas
+	if sivas > 0 && repos > 0 {
+		return "", fmt.Errorf("found %d git repositories and %d siva files, but gitbase "+
+			"can only read one format; keep them in different directories and init "+
+			"one of them", repos, sivas)
+	}
+
+	switch {
+	case format != "":
+		return format, nil
+	case sivas > 0:
+		return repoFormatSiva, nil
+	default:
+		return repoFormatGit, nil
+	}
+}
+
+// foundRepository is a repository found in one of the directories scanned.
+type foundRepository struct {
+	root string
+	path string
+	kind string
+	// parent is the worktree containing nested repositories and submodules.
+	parent string
+}
+
+// repoScan is the result of looking for repositories in some directories.
+type repoScan struct {
+	// repositories is the number of repositories found, not counting
+	// submodules, which are part of their parent.
+	repositories int
+	// found are the repositories found, with the directory they are in.
+	found []foundRepository
+	// excluded are the ones found excluded with --exclude-repo, not in
+	// found nor counted.
+	excluded []foundRepository
+	// incomplete is true if the scan stopped before visiting all the
+	// directories because it took too long.
+	incomplete bool
+}
+
+// ofKind returns the repositories found of the given kind.
+func (s *repoScan) ofKind(kind string) []foundRepository {
+	var result []foundRepository
+	for _, r := range s.found {
+		if r.kind == kind {
+			result = append(result, r)
+		}
+	}
+	return result
+}
+
+func (s *repoScan) add(r foundRepository) {
+	if r.kind != repoSubmodule {
+		s.repositories++
+	}
+	s.found = append(s.found, r)
+}
+
+// scanRepositories looks for the git repositories in the given directories up
+// to the given depth: worktrees, bare repositories and siva files. Worktrees
+// are walked into, except their .git directory, to find the repositories
+// nested in them, told apart from their submodules.
+func scanRepositories(dirs []string, maxDepth int, timeout time.Duration) (*repoScan, error) {
+	deadline := time.Now().Add(timeout)
+	scan := new(repoScan)
+	for _, dir := range dirs {
+		var worktrees []string
+		err := filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+			if err != nil {
+				// Unreadable directories are just not counted.
+				if fi != nil && fi.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+
+			if time.Now().After(deadline) {
+				return errScanTimeout
+			}
+
+			parent := enclosingWorktree(worktrees, path)
+			if !fi.IsDir() {
+				if strings.HasSuffix(fi.Name(), ".siva") {
+					scan.add(foundRepository{root: dir, path: path, kind: repoSiva, parent: parent})
+				}
+				return nil
+			}
+
+			if fi.Name() == ".git" {
+				return filepath.SkipDir
+			}
+
+			if isBareRepository(path) {
+				scan.add(foundRepository{root: dir, path: path, kind: repoBare, parent: parent})
+				return filepath.SkipDir
+			}
+
+			if isWorktree(path) {
+				kind := repoWorktree
+				switch {
+				case parent != "" && isSubmodule(path):
+					kind = repoSubmodule
+				case parent != "":
+					kind = repoNested
+				}
+
+				scan.add(foundRepository{root: dir, path: path, kind: kind, parent: parent})
+				worktrees = append(worktrees, path)
+			}
+
+			rel, err := filepath.Rel(dir, path)
+			if err != nil {
+				return err
+			}
+
+			if path != dir && (strings.HasPrefix(fi.Name(), ".") || depth(rel) >= maxDepth) {
+				return filepath.SkipDir
+			}
+			return nil
+		})
+
+		if err == errScanTimeout {
+			scan.incomplete = true
+			return scan, nil
+		} else if err != nil {
+			return nil, err
+		}
+	}
+
+	return scan, nil
+}
+
+// enclosingWorktree returns the innermost of the worktrees containing path, or
+// an empty string if there's none.
+func enclosingWorktree(worktrees []string, path string) string {
+	for i := len(worktrees) - 1; i >= 0; i-- {
+		if strings.HasPrefix(path, worktrees[i]+string(filepath.Separator)) {
+			return worktrees[i]
+		}
+	}
+	return ""
+}
+
+func depth(rel string) int {
+	return len(strings.Split(filepath.ToSlash(rel), "/"))
+}
+
+// isWorktree reports whether the directory has a .git directory or file.
+func isWorktree(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, ".git"))
+	return err == nil
+}
+
+// isBareRepository reports whether the directory is a bare repository, with
+// the HEAD, objects and refs of git and no worktree.
+func isBareRepository(dir string) bool {
+	for _, name := range []string{"HEAD", "objects", "refs"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// isSubmodule reports whether the worktree is a submodule, which have a .git
+// file pointing to the modules directory of its parent.
+func isSubmodule(dir string) bool {
+	content, err := ioutil.ReadFile(filepath.Join(dir, ".git"))
+	if err != nil {
+		return false
+	}
+
+	gitdir := strings.TrimSpace(strings.TrimPrefix(string(content), "gitdir:"))
+	return strings.Contains(filepath.ToSlash(gitdir), ".git/modules/")
+}
@@ -0,0 +1,133 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestScanRepositories(t *testing.T) {
+	dir, err := ioutil.TempDir("", "srcd-init")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	paths := []string{
+		"worktree/.git/objects",
+		"worktree/.git/modules/submodule",
+		"worktree/submodule",
+		"worktree/vendor/nested/.git",
+		"group/bare/objects",
+		"group/bare/refs",
+		"plain/src",
+		"a/b/c/d/e/deep/.git",
+	}
+	for _, p := range paths {
+		if err := os.MkdirAll(filepath.Join(dir, p), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files := map[string]string{
+		"group/bare/HEAD":         "",
+		"sivas/repo.siva":         "",
+		"plain/src/main.go":       "",
+		"worktree/submodule/.git": "gitdir: ../.git/modules/submodule\n",
+	}
+	for f, content := range files {
+		path := filepath.Join(dir, f)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	scan, err := scanRepositories([]string{dir}, repoScanDepth, time.Minute)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if scan.repositories != 4 || scan.incomplete {
+		t.Errorf("expected 4 repositories, got %+v", scan)
+	}
+
+	expected := map[string]string{
+		"worktree":               repoWorktree,
+		"worktree/submodule":     repoSubmodule,
+		"worktree/vendor/nested": repoNested,
+		"group/bare":             repoBare,
+		"sivas/repo.siva":        repoSiva,
+	}
+
+	if len(scan.found) != len(expected) {
+		t.Fatalf("expected %d repositories found, got %+v", len(expected), scan.found)
+	}
+
+	for _, r := range scan.found {
+		rel, err := filepath.Rel(dir, r.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if kind := expected[filepath.ToSlash(rel)]; kind != r.kind {
+			t.Errorf("expected %s to be %s, got: %s", rel, kind, r.kind)
+		}
+	}
+
+	nested := scan.ofKind(repoNested)
+	if len(nested) != 1 || nested[0].parent != filepath.Join(dir, "worktree") {
+		t.Errorf("expected the nested repository to be in the worktree, got: %+v", nested)
+	}
+}
+
+func TestRepoFormat(t *testing.T) {
+	git := foundRepository{kind: repoWorktree}
+	siva := foundRepository{kind: repoSiva}
+
+	testCases := []struct {
+		name     string
+		found    []foundRepository
+		format   string
+		expected string
+		err      bool
+	}{
+		{"git detected", []foundRepository{git}, "", repoFormatGit, false},
+		{"siva detected", []foundRepository{siva, siva}, "", repoFormatSiva, false},
+		{"nothing found", nil, "", repoFormatGit, false},
+		{"given", []foundRepository{siva}, repoFormatSiva, repoFormatSiva, false},
+		{"given without repositories", nil, repoFormatSiva, repoFormatSiva, false},
+		{"mixed", []foundRepository{git, siva}, "", "", true},
+		{"mixed given", []foundRepository{git, siva}, repoFormatGit, "", true},
+		{"unknown", []foundRepository{git}, "svn", "", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			scan := new(repoScan)
+			for _, r := range tc.found {
+				scan.add(r)
+			}
+
+			format, err := repoFormat(scan, tc.format)
+			if tc.err {
+				if err == nil {
+					t.Errorf("expected error, got format %s", format)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if format != tc.expected {
+				t.Errorf("expected: %s, got: %s", tc.expected, format)
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/src-d/engine/cmd/srcd/daemon"
+	"github.com/src-d/engine/components"
+	"github.com/src-d/engine/docker"
+)
+
+func TestRelativeComponents(t *testing.T) {
+	withoutPilosa := []string{components.Bblfshd.Name, components.Gitbase.Name}
+
+	testCases := []struct {
+		name     string
+		enabled  []string
+		names    []string
+		expected string
+		without  string
+		err      bool
+	}{
+		{"add", withoutPilosa, []string{"+pilosa"},
+			"srcd-cli-bblfshd,srcd-cli-gitbase,srcd-cli-pilosa", "", false},
+		{"remove", nil, []string{"-pilosa"},
+			"srcd-cli-bblfshd,srcd-cli-bblfsh-web,srcd-cli-gitbase,srcd-cli-gitbase-web", "srcd-cli-pilosa", false},
+		{"added twice", withoutPilosa, []string{"+gitbase"},
+			"srcd-cli-bblfshd,srcd-cli-gitbase", "", false},
+		{"mixed", withoutPilosa, []string{"+pilosa", "gitbase"}, "", "", true},
+		{"unknown", withoutPilosa, []string{"+foo"}, "", "", true},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			names, without, err := relativeComponents(tt.enabled, tt.names, nil)
+			if tt.err {
+				if err == nil {
+					t.Errorf("expected an error, got: %v", names)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := strings.Join(names, ","); got != tt.expected {
+				t.Errorf("expected: %s, got: %s", tt.expected, got)
+			}
+			if got := strings.Join(without, ","); got != tt.without {
+				t.Errorf("expected: %s, got: %s", tt.without, got)
+			}
+		})
+	}
+}
+
+func TestComponentsToRecreate(t *testing.T) {
+	all := &daemon.Config{}
+	withoutPilosa := &daemon.Config{Components: []string{
+		components.Gitbase.Name, components.Bblfshd.Name,
+	}}
+
+	expected := "srcd-cli-bblfsh-web,srcd-cli-gitbase-web,srcd-cli-pilosa,srcd-cli-gitbase"
+	if got := strings.Join(componentsToRecreate(all, withoutPilosa), ","); got != expected {
+		t.Errorf("expected: %s, got: %s", expected, got)
+	}
+
+	withPilosa := &daemon.Config{Components: append(withoutPilosa.Components, components.Pilosa.Name)}
+	expected = "srcd-cli-pilosa,srcd-cli-gitbase"
+	if got := strings.Join(componentsToRecreate(withoutPilosa, withPilosa), ","); got != expected {
+		t.Errorf("expected: %s, got: %s", expected, got)
+	}
+
+	withoutWeb := &daemon.Config{Components: []string{
+		components.Gitbase.Name, components.Bblfshd.Name, components.Pilosa.Name, components.BblfshWeb.Name,
+	}}
+	expected = "srcd-cli-gitbase-web"
+	if got := strings.Join(componentsToRecreate(all, withoutWeb), ","); got != expected {
+		t.Errorf("expected: %s, got: %s", expected, got)
+	}
+}
+
+func TestPilosaMemoryDefaults(t *testing.T) {
+	const gb = 1 << 30
+	testCases := []struct {
+		name      string
+		total     int64
+		memory    string
+		cacheSize string
+		expected  string
+	}{
+		{"scaled", 8 * gb, "", "", "2048m 512m"},
+		{"memory given", 8 * gb, "4g", "", "4g 1024m"},
+		{"no limit", 8 * gb, "0", "", "0 2048m"},
+		{"both given", 8 * gb, "1g", "128m", "1g 128m"},
+		{"unknown memory", 0, "", "", " "},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			memory, cacheSize := pilosaMemoryDefaults(tc.total, tc.memory, tc.cacheSize)
+			if got := memory + " " + cacheSize; got != tc.expected {
+				t.Errorf("expected: %s, got: %s", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestMixedPlatformsWarning(t *testing.T) {
+	arm64 := docker.Platform{OS: "linux", Architecture: "arm64"}
+	amd64 := docker.Platform{OS: "linux", Architecture: "amd64"}
+	cmps := []components.Component{components.Bblfshd, components.Pilosa, components.Gitbase}
+
+	testCases := []struct {
+		name      string
+		platforms map[string]docker.Platform
+		expected  string
+	}{
+		{"none forced", nil, ""},
+		{"all forced", map[string]docker.Platform{"": amd64}, ""},
+		{"native forced", map[string]docker.Platform{components.Gitbase.Name: arm64}, ""},
+		{"bblfshd forced", map[string]docker.Platform{components.Bblfshd.Name: amd64},
+			"the components run for different platforms: bblfshd for linux/amd64; pilosa, gitbase for linux/arm64; " +
+				"the drivers of bblfshd run for linux/amd64, the one of bblfshd"},
+		{"gitbase forced", map[string]docker.Platform{"": arm64, components.Gitbase.Name: amd64},
+			"the components run for different platforms: bblfshd, pilosa for linux/arm64; gitbase for linux/amd64; " +
+				"the drivers of bblfshd run for linux/arm64, the one of bblfshd"},
+	}
+
+	defer components.SetPlatforms(nil)
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			components.SetPlatforms(tc.platforms)
+			if result := mixedPlatformsWarning(arm64, cmps); result != tc.expected {
+				t.Errorf("expected: %s, got: %s", tc.expected, result)
+			}
+		})
+	}
+}
+
+func TestKeepComponent(t *testing.T) {
+	testCases := []struct {
+		name      string
+		state     string
+		health    string
+		keep      bool
+		condition string
+	}{
+		{"running", components.StateRunning, components.HealthNone, true, ""},
+		{"healthy", components.StateRunning, types.Healthy, true, ""},
+		{"starting", components.StateRunning, types.Starting, true, ""},
+		{"unhealthy", components.StateRunning, types.Unhealthy, false, "unhealthy"},
+		{"exited", components.StateStopped, components.HealthNone, false, "stopped"},
+		{"not created", components.StateNotCreated, components.HealthNone, false, "not created"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := &components.Status{State: tc.state, Health: tc.health}
+			if keep := keepComponent(s); keep != tc.keep {
+				t.Errorf("expected: %v, got: %v", tc.keep, keep)
+			}
+			if !tc.keep && componentCondition(s) != tc.condition {
+				t.Errorf("expected: %s, got: %s", tc.condition, componentCondition(s))
+			}
+		})
+	}
+}
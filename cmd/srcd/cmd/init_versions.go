@@ -0,0 +1,168 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/src-d/engine/components"
+	"github.com/src-d/engine/docker"
+)
+
+// versionsKey is the section of the config file with the versions the
+// components are pinned to, by component name.
+const versionsKey = "components.versions"
+
+// versionDefault is the value of the --<component>-version flags of init that
+// unpins the version of the component.
+const versionDefault = "default"
+
+// pinnableComponents are the components whose version can be pinned with the
+// --<component>-version flags of init.
+var pinnableComponents = []string{"gitbase", "bblfshd", "gitbase-web", "bblfsh-web"}
+
+// versionRegexp matches the tags of the docker images.
+var versionRegexp = regexp.MustCompile(`^[\w][\w.-]{0,127}$`)
+
+// versionCheckTimeout is how long the registry has to tell whether a version
+// given to init is published.
+const versionCheckTimeout = 30 * time.Second
+
+// versionPins returns the versions the components are pinned to in the
+// config file, by component name.
+func versionPins() (map[string]string, error) {
+	versions := make(map[string]string)
+	for name, version := range viper.GetStringMapString(versionsKey) {
+		c, ok := components.ByName(name)
+		version = strings.TrimSpace(version)
+		switch {
+		// pilosa is pinned with srcd components upgrade pilosa --to.
+		case !ok || !(isPinnable(c) || c.Name == components.Pilosa.Name):
+			return nil, fmt.Errorf("unknown component %s in %s", name, versionsKey)
+		case !versionRegexp.MatchString(version):
+			return nil, fmt.Errorf("invalid version %q of %s in %s", version, name, versionsKey)
+		}
+
+		if _, ok := c.Override(); ok {
+			return nil, fmt.Errorf("%s has both an image in %s and a version in %s; remove one of them",
+				c.ShortName(), imagesKey, versionsKey)
+		}
+		versions[c.Name] = version
+	}
+	return versions, nil
+}
+
+func isPinnable(c components.Component) bool {
+	for _, name := range pinnableComponents {
+		if c.ShortName() == name {
+			return true
+		}
+	}
+	return false
+}
+
+// applyVersionFlags pins the versions of the components given with the
+// --<component>-version flags, after checking they are published, or unpins
+// them with default, recording them in the config file.
+func applyVersionFlags(cmd *cobra.Command) error {
+	versions := make(map[string]string)
+	changed := false
+	for _, name := range pinnableComponents {
+		c, _ := components.ByName(name)
+		if version, ok := c.PinnedVersion(); ok {
+			versions[c.Name] = version
+		}
+
+		flag := name + "-version"
+		if !cmd.Flags().Changed(flag) {
+			continue
+		}
+
+		version, _ := cmd.Flags().GetString(flag)
+		version = strings.TrimSpace(version)
+		if version == versionDefault {
+			delete(versions, c.Name)
+			changed = true
+			continue
+		}
+
+		if _, ok := c.Override(); ok {
+			return usageErrorf("the image of %s is replaced with srcd components set-image; "+
+				"run srcd components set-image %s --reset before pinning its version", name, name)
+		}
+
+		if !versionRegexp.MatchString(version) {
+			return usageErrorf("invalid value of --%s %q: it must be the tag of an image, like v0.24.0", flag, version)
+		}
+
+		if err := checkPublishedVersion(c, version); err != nil {
+			return err
+		}
+		versions[c.Name] = version
+		changed = true
+	}
+
+	if !changed {
+		return nil
+	}
+
+	path, err := configFilePath()
+	if err != nil {
+		return err
+	}
+
+	for _, name := range pinnableComponents {
+		if !cmd.Flags().Changed(name + "-version") {
+			continue
+		}
+
+		c, _ := components.ByName(name)
+		key := versionsKey + "." + name
+		if version, ok := versions[c.Name]; ok {
+			err = setConfigFileValue(path, key, version)
+			logrus.Infof("%s pinned to version %s in %s", name, version, path)
+		} else {
+			err = setConfigFileValue(path, key, nil)
+			logrus.Infof("%s uses its default version %s again", name, c.DefaultRef())
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	components.SetPins(versions)
+	return nil
+}
+
+// checkPublishedVersion checks the given version of the image of the
+// component is published, or at least installed when the registry can't be
+// reached.
+func checkPublishedVersion(c components.Component, version string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), versionCheckTimeout)
+	defer cancel()
+
+	_, err := docker.RemoteDigest(ctx, c.Image, version)
+	if err == nil {
+		return nil
+	}
+
+	if installed, ierr := docker.IsInstalled(ctx, c.Image, version); ierr == nil && installed {
+		logrus.Warnf("could not check %s:%s is published: %v; using the installed image", c.Image, version, err)
+		return nil
+	}
+
+	return usageErrorf("version %s of %s is not published as %s:%s: %v", version, c.ShortName(), c.Image, version, err)
+}
+
+func init() {
+	for _, name := range pinnableComponents {
+		initCmd.Flags().String(name+"-version", "",
+			fmt.Sprintf("version of %s to install and run, like v0.24.0, kept in the config file, or default to unpin it", name))
+	}
+	addConfigSection(versionsKey)
+}
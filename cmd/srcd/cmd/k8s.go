@@ -0,0 +1,161 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/src-d/engine/cmd/srcd/daemon"
+	"github.com/src-d/engine/components"
+	"github.com/src-d/engine/docker"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// k8sHeader is written at the top of the kubernetes manifests exported.
+const k8sHeader = "# Exported by srcd k8s export, apply the directory with kubectl apply -f.\n"
+
+// k8sNamespaceRegexp matches the names of the namespaces of kubernetes.
+var k8sNamespaceRegexp = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]{0,61}[a-z0-9])?$`)
+
+// k8sQuantityRegexp matches the sizes of kubernetes, like 10Gi.
+var k8sQuantityRegexp = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?([KMGTPE]i?|k)?$`)
+
+var k8sCmd = &cobra.Command{
+	Use:   "k8s",
+	Short: "Export how the engine runs its components to kubernetes",
+}
+
+var k8sExportCmd = &cobra.Command{
+	Use:   "export [component...]",
+	Short: "Write the kubernetes manifests running the components as the engine does",
+	Long: `Write the kubernetes manifests running the components as the engine does
+
+The containers of the components running, or of the ones given along with the
+ones they require, are written to a directory as kubernetes manifests, a file
+per component numbered in the order they are applied: its config map with its
+environment, persistent volume claims, service and deployment, or stateful set
+for pilosa. The images have their digests, the resources come from the memory
+and CPUs the components are limited to, and the memory of the cache and joins
+of gitbase, and the readiness probes run their health checks.
+
+gitbase mounts the repositories from the claim of its repositories, and the
+directories of the data directory from the claim of its cache. Its password is
+read from a secret, which is not exported and must be created. Running it
+again with the same configuration writes the same files.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := daemon.Running()
+		if err != nil {
+			return err
+		}
+		if cfg == nil {
+			return notRunningErrorf("the daemon is not running; run srcd init first")
+		}
+
+		opts, err := k8sOptions(cmd)
+		if err != nil {
+			return err
+		}
+
+		cmps, err := exportComponents(cfg, args, docker.IsRunning)
+		if err != nil {
+			return err
+		}
+
+		opts.Workdir = cfg.Workdir
+		if opts.DataDir, err = daemon.ResolveDataDir(cfg.DataDir); err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		export, err := components.ExportK8s(ctx, cmps, opts)
+		if err != nil {
+			return err
+		}
+
+		output, _ := cmd.Flags().GetString("output")
+		if err := os.MkdirAll(output, 0755); err != nil {
+			return fmt.Errorf("could not create the directory of the manifests: %v", err)
+		}
+
+		for i, m := range export.Manifests {
+			content, err := k8sManifest(m)
+			if err != nil {
+				return err
+			}
+
+			path := filepath.Join(output, fmt.Sprintf("%02d-%s.yaml", i, m.Name))
+			if err := ioutil.WriteFile(path, content, 0644); err != nil {
+				return fmt.Errorf("could not write the manifest of %s: %v", m.Name, err)
+			}
+		}
+
+		for _, w := range export.Warnings {
+			logrus.Warn(w)
+		}
+
+		var names []string
+		for _, c := range cmps {
+			names = append(names, c.ShortName())
+		}
+		logrus.Infof("%s exported to %s", strings.Join(names, ", "), output)
+
+		if export.Password {
+			logrus.Infof("create the secret with the password of gitbase before applying them: "+
+				"kubectl create secret generic %s --namespace %s --from-literal=%s=<password>",
+				components.K8sPasswordSecret(), opts.Namespace, components.K8sPasswordKey)
+		}
+		return nil
+	},
+}
+
+// k8sOptions returns the options of the manifests given with the flags.
+func k8sOptions(cmd *cobra.Command) (components.K8sOptions, error) {
+	var opts components.K8sOptions
+	opts.Namespace, _ = cmd.Flags().GetString("namespace")
+	opts.StorageClass, _ = cmd.Flags().GetString("storage-class")
+	opts.StorageSize, _ = cmd.Flags().GetString("storage-size")
+
+	if !k8sNamespaceRegexp.MatchString(opts.Namespace) {
+		return opts, usageErrorf("invalid value of --namespace %q: it must be lowercase letters, digits and dashes", opts.Namespace)
+	}
+	if !k8sQuantityRegexp.MatchString(opts.StorageSize) {
+		return opts, usageErrorf("invalid value of --storage-size %q: it must be a size like 10Gi", opts.StorageSize)
+	}
+	return opts, nil
+}
+
+// k8sManifest returns the content of the file of the manifest, with its
+// objects as YAML documents.
+func k8sManifest(m components.K8sManifest) ([]byte, error) {
+	buf := bytes.NewBufferString(k8sHeader)
+	for _, o := range m.Objects {
+		content, err := yaml.Marshal(o)
+		if err != nil {
+			return nil, fmt.Errorf("could not encode the manifest of %s: %v", m.Name, err)
+		}
+
+		buf.WriteString("---\n")
+		buf.Write(content)
+	}
+	return buf.Bytes(), nil
+}
+
+func init() {
+	rootCmd.AddCommand(k8sCmd)
+	k8sCmd.AddCommand(k8sExportCmd)
+	flags := k8sExportCmd.Flags()
+	flags.StringP("output", "o", "k8s", "directory to write the manifests to")
+	flags.String("namespace", "srcd", "namespace of the objects")
+	flags.String("storage-class", "", "storage class of the persistent volume claims, the default one of the cluster if empty")
+	flags.String("storage-size", "10Gi", "size requested by every persistent volume claim")
+}
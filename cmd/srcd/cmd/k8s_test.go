@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/src-d/engine/components"
+)
+
+func TestK8sManifest(t *testing.T) {
+	m := components.K8sManifest{
+		Name: "pilosa",
+		Objects: []*components.K8sObject{
+			{
+				APIVersion: "v1",
+				Kind:       "Service",
+				Metadata:   components.K8sMetadata{Name: "srcd-cli-pilosa", Namespace: "srcd"},
+				Spec: &components.K8sServiceSpec{
+					ClusterIP: "None",
+					Selector:  map[string]string{components.K8sInstanceLabel: "srcd-cli-pilosa"},
+					Ports:     []components.K8sServicePort{{Name: "tcp-10101", Port: 10101, TargetPort: 10101, Protocol: "TCP"}},
+				},
+			},
+			{APIVersion: "apps/v1", Kind: "StatefulSet", Metadata: components.K8sMetadata{Name: "srcd-cli-pilosa"}},
+		},
+	}
+
+	content, err := k8sManifest(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := k8sHeader + `---
+apiVersion: v1
+kind: Service
+metadata:
+  name: srcd-cli-pilosa
+  namespace: srcd
+spec:
+  clusterIP: None
+  selector:
+    app.kubernetes.io/instance: srcd-cli-pilosa
+  ports:
+  - name: tcp-10101
+    port: 10101
+    targetPort: 10101
+    protocol: TCP
+---
+apiVersion: apps/v1
+kind: StatefulSet
+metadata:
+  name: srcd-cli-pilosa
+`
+	if string(content) != expected {
+		t.Errorf("expected: %s, got: %s", expected, content)
+	}
+}
+
+func TestK8sOptions(t *testing.T) {
+	testCases := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{"defaults", nil, ""},
+		{"namespace", []string{"--namespace", "engine-1"}, ""},
+		{"invalid namespace", []string{"--namespace", "Engine"},
+			`invalid value of --namespace "Engine": it must be lowercase letters, digits and dashes`},
+		{"size", []string{"--storage-size", "500Mi"}, ""},
+		{"invalid size", []string{"--storage-size", "10GB"},
+			`invalid value of --storage-size "10GB": it must be a size like 10Gi`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			defer k8sExportCmd.Flags().Set("namespace", "srcd")
+			defer k8sExportCmd.Flags().Set("storage-size", "10Gi")
+			if err := k8sExportCmd.Flags().Parse(tc.args); err != nil {
+				t.Fatal(err)
+			}
+
+			var result string
+			if _, err := k8sOptions(k8sExportCmd); err != nil {
+				result = strings.TrimSpace(err.Error())
+			}
+			if result != tc.expected {
+				t.Errorf("expected: %s, got: %s", tc.expected, result)
+			}
+		})
+	}
+}
@@ -1,21 +1,223 @@
 package cmd
 
 import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	units "github.com/docker/go-units"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"github.com/src-d/engine/cmd/srcd/daemon"
 	"github.com/src-d/engine/components"
 )
 
 var killCmd = &cobra.Command{
-	Use:   "kill",
-	Short: "Stops and removes all containers, volumes and docker images used by engine.",
-	Run: func(cmd *cobra.Command, args []string) {
-		if err := components.Purge(); err != nil {
-			logrus.Fatal(err)
+	Use:     "kill",
+	Aliases: []string{"prune"},
+	Short:   "Stops and removes all containers, volumes and docker images used by engine.",
+	Long: `Stops and removes all containers, volumes and docker images used by engine.
+
+Everything is downloaded again on the next init, and the installed drivers and
+indexes are lost. To just start the containers fresh, keeping images and data,
+use srcd init --force instead.
+
+What will be removed is printed first, with the space to reclaim, and must be
+confirmed. Use --yes to skip the confirmation, which is required when stdin is
+not a terminal, or --dry-run to only print it.
+
+Only some types of resources can be removed with --containers, --volumes and
+--images, which can be combined, and only the ones of a component with
+--component. The containers using the volumes or images removed are always
+removed too, as docker can't remove them otherwise.
+
+Cache volumes, like the one with the drivers installed in bblfshd, are kept so
+they don't need to be downloaded again, unless --all or --volumes=all is
+given. The volume with the indexes of pilosa, which can take hours to build
+again, is only removed with --reset-indexes, along with the metadata gitbase
+keeps of them.
+
+Only the resources of the environment given with --name, or of the default
+one, are removed, unless --all-environments is given. The images used by the
+containers of other environments are kept.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		opts, err := purgeOptions(cmd)
+		if err != nil {
+			return err
+		}
+
+		out, err := outputFormat(cmd)
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		plan, err := components.Plan(ctx, opts)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("could not list the resources to remove: %v", err)
+		}
+
+		if err := printPurgePlan(os.Stdout, plan, out); err != nil {
+			return err
 		}
+
+		if dryRun, _ := cmd.Flags().GetBool("dry-run"); dryRun || plan.Empty() {
+			return nil
+		}
+
+		if yes, _ := cmd.Flags().GetBool("yes"); !yes {
+			if !isTerminal(os.Stdin) {
+				return usageErrorf("refusing to remove anything without confirmation, use --yes")
+			}
+
+			if !askYesNo(bufio.NewReader(os.Stdin), os.Stderr, "Remove the above?") {
+				logrus.Info("nothing removed")
+				return nil
+			}
+		}
+
+		if err := components.Purge(plan); err != nil {
+			return err
+		}
+		return removeIndexMetadata(plan)
 	},
 }
 
+// removeIndexMetadata removes the metadata gitbase keeps of the indexes of the
+// pilosa volumes removed, so it doesn't look for them in pilosa.
+func removeIndexMetadata(plan *components.PurgePlan) error {
+	for _, v := range plan.Volumes {
+		if v.Class != components.IndexVolume || v.Path == "" {
+			continue
+		}
+
+		dir := daemon.IndexMetadataDirectory(v.Path)
+		if err := os.RemoveAll(dir); err != nil {
+			return fmt.Errorf("could not remove the metadata of the indexes in %s: %v", dir, err)
+		}
+	}
+	return nil
+}
+
+// purgeOptions returns the resources to remove selected with the flags.
+func purgeOptions(cmd *cobra.Command) (components.PurgeOptions, error) {
+	var opts components.PurgeOptions
+	opts.Containers, _ = cmd.Flags().GetBool("containers")
+	opts.Images, _ = cmd.Flags().GetBool("images")
+	opts.Caches, _ = cmd.Flags().GetBool("all")
+	opts.ResetIndexes, _ = cmd.Flags().GetBool("reset-indexes")
+	opts.AllEnvironments, _ = cmd.Flags().GetBool("all-environments")
+
+	switch volumes, _ := cmd.Flags().GetString("volumes"); volumes {
+	case "", "false":
+	case "true":
+		opts.Volumes = true
+	case "all":
+		opts.Volumes = true
+		opts.Caches = true
+	default:
+		return opts, fmt.Errorf("invalid value of --volumes %q, use --volumes or --volumes=all", volumes)
+	}
+
+	if name, _ := cmd.Flags().GetString("component"); name != "" {
+		c, ok := components.ByName(name)
+		if !ok {
+			return opts, usageErrorf("unknown component %s", name)
+		}
+		opts.Component = &c
+	}
+
+	return opts, nil
+}
+
+func printPurgePlan(w io.Writer, plan *components.PurgePlan, out *output) error {
+	v := struct {
+		*components.PurgePlan
+		Size int64 `json:"size"`
+	}{plan, plan.Size()}
+	return out.print(w, "purge_plan", v, func(w io.Writer) error { return printPurgeTable(w, plan) })
+}
+
+func printPurgeTable(w io.Writer, plan *components.PurgePlan) error {
+	if plan.Empty() {
+		fmt.Fprintln(w, "nothing to remove")
+		return printKept(w, plan)
+	}
+
+	tw := new(tabwriter.Writer)
+	tw.Init(w, 0, 8, 5, '\t', 0)
+	fmt.Fprintln(tw, "TYPE\tNAME\tSIZE")
+	fmt.Fprintln(tw, "----------\t----------\t----------")
+	for _, c := range plan.Containers {
+		fmt.Fprintf(tw, "container\t%s\t-\n", c)
+	}
+	for _, v := range plan.Volumes {
+		fmt.Fprintf(tw, "volume\t%s\t%s\n", v.Name, humanSize(v.Size))
+	}
+	for _, img := range plan.Images {
+		fmt.Fprintf(tw, "image\t%s\t%s\n", img.Name, humanSize(img.Size))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "total space to reclaim: %s\n", humanSize(plan.Size()))
+	return printKept(w, plan)
+}
+
+// printKept prints the cache and index volumes and the images used by other
+// environments that are not removed.
+func printKept(w io.Writer, plan *components.PurgePlan) error {
+	for _, v := range plan.Kept {
+		content := humanSize(v.Size)
+		if v.Description != "" {
+			content += " of " + v.Description
+		}
+
+		flag := "--all"
+		if v.Class == components.IndexVolume {
+			flag = "--reset-indexes"
+		}
+
+		if _, err := fmt.Fprintf(w, "kept volume %s (%s); use %s to remove\n", v.Name, content, flag); err != nil {
+			return err
+		}
+	}
+
+	for _, img := range plan.Shared {
+		_, err := fmt.Fprintf(w, "kept image %s (%s) used by environment %s; use --all-environments to remove\n",
+			img.Name, humanSize(img.Size), img.Description)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func humanSize(size int64) string {
+	if size < 0 {
+		return "unknown"
+	}
+	return units.HumanSize(float64(size))
+}
+
 func init() {
 	rootCmd.AddCommand(killCmd)
+
+	killCmd.Flags().Bool("dry-run", false, "only print what would be removed")
+	killCmd.Flags().BoolP("yes", "y", false, "remove without asking for confirmation")
+	addOutputFlags(killCmd, true)
+	killCmd.Flags().Bool("containers", false, "remove the containers")
+	killCmd.Flags().String("volumes", "", "remove the volumes, except the caches like the bblfsh drivers unless it's all")
+	killCmd.Flags().Lookup("volumes").NoOptDefVal = "true"
+	killCmd.Flags().Bool("all", false, "also remove the cache volumes, like the one with the bblfsh drivers")
+	killCmd.Flags().Bool("reset-indexes", false, "also remove the volume with the indexes of pilosa, which are built again with srcd sql index create")
+	killCmd.Flags().Bool("images", false, "remove the images")
+	killCmd.Flags().String("component", "", "only remove the resources of the given component, like gitbase")
+	killCmd.Flags().Bool("all-environments", false, "remove the resources of every environment, not only the ones of the current one")
 }
@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/src-d/engine/components"
+)
+
+func TestPrintPurgePlan(t *testing.T) {
+	plan := &components.PurgePlan{
+		Containers: []string{"srcd-cli-gitbase"},
+		Volumes:    []components.PurgeResource{{Name: "srcd-cli-bblfsh-storage", Size: 2000000000}},
+		Images:     []components.PurgeResource{{Name: "srcd/gitbase:latest", Size: -1}},
+		Kept:       []components.PurgeResource{},
+		Shared:     []components.PurgeResource{},
+	}
+
+	var buf bytes.Buffer
+	if err := printPurgePlan(&buf, plan, &output{format: outputJSON}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `{"containers":["srcd-cli-gitbase"],"volumes":[{"name":"srcd-cli-bblfsh-storage","size":2000000000,"description":null,"path":null}],"images":[{"name":"srcd/gitbase:latest","size":null,"description":null,"path":null}],"kept":[],"shared":[],"size":2000000000}
+`
+	if buf.String() != expected {
+		t.Errorf("expected: %s, got: %s", expected, buf.String())
+	}
+
+	buf.Reset()
+	if err := printPurgePlan(&buf, plan, &output{format: outputTable}); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasSuffix(buf.String(), "total space to reclaim: 2GB\n") {
+		t.Errorf("expected the total space to reclaim, got: %s", buf.String())
+	}
+}
+
+func TestPrintPurgePlanTemplate(t *testing.T) {
+	plan := &components.PurgePlan{
+		Containers: []string{"srcd-cli-gitbase", "srcd-cli-pilosa"},
+	}
+
+	cmd := &cobra.Command{}
+	addOutputFlags(cmd, true)
+	cmd.Flags().Set("format", "template={{len .Containers}} containers, {{.Size}} bytes")
+	out, err := outputFormat(cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := printPurgePlan(&buf, plan, out); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "2 containers, 0 bytes\n"
+	if buf.String() != expected {
+		t.Errorf("expected: %s, got: %s", expected, buf.String())
+	}
+}
+
+func TestPrintKeptVolumes(t *testing.T) {
+	plan := &components.PurgePlan{
+		Kept: []components.PurgeResource{
+			{Name: "srcd-cli-bblfsh-storage", Size: 2300000000, Description: "language drivers"},
+			{Name: "srcd-cli-cache", Size: -1},
+			{Name: "srcd-cli-pilosa-data", Size: 1200000000, Description: "indexes", Class: components.IndexVolume},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := printPurgePlan(&buf, plan, &output{format: outputTable}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `nothing to remove
+kept volume srcd-cli-bblfsh-storage (2.3GB of language drivers); use --all to remove
+kept volume srcd-cli-cache (unknown); use --all to remove
+kept volume srcd-cli-pilosa-data (1.2GB of indexes); use --reset-indexes to remove
+`
+	if buf.String() != expected {
+		t.Errorf("expected: %s, got: %s", expected, buf.String())
+	}
+}
+
+func TestPrintSharedImages(t *testing.T) {
+	plan := &components.PurgePlan{
+		Shared: []components.PurgeResource{
+			{Name: "srcd/gitbase:v0.24.0", Size: 150000000, Description: "clientA, clientB"},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := printPurgePlan(&buf, plan, &output{format: outputTable}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `nothing to remove
+kept image srcd/gitbase:v0.24.0 (150MB) used by environment clientA, clientB; use --all-environments to remove
+`
+	if buf.String() != expected {
+		t.Errorf("expected: %s, got: %s", expected, buf.String())
+	}
+}
@@ -0,0 +1,281 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	enry "gopkg.in/src-d/enry.v1"
+)
+
+var langCmd = &cobra.Command{
+	Use:   "lang path...",
+	Short: "Detect the language of files without parsing them",
+	Long: `Detect the language of files without parsing them
+
+Languages are detected locally with enry, the same language detection used to
+parse files, so neither the daemon nor bblfsh are needed. Directories are
+walked recursively, skipping hidden files, and the files found can be selected
+with the same --include and --exclude flags as srcd parse uast.
+
+For every file the detected language is printed along with the strategy that
+detected it (modeline, filename, shebang, extension, content or classifier)
+and whether it's vendored, generated, documentation or configuration.
+
+With --summary the number of files and bytes of each language are printed
+instead, ignoring the files whose language can't be detected.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) == 0 {
+			args = []string{"."}
+		}
+
+		filter, err := fileFilterFromFlags(cmd)
+		if err != nil {
+			return err
+		}
+
+		inputs, err := collectParseInputs(args, filter)
+		if err != nil {
+			return fmt.Errorf("could not find files: %v", err)
+		}
+
+		var files []*fileLanguage
+		for _, input := range inputs {
+			f, err := detectFileLanguage(input.path)
+			if err != nil {
+				logrus.Errorf("could not detect the language of %s: %v", input.path, err)
+				continue
+			}
+			files = append(files, f)
+		}
+
+		asJSON, _ := cmd.Flags().GetBool("json")
+		records := newRecordWriter(os.Stdout)
+		if summary, _ := cmd.Flags().GetBool("summary"); summary {
+			langs := summarizeLanguages(files)
+			err = records.write("language_summary", langs, func(w io.Writer) error {
+				return printLanguageSummary(w, langs, asJSON)
+			})
+		} else {
+			err = records.write("file_language", files, func(w io.Writer) error {
+				return printFileLanguages(w, files, asJSON)
+			})
+		}
+
+		return err
+	},
+}
+
+// fileLanguage is the language detected for a file.
+type fileLanguage struct {
+	Path     string `json:"path"`
+	Language string `json:"language"`
+	Strategy string `json:"strategy"`
+	// Class is vendored, generated, documentation or configuration, or
+	// empty for regular files.
+	Class string `json:"class,omitempty"`
+	Bytes int64  `json:"bytes"`
+}
+
+// languageStrategies are the strategies used by enry.GetLanguage, in the same
+// order, with the names used in the output.
+var languageStrategies = []struct {
+	name     string
+	strategy enry.Strategy
+}{
+	{"modeline", enry.GetLanguagesByModeline},
+	{"filename", enry.GetLanguagesByFilename},
+	{"shebang", enry.GetLanguagesByShebang},
+	{"extension", enry.GetLanguagesByExtension},
+	{"content", enry.GetLanguagesByContent},
+	{"classifier", enry.GetLanguagesByClassifier},
+}
+
+// detectLanguage works like enry.GetLanguage but also returns the name of the
+// strategy that detected the language.
+func detectLanguage(filename string, content []byte) (lang, strategy string) {
+	if enry.IsBinary(content) {
+		return "", ""
+	}
+
+	var languages []string
+	candidates := []string{}
+	for _, s := range languageStrategies {
+		languages = s.strategy(filename, content, candidates)
+		if len(languages) == 1 {
+			return languages[0], s.name
+		}
+
+		if len(languages) > 0 {
+			candidates = append(candidates, languages...)
+			strategy = s.name
+		}
+	}
+
+	if len(languages) == 0 {
+		return "", ""
+	}
+	return languages[0], strategy
+}
+
+func detectFileLanguage(path string) (*fileLanguage, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	lang, strategy := detectLanguage(filepath.Base(path), content)
+	return &fileLanguage{
+		Path:     path,
+		Language: lang,
+		Strategy: strategy,
+		Class:    fileClass(path, content),
+		Bytes:    int64(len(content)),
+	}, nil
+}
+
+// generatedMarkers are found in the header of generated files.
+var generatedMarkers = [][]byte{
+	[]byte("Code generated"),
+	[]byte("DO NOT EDIT"),
+	[]byte("@generated"),
+}
+
+// fileClass classifies the files that are not regular source code.
+func fileClass(path string, content []byte) string {
+	switch {
+	case enry.IsVendor(path):
+		return "vendored"
+	case isGenerated(path, content):
+		return "generated"
+	case enry.IsDocumentation(path):
+		return "documentation"
+	case enry.IsConfiguration(path):
+		return "configuration"
+	default:
+		return ""
+	}
+}
+
+func isGenerated(path string, content []byte) bool {
+	name := strings.ToLower(filepath.Base(path))
+	if strings.HasSuffix(name, ".min.js") || strings.HasSuffix(name, ".min.css") {
+		return true
+	}
+
+	header := content
+	if len(header) > 1024 {
+		header = header[:1024]
+	}
+
+	for _, m := range generatedMarkers {
+		if bytes.Contains(header, m) {
+			return true
+		}
+	}
+	return false
+}
+
+func printFileLanguages(w io.Writer, files []*fileLanguage, asJSON bool) error {
+	if asJSON {
+		if files == nil {
+			files = []*fileLanguage{}
+		}
+		return json.NewEncoder(w).Encode(files)
+	}
+
+	tw := new(tabwriter.Writer)
+	tw.Init(w, 0, 8, 5, '\t', 0)
+	fmt.Fprintln(tw, "PATH\tLANGUAGE\tSTRATEGY\tCLASS")
+	fmt.Fprintln(tw, "----------\t----------\t----------\t----------")
+	for _, f := range files {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n",
+			f.Path, orDash(f.Language), orDash(f.Strategy), orDash(f.Class))
+	}
+	return tw.Flush()
+}
+
+// languageSummary aggregates the files of a language.
+type languageSummary struct {
+	Language string  `json:"language"`
+	Files    int     `json:"files"`
+	Bytes    int64   `json:"bytes"`
+	Percent  float64 `json:"percent"`
+}
+
+// summarizeLanguages aggregates the files by language, sorted by bytes, like
+// linguist does. Files without a language are ignored.
+func summarizeLanguages(files []*fileLanguage) []*languageSummary {
+	byLang := make(map[string]*languageSummary)
+	var total int64
+	for _, f := range files {
+		if f.Language == "" {
+			continue
+		}
+
+		s, ok := byLang[f.Language]
+		if !ok {
+			s = &languageSummary{Language: f.Language}
+			byLang[f.Language] = s
+		}
+
+		s.Files++
+		s.Bytes += f.Bytes
+		total += f.Bytes
+	}
+
+	result := []*languageSummary{}
+	for _, s := range byLang {
+		if total > 0 {
+			s.Percent = float64(s.Bytes) * 100 / float64(total)
+		}
+		result = append(result, s)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Bytes != result[j].Bytes {
+			return result[i].Bytes > result[j].Bytes
+		}
+		return result[i].Language < result[j].Language
+	})
+	return result
+}
+
+func printLanguageSummary(w io.Writer, langs []*languageSummary, asJSON bool) error {
+	if asJSON {
+		return json.NewEncoder(w).Encode(langs)
+	}
+
+	tw := new(tabwriter.Writer)
+	tw.Init(w, 0, 8, 5, '\t', 0)
+	fmt.Fprintln(tw, "LANGUAGE\tFILES\tBYTES\tPERCENT")
+	fmt.Fprintln(tw, "----------\t----------\t----------\t----------")
+	for _, l := range langs {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%.2f%%\n", l.Language, l.Files, l.Bytes, l.Percent)
+	}
+	return tw.Flush()
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func init() {
+	rootCmd.AddCommand(langCmd)
+
+	langCmd.Flags().Bool("json", false, "print the results as JSON")
+	langCmd.Flags().Bool("summary", false, "print the number of files and bytes of each language")
+	addFileFilterFlags(langCmd)
+}
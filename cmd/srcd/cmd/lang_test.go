@@ -0,0 +1,47 @@
+package cmd
+
+import "testing"
+
+func TestDetectLanguage(t *testing.T) {
+	testCases := []struct {
+		filename string
+		content  string
+		lang     string
+		strategy string
+	}{
+		{"main.go", "package main\n", "Go", "extension"},
+		{"Makefile", "all:\n", "Makefile", "filename"},
+		{"run", "#!/usr/bin/env python\nprint(1)\n", "Python", "shebang"},
+		{"data.bin", "\x00\x01\x02", "", ""},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.filename, func(t *testing.T) {
+			lang, strategy := detectLanguage(tt.filename, []byte(tt.content))
+			if lang != tt.lang || strategy != tt.strategy {
+				t.Errorf("expected: %s by %s, got: %s by %s", tt.lang, tt.strategy, lang, strategy)
+			}
+		})
+	}
+}
+
+func TestSummarizeLanguages(t *testing.T) {
+	result := summarizeLanguages([]*fileLanguage{
+		{Path: "a.go", Language: "Go", Bytes: 30},
+		{Path: "b.go", Language: "Go", Bytes: 45},
+		{Path: "c.py", Language: "Python", Bytes: 25},
+		{Path: "d.bin", Bytes: 100},
+	})
+
+	if len(result) != 2 {
+		t.Fatalf("expected 2 languages, got %d", len(result))
+	}
+
+	if result[0].Language != "Go" || result[0].Files != 2 || result[0].Bytes != 75 || result[0].Percent != 75 {
+		t.Errorf("unexpected summary for Go: %+v", result[0])
+	}
+
+	if result[1].Language != "Python" || result[1].Percent != 25 {
+		t.Errorf("unexpected summary for Python: %+v", result[1])
+	}
+}
@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+
+	"github.com/sirupsen/logrus"
+	"github.com/src-d/engine/cmd/srcd/daemon"
+	"github.com/src-d/engine/docker"
+)
+
+// Verbosity levels of -v.
+const (
+	// verbosityDebug logs what the CLI, the components and the daemon do.
+	verbosityDebug = 1
+	// verbosityDocker also logs every call to the docker API.
+	verbosityDocker = 2
+)
+
+// setupLogging sets the level of the logs printed for the given verbosity,
+// only warnings and errors if quiet, and writes all of them to the log file,
+// if given, whatever the verbosity. The daemon is created with the same level.
+func setupLogging(verbosity int, quiet bool, logFile string) error {
+	terminal := logrus.InfoLevel
+	if quiet {
+		terminal = logrus.WarnLevel
+	}
+	if verbosity >= verbosityDebug {
+		terminal = logrus.DebugLevel
+		daemon.LogLevel = logrus.DebugLevel.String()
+	}
+	docker.Verbose = verbosity >= verbosityDocker
+
+	logrus.SetFormatter(&levelFormatter{
+		Formatter: &redactingFormatter{&logrus.TextFormatter{DisableColors: machineOutput()}},
+		level:     terminal,
+	})
+
+	if logFile == "" {
+		logrus.SetLevel(terminal)
+		return nil
+	}
+
+	f, err := os.OpenFile(logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("could not open the log file: %v", err)
+	}
+
+	// The file is closed when the process exits.
+	logrus.SetLevel(logrus.DebugLevel)
+	docker.Verbose = true
+	logrus.AddHook(&fileHook{
+		w:         f,
+		formatter: &redactingFormatter{&logrus.TextFormatter{DisableColors: true, FullTimestamp: true}},
+	})
+	return nil
+}
+
+// levelFormatter formats only the entries of the given level or more severe.
+// The level of logrus is the one of the log file, so the others are left out
+// of the terminal here.
+type levelFormatter struct {
+	logrus.Formatter
+	level logrus.Level
+}
+
+func (f *levelFormatter) Format(e *logrus.Entry) ([]byte, error) {
+	if e.Level > f.level {
+		return nil, nil
+	}
+	return f.Formatter.Format(e)
+}
+
+// fileHook writes all the entries to a log file.
+type fileHook struct {
+	w         io.Writer
+	formatter logrus.Formatter
+}
+
+func (h *fileHook) Levels() []logrus.Level { return logrus.AllLevels }
+
+func (h *fileHook) Fire(e *logrus.Entry) error {
+	b, err := h.formatter.Format(e)
+	if err != nil {
+		return err
+	}
+
+	_, err = h.w.Write(b)
+	return err
+}
+
+// sensitiveValues match the credentials that could end up in the logs, like
+// the tokens of the registry or passwords in URLs, keeping what's before them
+// in the first group.
+var sensitiveValues = []*regexp.Regexp{
+	regexp.MustCompile(`((?i)bearer\s+)[^\s"',]+`),
+	regexp.MustCompile(`((?i)"?(?:token|access_token|password|secret|registryauth|x-registry-auth)"?\s*[:=]\s*"?)[^\s"',&]+`),
+	regexp.MustCompile(`([a-z][a-z0-9+.-]*://[^:/@\s]+:)[^@\s]+(@)`),
+}
+
+// redact replaces the credentials in the message.
+func redact(msg string) string {
+	for _, re := range sensitiveValues {
+		if re.NumSubexp() == 2 {
+			msg = re.ReplaceAllString(msg, "${1}[redacted]${2}")
+		} else {
+			msg = re.ReplaceAllString(msg, "${1}[redacted]")
+		}
+	}
+	return msg
+}
+
+// redactingFormatter redacts the credentials in the message and the fields of
+// the entries.
+type redactingFormatter struct {
+	logrus.Formatter
+}
+
+func (f *redactingFormatter) Format(e *logrus.Entry) ([]byte, error) {
+	redacted := *e
+	redacted.Message = redact(e.Message)
+	if len(e.Data) > 0 {
+		redacted.Data = make(logrus.Fields, len(e.Data))
+		for k, v := range e.Data {
+			if s, ok := v.(string); ok {
+				v = redact(s)
+			}
+			redacted.Data[k] = v
+		}
+	}
+	return f.Formatter.Format(&redacted)
+}
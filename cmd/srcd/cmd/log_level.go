@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/src-d/engine/api"
+	"github.com/src-d/engine/cmd/srcd/daemon"
+)
+
+// logLevels are the levels of the logs of the daemon.
+var logLevels = []string{"debug", "info", "warning", "error"}
+
+var logLevelCmd = &cobra.Command{
+	Use:   "log-level [level]",
+	Short: "Show or change the level of the logs of the daemon",
+	Long: `Show or change the level of the logs of the daemon
+
+Changes the level of the logs of the running daemon to debug, info, warning or
+error, until it's recreated, without restarting it. Without a level, it prints
+the current one. The level the daemon is created with is set with
+daemon.log-level in the config file or -v.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var level string
+		if len(args) > 0 {
+			level = args[0]
+			if err := checkLogLevel(level); err != nil {
+				return usageErrorf("invalid level %q, it must be one of %v", level, logLevels)
+			}
+		}
+
+		running, err := daemon.IsRunning()
+		if err != nil {
+			return err
+		}
+
+		if !running {
+			return notRunningErrorf("the daemon is not running; run srcd init first")
+		}
+
+		c, err := daemon.RunningClient()
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		res, err := c.SetLogLevel(ctx, &api.SetLogLevelRequest{Level: level})
+		if err != nil {
+			return err
+		}
+
+		return newRecordWriter(os.Stdout).write("log-level", res, func(w io.Writer) error {
+			return printLogLevel(w, res, level != "")
+		})
+	},
+}
+
+func printLogLevel(w io.Writer, res *api.SetLogLevelResponse, changed bool) error {
+	var err error
+	switch {
+	case !changed:
+		_, err = fmt.Fprintln(w, res.Level)
+	case res.Level == res.Previous:
+		_, err = fmt.Fprintf(w, "the logs of the daemon are already at level %s\n", res.Level)
+	default:
+		_, err = fmt.Fprintf(w, "the level of the logs of the daemon changed from %s to %s\n", res.Previous, res.Level)
+	}
+	return err
+}
+
+func init() {
+	rootCmd.AddCommand(logLevelCmd)
+}
@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/src-d/engine/api"
+)
+
+func TestPrintLogLevel(t *testing.T) {
+	testCases := []struct {
+		name     string
+		res      *api.SetLogLevelResponse
+		changed  bool
+		expected string
+	}{
+		{"show", &api.SetLogLevelResponse{Level: "info", Previous: "info"}, false, "info\n"},
+		{"same", &api.SetLogLevelResponse{Level: "info", Previous: "info"}, true, "the logs of the daemon are already at level info\n"},
+		{"changed", &api.SetLogLevelResponse{Level: "debug", Previous: "info"}, true, "the level of the logs of the daemon changed from info to debug\n"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := printLogLevel(&buf, tc.res, tc.changed); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got := buf.String(); got != tc.expected {
+				t.Errorf("expected: %s, got: %s", tc.expected, got)
+			}
+		})
+	}
+}
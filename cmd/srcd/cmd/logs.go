@@ -0,0 +1,280 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/src-d/engine/components"
+	"github.com/src-d/engine/docker"
+)
+
+var logsCmd = &cobra.Command{
+	Use:   "logs [component...]",
+	Short: "Print the logs of the components",
+	Long: `Print the logs of the components
+
+The logs of the given components, like gitbase, bblfshd or web-sql, or of all
+the ones running if none is given, are printed. The lines of several
+components are interleaved as they are read, prefixed with the name of the
+component. With --follow, new lines are printed until Ctrl-C is pressed.
+
+The levels of the structured lines, like the ones of gitbase and the daemon,
+are colored in a terminal. With --level, only the lines of that level and the
+less detailed ones are printed, like --level warn for the warnings and errors;
+the lines without a level, like stack traces, go with the line before them.
+Set the level gitbase logs at with srcd init --gitbase-log-level.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmps, err := logsComponents(args)
+		if err != nil {
+			return err
+		}
+
+		if len(cmps) == 0 {
+			logrus.Info("no component is running")
+			return nil
+		}
+
+		opts, err := logsOptions(cmd, time.Now())
+		if err != nil {
+			return err
+		}
+
+		level, err := logsLevel(cmd)
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		ch := make(chan os.Signal, 1)
+		signal.Notify(ch, os.Interrupt)
+		defer signal.Stop(ch)
+		go func() {
+			select {
+			case <-ch:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+
+		// With --output-mode json every line is a record, with the name of its
+		// component.
+		var records recordWriter
+		if machineOutput() {
+			records = newRecordWriter(os.Stdout)
+		}
+
+		colors := decorated(os.Stdout)
+		if len(cmps) == 1 && records == nil {
+			w := newLevelWriter(os.Stdout, level, colors)
+			err := streamLogs(ctx, cmps[0], opts, w)
+			w.Flush()
+			return err
+		}
+
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		width := prefixWidth(cmps)
+		errs := make([]error, len(cmps))
+		for i, c := range cmps {
+			w := &prefixWriter{
+				w:         os.Stdout,
+				mu:        &mu,
+				prefix:    logsPrefix(c.ShortName(), width, i, colors),
+				records:   records,
+				component: c.ShortName(),
+			}
+
+			lw := newLevelWriter(w, level, colors && records == nil)
+
+			wg.Add(1)
+			go func(i int, c components.Component) {
+				defer wg.Done()
+				errs[i] = streamLogs(ctx, c, opts, lw)
+				lw.Flush()
+				w.Flush()
+			}(i, c)
+		}
+		wg.Wait()
+
+		for _, err := range errs {
+			if err != nil {
+				logrus.Error(err)
+			}
+		}
+		return nil
+	},
+}
+
+// logsComponents returns the components with the given names, or the ones
+// running if none is given.
+func logsComponents(names []string) ([]components.Component, error) {
+	if len(names) > 0 {
+		var cmps []components.Component
+		for _, name := range names {
+			c, ok := components.ByName(name)
+			if !ok {
+				return nil, usageErrorf("unknown component %s, it must be one of: %s",
+					name, strings.Join(components.Names(), ", "))
+			}
+			cmps = append(cmps, c)
+		}
+		return cmps, nil
+	}
+
+	var cmps []components.Component
+	for _, c := range append([]components.Component{components.Daemon}, components.All...) {
+		running, err := docker.IsRunning(c.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		if running {
+			cmps = append(cmps, c)
+		}
+	}
+	return cmps, nil
+}
+
+// logsOptions returns the logs selected with the flags. --since can be a
+// duration, relative to now, or a date in RFC 3339 format.
+func logsOptions(cmd *cobra.Command, now time.Time) (docker.LogsOptions, error) {
+	var opts docker.LogsOptions
+	opts.Follow, _ = cmd.Flags().GetBool("follow")
+	opts.Timestamps, _ = cmd.Flags().GetBool("timestamps")
+
+	opts.Tail, _ = cmd.Flags().GetString("tail")
+	if n, err := strconv.Atoi(opts.Tail); opts.Tail != "all" && (err != nil || n < 0) {
+		return opts, fmt.Errorf("invalid value of --tail %q, it must be a number of lines or all", opts.Tail)
+	}
+
+	since, _ := cmd.Flags().GetString("since")
+	if since == "" {
+		return opts, nil
+	}
+
+	if d, err := time.ParseDuration(since); err == nil {
+		opts.Since = strconv.FormatInt(now.Add(-d).Unix(), 10)
+	} else if t, err := time.Parse(time.RFC3339, since); err == nil {
+		opts.Since = strconv.FormatInt(t.Unix(), 10)
+	} else {
+		return opts, fmt.Errorf("invalid value of --since %q, it must be a duration like 10m or a date like 2019-01-10T12:00:00Z", since)
+	}
+	return opts, nil
+}
+
+func streamLogs(ctx context.Context, c components.Component, opts docker.LogsOptions, w io.Writer) error {
+	err := docker.StreamLogs(ctx, c.Name, opts, w)
+	if err == docker.ErrNotFound {
+		return notRunningErrorf("%s is not running", c.ShortName())
+	}
+	return err
+}
+
+// logsColors are the ANSI colors of the prefixes of the components, in turns.
+var logsColors = []int{36, 33, 32, 35, 34}
+
+// prefixWidth returns the length of the longest name of the components.
+func prefixWidth(cmps []components.Component) int {
+	var width int
+	for _, c := range cmps {
+		if len(c.ShortName()) > width {
+			width = len(c.ShortName())
+		}
+	}
+	return width
+}
+
+// logsPrefix returns the prefix of the lines of the i-th component, padded to
+// width and colored if colors is true.
+func logsPrefix(name string, width, i int, colors bool) string {
+	prefix := fmt.Sprintf("%-*s | ", width, name)
+	if !colors {
+		return prefix
+	}
+	return fmt.Sprintf("\033[%dm%s\033[0m", logsColors[i%len(logsColors)], prefix)
+}
+
+// prefixWriter writes whole lines with a prefix, holding a mutex shared by
+// the writers of all the components so their lines are not mixed.
+type prefixWriter struct {
+	w      io.Writer
+	mu     *sync.Mutex
+	prefix string
+	buf    []byte
+
+	// records, if not nil, is where the lines are written instead, as log
+	// records of the component.
+	records   recordWriter
+	component string
+}
+
+// logRecord is a line of the logs of a component with --output-mode json.
+type logRecord struct {
+	Component string `json:"component"`
+	Line      string `json:"line"`
+}
+
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+
+		if err := w.writeLine(w.buf[:i+1]); err != nil {
+			return 0, err
+		}
+		w.buf = w.buf[i+1:]
+	}
+}
+
+// Flush writes the last line, if it didn't end with a new line.
+func (w *prefixWriter) Flush() error {
+	if len(w.buf) == 0 {
+		return nil
+	}
+
+	err := w.writeLine(append(w.buf, '\n'))
+	w.buf = nil
+	return err
+}
+
+func (w *prefixWriter) writeLine(line []byte) error {
+	if w.records != nil {
+		text := strings.TrimSuffix(string(line), "\n")
+		return w.records.write("log", logRecord{w.component, text}, nil)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	_, err := fmt.Fprintf(w.w, "%s%s", w.prefix, line)
+	return err
+}
+
+func init() {
+	rootCmd.AddCommand(logsCmd)
+	addLogsFlags(logsCmd)
+}
+
+func addLogsFlags(cmd *cobra.Command) {
+	flags := cmd.Flags()
+	flags.BoolP("follow", "f", false, "keep printing new lines until Ctrl-C is pressed")
+	flags.String("tail", "all", "number of lines to print from the end of the logs")
+	flags.String("since", "", "only print the lines since a duration ago, like 10m, or a date, like 2019-01-10T12:00:00Z")
+	flags.BoolP("timestamps", "t", false, "print the timestamps of the lines")
+	flags.String("level", "", "only print the lines of a level and the less detailed ones: error, warn, info, debug or trace")
+}
@@ -0,0 +1,133 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+
+	"github.com/spf13/cobra"
+)
+
+// logsLevelRanks are the levels of the lines of the logs, from the least
+// detailed, as written by gitbase and the daemon. warning is the same as warn.
+var logsLevelRanks = map[string]int{
+	"panic":   0,
+	"fatal":   1,
+	"error":   2,
+	"warn":    3,
+	"warning": 3,
+	"info":    4,
+	"debug":   5,
+	"trace":   6,
+}
+
+// logsLevelColors are the ANSI colors of the levels of the lines, the ones
+// not there are not colored.
+var logsLevelColors = map[string]int{
+	"panic":   31,
+	"fatal":   31,
+	"error":   31,
+	"warn":    33,
+	"warning": 33,
+	"debug":   90,
+	"trace":   90,
+}
+
+// logsLevelRegexp matches the level of a line of the logs in the text
+// format, level=info, or in JSON, "level":"info".
+var logsLevelRegexp = regexp.MustCompile(`(?:^|\s)level="?([a-z]+)"?|"level":\s*"([a-z]+)"`)
+
+// logsLevel returns the rank of the level given with --level, or -1 to print
+// the lines of every level.
+func logsLevel(cmd *cobra.Command) (int, error) {
+	level, _ := cmd.Flags().GetString("level")
+	if level == "" {
+		return -1, nil
+	}
+
+	if err := checkGitbaseLogLevel(level); err != nil {
+		return 0, usageErrorf("invalid value of --level %q: %v", level, err)
+	}
+	return logsLevelRanks[level], nil
+}
+
+// lineLevel returns the level of the line and where it is in it, or false
+// if it has none.
+func lineLevel(line []byte) (string, []int, bool) {
+	m := logsLevelRegexp.FindSubmatchIndex(line)
+	if m == nil {
+		return "", nil, false
+	}
+
+	for i := 2; i < len(m); i += 2 {
+		if m[i] >= 0 {
+			level := string(line[m[i]:m[i+1]])
+			if _, ok := logsLevelRanks[level]; ok {
+				return level, m[i : i+2], true
+			}
+		}
+	}
+	return "", nil, false
+}
+
+// levelWriter writes the lines up to a level, coloring their levels if
+// colors is true. The lines without a level, like the ones of a stack trace,
+// are written if the last one with a level was.
+type levelWriter struct {
+	w      io.Writer
+	max    int
+	colors bool
+	buf    []byte
+	hidden bool
+}
+
+func newLevelWriter(w io.Writer, max int, colors bool) *levelWriter {
+	return &levelWriter{w: w, max: max, colors: colors}
+}
+
+func (w *levelWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+
+		if err := w.writeLine(w.buf[:i+1]); err != nil {
+			return 0, err
+		}
+		w.buf = w.buf[i+1:]
+	}
+}
+
+// Flush writes the last line, if it didn't end with a new line.
+func (w *levelWriter) Flush() error {
+	if len(w.buf) == 0 {
+		return nil
+	}
+
+	err := w.writeLine(w.buf)
+	w.buf = nil
+	return err
+}
+
+func (w *levelWriter) writeLine(line []byte) error {
+	level, pos, ok := lineLevel(line)
+	if ok {
+		w.hidden = w.max >= 0 && logsLevelRanks[level] > w.max
+	}
+
+	if w.hidden {
+		return nil
+	}
+
+	if ok && w.colors {
+		if color, ok := logsLevelColors[level]; ok {
+			line = []byte(fmt.Sprintf("%s\033[%dm%s\033[0m%s", line[:pos[0]], color, level, line[pos[1]:]))
+		}
+	}
+
+	_, err := w.w.Write(line)
+	return err
+}
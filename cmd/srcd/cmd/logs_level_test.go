@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestLineLevel(t *testing.T) {
+	testCases := []struct {
+		line     string
+		expected string
+	}{
+		{`time="2019-01-10T12:00:00Z" level=warning msg="slow query"`, "warning"},
+		{`2019-01-10T12:00:00.000Z time="2019-01-10T12:00:00Z" level=debug msg=parsed`, "debug"},
+		{`{"level":"error","msg":"could not open repository"}`, "error"},
+		{`{"level": "info","msg":"server started"}`, "info"},
+		{`goroutine 1 [running]:`, ""},
+		{`msg="loglevel=debug"`, ""},
+		{`level=verbose msg=unknown`, ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.line, func(t *testing.T) {
+			level, _, ok := lineLevel([]byte(tc.line))
+			if ok != (tc.expected != "") || level != tc.expected {
+				t.Errorf("expected: %q, got: %q", tc.expected, level)
+			}
+		})
+	}
+}
+
+func TestLevelWriter(t *testing.T) {
+	logs := strings.Join([]string{
+		`level=info msg="server started"`,
+		`level=debug msg="parsed query"`,
+		`level=warning msg="slow query"`,
+		`level=error msg=panic`,
+		`goroutine 1 [running]:`,
+		`level=trace msg=row`,
+		`  at the end`,
+	}, "\n")
+
+	testCases := []struct {
+		name     string
+		max      int
+		expected []string
+	}{
+		{"all", -1, strings.Split(logs, "\n")},
+		{"warn", logsLevelRanks["warn"], []string{
+			`level=warning msg="slow query"`,
+			`level=error msg=panic`,
+			`goroutine 1 [running]:`,
+		}},
+		{"info", logsLevelRanks["info"], []string{
+			`level=info msg="server started"`,
+			`level=warning msg="slow query"`,
+			`level=error msg=panic`,
+			`goroutine 1 [running]:`,
+		}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			w := newLevelWriter(&buf, tc.max, false)
+			w.Write([]byte(logs[:20]))
+			w.Write([]byte(logs[20:]))
+			w.Flush()
+
+			expected := strings.Join(tc.expected, "\n")
+			if tc.max < 0 {
+				expected = logs
+			} else {
+				expected += "\n"
+			}
+			if buf.String() != expected {
+				t.Errorf("expected: %s, got: %s", expected, buf.String())
+			}
+		})
+	}
+}
+
+func TestLevelWriterColors(t *testing.T) {
+	var buf bytes.Buffer
+	w := newLevelWriter(&buf, -1, true)
+	w.Write([]byte("level=error msg=failed\nlevel=info msg=ok\n"))
+
+	expected := "level=\033[31merror\033[0m msg=failed\nlevel=info msg=ok\n"
+	if buf.String() != expected {
+		t.Errorf("expected: %q, got: %q", expected, buf.String())
+	}
+}
@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+func TestLogsOptions(t *testing.T) {
+	now := time.Date(2019, 1, 10, 12, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name  string
+		flags map[string]string
+		since string
+		tail  string
+		err   bool
+	}{
+		{"default", nil, "", "all", false},
+		{"tail", map[string]string{"tail": "20"}, "", "20", false},
+		{"invalid tail", map[string]string{"tail": "some"}, "", "", true},
+		{"negative tail", map[string]string{"tail": "-1"}, "", "", true},
+		{"since duration", map[string]string{"since": "10m"}, "1547121000", "all", false},
+		{"since date", map[string]string{"since": "2019-01-10T11:00:00Z"}, "1547118000", "all", false},
+		{"invalid since", map[string]string{"since": "yesterday"}, "", "", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cmd := &cobra.Command{}
+			addLogsFlags(cmd)
+			for k, v := range tc.flags {
+				if err := cmd.Flags().Set(k, v); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			opts, err := logsOptions(cmd, now)
+			if tc.err {
+				if err == nil {
+					t.Errorf("expected error, got: %+v", opts)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if opts.Since != tc.since || opts.Tail != tc.tail {
+				t.Errorf("expected: since %s and tail %s, got: %+v", tc.since, tc.tail, opts)
+			}
+		})
+	}
+}
+
+func TestPrefixWriter(t *testing.T) {
+	var buf bytes.Buffer
+	var mu sync.Mutex
+	gitbase := &prefixWriter{w: &buf, mu: &mu, prefix: logsPrefix("gitbase", 7, 0, false)}
+	bblfshd := &prefixWriter{w: &buf, mu: &mu, prefix: logsPrefix("bblfshd", 7, 1, false)}
+
+	gitbase.Write([]byte("starting\nlisten"))
+	bblfshd.Write([]byte("ready\n"))
+	gitbase.Write([]byte("ing\n"))
+	gitbase.Write([]byte("no new line"))
+	gitbase.Flush()
+
+	expected := strings.Join([]string{
+		"gitbase | starting",
+		"bblfshd | ready",
+		"gitbase | listening",
+		"gitbase | no new line",
+	}, "\n") + "\n"
+	if buf.String() != expected {
+		t.Errorf("expected: %s, got: %s", expected, buf.String())
+	}
+}
+
+func TestLogsPrefix(t *testing.T) {
+	expected := "\033[33mpilosa  | \033[0m"
+	if got := logsPrefix("pilosa", 7, 1, true); got != expected {
+		t.Errorf("expected: %q, got: %q", expected, got)
+	}
+}
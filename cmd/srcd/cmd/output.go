@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"text/template"
+
+	"github.com/spf13/cobra"
+)
+
+// Output formats of the commands printing tables, given with --format.
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+	// outputTemplate is followed by a Go template, like
+	// template={{.Image}}:{{.Tag}}, executed for every item printed.
+	outputTemplate = "template="
+	// outputRecords is the format with --output-mode json, a JSON record per
+	// item.
+	outputRecords = "records"
+)
+
+// output is the format the results of a command are printed in.
+type output struct {
+	format string
+	tmpl   *template.Template
+}
+
+// addOutputFlags adds --format to the command, and --json as a shorthand of
+// --format json if withJSON is true, kept for the commands that had it.
+func addOutputFlags(cmd *cobra.Command, withJSON bool) {
+	cmd.Flags().String("format", outputTable, "output format: table, json, or template= followed by a Go template executed for every item, like 'template={{.Name}}'")
+	if withJSON {
+		cmd.Flags().Bool("json", false, "print the results as JSON, the same as --format json")
+	}
+}
+
+// outputFormat returns the output format given with the flags added by
+// addOutputFlags.
+func outputFormat(cmd *cobra.Command) (*output, error) {
+	format, _ := cmd.Flags().GetString("format")
+	if machineOutput() {
+		if asJSON, _ := cmd.Flags().GetBool("json"); asJSON || cmd.Flags().Changed("format") {
+			return nil, fmt.Errorf("--format and --json can't be used with --output-mode json")
+		}
+		return &output{format: outputRecords}, nil
+	}
+
+	if asJSON, _ := cmd.Flags().GetBool("json"); asJSON {
+		if cmd.Flags().Changed("format") && format != outputJSON {
+			return nil, fmt.Errorf("--json can't be used with --format %s", format)
+		}
+		format = outputJSON
+	}
+
+	switch {
+	case format == outputTable, format == outputJSON:
+		return &output{format: format}, nil
+	case strings.HasPrefix(format, outputTemplate):
+		tmpl, err := template.New("format").Parse(strings.TrimPrefix(format, outputTemplate))
+		if err != nil {
+			return nil, fmt.Errorf("invalid template of --format: %v", err)
+		}
+		return &output{format: outputTemplate, tmpl: tmpl}, nil
+	default:
+		return nil, fmt.Errorf("unknown output format %s, it must be table, json or template=...", format)
+	}
+}
+
+// print writes v with the output format, calling table for the table format.
+// Templates are executed for every item of v if it's a slice, or for v
+// otherwise, followed by a new line. With --output-mode json, they are
+// records of the given type.
+func (o *output) print(w io.Writer, typ string, v interface{}, table func(io.Writer) error) error {
+	switch o.format {
+	case outputRecords:
+		return (&jsonRecordWriter{w: w}).write(typ, v, nil)
+	case outputJSON:
+		return printJSON(w, v)
+	case outputTemplate:
+		items := []interface{}{v}
+		if rv := reflect.ValueOf(v); rv.Kind() == reflect.Slice {
+			items = make([]interface{}, rv.Len())
+			for i := range items {
+				items[i] = rv.Index(i).Interface()
+			}
+		}
+
+		for _, item := range items {
+			if err := o.tmpl.Execute(w, item); err != nil {
+				return fmt.Errorf("could not execute the template of --format: %v", err)
+			}
+			fmt.Fprintln(w)
+		}
+		return nil
+	default:
+		return table(w)
+	}
+}
+
+func printJSON(w io.Writer, v interface{}) error {
+	return json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestOutputFormat(t *testing.T) {
+	testCases := []struct {
+		name     string
+		flags    map[string]string
+		expected string
+		err      bool
+	}{
+		{"default", nil, outputTable, false},
+		{"json", map[string]string{"format": "json"}, outputJSON, false},
+		{"json flag", map[string]string{"json": "true"}, outputJSON, false},
+		{"both", map[string]string{"json": "true", "format": "json"}, outputJSON, false},
+		{"conflict", map[string]string{"json": "true", "format": "table"}, "", true},
+		{"template", map[string]string{"format": "template={{.Name}}"}, outputTemplate, false},
+		{"invalid template", map[string]string{"format": "template={{.Name"}, "", true},
+		{"unknown", map[string]string{"format": "yaml"}, "", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cmd := &cobra.Command{}
+			addOutputFlags(cmd, true)
+			for k, v := range tc.flags {
+				if err := cmd.Flags().Set(k, v); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			out, err := outputFormat(cmd)
+			if tc.err {
+				if err == nil {
+					t.Errorf("expected error, got: %s", out.format)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if out.format != tc.expected {
+				t.Errorf("expected: %s, got: %s", tc.expected, out.format)
+			}
+		})
+	}
+}
+
+func TestOutputTemplate(t *testing.T) {
+	cmd := &cobra.Command{}
+	addOutputFlags(cmd, false)
+	cmd.Flags().Set("format", "template={{.Name}}: {{.Port}}")
+	out, err := outputFormat(cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	items := []struct {
+		Name string
+		Port int
+	}{{"gitbase", 3306}, {"bblfshd", 9432}}
+
+	var buf bytes.Buffer
+	if err := out.print(&buf, "item", items, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "gitbase: 3306\nbblfshd: 9432\n"
+	if buf.String() != expected {
+		t.Errorf("expected: %s, got: %s", expected, buf.String())
+	}
+}
@@ -19,13 +19,19 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 	api "github.com/src-d/engine/api"
 	"github.com/src-d/engine/cmd/srcd/daemon"
-	"gopkg.in/bblfsh/sdk.v1/uast"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 var parseCmd = &cobra.Command{
@@ -42,80 +48,361 @@ This command parses the given files, automatically identifying the language
 unless the --lang flag is used. The resulting Universal Abstract Syntax Trees
 (UASTs) are filtered with the given --query XPath expression.
 
-The remaining nodes are printed to standard output in JSON format.`,
-	Run: func(cmd *cobra.Command, args []string) {
+Directories are walked recursively, skipping hidden files and files whose
+language can't be detected. The files found can be selected with --include and
+--exclude glob patterns, matched against the path relative to the directory
+and against the file name. Detection can be overridden for extensions or file
+names with --map-lang, or in the parse.map-lang section of the config file:
+
+  parse:
+    map-lang:
+      .inc: php
+      .bzl: python
+
+Files matching an override are never skipped.
+
+Files are parsed concurrently by --jobs workers, but the results are always
+printed in the order the files were found. While parsing more than one file,
+the progress is reported to standard error, refreshing it in place on
+terminals and with a line every few seconds otherwise. Use --quiet to hide it,
+along with the log of every file.
+
+When there is no driver installed for the language of a file, the user is
+asked whether to install it, once per language. Without a terminal to answer,
+as in CI, nothing is installed and those files are skipped. Use
+--install-missing to install the official drivers without asking, or
+--no-install to never install them. Every installed driver is logged with the
+exact image and version pulled.
+
+A file that fails to parse doesn't stop the rest of the batch; all failures are
+listed in the summary printed at the end. Files taking longer than
+--file-timeout fail too, but are listed apart from the parse errors, and a
+warning names the driver if several files of the same language time out. The
+command exits with a non-zero code if any file failed or timed out, unless
+--fail-on-error=false is given.
+
+The UASTs are returned in the mode given by --mode: semantic (the default),
+annotated or native. Not every driver supports every mode; files that can't be
+parsed in the requested mode fail with an error naming the driver and mode.
+
+The results are printed to standard output in the format given by --encoding:
+json (the default), yaml, or proto. The json and yaml encodings write one
+document per file with its path, language, UAST mode and nodes. The proto
+encoding writes the serialized nodes exactly as returned by bblfsh; when more
+than one node can be written (several files or a --query) every node is
+prefixed by its length encoded as a varint.
+
+With --format ndjson a line of JSON is written for every file as soon as it's
+parsed, so the lines follow the order in which files finish instead of the
+order of the inputs. Each line has the path, language, mode and status (ok or
+error) of the file, and its nodes or its error. Skipped files are not written.
+With --summary a last line with the counts of the whole batch is written.
+Standard output only gets the NDJSON lines, any log or progress goes to
+standard error.
+
+With --output the results are written to a file instead. With --output-dir
+the result of every file is written to its own file under the given directory,
+mirroring the paths of the inputs: foo/bar.go is written to
+dir/foo/bar.go.uast.json, .uast.yaml or .uast.pb depending on the encoding.
+In both cases a manifest listing every input with its output, language and
+parse status is written at the end, next to the output file or as
+manifest.json in the directory. Existing files are only overwritten with
+--force.
+
+Queries can only be applied to the UASTs of the v1 bblfsh protocol, so --query
+can't be combined with --mode. When a --query is given, --query-mode changes
+what is written for each file: the matching nodes (nodes, the default), only
+their token values (values) or the number of matching nodes (count). Files
+without matches always produce an explicit empty result. Invalid queries are
+rejected before parsing any file.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
 		if len(args) == 0 {
-			return
+			return nil
 		}
-		if len(args) > 1 {
-			logrus.Warnf("only taking into account the first file; ignoring the rest")
+
+		filter, err := fileFilterFromFlags(cmd)
+		if err != nil {
+			return err
 		}
-		path := args[0]
 
-		b, err := ioutil.ReadFile(path)
+		inputs, err := collectParseInputs(args, filter)
 		if err != nil {
-			logrus.Fatalf("could not read %s: %v", path, err)
+			return fmt.Errorf("could not find files to parse: %v", err)
 		}
 
 		c, err := daemon.Client()
 		if err != nil {
-			logrus.Fatalf("could not get daemon client: %v", err)
+			return fmt.Errorf("could not get daemon client: %v", err)
 		}
 
-		// First time it can be quite slow, as it may have to pull images.
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
-		defer cancel()
-
-		time.AfterFunc(3*time.Second, func() {
+		hint := time.AfterFunc(3*time.Second, func() {
 			logrus.Info("if this is the first time using a driver for a language, this might take a few more minutes while we install it")
 		})
+		defer hint.Stop()
 
 		flags := cmd.Flags()
 		lang, _ := flags.GetString("lang")
 		query, _ := flags.GetString("query")
-		stream, err := c.ParseWithLogs(ctx, &api.ParseRequest{
-			Kind:    api.ParseRequest_UAST,
-			Name:    path,
-			Content: b,
-			Lang:    lang,
-			Query:   query,
-		})
+		jobs, _ := flags.GetInt("jobs")
+		if jobs < 1 {
+			return usageErrorf("invalid number of jobs %d, it must be at least 1", jobs)
+		}
+
+		mappings, _ := flags.GetStringSlice("map-lang")
+		overrides, err := newLanguageOverrides(viper.GetStringMapString("parse.map-lang"), mappings)
+		if err != nil {
+			return err
+		}
+
+		fileTimeout, _ := flags.GetDuration("file-timeout")
+		if fileTimeout < 0 {
+			return usageErrorf("invalid file timeout %s", fileTimeout)
+		}
+
+		install, _ := flags.GetBool("install-missing")
+		noInstall, _ := flags.GetBool("no-install")
+		policy, err := newInstallPolicy(install, noInstall)
 		if err != nil {
-			logrus.Fatalf("%T %v", err, err)
+			return err
+		}
+
+		pins := driverPins()
+		warnDriverPins(c, pins)
+
+		p := &fileParser{
+			client:    c,
+			jobs:      jobs,
+			lang:      strings.ToLower(lang),
+			overrides: overrides,
+			query:     query,
+			installer: newDriverInstaller(c, policy, pins),
+			timeout:   fileTimeout,
+		}
+
+		encoding, _ := flags.GetString("encoding")
+		if _, err := newUASTWriter(nil, encoding, false); err != nil {
+			return err
+		}
+
+		queryMode, _ := flags.GetString("query-mode")
+		switch queryMode {
+		case queryModeNodes:
+		case queryModeValues, queryModeCount:
+			if query == "" {
+				return usageErrorf("--query-mode %s requires a --query", queryMode)
+			}
+			if encoding == encodingProto {
+				return usageErrorf("--query-mode %s can't be used with the proto encoding", queryMode)
+			}
+		default:
+			return usageErrorf("unknown query mode %q, it must be one of nodes, values or count", queryMode)
+		}
+
+		modeFlag, _ := flags.GetString("mode")
+		mode, ok := parseModes[modeFlag]
+		if !ok {
+			return usageErrorf("unknown mode %q, it must be one of semantic, annotated or native", modeFlag)
 		}
 
-		for {
-			resp, err := stream.Recv()
-			if err == io.EOF {
-				logrus.Fatalf("stream closed unexpectedly")
+		if query != "" {
+			if flags.Changed("mode") {
+				return usageErrorf("--query can't be used with --mode, queries are applied to v1 UASTs")
 			}
+
+			logrus.Debugf("using v1 UASTs to apply the query")
+			mode = api.Mode_DEFAULT_MODE
+			if err := validateQuery(c, query); err != nil {
+				return err
+			}
+		}
+		p.mode = mode
+
+		output, _ := flags.GetString("output")
+		outputDirPath, _ := flags.GetString("output-dir")
+		force, _ := flags.GetBool("force")
+
+		var manifestPath string
+		switch {
+		case output != "" && outputDirPath != "":
+			return usageErrorf("--output and --output-dir can't be used together")
+		case output != "":
+			manifestPath = output + "." + manifestName
+		case outputDirPath != "":
+			manifestPath = filepath.Join(outputDirPath, manifestName)
+		}
+
+		if _, err := os.Stat(manifestPath); manifestPath != "" && err == nil && !force {
+			return usageErrorf("%s already exists, use --force to overwrite it", manifestPath)
+		}
+
+		format, _ := flags.GetString("format")
+		ndjson := format == formatNDJSON
+		switch format {
+		case formatDocuments:
+		case formatNDJSON:
+			if encoding != encodingJSON {
+				return usageErrorf("--format ndjson can only be used with the json encoding")
+			}
+			if outputDirPath != "" {
+				return usageErrorf("--format ndjson can't be used with --output-dir")
+			}
+			p.unordered = true
+		default:
+			return usageErrorf("unknown format %q, it must be one of documents or ndjson", format)
+		}
+
+		var write func(r *parseResult) (string, error)
+		var stream *uastWriter
+		var outputFile *os.File
+		if outputDirPath != "" {
+			dir := &outputDir{
+				root:      outputDirPath,
+				encoding:  encoding,
+				delimited: query != "",
+				force:     force,
+			}
+			write = func(r *parseResult) (string, error) {
+				return dir.write(r, queryMode)
+			}
+		} else {
+			var out io.Writer = os.Stdout
+			if output != "" {
+				outputFile, err = createOutput(output, force)
+				if err != nil {
+					return err
+				}
+				out = outputFile
+			}
+
+			delimited := len(inputs) > 1 || query != ""
+			stream, err = newUASTWriter(out, encoding, delimited)
 			if err != nil {
-				logrus.Fatalf("could not stream: %v", err)
-			}
-			switch resp.Kind {
-			case api.ParseResponse_FINAL:
-				for _, b := range resp.Uast {
-					var node uast.Node
-					logrus.Infof("detected language: %s", resp.Lang)
-					if err := node.Unmarshal(b); err != nil {
-						logrus.Fatalf("could not unmarshal UAST: %v", err)
-					}
-					fmt.Println(&node)
+				return err
+			}
+
+			write = func(r *parseResult) (string, error) {
+				var err error
+				if ndjson {
+					err = stream.writeNDJSON(r, queryMode)
+				} else {
+					err = stream.writeResult(r, queryMode)
+				}
+
+				if err != nil {
+					return "", errors.Wrap(err, "could not write UAST")
 				}
-				return
-			case api.ParseResponse_LOG:
-				logrus.Debugf(resp.Log)
+				return output, nil
 			}
 		}
+
+		// Progress is only worth it for batches, and it replaces the log of
+		// every file, which would garble it.
+		var progress *parseProgress
+		if !quiet && !machineOutput() && len(inputs) > 1 {
+			progress = newParseProgress(os.Stderr, isTerminal(os.Stderr), len(inputs))
+		}
+
+		manifest := new(parseManifest)
+		summary := p.parse(inputs, func(r *parseResult) {
+			var path string
+			switch {
+			case r.skipped:
+			case r.err == nil:
+				logf := logrus.Infof
+				if progress != nil || quiet {
+					logf = logrus.Debugf
+				}
+
+				logf("%s: detected language: %s, mode: %s", r.path, r.lang, modeName(r.mode))
+				path, r.err = write(r)
+			case ndjson:
+				if _, err := write(r); err != nil {
+					logrus.Errorf("could not write the error of %s: %v", r.path, err)
+				}
+			}
+			manifest.add(r, path)
+
+			if progress != nil {
+				progress.add(r)
+			}
+		})
+
+		if progress != nil {
+			progress.finish()
+		}
+
+		if withSummary, _ := flags.GetBool("summary"); ndjson && withSummary {
+			if err := stream.writeNDJSONSummary(summary); err != nil {
+				logrus.Errorf("could not write summary: %v", err)
+			}
+		}
+
+		if outputFile != nil {
+			if err := outputFile.Close(); err != nil {
+				return fmt.Errorf("could not write %s: %v", output, err)
+			}
+		}
+
+		if manifestPath != "" {
+			if err := manifest.write(manifestPath, force); err != nil {
+				return fmt.Errorf("could not write manifest: %v", err)
+			}
+			logrus.Infof("manifest written to %s", manifestPath)
+		}
+
+		// The UASTs are written to stdout, so the summary record is written
+		// to stderr with --output-mode json too.
+		err = newRecordWriter(os.Stderr).write("parse_summary", summary.record(), func(w io.Writer) error {
+			summary.print(w)
+			return nil
+		})
+		if err != nil {
+			logrus.Errorf("could not write summary: %v", err)
+		}
+
+		if failOnError, _ := flags.GetBool("fail-on-error"); failOnError && summary.failed() {
+			return exitStatus(exitFailed)
+		}
+		return nil
 	},
 }
 
+// Formats of the output. Documents are written in the order of the inputs
+// using the chosen encoding, while NDJSON writes a line of JSON per file as
+// soon as it's parsed.
+const (
+	formatDocuments = "documents"
+	formatNDJSON    = "ndjson"
+)
+
+// Modes of output for the nodes matched by a query.
+const (
+	queryModeNodes  = "nodes"
+	queryModeValues = "values"
+	queryModeCount  = "count"
+)
+
+// validateQuery asks the daemon to check the query before any file is
+// parsed. Daemons without support for it just report the errors per file.
+func validateQuery(c api.EngineClient, query string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := c.ValidateQuery(ctx, &api.ValidateQueryRequest{Query: query})
+	if status.Code(err) == codes.Unimplemented {
+		logrus.Warnf("the daemon can't validate queries, invalid queries will be reported for each file")
+	} else if err != nil {
+		return usageErrorf("invalid query %q: %v", query, status.Convert(err).Message())
+	}
+	return nil
+}
+
 var parseLangCmd = &cobra.Command{
 	Use:   "lang",
 	Short: "Identify the language of the given files.",
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		if len(args) == 0 {
-			return
+			return nil
 		}
 		if len(args) > 1 {
 			logrus.Warnf("only taking into account the first file; ignoring the rest")
@@ -123,12 +410,12 @@ var parseLangCmd = &cobra.Command{
 		path := args[0]
 		b, err := ioutil.ReadFile(path)
 		if err != nil {
-			logrus.Fatalf("could not read %s: %v", path, err)
+			return fmt.Errorf("could not read %s: %v", path, err)
 		}
 
 		c, err := daemon.Client()
 		if err != nil {
-			logrus.Fatalf("could not get daemon client: %v", err)
+			return fmt.Errorf("could not get daemon client: %v", err)
 		}
 		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
 		defer cancel()
@@ -139,9 +426,10 @@ var parseLangCmd = &cobra.Command{
 			Content: b,
 		})
 		if err != nil {
-			logrus.Fatalf("server error: %v", err)
+			return fmt.Errorf("server error: %v", err)
 		}
 		fmt.Println(res.Lang)
+		return nil
 	},
 }
 
@@ -156,6 +444,22 @@ func init() {
 	parseCmd.AddCommand(parseLangCmd)
 	parseCmd.AddCommand(parseDriversCmd)
 
-	parseUASTCmd.Flags().StringP("lang", "l", "", "avoid language detection, use this parser")
+	parseUASTCmd.Flags().StringP("lang", "l", "", "avoid language detection, use this parser for every file")
+	parseUASTCmd.Flags().StringSlice("map-lang", nil, "use a language for an extension (.inc=php) or file name (BUILD=python), can be repeated")
+	addConfigSection("parse.map-lang")
 	parseUASTCmd.Flags().StringP("query", "q", "", "XPath query applied to the parsed UASTs")
+	parseUASTCmd.Flags().StringP("mode", "m", modeSemantic, "UAST mode: semantic, annotated or native")
+	parseUASTCmd.Flags().String("query-mode", queryModeNodes, "output of a query: the matching nodes, their token values, or the count per file")
+	parseUASTCmd.Flags().StringP("encoding", "e", encodingJSON, "encoding of the UASTs: json, proto or yaml")
+	parseUASTCmd.Flags().Bool("install-missing", false, "install the official driver of any language without one, without asking")
+	parseUASTCmd.Flags().Bool("no-install", false, "never install drivers, skip the files of languages without one")
+	parseUASTCmd.Flags().String("format", formatDocuments, "output format: documents in the order of the files, or ndjson as soon as each file is parsed")
+	parseUASTCmd.Flags().Bool("summary", false, "with --format ndjson, write a last line with the counts of the batch")
+	parseUASTCmd.Flags().StringP("output", "o", "", "write the results to this file instead of the standard output")
+	parseUASTCmd.Flags().String("output-dir", "", "write the result of every file to its own file under this directory")
+	parseUASTCmd.Flags().Bool("force", false, "overwrite existing output files")
+	parseUASTCmd.Flags().Duration("file-timeout", 0, "maximum time to parse each file, like 30s (defaults to 10m, to give time to install drivers)")
+	parseUASTCmd.Flags().Bool("fail-on-error", true, "exit with a non-zero code if any file failed or timed out")
+	addFileFilterFlags(parseUASTCmd)
+	parseUASTCmd.Flags().IntP("jobs", "j", defaultParseJobs(), "number of files parsed concurrently")
 }
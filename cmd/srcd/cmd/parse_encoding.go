@@ -0,0 +1,271 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	api "github.com/src-d/engine/api"
+	"gopkg.in/bblfsh/sdk.v1/uast"
+	"gopkg.in/bblfsh/sdk.v2/uast/nodes/nodesproto"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Supported encodings of the UASTs written by srcd parse uast.
+const (
+	encodingJSON  = "json"
+	encodingProto = "proto"
+	encodingYAML  = "yaml"
+)
+
+// Supported UAST modes.
+const (
+	modeSemantic  = "semantic"
+	modeAnnotated = "annotated"
+	modeNative    = "native"
+)
+
+var parseModes = map[string]api.Mode{
+	modeSemantic:  api.Mode_SEMANTIC,
+	modeAnnotated: api.Mode_ANNOTATED,
+	modeNative:    api.Mode_NATIVE,
+}
+
+// modeName returns the name of a mode as used in the output. The default mode
+// is the UAST of the v1 protocol, used to apply queries.
+func modeName(m api.Mode) string {
+	if m == api.Mode_DEFAULT_MODE {
+		return "v1"
+	}
+	return strings.ToLower(m.String())
+}
+
+// uastWriter writes the parse results returned by the daemon in a given
+// encoding.
+//
+// The nodes arrive already serialized as protobuf, so the proto encoding
+// writes them untouched, prefixed by their varint encoded length when the
+// stream can contain more than one node.
+//
+// The json and yaml encodings write a document per file with its path,
+// language and UAST mode, followed by the nodes, their token values or their
+// count, depending on the query mode.
+type uastWriter struct {
+	w         io.Writer
+	encoding  string
+	delimited bool
+}
+
+func newUASTWriter(w io.Writer, encoding string, delimited bool) (*uastWriter, error) {
+	switch encoding {
+	case encodingJSON, encodingProto, encodingYAML:
+	default:
+		return nil, fmt.Errorf("unknown encoding %q, it must be one of json, proto or yaml", encoding)
+	}
+
+	return &uastWriter{w: w, encoding: encoding, delimited: delimited}, nil
+}
+
+func (w *uastWriter) writeResult(r *parseResult, queryMode string) error {
+	if w.encoding == encodingProto {
+		return w.writeProto(r.uast)
+	}
+
+	doc := map[string]interface{}{
+		"path":     r.path,
+		"language": r.lang,
+		"mode":     modeName(r.mode),
+	}
+
+	if err := addNodes(doc, r, queryMode); err != nil {
+		return err
+	}
+
+	if w.encoding == encodingYAML {
+		b, err := yaml.Marshal(doc)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w.w, "---\n%s", b)
+		return err
+	}
+
+	return json.NewEncoder(w.w).Encode(doc)
+}
+
+// Status of the results written as NDJSON.
+const (
+	ndjsonOK    = "ok"
+	ndjsonError = "error"
+)
+
+// writeNDJSON writes the result as a single line of JSON with its status,
+// including the error of the files that failed.
+func (w *uastWriter) writeNDJSON(r *parseResult, queryMode string) error {
+	doc := map[string]interface{}{
+		"path":   r.path,
+		"status": ndjsonOK,
+	}
+
+	if r.err != nil {
+		doc["status"] = ndjsonError
+		doc["error"] = r.err.Error()
+	} else {
+		doc["language"] = r.lang
+		doc["mode"] = modeName(r.mode)
+		if err := addNodes(doc, r, queryMode); err != nil {
+			return err
+		}
+	}
+
+	return json.NewEncoder(w.w).Encode(doc)
+}
+
+// writeNDJSONSummary writes the aggregate counts of a batch as the last line
+// of JSON.
+func (w *uastWriter) writeNDJSONSummary(s *parseSummary) error {
+	return json.NewEncoder(w.w).Encode(map[string]interface{}{
+		"summary": map[string]int{
+			"files":     s.ok + len(s.failures) + len(s.timeouts) + s.skipped,
+			"ok":        s.ok,
+			"failed":    len(s.failures),
+			"timed_out": len(s.timeouts),
+			"skipped":   s.skipped,
+		},
+	})
+}
+
+// addNodes adds to the document the nodes of the result, their token values
+// or their count, depending on the query mode.
+func addNodes(doc map[string]interface{}, r *parseResult, queryMode string) error {
+	switch queryMode {
+	case queryModeCount:
+		doc["count"] = len(r.uast)
+	case queryModeValues:
+		values := []string{}
+		for _, b := range r.uast {
+			var node uast.Node
+			if err := node.Unmarshal(b); err != nil {
+				return fmt.Errorf("could not unmarshal UAST: %v", err)
+			}
+
+			if node.Token != "" {
+				values = append(values, node.Token)
+			}
+		}
+		doc["values"] = values
+	default:
+		nodes := []interface{}{}
+		for _, b := range r.uast {
+			n, err := decodeNode(b, r.mode)
+			if err != nil {
+				return err
+			}
+			nodes = append(nodes, n)
+		}
+		doc["uast"] = nodes
+	}
+
+	return nil
+}
+
+// writeProto writes the nodes as they are. A file without nodes, because none
+// matched the query, is written as a zero length message.
+func (w *uastWriter) writeProto(nodes [][]byte) error {
+	if len(nodes) == 0 && w.delimited {
+		_, err := w.w.Write(proto.EncodeVarint(0))
+		return err
+	}
+
+	for _, data := range nodes {
+		if w.delimited {
+			if _, err := w.w.Write(proto.EncodeVarint(uint64(len(data)))); err != nil {
+				return err
+			}
+		}
+
+		if _, err := w.w.Write(data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// decodeNode decodes a node into a value that can be encoded as json or yaml.
+// Nodes in the default mode are v1 protocol nodes, the rest are encoded in the
+// binary format of the v2 protocol.
+func decodeNode(data []byte, mode api.Mode) (interface{}, error) {
+	if mode != api.Mode_DEFAULT_MODE {
+		n, err := nodesproto.ReadTree(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("could not decode UAST: %v", err)
+		}
+
+		if n == nil {
+			return nil, nil
+		}
+		return n.Native(), nil
+	}
+
+	var node uast.Node
+	if err := node.Unmarshal(data); err != nil {
+		return nil, fmt.Errorf("could not unmarshal UAST: %v", err)
+	}
+
+	return nodeToMap(&node), nil
+}
+
+// nodeToMap converts a node into a generic map so the roles are encoded with
+// their names instead of their numeric values and empty fields are omitted.
+func nodeToMap(n *uast.Node) map[string]interface{} {
+	m := make(map[string]interface{})
+	if n.InternalType != "" {
+		m["InternalType"] = n.InternalType
+	}
+
+	if len(n.Properties) > 0 {
+		m["Properties"] = n.Properties
+	}
+
+	if n.Token != "" {
+		m["Token"] = n.Token
+	}
+
+	if n.StartPosition != nil {
+		m["StartPosition"] = positionToMap(n.StartPosition)
+	}
+
+	if n.EndPosition != nil {
+		m["EndPosition"] = positionToMap(n.EndPosition)
+	}
+
+	if len(n.Roles) > 0 {
+		roles := make([]string, len(n.Roles))
+		for i, r := range n.Roles {
+			roles[i] = r.String()
+		}
+		m["Roles"] = roles
+	}
+
+	if len(n.Children) > 0 {
+		children := make([]map[string]interface{}, len(n.Children))
+		for i, c := range n.Children {
+			children[i] = nodeToMap(c)
+		}
+		m["Children"] = children
+	}
+
+	return m
+}
+
+func positionToMap(p *uast.Position) map[string]uint32 {
+	return map[string]uint32{
+		"Offset": p.Offset,
+		"Line":   p.Line,
+		"Col":    p.Col,
+	}
+}
@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestWriteNDJSON(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := newUASTWriter(&buf, encodingJSON, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results := []*parseResult{
+		{path: "ok.go", lang: "go"},
+		{path: "broken.go", err: fmt.Errorf("syntax error")},
+	}
+
+	for _, r := range results {
+		if err := w.writeNDJSON(r, queryModeNodes); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %d: %q", len(lines), buf.String())
+	}
+
+	var ok, failed map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &ok); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &failed); err != nil {
+		t.Fatal(err)
+	}
+
+	if ok["status"] != ndjsonOK || ok["language"] != "go" {
+		t.Errorf("unexpected line for ok.go: %s", lines[0])
+	}
+
+	if failed["status"] != ndjsonError || failed["error"] != "syntax error" {
+		t.Errorf("unexpected line for broken.go: %s", lines[1])
+	}
+}
@@ -0,0 +1,781 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	api "github.com/src-d/engine/api"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	enry "gopkg.in/src-d/enry.v1"
+)
+
+// maxParseJobs caps the default number of concurrent parse requests so big
+// machines don't flood bblfshd with more requests than it has drivers for.
+const maxParseJobs = 16
+
+func defaultParseJobs() int {
+	n := runtime.NumCPU()
+	if n > maxParseJobs {
+		return maxParseJobs
+	}
+	return n
+}
+
+// parseInput is a file to be parsed. Files given explicitly on the command
+// line are always sent to the daemon, while files found walking a directory
+// are skipped when their language can't be detected and it's not forced with
+// --lang or --map-lang.
+type parseInput struct {
+	path     string
+	explicit bool
+}
+
+// fileFilter selects the files found walking directories using glob
+// patterns, as accepted by filepath.Match. Patterns are matched against the
+// path relative to the walked directory and against the file name, so both
+// vendor/* and *.min.js work. Files given explicitly are never filtered.
+type fileFilter struct {
+	include []string
+	exclude []string
+}
+
+func newFileFilter(include, exclude []string) (*fileFilter, error) {
+	for _, p := range append(include, exclude...) {
+		if _, err := filepath.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %v", p, err)
+		}
+	}
+
+	return &fileFilter{include: include, exclude: exclude}, nil
+}
+
+// addFileFilterFlags adds the flags to include and exclude files to a command
+// walking directories.
+func addFileFilterFlags(cmd *cobra.Command) {
+	cmd.Flags().StringSlice("include", nil, "only use the files found in directories matching these glob patterns")
+	cmd.Flags().StringSlice("exclude", nil, "ignore the files and directories matching these glob patterns")
+}
+
+// fileFilterFromFlags returns the filter given by the flags added with
+// addFileFilterFlags.
+func fileFilterFromFlags(cmd *cobra.Command) (*fileFilter, error) {
+	include, _ := cmd.Flags().GetStringSlice("include")
+	exclude, _ := cmd.Flags().GetStringSlice("exclude")
+	return newFileFilter(include, exclude)
+}
+
+func matchAny(patterns []string, rel string) bool {
+	rel = filepath.ToSlash(rel)
+	name := path.Base(rel)
+	for _, p := range patterns {
+		p = filepath.ToSlash(p)
+		if ok, _ := path.Match(p, rel); ok {
+			return true
+		}
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// skipDir reports whether a directory, relative to the walked one, is excluded.
+func (f *fileFilter) skipDir(rel string) bool {
+	return f != nil && matchAny(f.exclude, rel)
+}
+
+// match reports whether a file, relative to the walked directory, is selected.
+func (f *fileFilter) match(rel string) bool {
+	if f == nil {
+		return true
+	}
+
+	if matchAny(f.exclude, rel) {
+		return false
+	}
+
+	return len(f.include) == 0 || matchAny(f.include, rel)
+}
+
+// collectParseInputs expands the given paths into the list of files to parse.
+// Directories are walked recursively, ignoring hidden files and directories
+// and the ones not selected by the filter, which may be nil to select all.
+// Only paths are collected, contents are read by the workers when needed.
+func collectParseInputs(paths []string, filter *fileFilter) ([]parseInput, error) {
+	var inputs []parseInput
+	for _, path := range paths {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+
+		if !fi.IsDir() {
+			inputs = append(inputs, parseInput{path: path, explicit: true})
+			continue
+		}
+
+		err = filepath.Walk(path, func(p string, fi os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+
+			if p == path {
+				return nil
+			}
+
+			rel, err := filepath.Rel(path, p)
+			if err != nil {
+				return err
+			}
+
+			if strings.HasPrefix(fi.Name(), ".") || (fi.IsDir() && filter.skipDir(rel)) {
+				if fi.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+
+			if fi.Mode().IsRegular() && filter.match(rel) {
+				inputs = append(inputs, parseInput{path: p})
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not walk %s", path)
+		}
+	}
+
+	return inputs, nil
+}
+
+// languageOverrides maps file extensions, starting with a dot, and exact file
+// names to the language used to parse them, bypassing language detection.
+type languageOverrides map[string]string
+
+// newLanguageOverrides builds the overrides from the mappings in the config
+// file and the ones given as ext=language flags, which take precedence.
+func newLanguageOverrides(config map[string]string, mappings []string) (languageOverrides, error) {
+	o := make(languageOverrides)
+	for k, v := range config {
+		if err := o.add(k, v); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, m := range mappings {
+		parts := strings.SplitN(m, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid language mapping %q, expecting ext=language", m)
+		}
+
+		if err := o.add(parts[0], parts[1]); err != nil {
+			return nil, err
+		}
+	}
+
+	return o, nil
+}
+
+func (o languageOverrides) add(key, lang string) error {
+	key = strings.TrimSpace(key)
+	lang = strings.ToLower(strings.TrimSpace(lang))
+	if key == "" || lang == "" {
+		return usageErrorf("invalid language mapping %q=%q", key, lang)
+	}
+
+	o[strings.ToLower(key)] = lang
+	return nil
+}
+
+// lookup returns the language for the given path, or an empty string if there
+// is no override for it. Exact file names win over extensions. Both are
+// matched ignoring case, as the keys in the config file are case insensitive.
+func (o languageOverrides) lookup(path string) string {
+	name := strings.ToLower(filepath.Base(path))
+	if lang, ok := o[name]; ok {
+		return lang
+	}
+
+	return o[filepath.Ext(name)]
+}
+
+// parseResult is the outcome of parsing a single file.
+type parseResult struct {
+	index   int
+	path    string
+	lang    string
+	mode    api.Mode
+	uast    [][]byte
+	skipped bool
+	err     error
+	// timedOut is true if the error is the file taking longer than the
+	// per file timeout.
+	timedOut bool
+}
+
+// fileParser sends the files to the daemon using a pool of workers.
+type fileParser struct {
+	client    api.EngineClient
+	jobs      int
+	lang      string
+	overrides languageOverrides
+	query     string
+	mode      api.Mode
+	// installer handles the languages without a driver installed. If it's
+	// nil the daemon installs them as needed.
+	installer *driverInstaller
+	// timeout is the maximum time spent parsing each file, or 0 to use
+	// defaultFileTimeout.
+	timeout time.Duration
+	// unordered emits the results as soon as they finish instead of in
+	// the order of the inputs.
+	unordered bool
+
+	mu       sync.Mutex
+	timeouts map[string]int
+}
+
+// defaultFileTimeout is long enough to pull the images of the drivers the
+// first time they are used.
+const defaultFileTimeout = 10 * time.Minute
+
+// driverTimeoutsWarning is the number of files of the same language that can
+// time out before warning that its driver may be stuck.
+const driverTimeoutsWarning = 3
+
+// errFileTimeout is returned when a file takes longer than the timeout.
+var errFileTimeout = fmt.Errorf("timed out")
+
+// parse parses all the inputs and calls emit with every result in the same
+// order the inputs were given, no matter in which order they finish, unless
+// unordered is set. Emit can set the error of a result, which is then reported
+// as a failure. Only a bounded window of files is in flight or waiting to be
+// emitted at any time, so big batches don't end up entirely in memory. Several
+// files are sent to the daemon over a single ParseFiles stream, a single one
+// with its own call.
+func (p *fileParser) parse(inputs []parseInput, emit func(*parseResult)) *parseSummary {
+	if len(inputs) > 1 {
+		return p.parseStream(inputs, emit)
+	}
+	return p.parseEach(inputs, emit)
+}
+
+func (p *fileParser) numJobs() int {
+	if p.jobs < 1 {
+		return 1
+	}
+	return p.jobs
+}
+
+// feed sends the indexes of the inputs to the workers, only as long as the
+// window has room.
+func feed(n int, window chan struct{}) <-chan int {
+	indexes := make(chan int)
+	go func() {
+		defer close(indexes)
+		for i := 0; i < n; i++ {
+			window <- struct{}{}
+			indexes <- i
+		}
+	}()
+	return indexes
+}
+
+// parseEach parses every input with its own call to the daemon, with a pool
+// of workers.
+func (p *fileParser) parseEach(inputs []parseInput, emit func(*parseResult)) *parseSummary {
+	jobs := p.numJobs()
+	window := make(chan struct{}, 2*jobs)
+	indexes := feed(len(inputs), window)
+
+	results := make(chan *parseResult, jobs)
+	for i := 0; i < jobs; i++ {
+		go func() {
+			for idx := range indexes {
+				results <- p.parseFile(idx, inputs[idx])
+			}
+		}()
+	}
+
+	return p.emitResults(results, len(inputs), window, emit)
+}
+
+// emitResults emits the given number of results, freeing their room in the
+// window once emitted.
+func (p *fileParser) emitResults(
+	results <-chan *parseResult,
+	n int,
+	window chan struct{},
+	emit func(*parseResult),
+) *parseSummary {
+	summary := new(parseSummary)
+	pending := make(map[int]*parseResult)
+	next := 0
+	for i := 0; i < n; i++ {
+		res := <-results
+		if p.unordered {
+			emit(res)
+			summary.add(res)
+			<-window
+			continue
+		}
+
+		pending[res.index] = res
+		for {
+			r, ok := pending[next]
+			if !ok {
+				break
+			}
+
+			delete(pending, next)
+			emit(r)
+			summary.add(r)
+			<-window
+			next++
+		}
+	}
+
+	return summary
+}
+
+// prepareFile reads the file and finds its language. It returns done if the
+// file doesn't have to be sent to the daemon, as when it's skipped or it
+// can't be read.
+func (p *fileParser) prepareFile(index int, input parseInput) (res *parseResult, content []byte, lang string, done bool) {
+	res = &parseResult{index: index, path: input.path}
+
+	content, err := ioutil.ReadFile(input.path)
+	if err != nil {
+		res.err = errors.Wrapf(err, "could not read %s", input.path)
+		return res, nil, "", true
+	}
+
+	lang = p.lang
+	if lang == "" {
+		lang = p.overrides.lookup(input.path)
+	}
+
+	if lang == "" && !input.explicit {
+		if enry.IsBinary(content) {
+			res.skipped = true
+			return res, nil, "", true
+		}
+
+		lang = strings.ToLower(enry.GetLanguage(filepath.Base(input.path), content))
+		if lang == "" {
+			res.skipped = true
+			return res, nil, "", true
+		}
+	}
+
+	if lang == "" {
+		lang = strings.ToLower(enry.GetLanguage(filepath.Base(input.path), content))
+	}
+	return res, content, lang, false
+}
+
+func (p *fileParser) parseFile(index int, input parseInput) *parseResult {
+	res, content, lang, done := p.prepareFile(index, input)
+	if done {
+		return res
+	}
+
+	resp, err := p.request(input.path, content, lang)
+	if status.Code(err) == codes.FailedPrecondition && p.installer != nil {
+		var installed bool
+		installed, err = p.installer.ensure(lang)
+		if err == nil && !installed {
+			res.skipped = true
+			return res
+		}
+
+		if err == nil {
+			resp, err = p.request(input.path, content, lang)
+		}
+	}
+	return p.finish(res, lang, resp, err)
+}
+
+// finish fills the result of the file with the response of the daemon, or
+// its error.
+func (p *fileParser) finish(res *parseResult, lang string, resp *api.ParseResponse, err error) *parseResult {
+	if err == errFileTimeout {
+		res.timedOut = true
+		res.err = fmt.Errorf("timed out after %s", p.fileTimeout())
+		p.recordTimeout(lang)
+		return res
+	}
+
+	if err != nil {
+		res.err = err
+		return res
+	}
+
+	res.lang = resp.Lang
+	res.uast = resp.Uast
+	res.mode = resp.Mode
+	return res
+}
+
+func (p *fileParser) fileTimeout() time.Duration {
+	if p.timeout > 0 {
+		return p.timeout
+	}
+	return defaultFileTimeout
+}
+
+// recordTimeout counts the files of a language that timed out, warning when a
+// driver keeps timing out as it may be stuck and slowing down the whole batch.
+func (p *fileParser) recordTimeout(lang string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.timeouts == nil {
+		p.timeouts = make(map[string]int)
+	}
+
+	p.timeouts[lang]++
+	if p.timeouts[lang] == driverTimeoutsWarning {
+		logrus.Warnf("the %s driver timed out parsing %d files, it may be stuck; "+
+			"if the rest of the %s files time out too, restart bblfshd with srcd init",
+			lang, driverTimeoutsWarning, lang)
+	}
+}
+
+// request sends a file to the daemon and waits for the final response,
+// logging anything the daemon reports meanwhile. If the file takes longer than
+// the timeout errFileTimeout is returned.
+func (p *fileParser) request(path string, content []byte, lang string) (*api.ParseResponse, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), p.fileTimeout())
+	defer cancel()
+
+	resp, err := p.stream(ctx, path, content, lang)
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		return nil, errFileTimeout
+	}
+	return resp, err
+}
+
+func (p *fileParser) stream(
+	ctx context.Context,
+	path string,
+	content []byte,
+	lang string,
+) (*api.ParseResponse, error) {
+	stream, err := p.client.ParseWithLogs(ctx, &api.ParseRequest{
+		Kind:      api.ParseRequest_UAST,
+		Name:      path,
+		Content:   content,
+		Lang:      lang,
+		Query:     p.query,
+		Mode:      p.mode,
+		NoInstall: p.installer != nil,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			return nil, fmt.Errorf("stream closed unexpectedly")
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch resp.Kind {
+		case api.ParseResponse_FINAL:
+			return resp, nil
+		case api.ParseResponse_LOG:
+			logrus.Debugf("%s: %s", path, resp.Log)
+		}
+	}
+}
+
+// streamedFile is a file sent over the ParseFiles stream waiting for its
+// response.
+type streamedFile struct {
+	res  *parseResult
+	lang string
+	req  *api.ParseFilesRequest
+	// retried is true once the file was sent again after installing its
+	// driver.
+	retried bool
+}
+
+// streamParser keeps the files sent over a ParseFiles stream until their
+// response arrives. Once the stream fails, the files waiting and the ones
+// sent afterwards fail with its error.
+type streamParser struct {
+	p       *fileParser
+	results chan<- *parseResult
+	sends   chan<- *api.ParseFilesRequest
+
+	mu      sync.Mutex
+	files   map[int64]*streamedFile
+	err     error
+	sentJob bool
+}
+
+// send sends the file to the daemon, or fails it if the stream already did.
+func (s *streamParser) send(f *streamedFile) {
+	s.mu.Lock()
+	if s.err != nil {
+		s.mu.Unlock()
+		f.res.err = s.err
+		s.results <- f.res
+		return
+	}
+
+	// The number of files parsed at once is only read from the first one.
+	if !s.sentJob {
+		f.req.Jobs = int32(s.p.numJobs())
+		s.sentJob = true
+	} else {
+		f.req.Jobs = 0
+	}
+
+	s.files[f.req.Id] = f
+	s.mu.Unlock()
+	s.sends <- f.req
+}
+
+// take returns the file waiting for the response with the given id.
+func (s *streamParser) take(id int64) *streamedFile {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f := s.files[id]
+	delete(s.files, id)
+	return f
+}
+
+// fail fails all the files waiting, and the ones sent afterwards, with err.
+func (s *streamParser) fail(err error) {
+	s.mu.Lock()
+	s.err = err
+	files := s.files
+	s.files = nil
+	s.mu.Unlock()
+
+	for _, f := range files {
+		f.res.err = err
+		s.results <- f.res
+	}
+}
+
+// receive handles the responses of the daemon until the stream ends.
+func (s *streamParser) receive(stream api.Engine_ParseFilesClient) {
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			s.fail(fmt.Errorf("stream closed unexpectedly"))
+			return
+		}
+		if err != nil {
+			s.fail(err)
+			return
+		}
+
+		f := s.take(resp.Id)
+		if f == nil {
+			logrus.Debugf("ignoring the response for unknown file %d", resp.Id)
+			continue
+		}
+
+		code := codes.Code(resp.Code)
+		if code == codes.FailedPrecondition && s.p.installer != nil && !f.retried {
+			// Installing the driver can take a while, don't hold the
+			// responses of the other files meanwhile.
+			go s.install(f)
+			continue
+		}
+
+		switch code {
+		case codes.OK:
+			err = nil
+		case codes.DeadlineExceeded:
+			err = errFileTimeout
+		default:
+			err = status.Error(code, resp.Error)
+		}
+		s.results <- s.p.finish(f.res, f.lang, resp.Result, err)
+	}
+}
+
+// install installs the driver of the file, as the installer of the parser
+// chooses, and sends it again, or skips it.
+func (s *streamParser) install(f *streamedFile) {
+	installed, err := s.p.installer.ensure(f.lang)
+	if err != nil {
+		f.res.err = err
+		s.results <- f.res
+		return
+	}
+
+	if !installed {
+		f.res.skipped = true
+		s.results <- f.res
+		return
+	}
+
+	f.retried = true
+	s.send(f)
+}
+
+// parseStream parses the inputs over a single ParseFiles stream. A pool of
+// workers reads the files and finds their languages, and the daemon parses
+// them with as many at once as jobs.
+func (p *fileParser) parseStream(inputs []parseInput, emit func(*parseResult)) *parseSummary {
+	jobs := p.numJobs()
+	window := make(chan struct{}, 2*jobs)
+	indexes := feed(len(inputs), window)
+	results := make(chan *parseResult, jobs)
+	sends := make(chan *api.ParseFilesRequest, jobs)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s := &streamParser{
+		p:       p,
+		results: results,
+		sends:   sends,
+		files:   make(map[int64]*streamedFile),
+	}
+
+	stream, err := p.client.ParseFiles(ctx)
+	if err != nil {
+		s.fail(err)
+	} else {
+		go s.receive(stream)
+		go func() {
+			for req := range sends {
+				// The error is the one the receiver gets.
+				if err := stream.Send(req); err != nil {
+					logrus.Debugf("could not send %s: %v", req.File.Name, err)
+				}
+			}
+			stream.CloseSend()
+		}()
+	}
+
+	timeout := int64(p.fileTimeout() / time.Millisecond)
+	for i := 0; i < jobs; i++ {
+		go func() {
+			for idx := range indexes {
+				res, content, lang, done := p.prepareFile(idx, inputs[idx])
+				if done {
+					results <- res
+					continue
+				}
+
+				s.send(&streamedFile{res: res, lang: lang, req: &api.ParseFilesRequest{
+					Id:        int64(idx),
+					TimeoutMs: timeout,
+					File: &api.ParseRequest{
+						Kind:      api.ParseRequest_UAST,
+						Name:      inputs[idx].path,
+						Content:   content,
+						Lang:      lang,
+						Query:     p.query,
+						Mode:      p.mode,
+						NoInstall: p.installer != nil,
+					},
+				}})
+			}
+		}()
+	}
+
+	summary := p.emitResults(results, len(inputs), window, emit)
+	// Every file has its result, so nothing else is sent.
+	close(sends)
+	return summary
+}
+
+// parseSummary aggregates the results of a batch of parsed files.
+type parseSummary struct {
+	ok       int
+	skipped  int
+	failures []*parseResult
+	timeouts []*parseResult
+}
+
+func (s *parseSummary) add(r *parseResult) {
+	switch {
+	case r.timedOut:
+		s.timeouts = append(s.timeouts, r)
+	case r.err != nil:
+		s.failures = append(s.failures, r)
+	case r.skipped:
+		s.skipped++
+	default:
+		s.ok++
+	}
+}
+
+// failed reports whether any file failed or timed out.
+func (s *parseSummary) failed() bool {
+	return len(s.failures) > 0 || len(s.timeouts) > 0
+}
+
+// parseSummaryRecord is the summary of the files parsed with
+// --output-mode json.
+type parseSummaryRecord struct {
+	Files    int                  `json:"files"`
+	OK       int                  `json:"ok"`
+	Skipped  int                  `json:"skipped"`
+	Failures []parseFailureRecord `json:"failures"`
+	Timeouts []parseFailureRecord `json:"timeouts"`
+}
+
+type parseFailureRecord struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+func (s *parseSummary) record() parseSummaryRecord {
+	failures := func(results []*parseResult) []parseFailureRecord {
+		records := []parseFailureRecord{}
+		for _, r := range results {
+			records = append(records, parseFailureRecord{r.path, fmt.Sprint(r.err)})
+		}
+		return records
+	}
+
+	return parseSummaryRecord{
+		Files:    s.ok + len(s.failures) + len(s.timeouts) + s.skipped,
+		OK:       s.ok,
+		Skipped:  s.skipped,
+		Failures: failures(s.failures),
+		Timeouts: failures(s.timeouts),
+	}
+}
+
+func (s *parseSummary) print(w io.Writer) {
+	total := s.ok + len(s.failures) + len(s.timeouts) + s.skipped
+	fmt.Fprintf(w, "parsed %d files: %d ok, %d failed, %d timed out, %d skipped\n",
+		total, s.ok, len(s.failures), len(s.timeouts), s.skipped)
+	for _, f := range s.failures {
+		fmt.Fprintf(w, "  %s: %v\n", f.path, f.err)
+	}
+
+	if len(s.timeouts) > 0 {
+		fmt.Fprintln(w, "timed out:")
+		for _, f := range s.timeouts {
+			fmt.Fprintf(w, "  %s: %v\n", f.path, f.err)
+		}
+	}
+}
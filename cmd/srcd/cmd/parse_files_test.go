@@ -0,0 +1,291 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/src-d/engine/api"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+func TestLanguageOverrides(t *testing.T) {
+	o, err := newLanguageOverrides(
+		map[string]string{".inc": "php", "build": "python"},
+		[]string{".bzl=Python", ".inc=c"},
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	testCases := []struct {
+		path     string
+		expected string
+	}{
+		{"foo/bar.inc", "c"},
+		{"foo/BAR.INC", "c"},
+		{"rules.bzl", "python"},
+		{"foo/BUILD", "python"},
+		{"foo/BUILD.bazel", ""},
+		{"main.go", ""},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.path, func(t *testing.T) {
+			result := o.lookup(tt.path)
+			if result != tt.expected {
+				t.Errorf("expected: %s, got: %s", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestLanguageOverridesInvalid(t *testing.T) {
+	for _, m := range []string{"inc", "=php", ".inc="} {
+		if _, err := newLanguageOverrides(nil, []string{m}); err == nil {
+			t.Errorf("expected an error for mapping %q", m)
+		}
+	}
+}
+
+func TestParseSummaryTimeouts(t *testing.T) {
+	var s parseSummary
+	s.add(&parseResult{path: "ok.go"})
+	s.add(&parseResult{path: "skipped.bin", skipped: true})
+	s.add(&parseResult{path: "broken.go", err: errFileTimeout})
+	s.add(&parseResult{path: "slow.js", err: errFileTimeout, timedOut: true})
+
+	if s.ok != 1 || s.skipped != 1 || len(s.failures) != 1 || len(s.timeouts) != 1 {
+		t.Fatalf("unexpected summary: %+v", s)
+	}
+
+	if s.timeouts[0].path != "slow.js" {
+		t.Errorf("expected slow.js to time out, got %s", s.timeouts[0].path)
+	}
+
+	if !s.failed() {
+		t.Error("expected the summary to be failed")
+	}
+}
+
+func TestFileFilter(t *testing.T) {
+	f, err := newFileFilter([]string{"*.go", "cmd/*"}, []string{"vendor", "*_test.go"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	testCases := []struct {
+		path     string
+		expected bool
+	}{
+		{"main.go", true},
+		{"pkg/foo/bar.go", true},
+		{"pkg/foo/bar_test.go", false},
+		{"cmd/README", true},
+		{"pkg/README", false},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.path, func(t *testing.T) {
+			if result := f.match(tt.path); result != tt.expected {
+				t.Errorf("expected: %v, got: %v", tt.expected, result)
+			}
+		})
+	}
+
+	if !f.skipDir("pkg/vendor") {
+		t.Error("expected pkg/vendor to be skipped")
+	}
+
+	if f.skipDir("pkg") {
+		t.Error("expected pkg not to be skipped")
+	}
+}
+
+func TestFileFilterInvalid(t *testing.T) {
+	if _, err := newFileFilter([]string{"[a-"}, nil); err == nil {
+		t.Error("expected an error for an invalid pattern")
+	}
+}
+
+// fakeEngine parses the files by returning their content as the UAST, and
+// fails the ones with "fail" in their name.
+type fakeEngine struct {
+	api.EngineServer
+}
+
+func (fakeEngine) parse(req *api.ParseRequest) (*api.ParseResponse, error) {
+	if strings.Contains(req.Name, "fail") {
+		return nil, fmt.Errorf("could not parse %s", req.Name)
+	}
+
+	return &api.ParseResponse{
+		Kind: api.ParseResponse_FINAL,
+		Lang: req.Lang,
+		Uast: [][]byte{req.Content},
+	}, nil
+}
+
+func (e fakeEngine) ParseWithLogs(req *api.ParseRequest, stream api.Engine_ParseWithLogsServer) error {
+	resp, err := e.parse(req)
+	if err != nil {
+		return err
+	}
+	return stream.Send(resp)
+}
+
+func (e fakeEngine) ParseFiles(stream api.Engine_ParseFilesServer) error {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res := &api.ParseFilesResponse{Id: req.Id}
+			resp, err := e.parse(req.File)
+			if err != nil {
+				res.Code, res.Error = int32(codes.Unknown), err.Error()
+			} else {
+				res.Result = resp
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			stream.Send(res)
+		}()
+	}
+}
+
+// startFakeEngine serves fakeEngine on localhost and returns a client of it.
+func startFakeEngine(tb testing.TB) (api.EngineClient, func()) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	srv := grpc.NewServer()
+	api.RegisterEngineServer(srv, fakeEngine{})
+	go srv.Serve(lis)
+
+	conn, err := grpc.Dial(lis.Addr().String(), grpc.WithInsecure())
+	if err != nil {
+		srv.Stop()
+		tb.Fatal(err)
+	}
+
+	return api.NewEngineClient(conn), func() {
+		conn.Close()
+		srv.Stop()
+	}
+}
+
+// writeParseInputs writes n small Go files, failing the ones at the given
+// indexes.
+func writeParseInputs(tb testing.TB, n int, failing ...int) ([]parseInput, func()) {
+	dir, err := ioutil.TempDir("", "srcd-parse")
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	fails := make(map[int]bool)
+	for _, i := range failing {
+		fails[i] = true
+	}
+
+	inputs := make([]parseInput, n)
+	for i := range inputs {
+		name := fmt.Sprintf("file%d.go", i)
+		if fails[i] {
+			name = fmt.Sprintf("fail%d.go", i)
+		}
+
+		path := filepath.Join(dir, name)
+		content := fmt.Sprintf("package main\n\nconst n = %d\n", i)
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			os.RemoveAll(dir)
+			tb.Fatal(err)
+		}
+		inputs[i] = parseInput{path: path}
+	}
+	return inputs, func() { os.RemoveAll(dir) }
+}
+
+func TestFileParserStream(t *testing.T) {
+	client, stop := startFakeEngine(t)
+	defer stop()
+
+	inputs, remove := writeParseInputs(t, 50, 7, 31)
+	defer remove()
+
+	p := &fileParser{client: client, jobs: 4, lang: "go"}
+	var emitted []*parseResult
+	summary := p.parse(inputs, func(r *parseResult) { emitted = append(emitted, r) })
+
+	if len(emitted) != len(inputs) {
+		t.Fatalf("expected: %d results, got: %d", len(inputs), len(emitted))
+	}
+
+	for i, r := range emitted {
+		if r.index != i {
+			t.Fatalf("expected: result %d, got: %d", i, r.index)
+		}
+
+		failed := i == 7 || i == 31
+		if failed != (r.err != nil) {
+			t.Errorf("expected: failed %v for %s, got: %v", failed, r.path, r.err)
+		}
+
+		if !failed && !strings.Contains(string(r.uast[0]), fmt.Sprintf("n = %d", i)) {
+			t.Errorf("expected: the content of %s, got: %s", r.path, r.uast[0])
+		}
+	}
+
+	if summary.ok != 48 || len(summary.failures) != 2 {
+		t.Errorf("unexpected summary: %+v", summary)
+	}
+}
+
+// BenchmarkFileParser compares parsing a directory of small files with a
+// call per file and over a single stream.
+func BenchmarkFileParser(b *testing.B) {
+	client, stop := startFakeEngine(b)
+	defer stop()
+
+	inputs, remove := writeParseInputs(b, 2000)
+	defer remove()
+
+	p := &fileParser{client: client, jobs: defaultParseJobs(), lang: "go"}
+	benchmarks := []struct {
+		name  string
+		parse func([]parseInput, func(*parseResult)) *parseSummary
+	}{
+		{"unary", p.parseEach},
+		{"stream", p.parseStream},
+	}
+
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				summary := bm.parse(inputs, func(*parseResult) {})
+				if summary.ok != len(inputs) {
+					b.Fatalf("expected: %d parsed, got: %d", len(inputs), summary.ok)
+				}
+			}
+		})
+	}
+}
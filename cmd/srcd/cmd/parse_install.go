@@ -0,0 +1,205 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	api "github.com/src-d/engine/api"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// installPolicy decides what to do with files whose language has no driver
+// installed.
+type installPolicy int
+
+const (
+	// installPrompt asks the user once per language.
+	installPrompt installPolicy = iota
+	// installMissing installs the official driver without asking.
+	installMissing
+	// installNever skips the files.
+	installNever
+)
+
+// warnDriverPins warns about the installed drivers whose version differs from
+// the one pinned in the config file, as their UASTs may not be the expected.
+func warnDriverPins(c api.EngineClient, pins map[string]string) {
+	if len(pins) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	drivers, err := c.ListDrivers(ctx, &api.ListDriversRequest{})
+	if err != nil {
+		logrus.Warnf("could not check the pinned driver versions: %v", err)
+		return
+	}
+
+	for _, d := range drivers.Drivers {
+		pin, ok := pins[strings.ToLower(d.Lang)]
+		if ok && !sameVersion(pin, d.Version) {
+			logrus.Warnf("%s driver version %s is installed, but version %s is pinned", d.Lang, d.Version, pin)
+		}
+	}
+}
+
+// newInstallPolicy returns the policy for the --install-missing and
+// --no-install flags. Without any of them the user is asked only when there
+// is a terminal to answer, otherwise nothing is installed.
+func newInstallPolicy(install, noInstall bool) (installPolicy, error) {
+	switch {
+	case install && noInstall:
+		return 0, fmt.Errorf("--install-missing and --no-install can't be used together")
+	case install:
+		return installMissing, nil
+	case noInstall:
+		return installNever, nil
+	case isTerminal(os.Stdin) && isTerminal(os.Stderr):
+		return installPrompt, nil
+	default:
+		return installNever, nil
+	}
+}
+
+func isTerminal(f *os.File) bool {
+	return terminal.IsTerminal(int(f.Fd()))
+}
+
+// driverInstaller installs the missing drivers found while parsing following
+// an installPolicy. The decision is taken only once per language, even if
+// many files of that language are being parsed concurrently, and the files of
+// other languages keep being parsed while a driver is installed.
+type driverInstaller struct {
+	client api.EngineClient
+	policy installPolicy
+	pins   map[string]string
+	in     *bufio.Reader
+	out    io.Writer
+
+	mu        sync.Mutex
+	installed map[string]*driverInstall
+	// prompt is held while asking, so the questions of several languages
+	// are not mixed up in the terminal.
+	prompt sync.Mutex
+}
+
+// driverInstall is the decision taken for the driver of a language, and its
+// installation. done is closed once err is set.
+type driverInstall struct {
+	done chan struct{}
+	err  error
+}
+
+func newDriverInstaller(
+	client api.EngineClient,
+	policy installPolicy,
+	pins map[string]string,
+) *driverInstaller {
+	return &driverInstaller{
+		client:    client,
+		policy:    policy,
+		pins:      pins,
+		in:        bufio.NewReader(os.Stdin),
+		out:       os.Stderr,
+		installed: make(map[string]*driverInstall),
+	}
+}
+
+// errSkipDriver is recorded for the languages whose driver won't be installed.
+var errSkipDriver = fmt.Errorf("driver not installed")
+
+// ensure is called when the driver for the given language is not installed.
+// It returns whether the driver is installed now, so the file can be parsed,
+// or an error if the installation failed.
+func (i *driverInstaller) ensure(lang string) (bool, error) {
+	i.mu.Lock()
+	inst, ok := i.installed[lang]
+	if !ok {
+		inst = &driverInstall{done: make(chan struct{})}
+		i.installed[lang] = inst
+	}
+	i.mu.Unlock()
+
+	// The first file of the language installs it, the rest wait for it.
+	if ok {
+		<-inst.done
+	} else {
+		inst.err = i.install(lang)
+		close(inst.done)
+	}
+
+	err := inst.err
+	if err == errSkipDriver {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (i *driverInstaller) install(lang string) error {
+	switch i.policy {
+	case installNever:
+		logrus.Warnf("%s driver is not installed, skipping %s files", lang, lang)
+		return errSkipDriver
+	case installPrompt:
+		if !i.confirm(lang) {
+			logrus.Infof("skipping %s files", lang)
+			return errSkipDriver
+		}
+	}
+
+	version, err := driverVersion(lang, "", i.pins, false)
+	if err != nil {
+		return err
+	}
+
+	logrus.Infof("installing %s driver version %s", lang, version)
+
+	// Pulling the image of the driver can be quite slow.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	resp, err := i.client.InstallDriver(ctx, &api.VersionedDriver{Language: lang, Version: version})
+	if err != nil {
+		return fmt.Errorf("unable to install %s driver: %v", lang, err)
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"language": lang,
+		"image":    resp.Image,
+		"version":  resp.Version,
+	}).Info("installed driver")
+	return nil
+}
+
+func (i *driverInstaller) confirm(lang string) bool {
+	i.prompt.Lock()
+	defer i.prompt.Unlock()
+	return askYesNo(i.in, i.out,
+		fmt.Sprintf("%s driver is not installed, do you want to install it?", lang))
+}
+
+// askYesNo asks the question and reads the answer, which is no unless it's y
+// or yes.
+func askYesNo(in *bufio.Reader, out io.Writer, question string) bool {
+	fmt.Fprintf(out, "%s [y/N] ", question)
+	answer, err := in.ReadString('\n')
+	if err != nil && answer == "" {
+		return false
+	}
+
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	api "github.com/src-d/engine/api"
+	"google.golang.org/grpc"
+)
+
+// blockingInstaller is an engine client whose installs of the go driver block
+// until release is closed.
+type blockingInstaller struct {
+	api.EngineClient
+	release chan struct{}
+
+	mu    sync.Mutex
+	calls map[string]int
+}
+
+func (c *blockingInstaller) InstallDriver(ctx context.Context, in *api.VersionedDriver, opts ...grpc.CallOption) (*api.InstallDriverResponse, error) {
+	c.mu.Lock()
+	c.calls[in.Language]++
+	c.mu.Unlock()
+
+	if in.Language == "go" {
+		<-c.release
+	}
+	return &api.InstallDriverResponse{Version: in.Version}, nil
+}
+
+func TestDriverInstallerEnsure(t *testing.T) {
+	client := &blockingInstaller{release: make(chan struct{}), calls: make(map[string]int)}
+	i := newDriverInstaller(client, installMissing, nil)
+	i.in = bufio.NewReader(strings.NewReader(""))
+	i.out = ioutil.Discard
+
+	var wg sync.WaitGroup
+	for n := 0; n < 3; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if ok, err := i.ensure("go"); !ok || err != nil {
+				t.Errorf("expected: go installed, got: %v, %v", ok, err)
+			}
+		}()
+	}
+
+	// Another language is installed while the go driver is still pulled.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if ok, err := i.ensure("python"); !ok || err != nil {
+			t.Errorf("expected: python installed, got: %v, %v", ok, err)
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected: python installed without waiting for go")
+	}
+
+	close(client.release)
+	wg.Wait()
+
+	if client.calls["go"] != 1 || client.calls["python"] != 1 {
+		t.Errorf("expected: one install per language, got: %v", client.calls)
+	}
+}
+
+func TestDriverInstallerNever(t *testing.T) {
+	client := &blockingInstaller{calls: make(map[string]int)}
+	i := newDriverInstaller(client, installNever, nil)
+
+	for n := 0; n < 2; n++ {
+		if ok, err := i.ensure("go"); ok || err != nil {
+			t.Errorf("expected: go skipped, got: %v, %v", ok, err)
+		}
+	}
+
+	if len(client.calls) != 0 {
+		t.Errorf("expected: nothing installed, got: %v", client.calls)
+	}
+}
@@ -0,0 +1,245 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	api "github.com/src-d/engine/api"
+	"github.com/src-d/engine/cmd/srcd/daemon"
+	"gopkg.in/bblfsh/sdk.v1/manifest/discovery"
+	enry "gopkg.in/src-d/enry.v1"
+	"gopkg.in/src-d/enry.v1/data"
+)
+
+var parseLanguagesCmd = &cobra.Command{
+	Use:   "languages [path]",
+	Short: "List the languages that can be detected and parsed.",
+	Long: `List the languages that can be detected and parsed.
+
+Merges the languages known by the language detection (enry) with the drivers
+installed in bblfshd. Languages without an official bblfsh driver can only be
+detected, not parsed, and are marked as such.
+
+With --missing, the given path (the current directory by default) is scanned
+by file extension and only the languages found in it with an official driver
+that is not installed are listed, which is handy to know which drivers to
+install before parsing a big repository.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) > 1 {
+			return usageErrorf("invalid number of arguments given, expecting 0 or 1")
+		}
+
+		c, err := daemon.Client()
+		if err != nil {
+			return fmt.Errorf("could not get daemon client: %v", err)
+		}
+
+		// Might need to pull the image
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+		defer cancel()
+
+		drivers, err := c.ListDrivers(ctx, &api.ListDriversRequest{})
+		if err != nil {
+			return fmt.Errorf("could not list drivers: %v", err)
+		}
+
+		langs := mergeLanguages(drivers.Drivers, officialDriverLanguages())
+
+		if missing, _ := cmd.Flags().GetBool("missing"); missing {
+			root := "."
+			if len(args) > 0 {
+				root = args[0]
+			}
+
+			found, err := scanLanguages(root)
+			if err != nil {
+				return fmt.Errorf("could not scan %s: %v", root, err)
+			}
+
+			langs = missingLanguages(langs, found)
+		}
+
+		asJSON, _ := cmd.Flags().GetBool("json")
+		err = newRecordWriter(os.Stdout).write("language", langs, func(w io.Writer) error {
+			return printLanguages(w, langs, asJSON)
+		})
+		return err
+	},
+}
+
+func printLanguages(out io.Writer, langs []*languageInfo, asJSON bool) error {
+	if asJSON {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(langs)
+	}
+
+	w := new(tabwriter.Writer)
+	w.Init(out, 0, 8, 5, '\t', 0)
+	fmt.Fprintln(w, "LANGUAGE\tDETECTED-BY-ENRY\tDRIVER-INSTALLED\tDRIVER-VERSION\tFILES")
+	fmt.Fprintln(w, "----------\t----------\t----------\t----------\t----------")
+	for _, l := range langs {
+		installed := yesNo(l.DriverInstalled)
+		if l.DetectionOnly {
+			installed = "detection only"
+		}
+
+		files := "-"
+		if l.Files > 0 {
+			files = fmt.Sprint(l.Files)
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
+			l.Language, yesNo(l.DetectedByEnry), installed, l.DriverVersion, files)
+	}
+	return w.Flush()
+}
+
+// languageInfo describes what the engine can do with a language.
+type languageInfo struct {
+	Language        string `json:"language"`
+	DetectedByEnry  bool   `json:"detected_by_enry"`
+	DriverInstalled bool   `json:"driver_installed"`
+	DriverVersion   string `json:"driver_version"`
+	// DetectionOnly is true when there is no official driver for the language.
+	DetectionOnly bool `json:"detection_only"`
+	// Files is the number of files found with the language, only when
+	// scanning a directory.
+	Files int `json:"files,omitempty"`
+}
+
+// officialDriverLanguages returns the languages with an official driver, or
+// nil if they can't be retrieved.
+func officialDriverLanguages() map[string]bool {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	drivers, err := discovery.OfficialDrivers(ctx, &discovery.Options{
+		NamesOnly:     true,
+		NoMaintainers: true,
+	})
+	if err != nil {
+		logrus.Warnf("could not get the list of official drivers, detection only languages won't be marked: %v", err)
+		return nil
+	}
+
+	langs := make(map[string]bool, len(drivers))
+	for _, d := range drivers {
+		langs[strings.ToLower(d.Language)] = true
+	}
+	return langs
+}
+
+// mergeLanguages merges the languages known by enry with the installed
+// drivers. If official is nil, no language is marked as detection only.
+func mergeLanguages(
+	installed []*api.ListDriversResponse_DriverInfo,
+	official map[string]bool,
+) []*languageInfo {
+	byName := make(map[string]*languageInfo)
+	get := func(lang string) *languageInfo {
+		lang = strings.ToLower(lang)
+		l, ok := byName[lang]
+		if !ok {
+			l = &languageInfo{Language: lang}
+			byName[lang] = l
+		}
+		return l
+	}
+
+	for lang := range data.LanguagesType {
+		get(lang).DetectedByEnry = true
+	}
+
+	for _, d := range installed {
+		l := get(d.Lang)
+		l.DriverInstalled = true
+		l.DriverVersion = d.Version
+	}
+
+	var result []*languageInfo
+	for _, l := range byName {
+		l.DetectionOnly = official != nil && !official[l.Language] && !l.DriverInstalled
+		result = append(result, l)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Language < result[j].Language
+	})
+	return result
+}
+
+// missingLanguages returns the languages found in a directory that don't have
+// a driver installed, along with the number of files of each one. The ones
+// that can only be detected are left out, as there's no driver to install.
+func missingLanguages(langs []*languageInfo, found map[string]int) []*languageInfo {
+	var result []*languageInfo
+	for _, l := range langs {
+		n, ok := found[l.Language]
+		if !ok || l.DriverInstalled || l.DetectionOnly {
+			continue
+		}
+
+		l.Files = n
+		result = append(result, l)
+	}
+	return result
+}
+
+// scanLanguages walks the given directory and counts the files of each
+// language, detecting them only by file name and extension so it's fast even
+// on big repositories. Hidden directories are skipped.
+func scanLanguages(root string) (map[string]int, error) {
+	found := make(map[string]int)
+	err := filepath.Walk(root, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if path != root && strings.HasPrefix(fi.Name(), ".") {
+			if fi.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+
+		lang, _ := enry.GetLanguageByFilename(fi.Name())
+		if lang == "" {
+			lang, _ = enry.GetLanguageByExtension(fi.Name())
+		}
+
+		if lang != "" {
+			found[strings.ToLower(lang)]++
+		}
+		return nil
+	})
+	return found, err
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+func init() {
+	parseCmd.AddCommand(parseLanguagesCmd)
+
+	parseLanguagesCmd.Flags().Bool("json", false, "print the languages as JSON")
+	parseLanguagesCmd.Flags().Bool("missing", false, "only list languages found in the given path with an official driver not installed")
+}
@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	api "github.com/src-d/engine/api"
+)
+
+func TestMergeLanguages(t *testing.T) {
+	installed := []*api.ListDriversResponse_DriverInfo{
+		{Lang: "Go", Version: "v2.5.0"},
+		{Lang: "cobol", Version: "v0.1.0"},
+	}
+	official := map[string]bool{"go": true, "python": true}
+
+	testCases := []struct {
+		language string
+		expected languageInfo
+	}{
+		{"go", languageInfo{Language: "go", DetectedByEnry: true, DriverInstalled: true, DriverVersion: "v2.5.0"}},
+		{"python", languageInfo{Language: "python", DetectedByEnry: true}},
+		{"markdown", languageInfo{Language: "markdown", DetectedByEnry: true, DetectionOnly: true}},
+		{"cobol", languageInfo{Language: "cobol", DetectedByEnry: true, DriverInstalled: true, DriverVersion: "v0.1.0"}},
+	}
+
+	langs := mergeLanguages(installed, official)
+	byName := make(map[string]*languageInfo)
+	for i, l := range langs {
+		byName[l.Language] = l
+		if i > 0 && langs[i-1].Language >= l.Language {
+			t.Errorf("expected: languages sorted, got: %s before %s", langs[i-1].Language, l.Language)
+		}
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.language, func(t *testing.T) {
+			l, ok := byName[tc.language]
+			if !ok {
+				t.Fatalf("expected: %s listed, got: nothing", tc.language)
+			}
+			if *l != tc.expected {
+				t.Errorf("expected: %+v, got: %+v", tc.expected, *l)
+			}
+		})
+	}
+
+	for _, l := range mergeLanguages(installed, nil) {
+		if l.DetectionOnly {
+			t.Errorf("expected: no detection only languages without the official drivers, got: %s", l.Language)
+		}
+	}
+}
+
+func TestMissingLanguages(t *testing.T) {
+	langs := []*languageInfo{
+		{Language: "go", DriverInstalled: true},
+		{Language: "markdown", DetectionOnly: true},
+		{Language: "python"},
+		{Language: "ruby"},
+	}
+
+	testCases := []struct {
+		name     string
+		found    map[string]int
+		expected string
+	}{
+		{"nothing found", map[string]int{}, "[]"},
+		{"installed", map[string]int{"go": 3}, "[]"},
+		{"detection only", map[string]int{"markdown": 2}, "[]"},
+		{"missing", map[string]int{"go": 3, "markdown": 2, "python": 4}, "[python:4]"},
+		{"several missing", map[string]int{"python": 4, "ruby": 1}, "[python:4 ruby:1]"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var result []string
+			for _, l := range missingLanguages(langs, tc.found) {
+				result = append(result, fmt.Sprintf("%s:%d", l.Language, l.Files))
+			}
+
+			if s := fmt.Sprint(result); s != tc.expected {
+				t.Errorf("expected: %s, got: %s", tc.expected, s)
+			}
+		})
+	}
+}
+
+func TestScanLanguages(t *testing.T) {
+	dir, err := ioutil.TempDir("", "srcd-languages")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"main.go", "lib/util.go", "lib/tool.py", "Makefile", ".git/config.py"} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	found, err := scanLanguages(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "map[go:2 makefile:1 python:1]"
+	if s := fmt.Sprint(found); s != expected {
+		t.Errorf("expected: %s, got: %s", expected, s)
+	}
+}
@@ -0,0 +1,146 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// manifestName is the name of the manifest written in the --output-dir.
+const manifestName = "manifest.json"
+
+var outputExtensions = map[string]string{
+	encodingJSON:  ".uast.json",
+	encodingProto: ".uast.pb",
+	encodingYAML:  ".uast.yaml",
+}
+
+// createOutput creates a file to write results to. Existing files are only
+// overwritten if force is true.
+func createOutput(path string, force bool) (*os.File, error) {
+	flags := os.O_WRONLY | os.O_CREATE
+	if force {
+		flags |= os.O_TRUNC
+	} else {
+		flags |= os.O_EXCL
+	}
+
+	f, err := os.OpenFile(path, flags, 0644)
+	if os.IsExist(err) {
+		return nil, fmt.Errorf("%s already exists, use --force to overwrite it", path)
+	}
+	return f, err
+}
+
+// outputDir writes the results of every file to its own file, mirroring the
+// structure of the inputs under a root directory.
+type outputDir struct {
+	root      string
+	encoding  string
+	delimited bool
+	force     bool
+}
+
+// path returns where the result of the given input is written. The input
+// path is cleaned, so foo/../bar.go is bar.go, made relative to the root of
+// the filesystem if it's absolute, and stripped of the leading parent
+// directory elements left, so the result never escapes the root.
+func (o *outputDir) path(input string) string {
+	input = strings.TrimPrefix(input, filepath.VolumeName(input))
+	input = filepath.ToSlash(filepath.Clean(input))
+	input = strings.TrimLeft(input, "/")
+	for input == ".." || strings.HasPrefix(input, "../") {
+		input = strings.TrimPrefix(strings.TrimPrefix(input, ".."), "/")
+	}
+
+	return filepath.Join(o.root, filepath.FromSlash(input)) + outputExtensions[o.encoding]
+}
+
+// write writes the result to its file and returns its path.
+func (o *outputDir) write(r *parseResult, queryMode string) (string, error) {
+	path := o.path(r.path)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", errors.Wrapf(err, "could not create output directory for %s", r.path)
+	}
+
+	f, err := createOutput(path, o.force)
+	if err != nil {
+		return "", err
+	}
+
+	w, err := newUASTWriter(f, o.encoding, o.delimited)
+	if err == nil {
+		err = w.writeResult(r, queryMode)
+	}
+
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	if err != nil {
+		return "", errors.Wrapf(err, "could not write %s", path)
+	}
+	return path, nil
+}
+
+// Status of the files listed in the manifest.
+const (
+	manifestOK      = "ok"
+	manifestFailed  = "failed"
+	manifestTimeout = "timeout"
+	manifestSkipped = "skipped"
+)
+
+// parseManifest lists what happened to every input, so downstream tools can
+// find the outputs without guessing their paths.
+type parseManifest struct {
+	Files []manifestEntry `json:"files"`
+}
+
+type manifestEntry struct {
+	Input    string `json:"input"`
+	Output   string `json:"output,omitempty"`
+	Language string `json:"language,omitempty"`
+	Mode     string `json:"mode,omitempty"`
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+}
+
+func (m *parseManifest) add(r *parseResult, output string) {
+	e := manifestEntry{Input: r.path, Status: manifestOK}
+	switch {
+	case r.timedOut:
+		e.Status = manifestTimeout
+		e.Error = r.err.Error()
+	case r.err != nil:
+		e.Status = manifestFailed
+		e.Error = r.err.Error()
+	case r.skipped:
+		e.Status = manifestSkipped
+	default:
+		e.Output = output
+		e.Language = r.lang
+		e.Mode = modeName(r.mode)
+	}
+
+	m.Files = append(m.Files, e)
+}
+
+func (m *parseManifest) write(path string, force bool) error {
+	f, err := createOutput(path, force)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	err = enc.Encode(m)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOutputDirPath(t *testing.T) {
+	o := &outputDir{root: "out", encoding: encodingJSON}
+
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{"foo/bar.go", "out/foo/bar.go.uast.json"},
+		{"./foo/bar.go", "out/foo/bar.go.uast.json"},
+		{"/abs/foo.py", "out/abs/foo.py.uast.json"},
+		{"../../etc/passwd", "out/etc/passwd.uast.json"},
+		{"foo/../../bar.go", "out/bar.go.uast.json"},
+		{"foo/../bar.go", "out/bar.go.uast.json"},
+		{"foo/./baz/../bar.go", "out/foo/bar.go.uast.json"},
+		{"/../abs/foo.py", "out/abs/foo.py.uast.json"},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.input, func(t *testing.T) {
+			result := o.path(tt.input)
+			if result != filepath.FromSlash(tt.expected) {
+				t.Errorf("expected: %s, got: %s", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestCreateOutputForce(t *testing.T) {
+	dir, err := ioutil.TempDir("", "srcd-parse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "out.json")
+	if err := ioutil.WriteFile(path, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := createOutput(path, false); err == nil {
+		t.Fatal("expected an error overwriting without force")
+	}
+
+	f, err := createOutput(path, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	f.Close()
+
+	b, _ := ioutil.ReadFile(path)
+	if len(b) != 0 {
+		t.Errorf("expected the file to be truncated, got %q", b)
+	}
+}
@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Intervals between progress updates. Terminals are refreshed in place, so
+// they can be updated often, while other outputs, like CI logs, get a new line
+// every time.
+const (
+	progressTTYInterval   = 200 * time.Millisecond
+	progressPlainInterval = 10 * time.Second
+)
+
+// parseProgress reports the progress of a batch of files being parsed.
+type parseProgress struct {
+	w        io.Writer
+	tty      bool
+	total    int
+	interval time.Duration
+	start    time.Time
+
+	mu     sync.Mutex
+	done   int
+	failed int
+
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+// newParseProgress starts reporting the progress of parsing total files to w,
+// refreshing the line in place if it's a terminal.
+func newParseProgress(w io.Writer, tty bool, total int) *parseProgress {
+	p := &parseProgress{
+		w:        w,
+		tty:      tty,
+		total:    total,
+		interval: progressPlainInterval,
+		start:    time.Now(),
+		stop:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+
+	if tty {
+		p.interval = progressTTYInterval
+	}
+
+	go p.run()
+	return p
+}
+
+func (p *parseProgress) run() {
+	defer close(p.stopped)
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			p.print()
+		case <-p.stop:
+			if p.tty {
+				fmt.Fprint(p.w, "\r\033[K")
+			}
+			return
+		}
+	}
+}
+
+// add records a finished file.
+func (p *parseProgress) add(r *parseResult) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.done++
+	if r.err != nil {
+		p.failed++
+	}
+}
+
+// finish stops reporting and clears the progress line on terminals.
+func (p *parseProgress) finish() {
+	close(p.stop)
+	<-p.stopped
+}
+
+func (p *parseProgress) print() {
+	p.mu.Lock()
+	line := p.line(time.Since(p.start))
+	p.mu.Unlock()
+
+	if p.tty {
+		fmt.Fprintf(p.w, "\r\033[K%s", line)
+	} else {
+		fmt.Fprintln(p.w, line)
+	}
+}
+
+// line returns the progress after the given elapsed time: files completed,
+// throughput, failures and the estimated time remaining.
+func (p *parseProgress) line(elapsed time.Duration) string {
+	var percent int
+	if p.total > 0 {
+		percent = p.done * 100 / p.total
+	}
+
+	var rate float64
+	if elapsed > 0 {
+		rate = float64(p.done) / elapsed.Seconds()
+	}
+
+	eta := "unknown"
+	if rate > 0 {
+		remaining := time.Duration(float64(p.total-p.done) / rate * float64(time.Second))
+		eta = remaining.Round(time.Second).String()
+	}
+
+	return fmt.Sprintf("parsed %d/%d files (%d%%), %.1f files/s, %d failed, ETA %s",
+		p.done, p.total, percent, rate, p.failed, eta)
+}
@@ -0,0 +1,21 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseProgressLine(t *testing.T) {
+	p := &parseProgress{total: 100, done: 25, failed: 2}
+
+	expected := "parsed 25/100 files (25%), 5.0 files/s, 2 failed, ETA 15s"
+	if result := p.line(5 * time.Second); result != expected {
+		t.Errorf("expected: %s, got: %s", expected, result)
+	}
+
+	p.done, p.failed = 0, 0
+	expected = "parsed 0/100 files (0%), 0.0 files/s, 0 failed, ETA unknown"
+	if result := p.line(time.Second); result != expected {
+		t.Errorf("expected: %s, got: %s", expected, result)
+	}
+}
@@ -0,0 +1,137 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sync"
+)
+
+// Modes of the primary output of the commands, given with -o.
+const (
+	modeHuman = "human"
+	// modeJSON prints a JSON record per line, each one with a type so the
+	// records of a stream mixing them can be told apart.
+	modeJSON = "json"
+)
+
+// outputMode is the mode given with --output-mode.
+var outputMode = modeHuman
+
+func checkOutputMode(mode string) error {
+	switch mode {
+	case modeHuman, modeJSON:
+		return nil
+	default:
+		return fmt.Errorf("unknown output mode %s, it must be human or json", mode)
+	}
+}
+
+// machineOutput reports whether the output is for machines, with
+// --output-mode json. Spinners, colors and anything else meant for people are
+// left out then.
+func machineOutput() bool {
+	return outputMode == modeJSON
+}
+
+// decorated reports whether spinners and colors can be written to f: it's a
+// terminal and the output is for people.
+func decorated(f *os.File) bool {
+	return !machineOutput() && isTerminal(f)
+}
+
+// recordWriter is where commands write their primary output through, as
+// records of a type, like step or status.
+type recordWriter interface {
+	// write writes v as a record of the given type, or as records of it if
+	// it's a slice, one per item. For people, human is called instead, which
+	// can be nil for records only meant for machines.
+	write(typ string, v interface{}, human func(io.Writer) error) error
+}
+
+// newRecordWriter returns the record writer of the output mode writing to w.
+func newRecordWriter(w io.Writer) recordWriter {
+	if machineOutput() {
+		return &jsonRecordWriter{w: w}
+	}
+	return &humanRecordWriter{w: w}
+}
+
+type humanRecordWriter struct {
+	w io.Writer
+}
+
+func (r *humanRecordWriter) write(typ string, v interface{}, human func(io.Writer) error) error {
+	if human == nil {
+		return nil
+	}
+	return human(r.w)
+}
+
+// jsonRecordWriter writes every record as a line of JSON. It can be used by
+// several goroutines at once.
+type jsonRecordWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (r *jsonRecordWriter) write(typ string, v interface{}, human func(io.Writer) error) error {
+	items := []interface{}{v}
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Slice {
+		items = make([]interface{}, rv.Len())
+		for i := range items {
+			items[i] = rv.Index(i).Interface()
+		}
+	}
+
+	for _, item := range items {
+		b, err := json.Marshal(item)
+		if err != nil {
+			return err
+		}
+
+		record, err := typedRecord(typ, b)
+		if err != nil {
+			return err
+		}
+
+		r.mu.Lock()
+		_, err = r.w.Write(append(record, '\n'))
+		r.mu.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// typedRecord adds the type as the first field of the JSON object encoded, or
+// wraps anything else, like a string, in the value field of one.
+func typedRecord(typ string, encoded []byte) ([]byte, error) {
+	t, err := json.Marshal(typ)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(`{"type":`)
+	buf.Write(t)
+
+	encoded = bytes.TrimSpace(encoded)
+	switch {
+	case len(encoded) > 0 && encoded[0] == '{':
+		fields := bytes.TrimSpace(encoded[1:])
+		if len(fields) > 0 && fields[0] != '}' {
+			buf.WriteByte(',')
+		}
+		buf.Write(fields)
+	default:
+		buf.WriteString(`,"value":`)
+		buf.Write(encoded)
+		buf.WriteByte('}')
+	}
+	return buf.Bytes(), nil
+}
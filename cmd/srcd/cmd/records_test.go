@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestJSONRecordWriter(t *testing.T) {
+	type item struct {
+		Name string `json:"name"`
+	}
+
+	testCases := []struct {
+		name     string
+		v        interface{}
+		expected string
+	}{
+		{"object", item{"gitbase"}, `{"type":"test","name":"gitbase"}` + "\n"},
+		{"slice", []item{{"gitbase"}, {"bblfshd"}},
+			`{"type":"test","name":"gitbase"}` + "\n" + `{"type":"test","name":"bblfshd"}` + "\n"},
+		{"empty slice", []item{}, ""},
+		{"empty object", struct{}{}, `{"type":"test"}` + "\n"},
+		{"string", "0.0.1", `{"type":"test","value":"0.0.1"}` + "\n"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			r := &jsonRecordWriter{w: &buf}
+			err := r.write("test", tc.v, func(io.Writer) error {
+				return fmt.Errorf("human output written")
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if buf.String() != tc.expected {
+				t.Errorf("expected: %s, got: %s", tc.expected, buf.String())
+			}
+		})
+	}
+}
+
+func TestHumanRecordWriter(t *testing.T) {
+	var buf bytes.Buffer
+	r := &humanRecordWriter{w: &buf}
+	err := r.write("test", []string{"a"}, func(w io.Writer) error {
+		_, err := fmt.Fprintln(w, "for people")
+		return err
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := r.write("test", "only for machines", nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if expected := "for people\n"; buf.String() != expected {
+		t.Errorf("expected: %s, got: %s", expected, buf.String())
+	}
+}
+
+func TestOutputFormatMachineOutput(t *testing.T) {
+	defer func() { outputMode = modeHuman }()
+	outputMode = modeJSON
+
+	cmd := &cobra.Command{}
+	addOutputFlags(cmd, true)
+	out, err := outputFormat(cmd)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := out.print(&buf, "image", []string{"srcd/gitbase"}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := `{"type":"image","value":"srcd/gitbase"}` + "\n"; buf.String() != expected {
+		t.Errorf("expected: %s, got: %s", expected, buf.String())
+	}
+
+	cmd.Flags().Set("format", outputJSON)
+	if _, err := outputFormat(cmd); err == nil {
+		t.Errorf("expected error with --format and --output-mode json")
+	}
+}
+
+func TestOutputModeNotShadowed(t *testing.T) {
+	global := rootCmd.PersistentFlags().Lookup("output-mode")
+	if global == nil || global.Shorthand != "" {
+		t.Fatalf("expected: --output-mode without shorthand, got: %+v", global)
+	}
+
+	var visit func(c *cobra.Command)
+	visit = func(c *cobra.Command) {
+		if f := c.LocalNonPersistentFlags().Lookup(global.Name); f != nil {
+			t.Errorf("expected: --%s only as the global flag, got: a flag of %s", global.Name, c.CommandPath())
+		}
+		for _, sub := range c.Commands() {
+			visit(sub)
+		}
+	}
+	visit(rootCmd)
+}
@@ -0,0 +1,167 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/src-d/engine/cmd/srcd/daemon"
+	"github.com/src-d/engine/components"
+	"github.com/src-d/engine/docker"
+)
+
+var restartCmd = &cobra.Command{
+	Use:   "restart [component...]",
+	Short: "Restart the components, or only the given ones",
+	Long: `Restart the components, or only the given ones
+
+The components are stopped gracefully, like srcd stop does, and started again
+with the configuration of the last srcd init: the daemon, bblfshd, pilosa and
+gitbase, or only the given ones, waiting for gitbase to accept queries. Unlike
+srcd init, nothing is pulled and the repositories are not checked again. With
+--pull the images are updated first.
+
+The web clients are restarted by running srcd web again.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := daemon.Running()
+		if err != nil {
+			return err
+		}
+
+		if cfg == nil {
+			return notRunningErrorf("the engine is not initialized or its daemon was stopped, " +
+				"so its configuration is unknown; run srcd init to start it")
+		}
+
+		if _, err := os.Stat(cfg.Workdir); err != nil {
+			return fmt.Errorf("the working directory %s can't be found: %v; "+
+				"run srcd init with the new one", cfg.Workdir, err)
+		}
+
+		cmps, err := restartComponents(args, cfg)
+		if err != nil {
+			return err
+		}
+
+		var steps []initStep
+		if pull, _ := cmd.Flags().GetBool("pull"); pull {
+			steps = append(steps, initStep{
+				name: "pull images",
+				run:  func() error { return pullImages(cmps) },
+			})
+		}
+
+		steps = append(steps, restartSteps(cfg, cmps)...)
+
+		reporter := commandStepReporter()
+		if r, ok := reporter.(*ttyStepReporter); ok {
+			logrus.SetOutput(r)
+			defer logrus.SetOutput(os.Stderr)
+		}
+
+		return runSteps(reporter, steps)
+	},
+}
+
+// restartComponents returns the components with the given names in the order
+// they must be stopped, or the daemon and all the components started by init
+// that are enabled if none is given.
+func restartComponents(names []string, cfg *daemon.Config) ([]components.Component, error) {
+	cmps, err := stopComponents(names)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []components.Component
+	for _, c := range cmps {
+		switch {
+		case c.Name == components.Daemon.Name:
+		case isWebClient(c):
+			if len(names) > 0 {
+				return nil, fmt.Errorf("%s is started by srcd web, run it again to restart it", c.ShortName())
+			}
+			continue
+		case !cfg.Enabled(c.Name):
+			if len(names) > 0 {
+				return nil, disabledErrorf(c)
+			}
+			continue
+		}
+
+		result = append(result, c)
+	}
+	return result, nil
+}
+
+// restartSteps returns the steps to stop the components and start them again
+// with the configuration given, waiting for gitbase if it's restarted.
+func restartSteps(cfg *daemon.Config, cmps []components.Component) []initStep {
+	var steps []initStep
+	selected := make(map[string]bool)
+	for _, c := range cmps {
+		c := c
+		selected[c.Name] = true
+		steps = append(steps, initStep{
+			name: "stop " + c.ShortName(),
+			run: func() error {
+				err := stopComponent(c, gracePeriod(c))
+				if err == docker.ErrNotFound {
+					return nil
+				}
+				return err
+			},
+		})
+	}
+
+	if selected[components.Daemon.Name] {
+		steps = append(steps, initStep{
+			name: "start daemon",
+			run:  func() error { return daemon.Start(cfg) },
+			logs: func() ([]string, error) { return daemon.Logs(initLogLines) },
+		})
+	}
+
+	for _, c := range initComponentsOrder() {
+		if !selected[c.Name] {
+			continue
+		}
+
+		c := c
+		steps = append(steps, initStep{
+			name: "start " + c.ShortName(),
+			run:  func() error { return startComponent(c) },
+			logs: containerLogs(c.Name),
+		})
+	}
+
+	if selected[components.Gitbase.Name] {
+		steps = append(steps, initStep{
+			name: "wait for gitbase",
+			run:  waitForGitbase(cfg),
+			logs: containerLogs(components.Gitbase.Name),
+		})
+	}
+
+	return steps
+}
+
+// pullImages pulls the latest images of the components.
+func pullImages(cmps []components.Component) error {
+	for _, c := range cmps {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+		err := docker.Pull(ctx, c.ImageName(), c.Tag())
+		cancel()
+		if err != nil {
+			return fmt.Errorf("could not pull %s: %v", c.Ref(), err)
+		}
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(restartCmd)
+	restartCmd.Flags().Bool("pull", false, "pull the images of the components before starting them again")
+}
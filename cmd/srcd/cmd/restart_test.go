@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/src-d/engine/cmd/srcd/daemon"
+	"github.com/src-d/engine/components"
+)
+
+func TestRestartComponents(t *testing.T) {
+	all := &daemon.Config{}
+	noPilosa := &daemon.Config{Components: []string{
+		components.Bblfshd.Name,
+		components.Gitbase.Name,
+	}}
+
+	testCases := []struct {
+		name     string
+		names    []string
+		cfg      *daemon.Config
+		expected []string
+		err      bool
+	}{
+		{"all", nil, all, []string{"gitbase", "pilosa", "bblfshd", "daemon"}, false},
+		{"enabled", nil, noPilosa, []string{"gitbase", "bblfshd", "daemon"}, false},
+		{"given", []string{"bblfshd", "gitbase"}, all, []string{"gitbase", "bblfshd"}, false},
+		{"disabled", []string{"pilosa"}, noPilosa, nil, true},
+		{"web", []string{"web-sql"}, all, nil, true},
+		{"unknown", []string{"spark"}, all, nil, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cmps, err := restartComponents(tc.names, tc.cfg)
+			if tc.err {
+				if err == nil {
+					t.Errorf("expected error, got: %v", cmps)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var names []string
+			for _, c := range cmps {
+				names = append(names, c.ShortName())
+			}
+
+			if strings.Join(names, ",") != strings.Join(tc.expected, ",") {
+				t.Errorf("expected: %v, got: %v", tc.expected, names)
+			}
+		})
+	}
+}
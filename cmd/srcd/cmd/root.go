@@ -15,68 +15,298 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/src-d/engine/cmd/srcd/daemon"
+	"github.com/src-d/engine/components"
+	"github.com/src-d/engine/docker"
 
-	homedir "github.com/mitchellh/go-homedir"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
 var (
-	cfgFile string
-	verbose bool
+	cfgFile   string
+	verbosity int
+	quiet     bool
+	logFile   string
 )
 
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
 	Use:   "srcd",
 	Short: "The Code as Data solution by source{d}",
+	// The errors are printed by Execute, which exits with their code.
+	SilenceErrors: true,
+	SilenceUsage:  true,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if configErr != nil {
+			return configErr
+		}
+
+		startUpdateCheck(cmd)
+		askTelemetry(cmd)
+		startTelemetrySend(cmd)
+		return nil
+	},
+	PersistentPostRun: func(cmd *cobra.Command, args []string) {
+		printUpdateNotice()
+	},
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
-	if err := rootCmd.Execute(); err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+	markRunErrors(rootCmd)
+	start := time.Now()
+	cmd, err := rootCmd.ExecuteC()
+	if err == nil {
+		finishTelemetry(cmd, time.Since(start), exitOK)
+		return
+	}
+
+	// The errors not telling docker can't be reached, as the ones wrapped
+	// with fmt.Errorf, could be caused by it too.
+	code := exitCode(err)
+	if code == exitError || code == exitNotRunning {
+		if _, dockerErr := docker.Version(); dockerErr != nil {
+			code = exitDocker
+		}
+	}
+
+	finishTelemetry(cmd, time.Since(start), code)
+
+	switch {
+	case silent(err):
+	case cobraError(err):
+		fmt.Fprintf(os.Stderr, "Error: %v\nRun '%s --help' for usage.\n", err, cmd.CommandPath())
+	case daemon.FailedRequest() != "":
+		logrus.WithField("request_id", daemon.FailedRequest()).Error(err)
+	default:
+		logrus.Error(err)
 	}
+	os.Exit(code)
 }
 
 func init() {
 	cobra.OnInitialize(initConfig)
 
-	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.srcd.yaml)")
-	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "if true, log all of the things")
+	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.srcd/config.yml)")
+	rootCmd.PersistentFlags().CountVarP(&verbosity, "verbose", "v", "log what's done, -vv to log the calls to docker too")
+	rootCmd.PersistentFlags().BoolVar(&quiet, "quiet", false, "print only errors, warnings and the results, without progress or informational logs")
+	rootCmd.PersistentFlags().StringVar(&logFile, "log-file", "", "append all the logs to the file, whatever the verbosity")
+	rootCmd.PersistentFlags().StringVar(&outputMode, "output-mode", modeHuman, "output mode: human, or json for a JSON record per line with its type")
+	rootCmd.PersistentFlags().String("name", "", "name of the environment to use, with its own daemon and components; the default one if empty, see srcd env")
+	bindConfig("name", rootCmd.PersistentFlags().Lookup("name"), components.CheckEnvironmentName)
+
+	// The daemon is only served on a TCP port, that needs them, on Windows
+	// and remote docker hosts.
+	flags := rootCmd.PersistentFlags()
+	flags.Bool("daemon-tls", false, "serve the daemon with TLS when it's on a TCP port, with a self-signed certificate")
+	flags.String("daemon-token", "", "token of a daemon on a TCP port, if it's not the one in the data directory")
+	flags.String("daemon-cert-fingerprint", "", "SHA-256 fingerprint of the certificate of a daemon with TLS, if it's not the one in the data directory")
+	bindConfig("daemon.tls", flags.Lookup("daemon-tls"))
+	bindSecretConfig("daemon.token", flags.Lookup("daemon-token"))
+	bindConfig("daemon.cert-fingerprint", flags.Lookup("daemon-cert-fingerprint"))
+	flags.Int("daemon-port", 0, "port of the host to publish the daemon on when it's on a TCP port; 4242, or a free one if it's taken, if 0")
+	bindConfig("daemon.port", flags.Lookup("daemon-port"), checkOptionalPort)
+
+	flags.String("daemon-metrics-address", "", "address of the host to publish the metrics of the daemon on, like 9090 for localhost; disabled if empty")
+	bindConfig("daemon.metrics-address", flags.Lookup("daemon-metrics-address"), checkMetricsAddress)
+
+	flags.String("daemon-log-level", "", "level of the logs of the daemon when it's created: debug, info, warning or error; debug with -v")
+	flags.String("daemon-log-format", "text", "format of the logs of the daemon: text, or json for log collectors")
+	bindConfig("daemon.log-level", flags.Lookup("daemon-log-level"), checkLogLevel)
+	bindConfig("daemon.log-format", flags.Lookup("daemon-log-format"), checkLogFormat)
+
+	flags.Duration("daemon-health-interval", 15*time.Second, "how often the daemon probes gitbase and bblfshd for its health checks, at least 1s")
+	flags.Duration("daemon-health-timeout", 5*time.Second, "how long every probe of the health checks of the daemon can take")
+	bindConfig("daemon.health-interval", flags.Lookup("daemon-health-interval"), checkHealthInterval)
+	bindConfig("daemon.health-timeout", flags.Lookup("daemon-health-timeout"), checkPositiveDuration)
+
+	flags.Duration("daemon-drain-timeout", 20*time.Second, "how long the daemon gives the calls in flight to finish when it's stopped")
+	bindConfig("daemon.drain-timeout", flags.Lookup("daemon-drain-timeout"), checkPositiveDuration)
+
+	flags.Bool("require-native", false, "fail instead of pulling and running the images for amd64, emulated, when a component has none for the platform of docker")
+	bindConfig("require-native", flags.Lookup("require-native"))
+
+	flags.String("platform", "", "platform to pull and run the images for instead of the one of docker, linux/amd64 or linux/arm64, for all the components or like bblfshd=linux/amd64 for one, separated by commas")
+	bindConfig("platform", flags.Lookup("platform"), checkPlatforms)
+
+	flags.String("http-proxy", "", "proxy of the requests of the engine to Docker Hub and GitHub, like http://proxy:3128; the one of HTTPS_PROXY if empty")
+	flags.String("ca-bundle", "", "file with the certificates in PEM of the CAs to trust along with the ones of the system, like the one of a proxy intercepting TLS")
+	bindConfig("http.proxy", flags.Lookup("http-proxy"), checkProxy)
+	bindConfig("http.ca-bundle", flags.Lookup("ca-bundle"))
+
+	flags.String("registry-mirror", "", "registry with the path the images of Docker Hub are mirrored under, like registry.corp/dockerhub, to pull them from")
+	bindConfig("registry-mirror", flags.Lookup("registry-mirror"), checkRegistryMirror)
+
+	flags.BoolVar(&daemon.NoRefresh, "no-daemon-refresh", false, "don't recreate the daemon when it's incompatible with the CLI, to debug it")
+	flags.BoolVar(&daemon.NoRetry, "no-daemon-retry", false, "don't retry the calls to the daemon when it's unavailable, to debug it")
 }
 
+// configErr is the error found by initConfig, returned before running any
+// command.
+var configErr error
+
 // initConfig reads in config file and ENV variables if set.
 func initConfig() {
-	if cfgFile != "" {
-		// Use config file from the flag.
-		viper.SetConfigFile(cfgFile)
-	} else {
-		// Find home directory.
-		home, err := homedir.Dir()
-		if err != nil {
-			fmt.Println(err)
-			os.Exit(1)
+	if configErr = readConfig(); configErr != nil {
+		configErr = &codedError{exitUsage, configErr}
+	}
+}
+
+func readConfig() error {
+	// read in environment variables that match, like SRCD_BBLFSH_MEMORY
+	viper.SetEnvPrefix(envPrefix)
+	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_", "-", "_"))
+	viper.AutomaticEnv()
+
+	// SRCD_OUTPUT_MODE sets the output mode of every command, as in CI.
+	if mode := viper.GetString("output-mode"); mode != "" && !rootCmd.PersistentFlags().Changed("output-mode") {
+		outputMode = mode
+	}
+
+	if err := checkOutputMode(outputMode); err != nil {
+		return err
+	}
+
+	// SRCD_QUIET makes every command quiet, as in CI.
+	if !quiet {
+		quiet = viper.GetBool("quiet")
+	}
+
+	// SRCD_NO_DAEMON_REFRESH keeps the daemons incompatible with the CLI.
+	if !daemon.NoRefresh {
+		daemon.NoRefresh = viper.GetBool("no-daemon-refresh")
+	}
+
+	// SRCD_NO_DAEMON_RETRY makes the calls fail as soon as the daemon is
+	// unavailable.
+	if !daemon.NoRetry {
+		daemon.NoRetry = viper.GetBool("no-daemon-retry")
+	}
+
+	if quiet && verbosity > 0 {
+		return errors.New("--quiet and --verbose can't be used together")
+	}
+
+	if err := setupLogging(verbosity, quiet, logFile); err != nil {
+		return err
+	}
+
+	path := cfgFile
+	if path == "" {
+		var err error
+		if path, err = defaultConfigFile(); err != nil {
+			return err
 		}
+	}
+
+	if err := readConfigFile(path, cfgFile != ""); err != nil {
+		return err
+	}
+
+	if err := checkSettings(); err != nil {
+		return err
+	}
+
+	// The components are renamed before anything uses them, as their
+	// images are replaced by name.
+	if err := components.SetEnvironment(viper.GetString("name")); err != nil {
+		return err
+	}
+
+	overrides, err := imageOverrides()
+	if err != nil {
+		return err
+	}
+	components.SetOverrides(overrides)
+
+	pins, err := versionPins()
+	if err != nil {
+		return err
+	}
+	components.SetPins(pins)
+
+	// The daemon created is given them too, for the components it creates.
+	platforms, err := components.ParsePlatforms(stringSliceSetting("platform"))
+	if err != nil {
+		return fmt.Errorf("invalid platform: %v", err)
+	}
+	components.SetPlatforms(platforms)
 
-		// Search config in home directory with name ".srcd" (without extension).
-		viper.AddConfigPath(home)
-		viper.SetConfigName(".srcd")
+	if configValues != nil {
+		logrus.Debugf("using config file: %s", path)
 	}
 
-	if verbose {
-		logrus.SetLevel(logrus.DebugLevel)
+	daemon.DataDir = viper.GetString("data-dir")
+	if daemon.DataDir == "" {
+		daemon.DataDir = daemon.RecordedDataDir()
 	}
+	daemon.Auth = daemon.AuthOptions{
+		TLS:             viper.GetBool("daemon.tls"),
+		Token:           viper.GetString("daemon.token"),
+		CertFingerprint: viper.GetString("daemon.cert-fingerprint"),
+	}
+
+	daemon.Port = viper.GetInt("daemon.port")
+	if err := checkOptionalPort(strconv.Itoa(daemon.Port)); err != nil {
+		return fmt.Errorf("invalid daemon.port: %v", err)
+	}
+
+	// -v makes the daemon log at debug level whatever the configuration.
+	if daemon.LogLevel == "" {
+		daemon.LogLevel = viper.GetString("daemon.log-level")
+	}
+	daemon.LogFormat = viper.GetString("daemon.log-format")
 
-	viper.AutomaticEnv() // read in environment variables that match
+	daemon.MetricsAddress, err = daemon.ParseMetricsAddress(viper.GetString("daemon.metrics-address"))
+	if err != nil {
+		return fmt.Errorf("invalid daemon.metrics-address: %v", err)
+	}
+
+	daemon.Probes = daemon.ProbeOptions{
+		Interval: viper.GetDuration("daemon.health-interval"),
+		Timeout:  viper.GetDuration("daemon.health-timeout"),
+	}
+	if err := checkHealthInterval(daemon.Probes.Interval.String()); err != nil {
+		return fmt.Errorf("invalid daemon.health-interval: %v", err)
+	}
+	if err := checkPositiveDuration(daemon.Probes.Timeout.String()); err != nil {
+		return fmt.Errorf("invalid daemon.health-timeout: %v", err)
+	}
+
+	// The daemon created is given it too, for the images it pulls.
+	docker.RequireNative = viper.GetBool("require-native")
+
+	// The daemon created is given them too, for the discovery of the drivers.
+	var caCerts []byte
+	if path := viper.GetString("http.ca-bundle"); path != "" {
+		if caCerts, err = ioutil.ReadFile(path); err != nil {
+			return fmt.Errorf("invalid http.ca-bundle: %v", err)
+		}
+	}
+	if err := docker.ConfigureHTTP(viper.GetString("http.proxy"), caCerts); err != nil {
+		return fmt.Errorf("invalid http settings: %v", err)
+	}
+
+	// The daemon created is given it too, with its credentials, for the
+	// images and drivers it pulls.
+	if err := docker.ConfigureMirror(viper.GetString("registry-mirror"), ""); err != nil {
+		return fmt.Errorf("invalid registry-mirror: %v", err)
+	}
 
-	// If a config file is found, read it in.
-	if err := viper.ReadInConfig(); err == nil {
-		fmt.Println("Using config file:", viper.ConfigFileUsed())
+	daemon.DrainTimeout = viper.GetDuration("daemon.drain-timeout")
+	if err := checkPositiveDuration(daemon.DrainTimeout.String()); err != nil {
+		return fmt.Errorf("invalid daemon.drain-timeout: %v", err)
 	}
+	return nil
 }
@@ -16,10 +16,10 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
 	"io"
-	"log"
 	"os"
 	"strings"
 	"time"
@@ -29,6 +29,8 @@ import (
 	"github.com/spf13/cobra"
 	"github.com/src-d/engine/api"
 	"github.com/src-d/engine/cmd/srcd/daemon"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 // sqlCmd represents the sql command
@@ -37,7 +39,7 @@ var sqlCmd = &cobra.Command{
 	Short: "Run a SQL query over the analyzed repositories.",
 	RunE: func(cmd *cobra.Command, args []string) error {
 		if len(args) > 1 {
-			return fmt.Errorf("two many arguments, expected only one query or nothing")
+			return usageErrorf("two many arguments, expected only one query or nothing")
 		}
 
 		var query string
@@ -47,14 +49,11 @@ var sqlCmd = &cobra.Command{
 
 		if strings.TrimSpace(query) == "" {
 			if err := repl(); err != nil {
-				log.Fatal(err)
+				return err
 			}
 		}
 
-		if err := runQuery(query); err != nil {
-			log.Fatal(err)
-		}
-		return nil
+		return runQuery(query)
 	},
 }
 
@@ -77,7 +76,7 @@ func repl() error {
 			line, err := rl.Readline()
 			if err != nil {
 				if err != io.EOF {
-					log.Fatalf("could not read line: %v", err)
+					return fmt.Errorf("could not read line: %v", err)
 				}
 				return nil
 			}
@@ -116,8 +115,7 @@ func runQuery(query string) error {
 
 	res, err := c.SQL(ctx, &api.SQLRequest{Query: query})
 	if err != nil {
-		// TODO(erizocosmico): extract the actual error from the transport
-		return err
+		return sqlError(err)
 	}
 
 	writer := tablewriter.NewWriter(os.Stdout)
@@ -131,6 +129,17 @@ func runQuery(query string) error {
 	return nil
 }
 
+// sqlError returns the error of a query that failed. The ones exceeding the
+// query timeout of gitbase are shown with only their message, like query
+// exceeded the server limit of 10m.
+func sqlError(err error) error {
+	// TODO(erizocosmico): extract the actual error from the transport
+	if s, ok := status.FromError(err); ok && s.Code() == codes.DeadlineExceeded {
+		return operationFailed(errors.New(s.Message()))
+	}
+	return err
+}
+
 func init() {
 	rootCmd.AddCommand(sqlCmd)
 }
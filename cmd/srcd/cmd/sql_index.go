@@ -0,0 +1,542 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/src-d/engine/api"
+	"github.com/src-d/engine/cmd/srcd/daemon"
+	"github.com/src-d/engine/components"
+	"github.com/src-d/engine/docker"
+)
+
+const (
+	// indexDriver is the driver of the indexes created, the only one of
+	// gitbase.
+	indexDriver = "pilosa"
+	// indexPollInterval is how often the progress of an index being built is
+	// checked.
+	indexPollInterval = time.Second
+	// indexQueryTimeout is how long every statement about the indexes can
+	// take.
+	indexQueryTimeout = time.Minute
+)
+
+var sqlIndexCmd = &cobra.Command{
+	Use:   "index",
+	Short: "Manage the indexes of gitbase",
+	Long: `Manage the indexes of gitbase
+
+Indexes are kept by pilosa and speed up a lot the queries filtering by the
+columns indexed, like the language of the files. Building them takes a long
+time for big working directories, they are built in the background by
+gitbase.`,
+}
+
+var sqlIndexCreateCmd = &cobra.Command{
+	Use:   "create <table> <column>...",
+	Short: "Create an index and wait for it to be built",
+	Long: `Create an index and wait for it to be built
+
+Creates an index of the given columns of a table of gitbase, like
+srcd sql index create files language, named after them unless --index-name
+is given. The progress is printed until it's built, unless --no-wait is given,
+and it fails if gitbase stops building it, like when pilosa is stopped. It
+fails at once if the daemon reports pilosa is not healthy.`,
+	Args: cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		table, columns := args[0], args[1:]
+		name, _ := cmd.Flags().GetString("index-name")
+		if name == "" {
+			name = defaultIndexName(table, columns)
+		}
+
+		c, err := daemon.Client()
+		if err != nil {
+			return fmt.Errorf("could not get daemon client: %v", err)
+		}
+
+		if err := checkPilosaServing(); err != nil {
+			return fmt.Errorf("could not create the index %s: %v", name, err)
+		}
+
+		if err := runIndexQuery(c, createIndexQuery(name, table, columns)); err != nil {
+			return fmt.Errorf("could not create the index %s: %v", name, err)
+		}
+
+		if noWait, _ := cmd.Flags().GetBool("no-wait"); noWait {
+			logrus.Infof("index %s is being built, see srcd sql index list", name)
+			return nil
+		}
+
+		var progress func(string, time.Duration)
+		if !quiet && !machineOutput() {
+			progress = indexProgressPrinter(os.Stderr, isTerminal(os.Stderr), name)
+		}
+
+		start := time.Now()
+		if err := waitIndex(c, name, table, progress); err != nil {
+			return err
+		}
+
+		logrus.Infof("index %s built in %s", name, time.Since(start).Round(time.Second))
+		return nil
+	},
+}
+
+var sqlIndexListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the indexes with their state and size",
+	Long: `List the indexes with their state and size
+
+Shows every index of gitbase with its table, its columns, whether it's ready
+or still being built, with its progress, and the disk space of its files in
+the data directory.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		out, err := outputFormat(cmd)
+		if err != nil {
+			return err
+		}
+
+		c, err := daemon.Client()
+		if err != nil {
+			return fmt.Errorf("could not get daemon client: %v", err)
+		}
+
+		indexes, err := listIndexes(c)
+		if err != nil {
+			return err
+		}
+
+		setIndexSizes(indexes)
+		return out.print(os.Stdout, "index", indexes, func(w io.Writer) error {
+			return printIndexes(w, indexes)
+		})
+	},
+}
+
+var sqlIndexDeleteCmd = &cobra.Command{
+	Use:   "delete <name>",
+	Short: "Delete an index",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+		c, err := daemon.Client()
+		if err != nil {
+			return fmt.Errorf("could not get daemon client: %v", err)
+		}
+
+		indexes, err := listIndexes(c)
+		if err != nil {
+			return err
+		}
+
+		idx := findIndex(indexes, name)
+		if idx == nil {
+			return fmt.Errorf("unknown index %s, see srcd sql index list", name)
+		}
+
+		query := fmt.Sprintf("DROP INDEX %s ON %s", quoteIdentifier(idx.Name), quoteIdentifier(idx.Table))
+		if err := runIndexQuery(c, query); err != nil {
+			return fmt.Errorf("could not delete the index %s: %v", name, err)
+		}
+
+		logrus.Infof("index %s deleted", name)
+		return nil
+	},
+}
+
+// Index states.
+const (
+	indexReady    = "ready"
+	indexBuilding = "building"
+)
+
+// sqlIndex is an index of gitbase.
+type sqlIndex struct {
+	Name    string   `json:"name"`
+	Table   string   `json:"table"`
+	Columns []string `json:"columns"`
+	Driver  string   `json:"driver"`
+	// State is ready, or building while gitbase builds it, with the
+	// progress reported by it.
+	State    string `json:"state"`
+	Progress string `json:"progress,omitempty"`
+	// Size is the disk space of its files in the data directory in bytes,
+	// nil if it's not known, like when the daemon is on another machine.
+	Size *int64 `json:"size"`
+}
+
+// defaultIndexName returns the name of an index of the given columns when
+// none is given, like files_language_idx.
+func defaultIndexName(table string, columns []string) string {
+	parts := append([]string{table}, columns...)
+	name := strings.Join(parts, "_") + "_idx"
+	return regexp.MustCompile(`[^a-zA-Z0-9_]+`).ReplaceAllString(name, "_")
+}
+
+// createIndexQuery returns the statement creating an index. The columns are
+// not quoted, as they can be expressions, like language(file_path).
+func createIndexQuery(name, table string, columns []string) string {
+	return fmt.Sprintf("CREATE INDEX %s ON %s USING %s (%s) WITH (async = true)",
+		quoteIdentifier(name), quoteIdentifier(table), indexDriver, strings.Join(columns, ", "))
+}
+
+func quoteIdentifier(name string) string {
+	return "`" + strings.Replace(name, "`", "``", -1) + "`"
+}
+
+func runIndexQuery(c api.EngineClient, query string) error {
+	_, err := indexQuery(c, query)
+	return err
+}
+
+func indexQuery(c api.EngineClient, query string) (*api.SQLResponse, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), indexQueryTimeout)
+	defer cancel()
+
+	return c.SQL(ctx, &api.SQLRequest{Query: query})
+}
+
+// sqlColumn returns the position of the column with the given name in the
+// results of a query, or -1 if there's none.
+func sqlColumn(res *api.SQLResponse, name string) int {
+	if res.Header == nil {
+		return -1
+	}
+
+	for i, c := range res.Header.Cell {
+		if strings.EqualFold(c, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// sqlCell returns the value of the given column of a row, or an empty string
+// if it doesn't have it.
+func sqlCell(row *api.SQLResponse_Row, i int) string {
+	if row == nil || i < 0 || i >= len(row.Cell) {
+		return ""
+	}
+	return row.Cell[i]
+}
+
+// listIndexes returns the indexes of all the tables of gitbase, sorted by
+// name, with the progress of the ones being built.
+func listIndexes(c api.EngineClient) ([]*sqlIndex, error) {
+	tables, err := indexQuery(c, "SHOW TABLES")
+	if err != nil {
+		return nil, fmt.Errorf("could not list the tables: %v", err)
+	}
+
+	indexes := []*sqlIndex{}
+	for _, row := range tables.Rows {
+		table := sqlCell(row, 0)
+		res, err := indexQuery(c, "SHOW INDEXES FROM "+quoteIdentifier(table))
+		if err != nil {
+			return nil, fmt.Errorf("could not list the indexes of %s: %v", table, err)
+		}
+		indexes = append(indexes, parseIndexes(table, res)...)
+	}
+
+	building, err := buildingIndexes(c)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, idx := range indexes {
+		idx.State = indexReady
+		if progress, ok := building[idx.Name]; ok {
+			idx.State = indexBuilding
+			idx.Progress = progress
+		}
+	}
+
+	sort.Slice(indexes, func(i, j int) bool { return indexes[i].Name < indexes[j].Name })
+	return indexes, nil
+}
+
+// parseIndexes returns the indexes of the results of SHOW INDEXES, which
+// have a row for every column of every index.
+func parseIndexes(table string, res *api.SQLResponse) []*sqlIndex {
+	name := sqlColumn(res, "Key_name")
+	column := sqlColumn(res, "Column_name")
+	expression := sqlColumn(res, "Expression")
+	driver := sqlColumn(res, "Index_type")
+
+	var indexes []*sqlIndex
+	byName := make(map[string]*sqlIndex)
+	for _, row := range res.Rows {
+		n := sqlCell(row, name)
+		idx, ok := byName[n]
+		if !ok {
+			idx = &sqlIndex{Name: n, Table: table, Driver: sqlCell(row, driver)}
+			byName[n] = idx
+			indexes = append(indexes, idx)
+		}
+
+		col := sqlCell(row, column)
+		if col == "" || strings.EqualFold(col, "NULL") {
+			col = sqlCell(row, expression)
+		}
+		idx.Columns = append(idx.Columns, col)
+	}
+	return indexes
+}
+
+// indexProcess is the command of the processes of gitbase building indexes.
+const indexProcess = "create_index"
+
+// buildingIndexes returns the progress of the indexes being built by name,
+// from the processes of gitbase.
+func buildingIndexes(c api.EngineClient) (map[string]string, error) {
+	res, err := indexQuery(c, "SHOW PROCESSLIST")
+	if err != nil {
+		return nil, fmt.Errorf("could not get the processes of gitbase: %v", err)
+	}
+	return parseBuildingIndexes(res), nil
+}
+
+// createIndexName matches the name of the index in the statements creating
+// one, which are the info of their processes.
+var createIndexName = regexp.MustCompile("(?i)^\\s*CREATE\\s+INDEX\\s+`?([^`\\s]+)`?")
+
+func parseBuildingIndexes(res *api.SQLResponse) map[string]string {
+	command := sqlColumn(res, "Command")
+	state := sqlColumn(res, "State")
+	info := sqlColumn(res, "Info")
+
+	building := make(map[string]string)
+	for _, row := range res.Rows {
+		if !strings.EqualFold(sqlCell(row, command), indexProcess) {
+			continue
+		}
+
+		m := createIndexName.FindStringSubmatch(sqlCell(row, info))
+		if m == nil {
+			continue
+		}
+		building[m[1]] = sqlCell(row, state)
+	}
+	return building
+}
+
+// indexPartProgress matches the progress of every part of an index being
+// built, like repositories (3/10), with ? as the total if it's not known.
+var indexPartProgress = regexp.MustCompile(`\((\d+)/(\d+|\?)\)`)
+
+// indexPercent returns the percentage of the index built from its progress,
+// or -1 if it's not known.
+func indexPercent(progress string) int {
+	var done, total int64
+	for _, m := range indexPartProgress.FindAllStringSubmatch(progress, -1) {
+		if m[2] == "?" {
+			return -1
+		}
+
+		d, _ := strconv.ParseInt(m[1], 10, 64)
+		t, _ := strconv.ParseInt(m[2], 10, 64)
+		done += d
+		total += t
+	}
+
+	if total == 0 {
+		return -1
+	}
+	return int(done * 100 / total)
+}
+
+// waitIndex waits for the index with the given name of the table to be
+// built, calling progress with its progress every time it's checked. It fails
+// if gitbase stops building it without the index, or if gitbase or pilosa
+// stop.
+func waitIndex(c api.EngineClient, name, table string, progress func(string, time.Duration)) error {
+	start := time.Now()
+	for {
+		building, err := buildingIndexes(c)
+		if err != nil {
+			return fmt.Errorf("could not get the progress of the index %s: %v", name, err)
+		}
+
+		state, ok := building[name]
+		if !ok {
+			break
+		}
+
+		for _, cmp := range []components.Component{components.Pilosa, components.Gitbase} {
+			if running, err := docker.IsRunning(cmp.Name); err == nil && !running {
+				return fmt.Errorf("%s stopped while the index %s was being built, see srcd logs %s",
+					cmp.ShortName(), name, cmp.ShortName())
+			}
+		}
+
+		if progress != nil {
+			progress(state, time.Since(start))
+		}
+		time.Sleep(indexPollInterval)
+	}
+
+	if progress != nil {
+		progress("", 0)
+	}
+
+	res, err := indexQuery(c, "SHOW INDEXES FROM "+quoteIdentifier(table))
+	if err != nil {
+		return fmt.Errorf("could not check the index %s: %v", name, err)
+	}
+
+	if findIndex(parseIndexes(table, res), name) == nil {
+		return fmt.Errorf("gitbase stopped building the index %s without creating it, "+
+			"as it happens when pilosa is not available, see srcd logs gitbase", name)
+	}
+	return nil
+}
+
+func findIndex(indexes []*sqlIndex, name string) *sqlIndex {
+	for _, idx := range indexes {
+		if idx.Name == name {
+			return idx
+		}
+	}
+	return nil
+}
+
+// indexProgressPrinter returns the function printing the progress of the
+// index with the given name, refreshing the line in place on terminals, and
+// with a line every few seconds otherwise. The line is cleared when it's
+// called with an empty progress.
+func indexProgressPrinter(w io.Writer, tty bool, name string) func(string, time.Duration) {
+	interval := progressPlainInterval
+	if tty {
+		interval = progressTTYInterval
+	}
+
+	var last time.Time
+	return func(progress string, elapsed time.Duration) {
+		if progress == "" {
+			if tty {
+				fmt.Fprint(w, "\r\033[K")
+			}
+			return
+		}
+
+		if time.Since(last) < interval {
+			return
+		}
+		last = time.Now()
+
+		line := indexProgressLine(name, progress, elapsed)
+		if tty {
+			fmt.Fprintf(w, "\r\033[K%s", line)
+		} else {
+			fmt.Fprintln(w, line)
+		}
+	}
+}
+
+func indexProgressLine(name, progress string, elapsed time.Duration) string {
+	line := fmt.Sprintf("building index %s", name)
+	if percent := indexPercent(progress); percent >= 0 {
+		line += fmt.Sprintf(" (%d%%)", percent)
+	}
+	if progress != "" {
+		line += ": " + progress
+	}
+	return fmt.Sprintf("%s, %s elapsed", line, elapsed.Round(time.Second))
+}
+
+// setIndexSizes sets the size of the indexes from their files in the data
+// directory, when the daemon keeps it on this machine.
+func setIndexSizes(indexes []*sqlIndex) {
+	cfg, err := daemon.Running()
+	if err != nil || cfg == nil {
+		return
+	}
+
+	dir, err := cfg.IndexDirectory()
+	if err != nil {
+		logrus.Debugf("could not get the directory of the indexes: %v", err)
+		return
+	}
+
+	for _, idx := range indexes {
+		// The pilosa driver keeps every index in a directory by database
+		// and table.
+		path := filepath.Join(dir, idx.Driver, "gitbase", idx.Table, idx.Name)
+		size, err := directorySize(path)
+		if err != nil {
+			logrus.Debugf("could not get the size of the index %s: %v", idx.Name, err)
+			continue
+		}
+		idx.Size = &size
+	}
+}
+
+// directorySize returns the size of the files in the given directory.
+func directorySize(dir string) (int64, error) {
+	var size int64
+	err := filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if fi.Mode().IsRegular() {
+			size += fi.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
+func printIndexes(w io.Writer, indexes []*sqlIndex) error {
+	if len(indexes) == 0 {
+		_, err := fmt.Fprintln(w, "no indexes, create one with srcd sql index create")
+		return err
+	}
+
+	tw := new(tabwriter.Writer)
+	tw.Init(w, 0, 8, 5, '\t', 0)
+	fmt.Fprintln(tw, "NAME\tTABLE\tCOLUMNS\tSTATE\tSIZE")
+	fmt.Fprintln(tw, "----------\t----------\t----------\t----------\t----------")
+	for _, idx := range indexes {
+		state := idx.State
+		if idx.State == indexBuilding {
+			if percent := indexPercent(idx.Progress); percent >= 0 {
+				state = fmt.Sprintf("%s (%d%%)", state, percent)
+			}
+		}
+
+		size := int64(-1)
+		if idx.Size != nil {
+			size = *idx.Size
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", idx.Name, idx.Table,
+			strings.Join(idx.Columns, ", "), state, humanSize(size))
+	}
+	return tw.Flush()
+}
+
+func init() {
+	sqlCmd.AddCommand(sqlIndexCmd)
+	sqlIndexCmd.AddCommand(sqlIndexCreateCmd)
+	sqlIndexCmd.AddCommand(sqlIndexListCmd)
+	sqlIndexCmd.AddCommand(sqlIndexDeleteCmd)
+
+	sqlIndexCreateCmd.Flags().String("index-name", "", "name of the index, like files_language_idx for the language of files if empty")
+	sqlIndexCreateCmd.Flags().Bool("no-wait", false, "return once the index is being built, without waiting for it")
+	addOutputFlags(sqlIndexListCmd, false)
+}
@@ -0,0 +1,128 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/src-d/engine/api"
+)
+
+func sqlResponse(header []string, rows ...[]string) *api.SQLResponse {
+	res := &api.SQLResponse{Header: &api.SQLResponse_Row{Cell: header}}
+	for _, r := range rows {
+		res.Rows = append(res.Rows, &api.SQLResponse_Row{Cell: r})
+	}
+	return res
+}
+
+func TestCreateIndexQuery(t *testing.T) {
+	name := defaultIndexName("commit_files", []string{"file_path", "repository_id"})
+	if name != "commit_files_file_path_repository_id_idx" {
+		t.Errorf("expected: commit_files_file_path_repository_id_idx, got: %s", name)
+	}
+
+	expected := "CREATE INDEX `files_lang_idx` ON `files` USING pilosa (language(file_path, blob_content)) WITH (async = true)"
+	result := createIndexQuery("files_lang_idx", "files", []string{"language(file_path, blob_content)"})
+	if result != expected {
+		t.Errorf("expected: %s, got: %s", expected, result)
+	}
+}
+
+func TestParseIndexes(t *testing.T) {
+	res := sqlResponse(
+		[]string{"Table", "Non_unique", "Key_name", "Seq_in_index", "Column_name", "Index_type", "Expression"},
+		[]string{"refs", "1", "refs_idx", "1", "ref_name", "pilosa", "NULL"},
+		[]string{"refs", "1", "refs_idx", "2", "repository_id", "pilosa", "NULL"},
+		[]string{"refs", "1", "hash_idx", "1", "NULL", "pilosa", "commit_hash"},
+	)
+
+	indexes := parseIndexes("refs", res)
+	var result []string
+	for _, idx := range indexes {
+		result = append(result, idx.Name+"("+strings.Join(idx.Columns, ",")+")")
+	}
+
+	expected := "refs_idx(ref_name,repository_id) hash_idx(commit_hash)"
+	if strings.Join(result, " ") != expected {
+		t.Errorf("expected: %s, got: %s", expected, strings.Join(result, " "))
+	}
+}
+
+func TestParseBuildingIndexes(t *testing.T) {
+	res := sqlResponse(
+		[]string{"Id", "User", "Host", "db", "Command", "Time", "State", "Info"},
+		[]string{"1", "root", "", "gitbase", "query", "0", "running", "SHOW PROCESSLIST"},
+		[]string{"2", "root", "", "gitbase", "create_index", "12", "files (3/10), repositories (1/2)",
+			"CREATE INDEX `files_lang_idx` ON `files` USING pilosa (language(file_path))"},
+	)
+
+	building := parseBuildingIndexes(res)
+	if len(building) != 1 {
+		t.Fatalf("expected: 1 index, got: %v", building)
+	}
+
+	progress := building["files_lang_idx"]
+	if progress != "files (3/10), repositories (1/2)" {
+		t.Errorf("expected: files (3/10), repositories (1/2), got: %s", progress)
+	}
+
+	if p := indexPercent(progress); p != 33 {
+		t.Errorf("expected: 33, got: %d", p)
+	}
+}
+
+func TestIndexPercent(t *testing.T) {
+	testCases := []struct {
+		progress string
+		expected int
+	}{
+		{"files (5/10)", 50},
+		{"files (10/10)", 100},
+		{"files (3/?)", -1},
+		{"", -1},
+		{"files (0/0)", -1},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.progress, func(t *testing.T) {
+			if p := indexPercent(tt.progress); p != tt.expected {
+				t.Errorf("expected: %d, got: %d", tt.expected, p)
+			}
+		})
+	}
+}
+
+func TestPrintIndexes(t *testing.T) {
+	size := int64(15000000)
+	indexes := []*sqlIndex{
+		{Name: "files_lang_idx", Table: "files", Columns: []string{"language(file_path)"}, State: indexBuilding, Progress: "files (1/4)"},
+		{Name: "refs_idx", Table: "refs", Columns: []string{"ref_name", "repository_id"}, State: indexReady, Size: &size},
+	}
+
+	var buf bytes.Buffer
+	if err := printIndexes(&buf, indexes); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("expected: 4 lines, got: %s", buf.String())
+	}
+
+	for i, expected := range []string{"building (25%)", "15MB"} {
+		if !strings.Contains(lines[i+2], expected) {
+			t.Errorf("expected: %s, got: %s", expected, lines[i+2])
+		}
+	}
+
+	buf.Reset()
+	if err := printIndexes(&buf, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "no indexes, create one with srcd sql index create\n"
+	if buf.String() != expected {
+		t.Errorf("expected: %s, got: %s", expected, buf.String())
+	}
+}
@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/src-d/engine/cmd/srcd/daemon"
+	"github.com/src-d/engine/components"
+)
+
+var sqlRotatePasswordCmd = &cobra.Command{
+	Use:   "rotate-password",
+	Short: "Change the password of gitbase",
+	Long: `Change the password of gitbase
+
+Replaces the password of the user of gitbase, set with srcd init
+--gitbase-password, with a new one generated, or the one read from stdin with
+--password-stdin, so it's not left in the shell history. gitbase and the
+daemon are recreated with it, and it replaces the one stored in the data
+directory. If gitbase doesn't accept queries with the
+new password, both are recreated again with the old one, which is stored back,
+so gitbase and the stored password never end up different.
+
+The clients connected to gitbase are disconnected, and have to connect again
+with the new password. gitbase-web is removed too, run srcd web gitbase to
+start it again with the new password.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := daemon.Running()
+		if err != nil {
+			return err
+		}
+
+		if cfg == nil {
+			return notRunningErrorf("the engine is not initialized; run srcd init --gitbase-password auto first")
+		}
+
+		if cfg.Gitbase.Password == "" {
+			return usageErrorf("gitbase has no password; set one with srcd init --gitbase-password auto")
+		}
+
+		var password string
+		if fromStdin, _ := cmd.Flags().GetBool("password-stdin"); fromStdin {
+			if password, err = readPassword(os.Stdin); err != nil {
+				return err
+			}
+		} else if password, err = daemon.GenerateGitbasePassword(); err != nil {
+			return err
+		}
+
+		if password == cfg.Gitbase.Password {
+			return usageErrorf("the new password of gitbase must be different from the current one")
+		}
+
+		newCfg := *cfg
+		newCfg.Gitbase.Password = password
+
+		reporter := commandStepReporter()
+		if r, ok := reporter.(*ttyStepReporter); ok {
+			logrus.SetOutput(r)
+			defer logrus.SetOutput(os.Stderr)
+		}
+
+		if err := runSteps(reporter, recreateGitbaseSteps(&newCfg)); err != nil {
+			logrus.Warnf("could not start gitbase with the new password, starting it again with the old one")
+			if rerr := runSteps(reporter, recreateGitbaseSteps(cfg)); rerr != nil {
+				return fmt.Errorf("could not start gitbase with the new password: %v; "+
+					"nor with the old one: %v", err, rerr)
+			}
+			return fmt.Errorf("could not start gitbase with the new password, the old one is kept: %v", err)
+		}
+
+		datadir, err := daemon.ResolveDataDir(cfg.DataDir)
+		if err != nil {
+			return err
+		}
+
+		logrus.Infof("new password of gitbase stored in %s", daemon.GitbasePasswordFile(datadir))
+		return nil
+	},
+}
+
+// readPassword reads the password from the first line of r, which can't be
+// empty.
+func readPassword(r io.Reader) (string, error) {
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", fmt.Errorf("could not read the password from stdin: %v", err)
+	}
+
+	password := strings.TrimRight(line, "\r\n")
+	if password == "" {
+		return "", usageErrorf("the password read from stdin is empty")
+	}
+	return password, nil
+}
+
+// recreateGitbaseSteps returns the steps to remove the daemon and gitbase, and
+// start them again with the given configuration.
+func recreateGitbaseSteps(cfg *daemon.Config) []initStep {
+	return []initStep{
+		{
+			name: "remove daemon, gitbase and gitbase-web",
+			run: func() error {
+				return daemon.KillComponents([]string{components.Gitbase.Name, components.GitbaseWeb.Name})
+			},
+		},
+		{
+			name: "start daemon",
+			run:  func() error { return daemon.Start(cfg) },
+			logs: func() ([]string, error) { return daemon.Logs(initLogLines) },
+		},
+		{
+			name: "start gitbase",
+			run:  func() error { return startComponent(components.Gitbase) },
+			logs: containerLogs(components.Gitbase.Name),
+		},
+		{
+			name: "wait for gitbase",
+			run:  waitForGitbase(cfg),
+			logs: containerLogs(components.Gitbase.Name),
+		},
+	}
+}
+
+func init() {
+	sqlCmd.AddCommand(sqlRotatePasswordCmd)
+	sqlRotatePasswordCmd.Flags().Bool("password-stdin", false, "read the new password of gitbase from stdin instead of generating it")
+}
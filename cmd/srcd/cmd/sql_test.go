@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestSQLError(t *testing.T) {
+	err := sqlError(status.Errorf(codes.DeadlineExceeded, "query exceeded the server limit of 10m"))
+	if err.Error() != "query exceeded the server limit of 10m" {
+		t.Errorf("expected: query exceeded the server limit of 10m, got: %s", err)
+	}
+	if code := exitCode(err); code != exitFailed {
+		t.Errorf("expected: %d, got: %d", exitFailed, code)
+	}
+
+	cause := errors.New("unknown table")
+	if err := sqlError(cause); err != cause {
+		t.Errorf("expected: %s, got: %s", cause, err)
+	}
+}
+
+func TestReadPassword(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+		err      string
+	}{
+		{"s3cr3t\n", "s3cr3t", ""},
+		{"s3cr3t\r\nignored\n", "s3cr3t", ""},
+		{"no newline", "no newline", ""},
+		{"\n", "", "the password read from stdin is empty"},
+		{"", "", "the password read from stdin is empty"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			password, err := readPassword(strings.NewReader(tc.input))
+			var errMsg string
+			if err != nil {
+				errMsg = err.Error()
+			}
+			if errMsg != tc.err {
+				t.Fatalf("expected: %s, got: %s", tc.err, errMsg)
+			}
+
+			if password != tc.expected {
+				t.Errorf("expected: %s, got: %s", tc.expected, password)
+			}
+		})
+	}
+}
@@ -0,0 +1,944 @@
+package cmd
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/src-d/engine/cmd/srcd/daemon"
+	"github.com/src-d/engine/components"
+	"github.com/src-d/engine/docker"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	// stateFormatVersion is the version of the format of the states written
+	// by srcd state export, the newest one srcd state import reads.
+	stateFormatVersion = 1
+	// stateManifestName is the name of the manifest of a state, its first
+	// file, and stateConfigName the one of its config file, next.
+	stateManifestName = "state.json"
+	stateConfigName   = "config.yml"
+	// stateIndexesDir is the directory of a state with the metadata of the
+	// indexes of gitbase, in gitbase, and their data, in pilosa, and
+	// stateVolumesDir the one with the files of every volume, in a directory
+	// named after it.
+	stateIndexesDir = "indexes"
+	stateVolumesDir = "volumes"
+	// stateTimeout is how long exporting or importing a state can take.
+	stateTimeout = time.Hour
+)
+
+var stateCmd = &cobra.Command{
+	Use:   "state",
+	Short: "Move the engine, with its data, to another machine",
+}
+
+var stateExportCmd = &cobra.Command{
+	Use:   "export <file>",
+	Short: "Write the configuration and data of the engine to a file",
+	Long: `Write the configuration and data of the engine to a file
+
+The settings of the last srcd init, the config file, the indexes of the
+working directory, the drivers installed in bblfshd, and the lock of the
+images of the daemon and the components enabled, with their ids and digests,
+are written to a gzipped tarball, to recreate the engine on another machine
+with srcd state import.
+
+The password of gitbase and the token of the daemon are left out. Stop pilosa
+with srcd components stop pilosa first, so the indexes are not written while
+they are copied.`,
+	Example: `  srcd state export state.tar.gz`,
+	Args:    cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		output := args[0]
+		if force, _ := cmd.Flags().GetBool("force"); !force {
+			if _, err := os.Stat(output); err == nil {
+				return usageErrorf("%s already exists; give --force to overwrite it", output)
+			}
+		}
+
+		cfg, err := daemon.Running()
+		if err != nil {
+			return err
+		}
+
+		if cfg == nil {
+			return notRunningErrorf("the engine is not initialized; run srcd init first")
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), stateTimeout)
+		defer cancel()
+
+		m, err := newStateManifest(ctx, cfg)
+		if err != nil {
+			return err
+		}
+
+		config, err := exportedConfigFile()
+		if err != nil {
+			return err
+		}
+		m.ConfigFile = config != nil
+
+		gitbaseDir, pilosaDir, err := cfg.WorkdirDirectories()
+		if err != nil {
+			return err
+		}
+
+		if _, err := os.Stat(pilosaDir); err == nil {
+			m.Indexes = true
+			if running, err := docker.IsRunning(components.Pilosa.Name); err == nil && running {
+				logrus.Warnf("pilosa is running, so the indexes may change while they are copied; " +
+					"stop it first with srcd components stop pilosa for a consistent copy")
+			}
+		}
+
+		for _, v := range components.Bblfshd.Volumes {
+			if _, err := docker.VolumeDevice(ctx, v.Name); err == docker.ErrNotFound {
+				continue
+			} else if err != nil {
+				return err
+			}
+			m.Volumes = append(m.Volumes, v.Name)
+		}
+
+		// The state is written next to its final path and renamed once it's
+		// complete, so there's never a partial one there.
+		tmp := output + ".tmp"
+		f, err := os.Create(tmp)
+		if err != nil {
+			return fmt.Errorf("could not create the state: %v", err)
+		}
+		defer os.Remove(tmp)
+
+		err = writeState(ctx, f, m, config, gitbaseDir, pilosaDir)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return operationFailed(fmt.Errorf("could not write the state: %v", err))
+		}
+
+		if err := os.Rename(tmp, output); err != nil {
+			return fmt.Errorf("could not write the state: %v", err)
+		}
+
+		logrus.Infof("state of the engine %s with the working directory %s written to %s",
+			m.EngineVersion, m.Config.Workdir, output)
+		return nil
+	},
+}
+
+var stateImportCmd = &cobra.Command{
+	Use:   "import <file>",
+	Short: "Recreate the engine from a file written by srcd state export",
+	Long: `Recreate the engine from a file written by srcd state export
+
+The config file of the state replaces the one of this machine, which is kept
+with a .bak suffix, the images are installed as locked in the state, pulled
+by their digests or loaded from the bundle given with --bundle, the indexes
+and the drivers of bblfshd are restored, and the engine is initialized with
+the settings of the state. With --workdir, the working directory is another
+one, like the path the repositories were copied to on this machine, and the
+repositories under the one of the state are moved along.
+
+The engine must not be initialized yet. A state exported by another version
+of the engine is imported with the images of this version instead of the
+ones locked, and is rejected if its indexes were written by another version
+of pilosa, unless they are left out with --skip-indexes. A state of a newer
+format than this srcd reads is rejected.
+
+The password of gitbase is not in the state, a new one is generated if
+gitbase had one.`,
+	Example: `  srcd state import state.tar.gz --workdir ~/repos
+  srcd state import state.tar.gz --bundle engine.tar`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		workdir, _ := cmd.Flags().GetString("workdir")
+		bundle, _ := cmd.Flags().GetString("bundle")
+		skipIndexes, _ := cmd.Flags().GetBool("skip-indexes")
+
+		m, config, err := readStateFile(args[0])
+		if err != nil {
+			return err
+		}
+
+		running, err := daemon.Running()
+		if err != nil {
+			return err
+		}
+
+		if running != nil {
+			return usageErrorf("the engine is already initialized here, with the working directory %s; "+
+				"import the state into another environment with --name, or remove this one with srcd kill first",
+				running.Workdir)
+		}
+
+		if m.EngineVersion != components.Daemon.Version {
+			logrus.Warnf("the state was exported by the engine %s, not %s like this srcd; "+
+				"the images of this version are installed instead of the ones locked in it",
+				m.EngineVersion, components.Daemon.Version)
+		}
+
+		if m.Environment != docker.Environment() {
+			logrus.Infof("importing the environment %s into %s", m.Environment, docker.Environment())
+		}
+
+		undo := func() {}
+		if config != nil {
+			path, err := configFilePath()
+			if err != nil {
+				return err
+			}
+
+			if undo, err = restoreConfigFile(path, config); err != nil {
+				return err
+			}
+
+			if err := readConfig(); err != nil {
+				undo()
+				return usageErrorf("invalid config file in the state: %v", err)
+			}
+		}
+
+		cfg, err := importedConfig(m, workdir, skipIndexes)
+		if err != nil {
+			undo()
+			return err
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), stateTimeout)
+		defer cancel()
+
+		steps := []initStep{
+			{
+				name: "install images",
+				run:  func() error { return installStateImages(ctx, m, cfg, bundle) },
+			},
+			{
+				name: "restore indexes and volumes",
+				run:  func() error { return restoreStateFile(ctx, args[0], m, cfg, !skipIndexes) },
+			},
+			{
+				name: "start daemon",
+				run:  func() error { return daemon.Start(cfg) },
+				logs: func() ([]string, error) { return daemon.Logs(initLogLines) },
+			},
+		}
+		steps = append(steps, componentSteps(cfg, false)...)
+
+		reporter := commandStepReporter()
+		if r, ok := reporter.(*ttyStepReporter); ok {
+			logrus.SetOutput(r)
+			defer logrus.SetOutput(os.Stderr)
+		}
+
+		return runSteps(reporter, steps)
+	},
+}
+
+// stateManifest is what a state written by srcd state export has. A state is
+// a gzipped tarball with the manifest first, followed by the config file, if
+// there's one, and then the files of the indexes and of the volumes.
+type stateManifest struct {
+	FormatVersion int `json:"format_version"`
+	// EngineVersion is the version of the engine that exported it.
+	EngineVersion string    `json:"engine_version"`
+	Created       time.Time `json:"created"`
+	// Environment is the name of the environment it was exported from.
+	Environment string `json:"environment"`
+	// Config is the configuration of the last srcd init, with the working
+	// directory and the data directory, without the password of gitbase.
+	// GitbaseAuth is whether gitbase had one.
+	Config      daemon.Config `json:"config"`
+	GitbaseAuth bool          `json:"gitbase_auth"`
+	ConfigFile  bool          `json:"config_file"`
+	// Images are the lock of the images of the daemon and the components
+	// enabled.
+	Images []stateImage `json:"images"`
+	// Indexes is whether it has the indexes of the working directory, and
+	// Volumes are the names of the volumes whose files it has.
+	Indexes bool     `json:"indexes"`
+	Volumes []string `json:"volumes"`
+}
+
+// stateImage is an image locked in a state.
+type stateImage struct {
+	// Component is the short name of the component of the image.
+	Component string `json:"component"`
+	Ref       string `json:"ref"`
+	ID        string `json:"id"`
+	// Digest is the one the image was pulled by, empty if it was built or
+	// loaded, and Platform the one it's built for, like linux/amd64.
+	Digest   string `json:"digest,omitempty"`
+	Platform string `json:"platform"`
+}
+
+// newStateManifest returns the manifest of the state of the engine with the
+// given configuration, locking the images installed of the daemon and the
+// components enabled.
+func newStateManifest(ctx context.Context, cfg *daemon.Config) (*stateManifest, error) {
+	m := &stateManifest{
+		FormatVersion: stateFormatVersion,
+		EngineVersion: components.Daemon.Version,
+		Created:       time.Now().UTC(),
+		Environment:   docker.Environment(),
+		Config:        *cfg,
+		GitbaseAuth:   cfg.Gitbase.Password != "",
+	}
+	m.Config.Gitbase.Password = ""
+	m.Config.Socket = ""
+
+	for _, c := range append([]components.Component{components.Daemon}, enabledComponents(cfg)...) {
+		img, err := docker.InspectImage(ctx, c.Ref())
+		if err == docker.ErrImageNotFound {
+			logrus.Warnf("%s is not installed, so it's not locked in the state", c.Ref())
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		m.Images = append(m.Images, stateImage{
+			Component: c.ShortName(),
+			Ref:       c.Ref(),
+			ID:        img.ID,
+			Digest:    docker.RepoDigest(img),
+			Platform:  docker.ImagePlatform(img).String(),
+		})
+	}
+	return m, nil
+}
+
+// lockedImage returns the image the state locks the component to, and
+// whether it's the one to install: the state was exported by this version of
+// the engine, with the same reference for the component, for a platform that
+// runs on the given one, the one the image is installed for here, and the
+// image was pulled by its digest, so it can be pulled again.
+func lockedImage(m *stateManifest, c components.Component, platform docker.Platform) (stateImage, bool) {
+	if m.EngineVersion != components.Daemon.Version {
+		return stateImage{}, false
+	}
+
+	for _, img := range m.Images {
+		if img.Component == c.ShortName() {
+			return img, img.Ref == c.Ref() && img.Digest != "" &&
+				docker.PlatformOfLabel(img.Platform).Runs(platform)
+		}
+	}
+	return stateImage{}, false
+}
+
+// checkStateFormat fails if the state is not of a format this srcd reads.
+func checkStateFormat(m *stateManifest) error {
+	switch {
+	case m.FormatVersion < 1:
+		return fmt.Errorf("not a state of the engine: its manifest has no format version")
+	case m.FormatVersion > stateFormatVersion:
+		return fmt.Errorf("the state was exported by the engine %s in the format %d, newer than the %d this srcd reads; "+
+			"update srcd to import it", m.EngineVersion, m.FormatVersion, stateFormatVersion)
+	}
+	return nil
+}
+
+// checkStateIndexes fails if the state has indexes written by another image
+// of pilosa than the given one, the one run here, which may not read them,
+// unless they are skipped.
+func checkStateIndexes(m *stateManifest, pilosaRef string, skip bool) error {
+	if !m.Indexes || skip {
+		return nil
+	}
+
+	for _, img := range m.Images {
+		if img.Component == components.Pilosa.ShortName() && img.Ref != pilosaRef {
+			return usageErrorf("the indexes of the state were written by %s, which %s may not read; "+
+				"pin pilosa to that version in the config file, or give --skip-indexes to import the rest "+
+				"and create the indexes again with srcd sql index create", img.Ref, pilosaRef)
+		}
+	}
+	return nil
+}
+
+// exportedConfigFile returns the content of the config file without the
+// secret settings, or nil if there's none.
+func exportedConfigFile() ([]byte, error) {
+	path, err := configFilePath()
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("could not read config file: %v", err)
+	}
+	return withoutSecrets(content)
+}
+
+// withoutSecrets returns the content of a config file without the secret
+// settings, like the password of gitbase.
+func withoutSecrets(content []byte) ([]byte, error) {
+	var values yaml.MapSlice
+	if err := yaml.Unmarshal(content, &values); err != nil {
+		return nil, fmt.Errorf("invalid config file: %v", err)
+	}
+
+	for _, s := range configSettings {
+		if s.secret {
+			values = setMapValue(values, strings.Split(s.key, "."), nil)
+		}
+	}
+	return yaml.Marshal(values)
+}
+
+// restoreConfigFile writes the config file of a state to path, moving the one
+// there, if it's another one, to path.bak, and returns the function undoing
+// it.
+func restoreConfigFile(path string, content []byte) (func(), error) {
+	undo := func() {}
+	old, err := ioutil.ReadFile(path)
+	switch {
+	case err == nil && bytes.Equal(old, content):
+		return undo, nil
+	case err == nil:
+		backup := path + ".bak"
+		if err := os.Rename(path, backup); err != nil {
+			return nil, fmt.Errorf("could not back up the config file: %v", err)
+		}
+		logrus.Infof("config file %s moved to %s", path, backup)
+		undo = func() { os.Rename(backup, path) }
+	case os.IsNotExist(err):
+		undo = func() { os.Remove(path) }
+	default:
+		return nil, fmt.Errorf("could not read config file: %v", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		undo()
+		return nil, fmt.Errorf("could not create config file: %v", err)
+	}
+
+	if err := ioutil.WriteFile(path, content, 0644); err != nil {
+		undo()
+		return nil, fmt.Errorf("could not write config file: %v", err)
+	}
+	return undo, nil
+}
+
+// importedConfig returns the configuration of the state with the given
+// working directory, the one of the state if it's empty, and the repositories
+// in it moved along, the data directory of this machine, and a password of
+// its own for gitbase if it had one. It fails if the indexes of the state
+// can't be imported, unless they are skipped.
+func importedConfig(m *stateManifest, workdir string, skipIndexes bool) (*daemon.Config, error) {
+	cfg := m.Config
+	if workdir == "" {
+		workdir = cfg.Workdir
+	}
+
+	dirs, err := initDirectories([]string{workdir})
+	if err != nil {
+		return nil, err
+	}
+
+	if dirs[0] != cfg.Workdir {
+		logrus.Infof("moving the working directory from %s to %s", cfg.Workdir, dirs[0])
+	}
+
+	var repos []string
+	for _, r := range cfg.Repos {
+		repos = append(repos, movedPath(r, cfg.Workdir, dirs[0]))
+	}
+
+	if dirs, err = initDirectories(append(dirs, repos...)); err != nil {
+		return nil, err
+	}
+
+	// The repositories are excluded with the same patterns.
+	excludes, err := parseRepoPatterns(cfg.Excluded)
+	if err != nil {
+		return nil, err
+	}
+
+	scan, format, err := checkRepositories(dirs, "", false, excludes)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.Workdir = dirs[0]
+	cfg.Repos = dirs[1:]
+	cfg.Format = format
+	cfg.Hidden = nil
+	if format == repoFormatGit {
+		cfg.Hidden = append(excludedPaths(scan), applyRepoPolicy(scan, cfg.RepoPolicy)...)
+	}
+
+	if cfg.DataDir, err = daemon.ResolveDataDir(daemon.DataDir); err != nil {
+		return nil, usageErrorf("invalid data directory: %v", err)
+	}
+
+	if m.GitbaseAuth {
+		if cfg.Gitbase.Password, err = resolveGitbasePassword(cfg.DataDir, gitbasePasswordAuto); err != nil {
+			return nil, err
+		}
+		logrus.Infof("the password of gitbase is not in the state, gitbase uses the one of %s", cfg.DataDir)
+	}
+
+	cfg.TLS = cfg.TLS && !daemon.UsesSocket()
+	cfg.Port = daemon.ConfiguredPort()
+
+	if err := cfg.CheckVolumes(); err != nil {
+		return nil, err
+	}
+
+	if err := checkStateIndexes(m, components.Pilosa.Ref(), skipIndexes); err != nil {
+		return nil, err
+	}
+
+	if m.Indexes && !skipIndexes {
+		gitbaseDir, pilosaDir, err := cfg.WorkdirDirectories()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, dir := range []string{gitbaseDir, pilosaDir} {
+			if files, _ := ioutil.ReadDir(dir); len(files) > 0 {
+				return nil, usageErrorf("there are indexes of %s in %s already; remove them first, "+
+					"or give --skip-indexes to keep them", cfg.Workdir, dir)
+			}
+		}
+	}
+	return &cfg, nil
+}
+
+// movedPath returns the path in the directory from, or from itself, in the
+// directory to instead, or the path as it is if it's out of it.
+func movedPath(p, from, to string) string {
+	rel, err := filepath.Rel(from, p)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return p
+	}
+	return filepath.Join(to, rel)
+}
+
+// installStateImages installs the images of the daemon and the components
+// enabled, the ones locked in the state if it has them, after loading the
+// images of the bundle in the given file, if any.
+func installStateImages(ctx context.Context, m *stateManifest, cfg *daemon.Config, bundle string) error {
+	if bundle != "" {
+		// The drivers are in the volume of bblfshd of the state.
+		_, err := installBundle(ctx, bundle, func(*components.BundleImage, io.Reader) error { return nil })
+		if err != nil {
+			return err
+		}
+	}
+
+	host, err := docker.HostPlatform(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range append([]components.Component{components.Daemon}, enabledComponents(cfg)...) {
+		platform := host
+		if p, ok := c.Platform(); ok {
+			platform = p
+		}
+
+		img, locked := lockedImage(m, c, platform)
+		if !locked {
+			if err := docker.EnsureInstalled(c.ImageName(), c.Tag()); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if id, err := docker.ImageID(ctx, c.Ref()); err == nil && id == img.ID {
+			continue
+		}
+
+		if bundle != "" {
+			logrus.Warnf("%s of the bundle is not the image %s locked in the state", c.Ref(), img.ID)
+			continue
+		}
+
+		logrus.Infof("installing %s locked to %s", c.Ref(), img.Digest)
+		if err := docker.PullDigest(ctx, c.ImageName(), c.Tag(), img.Digest); err != nil {
+			return err
+		}
+
+		if id, err := docker.ImageID(ctx, c.Ref()); err != nil {
+			return err
+		} else if id != img.ID {
+			logrus.Warnf("%s was installed with the id %s, not %s like in the state", c.Ref(), id, img.ID)
+		}
+	}
+	return nil
+}
+
+// writeState writes the state with the manifest and config file given, and
+// the indexes in the given directories and the volumes of the manifest, as a
+// gzipped tarball to w.
+func writeState(ctx context.Context, w io.Writer, m *stateManifest, config []byte, gitbaseDir, pilosaDir string) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	manifest, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := writeTarFile(tw, stateManifestName, manifest, m.Created); err != nil {
+		return err
+	}
+
+	if config != nil {
+		if err := writeTarFile(tw, stateConfigName, config, m.Created); err != nil {
+			return err
+		}
+	}
+
+	if m.Indexes {
+		for _, dir := range []string{gitbaseDir, pilosaDir} {
+			if _, err := os.Stat(dir); os.IsNotExist(err) {
+				continue
+			}
+
+			// The directories are named after the working directory, so
+			// they are added by component, gitbase or pilosa.
+			logrus.Infof("adding the indexes in %s", dir)
+			prefix := path.Join(stateIndexesDir, filepath.Base(filepath.Dir(dir)))
+			if err := tarDirectory(tw, dir, prefix); err != nil {
+				return fmt.Errorf("could not add %s: %v", dir, err)
+			}
+		}
+	}
+
+	for _, name := range m.Volumes {
+		name := name
+		logrus.Infof("adding volume %s", name)
+		err := docker.CopyFromVolume(ctx, name, components.Daemon.Ref(), func(tr *tar.Reader) error {
+			for {
+				hdr, err := tr.Next()
+				if err == io.EOF {
+					return nil
+				} else if err != nil {
+					return err
+				}
+
+				hdr.Name = path.Join(stateVolumesDir, name, hdr.Name)
+				if hdr.Typeflag == tar.TypeDir {
+					hdr.Name += "/"
+				}
+
+				if err := tw.WriteHeader(hdr); err != nil {
+					return err
+				}
+				if _, err := io.Copy(tw, tr); err != nil {
+					return err
+				}
+			}
+		})
+		if err != nil {
+			return fmt.Errorf("could not add volume %s: %v", name, err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// writeTarFile writes a regular file with the given content to tw.
+func writeTarFile(tw *tar.Writer, name string, content []byte, modTime time.Time) error {
+	err := tw.WriteHeader(&tar.Header{
+		Name:     name,
+		Mode:     0644,
+		Size:     int64(len(content)),
+		ModTime:  modTime,
+		Typeflag: tar.TypeReg,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = tw.Write(content)
+	return err
+}
+
+// readStateFile reads the manifest and config file of the state in the given
+// file. See readState.
+func readStateFile(file string) (*stateManifest, []byte, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, nil, usageErrorf("could not open the state: %v", err)
+	}
+	defer f.Close()
+
+	m, config, err := readState(f)
+	if err != nil {
+		return nil, nil, usageErrorf("%v", err)
+	}
+	return m, config, nil
+}
+
+// readState reads the manifest of the state in r, checking it's of a format
+// this srcd reads, and its config file, nil if it has none.
+func readState(r io.Reader) (*stateManifest, []byte, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, nil, fmt.Errorf("not a state of the engine: %v", err)
+	}
+
+	tr := tar.NewReader(gz)
+	hdr, err := tr.Next()
+	if err == io.EOF || (err == nil && hdr.Name != stateManifestName) {
+		return nil, nil, fmt.Errorf("not a state of the engine: it doesn't start with %s", stateManifestName)
+	} else if err != nil {
+		return nil, nil, fmt.Errorf("the state is corrupted: %v", err)
+	}
+
+	var m stateManifest
+	if err := json.NewDecoder(tr).Decode(&m); err != nil {
+		return nil, nil, fmt.Errorf("the state is corrupted: could not read its manifest: %v", err)
+	}
+
+	if err := checkStateFormat(&m); err != nil {
+		return nil, nil, err
+	}
+
+	if !m.ConfigFile {
+		return &m, nil, nil
+	}
+
+	hdr, err = tr.Next()
+	if err != nil || hdr.Name != stateConfigName {
+		return nil, nil, fmt.Errorf("the state is corrupted: its config file is missing")
+	}
+
+	config, err := ioutil.ReadAll(tr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("the state is truncated or corrupted: %v", err)
+	}
+	return &m, config, nil
+}
+
+// restoreStateFile restores the state in the given file. See restoreState.
+func restoreStateFile(ctx context.Context, file string, m *stateManifest, cfg *daemon.Config, indexes bool) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return fmt.Errorf("could not open the state: %v", err)
+	}
+	defer f.Close()
+
+	return restoreState(ctx, f, m, cfg, indexes)
+}
+
+// restoreState copies the files of the volumes of the state in r into them,
+// creating them, and, with indexes, its indexes to the directories of the
+// working directory of the configuration.
+func restoreState(ctx context.Context, r io.Reader, m *stateManifest, cfg *daemon.Config, indexes bool) (err error) {
+	gitbaseDir, pilosaDir, err := cfg.WorkdirDirectories()
+	if err != nil {
+		return err
+	}
+	dirs := map[string]string{"gitbase": gitbaseDir, "pilosa": pilosaDir}
+
+	volumes := make(map[string]bool)
+	for _, name := range m.Volumes {
+		volumes[name] = true
+	}
+
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return fmt.Errorf("could not read the state: %v", err)
+	}
+
+	var volume *volumeRestore
+	defer func() {
+		if volume != nil {
+			if ferr := volume.finish(); err == nil {
+				err = ferr
+			}
+		}
+	}()
+
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("the state is truncated or corrupted: %v", err)
+		}
+
+		if hdr.Name == stateManifestName || hdr.Name == stateConfigName {
+			continue
+		}
+
+		dir, sub, rel := splitStateEntry(hdr.Name)
+		switch {
+		case dir == stateIndexesDir && dirs[sub] != "":
+			if !indexes {
+				continue
+			}
+
+			if err := extractTarEntry(hdr, tr, dirs[sub], rel); err != nil {
+				return fmt.Errorf("could not restore %s: %v", hdr.Name, err)
+			}
+		case dir == stateVolumesDir && volumes[sub]:
+			if volume != nil && volume.name != sub {
+				v := volume
+				volume = nil
+				if err := v.finish(); err != nil {
+					return err
+				}
+			}
+
+			if volume == nil {
+				logrus.Infof("restoring volume %s", sub)
+				if volume, err = startVolumeRestore(ctx, cfg, sub); err != nil {
+					return err
+				}
+			}
+
+			if rel == "" {
+				continue
+			}
+
+			hdr.Name = rel
+			if err := volume.write(hdr, tr); err != nil {
+				return fmt.Errorf("could not restore %s: %v", hdr.Name, err)
+			}
+		default:
+			return fmt.Errorf("the state is corrupted: %s is not in its manifest", hdr.Name)
+		}
+	}
+}
+
+// splitStateEntry returns the directory of the state with the entry with the
+// given name, like indexes, the one in it, like pilosa, and the path of the
+// entry relative to the last one.
+func splitStateEntry(name string) (dir, sub, rel string) {
+	parts := strings.SplitN(strings.TrimSuffix(name, "/"), "/", 3)
+	for len(parts) < 3 {
+		parts = append(parts, "")
+	}
+	return parts[0], parts[1], parts[2]
+}
+
+// extractTarEntry writes the directory or regular file of the entry of a
+// tarball to its path rel in dir, failing if the path is out of it. Other
+// entries, like links, are skipped.
+func extractTarEntry(hdr *tar.Header, r io.Reader, dir, rel string) error {
+	target := filepath.Join(dir, filepath.FromSlash(rel))
+	if target != dir && !strings.HasPrefix(target, dir+string(filepath.Separator)) {
+		return fmt.Errorf("the path %s is out of %s", rel, dir)
+	}
+
+	switch hdr.Typeflag {
+	case tar.TypeDir:
+		return os.MkdirAll(target, 0755)
+	case tar.TypeReg, tar.TypeRegA:
+	default:
+		logrus.Debugf("skipping %s, it's not a file or directory", hdr.Name)
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, os.FileMode(hdr.Mode).Perm())
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(f, r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// volumeRestore copies the files of a volume of a state into it as they are
+// read, through a tarball streamed to docker.
+type volumeRestore struct {
+	name string
+	pw   *io.PipeWriter
+	tw   *tar.Writer
+	done chan error
+}
+
+// startVolumeRestore creates the volume with the given name where the
+// configuration keeps it, if it doesn't exist, and starts copying files into
+// it.
+func startVolumeRestore(ctx context.Context, cfg *daemon.Config, name string) (*volumeRestore, error) {
+	device, err := cfg.VolumeDevice(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if device != "" {
+		if err := os.MkdirAll(device, 0755); err != nil {
+			return nil, fmt.Errorf("could not create the directory of volume %s: %v", name, err)
+		}
+	}
+
+	if err := docker.CreateVolume(ctx, name, device, nil); err != nil {
+		return nil, fmt.Errorf("could not create volume %s: %v", name, err)
+	}
+
+	pr, pw := io.Pipe()
+	v := &volumeRestore{name: name, pw: pw, tw: tar.NewWriter(pw), done: make(chan error, 1)}
+	go func() {
+		err := docker.CopyToVolume(ctx, name, components.Daemon.Ref(), pr)
+		pr.CloseWithError(err)
+		v.done <- err
+	}()
+	return v, nil
+}
+
+// write copies the entry of a tarball into the volume.
+func (v *volumeRestore) write(hdr *tar.Header, r io.Reader) error {
+	if err := v.tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := io.Copy(v.tw, r)
+	return err
+}
+
+// finish waits for the files written to be copied into the volume.
+func (v *volumeRestore) finish() error {
+	err := v.tw.Close()
+	v.pw.CloseWithError(err)
+
+	// The copy fails first when writing does for it.
+	if cerr := <-v.done; cerr != nil {
+		return cerr
+	}
+	return err
+}
+
+func init() {
+	rootCmd.AddCommand(stateCmd)
+	stateCmd.AddCommand(stateExportCmd)
+	stateCmd.AddCommand(stateImportCmd)
+	stateExportCmd.Flags().Bool("force", false, "overwrite the file if it exists")
+	stateImportCmd.Flags().String("workdir", "", "working directory to use instead of the one of the state, like the path the repositories were copied to")
+	stateImportCmd.Flags().String("bundle", "", "bundle written by srcd bundle create to load the images from instead of pulling them")
+	stateImportCmd.Flags().Bool("skip-indexes", false, "leave out the indexes of the state, to create them again")
+}
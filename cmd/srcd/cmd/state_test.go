@@ -0,0 +1,304 @@
+package cmd
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/src-d/engine/cmd/srcd/daemon"
+	"github.com/src-d/engine/components"
+	"github.com/src-d/engine/docker"
+)
+
+func TestCheckStateFormat(t *testing.T) {
+	testCases := []struct {
+		name    string
+		version int
+		err     string
+	}{
+		{"current", stateFormatVersion, ""},
+		{"missing", 0, "not a state of the engine: its manifest has no format version"},
+		{"newer", stateFormatVersion + 1,
+			"the state was exported by the engine v9.0.0 in the format 2, newer than the 1 this srcd reads; update srcd to import it"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := checkStateFormat(&stateManifest{FormatVersion: tc.version, EngineVersion: "v9.0.0"})
+			var errMsg string
+			if err != nil {
+				errMsg = err.Error()
+			}
+			if errMsg != tc.err {
+				t.Errorf("expected: %s, got: %s", tc.err, errMsg)
+			}
+		})
+	}
+}
+
+func TestLockedImage(t *testing.T) {
+	amd64 := docker.Platform{OS: "linux", Architecture: "amd64"}
+	arm64 := docker.Platform{OS: "linux", Architecture: "arm64"}
+	locked := stateImage{
+		Component: components.Gitbase.ShortName(),
+		Ref:       components.Gitbase.Ref(),
+		ID:        "sha256:1",
+		Digest:    "sha256:2",
+		Platform:  "linux/amd64",
+	}
+
+	testCases := []struct {
+		name     string
+		version  string
+		image    stateImage
+		platform docker.Platform
+		expected bool
+	}{
+		{"locked", components.Daemon.Version, locked, amd64, true},
+		{"other engine", "v0.0.1", locked, amd64, false},
+		{"other platform", components.Daemon.Version, locked, arm64, false},
+		{"other ref", components.Daemon.Version, stateImage{Component: locked.Component, Ref: "srcd/gitbase:dev",
+			Digest: locked.Digest, Platform: locked.Platform}, amd64, false},
+		{"built", components.Daemon.Version, stateImage{Component: locked.Component, Ref: locked.Ref,
+			Platform: locked.Platform}, amd64, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m := &stateManifest{EngineVersion: tc.version, Images: []stateImage{tc.image}}
+			_, ok := lockedImage(m, components.Gitbase, tc.platform)
+			if ok != tc.expected {
+				t.Errorf("expected: %v, got: %v", tc.expected, ok)
+			}
+		})
+	}
+
+	m := &stateManifest{EngineVersion: components.Daemon.Version, Images: []stateImage{locked}}
+	if _, ok := lockedImage(m, components.Pilosa, amd64); ok {
+		t.Errorf("expected: pilosa not locked, got: locked")
+	}
+}
+
+func TestCheckStateIndexes(t *testing.T) {
+	images := []stateImage{{Component: components.Pilosa.ShortName(), Ref: "pilosa/pilosa:v0.9.0"}}
+
+	testCases := []struct {
+		name    string
+		indexes bool
+		ref     string
+		skip    bool
+		err     string
+	}{
+		{"same pilosa", true, "pilosa/pilosa:v0.9.0", false, ""},
+		{"no indexes", false, "pilosa/pilosa:v1.2.0", false, ""},
+		{"skipped", true, "pilosa/pilosa:v1.2.0", true, ""},
+		{"other pilosa", true, "pilosa/pilosa:v1.2.0", false,
+			"the indexes of the state were written by pilosa/pilosa:v0.9.0, which pilosa/pilosa:v1.2.0 may not read; " +
+				"pin pilosa to that version in the config file, or give --skip-indexes to import the rest " +
+				"and create the indexes again with srcd sql index create"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m := &stateManifest{Indexes: tc.indexes, Images: images}
+			err := checkStateIndexes(m, tc.ref, tc.skip)
+			var errMsg string
+			if err != nil {
+				errMsg = err.Error()
+			}
+			if errMsg != tc.err {
+				t.Errorf("expected: %s, got: %s", tc.err, errMsg)
+			}
+		})
+	}
+}
+
+func TestMovedPath(t *testing.T) {
+	from := filepath.FromSlash("/home/old/repos")
+	to := filepath.FromSlash("/srv/repos")
+
+	testCases := []struct {
+		path     string
+		expected string
+	}{
+		{"/home/old/repos", "/srv/repos"},
+		{"/home/old/repos/engine", "/srv/repos/engine"},
+		{"/home/old/repos-more", "/home/old/repos-more"},
+		{"/home/old", "/home/old"},
+		{"/mnt/other", "/mnt/other"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.path, func(t *testing.T) {
+			expected := filepath.FromSlash(tc.expected)
+			if result := movedPath(filepath.FromSlash(tc.path), from, to); result != expected {
+				t.Errorf("expected: %s, got: %s", expected, result)
+			}
+		})
+	}
+}
+
+func TestWithoutSecrets(t *testing.T) {
+	content := []byte(`gitbase:
+  password: secret
+  user: root
+daemon:
+  token: secret
+versions:
+  pilosa: v0.9.0
+`)
+
+	result, err := withoutSecrets(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `gitbase:
+  user: root
+versions:
+  pilosa: v0.9.0
+`
+	if string(result) != expected {
+		t.Errorf("expected: %s, got: %s", expected, result)
+	}
+}
+
+func TestRestoreConfigFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "srcd-state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config.yml")
+	if err := ioutil.WriteFile(path, []byte("name: old\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	undo, err := restoreConfigFile(path, []byte("name: new\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	read := func(path string) string {
+		content, _ := ioutil.ReadFile(path)
+		return string(content)
+	}
+
+	if result := read(path); result != "name: new\n" {
+		t.Errorf("expected: the config file of the state, got: %s", result)
+	}
+	if result := read(path + ".bak"); result != "name: old\n" {
+		t.Errorf("expected: the previous config file kept, got: %s", result)
+	}
+
+	undo()
+	if result := read(path); result != "name: old\n" {
+		t.Errorf("expected: the previous config file back, got: %s", result)
+	}
+}
+
+func TestStateRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "srcd-state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	exported := &daemon.Config{Workdir: "/home/old/repos", DataDir: filepath.Join(dir, "old")}
+	gitbaseDir, pilosaDir, err := exported.WorkdirDirectories()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string]string{
+		filepath.Join(gitbaseDir, "repos", "meta"):    "metadata",
+		filepath.Join(pilosaDir, "repos", "fragment"): "data",
+	}
+	for path, content := range files {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m := &stateManifest{FormatVersion: stateFormatVersion, Config: *exported, ConfigFile: true, Indexes: true}
+	var buf bytes.Buffer
+	if err := writeState(context.Background(), &buf, m, []byte("name: old\n"), gitbaseDir, pilosaDir); err != nil {
+		t.Fatal(err)
+	}
+
+	read, config, err := readState(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read.Config.Workdir != exported.Workdir || string(config) != "name: old\n" {
+		t.Errorf("expected: the manifest and config file written, got: %+v and %s", read, config)
+	}
+
+	imported := &daemon.Config{Workdir: "/srv/repos", DataDir: filepath.Join(dir, "new")}
+	if err := restoreState(context.Background(), bytes.NewReader(buf.Bytes()), read, imported, true); err != nil {
+		t.Fatal(err)
+	}
+
+	newGitbaseDir, newPilosaDir, err := imported.WorkdirDirectories()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for path, expected := range map[string]string{
+		filepath.Join(newGitbaseDir, "repos", "meta"):    "metadata",
+		filepath.Join(newPilosaDir, "repos", "fragment"): "data",
+	} {
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(content) != expected {
+			t.Errorf("expected: %s in %s, got: %s", expected, path, content)
+		}
+	}
+}
+
+func TestReadStateRejectsOthers(t *testing.T) {
+	var buf bytes.Buffer
+	err := writeState(context.Background(), &buf, &stateManifest{FormatVersion: stateFormatVersion + 1, EngineVersion: "v9.0.0"}, nil, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err = readState(&buf)
+	if err == nil || !strings.Contains(err.Error(), "update srcd to import it") {
+		t.Errorf("expected: the newer format rejected, got: %v", err)
+	}
+
+	_, _, err = readState(strings.NewReader("not a state"))
+	if err == nil || !strings.HasPrefix(err.Error(), "not a state of the engine") {
+		t.Errorf("expected: not a state, got: %v", err)
+	}
+}
+
+func TestExtractTarEntry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "srcd-state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	hdr := &tar.Header{Name: "indexes/pilosa/../../escape", Mode: 0644, Typeflag: tar.TypeReg}
+	err = extractTarEntry(hdr, strings.NewReader("data"), filepath.Join(dir, "pilosa"), "../escape")
+	if err == nil {
+		t.Errorf("expected: a path out of the directory rejected, got: no error")
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "escape")); !os.IsNotExist(err) {
+		t.Errorf("expected: no file written out of the directory, got: %v", err)
+	}
+}
@@ -0,0 +1,555 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	units "github.com/docker/go-units"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/src-d/engine/components"
+	"github.com/src-d/engine/docker"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// statsInterval is how often the table is refreshed, and how long a
+// component not running waits before its stats are streamed again.
+const statsInterval = time.Second
+
+// gitbaseMetricsTimeout is how long getting the metrics of gitbase can take.
+const gitbaseMetricsTimeout = 5 * time.Second
+
+var statsCmd = &cobra.Command{
+	Use:   "stats [component...]",
+	Short: "Show the resources used by the containers of the engine",
+	Long: `Show the resources used by the containers of the engine
+
+Shows the CPU, memory, network and block I/O used by the given components, like
+gitbase or bblfshd, or by all of them, including the daemon, if none is given.
+The table is refreshed every second until Ctrl-C or q is pressed. The rows of
+the components not running are shown with -.
+
+When gitbase is shown, its active queries, slow queries and cache hit ratio
+are shown below the table, from its metrics. They are shown as unavailable if
+gitbase is not running, or its metrics are not enabled with srcd init
+--enable-metrics.
+
+With --watch-threshold, the components using more than a percentage of their
+memory limit, or of the CPU, are highlighted, like --watch-threshold mem=90%.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmps, err := statsComponents(args)
+		if err != nil {
+			return err
+		}
+
+		values, _ := cmd.Flags().GetStringSlice("watch-threshold")
+		thresholds, err := parseThresholds(values)
+		if err != nil {
+			return err
+		}
+
+		out, err := outputFormat(cmd)
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		ch := make(chan os.Signal, 1)
+		signal.Notify(ch, os.Interrupt)
+		defer signal.Stop(ch)
+		go func() {
+			select {
+			case <-ch:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+
+		c := newStatsCollector(cmps)
+		if noStream, _ := cmd.Flags().GetBool("no-stream"); noStream {
+			c.collectOnce(ctx)
+			return printStats(os.Stdout, out, c.snapshot(thresholds), thresholds, decorated(os.Stdout))
+		}
+
+		go c.collect(ctx)
+
+		var w io.Writer = os.Stdout
+		live := out.format == outputTable && decorated(os.Stdout)
+		if live && isTerminal(os.Stdin) {
+			restore, err := quitOnKey(os.Stdin, cancel)
+			if err != nil {
+				logrus.Debugf("could not read the keys pressed: %v", err)
+			} else {
+				defer restore()
+				w = &crlfWriter{w}
+			}
+		}
+
+		ticker := time.NewTicker(statsInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-ticker.C:
+			}
+
+			var buf bytes.Buffer
+			if live {
+				buf.WriteString("\033[H\033[2J")
+			}
+
+			if err := printStats(&buf, out, c.snapshot(thresholds), thresholds, live); err != nil {
+				return err
+			}
+
+			if _, err := w.Write(buf.Bytes()); err != nil {
+				return err
+			}
+		}
+	},
+}
+
+// statsComponents returns the components with the given names, or all of
+// them, including the daemon, if none is given.
+func statsComponents(names []string) ([]components.Component, error) {
+	if len(names) == 0 {
+		return append([]components.Component{components.Daemon}, components.All...), nil
+	}
+
+	var cmps []components.Component
+	for _, name := range names {
+		c, ok := components.ByName(name)
+		if !ok {
+			return nil, usageErrorf("unknown component %s, it must be one of: %s",
+				name, strings.Join(components.Names(), ", "))
+		}
+		cmps = append(cmps, c)
+	}
+	return cmps, nil
+}
+
+// statsThreshold is a percentage of a resource, cpu or mem, given with
+// --watch-threshold.
+type statsThreshold struct {
+	resource string
+	percent  float64
+}
+
+// parseThresholds parses thresholds like mem=90% or cpu=200%.
+func parseThresholds(values []string) ([]statsThreshold, error) {
+	var thresholds []statsThreshold
+	for _, v := range values {
+		parts := strings.SplitN(v, "=", 2)
+		if len(parts) != 2 || (parts[0] != "mem" && parts[0] != "cpu") {
+			return nil, usageErrorf("invalid value of --watch-threshold %q, it must be like mem=90%% or cpu=80%%", v)
+		}
+
+		percent, err := strconv.ParseFloat(strings.TrimSuffix(parts[1], "%"), 64)
+		if err != nil || percent <= 0 {
+			return nil, usageErrorf("invalid percentage of --watch-threshold %q, it must be like mem=90%%", v)
+		}
+		thresholds = append(thresholds, statsThreshold{parts[0], percent})
+	}
+	return thresholds, nil
+}
+
+// componentStats are the resources used by a component. Usage is nil if
+// it's not running.
+type componentStats struct {
+	Name  string         `json:"name"`
+	Usage *resourceUsage `json:"usage"`
+	// Alerts are the resources over their --watch-threshold, cpu or mem.
+	Alerts []string `json:"alerts"`
+	// Gitbase are the metrics of gitbase, only in its stats.
+	Gitbase *gitbaseStats `json:"gitbase,omitempty"`
+}
+
+// gitbaseStats are the metrics scraped from gitbase, if they are available.
+type gitbaseStats struct {
+	Available bool `json:"available"`
+	// Reason is why the metrics are not available.
+	Reason string `json:"reason,omitempty"`
+	*components.GitbaseMetrics
+}
+
+// resourceUsage is the usage of the resources of a container, computed like
+// docker stats does.
+type resourceUsage struct {
+	CPUPercent    float64 `json:"cpu_percent"`
+	MemoryUsage   uint64  `json:"memory_usage"`
+	MemoryLimit   uint64  `json:"memory_limit"`
+	MemoryPercent float64 `json:"memory_percent"`
+	NetworkRx     uint64  `json:"network_rx"`
+	NetworkTx     uint64  `json:"network_tx"`
+	BlockRead     uint64  `json:"block_read"`
+	BlockWrite    uint64  `json:"block_write"`
+}
+
+func newResourceUsage(s *docker.Stats) *resourceUsage {
+	u := &resourceUsage{
+		CPUPercent:  cpuPercent(s),
+		MemoryUsage: memoryUsage(s),
+		MemoryLimit: s.MemoryStats.Limit,
+	}
+
+	if u.MemoryLimit > 0 {
+		u.MemoryPercent = float64(u.MemoryUsage) / float64(u.MemoryLimit) * 100
+	}
+
+	for _, n := range s.Networks {
+		u.NetworkRx += n.RxBytes
+		u.NetworkTx += n.TxBytes
+	}
+
+	for _, e := range s.BlkioStats.IoServiceBytesRecursive {
+		switch strings.ToLower(e.Op) {
+		case "read":
+			u.BlockRead += e.Value
+		case "write":
+			u.BlockWrite += e.Value
+		}
+	}
+	return u
+}
+
+// cpuPercent returns the CPU used since the previous stats, where 100% is a
+// whole core.
+func cpuPercent(s *docker.Stats) float64 {
+	cpu := float64(s.CPUStats.CPUUsage.TotalUsage) - float64(s.PreCPUStats.CPUUsage.TotalUsage)
+	system := float64(s.CPUStats.SystemUsage) - float64(s.PreCPUStats.SystemUsage)
+	if cpu <= 0 || system <= 0 {
+		return 0
+	}
+
+	cores := len(s.CPUStats.CPUUsage.PercpuUsage)
+	if cores == 0 {
+		cores = 1
+	}
+	return cpu / system * float64(cores) * 100
+}
+
+// memoryUsage returns the memory used without the page cache that can be
+// reclaimed, as it doesn't count towards the limit.
+func memoryUsage(s *docker.Stats) uint64 {
+	m := s.MemoryStats
+	if v, ok := m.Stats["total_inactive_file"]; ok && v < m.Usage {
+		return m.Usage - v
+	}
+
+	if v := m.Stats["inactive_file"]; v < m.Usage {
+		return m.Usage - v
+	}
+	return m.Usage
+}
+
+// alerts returns the resources of the usage over their thresholds.
+func (u *resourceUsage) alerts(thresholds []statsThreshold) []string {
+	var result []string
+	for _, t := range thresholds {
+		if (t.resource == "mem" && u.MemoryPercent >= t.percent) ||
+			(t.resource == "cpu" && u.CPUPercent >= t.percent) {
+			result = append(result, t.resource)
+		}
+	}
+	return result
+}
+
+// statsCollector keeps the last usage of every component.
+type statsCollector struct {
+	cmps []components.Component
+
+	mu      sync.Mutex
+	usage   map[string]*resourceUsage
+	gitbase *gitbaseStats
+}
+
+func newStatsCollector(cmps []components.Component) *statsCollector {
+	return &statsCollector{cmps: cmps, usage: make(map[string]*resourceUsage)}
+}
+
+func (c *statsCollector) set(cmp components.Component, u *resourceUsage) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.usage[cmp.Name] = u
+}
+
+// withGitbase returns whether the metrics of gitbase are shown.
+func (c *statsCollector) withGitbase() bool {
+	for _, cmp := range c.cmps {
+		if cmp.Name == components.Gitbase.Name {
+			return true
+		}
+	}
+	return false
+}
+
+// collectOnce gets the usage of all the components once.
+func (c *statsCollector) collectOnce(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, cmp := range c.cmps {
+		wg.Add(1)
+		go func(cmp components.Component) {
+			defer wg.Done()
+			c.stream(ctx, cmp, false)
+		}(cmp)
+	}
+
+	if c.withGitbase() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.scrapeGitbase(ctx)
+		}()
+	}
+	wg.Wait()
+}
+
+// collect streams the usage of all the components until the context is done.
+// The ones not running, or that stop, are retried every statsInterval, so
+// they are shown again when they start.
+func (c *statsCollector) collect(ctx context.Context) {
+	for _, cmp := range c.cmps {
+		go func(cmp components.Component) {
+			for {
+				c.stream(ctx, cmp, true)
+				c.set(cmp, nil)
+
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(statsInterval):
+				}
+			}
+		}(cmp)
+	}
+
+	if c.withGitbase() {
+		go func() {
+			for {
+				c.scrapeGitbase(ctx)
+
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(statsInterval):
+				}
+			}
+		}()
+	}
+}
+
+// scrapeGitbase gets the metrics of gitbase, or why they are not available.
+func (c *statsCollector) scrapeGitbase(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, gitbaseMetricsTimeout)
+	defer cancel()
+
+	s := &gitbaseStats{}
+	info, err := docker.Inspect(ctx, components.Gitbase.Name)
+	switch {
+	case err == docker.ErrNotFound || (err == nil && !info.State.Running):
+		s.Reason = "gitbase is not running"
+	case err != nil:
+		s.Reason = err.Error()
+	default:
+		addr, ok := components.GitbaseMetricsAddress(info)
+		if !ok {
+			s.Reason = "its metrics are not enabled, enable them with srcd init --enable-metrics"
+			break
+		}
+
+		if s.GitbaseMetrics, err = components.ScrapeGitbaseMetrics(ctx, addr); err != nil {
+			s.Reason = err.Error()
+			break
+		}
+		s.Available = true
+	}
+
+	// The last metrics are kept when the scrape is cancelled on exit.
+	if ctx.Err() != nil && !s.Available {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gitbase = s
+}
+
+func (c *statsCollector) stream(ctx context.Context, cmp components.Component, stream bool) {
+	err := docker.StreamStats(ctx, cmp.Name, stream, func(s *docker.Stats) {
+		c.set(cmp, newResourceUsage(s))
+	})
+	if err != nil && err != docker.ErrNotFound {
+		logrus.Debugf("could not get the stats of %s: %v", cmp.ShortName(), err)
+	}
+}
+
+// snapshot returns the last usage of the components, in their order.
+func (c *statsCollector) snapshot(thresholds []statsThreshold) []*componentStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	result := make([]*componentStats, len(c.cmps))
+	for i, cmp := range c.cmps {
+		s := &componentStats{Name: cmp.ShortName(), Usage: c.usage[cmp.Name]}
+		if s.Usage != nil {
+			s.Alerts = s.Usage.alerts(thresholds)
+		}
+		if cmp.Name == components.Gitbase.Name {
+			s.Gitbase = c.gitbase
+		}
+		result[i] = s
+	}
+	return result
+}
+
+func printStats(w io.Writer, out *output, stats []*componentStats, thresholds []statsThreshold, colors bool) error {
+	return out.print(w, "stats", stats, func(w io.Writer) error {
+		return printStatsTable(w, stats, len(thresholds) > 0, colors)
+	})
+}
+
+// printStatsTable prints the usage of the components, with a column with
+// the resources over their thresholds if withAlerts is true. With colors,
+// the rows of those components are red.
+func printStatsTable(w io.Writer, stats []*componentStats, withAlerts, colors bool) error {
+	// Every row starts with a color of the same length, so the escape codes
+	// don't misalign the columns.
+	color := func(alert bool) string {
+		switch {
+		case !colors:
+			return ""
+		case alert:
+			return "\033[31m"
+		default:
+			return "\033[39m"
+		}
+	}
+
+	tw := new(tabwriter.Writer)
+	tw.Init(w, 0, 8, 5, '\t', 0)
+	header := "NAME\tCPU %\tMEM USAGE / LIMIT\tMEM %\tNET I/O\tBLOCK I/O"
+	if withAlerts {
+		header += "\tALERTS"
+	}
+	fmt.Fprintln(tw, color(false)+header)
+	fmt.Fprintln(tw, color(false)+strings.TrimSuffix(strings.Repeat("----------\t", strings.Count(header, "\t")+1), "\t"))
+
+	for _, s := range stats {
+		row := []string{s.Name, "-", "-", "-", "-", "-"}
+		if u := s.Usage; u != nil {
+			row = []string{
+				s.Name,
+				fmt.Sprintf("%.2f%%", u.CPUPercent),
+				fmt.Sprintf("%s / %s", bytesSize(u.MemoryUsage), bytesSize(u.MemoryLimit)),
+				fmt.Sprintf("%.2f%%", u.MemoryPercent),
+				fmt.Sprintf("%s / %s", decimalSize(u.NetworkRx), decimalSize(u.NetworkTx)),
+				fmt.Sprintf("%s / %s", decimalSize(u.BlockRead), decimalSize(u.BlockWrite)),
+			}
+		}
+
+		if withAlerts {
+			row = append(row, orDash(strings.Join(s.Alerts, ",")))
+		}
+		fmt.Fprintln(tw, color(len(s.Alerts) > 0)+strings.Join(row, "\t"))
+	}
+
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if colors {
+		fmt.Fprint(w, "\033[0m")
+	}
+
+	for _, s := range stats {
+		if s.Gitbase != nil {
+			fmt.Fprintln(w)
+			fmt.Fprintln(w, gitbaseStatsLine(s.Gitbase))
+		}
+	}
+	return nil
+}
+
+// gitbaseStatsLine returns the line with the metrics of gitbase printed
+// below the table.
+func gitbaseStatsLine(s *gitbaseStats) string {
+	if !s.Available || s.GitbaseMetrics == nil {
+		return fmt.Sprintf("gitbase metrics: unavailable, %s", s.Reason)
+	}
+
+	ratio := "-"
+	if r := s.CacheHitRatio; r != nil {
+		ratio = fmt.Sprintf("%.1f%%", *r*100)
+	}
+	return fmt.Sprintf("gitbase metrics: %d active queries, %d slow queries, cache hit ratio %s",
+		s.ActiveQueries, s.SlowQueries, ratio)
+}
+
+// bytesSize formats memory in binary units, like docker stats.
+func bytesSize(size uint64) string {
+	return units.BytesSize(float64(size))
+}
+
+// decimalSize formats transferred bytes in decimal units, like docker stats.
+func decimalSize(size uint64) string {
+	return units.HumanSizeWithPrecision(float64(size), 3)
+}
+
+// quitOnKey puts the terminal in raw mode and calls quit when q or Ctrl-C is
+// pressed. The function returned restores the terminal.
+func quitOnKey(f *os.File, quit func()) (func(), error) {
+	fd := int(f.Fd())
+	state, err := terminal.MakeRaw(fd)
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		key := make([]byte, 1)
+		for {
+			if _, err := f.Read(key); err != nil {
+				return
+			}
+
+			// In raw mode Ctrl-C is read as a key instead of interrupting.
+			if key[0] == 'q' || key[0] == 'Q' || key[0] == 3 {
+				quit()
+				return
+			}
+		}
+	}()
+
+	return func() { terminal.Restore(fd, state) }, nil
+}
+
+// crlfWriter ends the lines with \r\n, as a terminal in raw mode doesn't
+// return to the start of the line on \n.
+type crlfWriter struct {
+	w io.Writer
+}
+
+func (w *crlfWriter) Write(p []byte) (int, error) {
+	if _, err := w.w.Write(bytes.Replace(p, []byte("\n"), []byte("\r\n"), -1)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func init() {
+	rootCmd.AddCommand(statsCmd)
+	addOutputFlags(statsCmd, true)
+	statsCmd.Flags().Bool("no-stream", false, "print the usage once instead of refreshing it")
+	statsCmd.Flags().StringSlice("watch-threshold", nil, "highlight the components over a percentage of a resource, like mem=90% or cpu=80%")
+}
@@ -0,0 +1,168 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/src-d/engine/components"
+	"github.com/src-d/engine/docker"
+)
+
+func TestParseThresholds(t *testing.T) {
+	testCases := []struct {
+		values   []string
+		expected []statsThreshold
+		err      bool
+	}{
+		{nil, nil, false},
+		{[]string{"mem=90%"}, []statsThreshold{{"mem", 90}}, false},
+		{[]string{"mem=90", "cpu=150%"}, []statsThreshold{{"mem", 90}, {"cpu", 150}}, false},
+		{[]string{"disk=90%"}, nil, true},
+		{[]string{"mem"}, nil, true},
+		{[]string{"mem=lots"}, nil, true},
+		{[]string{"mem=0%"}, nil, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(strings.Join(tc.values, ","), func(t *testing.T) {
+			thresholds, err := parseThresholds(tc.values)
+			if tc.err {
+				if err == nil {
+					t.Errorf("expected an error, got: %v", thresholds)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if len(thresholds) != len(tc.expected) {
+				t.Fatalf("expected: %v, got: %v", tc.expected, thresholds)
+			}
+			for i := range thresholds {
+				if thresholds[i] != tc.expected[i] {
+					t.Errorf("expected: %v, got: %v", tc.expected, thresholds)
+				}
+			}
+		})
+	}
+}
+
+func TestNewResourceUsage(t *testing.T) {
+	var s docker.Stats
+	s.PreCPUStats.CPUUsage.TotalUsage = 1000
+	s.PreCPUStats.SystemUsage = 10000
+	s.CPUStats.CPUUsage.TotalUsage = 2000
+	s.CPUStats.CPUUsage.PercpuUsage = []uint64{1000, 1000}
+	s.CPUStats.SystemUsage = 20000
+	s.MemoryStats.Usage = 1000
+	s.MemoryStats.Limit = 1000
+	s.MemoryStats.Stats = map[string]uint64{"total_inactive_file": 100}
+	s.Networks = map[string]types.NetworkStats{
+		"eth0": {RxBytes: 10, TxBytes: 20},
+		"eth1": {RxBytes: 1, TxBytes: 2},
+	}
+	s.BlkioStats.IoServiceBytesRecursive = []types.BlkioStatEntry{
+		{Op: "Read", Value: 5},
+		{Op: "Write", Value: 7},
+		{Op: "Total", Value: 12},
+	}
+
+	expected := resourceUsage{
+		CPUPercent:    20,
+		MemoryUsage:   900,
+		MemoryLimit:   1000,
+		MemoryPercent: 90,
+		NetworkRx:     11,
+		NetworkTx:     22,
+		BlockRead:     5,
+		BlockWrite:    7,
+	}
+
+	u := newResourceUsage(&s)
+	if *u != expected {
+		t.Errorf("expected: %+v, got: %+v", expected, *u)
+	}
+
+	alerts := u.alerts([]statsThreshold{{"mem", 90}, {"cpu", 50}})
+	if strings.Join(alerts, ",") != "mem" {
+		t.Errorf("expected: %s, got: %s", "mem", alerts)
+	}
+}
+
+func TestPrintStatsTable(t *testing.T) {
+	stats := []*componentStats{
+		{Name: "daemon", Usage: &resourceUsage{CPUPercent: 1.5, MemoryUsage: 1 << 20, MemoryLimit: 1 << 30}},
+		{Name: "gitbase"},
+	}
+
+	var buf bytes.Buffer
+	if err := printStatsTable(&buf, stats, true, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("expected 4 lines, got: %s", buf.String())
+	}
+
+	expected := []string{
+		"daemon 1.50% 1MiB / 1GiB 0.00% 0B / 0B 0B / 0B -",
+		"gitbase - - - - - -",
+	}
+	for i, e := range expected {
+		if got := strings.Join(strings.Fields(lines[i+2]), " "); got != e {
+			t.Errorf("expected: %s, got: %s", e, got)
+		}
+	}
+
+	stats[1].Gitbase = &gitbaseStats{Reason: "gitbase is not running"}
+	buf.Reset()
+	if err := printStatsTable(&buf, stats, false, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	lines = strings.Split(strings.TrimSpace(buf.String()), "\n")
+	last := "gitbase metrics: unavailable, gitbase is not running"
+	if lines[len(lines)-1] != last {
+		t.Errorf("expected: %s, got: %s", last, lines[len(lines)-1])
+	}
+}
+
+func TestGitbaseStatsLine(t *testing.T) {
+	ratio := 0.932
+	testCases := []struct {
+		name     string
+		stats    *gitbaseStats
+		expected string
+	}{
+		{
+			"available",
+			&gitbaseStats{Available: true, GitbaseMetrics: &components.GitbaseMetrics{
+				ActiveQueries: 2, SlowQueries: 5, CacheHitRatio: &ratio,
+			}},
+			"gitbase metrics: 2 active queries, 5 slow queries, cache hit ratio 93.2%",
+		},
+		{
+			"no cache",
+			&gitbaseStats{Available: true, GitbaseMetrics: &components.GitbaseMetrics{}},
+			"gitbase metrics: 0 active queries, 0 slow queries, cache hit ratio -",
+		},
+		{
+			"disabled",
+			&gitbaseStats{Reason: "its metrics are not enabled"},
+			"gitbase metrics: unavailable, its metrics are not enabled",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := gitbaseStatsLine(tc.stats); got != tc.expected {
+				t.Errorf("expected: %s, got: %s", tc.expected, got)
+			}
+		})
+	}
+}
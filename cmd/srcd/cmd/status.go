@@ -0,0 +1,353 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/src-d/engine/cmd/srcd/daemon"
+	"github.com/src-d/engine/components"
+)
+
+// statusTimeout is how long srcd status waits for each of its checks.
+const statusTimeout = 5 * time.Second
+
+// stateUnknown is the state of the components whose status can't be found.
+const stateUnknown = "unknown"
+
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show whether the engine is initialized and working",
+	Long: `Show whether the engine is initialized and working
+
+Prints the working directory of the last srcd init, the other directories
+with repositories given to it with where they are mounted in gitbase, the
+patterns of the repositories excluded from gitbase with --exclude-repo, the
+state and health of every component, the addresses to connect to them, like
+the DSN of gitbase or the URLs of the web clients, the size of the volumes,
+like the one with the indexes of pilosa, and the problems found, with a hint
+about how to fix them: required components not healthy, pilosa not answering
+at its status endpoint, containers running an image that's not the one
+installed, a daemon with a version other than the one of the CLI, or
+components running while the ones they require are stopped.
+
+The checks run at the same time, with a short timeout, so it finishes quickly
+even when some components are down. It exits with a non-zero code if the
+engine is not fully healthy, so it can be used to wait for it in scripts.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		s := checkEnvironment()
+
+		var err error
+		if asJSON, _ := cmd.Flags().GetBool("json"); asJSON {
+			err = printJSON(os.Stdout, s)
+		} else {
+			err = newRecordWriter(os.Stdout).write("environment", s, func(w io.Writer) error {
+				return printEnvironment(w, s)
+			})
+		}
+		if err != nil {
+			return err
+		}
+
+		if !s.Healthy {
+			return exitStatus(exitNotRunning)
+		}
+		return nil
+	},
+}
+
+// envStatus is the status of the whole engine.
+type envStatus struct {
+	Initialized bool `json:"initialized"`
+	// Workdir is nil if the engine is not initialized.
+	Workdir *string `json:"workdir"`
+	// Repos are the directories mounted in gitbase, the working directory
+	// first, each one with where it's mounted, empty if the engine is not
+	// initialized.
+	Repos []components.RepoMount `json:"repos"`
+	// Excluded are the patterns of the repositories excluded from gitbase
+	// with srcd init --exclude-repo.
+	Excluded   []string             `json:"excluded"`
+	Components []*components.Status `json:"components"`
+	Addresses  []components.Address `json:"addresses"`
+	Problems   []checkResult        `json:"problems"`
+	// Settings are the ones that change how the components behave, like
+	// gitbase squash or gitbase cache-size, empty if they can't be known.
+	Settings map[string]string `json:"settings"`
+	// Volumes are the ones of the components with their size, like the one
+	// with the indexes of pilosa.
+	Volumes []components.PurgeResource `json:"volumes"`
+	// Healthy is true if no problem was found.
+	Healthy bool `json:"healthy"`
+}
+
+// checkEnvironment checks the configuration of the daemon, the status of
+// every component, the images they run and the version of the daemon at the
+// same time.
+func checkEnvironment() *envStatus {
+	cmps := append([]components.Component{components.Daemon}, components.All...)
+	statuses := make([]*components.Status, len(cmps))
+	errs := make([]error, len(cmps))
+
+	var (
+		wg          sync.WaitGroup
+		cfg         *daemon.Config
+		cfgErr      error
+		images      checkResult
+		daemonCheck checkResult
+		gitbase     map[string]string
+		volumes     []components.PurgeResource
+		pilosaCheck checkResult
+		pilosa      map[string]string
+	)
+
+	for i, c := range cmps {
+		wg.Add(1)
+		go func(i int, c components.Component) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), statusTimeout)
+			defer cancel()
+			statuses[i], errs[i] = components.GetStatus(ctx, c, false)
+		}(i, c)
+	}
+
+	wg.Add(7)
+	go func() {
+		defer wg.Done()
+		cfg, cfgErr = daemon.Running()
+	}()
+	go func() {
+		defer wg.Done()
+		images = runImagesCheck()
+	}()
+	go func() {
+		defer wg.Done()
+		daemonCheck = runDaemonVersionCheck()
+	}()
+	go func() {
+		defer wg.Done()
+		gitbase, _ = gitbaseSettings()
+	}()
+	go func() {
+		defer wg.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), statusTimeout)
+		defer cancel()
+		volumes, _ = components.VolumeUsage(ctx)
+	}()
+	go func() {
+		defer wg.Done()
+		pilosaCheck = runPilosaCheck()
+	}()
+	go func() {
+		defer wg.Done()
+		pilosa, _ = pilosaSettings()
+	}()
+	wg.Wait()
+
+	s := &envStatus{Problems: []checkResult{}, Excluded: []string{}, Settings: map[string]string{},
+		Volumes: []components.PurgeResource{}, Repos: []components.RepoMount{}}
+	if volumes != nil {
+		s.Volumes = volumes
+	}
+	for k, v := range gitbase {
+		s.Settings["gitbase "+k] = v
+	}
+	for k, v := range pilosa {
+		s.Settings["pilosa "+k] = v
+	}
+	for i, c := range cmps {
+		if errs[i] != nil {
+			statuses[i] = &components.Status{Name: c.ShortName(), Image: c.ImageName(), Tag: c.Tag(),
+				State: stateUnknown, Health: components.HealthNone}
+			s.Problems = append(s.Problems, problem(c.ShortName(), fail("make sure docker is running",
+				"could not get the status of %s: %v", c.ShortName(), errs[i])))
+		}
+	}
+	markDisabled(statuses, cfg)
+	s.Components = statuses
+
+	switch {
+	case cfgErr != nil:
+		s.Problems = append(s.Problems, problem("workdir", fail("",
+			"could not get the configuration of the daemon: %v", cfgErr)))
+	case cfg == nil || cfg.Workdir == "":
+		s.Problems = append(s.Problems, problem("workdir", fail("run srcd init",
+			"the engine is not initialized")))
+	default:
+		s.Initialized = true
+		s.Workdir = &cfg.Workdir
+		s.Repos = components.RepoMounts(cfg.Workdir, cfg.Repos)
+		if len(cfg.Excluded) > 0 {
+			s.Excluded = cfg.Excluded
+		}
+	}
+
+	s.Problems = append(s.Problems, statusProblems(statuses, cfg)...)
+	if images.Status != checkPass {
+		s.Problems = append(s.Problems, problem("images", images))
+	}
+
+	// The container of pilosa not running is already reported as not healthy.
+	if pilosaCheck.Status == checkFail && statusOf(statuses, components.Pilosa).State == components.StateRunning {
+		s.Problems = append(s.Problems, problem("pilosa", pilosaCheck))
+	}
+
+	// The daemon not running is already reported as not healthy.
+	if daemonCheck.Status != checkPass && statusOf(statuses, components.Daemon).Healthy() {
+		s.Problems = append(s.Problems, problem("daemon version", daemonCheck))
+	}
+
+	var socket string
+	if cfg != nil {
+		socket = cfg.Socket
+	}
+	s.Addresses = components.Addresses(statuses, daemon.RemoteDockerHost(), socket)
+	if cfg != nil && statusOf(statuses, components.Pilosa).State == components.StateRunning {
+		s.Addresses = append(s.Addresses, components.Address{
+			Component:   components.Pilosa.ShortName(),
+			Description: "pilosa for gitbase",
+			Address:     components.PilosaEndpoint(cfg.Pilosa.EffectivePort()),
+		})
+	}
+	s.Healthy = len(s.Problems) == 0
+	return s
+}
+
+// runImagesCheck checks that the containers running have the images
+// installed. The ones stopped are reported as not healthy instead.
+func runImagesCheck() checkResult {
+	states, err := componentStates()
+	if err != nil {
+		return warn("", "%v", err)
+	}
+
+	var running []componentState
+	for _, s := range states {
+		if s.running {
+			running = append(running, s)
+		}
+	}
+	return checkComponents(running)
+}
+
+// problem returns the result of the check with its name.
+func problem(check string, r checkResult) checkResult {
+	r.Check = check
+	return r
+}
+
+func statusOf(statuses []*components.Status, c components.Component) *components.Status {
+	for _, s := range statuses {
+		if s.Name == c.ShortName() {
+			return s
+		}
+	}
+	return &components.Status{Name: c.ShortName(), State: stateUnknown, Health: components.HealthNone}
+}
+
+// statusProblems returns the required components that are not healthy, and
+// the components running while the ones they require are not.
+func statusProblems(statuses []*components.Status, cfg *daemon.Config) []checkResult {
+	var problems []checkResult
+	if unhealthy := unhealthyComponents(statuses, cfg); len(unhealthy) > 0 {
+		problems = append(problems, problem("health", fail(
+			"start them with srcd restart "+strings.Join(unhealthy, " ")+", or srcd init if it was never run",
+			"required components not healthy: %s", strings.Join(unhealthy, ", "))))
+	}
+
+	for _, u := range components.UnmetRequirements(statuses) {
+		problems = append(problems, problem("dependencies", warn(
+			"start them with srcd restart "+strings.Join(u.Stopped, " "),
+			"%s is running, but %s, which it requires, is not", u.Name, strings.Join(u.Stopped, ", "))))
+	}
+	return problems
+}
+
+func printEnvironment(w io.Writer, s *envStatus) error {
+	workdir := "not initialized"
+	if s.Workdir != nil {
+		workdir = *s.Workdir
+	}
+	fmt.Fprintf(w, "working directory: %s\n", workdir)
+	if len(s.Repos) > 1 {
+		printRepoMounts(w, s.Repos)
+	}
+	if len(s.Excluded) > 0 {
+		fmt.Fprintf(w, "excluded repositories: %s\n", strings.Join(s.Excluded, ", "))
+	}
+	fmt.Fprintln(w)
+
+	tw := new(tabwriter.Writer)
+	tw.Init(w, 0, 8, 5, '\t', 0)
+	fmt.Fprintln(tw, "COMPONENT\tSTATE\tHEALTH\tUPTIME")
+	fmt.Fprintln(tw, "----------\t----------\t----------\t----------")
+	for _, c := range s.Components {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", c.Name, c.State, c.Health, uptime(c))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if len(s.Addresses) > 0 {
+		fmt.Fprintln(w, "\naddresses:")
+		for _, a := range s.Addresses {
+			fmt.Fprintf(w, "  %s: %s\n", a.Description, a.Address)
+		}
+	}
+
+	printOverrides(w, s.Components)
+
+	if len(s.Volumes) > 0 {
+		fmt.Fprintln(w, "\nvolumes:")
+		for _, v := range s.Volumes {
+			content := humanSize(v.Size)
+			if v.Description != "" {
+				content += " of " + v.Description
+			}
+			fmt.Fprintf(w, "  %s: %s\n", v.Name, content)
+		}
+	}
+
+	if len(s.Settings) > 0 {
+		fmt.Fprintln(w, "\nsettings:")
+		for _, k := range sortedSettings(s.Settings) {
+			fmt.Fprintf(w, "  %s: %s\n", k, s.Settings[k])
+		}
+	}
+
+	if len(s.Problems) == 0 {
+		_, err := fmt.Fprintln(w, "\nno problems found")
+		return err
+	}
+
+	fmt.Fprintln(w, "\nproblems:")
+	for _, p := range s.Problems {
+		fmt.Fprintf(w, "  %s  %s: %s\n", p.Status, p.Check, p.Message)
+		if p.Hint != "" {
+			fmt.Fprintf(w, "        hint: %s\n", p.Hint)
+		}
+	}
+	return nil
+}
+
+func sortedSettings(settings map[string]string) []string {
+	keys := make([]string, 0, len(settings))
+	for k := range settings {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func init() {
+	rootCmd.AddCommand(statusCmd)
+	statusCmd.Flags().Bool("json", false, "print the status as JSON")
+}
@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/src-d/engine/cmd/srcd/daemon"
+	"github.com/src-d/engine/components"
+)
+
+func runningStatus(c components.Component) *components.Status {
+	return &components.Status{Name: c.ShortName(), State: components.StateRunning,
+		Health: components.HealthNone}
+}
+
+func stoppedStatus(c components.Component) *components.Status {
+	return &components.Status{Name: c.ShortName(), State: components.StateStopped,
+		Health: components.HealthNone}
+}
+
+func TestStatusProblems(t *testing.T) {
+	cfg := &daemon.Config{Workdir: "/repos"}
+	testCases := []struct {
+		name     string
+		statuses []*components.Status
+		expected []string
+	}{
+		{"healthy", []*components.Status{
+			runningStatus(components.Daemon),
+			runningStatus(components.Bblfshd),
+			runningStatus(components.Pilosa),
+			runningStatus(components.Gitbase),
+		}, nil},
+		{"stopped dependency", []*components.Status{
+			runningStatus(components.Daemon),
+			stoppedStatus(components.Bblfshd),
+			runningStatus(components.Pilosa),
+			runningStatus(components.Gitbase),
+		}, []string{"FAIL health", "WARN dependencies"}},
+		{"not running", []*components.Status{
+			stoppedStatus(components.Daemon),
+			stoppedStatus(components.Bblfshd),
+			stoppedStatus(components.Pilosa),
+			stoppedStatus(components.Gitbase),
+		}, []string{"FAIL health"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var got []string
+			for _, p := range statusProblems(tc.statuses, cfg) {
+				got = append(got, p.Status+" "+p.Check)
+			}
+
+			if fmt.Sprint(got) != fmt.Sprint(tc.expected) {
+				t.Errorf("expected: %v, got: %v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestPrintEnvironmentRepos(t *testing.T) {
+	workdir := "/home/me/work"
+	s := &envStatus{
+		Workdir: &workdir,
+		Repos:   components.RepoMounts(workdir, []string{"/mnt/data/oss"}),
+	}
+
+	var buf bytes.Buffer
+	if err := printEnvironment(&buf, s); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "working directory: /home/me/work\n" +
+		"directories mounted in gitbase:\n" +
+		"  /home/me/work at /opt/repos/work\n" +
+		"  /mnt/data/oss at /opt/repos/oss\n"
+	if !strings.HasPrefix(buf.String(), expected) {
+		t.Errorf("expected: %s, got: %s", expected, buf.String())
+	}
+
+	s.Repos = components.RepoMounts(workdir, nil)
+	buf.Reset()
+	if err := printEnvironment(&buf, s); err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(buf.String(), "mounted in gitbase") {
+		t.Errorf("expected: only the working directory, got: %s", buf.String())
+	}
+}
@@ -0,0 +1,171 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/src-d/engine/cmd/srcd/daemon"
+	"github.com/src-d/engine/components"
+	"github.com/src-d/engine/docker"
+)
+
+// stopOrder returns the order the components are stopped, the ones requiring
+// others first.
+func stopOrder() []components.Component {
+	return []components.Component{
+		components.GitbaseWeb,
+		components.BblfshWeb,
+		components.Gitbase,
+		components.Pilosa,
+		components.Bblfshd,
+		components.Daemon,
+	}
+}
+
+var stopCmd = &cobra.Command{
+	Use:   "stop [component...]",
+	Short: "Stop the running components, or only the given ones",
+	Long: `Stop the running components, or only the given ones
+
+The components are bblfshd, bblfsh-web (or web-parse), gitbase, gitbase-web
+(or web-sql), pilosa and the daemon, which is started again by any command
+needing it. They are stopped gracefully and their containers removed, keeping
+their data, and the rest keep running. A warning is shown for the running
+components that can't work without the ones stopped.
+
+Every component is given some time to shut down before being killed, longer
+for pilosa, which flushes its indexes, and gitbase. It can be changed for all
+of them with --timeout, or skipped with --force. A warning names the
+components that had to be killed.
+
+The stopped components are started again when they are used, or with srcd
+init, which only starts the ones not running.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmps, err := stopComponents(args)
+		if err != nil {
+			return err
+		}
+
+		stopping := make(map[string]bool)
+		for _, c := range cmps {
+			stopping[c.Name] = true
+		}
+
+		for _, c := range cmps {
+			for _, dep := range components.RequiredBy(c) {
+				if stopping[dep.Name] {
+					continue
+				}
+
+				if running, _ := docker.IsRunning(dep.Name); running {
+					logrus.Warnf("%s depends on %s and will stop working", dep.ShortName(), c.ShortName())
+				}
+			}
+		}
+
+		timeout, _ := cmd.Flags().GetDuration("timeout")
+		force, _ := cmd.Flags().GetBool("force")
+		if timeout < 0 {
+			return usageErrorf("invalid timeout %s", timeout)
+		}
+
+		for _, c := range cmps {
+			err := stopComponent(c, stopGracePeriod(c, timeout, force))
+			if err == docker.ErrNotFound {
+				if len(args) > 0 {
+					logrus.Infof("%s is not running", c.ShortName())
+				}
+			} else if err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
+
+// stopGracePeriod returns the time the component is given to shut down: none
+// with force, the timeout if it's given or the default of the component. See
+// gracePeriod.
+func stopGracePeriod(c components.Component, timeout time.Duration, force bool) time.Duration {
+	switch {
+	case force:
+		return 0
+	case timeout > 0:
+		return timeout
+	default:
+		return gracePeriod(c)
+	}
+}
+
+// gracePeriod returns the default time the component is given to shut down,
+// longer than the drain window of the daemon for it.
+func gracePeriod(c components.Component) time.Duration {
+	if c.Name == components.Daemon.Name {
+		return daemon.GracePeriod()
+	}
+	return c.GracePeriod()
+}
+
+// stopComponent stops the component and removes its container, killing it if
+// it doesn't shut down in the grace period. It returns docker.ErrNotFound if
+// it's not running.
+func stopComponent(c components.Component, grace time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), grace+time.Minute)
+	defer cancel()
+
+	// The proxy serving a web client over HTTPS goes along with it.
+	if isWebClient(c) {
+		_, err := docker.Stop(ctx, components.WebProxyName(c.Name), grace)
+		if err != nil && err != docker.ErrNotFound {
+			return fmt.Errorf("could not stop the proxy of %s: %v", c.ShortName(), err)
+		}
+	}
+
+	killed, err := docker.Stop(ctx, c.Name, grace)
+	switch {
+	case err == docker.ErrNotFound:
+		return err
+	case err != nil:
+		return fmt.Errorf("could not stop %s: %v", c.ShortName(), err)
+	case killed:
+		logrus.Warnf("%s didn't shut down after %s, it was killed", c.ShortName(), grace)
+	default:
+		logrus.Infof("stopped %s", c.ShortName())
+	}
+	return nil
+}
+
+// stopComponents returns the components with the given names in the order
+// they must be stopped, or all of them if none is given.
+func stopComponents(names []string) ([]components.Component, error) {
+	if len(names) == 0 {
+		return stopOrder(), nil
+	}
+
+	selected := make(map[string]bool)
+	for _, name := range names {
+		c, ok := components.ByName(name)
+		if !ok {
+			return nil, usageErrorf("unknown component %s", name)
+		}
+		selected[c.Name] = true
+	}
+
+	var result []components.Component
+	for _, c := range stopOrder() {
+		if selected[c.Name] {
+			result = append(result, c)
+		}
+	}
+	return result, nil
+}
+
+func init() {
+	rootCmd.AddCommand(stopCmd)
+
+	stopCmd.Flags().Duration("timeout", 0, "time every component is given to shut down before being killed, a default for each component if not given")
+	stopCmd.Flags().Bool("force", false, "kill the components right away without giving them time to shut down")
+}
@@ -0,0 +1,512 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"time"
+
+	homedir "github.com/mitchellh/go-homedir"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// telemetryURL is where the batches of anonymous usage events are sent.
+var telemetryURL = "https://telemetry.sourced.tech/engine/v1/events"
+
+const (
+	// telemetryEnv turns the telemetry on or off, overriding the setting.
+	telemetryEnv = "SRCD_TELEMETRY"
+	// telemetryQueueSize is how many events are kept waiting to be sent,
+	// the oldest ones dropped beyond it.
+	telemetryQueueSize = 100
+	// telemetryBatchSize is how many events must be waiting for a command to
+	// send them.
+	telemetryBatchSize = 10
+	// telemetrySendTimeout is how long sending a batch can take.
+	telemetrySendTimeout = 3 * time.Second
+	// telemetrySendWait is how long a command waits, after its output, for
+	// the batch sent along with it.
+	telemetrySendWait = 300 * time.Millisecond
+)
+
+// Where the setting comes from, see telemetryStatus.
+const (
+	telemetryFromEnv     = "environment"
+	telemetryFromSetting = "setting"
+	telemetryNotAsked    = "not asked"
+)
+
+var telemetryCmd = &cobra.Command{
+	Use:   "telemetry",
+	Short: "Manage the anonymous usage metrics sent to the maintainers",
+	Long: `Manage the anonymous usage metrics sent to the maintainers
+
+The telemetry is off unless it's turned on: the first command run in a
+terminal asks whether to turn it on, and srcd telemetry on or off changes it.
+SRCD_TELEMETRY=1 or 0 overrides the setting, and nothing is asked without a
+terminal.
+
+With it on, an event is kept for every command run, with the name of the
+command, how long it took, whether it failed and its exit code, the OS,
+architecture and version of the engine. Never its arguments, so no paths,
+queries or names of repositories. They are sent in batches in the background,
+and the ones that can't be sent are dropped rather than blocking a command.
+srcd telemetry show-last prints the last event as it's sent.`,
+}
+
+var telemetryStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Print whether the telemetry is on",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		s := currentTelemetryStatus()
+		return newRecordWriter(os.Stdout).write("telemetry", s, func(w io.Writer) error {
+			return printTelemetryStatus(w, s)
+		})
+	},
+}
+
+var telemetryOnCmd = &cobra.Command{
+	Use:   "on",
+	Short: "Send anonymous usage metrics",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return setTelemetry(true)
+	},
+}
+
+var telemetryOffCmd = &cobra.Command{
+	Use:   "off",
+	Short: "Don't send anonymous usage metrics, dropping the ones waiting",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return setTelemetry(false)
+	},
+}
+
+var telemetryShowLastCmd = &cobra.Command{
+	Use:   "show-last",
+	Short: "Print the last event, exactly as it's sent",
+	Long: `Print the last event, exactly as it's sent
+
+The event of the last command run, other than the ones of srcd telemetry, is
+printed in a batch, as the events are sent. It's kept even with
+the telemetry off, only on this machine, so what would be sent can be checked
+before turning it on.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path, err := telemetryFile("telemetry-last.json")
+		if err != nil {
+			return err
+		}
+
+		content, err := ioutil.ReadFile(path)
+		if os.IsNotExist(err) {
+			return notRunningErrorf("no command was run yet")
+		} else if err != nil {
+			return err
+		}
+
+		var ev telemetryEvent
+		if err := json.Unmarshal(content, &ev); err != nil {
+			return fmt.Errorf("invalid last event %s: %v", path, err)
+		}
+
+		return newRecordWriter(os.Stdout).write("telemetry_event", ev, func(w io.Writer) error {
+			content, err := json.MarshalIndent(telemetryBatch{Events: []telemetryEvent{ev}}, "", "  ")
+			if err != nil {
+				return err
+			}
+			_, err = fmt.Fprintf(w, "%s\n", content)
+			return err
+		})
+	},
+}
+
+// telemetryEvent is what's sent of a command run.
+type telemetryEvent struct {
+	// Command is the name of the command, like srcd sql, without its
+	// arguments or flags.
+	Command    string `json:"command"`
+	DurationMS int64  `json:"duration_ms"`
+	Success    bool   `json:"success"`
+	ExitCode   int    `json:"exit_code"`
+	OS         string `json:"os"`
+	Arch       string `json:"arch"`
+	Version    string `json:"version"`
+}
+
+// telemetryBatch is the body of the requests sending the events.
+type telemetryBatch struct {
+	Events []telemetryEvent `json:"events"`
+}
+
+func newTelemetryEvent(cmd *cobra.Command, took time.Duration, code int) telemetryEvent {
+	return telemetryEvent{
+		Command:    cmd.CommandPath(),
+		DurationMS: int64(took / time.Millisecond),
+		Success:    code == exitOK,
+		ExitCode:   code,
+		OS:         runtime.GOOS,
+		Arch:       runtime.GOARCH,
+		Version:    version,
+	}
+}
+
+// telemetrySetting is the answer to whether to turn the telemetry on, kept
+// in ~/.srcd/telemetry.json.
+type telemetrySetting struct {
+	Enabled bool      `json:"enabled"`
+	SetAt   time.Time `json:"set_at"`
+}
+
+// telemetryFile returns the path of the file of the telemetry with the given
+// name in ~/.srcd.
+func telemetryFile(name string) (string, error) {
+	home, err := homedir.Dir()
+	if err != nil {
+		return "", errors.Wrap(err, "unable to get home dir")
+	}
+	return filepath.Join(home, ".srcd", name), nil
+}
+
+// loadTelemetrySetting returns the setting, or nil if it was never set.
+func loadTelemetrySetting() *telemetrySetting {
+	path, err := telemetryFile("telemetry.json")
+	if err != nil {
+		return nil
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+
+	var s telemetrySetting
+	if err := json.Unmarshal(content, &s); err != nil {
+		logrus.Debugf("ignoring invalid telemetry setting %s: %v", path, err)
+		return nil
+	}
+	return &s
+}
+
+func saveTelemetrySetting(enabled bool) error {
+	path, err := telemetryFile("telemetry.json")
+	if err != nil {
+		return err
+	}
+
+	content, err := json.Marshal(telemetrySetting{Enabled: enabled, SetAt: time.Now().UTC()})
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, content, 0644)
+}
+
+// resolveTelemetry returns whether the telemetry is on and where that comes
+// from, given the value of SRCD_TELEMETRY, if set, and the setting, nil if
+// it was never set. It's off unless one of them turns it on.
+func resolveTelemetry(env string, envSet bool, setting *telemetrySetting) (bool, string) {
+	if envSet {
+		enabled, err := strconv.ParseBool(env)
+		return err == nil && enabled, telemetryFromEnv
+	}
+
+	if setting != nil {
+		return setting.Enabled, telemetryFromSetting
+	}
+	return false, telemetryNotAsked
+}
+
+func telemetryEnabled() (bool, string) {
+	env, envSet := os.LookupEnv(telemetryEnv)
+	return resolveTelemetry(env, envSet, loadTelemetrySetting())
+}
+
+// telemetryStatus is whether the telemetry is on, printed by srcd telemetry
+// status.
+type telemetryStatus struct {
+	Enabled bool   `json:"enabled"`
+	Source  string `json:"source"`
+	Queued  int    `json:"queued"`
+	URL     string `json:"url"`
+}
+
+func currentTelemetryStatus() *telemetryStatus {
+	s := &telemetryStatus{URL: telemetryURL}
+	s.Enabled, s.Source = telemetryEnabled()
+	if path, err := telemetryFile("telemetry-queue.jsonl"); err == nil {
+		s.Queued = len(readTelemetryQueue(path))
+	}
+	return s
+}
+
+func printTelemetryStatus(w io.Writer, s *telemetryStatus) error {
+	state := "off"
+	if s.Enabled {
+		state = "on"
+	}
+
+	var source string
+	switch s.Source {
+	case telemetryFromEnv:
+		source = ", set with " + telemetryEnv
+	case telemetryNotAsked:
+		source = ", as it was never turned on"
+	}
+
+	if _, err := fmt.Fprintf(w, "telemetry is %s%s\n", state, source); err != nil {
+		return err
+	}
+
+	if s.Queued > 0 {
+		_, err := fmt.Fprintf(w, "%d events waiting to be sent to %s\n", s.Queued, s.URL)
+		return err
+	}
+	return nil
+}
+
+// setTelemetry turns the telemetry on or off, dropping the events waiting
+// when it's turned off.
+func setTelemetry(enabled bool) error {
+	if err := saveTelemetrySetting(enabled); err != nil {
+		return fmt.Errorf("could not save the telemetry setting: %v", err)
+	}
+
+	state := "off"
+	if enabled {
+		state = "on"
+	} else if path, err := telemetryFile("telemetry-queue.jsonl"); err == nil {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			logrus.Warnf("could not drop the events waiting: %v", err)
+		}
+	}
+
+	if _, ok := os.LookupEnv(telemetryEnv); ok {
+		logrus.Warnf("%s is set, which overrides the setting", telemetryEnv)
+	}
+	logrus.Infof("telemetry is %s", state)
+	return nil
+}
+
+// telemetryExemptCommands are the commands, with their subcommands, that are
+// neither recorded nor ask about the telemetry: srcd telemetry and the ones
+// of the completion, run by the shells. They are told by name, as the
+// commands completing refer to rootCmd.
+var telemetryExemptCommands = map[string]bool{"telemetry": true, "completion": true, "__complete": true}
+
+func telemetryExempt(cmd *cobra.Command) bool {
+	for c := cmd; c != nil && c.HasParent(); c = c.Parent() {
+		if !c.Parent().HasParent() && telemetryExemptCommands[c.Name()] {
+			return true
+		}
+	}
+	return false
+}
+
+// askTelemetry asks whether to turn the telemetry on the first time a
+// command is run in a terminal, unless SRCD_TELEMETRY is set.
+func askTelemetry(cmd *cobra.Command) {
+	if _, ok := os.LookupEnv(telemetryEnv); ok || telemetryExempt(cmd) ||
+		machineOutput() || quiet || !isTerminal(os.Stdin) || !isTerminal(os.Stderr) ||
+		loadTelemetrySetting() != nil {
+		return
+	}
+
+	enabled := askYesNo(bufio.NewReader(os.Stdin), os.Stderr,
+		"Help the maintainers of the engine by sending anonymous usage metrics: the commands "+
+			"run, how long they took and whether they failed, the OS and the version, never any "+
+			"path, query or repository name? It can be changed with srcd telemetry on or off.")
+	if err := saveTelemetrySetting(enabled); err != nil {
+		logrus.Debugf("could not save the telemetry setting: %v", err)
+	}
+}
+
+// telemetrySent is closed when the batch sent along with the command is,
+// nil if there's none.
+var telemetrySent chan struct{}
+
+// startTelemetrySend sends the events waiting in the background, if the
+// telemetry is on and there are enough of them.
+func startTelemetrySend(cmd *cobra.Command) {
+	if enabled, _ := telemetryEnabled(); !enabled || telemetryExempt(cmd) {
+		return
+	}
+
+	path, err := telemetryFile("telemetry-queue.jsonl")
+	if err != nil {
+		return
+	}
+
+	events := readTelemetryQueue(path)
+	if len(events) < telemetryBatchSize {
+		return
+	}
+
+	telemetrySent = make(chan struct{})
+	go func() {
+		defer close(telemetrySent)
+		ctx, cancel := context.WithTimeout(context.Background(), telemetrySendTimeout)
+		defer cancel()
+
+		if err := sendTelemetry(ctx, telemetryURL, events); err != nil {
+			logrus.Debugf("could not send the telemetry: %v", err)
+			return
+		}
+
+		if err := dropTelemetryEvents(path, len(events)); err != nil {
+			logrus.Debugf("could not drop the telemetry sent: %v", err)
+		}
+	}()
+}
+
+// finishTelemetry keeps the event of the command finished, waiting to be
+// sent if the telemetry is on, and waits briefly for the batch sent along
+// with it.
+func finishTelemetry(cmd *cobra.Command, took time.Duration, code int) {
+	if cmd != nil && !telemetryExempt(cmd) {
+		ev := newTelemetryEvent(cmd, took, code)
+		if err := saveLastTelemetryEvent(ev); err != nil {
+			logrus.Debugf("could not keep the telemetry event: %v", err)
+		}
+
+		if enabled, _ := telemetryEnabled(); enabled {
+			path, err := telemetryFile("telemetry-queue.jsonl")
+			if err == nil {
+				err = queueTelemetryEvent(path, ev, telemetryQueueSize)
+			}
+			if err != nil {
+				logrus.Debugf("could not queue the telemetry event: %v", err)
+			}
+		}
+	}
+
+	if telemetrySent == nil {
+		return
+	}
+
+	select {
+	case <-telemetrySent:
+	case <-time.After(telemetrySendWait):
+		logrus.Debug("the telemetry was not sent in time")
+	}
+}
+
+func saveLastTelemetryEvent(ev telemetryEvent) error {
+	path, err := telemetryFile("telemetry-last.json")
+	if err != nil {
+		return err
+	}
+
+	content, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, content, 0644)
+}
+
+// readTelemetryQueue returns the events waiting in the queue at the path, a
+// line of JSON each, skipping the invalid ones.
+func readTelemetryQueue(path string) []telemetryEvent {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+
+	var events []telemetryEvent
+	for _, line := range bytes.Split(content, []byte("\n")) {
+		var ev telemetryEvent
+		if len(line) > 0 && json.Unmarshal(line, &ev) == nil {
+			events = append(events, ev)
+		}
+	}
+	return events
+}
+
+func writeTelemetryQueue(path string, events []telemetryEvent) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, ev := range events {
+		if err := enc.Encode(ev); err != nil {
+			return err
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, buf.Bytes(), 0644)
+}
+
+// queueTelemetryEvent adds the event to the queue at the path, dropping the
+// oldest ones beyond max.
+func queueTelemetryEvent(path string, ev telemetryEvent, max int) error {
+	events := append(readTelemetryQueue(path), ev)
+	if len(events) > max {
+		events = events[len(events)-max:]
+	}
+	return writeTelemetryQueue(path, events)
+}
+
+// dropTelemetryEvents removes the n oldest events of the queue at the path,
+// the ones sent, keeping the ones queued since.
+func dropTelemetryEvents(path string, n int) error {
+	events := readTelemetryQueue(path)
+	if n > len(events) {
+		n = len(events)
+	}
+	return writeTelemetryQueue(path, events[n:])
+}
+
+// sendTelemetry sends the events as a batch to the URL.
+func sendTelemetry(ctx context.Context, url string, events []telemetryEvent) error {
+	body, err := json.Marshal(telemetryBatch{Events: events})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "srcd/"+version)
+
+	res, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected response: %s", res.Status)
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(telemetryCmd)
+	telemetryCmd.AddCommand(telemetryStatusCmd)
+	telemetryCmd.AddCommand(telemetryOnCmd)
+	telemetryCmd.AddCommand(telemetryOffCmd)
+	telemetryCmd.AddCommand(telemetryShowLastCmd)
+}
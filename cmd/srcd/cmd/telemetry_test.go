@@ -0,0 +1,168 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+func TestResolveTelemetry(t *testing.T) {
+	on := &telemetrySetting{Enabled: true}
+	off := &telemetrySetting{Enabled: false}
+
+	testCases := []struct {
+		name     string
+		env      string
+		envSet   bool
+		setting  *telemetrySetting
+		expected bool
+		source   string
+	}{
+		{"never asked", "", false, nil, false, telemetryNotAsked},
+		{"turned on", "", false, on, true, telemetryFromSetting},
+		{"turned off", "", false, off, false, telemetryFromSetting},
+		{"env on", "1", true, off, true, telemetryFromEnv},
+		{"env off", "0", true, on, false, telemetryFromEnv},
+		{"env invalid", "maybe", true, on, false, telemetryFromEnv},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			enabled, source := resolveTelemetry(tc.env, tc.envSet, tc.setting)
+			if enabled != tc.expected || source != tc.source {
+				t.Errorf("expected: %v (%s), got: %v (%s)", tc.expected, tc.source, enabled, source)
+			}
+		})
+	}
+}
+
+func TestNewTelemetryEvent(t *testing.T) {
+	root := &cobra.Command{Use: "srcd"}
+	sql := &cobra.Command{Use: "sql [query]"}
+	root.AddCommand(sql)
+
+	ev := newTelemetryEvent(sql, 1500*time.Millisecond, exitFailed)
+	content, err := json.Marshal(ev)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := fmt.Sprintf(`{"command":"srcd sql","duration_ms":1500,"success":false,"exit_code":5,"os":"%s","arch":"%s","version":"%s"}`,
+		ev.OS, ev.Arch, version)
+	if string(content) != expected {
+		t.Errorf("expected: %s, got: %s", expected, content)
+	}
+}
+
+func TestTelemetryExempt(t *testing.T) {
+	testCases := []struct {
+		args     []string
+		expected bool
+	}{
+		{[]string{"sql"}, false},
+		{[]string{"components", "list"}, false},
+		{[]string{"telemetry", "show-last"}, true},
+		{[]string{"completion"}, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(fmt.Sprint(tc.args), func(t *testing.T) {
+			cmd, _, err := rootCmd.Find(tc.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if result := telemetryExempt(cmd); result != tc.expected {
+				t.Errorf("expected: %v, got: %v", tc.expected, result)
+			}
+		})
+	}
+}
+
+func TestTelemetryQueue(t *testing.T) {
+	dir, err := ioutil.TempDir("", "srcd-telemetry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "queue.jsonl")
+	for i := 0; i < 5; i++ {
+		if err := queueTelemetryEvent(path, telemetryEvent{DurationMS: int64(i)}, 3); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	durations := func() string {
+		var result []int64
+		for _, ev := range readTelemetryQueue(path) {
+			result = append(result, ev.DurationMS)
+		}
+		return fmt.Sprint(result)
+	}
+
+	if result := durations(); result != "[2 3 4]" {
+		t.Errorf("expected the oldest events dropped: [2 3 4], got: %s", result)
+	}
+
+	if err := dropTelemetryEvents(path, 2); err != nil {
+		t.Fatal(err)
+	}
+	if result := durations(); result != "[4]" {
+		t.Errorf("expected the events sent dropped: [4], got: %s", result)
+	}
+
+	if err := dropTelemetryEvents(path, 5); err != nil {
+		t.Fatal(err)
+	}
+	if result := durations(); result != "[]" {
+		t.Errorf("expected: [], got: %s", result)
+	}
+}
+
+func TestSendTelemetry(t *testing.T) {
+	testCases := []struct {
+		name   string
+		status int
+		err    string
+	}{
+		{"sent", http.StatusNoContent, ""},
+		{"rejected", http.StatusBadRequest, "unexpected response: 400 Bad Request"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var received telemetryBatch
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+					t.Error(err)
+				}
+				w.WriteHeader(tc.status)
+			}))
+			defer server.Close()
+
+			events := []telemetryEvent{{Command: "srcd init"}, {Command: "srcd sql"}}
+			err := sendTelemetry(context.Background(), server.URL, events)
+			var errMsg string
+			if err != nil {
+				errMsg = err.Error()
+			}
+			if errMsg != tc.err {
+				t.Fatalf("expected: %s, got: %s", tc.err, errMsg)
+			}
+
+			if len(received.Events) != 2 || received.Events[1].Command != "srcd sql" {
+				t.Errorf("expected: the batch of events, got: %+v", received)
+			}
+		})
+	}
+}
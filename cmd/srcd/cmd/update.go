@@ -0,0 +1,328 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	homedir "github.com/mitchellh/go-homedir"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// latestReleaseURL is the GitHub API endpoint with the latest release of the
+// engine.
+var latestReleaseURL = "https://api.github.com/repos/src-d/engine/releases/latest"
+
+const (
+	// updateCheckInterval is how often the passive check runs.
+	updateCheckInterval = 24 * time.Hour
+	// updateCheckTimeout is how long the requests to GitHub can take.
+	updateCheckTimeout = 3 * time.Second
+	// updateNoticeWait is how long a command waits, after its output, for
+	// the passive check started along with it to finish.
+	updateNoticeWait = 500 * time.Millisecond
+)
+
+var updateCmd = &cobra.Command{
+	Use:   "update",
+	Short: "Check whether there's a new version of the engine",
+	Long: `Check whether there's a new version of the engine
+
+With --check, queries the latest release of the engine on GitHub and prints
+whether it's newer than this one, along with the URL of its changelog.
+
+The other commands can also check it, at most once every 24 hours, and print
+a notice after their output if there's a new version. This is off unless
+enabled with --update-check, SRCD_UPDATE_CHECK=1 or update-check: true in the
+config file, and --no-update-check skips it even then. The proxy given with
+--http-proxy, or in HTTPS_PROXY, is used for the requests, along with the CAs
+of --ca-bundle.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if check, _ := cmd.Flags().GetBool("check"); !check {
+			return errors.New("the engine can't update itself yet, use srcd update --check " +
+				"to find out whether there's a new version to download")
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), updateCheckTimeout)
+		defer cancel()
+
+		r, err := latestRelease(ctx)
+		if err != nil {
+			return fmt.Errorf("could not check for updates: %v", err)
+		}
+
+		saveUpdateCheck(r)
+
+		s := newUpdateStatus(r)
+		err = newRecordWriter(os.Stdout).write("update", s, func(w io.Writer) error {
+			return printUpdateStatus(w, s)
+		})
+		return err
+	},
+}
+
+// release is the latest release of the engine on GitHub.
+type release struct {
+	Tag string `json:"tag_name"`
+	URL string `json:"html_url"`
+}
+
+// latestRelease queries the latest release on GitHub.
+func latestRelease(ctx context.Context) (*release, error) {
+	req, err := http.NewRequest(http.MethodGet, latestReleaseURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+	req.Header.Set("User-Agent", "srcd/"+version)
+
+	res, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected response from GitHub: %s", res.Status)
+	}
+
+	var r release
+	if err := json.NewDecoder(res.Body).Decode(&r); err != nil {
+		return nil, errors.Wrap(err, "invalid response from GitHub")
+	}
+
+	if _, ok := parseSemver(r.Tag); !ok {
+		return nil, fmt.Errorf("invalid version of the latest release: %q", r.Tag)
+	}
+	return &r, nil
+}
+
+// updateStatus says whether the release is newer than the CLI.
+type updateStatus struct {
+	Current   string `json:"current"`
+	Latest    string `json:"latest"`
+	Available bool   `json:"available"`
+	Changelog string `json:"changelog"`
+}
+
+func newUpdateStatus(r *release) *updateStatus {
+	return &updateStatus{
+		Current:   version,
+		Latest:    r.Tag,
+		Available: newerVersion(r.Tag, version),
+		Changelog: r.URL,
+	}
+}
+
+func printUpdateStatus(w io.Writer, s *updateStatus) error {
+	if !s.Available {
+		_, err := fmt.Fprintf(w, "srcd %s is up to date, the latest release is %s\n", s.Current, s.Latest)
+		return err
+	}
+
+	_, err := fmt.Fprintf(w, "a new version of srcd is available: %s, this is %s\nchangelog: %s\n",
+		s.Latest, s.Current, s.Changelog)
+	return err
+}
+
+// newerVersion reports whether the semantic version latest is newer than
+// current. Versions that can't be parsed are never newer.
+func newerVersion(latest, current string) bool {
+	l, ok := parseSemver(latest)
+	if !ok {
+		return false
+	}
+
+	c, ok := parseSemver(current)
+	if !ok {
+		return false
+	}
+
+	for i := range l.numbers {
+		if l.numbers[i] != c.numbers[i] {
+			return l.numbers[i] > c.numbers[i]
+		}
+	}
+
+	// A pre-release, like 1.0.0-beta.1, comes before its release.
+	switch {
+	case l.pre == c.pre:
+		return false
+	case l.pre == "":
+		return true
+	case c.pre == "":
+		return false
+	default:
+		return l.pre > c.pre
+	}
+}
+
+type semver struct {
+	numbers [3]int
+	pre     string
+}
+
+// parseSemver parses versions like v1.2.3 or 1.2.3-beta.1, ignoring the
+// build metadata.
+func parseSemver(v string) (semver, bool) {
+	var s semver
+	v = strings.TrimPrefix(v, "v")
+	if i := strings.Index(v, "+"); i >= 0 {
+		v = v[:i]
+	}
+
+	if i := strings.Index(v, "-"); i >= 0 {
+		v, s.pre = v[:i], v[i+1:]
+	}
+
+	parts := strings.Split(v, ".")
+	if len(parts) != len(s.numbers) {
+		return s, false
+	}
+
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return s, false
+		}
+		s.numbers[i] = n
+	}
+	return s, true
+}
+
+// updateCheck is the last passive check, cached so it runs at most once per
+// updateCheckInterval.
+type updateCheck struct {
+	CheckedAt time.Time `json:"checked_at"`
+	Latest    string    `json:"latest,omitempty"`
+	Changelog string    `json:"changelog,omitempty"`
+}
+
+// updateCheckFile returns where the last check is cached,
+// ~/.srcd/update-check.json.
+func updateCheckFile() (string, error) {
+	home, err := homedir.Dir()
+	if err != nil {
+		return "", errors.Wrap(err, "unable to get home dir")
+	}
+	return filepath.Join(home, ".srcd", "update-check.json"), nil
+}
+
+// lastUpdateCheck returns the cached check, or a zero one if there's none.
+func lastUpdateCheck() updateCheck {
+	var c updateCheck
+	path, err := updateCheckFile()
+	if err != nil {
+		return c
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return c
+	}
+
+	if err := json.Unmarshal(content, &c); err != nil {
+		logrus.Debugf("ignoring invalid update check cache %s: %v", path, err)
+	}
+	return c
+}
+
+// saveUpdateCheck caches a check done now with the release found, which is
+// nil if it failed, so a failure isn't retried until the next interval.
+func saveUpdateCheck(r *release) {
+	c := updateCheck{CheckedAt: time.Now()}
+	if r != nil {
+		c.Latest, c.Changelog = r.Tag, r.URL
+	}
+
+	path, err := updateCheckFile()
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(path), 0755)
+	}
+
+	var content []byte
+	if err == nil {
+		content, err = json.Marshal(c)
+	}
+
+	if err == nil {
+		err = ioutil.WriteFile(path, content, 0644)
+	}
+
+	if err != nil {
+		logrus.Debugf("could not cache the update check: %v", err)
+	}
+}
+
+// updateCheckDue reports whether the passive check has to run again.
+func updateCheckDue(last updateCheck, now time.Time) bool {
+	return now.Sub(last.CheckedAt) >= updateCheckInterval || now.Before(last.CheckedAt)
+}
+
+// updateNotice is the passive check running along with a command. It's nil
+// if there's none.
+var updateNotice chan *release
+
+// startUpdateCheck starts the passive check if it's enabled and due. It's
+// opt-in, and only done for people, not for scripts or machine output.
+func startUpdateCheck(cmd *cobra.Command) {
+	if !viper.GetBool("update-check") || viper.GetBool("no-update-check") || cmd == updateCmd ||
+		machineOutput() || quiet || !isTerminal(os.Stderr) ||
+		!updateCheckDue(lastUpdateCheck(), time.Now()) {
+		return
+	}
+
+	updateNotice = make(chan *release, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), updateCheckTimeout)
+		defer cancel()
+
+		r, err := latestRelease(ctx)
+		if err != nil {
+			logrus.Debugf("could not check for updates: %v", err)
+		}
+
+		saveUpdateCheck(r)
+		updateNotice <- r
+	}()
+}
+
+// printUpdateNotice prints a line to stderr if the passive check found a new
+// version. It waits for it only briefly, so it's skipped if the network is
+// slow.
+func printUpdateNotice() {
+	if updateNotice == nil {
+		return
+	}
+
+	select {
+	case r := <-updateNotice:
+		if r != nil && newerVersion(r.Tag, version) {
+			fmt.Fprintf(os.Stderr, "\nsrcd %s is available, this is %s: %s\n", r.Tag, version, r.URL)
+		}
+	case <-time.After(updateNoticeWait):
+		logrus.Debug("the update check did not finish in time")
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(updateCmd)
+	updateCmd.Flags().Bool("check", false, "check whether there's a newer release")
+
+	rootCmd.PersistentFlags().Bool("update-check", false, "check for new versions of the engine once a day")
+	bindConfig("update-check", rootCmd.PersistentFlags().Lookup("update-check"))
+	rootCmd.PersistentFlags().Bool("no-update-check", false, "don't check for new versions of the engine, even if update-check is enabled")
+	bindConfig("no-update-check", rootCmd.PersistentFlags().Lookup("no-update-check"))
+}
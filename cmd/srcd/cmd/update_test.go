@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNewerVersion(t *testing.T) {
+	testCases := []struct {
+		latest, current string
+		expected        bool
+	}{
+		{"v0.0.2", "0.0.1", true},
+		{"v0.1.0", "0.0.9", true},
+		{"v1.0.0", "0.10.0", true},
+		{"v0.0.1", "0.0.1", false},
+		{"v0.0.1", "0.0.2", false},
+		{"v0.10.0", "0.9.0", true},
+		{"v1.0.0", "1.0.0-beta.1", true},
+		{"v1.0.0-beta.2", "1.0.0-beta.1", true},
+		{"v1.0.0-beta.1", "1.0.0", false},
+		{"v1.0.0+build.2", "1.0.0", false},
+		{"latest", "0.0.1", false},
+		{"v0.0.2", "undefined", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.latest+" "+tc.current, func(t *testing.T) {
+			if got := newerVersion(tc.latest, tc.current); got != tc.expected {
+				t.Errorf("expected: %v, got: %v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestLatestRelease(t *testing.T) {
+	testCases := []struct {
+		name     string
+		status   int
+		body     string
+		expected string
+	}{
+		{"ok", http.StatusOK,
+			`{"tag_name":"v0.1.0","html_url":"https://github.com/src-d/engine/releases/tag/v0.1.0"}`,
+			"v0.1.0 https://github.com/src-d/engine/releases/tag/v0.1.0"},
+		{"rate limited", http.StatusForbidden, `{}`, "error"},
+		{"invalid tag", http.StatusOK, `{"tag_name":"nightly"}`, "error"},
+		{"invalid body", http.StatusOK, `<html>`, "error"},
+	}
+
+	defer func(url string) { latestReleaseURL = url }(latestReleaseURL)
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tc.status)
+				fmt.Fprint(w, tc.body)
+			}))
+			defer server.Close()
+			latestReleaseURL = server.URL
+
+			got := "error"
+			if r, err := latestRelease(context.Background()); err == nil {
+				got = r.Tag + " " + r.URL
+			}
+
+			if got != tc.expected {
+				t.Errorf("expected: %s, got: %s", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestUpdateCheckDue(t *testing.T) {
+	now := time.Now()
+	testCases := []struct {
+		name      string
+		checkedAt time.Time
+		expected  bool
+	}{
+		{"never", time.Time{}, true},
+		{"an hour ago", now.Add(-time.Hour), false},
+		{"yesterday", now.Add(-25 * time.Hour), true},
+		{"in the future", now.Add(time.Hour), true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := updateCheckDue(updateCheck{CheckedAt: tc.checkedAt}, now)
+			if got != tc.expected {
+				t.Errorf("expected: %v, got: %v", tc.expected, got)
+			}
+		})
+	}
+}
@@ -17,47 +17,190 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	api "github.com/src-d/engine/api"
 	"github.com/src-d/engine/cmd/srcd/daemon"
+	"github.com/src-d/engine/components"
+	"github.com/src-d/engine/docker"
 )
 
 const version = "0.0.1"
 
+// versionUnavailable is printed for the versions that can't be found.
+const versionUnavailable = "unavailable"
+
 // versionCmd represents the version command
 var versionCmd = &cobra.Command{
 	Use:   "version",
 	Short: "Show the version information",
-	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Printf("srcd cli version: %s\n", version)
-		if v, err := daemon.DockerVersion(); err != nil {
-			fmt.Printf("could not get docker version: %s\n", err)
-		} else {
-			fmt.Printf("docker version: %s\n", v)
+	Long: `Show the version information
+
+Prints the version of the CLI, of the daemon, of docker and of the images of
+the components, installed and running, to paste into bug reports. The versions
+that can't be found, like the one of the daemon when it's not running, are
+printed as unavailable.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if short, _ := cmd.Flags().GetBool("short"); short && !machineOutput() {
+			fmt.Println(version)
+			return nil
 		}
 
-		if ok, err := daemon.IsRunning(); err != nil {
-			fmt.Printf("could not get srcd daemon version: %s\n", err)
-			return
-		} else if !ok {
-			fmt.Printf("srcd daemon version: not running\n")
-			return
+		report := collectVersions()
+
+		var err error
+		if asJSON, _ := cmd.Flags().GetBool("json"); asJSON {
+			err = printJSON(os.Stdout, report)
+		} else {
+			err = newRecordWriter(os.Stdout).write("version", report, func(w io.Writer) error {
+				return printVersions(w, report)
+			})
 		}
+		return err
+	},
+}
+
+// versionReport has the versions of everything the engine runs on. The ones
+// that can't be found are null in JSON.
+type versionReport struct {
+	CLI       string  `json:"cli"`
+	Daemon    *string `json:"daemon"`
+	Docker    *string `json:"docker"`
+	DockerAPI *string `json:"docker_api"`
+	// Components is nil if docker can't be reached.
+	Components []*components.Version `json:"components"`
+}
+
+// collectVersions returns the versions that can be found, logging why the
+// others can't.
+func collectVersions() *versionReport {
+	report := &versionReport{CLI: version}
+
+	apiVersion, err := docker.Version()
+	if err != nil {
+		logrus.Debugf("could not get docker version: %v", err)
+		return report
+	}
+	report.DockerAPI = &apiVersion
+
+	if v, err := docker.ServerVersion(); err != nil {
+		logrus.Debugf("could not get docker version: %v", err)
+	} else {
+		report.Docker = &v
+	}
 
-		client, err := daemon.Client()
+	if v, err := daemonVersion(); err != nil {
+		logrus.Debugf("could not get srcd daemon version: %v", err)
+	} else {
+		report.Daemon = &v
+	}
+
+	report.Components = []*components.Version{}
+	for _, c := range append([]components.Component{components.Daemon}, components.All...) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		v, err := components.GetVersion(ctx, c)
+		cancel()
 		if err != nil {
-			logrus.Fatal(err)
+			logrus.Debugf("could not get the version of %s: %v", c.ShortName(), err)
+			v = &components.Version{Name: c.ShortName(), Image: c.ImageName()}
 		}
-		res, err := client.Version(context.Background(), &api.VersionRequest{})
-		if err != nil {
-			logrus.Fatal(err)
+
+		report.Components = append(report.Components, v)
+	}
+
+	return report
+}
+
+// daemonVersion returns the version reported by the daemon.
+func daemonVersion() (string, error) {
+	if ok, err := daemon.IsRunning(); err != nil {
+		return "", err
+	} else if !ok {
+		return "", fmt.Errorf("the daemon is not running")
+	}
+
+	client, err := daemon.RunningClient()
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	res, err := client.Version(ctx, &api.VersionRequest{})
+	if err != nil {
+		return "", err
+	}
+	return res.Version, nil
+}
+
+func printVersions(w io.Writer, r *versionReport) error {
+	dockerVersion := versionUnavailable
+	if r.Docker != nil && r.DockerAPI != nil {
+		dockerVersion = fmt.Sprintf("%s (API %s)", *r.Docker, *r.DockerAPI)
+	} else if r.DockerAPI != nil {
+		dockerVersion = fmt.Sprintf("API %s", *r.DockerAPI)
+	}
+
+	fmt.Fprintf(w, "srcd cli version: %s\n", r.CLI)
+	fmt.Fprintf(w, "srcd daemon version: %s\n", orUnavailable(r.Daemon))
+	fmt.Fprintf(w, "docker version: %s\n", dockerVersion)
+
+	if r.Components == nil {
+		_, err := fmt.Fprintf(w, "components: %s\n", versionUnavailable)
+		return err
+	}
+
+	fmt.Fprintln(w)
+	tw := new(tabwriter.Writer)
+	tw.Init(w, 0, 8, 5, '\t', 0)
+	fmt.Fprintln(tw, "COMPONENT\tINSTALLED\tRUNNING")
+	fmt.Fprintln(tw, "----------\t----------\t----------")
+	var pinned []string
+	for _, v := range r.Components {
+		name := v.Name
+		if v.PinnedVersion != nil {
+			name += " (pinned)"
+			pinned = append(pinned, pinnedVersionItem(v.Name, *v.PinnedVersion))
 		}
-		fmt.Printf("srcd daemon version: %s\n", res.Version)
-	},
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", name, imageVersionString(v.Installed), imageVersionString(v.Running))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	printList(w, "pinned versions, unpin them with srcd init --<component>-version default", pinned)
+	return nil
+}
+
+func orUnavailable(s *string) string {
+	if s == nil {
+		return versionUnavailable
+	}
+	return *s
+}
+
+// imageVersionString returns the tag and the short digest of the version,
+// like latest (1a2b3c4d5e6f), or a dash if it's nil.
+func imageVersionString(v *components.ImageVersion) string {
+	switch {
+	case v == nil:
+		return "-"
+	case v.Digest == nil:
+		return v.Tag
+	default:
+		return fmt.Sprintf("%s (%s)", v.Tag, shortDigest(*v.Digest))
+	}
 }
 
 func init() {
 	rootCmd.AddCommand(versionCmd)
+	versionCmd.Flags().Bool("short", false, "print only the version of the CLI")
+	versionCmd.Flags().Bool("json", false, "print all the versions as JSON")
 }
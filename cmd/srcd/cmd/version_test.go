@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/src-d/engine/components"
+)
+
+func TestPrintVersions(t *testing.T) {
+	dockerVersion, api := "18.09.1", "1.39"
+	digest := "sha256:1a2b3c4d5e6f7a8b9c0d"
+	pinned := "v0.24.0"
+	testCases := []struct {
+		name     string
+		report   *versionReport
+		expected []string
+	}{
+		{
+			"no docker",
+			&versionReport{CLI: "0.0.1"},
+			[]string{
+				"srcd cli version: 0.0.1",
+				"srcd daemon version: unavailable",
+				"docker version: unavailable",
+				"components: unavailable",
+			},
+		},
+		{
+			"components",
+			&versionReport{
+				CLI:       "0.0.1",
+				Docker:    &dockerVersion,
+				DockerAPI: &api,
+				Components: []*components.Version{
+					{
+						Name:      "gitbase",
+						Installed: &components.ImageVersion{Tag: "v0.19.0", Digest: &digest},
+						Running:   &components.ImageVersion{Tag: "v0.18.0"},
+					},
+					{Name: "pilosa"},
+				},
+			},
+			[]string{
+				"srcd cli version: 0.0.1",
+				"srcd daemon version: unavailable",
+				"docker version: 18.09.1 (API 1.39)",
+				"",
+				"COMPONENT     INSTALLED                  RUNNING",
+				"----------    ----------                 ----------",
+				"gitbase       v0.19.0 (1a2b3c4d5e6f)     v0.18.0",
+				"pilosa        -                          -",
+			},
+		},
+		{
+			"pinned",
+			&versionReport{
+				CLI:       "0.0.1",
+				Docker:    &dockerVersion,
+				DockerAPI: &api,
+				Components: []*components.Version{
+					{
+						Name:          "gitbase",
+						Installed:     &components.ImageVersion{Tag: "v0.24.0"},
+						PinnedVersion: &pinned,
+					},
+				},
+			},
+			[]string{
+				"srcd cli version: 0.0.1",
+				"srcd daemon version: unavailable",
+				"docker version: 18.09.1 (API 1.39)",
+				"",
+				"COMPONENT            INSTALLED     RUNNING",
+				"----------           ----------    ----------",
+				"gitbase (pinned)     v0.24.0       -",
+				"",
+				"pinned versions, unpin them with srcd init --<component>-version default:",
+				"  gitbase: v0.24.0",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := printVersions(&buf, tc.report); err != nil {
+				t.Fatal(err)
+			}
+
+			// The columns are padded with tabs, only the fields are compared.
+			lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+			if len(lines) != len(tc.expected) {
+				t.Fatalf("expected:\n%s\ngot:\n%s", strings.Join(tc.expected, "\n"), buf.String())
+			}
+
+			for i, line := range lines {
+				expected := strings.Join(strings.Fields(tc.expected[i]), " ")
+				if got := strings.Join(strings.Fields(line), " "); got != expected {
+					t.Errorf("expected: %s, got: %s", expected, got)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,242 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/src-d/engine/cmd/srcd/daemon"
+	"github.com/src-d/engine/components"
+	"github.com/src-d/engine/docker"
+)
+
+const (
+	// defaultWaitTimeout is how long srcd wait waits for the components by
+	// default.
+	defaultWaitTimeout = 10 * time.Minute
+	// waitPollInterval is how often srcd wait checks the components, and
+	// waitProgressInterval how often it says which ones it's waiting for.
+	waitPollInterval     = time.Second
+	waitProgressInterval = 10 * time.Second
+)
+
+var waitCmd = &cobra.Command{
+	Use:   "wait",
+	Short: "Wait until the components are ready",
+	Long: `Wait until the components are ready
+
+Blocks until the components given with --for, or else the daemon and every
+component enabled by the last srcd init, are running and pass their health
+checks, and gitbase answers queries, so scripts can run srcd init && srcd wait
+&& srcd sql instead of sleeping. Every few seconds it says which components it
+is still waiting for and why.
+
+It fails right away if a component is not created, or was disabled by srcd
+init, as it would never get ready without running srcd init again, and when
+the timeout is over, with the reason every component is not ready.`,
+	Example: `  srcd wait
+  srcd wait --for gitbase,bblfshd --timeout 5m`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		names, _ := cmd.Flags().GetStringSlice("for")
+		timeout, _ := cmd.Flags().GetDuration("timeout")
+		if timeout <= 0 {
+			return usageErrorf("invalid --timeout %s: it must be positive", timeout)
+		}
+
+		cfg, err := daemon.Running()
+		if err != nil {
+			return err
+		}
+		if cfg == nil {
+			return notRunningErrorf("the engine is not initialized; run srcd init first")
+		}
+
+		cmps, err := waitComponents(names, cfg)
+		if err != nil {
+			return err
+		}
+
+		start := time.Now()
+		deadline := start.Add(timeout)
+		lastProgress := start
+		for {
+			reasons, err := waitReasons(cmps, cfg)
+			if err != nil {
+				return err
+			}
+
+			if missing := fatalWaitReasons(reasons); len(missing) > 0 {
+				return notRunningErrorf("%s; run srcd init to create the components, "+
+					"enabling the ones needed", strings.Join(missing, ", "))
+			}
+
+			pending := pendingWaitReasons(reasons)
+			if len(pending) == 0 {
+				break
+			}
+
+			now := time.Now()
+			if now.After(deadline) {
+				return notRunningErrorf("not ready after %s: %s", timeout, strings.Join(pending, ", "))
+			}
+
+			if now.Sub(lastProgress) >= waitProgressInterval {
+				logrus.Infof("still waiting after %s: %s",
+					now.Sub(start).Round(time.Second), strings.Join(pending, ", "))
+				lastProgress = now
+			}
+			time.Sleep(waitPollInterval)
+		}
+
+		res := waitResult{Waited: time.Since(start).Round(time.Second).String()}
+		for _, c := range cmps {
+			res.Components = append(res.Components, c.ShortName())
+		}
+		return newRecordWriter(os.Stdout).write("ready", res, func(w io.Writer) error {
+			_, err := fmt.Fprintf(w, "%s ready after %s\n", strings.Join(res.Components, ", "), res.Waited)
+			return err
+		})
+	},
+}
+
+// waitResult is what srcd wait waited for, and for how long.
+type waitResult struct {
+	Components []string `json:"components"`
+	Waited     string   `json:"waited"`
+}
+
+// waitReason is why a component is not ready yet. Fatal ones, like not being
+// created, don't go away without running srcd init.
+type waitReason struct {
+	name   string
+	reason string
+	fatal  bool
+}
+
+func (r waitReason) String() string {
+	return fmt.Sprintf("%s is %s", r.name, r.reason)
+}
+
+// waitComponents returns the components with the given names, or else the
+// daemon and the ones enabled in the configuration.
+func waitComponents(names []string, cfg *daemon.Config) ([]components.Component, error) {
+	if len(names) == 0 {
+		cmps := []components.Component{components.Daemon}
+		for _, c := range initComponentsOrder() {
+			if cfg.Enabled(c.Name) {
+				cmps = append(cmps, c)
+			}
+		}
+		return cmps, nil
+	}
+
+	var cmps []components.Component
+	seen := make(map[string]bool)
+	for _, name := range names {
+		c, ok := components.ByName(strings.TrimSpace(name))
+		if !ok {
+			return nil, usageErrorf("unknown component %s, it must be one of %s",
+				name, strings.Join(components.Names(), ", "))
+		}
+		if !seen[c.Name] {
+			seen[c.Name] = true
+			cmps = append(cmps, c)
+		}
+	}
+	return cmps, nil
+}
+
+// waitReasons returns why the components are not ready yet, none for the
+// ones that are. A component is ready when it's running and healthy, and
+// gitbase also when it accepts connections.
+func waitReasons(cmps []components.Component, cfg *daemon.Config) ([]waitReason, error) {
+	var reasons []waitReason
+	for _, c := range cmps {
+		ctx, cancel := context.WithTimeout(context.Background(), statusTimeout)
+		s, err := components.GetStatus(ctx, c, false)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+
+		markDisabled([]*components.Status{s}, cfg)
+		r, ready := waitReasonOf(c.ShortName(), s)
+		if ready && c.Name == components.Gitbase.Name {
+			if err := probeGitbase(ctx, cfg); err != nil {
+				r, ready = waitReason{c.ShortName(), fmt.Sprintf("not answering yet (%v)", err), false}, false
+			}
+		}
+		cancel()
+
+		if !ready {
+			reasons = append(reasons, r)
+		}
+	}
+	return reasons, nil
+}
+
+// probeGitbase checks that gitbase accepts connections.
+func probeGitbase(ctx context.Context, cfg *daemon.Config) error {
+	info, err := docker.Inspect(ctx, components.Gitbase.Name)
+	if err != nil {
+		return err
+	}
+
+	addr, ok := components.GitbaseAddress(info, daemon.RemoteDockerHost())
+	if !ok {
+		return fmt.Errorf("the port of gitbase is not published")
+	}
+
+	user := valueOrDefault(cfg.Gitbase.User, components.DefaultGitbaseUser)
+	return components.ProbeGitbase(ctx, addr, user, cfg.Gitbase.Password)
+}
+
+// waitReasonOf returns why the component with the given status is not ready,
+// and false, or true if it's healthy.
+func waitReasonOf(name string, s *components.Status) (waitReason, bool) {
+	switch {
+	case s.State == components.StateNotCreated:
+		return waitReason{name, "not created", true}, false
+	case s.State == components.StateDisabled:
+		return waitReason{name, "disabled by srcd init", true}, false
+	case s.State != components.StateRunning:
+		return waitReason{name, s.State, false}, false
+	case s.Health == components.HealthNone || s.Health == types.Healthy:
+		return waitReason{}, true
+	default:
+		return waitReason{name, s.Health, false}, false
+	}
+}
+
+// fatalWaitReasons returns the reasons that won't go away without srcd init.
+func fatalWaitReasons(reasons []waitReason) []string {
+	var result []string
+	for _, r := range reasons {
+		if r.fatal {
+			result = append(result, r.String())
+		}
+	}
+	return result
+}
+
+// pendingWaitReasons returns all the reasons as text.
+func pendingWaitReasons(reasons []waitReason) []string {
+	var result []string
+	for _, r := range reasons {
+		result = append(result, r.String())
+	}
+	return result
+}
+
+func init() {
+	rootCmd.AddCommand(waitCmd)
+	waitCmd.Flags().StringSlice("for", nil, "components to wait for, like gitbase,bblfshd (defaults to the daemon and the ones enabled by srcd init)")
+	waitCmd.Flags().Duration("timeout", defaultWaitTimeout, "how long to wait for the components to be ready before failing")
+}
@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/src-d/engine/cmd/srcd/daemon"
+	"github.com/src-d/engine/components"
+)
+
+func TestWaitComponents(t *testing.T) {
+	testCases := []struct {
+		name     string
+		names    []string
+		cfg      *daemon.Config
+		expected string
+		err      string
+	}{
+		{"all initialized", nil, &daemon.Config{}, "[daemon bblfshd pilosa gitbase]", ""},
+		{"some initialized", nil, &daemon.Config{Components: []string{components.Gitbase.Name}}, "[daemon gitbase]", ""},
+		{"given", []string{"gitbase", "bblfshd", "gitbase"}, &daemon.Config{}, "[gitbase bblfshd]", ""},
+		{"unknown", []string{"gitbase", "mysql"}, &daemon.Config{}, "",
+			"unknown component mysql, it must be one of " + strings.Join(components.Names(), ", ")},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cmps, err := waitComponents(tc.names, tc.cfg)
+			var errMsg string
+			if err != nil {
+				errMsg = err.Error()
+			}
+			if errMsg != tc.err {
+				t.Fatalf("expected: %s, got: %s", tc.err, errMsg)
+			}
+
+			var names []string
+			for _, c := range cmps {
+				names = append(names, c.ShortName())
+			}
+			if err == nil && fmt.Sprint(names) != tc.expected {
+				t.Errorf("expected: %s, got: %v", tc.expected, names)
+			}
+		})
+	}
+}
+
+func TestWaitReasonOf(t *testing.T) {
+	testCases := []struct {
+		state  string
+		health string
+		ready  bool
+		reason string
+		fatal  bool
+	}{
+		{components.StateRunning, "healthy", true, "", false},
+		{components.StateRunning, components.HealthNone, true, "", false},
+		{components.StateRunning, "starting", false, "gitbase is starting", false},
+		{components.StateRunning, "unhealthy", false, "gitbase is unhealthy", false},
+		{components.StateStopped, components.HealthNone, false, "gitbase is stopped", false},
+		{components.StateNotCreated, components.HealthNone, false, "gitbase is not created", true},
+		{components.StateDisabled, components.HealthNone, false, "gitbase is disabled by srcd init", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.state+" "+tc.health, func(t *testing.T) {
+			s := &components.Status{Name: components.Gitbase.Name, State: tc.state, Health: tc.health}
+			r, ready := waitReasonOf("gitbase", s)
+			if ready != tc.ready {
+				t.Fatalf("expected ready: %v, got: %v", tc.ready, ready)
+			}
+
+			if !ready && (r.String() != tc.reason || r.fatal != tc.fatal) {
+				t.Errorf("expected: %s (fatal: %v), got: %s (fatal: %v)", tc.reason, tc.fatal, r, r.fatal)
+			}
+		})
+	}
+}
+
+func TestFatalWaitReasons(t *testing.T) {
+	reasons := []waitReason{
+		{"daemon", "starting", false},
+		{"gitbase", "not created", true},
+		{"pilosa", "disabled by srcd init", true},
+	}
+
+	expected := "[gitbase is not created pilosa is disabled by srcd init]"
+	if result := fmt.Sprint(fatalWaitReasons(reasons)); result != expected {
+		t.Errorf("expected: %s, got: %s", expected, result)
+	}
+
+	expected = "[daemon is starting gitbase is not created pilosa is disabled by srcd init]"
+	if result := fmt.Sprint(pendingWaitReasons(reasons)); result != expected {
+		t.Errorf("expected: %s, got: %s", expected, result)
+	}
+
+	if result := fatalWaitReasons(reasons[:1]); len(result) != 0 {
+		t.Errorf("expected: no fatal reasons, got: %v", result)
+	}
+}
@@ -24,10 +24,12 @@ import (
 	api "github.com/src-d/engine/api"
 	"github.com/src-d/engine/cmd/srcd/daemon"
 	"github.com/src-d/engine/components"
+	"github.com/src-d/engine/docker"
 
 	"github.com/pkg/browser"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 )
 
 var webCmd = &cobra.Command{
@@ -35,65 +37,331 @@ var webCmd = &cobra.Command{
 	Short: "Start web interfaces for source{d} tools",
 }
 
+// webClient is a web client of srcd web, named after its subcommand.
+type webClient struct {
+	ui   string
+	c    components.Component
+	desc string
+}
+
+// webClients are the web clients in the order they are listed.
+var webClients = []webClient{
+	{"sql", components.GitbaseWeb, "gitbase web client"},
+	{"parse", components.BblfshWeb, "bblfsh web client"},
+}
+
+// setting returns the key of the setting of the web client with the given
+// name, like web.sql.port.
+func (w webClient) setting(name string) string {
+	return "web." + w.ui + "." + name
+}
+
 var webSQLCmd = &cobra.Command{
 	Use:   "sql",
 	Short: "Start gitbase web client",
-	Run:   startWebComponent(components.GitbaseWeb.Name, "gitbase web client"),
+	Long: `Start gitbase web client
+
+With --web-base-path, it's served under a path, like /engine/sql, behind a
+reverse proxy passing the requests on with the path kept, not stripped. The
+URL it's reached at there, like https://tools.internal/engine/sql, can be
+given instead of the path, so it's the one printed. gitbase-web v0.7.0 or
+newer is needed. With nginx:
+
+    location /engine/sql/ {
+        proxy_pass http://127.0.0.1:8080;
+        proxy_set_header Host $host;
+        proxy_set_header X-Forwarded-Proto $scheme;
+    }
+
+With the file provider of traefik:
+
+    [http.routers.engine-sql]
+      rule = "PathPrefix(` + "`/engine/sql`" + `)"
+      service = "engine-sql"
+    [[http.services.engine-sql.loadBalancer.servers]]
+      url = "http://127.0.0.1:8080"`,
+	RunE: startWebComponent(webClients[0]),
 }
 
 var webParseCmd = &cobra.Command{
 	Use:   "parse",
 	Short: "Start bblfsh web client",
-	Run:   startWebComponent(components.BblfshWeb.Name, "bblfsh web client"),
+	RunE:  startWebComponent(webClients[1]),
 }
 
-func startWebComponent(name, desc string) func(cmd *cobra.Command, args []string) {
-	return func(cmd *cobra.Command, args []string) {
-		c, err := daemon.Client()
+// startWebComponent returns the command starting a web client, see
+// startWebClient, and waiting for Ctrl-C to stop it. The URL printed is
+// opened in the browser once the web client serves it, unless --no-browser is
+// given or docker runs on another machine.
+func startWebComponent(client webClient) func(cmd *cobra.Command, args []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		cmp, desc := client.c, client.desc
+		w, err := startWebClient(cmd, client)
 		if err != nil {
-			logrus.Fatalf("could not get daemon client: %v", err)
+			return err
 		}
 
-		started := make(chan struct{})
-		go func() {
-			select {
-			case <-time.After(3 * time.Second):
-				logrus.Info("this is taking a while, if this is the first time you launch this web client, it might take a few more minutes while we install all the required images")
-			case <-started:
-			}
-		}()
+		ch := make(chan os.Signal, 1)
+		signal.Notify(ch, os.Interrupt, os.Kill)
+
+		fmt.Printf("Go to %s for the %s. Press Ctrl-C to stop it.\n", w.url, desc)
+		noBrowser, _ := cmd.Flags().GetBool("no-browser")
+		if w.browsable(noBrowser) {
+			go openWhenReady(cmp.Name, w.probe, w.url)
+		}
+
+		if !waitForInterrupt(ch, cmp.Name) {
+			logrus.Infof("the %s was stopped", desc)
+			return nil
+		}
+
+		c, err := daemon.Client()
+		if err != nil {
+			return fmt.Errorf("could not get daemon client: %v", err)
+		}
 
-		// Might have to pull some images
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+		defer cancel()
 
-		port, _ := cmd.Flags().GetUint("port")
-		_, err = c.StartComponent(ctx, &api.StartComponentRequest{
-			Name: name,
-			Port: int32(port),
-		})
-		close(started)
+		_, err = c.StopComponent(ctx, &api.StopComponentRequest{Name: cmp.Name})
 		if err != nil {
-			cancel()
-			logrus.Fatalf("could not start %s at port %d: %v", desc, port, err)
+			return operationFailed(fmt.Errorf("could not stop %s at port %d: %v", desc, w.port, err))
 		}
-		cancel()
+		return nil
+	}
+}
 
-		fmt.Printf("Go to http://localhost:%d for the %s. Press Ctrl-C to stop it.\n", port, desc)
-		_ = browser.OpenURL(fmt.Sprintf("http://localhost:%d", port))
+// startedWebClient is a web client started by srcd web.
+type startedWebClient struct {
+	desc string
+	// url is the one of its container, or the one given with
+	// --web-base-path, with the token if it has one.
+	url string
+	// probe is the URL of its container, checked to serve its page.
+	probe string
+	port  int
+	bind  string
+	// remote is the host docker runs on if it's another machine.
+	remote string
+}
 
-		ch := make(chan os.Signal)
-		signal.Notify(ch, os.Interrupt, os.Kill)
+// startWebClient starts the web client at the port of its setting, or the next free one with --auto-ports, published on the
+// loopback unless --expose-web is given, and served over HTTPS by a proxy
+// with --tls, which only serves the requests with the token with --web-auth
+// token, under the path of --web-base-path, if any. Its container is created
+// again if it's published on another port or address.
+func startWebClient(cmd *cobra.Command, client webClient) (*startedWebClient, error) {
+	cmp, desc := client.c, client.desc
+	name := cmp.Name
+	bind, err := components.ParseExposeAddress(viper.GetString("web.expose"))
+	if err != nil {
+		return nil, usageErrorf("invalid value of --expose-web %q: %v", viper.GetString("web.expose"), err)
+	}
+	if bind == "" {
+		bind = components.WebDefaultBind
+	}
 
-		<-ch
-		close(ch)
+	creds := &webTLS{}
+	if viper.GetBool("web.tls") {
+		if creds, err = loadWebTLS(bind); err != nil {
+			return nil, err
+		}
+	}
 
-		ctx, cancel = context.WithTimeout(context.Background(), 10*time.Minute)
-		defer cancel()
+	if err := checkWebAuth(viper.GetString("web.auth")); err != nil {
+		return nil, usageErrorf("invalid value of --web-auth %q: %v", viper.GetString("web.auth"), err)
+	}
+
+	var token string
+	if webAuthEnabled(cmp) {
+		if token, err = webToken(false); err != nil {
+			return nil, err
+		}
+	}
+
+	base, public, err := parseWebBasePath(viper.GetString(client.setting("base-path")))
+	if err != nil {
+		return nil, usageErrorf("invalid value of --web-base-path %q: %v", viper.GetString(client.setting("base-path")), err)
+	}
+	if base != "" {
+		if err := checkWebBasePath(cmp); err != nil {
+			return nil, err
+		}
+	}
+
+	auto, _ := cmd.Flags().GetBool("auto-ports")
+	port, err := availableWebPort(cmp, viper.GetInt(client.setting("port")), auto)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := daemon.Client()
+	if err != nil {
+		return nil, fmt.Errorf("could not get daemon client: %v", err)
+	}
+
+	started := make(chan struct{})
+	go func() {
+		select {
+		case <-time.After(3 * time.Second):
+			logrus.Info("this is taking a while, if this is the first time you launch this web client, it might take a few more minutes while we install all the required images")
+		case <-started:
+		}
+	}()
 
-		_, err = c.StopComponent(ctx, &api.StopComponentRequest{Name: name})
+	// Might have to pull some images
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+
+	_, err = c.StartComponent(ctx, &api.StartComponentRequest{
+		Name:        name,
+		Port:        int32(port),
+		BindAddress: bind,
+		TlsCert:     creds.cert,
+		TlsKey:      creds.key,
+		WebToken:    token,
+		WebBasePath: base,
+	})
+	close(started)
+	cancel()
+	if err != nil {
+		return nil, operationFailed(fmt.Errorf("could not start %s at port %d: %v", desc, port, err))
+	}
+
+	host := "localhost"
+	remote := daemon.RemoteDockerHost()
+	if remote != "" {
+		host = remote
+	}
+
+	scheme := "http"
+	if creds.cert != "" {
+		scheme = "https"
+	}
+	probe := fmt.Sprintf("%s://%s:%d%s", scheme, components.URLHost(bind, host), port, base)
+	if info, err := docker.Info(name); err == nil {
+		if u, ok := components.WebURL(info, host); ok {
+			probe = u
+		}
+	}
+
+	url := probe
+	if public != "" {
+		url = public
+	}
+
+	if token != "" {
+		probe, url = withToken(probe, token), withToken(url, token)
+	}
+
+	switch {
+	case components.IsLoopback(bind):
+	case token == "":
+		logrus.Warnf("the %s has no authentication and is %s: anyone reaching this host on port %d can use it; "+
+			"run it without --expose-web to keep it on the loopback", desc, components.BindDescription(bind), port)
+	case creds.cert == "":
+		logrus.Warnf("the %s is %s and its token is sent over HTTP; give --tls to serve it over HTTPS",
+			desc, components.BindDescription(bind))
+	}
+
+	if creds.generated {
+		logrus.Infof("the %s is served with the self-signed certificate %s, "+
+			"which the browser asks to trust the first time", desc, creds.path)
+	}
+
+	return &startedWebClient{desc: desc, url: url, probe: probe, port: port, bind: bind, remote: remote}, nil
+}
+
+// browsable reports whether the browser is opened onto the web client, which
+// it's not with noBrowser or when docker runs on another machine, logging
+// why.
+func (w *startedWebClient) browsable(noBrowser bool) bool {
+	switch {
+	case w.remote != "" && components.IsLoopback(w.bind):
+		logrus.Warnf("docker runs on %s and the %s is %s, so it's only reached from that machine; "+
+			"give --expose-web to reach it from here", w.remote, w.desc, components.BindDescription(w.bind))
+		return false
+	case noBrowser:
+		return false
+	case w.remote != "":
+		logrus.Infof("docker runs on %s, so the browser is not opened here", w.remote)
+		return false
+	default:
+		return true
+	}
+}
+
+// webStoppedInterval is how often srcd web checks the web client is still
+// running while it waits for Ctrl-C.
+const webStoppedInterval = 2 * time.Second
+
+// waitForInterrupt waits for Ctrl-C, returning true, or for the container of
+// the web client to be gone, stopped with srcd web stop or srcd stop,
+// returning false.
+func waitForInterrupt(ch <-chan os.Signal, name string) bool {
+	ticker := time.NewTicker(webStoppedInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ch:
+			return true
+		case <-ticker.C:
+			if running, err := docker.IsRunning(name); err == nil && !running {
+				return false
+			}
+		}
+	}
+}
+
+// webReadyTimeout is how long the web clients have to serve their page
+// before the browser is opened onto it.
+const webReadyTimeout = time.Minute
+
+// webLogLines is how many lines of the logs of a web client are printed
+// when it doesn't serve its page in time.
+const webLogLines = 20
+
+// openWhenReady opens the URL of the web client in the browser once it serves
+// the one of its container, or prints its last logs if it doesn't within
+// webReadyTimeout.
+func openWhenReady(name, probe, url string) {
+	if err := waitForWebPage(probe); err != nil {
+		logrus.Warnf("%v, so the browser is not opened; its last logs:", err)
+		lines, err := docker.Logs(context.Background(), name, webLogLines)
 		if err != nil {
-			cancel()
-			logrus.Fatalf("could not stop %s at port %d: %v", desc, port, err)
+			logrus.Warnf("could not read its logs: %v", err)
+			return
+		}
+		for _, l := range lines {
+			fmt.Fprintln(os.Stderr, l)
+		}
+		return
+	}
+
+	if err := browser.OpenURL(url); err != nil {
+		logrus.Debugf("could not open the browser: %v", err)
+	}
+}
+
+// waitForWebPage waits until the web client serves the page at the URL,
+// checked every half second for up to webReadyTimeout.
+func waitForWebPage(url string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), webReadyTimeout)
+	defer cancel()
+
+	for {
+		pctx, pcancel := context.WithTimeout(ctx, 5*time.Second)
+		err := components.ProbeWebClient(pctx, url)
+		pcancel()
+		if err == nil {
+			return nil
+		}
+		logrus.Debugf("web client not ready yet: %v", err)
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("the web client didn't serve %s within %s", url, webReadyTimeout)
+		case <-time.After(500 * time.Millisecond):
 		}
 	}
 }
@@ -103,6 +371,26 @@ func init() {
 	webCmd.AddCommand(webSQLCmd)
 	webCmd.AddCommand(webParseCmd)
 
+	webCmd.PersistentFlags().Bool("auto-ports", false, "use the next free port when the one given is taken")
+	webCmd.PersistentFlags().Bool("no-browser", false, "only print the URL of the web client, without opening the browser")
+	webCmd.PersistentFlags().String("expose-web", "", "publish the web client on an address of the host other than the loopback, every interface unless one like 192.168.1.10 is given; it has no authentication")
+	webCmd.PersistentFlags().Lookup("expose-web").NoOptDefVal = "0.0.0.0"
+
 	webSQLCmd.Flags().UintP("port", "p", 8080, "port of the service")
 	webParseCmd.Flags().UintP("port", "p", 8081, "port of the service")
+	bindConfig("web.sql.port", webSQLCmd.Flags().Lookup("port"), checkPort)
+	bindConfig("web.parse.port", webParseCmd.Flags().Lookup("port"), checkPort)
+	for _, c := range []*cobra.Command{webSQLCmd, webParseCmd} {
+		c.Flags().String("web-base-path", "", "path the web client is served under behind a reverse proxy, like /engine/sql, or the URL it's reached at there, like https://tools.internal/engine/sql")
+	}
+	bindConfig("web.sql.base-path", webSQLCmd.Flags().Lookup("web-base-path"), checkWebBasePathValue)
+	bindConfig("web.parse.base-path", webParseCmd.Flags().Lookup("web-base-path"), checkWebBasePathValue)
+	bindConfig("web.expose", webCmd.PersistentFlags().Lookup("expose-web"), checkWebExpose)
+}
+
+// checkWebExpose validates the addresses of the host the web clients are
+// published on.
+func checkWebExpose(value string) error {
+	_, err := components.ParseExposeAddress(value)
+	return err
 }
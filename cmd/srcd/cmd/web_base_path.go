@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/src-d/engine/components"
+)
+
+// webBasePathRegexp matches the base paths the web clients can be served
+// under, like /engine/sql.
+var webBasePathRegexp = regexp.MustCompile(`^(/[\w.~-]+)+$`)
+
+// parseWebBasePath returns the path the web client is served under given the
+// value of --web-base-path: a path like /engine/sql, or the URL it's reached
+// at through the reverse proxy, like https://tools.internal/engine/sql/,
+// which is returned too. Both are empty for the root.
+func parseWebBasePath(value string) (path, public string, err error) {
+	value = strings.TrimSpace(value)
+	path = value
+	if strings.Contains(value, "://") {
+		u, err := url.Parse(value)
+		switch {
+		case err != nil:
+			return "", "", fmt.Errorf("invalid URL: %v", err)
+		case u.Scheme != "http" && u.Scheme != "https", u.Host == "":
+			return "", "", fmt.Errorf("the URL must be an http or https one with a host")
+		case u.RawQuery != "" || u.Fragment != "":
+			return "", "", fmt.Errorf("the URL can't have a query or a fragment")
+		}
+		path, public = u.Path, strings.TrimSuffix(value, "/")
+	}
+
+	path = strings.TrimSuffix(path, "/")
+	if path == "" {
+		return "", public, nil
+	}
+
+	if !webBasePathRegexp.MatchString(path) || strings.Contains(path, "/./") || strings.Contains(path, "/../") ||
+		strings.HasSuffix(path, "/.") || strings.HasSuffix(path, "/..") {
+		return "", "", fmt.Errorf("invalid path %q, it must be like /engine/sql", path)
+	}
+	return path, public, nil
+}
+
+// checkWebBasePath checks the version of the web client run can be served
+// under a base path.
+func checkWebBasePath(c components.Component) error {
+	b, ok := c.WebBasePath()
+	if !ok {
+		return usageErrorf("--web-base-path can't be used with %s, as no version of %s can be served under a base path",
+			c.ShortName(), c.Image)
+	}
+
+	if version := c.Tag(); newerVersion(b.Since, version) {
+		return usageErrorf("--web-base-path requires %s %s or newer, but %s is run; "+
+			"pin the newer one with srcd init --%s-version %s",
+			c.ShortName(), b.Since, version, c.ShortName(), b.Since)
+	}
+	return nil
+}
+
+// checkWebBasePathValue validates the values of the base paths of the web
+// clients.
+func checkWebBasePathValue(value string) error {
+	_, _, err := parseWebBasePath(value)
+	return err
+}
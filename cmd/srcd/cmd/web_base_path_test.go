@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/src-d/engine/components"
+)
+
+func TestParseWebBasePath(t *testing.T) {
+	testCases := []struct {
+		value  string
+		path   string
+		public string
+		err    bool
+	}{
+		{value: ""},
+		{value: "/"},
+		{value: "/engine/sql", path: "/engine/sql"},
+		{value: "/engine/sql/", path: "/engine/sql"},
+		{
+			value:  "https://tools.internal/engine/sql/",
+			path:   "/engine/sql",
+			public: "https://tools.internal/engine/sql",
+		},
+		{value: "https://tools.internal", public: "https://tools.internal"},
+		{value: "engine/sql", err: true},
+		{value: "/engine/../sql", err: true},
+		{value: "/engine sql", err: true},
+		{value: "ftp://tools.internal/engine", err: true},
+		{value: "https://tools.internal/engine?x=1", err: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.value, func(t *testing.T) {
+			path, public, err := parseWebBasePath(tc.value)
+			if tc.err != (err != nil) {
+				t.Fatalf("expected error: %v, got: %v", tc.err, err)
+			}
+			if path != tc.path {
+				t.Errorf("expected: %s, got: %s", tc.path, path)
+			}
+			if public != tc.public {
+				t.Errorf("expected: %s, got: %s", tc.public, public)
+			}
+		})
+	}
+}
+
+func TestCheckWebBasePath(t *testing.T) {
+	defer components.SetPins(nil)
+
+	b, _ := components.GitbaseWeb.WebBasePath()
+	testCases := []struct {
+		name string
+		c    components.Component
+		pin  string
+		err  bool
+	}{
+		{"latest", components.GitbaseWeb, "", false},
+		{"supported", components.GitbaseWeb, b.Since, false},
+		{"too old", components.GitbaseWeb, "v0.3.0", true},
+		{"never supported", components.BblfshWeb, "", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			pins := map[string]string{}
+			if tc.pin != "" {
+				pins[tc.c.Name] = tc.pin
+			}
+			components.SetPins(pins)
+
+			err := checkWebBasePath(tc.c)
+			if tc.err != (err != nil) {
+				t.Errorf("expected error: %v, got: %v", tc.err, err)
+			}
+		})
+	}
+}
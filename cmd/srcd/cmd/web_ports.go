@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/src-d/engine/cmd/srcd/daemon"
+	"github.com/src-d/engine/components"
+)
+
+// webPort is the port of the host a web client is published on, chosen with
+// a flag of init kept in the config file.
+type webPort struct {
+	flag      string
+	key       string
+	component components.Component
+}
+
+var webPorts = []webPort{
+	{"web-sql-port", "web.sql.port", components.GitbaseWeb},
+	{"web-parse-port", "web.parse.port", components.BblfshWeb},
+}
+
+// autoPortsTries is how many of the ports after the one taken are tried
+// with --auto-ports.
+const autoPortsTries = 100
+
+// availableWebPort returns the port the web client can be published on: the
+// given one if it's free or already used by the engine, or with auto the
+// next free one.
+func availableWebPort(c components.Component, port int, auto bool) (int, error) {
+	// The ports of another machine can't be listened on to check them.
+	if daemon.RemoteDockerHost() != "" {
+		return port, nil
+	}
+
+	engine, err := enginePorts()
+	if err != nil {
+		return 0, err
+	}
+
+	taken := func(port int) bool {
+		_, ok := engine[port]
+		return !ok && portTaken(port)
+	}
+	return choosePort(c, port, auto, taken)
+}
+
+func choosePort(c components.Component, port int, auto bool, taken func(int) bool) (int, error) {
+	if !taken(port) {
+		return port, nil
+	}
+
+	if !auto {
+		return 0, usageErrorf("port %d of the %s is taken by another program; "+
+			"choose another one, or give --auto-ports to use the next free one", port, c.ShortName())
+	}
+
+	for p := port + 1; p <= port+autoPortsTries && p <= 65535; p++ {
+		if !taken(p) {
+			logrus.Infof("port %d of the %s is taken, using %d", port, c.ShortName(), p)
+			return p, nil
+		}
+	}
+	return 0, fmt.Errorf("no free port for the %s from %d to %d", c.ShortName(), port, port+autoPortsTries)
+}
+
+// applyWebPortFlags checks the ports of the web clients given to init are
+// available, choosing free ones with --auto-ports, and records them in the
+// config file, where srcd web reads them from.
+func applyWebPortFlags(cmd *cobra.Command) error {
+	auto, _ := cmd.Flags().GetBool("auto-ports")
+	var path string
+	for _, wp := range webPorts {
+		if !cmd.Flags().Changed(wp.flag) {
+			continue
+		}
+
+		port, _ := cmd.Flags().GetInt(wp.flag)
+		if err := checkPort(fmt.Sprint(port)); err != nil {
+			return usageErrorf("invalid value of --%s %d: %v", wp.flag, port, err)
+		}
+
+		port, err := availableWebPort(wp.component, port, auto)
+		if err != nil {
+			return err
+		}
+
+		if path == "" {
+			if path, err = configFilePath(); err != nil {
+				return err
+			}
+		}
+
+		if err := setConfigFileValue(path, wp.key, port); err != nil {
+			return err
+		}
+		viper.Set(wp.key, port)
+		logrus.Infof("%s published on port %d with srcd web, kept in %s", wp.component.ShortName(), port, path)
+	}
+	return nil
+}
+
+func init() {
+	for _, wp := range webPorts {
+		initCmd.Flags().Int(wp.flag, 0, fmt.Sprintf("port of the host srcd web publishes %s on, kept in the config file", wp.component.ShortName()))
+	}
+	initCmd.Flags().Bool("auto-ports", false, "use the next free port when the one of a web client is taken")
+}
@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/src-d/engine/components"
+)
+
+func TestChoosePort(t *testing.T) {
+	busy := map[int]bool{8080: true, 8081: true}
+	taken := func(port int) bool { return busy[port] }
+
+	testCases := []struct {
+		name     string
+		port     int
+		auto     bool
+		expected int
+		err      bool
+	}{
+		{"free", 9000, false, 9000, false},
+		{"taken", 8080, false, 0, true},
+		{"next free", 8080, true, 8082, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			port, err := choosePort(components.GitbaseWeb, tc.port, tc.auto, taken)
+			if tc.err != (err != nil) {
+				t.Fatalf("expected error: %v, got: %v", tc.err, err)
+			}
+			if port != tc.expected {
+				t.Errorf("expected: %d, got: %d", tc.expected, port)
+			}
+		})
+	}
+}
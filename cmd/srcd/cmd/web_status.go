@@ -0,0 +1,143 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	units "github.com/docker/go-units"
+	"github.com/spf13/cobra"
+	"github.com/src-d/engine/cmd/srcd/daemon"
+	"github.com/src-d/engine/components"
+	"github.com/src-d/engine/docker"
+)
+
+// webStatus is the status of a web client. Fields not known are null in JSON.
+type webStatus struct {
+	UI        string `json:"ui"`
+	Component string `json:"component"`
+	State     string `json:"state"`
+	Health    string `json:"health"`
+	// URL is nil if the web client is not running.
+	URL *string `json:"url"`
+	// Bind is the address of the host it's published on, nil if it's not
+	// running.
+	Bind *string `json:"bind"`
+	// Auth is whether the requests must have the token of srcd web token.
+	Auth      bool       `json:"auth"`
+	StartedAt *time.Time `json:"started_at"`
+
+	uptime time.Duration
+}
+
+var webStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the web clients running, with their URLs",
+	Long: `Show the web clients running, with their URLs
+
+Every web client is listed with its state, the URL it's reached at, the
+address of the host it's published on and how long it has been running. The
+URL doesn't have the token of the gitbase web client with --web-auth token,
+printed by srcd web token.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		out, err := outputFormat(cmd)
+		if err != nil {
+			return usageErrorf("%v", err)
+		}
+
+		host := "localhost"
+		if remote := daemon.RemoteDockerHost(); remote != "" {
+			host = remote
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		var statuses []*webStatus
+		for _, w := range webClients {
+			s, err := components.GetStatus(ctx, w.c, false)
+			if err != nil {
+				return err
+			}
+
+			var info *docker.Container
+			if s.State == components.StateRunning {
+				if info, err = docker.Info(w.c.Name); err != nil && err != docker.ErrNotFound {
+					return err
+				}
+			}
+			statuses = append(statuses, newWebStatus(w, s, info, host))
+		}
+
+		return out.print(os.Stdout, "web", statuses, func(w io.Writer) error {
+			return printWebStatus(w, statuses)
+		})
+	},
+}
+
+// newWebStatus returns the status of the web client with the given status
+// and container, nil if it's not running, given the host docker runs on.
+func newWebStatus(w webClient, s *components.Status, info *docker.Container, host string) *webStatus {
+	ws := &webStatus{
+		UI:        w.ui,
+		Component: s.Name,
+		State:     s.State,
+		Health:    s.Health,
+		StartedAt: s.StartedAt,
+		uptime:    s.Uptime(),
+	}
+	if info == nil {
+		return ws
+	}
+
+	if u, ok := components.WebURL(info, host); ok {
+		ws.URL = &u
+	}
+
+	bind := info.Labels[components.WebBindLabel]
+	if bind == "" {
+		// Created before the label, or published by docker.
+		bind = "0.0.0.0"
+		for _, p := range info.Ports {
+			if p.PublicPort != 0 && p.IP != "" {
+				bind = p.IP
+			}
+		}
+	}
+	ws.Bind = &bind
+	ws.Auth = info.Labels[components.WebAuthLabel] != ""
+	return ws
+}
+
+func printWebStatus(w io.Writer, statuses []*webStatus) error {
+	tw := new(tabwriter.Writer)
+	tw.Init(w, 0, 8, 5, '\t', 0)
+	fmt.Fprintln(tw, "UI\tCOMPONENT\tSTATE\tURL\tBIND\tUPTIME")
+	fmt.Fprintln(tw, "----------\t----------\t----------\t----------\t----------\t----------")
+	for _, s := range statuses {
+		url, bind, up := "-", "-", "-"
+		if s.URL != nil {
+			url = *s.URL
+			if s.Auth {
+				url += " (token)"
+			}
+		}
+		if s.Bind != nil {
+			bind = *s.Bind
+		}
+		if s.StartedAt != nil {
+			up = units.HumanDuration(s.uptime)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", s.UI, s.Component, s.State, url, bind, up)
+	}
+	return tw.Flush()
+}
+
+func init() {
+	webCmd.AddCommand(webStatusCmd)
+	addOutputFlags(webStatusCmd, true)
+}
@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/src-d/engine/components"
+	"github.com/src-d/engine/docker"
+)
+
+func TestNewWebStatus(t *testing.T) {
+	started := time.Now().Add(-time.Hour)
+	running := &components.Status{
+		Name:      "gitbase-web",
+		State:     components.StateRunning,
+		Health:    components.HealthNone,
+		StartedAt: &started,
+	}
+
+	testCases := []struct {
+		name string
+		info *docker.Container
+		url  string
+		bind string
+		auth bool
+	}{
+		{
+			name: "loopback",
+			info: &docker.Container{Labels: map[string]string{
+				components.WebPortLabel: "8080",
+				components.WebBindLabel: "127.0.0.1",
+			}},
+			url:  "http://localhost:8080",
+			bind: "127.0.0.1",
+		},
+		{
+			name: "exposed with tls and token",
+			info: &docker.Container{Labels: map[string]string{
+				components.WebPortLabel: "8443",
+				components.WebBindLabel: "192.168.1.10",
+				components.WebTLSLabel:  "abc",
+				components.WebAuthLabel: "def",
+			}},
+			url:  "https://192.168.1.10:8443",
+			bind: "192.168.1.10",
+			auth: true,
+		},
+		{
+			name: "without labels",
+			info: &docker.Container{Ports: []types.Port{{IP: "0.0.0.0", PublicPort: 8080, PrivatePort: 8080}}},
+			url:  "http://localhost:8080",
+			bind: "0.0.0.0",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newWebStatus(webClients[0], running, tc.info, "localhost")
+			if s.URL == nil || *s.URL != tc.url {
+				t.Errorf("expected: %s, got: %v", tc.url, s.URL)
+			}
+			if s.Bind == nil || *s.Bind != tc.bind {
+				t.Errorf("expected: %s, got: %v", tc.bind, s.Bind)
+			}
+			if s.Auth != tc.auth {
+				t.Errorf("expected: %v, got: %v", tc.auth, s.Auth)
+			}
+		})
+	}
+
+	stopped := &components.Status{Name: "bblfsh-web", State: components.StateNotCreated, Health: components.HealthNone}
+	s := newWebStatus(webClients[1], stopped, nil, "localhost")
+	if s.URL != nil || s.Bind != nil {
+		t.Errorf("expected no URL nor bind, got: %v, %v", s.URL, s.Bind)
+	}
+
+	var buf bytes.Buffer
+	if err := printWebStatus(&buf, []*webStatus{s}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "parse") || !strings.Contains(buf.String(), "not created") {
+		t.Errorf("expected the bblfsh web client not created, got: %s", buf.String())
+	}
+}
+
+func TestSelectWebClients(t *testing.T) {
+	testCases := []struct {
+		args     []string
+		expected []string
+		err      bool
+	}{
+		{nil, []string{"gitbase-web", "bblfsh-web"}, false},
+		{[]string{"sql"}, []string{"gitbase-web"}, false},
+		{[]string{"parse"}, []string{"bblfsh-web"}, false},
+		{[]string{"gitbase"}, nil, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(strings.Join(tc.args, ","), func(t *testing.T) {
+			clients, err := selectWebClients(tc.args)
+			if tc.err != (err != nil) {
+				t.Fatalf("expected error: %v, got: %v", tc.err, err)
+			}
+
+			var names []string
+			for _, w := range clients {
+				names = append(names, w.c.ShortName())
+			}
+			if strings.Join(names, ",") != strings.Join(tc.expected, ",") {
+				t.Errorf("expected: %v, got: %v", tc.expected, names)
+			}
+		})
+	}
+}
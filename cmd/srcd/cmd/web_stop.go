@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/src-d/engine/docker"
+)
+
+var webStopCmd = &cobra.Command{
+	Use:   "stop [sql|parse]",
+	Short: "Stop the web clients, or only the given one",
+	Long: `Stop the web clients, or only the given one
+
+The web client, and the proxy serving it over HTTPS or with a token, are
+stopped gracefully and their containers removed. gitbase and bblfshd keep
+running. The srcd web command that started it, if it's still waiting for
+Ctrl-C, stops waiting.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		clients, err := selectWebClients(args)
+		if err != nil {
+			return err
+		}
+		return stopWebClients(clients)
+	},
+}
+
+// stopWebClients stops the web clients gracefully, along with their proxies.
+func stopWebClients(clients []webClient) error {
+	for _, w := range clients {
+		err := stopComponent(w.c, gracePeriod(w.c))
+		if err == docker.ErrNotFound {
+			logrus.Infof("the %s web client is not running", w.ui)
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// selectWebClients returns the web client with the given name, sql or parse,
+// or all of them if none is given.
+func selectWebClients(names []string) ([]webClient, error) {
+	if len(names) == 0 {
+		return webClients, nil
+	}
+
+	var result []webClient
+	for _, name := range names {
+		found := false
+		for _, w := range webClients {
+			if w.ui == name {
+				result = append(result, w)
+				found = true
+			}
+		}
+		if !found {
+			return nil, usageErrorf("unknown web client %s, it must be sql or parse", name)
+		}
+	}
+	return result, nil
+}
+
+func init() {
+	webCmd.AddCommand(webStopCmd)
+}
@@ -0,0 +1,129 @@
+package cmd
+
+import (
+	"crypto/tls"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/spf13/viper"
+	"github.com/src-d/engine/cmd/srcd/daemon"
+	"github.com/src-d/engine/components"
+)
+
+// webTLS is the certificate and key in PEM the web clients are served with
+// over HTTPS.
+type webTLS struct {
+	cert string
+	key  string
+	// path is the file of the certificate.
+	path string
+	// generated is whether it's the self-signed one of the data directory.
+	generated bool
+}
+
+// loadWebTLS returns the certificate and key of web.tls-cert and web.tls-key,
+// or the self-signed ones generated in the data directory, valid for the
+// hosts of web.tls-hosts or, without them, for the ones the web client
+// published on the given address of the host is reached at.
+func loadWebTLS(bind string) (*webTLS, error) {
+	certPath, keyPath := viper.GetString("web.tls-cert"), viper.GetString("web.tls-key")
+	switch {
+	case certPath != "" && keyPath != "":
+		return readWebTLS(certPath, keyPath)
+	case certPath != "" || keyPath != "":
+		return nil, usageErrorf("--tls-cert and --tls-key must be given together")
+	}
+
+	datadir, err := webDataDir()
+	if err != nil {
+		return nil, err
+	}
+
+	hostname, _ := os.Hostname()
+	hosts := webTLSHosts(viper.GetStringSlice("web.tls-hosts"), bind, hostname, daemon.RemoteDockerHost())
+	cert, key, path, err := daemon.WebCertificate(datadir, hosts)
+	if err != nil {
+		return nil, err
+	}
+	return &webTLS{cert: string(cert), key: string(key), path: path, generated: true}, nil
+}
+
+// webDataDir returns the data directory the secrets of the web clients are
+// kept in, the one of the daemon running if there's one.
+func webDataDir() (string, error) {
+	cfg, err := daemon.Running()
+	if err != nil {
+		return "", err
+	}
+
+	datadir := daemon.DataDir
+	if cfg != nil {
+		datadir = cfg.DataDir
+	}
+	return daemon.ResolveDataDir(datadir)
+}
+
+// readWebTLS reads the certificate and key given by the user, checking they
+// match.
+func readWebTLS(certPath, keyPath string) (*webTLS, error) {
+	cert, err := ioutil.ReadFile(certPath)
+	if err != nil {
+		return nil, usageErrorf("could not read the certificate of --tls-cert: %v", err)
+	}
+
+	key, err := ioutil.ReadFile(keyPath)
+	if err != nil {
+		return nil, usageErrorf("could not read the key of --tls-key: %v", err)
+	}
+
+	if _, err := tls.X509KeyPair(cert, key); err != nil {
+		return nil, usageErrorf("invalid certificate %s or key %s: %v", certPath, keyPath, err)
+	}
+	return &webTLS{cert: string(cert), key: string(key), path: certPath}, nil
+}
+
+// webTLSHosts returns the host names and addresses the certificate generated
+// for the web clients is valid for: the ones given with --tls-hosts, or
+// localhost, the name of this machine, the host docker runs on if it's
+// another one, and the address the web client is published on if it's a
+// specific one.
+func webTLSHosts(given []string, bind, hostname, remote string) []string {
+	var hosts []string
+	seen := make(map[string]bool)
+	add := func(h string) {
+		h = strings.TrimSpace(h)
+		if h != "" && !seen[h] {
+			seen[h] = true
+			hosts = append(hosts, h)
+		}
+	}
+
+	if len(given) > 0 {
+		for _, h := range given {
+			add(h)
+		}
+		return hosts
+	}
+
+	add("localhost")
+	add(components.WebDefaultBind)
+	add(hostname)
+	add(remote)
+	if host := components.URLHost(bind, ""); host != "" {
+		add(host)
+	}
+	return hosts
+}
+
+func init() {
+	flags := webCmd.PersistentFlags()
+	flags.Bool("tls", false, "serve the web client over HTTPS, with the certificate of --tls-cert or a self-signed one")
+	flags.String("tls-cert", "", "file of the certificate in PEM to serve the web client with, along with --tls-key")
+	flags.String("tls-key", "", "file of the key in PEM of the certificate of --tls-cert")
+	flags.StringSlice("tls-hosts", nil, "host names and addresses the self-signed certificate is valid for, localhost and the name of this machine by default")
+	bindConfig("web.tls", flags.Lookup("tls"))
+	bindConfig("web.tls-cert", flags.Lookup("tls-cert"))
+	bindConfig("web.tls-key", flags.Lookup("tls-key"))
+	bindConfig("web.tls-hosts", flags.Lookup("tls-hosts"))
+}
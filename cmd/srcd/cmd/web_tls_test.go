@@ -0,0 +1,32 @@
+package cmd
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestWebTLSHosts(t *testing.T) {
+	testCases := []struct {
+		name     string
+		given    []string
+		bind     string
+		remote   string
+		expected string
+	}{
+		{"loopback", nil, "127.0.0.1", "", "[localhost 127.0.0.1 laptop]"},
+		{"every interface", nil, "0.0.0.0", "", "[localhost 127.0.0.1 laptop]"},
+		{"address", nil, "192.168.1.10", "", "[localhost 127.0.0.1 laptop 192.168.1.10]"},
+		{"remote docker", nil, "127.0.0.1", "192.168.99.100", "[localhost 127.0.0.1 laptop 192.168.99.100]"},
+		{"given", []string{"engine.example.com", " 10.0.0.2", "engine.example.com"}, "0.0.0.0", "",
+			"[engine.example.com 10.0.0.2]"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := fmt.Sprint(webTLSHosts(tc.given, tc.bind, "laptop", tc.remote))
+			if got != tc.expected {
+				t.Errorf("expected: %s, got: %s", tc.expected, got)
+			}
+		})
+	}
+}
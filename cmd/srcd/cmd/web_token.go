@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/src-d/engine/cmd/srcd/daemon"
+	"github.com/src-d/engine/components"
+	"github.com/src-d/engine/docker"
+)
+
+// Values of web.auth.
+const (
+	webAuthToken = "token"
+	webAuthOff   = "off"
+)
+
+var webTokenCmd = &cobra.Command{
+	Use:   "token",
+	Short: "Print the token of the gitbase web client",
+	Long: `Print the token of the gitbase web client
+
+With srcd web sql --web-auth token, the requests to the gitbase web client
+must have this token, kept in the data directory. The URL printed by srcd web
+sql has it, so the browser keeps it in a cookie on the first visit; other
+clients can send it in an Authorization: Bearer header.
+
+With --rotate, a new token is generated and the old one is rejected from
+then on. The gitbase web client running with a token is created again with
+the new one.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		rotate, _ := cmd.Flags().GetBool("rotate")
+		token, err := webToken(rotate)
+		if err != nil {
+			return err
+		}
+
+		if rotate {
+			if err := applyRotatedToken(); err != nil {
+				return err
+			}
+		}
+
+		fmt.Println(token)
+		return nil
+	},
+}
+
+// webToken returns the token of the web clients kept in the data directory,
+// generating a new one if there's none or rotate is true.
+func webToken(rotate bool) (string, error) {
+	datadir, err := webDataDir()
+	if err != nil {
+		return "", err
+	}
+	return daemon.WebToken(datadir, rotate)
+}
+
+// webAuthEnabled reports whether the requests to the web client must have the
+// token.
+func webAuthEnabled(c components.Component) bool {
+	return c.Name == components.GitbaseWeb.Name && viper.GetString("web.auth") == webAuthToken
+}
+
+// withToken returns the URL of the web client with the token in its query,
+// so the first visit of the browser has it.
+func withToken(u, token string) string {
+	return u + "/?" + components.WebTokenParam + "=" + url.QueryEscape(token)
+}
+
+// applyRotatedToken creates the gitbase web client again with the new token,
+// if it's running with one.
+func applyRotatedToken() error {
+	c := components.GitbaseWeb
+	info, err := docker.Info(c.Name)
+	if err == docker.ErrNotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if info.State != "running" || info.Labels[components.WebAuthLabel] == "" {
+		return nil
+	}
+
+	var published int
+	for _, p := range info.Ports {
+		if p.PublicPort != 0 {
+			published = int(p.PublicPort)
+		}
+	}
+
+	if err := startWebClientAs(c, webRestartOf(info.Labels, published)); err != nil {
+		return operationFailed(fmt.Errorf("could not start the gitbase web client with the new token: %v", err))
+	}
+	logrus.Infof("the gitbase web client was started again with the new token, the old one is rejected")
+	return nil
+}
+
+// checkWebAuth validates the values of web.auth.
+func checkWebAuth(value string) error {
+	if value != webAuthToken && value != webAuthOff {
+		return fmt.Errorf("it must be token or off")
+	}
+	return nil
+}
+
+func init() {
+	webCmd.AddCommand(webTokenCmd)
+	webTokenCmd.Flags().Bool("rotate", false, "generate a new token, rejecting the old one")
+
+	webSQLCmd.Flags().String("web-auth", webAuthOff, "token to only serve the requests with the token of srcd web token, or off")
+	bindConfig("web.auth", webSQLCmd.Flags().Lookup("web-auth"), checkWebAuth)
+}
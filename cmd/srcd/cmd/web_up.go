@@ -0,0 +1,188 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/browser"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/src-d/engine/cmd/srcd/daemon"
+	"github.com/src-d/engine/components"
+	"github.com/src-d/engine/docker"
+)
+
+var webUpCmd = &cobra.Command{
+	Use:   "up",
+	Short: "Start both web clients, along with the components they require",
+	Long: `Start both web clients, along with the components they require
+
+gitbase and bblfshd are started if they are stopped, and waited for to be
+healthy, then the gitbase and bblfsh web clients are started like srcd web sql
+and srcd web parse do, with the ports and settings of the config file, and
+waited for to serve their pages. Their URLs are printed together and opened in
+the browser unless --no-browser is given.
+
+Unlike srcd web sql and parse, it doesn't wait for Ctrl-C: the web clients keep
+running until srcd web down stops them. Nothing is pulled, so it fails naming
+the components that are not installed, with the command to install them.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := daemon.Running()
+		if err != nil {
+			return err
+		}
+
+		var cmps []components.Component
+		for _, w := range webClients {
+			cmps = append(cmps, w.c)
+		}
+
+		err = checkWebUp(cfg, cmps, func(c components.Component) (bool, error) {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			return docker.IsInstalled(ctx, c.ImageName(), c.Tag())
+		})
+		if err != nil {
+			return err
+		}
+
+		started := make([]*startedWebClient, len(webClients))
+		steps := requirementSteps(cfg, components.Requirements(cmps...))
+		for i, w := range webClients {
+			i, w := i, w
+			steps = append(steps,
+				initStep{
+					name: "start " + w.c.ShortName(),
+					run: func() (err error) {
+						started[i], err = startWebClient(cmd, w)
+						return err
+					},
+					logs: containerLogs(w.c.Name),
+				},
+				initStep{
+					name: "wait for " + w.c.ShortName(),
+					run:  func() error { return waitForWebPage(started[i].probe) },
+					logs: containerLogs(w.c.Name),
+				},
+			)
+		}
+
+		reporter := commandStepReporter()
+		if r, ok := reporter.(*ttyStepReporter); ok {
+			logrus.SetOutput(r)
+			defer logrus.SetOutput(os.Stderr)
+		}
+
+		if err := runSteps(reporter, steps); err != nil {
+			return err
+		}
+
+		tw := tabwriter.NewWriter(os.Stdout, 0, 8, 1, ' ', 0)
+		fmt.Fprintln(tw, "The web clients are running:")
+		for _, w := range started {
+			fmt.Fprintf(tw, "  %s:\t%s\n", w.desc, w.url)
+		}
+		fmt.Fprintln(tw, "Run srcd web down to stop them.")
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+
+		noBrowser, _ := cmd.Flags().GetBool("no-browser")
+		for _, w := range started {
+			if !w.browsable(noBrowser) {
+				continue
+			}
+
+			if err := browser.OpenURL(w.url); err != nil {
+				logrus.Debugf("could not open the browser: %v", err)
+			}
+		}
+		return nil
+	},
+}
+
+var webDownCmd = &cobra.Command{
+	Use:   "down",
+	Short: "Stop both web clients",
+	Long: `Stop both web clients
+
+The gitbase and bblfsh web clients started by srcd web up are stopped, like
+srcd web stop does. gitbase and bblfshd keep running, as the rest of the
+engine uses them; srcd stop stops them.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return stopWebClients(webClients)
+	},
+}
+
+// checkWebUp checks the components can be started along with the ones they
+// require: none of them is disabled in the configuration of the daemon
+// running, if any, and all of them are installed.
+func checkWebUp(cfg *daemon.Config, cmps []components.Component, installed func(components.Component) (bool, error)) error {
+	needed := append(components.Requirements(cmps...), cmps...)
+
+	var missing, refs []string
+	for _, c := range needed {
+		if cfg != nil && !cfg.Enabled(c.Name) {
+			return disabledErrorf(c)
+		}
+
+		ok, err := installed(c)
+		if err != nil {
+			return fmt.Errorf("could not check if %s is installed: %v", c.ShortName(), err)
+		}
+
+		if !ok {
+			missing = append(missing, c.ShortName())
+			refs = append(refs, c.Ref())
+		}
+	}
+
+	switch len(missing) {
+	case 0:
+		return nil
+	case 1:
+		return fmt.Errorf("%s is not installed; run srcd components install %s", missing[0], refs[0])
+	default:
+		return fmt.Errorf("%s are not installed; run srcd components install %s",
+			strings.Join(missing, ", "), strings.Join(refs, " "))
+	}
+}
+
+// requirementSteps returns the steps to start the components required that
+// are not running, and to wait for all of them to be healthy, gitbase to
+// accept queries.
+func requirementSteps(cfg *daemon.Config, cmps []components.Component) []initStep {
+	var steps []initStep
+	for _, c := range cmps {
+		c := c
+		if running, err := docker.IsRunning(c.Name); err != nil || !running {
+			steps = append(steps, initStep{
+				name: "start " + c.ShortName(),
+				run:  func() error { return startComponent(c) },
+				logs: containerLogs(c.Name),
+			})
+		}
+
+		wait := func() error { return waitForHealthy(c) }
+		if c.Name == components.Gitbase.Name && cfg != nil {
+			wait = waitForGitbase(cfg)
+		}
+		steps = append(steps, initStep{
+			name: "wait for " + c.ShortName(),
+			run:  wait,
+			logs: containerLogs(c.Name),
+		})
+	}
+	return steps
+}
+
+func init() {
+	webCmd.AddCommand(webUpCmd)
+	webCmd.AddCommand(webDownCmd)
+}
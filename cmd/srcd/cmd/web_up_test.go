@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/src-d/engine/cmd/srcd/daemon"
+	"github.com/src-d/engine/components"
+)
+
+func TestCheckWebUp(t *testing.T) {
+	cmps := []components.Component{components.GitbaseWeb, components.BblfshWeb}
+
+	testCases := []struct {
+		name     string
+		cfg      *daemon.Config
+		missing  map[string]bool
+		expected string
+	}{
+		{name: "all installed"},
+		{name: "no daemon", cfg: nil},
+		{
+			name:    "one missing",
+			missing: map[string]bool{components.Gitbase.Name: true},
+			expected: "gitbase is not installed; run srcd components install " +
+				components.Gitbase.Ref(),
+		},
+		{
+			name:    "several missing",
+			missing: map[string]bool{components.Bblfshd.Name: true, components.BblfshWeb.Name: true},
+			expected: "bblfshd, bblfsh-web are not installed; run srcd components install " +
+				components.Bblfshd.Ref() + " " + components.BblfshWeb.Ref(),
+		},
+		{
+			name:     "disabled",
+			cfg:      &daemon.Config{Components: []string{components.Bblfshd.Name}},
+			expected: "gitbase is disabled; re-run init with --components +gitbase to enable it",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := checkWebUp(tc.cfg, cmps, func(c components.Component) (bool, error) {
+				return !tc.missing[c.Name], nil
+			})
+
+			var result string
+			if err != nil {
+				result = err.Error()
+			}
+			if result != tc.expected {
+				t.Errorf("expected: %s, got: %s", tc.expected, result)
+			}
+		})
+	}
+}
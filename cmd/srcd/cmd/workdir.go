@@ -0,0 +1,261 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/src-d/engine/api"
+	"github.com/src-d/engine/cmd/srcd/daemon"
+	"github.com/src-d/engine/components"
+	"github.com/src-d/engine/docker"
+)
+
+var workdirCmd = &cobra.Command{
+	Use:   "workdir",
+	Short: "Show, change or sync the working directory",
+}
+
+var workdirShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Print the working directory",
+	Long: `Print the working directory
+
+Prints the working directory of the running daemon. When srcd init was given
+more directories with repositories, they are all listed after it with where
+they are mounted in gitbase, under /opt/repos.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := daemon.Running()
+		if err != nil {
+			return err
+		}
+
+		if cfg == nil || cfg.Workdir == "" {
+			return notRunningErrorf("the engine is not initialized; run srcd init first")
+		}
+
+		res := &workdirRecord{
+			Workdir: cfg.Workdir,
+			Repos:   components.RepoMounts(cfg.Workdir, cfg.Repos),
+		}
+		return newRecordWriter(os.Stdout).write("workdir", res, func(w io.Writer) error {
+			fmt.Fprintln(w, res.Workdir)
+			if len(res.Repos) > 1 {
+				printRepoMounts(w, res.Repos)
+			}
+			return nil
+		})
+	},
+}
+
+// workdirRecord is the working directory printed by srcd workdir show, with
+// the directories mounted in gitbase.
+type workdirRecord struct {
+	Workdir string                 `json:"workdir"`
+	Repos   []components.RepoMount `json:"repos"`
+}
+
+// printRepoMounts prints the directories mounted in gitbase with where each
+// one is mounted.
+func printRepoMounts(w io.Writer, mounts []components.RepoMount) {
+	fmt.Fprintln(w, "directories mounted in gitbase:")
+	for _, m := range mounts {
+		fmt.Fprintf(w, "  %s at %s\n", m.Host, m.Container)
+	}
+}
+
+var workdirSetCmd = &cobra.Command{
+	Use:   "set path",
+	Short: "Change the working directory without a full init",
+	Long: `Change the working directory without a full init
+
+Only the containers depending on the working directory are recreated, gitbase,
+pilosa and bblfshd, along with the daemon, keeping the rest of the
+configuration of the last srcd init. Images, volumes, the network and the web
+clients are left untouched. It waits for gitbase to accept queries before
+returning.
+
+Queries running in gitbase would be cut off, so it asks for confirmation if
+there are any, unless --yes is given.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := daemon.Running()
+		if err != nil {
+			return err
+		}
+
+		if cfg == nil {
+			return notRunningErrorf("the engine is not initialized; run srcd init %s instead", args[0])
+		}
+
+		dirs, err := initDirectories(append(args, cfg.Repos...))
+		if err != nil {
+			return err
+		}
+
+		if dirs[0] == cfg.Workdir {
+			logrus.Infof("%s is already the working directory", cfg.Workdir)
+			return nil
+		}
+
+		// The repositories are excluded with the same patterns.
+		excludes, err := parseRepoPatterns(cfg.Excluded)
+		if err != nil {
+			return err
+		}
+
+		scan, format, err := checkRepositories(dirs, "", false, excludes)
+		if err != nil {
+			return err
+		}
+		newCfg := *cfg
+		newCfg.Workdir = dirs[0]
+		newCfg.Format = format
+		newCfg.Hidden = nil
+		if format == repoFormatGit {
+			newCfg.Hidden = append(excludedPaths(scan), applyRepoPolicy(scan, cfg.RepoPolicy)...)
+		}
+
+		yes, _ := cmd.Flags().GetBool("yes")
+		if !yes {
+			queries, err := runningQueries()
+			if err != nil {
+				logrus.Warnf("could not check the queries running in gitbase: %v", err)
+			}
+
+			ok, err := confirmWorkdirChange(queries, isTerminal(os.Stdin), os.Stdin, os.Stderr)
+			if err != nil || !ok {
+				return err
+			}
+		}
+
+		logrus.Infof("changing the working directory from %s to %s", cfg.Workdir, newCfg.Workdir)
+		steps := []initStep{{name: "remove working directory containers", run: daemon.Kill}}
+		if step := syncWorkdirStep(&newCfg); step != nil {
+			steps = append(steps, *step)
+		}
+		steps = append(steps, initStep{
+			name: "start daemon",
+			run:  func() error { return daemon.Start(&newCfg) },
+			logs: func() ([]string, error) { return daemon.Logs(initLogLines) },
+		})
+		steps = append(steps, componentSteps(&newCfg, false)...)
+
+		reporter := commandStepReporter()
+		if r, ok := reporter.(*ttyStepReporter); ok {
+			logrus.SetOutput(r)
+			defer logrus.SetOutput(os.Stderr)
+		}
+
+		return runSteps(reporter, steps)
+	},
+}
+
+var workdirSyncCmd = &cobra.Command{
+	Use:   "sync",
+	Short: "Copy the changes of the working directory into its volume",
+	Long: `Copy the changes of the working directory into its volume
+
+When docker runs on another machine and srcd init synced the working directory
+into a volume there, copies the files of the working directory whose size or
+modification time changed since the last sync, and removes from the volume the
+ones removed, logging the progress of big copies. gitbase reads the changes at
+once, but only lists the repositories added once it's restarted with srcd
+restart gitbase.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := daemon.Running()
+		if err != nil {
+			return err
+		}
+
+		if cfg == nil {
+			return notRunningErrorf("the engine is not initialized; run srcd init first")
+		}
+
+		if cfg.WorkdirVolume == "" {
+			return usageErrorf("the working directory %s is mounted in gitbase, not synced into a volume; "+
+				"run srcd init --sync-workdir on to sync it", cfg.Workdir)
+		}
+
+		res, err := syncWorkdir(context.Background(), cfg.Workdir, cfg.WorkdirVolume)
+		if err != nil {
+			return operationFailed(err)
+		}
+
+		logNewRepositories(res)
+		return newRecordWriter(os.Stdout).write("sync", res, func(w io.Writer) error {
+			_, err := fmt.Fprintln(w, res)
+			return err
+		})
+	},
+}
+
+// runningQueries returns the number of queries running in gitbase, other than
+// the one asking for them, or 0 if gitbase is not running.
+func runningQueries() (int, error) {
+	if running, err := docker.IsRunning(components.Gitbase.Name); err != nil || !running {
+		return 0, err
+	}
+
+	c, err := daemon.Client()
+	if err != nil {
+		return 0, fmt.Errorf("could not get daemon client: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	const query = "SHOW PROCESSLIST"
+	res, err := c.SQL(ctx, &api.SQLRequest{Query: query})
+	if err != nil {
+		return 0, err
+	}
+	return otherQueries(res, query), nil
+}
+
+// otherQueries returns the number of queries listed by the result of SHOW
+// PROCESSLIST other than the given one, which asked for them.
+func otherQueries(res *api.SQLResponse, query string) int {
+	info := sqlColumn(res, "info")
+	var queries int
+	for _, row := range res.Rows {
+		if !strings.EqualFold(sqlCell(row, info), query) {
+			queries++
+		}
+	}
+	return queries
+}
+
+// confirmWorkdirChange asks whether to change the working directory when
+// there are queries running in gitbase, as they would be cut off. It fails
+// instead if stdin is not a terminal.
+func confirmWorkdirChange(queries int, terminal bool, in io.Reader, out io.Writer) (bool, error) {
+	if queries == 0 {
+		return true, nil
+	}
+
+	if !terminal {
+		return false, usageErrorf("%d queries running in gitbase would be cut off, "+
+			"use --yes to change the working directory anyway", queries)
+	}
+
+	question := fmt.Sprintf("%d queries running in gitbase will be cut off, continue?", queries)
+	return askYesNo(bufio.NewReader(in), out, question), nil
+}
+
+func init() {
+	rootCmd.AddCommand(workdirCmd)
+	workdirCmd.AddCommand(workdirShowCmd)
+	workdirCmd.AddCommand(workdirSetCmd)
+	workdirCmd.AddCommand(workdirSyncCmd)
+
+	workdirSetCmd.Flags().BoolP("yes", "y", false, "change the working directory even if there are queries running")
+}
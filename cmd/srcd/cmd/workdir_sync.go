@@ -0,0 +1,483 @@
+package cmd
+
+import (
+	"archive/tar"
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	units "github.com/docker/go-units"
+	"github.com/sirupsen/logrus"
+	"github.com/src-d/engine/cmd/srcd/daemon"
+	"github.com/src-d/engine/components"
+	"github.com/src-d/engine/docker"
+)
+
+// Values of --sync-workdir.
+const (
+	syncWorkdirAuto = "auto"
+	syncWorkdirOn   = "on"
+	syncWorkdirOff  = "off"
+)
+
+// workdirSyncIndex is the file in the root of the volume of the working
+// directory listing the files synced into it, so the next sync only copies
+// the ones changed.
+const workdirSyncIndex = ".srcd-sync.json"
+
+// syncProgressInterval is how often the progress of a sync is logged.
+const syncProgressInterval = 5 * time.Second
+
+// checkSyncWorkdir validates the values of --sync-workdir.
+func checkSyncWorkdir(value string) error {
+	switch value {
+	case syncWorkdirAuto, syncWorkdirOn, syncWorkdirOff:
+		return nil
+	default:
+		return fmt.Errorf("it must be on, off or auto")
+	}
+}
+
+// resolveWorkdirSync returns whether the working directory is synced into a
+// volume for the value of --sync-workdir, given the remote host docker runs
+// on, if any, and whether the running daemon already syncs it. With auto, it
+// keeps syncing it, and otherwise it's only asked when docker is remote.
+func resolveWorkdirSync(value, remote string, synced bool) (sync, ask bool, err error) {
+	if err := checkSyncWorkdir(value); err != nil {
+		return false, false, usageErrorf("invalid --sync-workdir %s: %v", value, err)
+	}
+
+	switch {
+	case value == syncWorkdirOn:
+		return true, false, nil
+	case value == syncWorkdirOff || remote == "":
+		return false, false, nil
+	case synced:
+		return true, false, nil
+	default:
+		return false, true, nil
+	}
+}
+
+// askWorkdirSync asks whether to sync the working directory into a volume of
+// the remote docker host, as a bind mount would be a directory of that host.
+// It only warns when stdin is not a terminal, keeping the bind mount.
+func askWorkdirSync(remote, workdir string) bool {
+	if !isTerminal(os.Stdin) || machineOutput() {
+		logrus.Warnf("docker runs on %s, so gitbase mounts the %s of that host, not the one of this machine; "+
+			"use --sync-workdir on to copy it there", remote, workdir)
+		return false
+	}
+
+	question := fmt.Sprintf("docker runs on %s, which doesn't have %s of this machine: "+
+		"copy it into a volume there, syncing it on every init?", remote, workdir)
+	return askYesNo(bufio.NewReader(os.Stdin), os.Stderr, question)
+}
+
+// syncWorkdirStep returns the step syncing the working directory into its
+// volume, or nil if it's mounted.
+func syncWorkdirStep(cfg *daemon.Config) *initStep {
+	if cfg.WorkdirVolume == "" {
+		return nil
+	}
+
+	return &initStep{
+		name: "sync working directory",
+		run: func() error {
+			res, err := syncWorkdir(context.Background(), cfg.Workdir, cfg.WorkdirVolume)
+			if err != nil {
+				return err
+			}
+
+			logrus.Info(res)
+			logNewRepositories(res)
+			return nil
+		},
+	}
+}
+
+// logNewRepositories tells gitbase only lists the repositories synced since
+// it started once it's restarted.
+func logNewRepositories(res *workdirSyncResult) {
+	if res.NewRepositories == 0 {
+		return
+	}
+
+	if running, err := docker.IsRunning(components.Gitbase.Name); err == nil && running {
+		logrus.Infof("%d repositories were added, gitbase lists them once restarted with srcd restart gitbase",
+			res.NewRepositories)
+	}
+}
+
+// syncIndex lists the files, directories and symlinks of the working
+// directory synced into a volume, by their slash separated path relative to
+// it.
+type syncIndex struct {
+	Workdir string               `json:"workdir"`
+	Files   map[string]syncEntry `json:"files"`
+}
+
+// syncEntry is what's compared of a file to know whether it changed since
+// it was synced.
+type syncEntry struct {
+	Size    int64       `json:"size"`
+	ModTime int64       `json:"mtime"`
+	Mode    os.FileMode `json:"mode"`
+}
+
+func newSyncEntry(fi os.FileInfo) syncEntry {
+	e := syncEntry{ModTime: fi.ModTime().UnixNano(), Mode: fi.Mode()}
+	if fi.Mode().IsRegular() {
+		e.Size = fi.Size()
+	}
+	return e
+}
+
+// syncable reports whether the file can be synced: only regular files,
+// directories and symlinks are.
+func syncable(fi os.FileInfo) bool {
+	return fi.Mode().IsRegular() || fi.IsDir() || fi.Mode()&os.ModeSymlink != 0
+}
+
+// scanWorkdir returns the index of the files of the working directory as
+// they are now.
+func scanWorkdir(workdir string) (*syncIndex, error) {
+	idx := &syncIndex{Workdir: workdir, Files: make(map[string]syncEntry)}
+	err := filepath.Walk(workdir, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(workdir, p)
+		if err != nil {
+			return err
+		}
+
+		rel = filepath.ToSlash(rel)
+		if rel == "." || rel == workdirSyncIndex || !syncable(fi) {
+			return nil
+		}
+
+		idx.Files[rel] = newSyncEntry(fi)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not read the working directory to sync it: %v", err)
+	}
+	return idx, nil
+}
+
+// diffSyncIndex returns the paths of current that are not in previous, or
+// whose size, modification time or mode changed, parents first, and the ones
+// of previous no longer in current, leaving out the ones inside directories
+// removed too.
+func diffSyncIndex(previous, current *syncIndex) (changed, removed []string) {
+	for p, e := range current.Files {
+		if old, ok := previous.Files[p]; !ok || old != e {
+			changed = append(changed, p)
+		}
+	}
+
+	gone := make(map[string]bool)
+	for p := range previous.Files {
+		if _, ok := current.Files[p]; !ok {
+			gone[p] = true
+		}
+	}
+
+	for p := range gone {
+		parentGone := false
+		for dir := path.Dir(p); dir != "."; dir = path.Dir(dir) {
+			if gone[dir] {
+				parentGone = true
+				break
+			}
+		}
+
+		if !parentGone {
+			removed = append(removed, p)
+		}
+	}
+
+	// A directory is always before the paths inside it.
+	sort.Strings(changed)
+	sort.Strings(removed)
+	return changed, removed
+}
+
+// newRepositories returns how many of the paths are of repositories not in
+// the index: .git directories and siva files.
+func newRepositories(previous *syncIndex, paths []string) int {
+	var n int
+	for _, p := range paths {
+		if _, ok := previous.Files[p]; ok {
+			continue
+		}
+
+		if path.Base(p) == ".git" || strings.HasSuffix(p, ".siva") {
+			n++
+		}
+	}
+	return n
+}
+
+// workdirSyncResult is what a sync of the working directory copied into its
+// volume.
+type workdirSyncResult struct {
+	Volume string `json:"volume"`
+	// Copied is the number of files, directories and symlinks copied, and
+	// Bytes the size of the files.
+	Copied  int   `json:"copied"`
+	Bytes   int64 `json:"bytes"`
+	Removed int   `json:"removed"`
+	// NewRepositories is how many repositories were not in the volume.
+	NewRepositories int    `json:"new_repositories"`
+	Took            string `json:"took"`
+}
+
+func (r *workdirSyncResult) String() string {
+	if r.Copied == 0 && r.Removed == 0 {
+		return fmt.Sprintf("volume %s is up to date with the working directory", r.Volume)
+	}
+
+	return fmt.Sprintf("copied %d files and directories (%s) into volume %s and removed %d in %s",
+		r.Copied, units.HumanSize(float64(r.Bytes)), r.Volume, r.Removed, r.Took)
+}
+
+// syncWorkdir copies the files of the working directory that changed since
+// the last sync into the volume with the given name, creating it, and
+// removes from it the ones removed. Without the index of the last sync, or
+// if it was of another directory, the volume is emptied and everything is
+// copied again. The progress is logged every syncProgressInterval.
+func syncWorkdir(ctx context.Context, workdir, volume string) (*workdirSyncResult, error) {
+	start := time.Now()
+	image := components.Daemon.Ref()
+	if err := docker.CreateVolume(ctx, volume, "", nil); err != nil {
+		return nil, err
+	}
+
+	previous, err := readSyncIndex(ctx, volume, image)
+	if err != nil {
+		logrus.Debugf("copying the whole working directory, no index of the last sync: %v", err)
+	}
+
+	if previous == nil || previous.Workdir != workdir {
+		if err := docker.EmptyVolume(ctx, volume, image); err != nil {
+			return nil, err
+		}
+		previous = &syncIndex{Files: make(map[string]syncEntry)}
+	}
+
+	current, err := scanWorkdir(workdir)
+	if err != nil {
+		return nil, err
+	}
+
+	changed, removed := diffSyncIndex(previous, current)
+	res := &workdirSyncResult{
+		Volume:          volume,
+		Copied:          len(changed),
+		Removed:         len(removed),
+		NewRepositories: newRepositories(previous, changed),
+	}
+	defer func() { res.Took = time.Since(start).Round(time.Second).String() }()
+	if len(changed) == 0 && len(removed) == 0 {
+		return res, nil
+	}
+
+	if err := docker.RemoveFromVolume(ctx, volume, image, removed); err != nil {
+		return nil, err
+	}
+
+	progress := &syncProgress{start: start}
+	for _, p := range changed {
+		progress.total += current.Files[p].Size
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go progress.log(stop)
+
+	pr, pw := io.Pipe()
+	errc := make(chan error, 1)
+	go func() {
+		err := writeSyncTar(pw, workdir, changed, current, progress)
+		pw.CloseWithError(err)
+		errc <- err
+	}()
+
+	err = docker.CopyToVolume(ctx, volume, image, pr)
+	pr.Close()
+	if werr := <-errc; werr != nil && werr != io.ErrClosedPipe {
+		return nil, werr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	res.Bytes = progress.copied()
+	return res, nil
+}
+
+// readSyncIndex reads the index of the last sync from the volume.
+func readSyncIndex(ctx context.Context, volume, image string) (*syncIndex, error) {
+	content, err := docker.ReadFromVolume(ctx, volume, image, workdirSyncIndex)
+	if err != nil {
+		return nil, err
+	}
+
+	var idx syncIndex
+	if err := json.Unmarshal(content, &idx); err != nil {
+		return nil, fmt.Errorf("invalid index of the last sync: %v", err)
+	}
+	if idx.Files == nil {
+		idx.Files = make(map[string]syncEntry)
+	}
+	return &idx, nil
+}
+
+// writeSyncTar writes to w a tarball with the files of the working directory
+// at the given paths, counting the bytes of their content with progress, and
+// the index, updated with the files as they were copied, at the end.
+func writeSyncTar(w io.Writer, workdir string, paths []string, idx *syncIndex, progress io.Writer) error {
+	tw := tar.NewWriter(w)
+	for _, p := range paths {
+		if err := writeSyncEntry(tw, workdir, p, idx, progress); err != nil {
+			return err
+		}
+	}
+
+	content, err := json.Marshal(idx)
+	if err != nil {
+		return err
+	}
+
+	hdr := &tar.Header{
+		Name:     workdirSyncIndex,
+		Mode:     0644,
+		Size:     int64(len(content)),
+		ModTime:  time.Now(),
+		Typeflag: tar.TypeReg,
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if _, err := tw.Write(content); err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// writeSyncEntry writes the file of the working directory at the given path
+// to tw, recording it in the index as it is when it's copied. The files
+// removed since the working directory was scanned are left out, and kept in
+// the index so the next sync removes them from the volume.
+func writeSyncEntry(tw *tar.Writer, workdir, p string, idx *syncIndex, progress io.Writer) error {
+	file := filepath.Join(workdir, filepath.FromSlash(p))
+	fi, err := os.Lstat(file)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if !syncable(fi) {
+		return nil
+	}
+
+	var link string
+	if fi.Mode()&os.ModeSymlink != 0 {
+		if link, err = os.Readlink(file); err != nil {
+			return err
+		}
+	}
+
+	hdr, err := tar.FileInfoHeader(fi, link)
+	if err != nil {
+		return err
+	}
+
+	hdr.Name = p
+	if fi.IsDir() {
+		hdr.Name += "/"
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+
+	if fi.Mode().IsRegular() {
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		_, err = io.CopyN(io.MultiWriter(tw, progress), f, hdr.Size)
+		if err == io.EOF {
+			return fmt.Errorf("%s changed while it was synced, sync it again", file)
+		} else if err != nil {
+			return err
+		}
+	}
+
+	idx.Files[p] = newSyncEntry(fi)
+	return nil
+}
+
+// syncProgress counts the bytes of the files copied by a sync out of the
+// total.
+type syncProgress struct {
+	start time.Time
+	total int64
+	done  int64
+}
+
+func (p *syncProgress) Write(b []byte) (int, error) {
+	atomic.AddInt64(&p.done, int64(len(b)))
+	return len(b), nil
+}
+
+func (p *syncProgress) copied() int64 {
+	return atomic.LoadInt64(&p.done)
+}
+
+// log logs the progress every syncProgressInterval until stop is closed.
+func (p *syncProgress) log(stop <-chan struct{}) {
+	t := time.NewTicker(syncProgressInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-t.C:
+			logrus.Info(p.status(p.copied(), time.Since(p.start)))
+		}
+	}
+}
+
+// status says how much of the total was copied, and how long the rest would
+// take at the same pace.
+func (p *syncProgress) status(done int64, elapsed time.Duration) string {
+	percent := int64(100)
+	if p.total > 0 {
+		percent = done * 100 / p.total
+	}
+
+	msg := fmt.Sprintf("synced %s of %s of the working directory (%d%%)",
+		units.HumanSize(float64(done)), units.HumanSize(float64(p.total)), percent)
+	if done > 0 && done < p.total {
+		left := time.Duration(float64(elapsed) * float64(p.total-done) / float64(done))
+		msg += fmt.Sprintf(", about %s left", left.Round(time.Second))
+	}
+	return msg
+}
@@ -0,0 +1,245 @@
+package cmd
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestResolveWorkdirSync(t *testing.T) {
+	testCases := []struct {
+		name   string
+		value  string
+		remote string
+		synced bool
+		sync   bool
+		ask    bool
+		err    string
+	}{
+		{"local", syncWorkdirAuto, "", false, false, false, ""},
+		{"remote", syncWorkdirAuto, "build.example.com", false, false, true, ""},
+		{"already synced", syncWorkdirAuto, "build.example.com", true, true, false, ""},
+		{"on", syncWorkdirOn, "", false, true, false, ""},
+		{"off", syncWorkdirOff, "build.example.com", true, false, false, ""},
+		{"invalid", "yes", "build.example.com", false, false, false, "invalid --sync-workdir yes: it must be on, off or auto"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			sync, ask, err := resolveWorkdirSync(tc.value, tc.remote, tc.synced)
+			var errMsg string
+			if err != nil {
+				errMsg = err.Error()
+			}
+			if errMsg != tc.err {
+				t.Fatalf("expected: %s, got: %s", tc.err, errMsg)
+			}
+
+			if sync != tc.sync || ask != tc.ask {
+				t.Errorf("expected: sync %v, ask %v, got: sync %v, ask %v", tc.sync, tc.ask, sync, ask)
+			}
+		})
+	}
+}
+
+func TestDiffSyncIndex(t *testing.T) {
+	dir := syncEntry{ModTime: 1, Mode: os.ModeDir | 0755}
+	file := syncEntry{Size: 10, ModTime: 1, Mode: 0644}
+	previous := &syncIndex{Files: map[string]syncEntry{
+		"engine":                 dir,
+		"engine/.git":            dir,
+		"engine/.git/HEAD":       file,
+		"engine/.git/config":     file,
+		"old":                    dir,
+		"old/.git":               dir,
+		"old/.git/HEAD":          file,
+		"engine/README.md":       file,
+		"engine/docs/removed.md": file,
+	}}
+	current := &syncIndex{Files: map[string]syncEntry{
+		"engine":             dir,
+		"engine/.git":        dir,
+		"engine/.git/HEAD":   {Size: 12, ModTime: 1, Mode: 0644},
+		"engine/.git/config": {Size: 10, ModTime: 2, Mode: 0644},
+		"engine/README.md":   file,
+		"new":                dir,
+		"new/.git":           dir,
+		"new/.git/HEAD":      file,
+	}}
+
+	changed, removed := diffSyncIndex(previous, current)
+	expected := "[engine/.git/HEAD engine/.git/config new new/.git new/.git/HEAD]"
+	if fmt.Sprint(changed) != expected {
+		t.Errorf("expected: %s, got: %v", expected, changed)
+	}
+
+	expected = "[engine/docs/removed.md old]"
+	if fmt.Sprint(removed) != expected {
+		t.Errorf("expected: %s, got: %v", expected, removed)
+	}
+
+	if n := newRepositories(previous, changed); n != 1 {
+		t.Errorf("expected: 1 new repository, got: %d", n)
+	}
+
+	changed, removed = diffSyncIndex(current, current)
+	if len(changed) != 0 || len(removed) != 0 {
+		t.Errorf("expected: nothing to sync, got: %v and %v", changed, removed)
+	}
+}
+
+func TestScanWorkdir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "srcd-sync")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"repo/.git/HEAD":      "ref: refs/heads/master\n",
+		"repo/main.go":        "package main\n",
+		"b.siva":              "siva",
+		workdirSyncIndex:      "{}",
+		"repo/.git/logs/HEAD": "",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	idx, err := scanWorkdir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if idx.Workdir != dir {
+		t.Errorf("expected: %s, got: %s", dir, idx.Workdir)
+	}
+
+	var paths []string
+	for p := range idx.Files {
+		paths = append(paths, p)
+	}
+	expected := 7
+	if len(paths) != expected {
+		t.Errorf("expected: %d paths without the index, got: %v", expected, paths)
+	}
+
+	if e := idx.Files["repo/main.go"]; e.Size != 13 || !e.Mode.IsRegular() {
+		t.Errorf("expected: a regular file of 13 bytes, got: %+v", e)
+	}
+	if e := idx.Files["repo/.git"]; e.Size != 0 || !e.Mode.IsDir() {
+		t.Errorf("expected: a directory, got: %+v", e)
+	}
+}
+
+func TestWriteSyncTar(t *testing.T) {
+	dir, err := ioutil.TempDir("", "srcd-sync")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := os.MkdirAll(filepath.Join(dir, "repo"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "repo", "main.go"), []byte("package main\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The file gone since the scan is left out, and kept in the index.
+	idx := &syncIndex{Workdir: dir, Files: map[string]syncEntry{
+		"repo":         {Mode: os.ModeDir | 0755},
+		"repo/main.go": {Size: 1, Mode: 0644},
+		"repo/gone.go": {Size: 1, Mode: 0644},
+	}}
+
+	var buf bytes.Buffer
+	progress := &syncProgress{total: 13}
+	err = writeSyncTar(&buf, dir, []string{"repo", "repo/gone.go", "repo/main.go"}, idx, progress)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	var written syncIndex
+	tr := tar.NewReader(&buf)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+
+		names = append(names, hdr.Name)
+		if hdr.Name == workdirSyncIndex {
+			if err := json.NewDecoder(tr).Decode(&written); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	expected := "[repo/ repo/main.go " + workdirSyncIndex + "]"
+	if fmt.Sprint(names) != expected {
+		t.Errorf("expected: %s, got: %v", expected, names)
+	}
+
+	if progress.copied() != 13 {
+		t.Errorf("expected: 13 bytes copied, got: %d", progress.copied())
+	}
+
+	if e := written.Files["repo/main.go"]; e.Size != 13 {
+		t.Errorf("expected: the file as copied in the index, got: %+v", e)
+	}
+	if _, ok := written.Files["repo/gone.go"]; !ok {
+		t.Errorf("expected: the file gone kept in the index, got: %v", written.Files)
+	}
+}
+
+func TestSyncProgressStatus(t *testing.T) {
+	p := &syncProgress{total: 4000000000}
+
+	testCases := []struct {
+		done     int64
+		expected string
+	}{
+		{0, "synced 0B of 4GB of the working directory (0%)"},
+		{1000000000, "synced 1GB of 4GB of the working directory (25%), about 1m30s left"},
+		{4000000000, "synced 4GB of 4GB of the working directory (100%)"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(fmt.Sprint(tc.done), func(t *testing.T) {
+			if result := p.status(tc.done, 30*time.Second); result != tc.expected {
+				t.Errorf("expected: %s, got: %s", tc.expected, result)
+			}
+		})
+	}
+}
+
+func TestWorkdirSyncResult(t *testing.T) {
+	res := &workdirSyncResult{Volume: "srcd-cli-workdir"}
+	expected := "volume srcd-cli-workdir is up to date with the working directory"
+	if res.String() != expected {
+		t.Errorf("expected: %s, got: %s", expected, res)
+	}
+
+	res = &workdirSyncResult{Volume: "srcd-cli-workdir", Copied: 3, Bytes: 2500000, Removed: 1, Took: "2s"}
+	expected = "copied 3 files and directories (2.5MB) into volume srcd-cli-workdir and removed 1 in 2s"
+	if res.String() != expected {
+		t.Errorf("expected: %s, got: %s", expected, res)
+	}
+}
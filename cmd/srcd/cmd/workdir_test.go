@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/src-d/engine/api"
+)
+
+func TestOtherQueries(t *testing.T) {
+	header := &api.SQLResponse_Row{Cell: []string{"Id", "User", "Command", "Time", "State", "Info"}}
+	row := func(info string) *api.SQLResponse_Row {
+		return &api.SQLResponse_Row{Cell: []string{"1", "root", "query", "3", "running", info}}
+	}
+
+	testCases := []struct {
+		name     string
+		rows     []*api.SQLResponse_Row
+		expected int
+	}{
+		{"only the processlist", []*api.SQLResponse_Row{row("SHOW PROCESSLIST")}, 0},
+		{"lowercase processlist", []*api.SQLResponse_Row{row("show processlist")}, 0},
+		{"running", []*api.SQLResponse_Row{
+			row("SHOW PROCESSLIST"),
+			row("SELECT * FROM commits"),
+			row("CREATE INDEX files_idx ON files USING pilosa (file_path)"),
+		}, 2},
+		{"none", nil, 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			res := &api.SQLResponse{Header: header, Rows: tc.rows}
+			if queries := otherQueries(res, "SHOW PROCESSLIST"); queries != tc.expected {
+				t.Errorf("expected: %d, got: %d", tc.expected, queries)
+			}
+		})
+	}
+}
+
+func TestConfirmWorkdirChange(t *testing.T) {
+	testCases := []struct {
+		name     string
+		queries  int
+		terminal bool
+		answer   string
+		expected bool
+		asked    bool
+		err      string
+	}{
+		{"no queries", 0, false, "", true, false, ""},
+		{"not a terminal", 2, false, "", false, false,
+			"2 queries running in gitbase would be cut off, use --yes to change the working directory anyway"},
+		{"yes", 1, true, "y\n", true, true, ""},
+		{"no", 1, true, "n\n", false, true, ""},
+		{"no answer", 1, true, "", false, true, ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var out bytes.Buffer
+			ok, err := confirmWorkdirChange(tc.queries, tc.terminal, strings.NewReader(tc.answer), &out)
+			var errMsg string
+			if err != nil {
+				errMsg = err.Error()
+			}
+			if errMsg != tc.err {
+				t.Fatalf("expected: %s, got: %s", tc.err, errMsg)
+			}
+
+			if ok != tc.expected {
+				t.Errorf("expected: %v, got: %v", tc.expected, ok)
+			}
+
+			if asked := out.Len() > 0; asked != tc.asked {
+				t.Errorf("expected asked: %v, got: %v (%q)", tc.asked, asked, out.String())
+			}
+		})
+	}
+}
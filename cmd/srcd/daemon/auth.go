@@ -0,0 +1,433 @@
+package daemon
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/src-d/engine/components"
+	"google.golang.org/grpc/credentials"
+)
+
+// Environment variables the credentials are given to the daemon with.
+const (
+	envToken   = "SRCD_DAEMON_TOKEN"
+	envTLSCert = "SRCD_DAEMON_TLS_CERT"
+	envTLSKey  = "SRCD_DAEMON_TLS_KEY"
+	// envGitbasePassword is the password the daemon connects to gitbase
+	// with, and creates gitbase with.
+	envGitbasePassword = "SRCD_GITBASE_PASSWORD"
+)
+
+// Auth configures the credentials of the daemons served on a TCP port, set
+// from the configuration. The daemons served on a unix socket don't need
+// them, only their user can reach it.
+var Auth AuthOptions
+
+// AuthOptions are the credentials of the daemons served on a TCP port.
+type AuthOptions struct {
+	// TLS makes the daemons created be served with TLS, with a self-signed
+	// certificate generated in the data directory.
+	TLS bool
+	// Token and CertFingerprint, the SHA-256 of the certificate in hex, are
+	// used instead of the ones in the data directory, to reach a daemon
+	// created from another machine.
+	Token           string
+	CertFingerprint string
+}
+
+// credentialFiles are the files with the credentials of the daemon in the auth
+// directory of the data directory.
+type credentialFiles struct {
+	dir string
+}
+
+func newCredentialFiles(datadir string) credentialFiles {
+	return credentialFiles{filepath.Join(datadir, "auth")}
+}
+
+func (f credentialFiles) token() string { return filepath.Join(f.dir, "token") }
+func (f credentialFiles) cert() string  { return filepath.Join(f.dir, "cert.pem") }
+func (f credentialFiles) key() string   { return filepath.Join(f.dir, "key.pem") }
+
+func (f credentialFiles) gitbasePassword() string { return filepath.Join(f.dir, "gitbase-password") }
+
+func (f credentialFiles) webToken() string { return filepath.Join(f.dir, "web-token") }
+func (f credentialFiles) webCert() string  { return filepath.Join(f.dir, "web-cert.pem") }
+func (f credentialFiles) webKey() string   { return filepath.Join(f.dir, "web-key.pem") }
+
+// daemonCredentials are the token, and the certificate and key in PEM if TLS
+// is used, the daemon is created with.
+type daemonCredentials struct {
+	token string
+	cert  []byte
+	key   []byte
+}
+
+// env returns the environment variables giving the credentials to the daemon.
+func (c *daemonCredentials) env() []string {
+	env := []string{envToken + "=" + c.token}
+	if c.cert != nil {
+		env = append(env, envTLSCert+"="+string(c.cert), envTLSKey+"="+string(c.key))
+	}
+	return env
+}
+
+// loadOrCreateCredentials returns the credentials kept in the data
+// directory, generating the ones missing, only readable by the user.
+func loadOrCreateCredentials(datadir string, withTLS bool) (*daemonCredentials, error) {
+	files := newCredentialFiles(datadir)
+	if err := os.MkdirAll(files.dir, 0700); err != nil {
+		return nil, errors.Wrap(err, "unable to create the directory of the daemon credentials")
+	}
+
+	token, err := ioutil.ReadFile(files.token())
+	if os.IsNotExist(err) {
+		token, err = generateToken()
+		if err == nil {
+			err = ioutil.WriteFile(files.token(), token, 0600)
+		}
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to get the token of the daemon")
+	}
+
+	c := &daemonCredentials{token: strings.TrimSpace(string(token))}
+	if !withTLS {
+		return c, nil
+	}
+
+	c.cert, err = ioutil.ReadFile(files.cert())
+	if err == nil {
+		c.key, err = ioutil.ReadFile(files.key())
+	}
+
+	if os.IsNotExist(err) {
+		// The certificate is shared by the daemons of all the environments,
+		// so it has the name of the default one. The CLI checks its
+		// fingerprint instead of its names, so it's valid for whatever host
+		// the daemon runs on.
+		name := components.NamePrefix + "daemon"
+		c.cert, c.key, err = generateCertificate(time.Now(), name, []string{name, "localhost"})
+		if err == nil {
+			err = ioutil.WriteFile(files.key(), c.key, 0600)
+		}
+		if err == nil {
+			err = ioutil.WriteFile(files.cert(), c.cert, 0644)
+		}
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to get the TLS certificate of the daemon")
+	}
+	return c, nil
+}
+
+// GitbasePasswordFile returns the file of the data directory with the
+// password of gitbase.
+func GitbasePasswordFile(datadir string) string {
+	return newCredentialFiles(datadir).gitbasePassword()
+}
+
+// StoredGitbasePassword returns the password of gitbase kept in the data
+// directory, or an empty string if there's none.
+func StoredGitbasePassword(datadir string) (string, error) {
+	password, err := ioutil.ReadFile(GitbasePasswordFile(datadir))
+	if os.IsNotExist(err) {
+		return "", nil
+	} else if err != nil {
+		return "", errors.Wrap(err, "unable to read the password of gitbase")
+	}
+	return strings.TrimSpace(string(password)), nil
+}
+
+// GenerateGitbasePassword returns a random password for gitbase.
+func GenerateGitbasePassword() (string, error) {
+	password, err := generateToken()
+	if err != nil {
+		return "", errors.Wrap(err, "unable to generate the password of gitbase")
+	}
+	return string(password), nil
+}
+
+// storeGitbasePassword keeps the password of gitbase in the data directory,
+// only readable by the user. The file is replaced at once, so it's never left
+// with half of a password.
+func storeGitbasePassword(datadir, password string) error {
+	if err := storeSecret(datadir, newCredentialFiles(datadir).gitbasePassword(), password); err != nil {
+		return errors.Wrap(err, "unable to store the password of gitbase")
+	}
+	return nil
+}
+
+// storeSecret writes the secret to the file of the directory of the
+// credentials, replacing it at once.
+func storeSecret(datadir, path, secret string) error {
+	files := newCredentialFiles(datadir)
+	if err := os.MkdirAll(files.dir, 0700); err != nil {
+		return errors.Wrap(err, "unable to create the directory of the credentials")
+	}
+
+	// Temporary files are only readable by the user.
+	f, err := ioutil.TempFile(files.dir, "."+filepath.Base(path))
+	if err != nil {
+		return err
+	}
+
+	_, err = f.WriteString(secret)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return nil
+}
+
+// WebToken returns the token the requests to the web clients must have, kept
+// in the data directory, generating it if it's missing or rotate is true.
+func WebToken(datadir string, rotate bool) (string, error) {
+	path := newCredentialFiles(datadir).webToken()
+	if !rotate {
+		token, err := ioutil.ReadFile(path)
+		if err == nil {
+			return strings.TrimSpace(string(token)), nil
+		} else if !os.IsNotExist(err) {
+			return "", errors.Wrap(err, "unable to read the token of the web clients")
+		}
+	}
+
+	token, err := generateToken()
+	if err == nil {
+		err = storeSecret(datadir, path, string(token))
+	}
+	if err != nil {
+		return "", errors.Wrap(err, "unable to store the token of the web clients")
+	}
+	return string(token), nil
+}
+
+func generateToken() ([]byte, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	return []byte(hex.EncodeToString(b)), nil
+}
+
+// WebCertificate returns the self-signed certificate and its key in PEM the
+// web clients are served with over HTTPS, kept in the data directory, and the
+// file of the certificate. It's generated again when it's not valid for the
+// given host names and addresses, so they can be changed with a flag.
+func WebCertificate(datadir string, hosts []string) (cert, key []byte, path string, err error) {
+	files := newCredentialFiles(datadir)
+	if err := os.MkdirAll(files.dir, 0700); err != nil {
+		return nil, nil, "", errors.Wrap(err, "unable to create the directory of the credentials")
+	}
+
+	cert, err = ioutil.ReadFile(files.webCert())
+	if err == nil {
+		key, err = ioutil.ReadFile(files.webKey())
+	}
+	if err == nil && !sameHosts(certHosts(cert), hosts) {
+		err = os.ErrNotExist
+	}
+
+	if os.IsNotExist(err) {
+		cert, key, err = generateCertificate(time.Now(), components.NamePrefix+"web", hosts)
+		if err == nil {
+			err = ioutil.WriteFile(files.webKey(), key, 0600)
+		}
+		if err == nil {
+			err = ioutil.WriteFile(files.webCert(), cert, 0644)
+		}
+	}
+	if err != nil {
+		return nil, nil, "", errors.Wrap(err, "unable to get the TLS certificate of the web clients")
+	}
+	return cert, key, files.webCert(), nil
+}
+
+// certHosts returns the host names and addresses the certificate in PEM is
+// valid for, none if it can't be read.
+func certHosts(cert []byte) []string {
+	block, _ := pem.Decode(cert)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil
+	}
+
+	c, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil
+	}
+
+	hosts := append([]string(nil), c.DNSNames...)
+	for _, ip := range c.IPAddresses {
+		hosts = append(hosts, ip.String())
+	}
+	return hosts
+}
+
+func sameHosts(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	a, b = append([]string(nil), a...), append([]string(nil), b...)
+	sort.Strings(a)
+	sort.Strings(b)
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// generateCertificate returns a self-signed certificate with the given common
+// name, valid for the given host names and addresses, and its key in PEM.
+func generateCertificate(now time.Time, name string, hosts []string) (cert, key []byte, err error) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.AddDate(10, 0, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, h)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &priv.PublicKey, priv)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(priv)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cert = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	key = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return cert, key, nil
+}
+
+// certFingerprint returns the SHA-256 of the first certificate in PEM, in
+// hex.
+func certFingerprint(cert []byte) (string, error) {
+	block, _ := pem.Decode(cert)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return "", fmt.Errorf("invalid certificate")
+	}
+	return fingerprint(block.Bytes), nil
+}
+
+func fingerprint(der []byte) string {
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:])
+}
+
+// normalizeFingerprint accepts fingerprints in hex with or without colons,
+// like openssl x509 -fingerprint -sha256 prints them.
+func normalizeFingerprint(f string) string {
+	return strings.ToLower(strings.Replace(strings.TrimSpace(f), ":", "", -1))
+}
+
+// clientCredentials returns the token and the fingerprint of the certificate
+// of the daemon using the given data directory: the ones of Auth, if given,
+// or the ones in the directory.
+func clientCredentials(datadir string, withTLS bool) (token, fp string, err error) {
+	files := newCredentialFiles(datadir)
+	token = Auth.Token
+	if token == "" {
+		content, err := ioutil.ReadFile(files.token())
+		if err != nil && !os.IsNotExist(err) {
+			return "", "", errors.Wrap(err, "unable to read the token of the daemon")
+		}
+		token = strings.TrimSpace(string(content))
+	}
+
+	if !withTLS {
+		return token, "", nil
+	}
+
+	fp = normalizeFingerprint(Auth.CertFingerprint)
+	if fp == "" {
+		cert, err := ioutil.ReadFile(files.cert())
+		if os.IsNotExist(err) {
+			return "", "", fmt.Errorf("the daemon is served with TLS but its certificate " +
+				"is not in the data directory, give its fingerprint with --daemon-cert-fingerprint")
+		} else if err != nil {
+			return "", "", errors.Wrap(err, "unable to read the certificate of the daemon")
+		}
+
+		if fp, err = certFingerprint(cert); err != nil {
+			return "", "", errors.Wrapf(err, "unable to read the certificate of the daemon %s", files.cert())
+		}
+	}
+	return token, fp, nil
+}
+
+// pinnedTLS returns the TLS configuration accepting only the certificate
+// with the given fingerprint, as it's self-signed.
+func pinnedTLS(fp string) *tls.Config {
+	return &tls.Config{
+		// The certificate is verified by its fingerprint instead.
+		InsecureSkipVerify: true,
+		VerifyPeerCertificate: func(raw [][]byte, _ [][]*x509.Certificate) error {
+			if len(raw) == 0 || fingerprint(raw[0]) != fp {
+				return fmt.Errorf("the certificate of the daemon doesn't have the fingerprint %s", fp)
+			}
+			return nil
+		},
+	}
+}
+
+// tokenCredentials sends the token of the daemon with every call.
+type tokenCredentials string
+
+var _ credentials.PerRPCCredentials = tokenCredentials("")
+
+func (t tokenCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + string(t)}, nil
+}
+
+// RequireTransportSecurity is false so the token is also sent to the daemons
+// served without TLS on localhost.
+func (t tokenCredentials) RequireTransportSecurity() bool { return false }
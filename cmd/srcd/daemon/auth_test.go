@@ -0,0 +1,222 @@
+package daemon
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestLoadOrCreateCredentials(t *testing.T) {
+	dir, err := ioutil.TempDir("", "srcd-auth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c, err := loadOrCreateCredentials(dir, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(c.token) != 64 || c.cert != nil {
+		t.Errorf("expected a token of 64 characters and no certificate, got: %q %q", c.token, c.cert)
+	}
+
+	again, err := loadOrCreateCredentials(dir, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if again.token != c.token {
+		t.Errorf("expected: %s, got: %s", c.token, again.token)
+	}
+
+	fi, err := os.Stat(newCredentialFiles(dir).key())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if fi.Mode().Perm() != 0600 {
+		t.Errorf("expected: %v, got: %v", os.FileMode(0600), fi.Mode().Perm())
+	}
+
+	token, fp, err := clientCredentials(dir, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected, _ := certFingerprint(again.cert)
+	if token != c.token || fp != expected {
+		t.Errorf("expected: %s %s, got: %s %s", c.token, expected, token, fp)
+	}
+}
+
+func TestWebCertificate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "srcd-auth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	hosts := []string{"localhost", "127.0.0.1"}
+	cert, key, path, err := WebCertificate(dir, hosts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if path != newCredentialFiles(dir).webCert() {
+		t.Errorf("expected: %s, got: %s", newCredentialFiles(dir).webCert(), path)
+	}
+
+	if got := certHosts(cert); !sameHosts(got, hosts) {
+		t.Errorf("expected: %v, got: %v", hosts, got)
+	}
+
+	again, _, _, err := WebCertificate(dir, []string{"127.0.0.1", "localhost"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if string(again) != string(cert) {
+		t.Errorf("expected the same certificate for the same hosts")
+	}
+
+	hosts = append(hosts, "engine.example.com")
+	other, otherKey, _, err := WebCertificate(dir, hosts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if string(other) == string(cert) || string(otherKey) == string(key) {
+		t.Errorf("expected a new certificate for other hosts")
+	}
+
+	if got := certHosts(other); !sameHosts(got, hosts) {
+		t.Errorf("expected: %v, got: %v", hosts, got)
+	}
+}
+
+func TestWebToken(t *testing.T) {
+	dir, err := ioutil.TempDir("", "srcd-auth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	token, err := WebToken(dir, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(token) != 64 {
+		t.Errorf("expected a token of 64 characters, got: %q", token)
+	}
+
+	fi, err := os.Stat(newCredentialFiles(dir).webToken())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if fi.Mode().Perm() != 0600 {
+		t.Errorf("expected: %v, got: %v", os.FileMode(0600), fi.Mode().Perm())
+	}
+
+	again, err := WebToken(dir, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if again != token {
+		t.Errorf("expected: %s, got: %s", token, again)
+	}
+
+	rotated, err := WebToken(dir, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if rotated == token {
+		t.Errorf("expected a new token after rotating it")
+	}
+}
+
+func TestStoreGitbasePassword(t *testing.T) {
+	dir, err := ioutil.TempDir("", "srcd-auth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	password, err := StoredGitbasePassword(dir)
+	if err != nil || password != "" {
+		t.Fatalf("expected no password, got: %q %v", password, err)
+	}
+
+	for _, p := range []string{"first", "second"} {
+		if err := storeGitbasePassword(dir, p); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		password, err := StoredGitbasePassword(dir)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if password != p {
+			t.Errorf("expected: %s, got: %s", p, password)
+		}
+	}
+
+	fi, err := os.Stat(GitbasePasswordFile(dir))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if fi.Mode().Perm() != 0600 {
+		t.Errorf("expected: -rw-------, got: %s", fi.Mode().Perm())
+	}
+
+	files, err := ioutil.ReadDir(newCredentialFiles(dir).dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(files) != 1 {
+		t.Errorf("expected: only the password file, got: %d files", len(files))
+	}
+}
+
+func TestPinnedTLS(t *testing.T) {
+	cert, _, err := generateCertificate(time.Now(), "srcd-cli-daemon", []string{"localhost"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	fp, err := certFingerprint(cert)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	block, _ := pem.Decode(cert)
+	if err := pinnedTLS(fp).VerifyPeerCertificate([][]byte{block.Bytes}, nil); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	other, _, err := generateCertificate(time.Now(), "srcd-cli-daemon", []string{"localhost"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	block, _ = pem.Decode(other)
+	if err := pinnedTLS(fp).VerifyPeerCertificate([][]byte{block.Bytes}, nil); err == nil {
+		t.Errorf("expected an error for another certificate")
+	}
+}
+
+func TestNormalizeFingerprint(t *testing.T) {
+	if got := normalizeFingerprint(" AB:CD:01 "); got != "abcd01" {
+		t.Errorf("expected: %s, got: %s", "abcd01", got)
+	}
+}
@@ -2,19 +2,36 @@ package daemon
 
 import (
 	"context"
+	"crypto/rand"
 	"crypto/sha1"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
 	"os"
 	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/client"
 	"github.com/docker/go-connections/nat"
+	units "github.com/docker/go-units"
 	homedir "github.com/mitchellh/go-homedir"
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 	grpc "google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
 
 	api "github.com/src-d/engine/api"
 	"github.com/src-d/engine/components"
@@ -22,122 +39,2033 @@ import (
 )
 
 const (
-	daemonImage  = "srcd/cli-daemon"
-	daemonName   = "srcd-cli-daemon"
-	daemonPort   = "4242"
+	// daemonPort is the port of the container the daemon is served on,
+	// published on the port of the host configured. See Port.
+	daemonPort = "4242"
+	// metricsPort is the port of the container the metrics of the daemon
+	// are served on, published on the address configured.
+	metricsPort  = "9090"
 	dockerSocket = "/var/run/docker.sock"
 	workdirKey   = "WORKDIR"
+
+	// socketName is the name of the unix socket the daemon is served on, in
+	// the run directory of the data directory, mounted in its container at
+	// containerRunDir.
+	socketName      = "daemon.sock"
+	containerRunDir = "/run/srcd"
+	// socketWait is how long the CLI waits for the socket of a daemon just
+	// started to be created.
+	socketWait = 10 * time.Second
+)
+
+// UsesSocket reports whether the daemons created are served on a unix socket
+// instead of a TCP port. It's only used on Windows, and in WSL with Docker
+// Desktop, where docker can't share unix sockets with the host, published on
+// localhost, and with remote docker hosts, published on all their interfaces.
+func UsesSocket() bool {
+	return runtime.GOOS != "windows" && remoteDockerHost() == "" && DetectTopology() != TopologyWSLDesktop
+}
+
+// remoteDockerHost returns the host of DOCKER_HOST if docker is reached over
+// TCP, or an empty string otherwise.
+func remoteDockerHost() string {
+	host := os.Getenv("DOCKER_HOST")
+	if host == "" {
+		return ""
+	}
+
+	proto, addr, _, err := client.ParseHost(host)
+	if err != nil || proto != "tcp" {
+		return ""
+	}
+
+	if h, _, err := net.SplitHostPort(addr); err == nil {
+		return h
+	}
+	return addr
+}
+
+// RemoteDockerHost returns the host docker runs on if it's another machine,
+// reached over TCP, or an empty string if it's this one.
+func RemoteDockerHost() string {
+	host := remoteDockerHost()
+	if host == "localhost" {
+		return ""
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return ""
+	}
+	return host
+}
+
+// Labels of the daemon container recording how it was started.
+const (
+	labelWorkdir          = "srcd.workdir"
+	labelRepos            = "srcd.repos"
+	labelWorkdirVolume    = "srcd.workdir.volume"
+	labelFormat           = "srcd.repos.format"
+	labelGitbaseSquash    = "srcd.gitbase.squash"
+	labelGitbaseCacheSize = "srcd.gitbase.cache-size"
+	labelGitbaseMaxMemory = "srcd.gitbase.max-memory"
+	labelGitbaseTimeout   = "srcd.gitbase.conn-timeout"
+	labelGitbaseQueryTime = "srcd.gitbase.query-timeout"
+	labelGitbaseMaxConns  = "srcd.gitbase.max-connections"
+	labelGitbaseParallel  = "srcd.gitbase.parallelism"
+	labelGitbaseWritable  = "srcd.gitbase.writable-workdir"
+	labelGitbaseUser      = "srcd.gitbase.user"
+	labelGitbaseAuth      = "srcd.gitbase.auth"
+	labelGitbaseMetrics   = "srcd.gitbase.metrics"
+	labelGitbaseLogLevel  = "srcd.gitbase.log-level"
+	labelSkipNested       = "srcd.repos.skip-nested"
+	labelIncludeBare      = "srcd.repos.include-bare"
+	labelHidden           = "srcd.repos.hidden"
+	labelExcluded         = "srcd.repos.excluded"
+	labelComponents       = "srcd.components"
+	labelImages           = "srcd.images"
+	labelDataDir          = "srcd.data-dir"
+	labelBblfshMemory     = "srcd.bblfsh.memory"
+	labelBblfshMaxDrivers = "srcd.bblfsh.max-drivers"
+	labelPilosaPort       = "srcd.pilosa.port"
+	labelPilosaExpose     = "srcd.pilosa.expose"
+	labelPilosaMemory     = "srcd.pilosa.memory"
+	labelPilosaCacheSize  = "srcd.pilosa.cache-size"
+	labelSocket           = "srcd.socket"
+	labelPort             = "srcd.port"
+	labelTLS              = "srcd.tls"
+	labelMetrics          = "srcd.metrics"
+	labelLogFormat        = "srcd.log-format"
+	labelHealthInterval   = "srcd.health.interval"
+	labelHealthTimeout    = "srcd.health.timeout"
+	labelDrainTimeout     = "srcd.drain.timeout"
+)
+
+// Options configure the components started by the daemon.
+type Options struct {
+	// BblfshMemory is the memory limit of bblfshd in the format used by
+	// docker, like 512m or 2g. Empty means no limit.
+	BblfshMemory string
+	// BblfshMaxDrivers is the maximum number of instances of every driver
+	// run by bblfshd. 0 means the bblfshd default.
+	BblfshMaxDrivers int
+}
+
+func (o Options) labels() map[string]string {
+	return map[string]string{
+		labelBblfshMemory:     o.BblfshMemory,
+		labelBblfshMaxDrivers: strconv.Itoa(o.BblfshMaxDrivers),
+	}
+}
+
+// PilosaOptions configure where pilosa is served. Zero values are the
+// defaults, also used by the daemons started before they could be chosen.
+type PilosaOptions struct {
+	// Port is the one pilosa is served on, in its container and in the host
+	// if it's exposed, components.PilosaDefaultPort if it's 0.
+	Port int
+	// Expose is the address of the host pilosa is published on, like
+	// 127.0.0.1, empty if it's only reached by gitbase.
+	Expose string
+	// Memory is the memory limit of pilosa in the format used by docker,
+	// like 2g. Empty or 0 means no limit.
+	Memory string
+	// CacheSize is the size of the caches of pilosa, like 512m. Empty means
+	// the pilosa default.
+	CacheSize string
+}
+
+// EffectivePort returns the port pilosa is served on.
+func (o PilosaOptions) EffectivePort() int {
+	if o.Port == 0 {
+		return components.PilosaDefaultPort
+	}
+	return o.Port
+}
+
+func (o PilosaOptions) labels() map[string]string {
+	return map[string]string{
+		labelPilosaPort:      strconv.Itoa(o.EffectivePort()),
+		labelPilosaExpose:    o.Expose,
+		labelPilosaMemory:    o.Memory,
+		labelPilosaCacheSize: o.CacheSize,
+	}
+}
+
+func (o PilosaOptions) args() []string {
+	args := []string{fmt.Sprintf("--pilosa-port=%d", o.EffectivePort())}
+	if o.Expose != "" {
+		args = append(args, fmt.Sprintf("--expose-pilosa=%s", o.Expose))
+	}
+	if o.Memory != "" {
+		args = append(args, fmt.Sprintf("--pilosa-memory=%s", o.Memory))
+	}
+	if o.CacheSize != "" {
+		args = append(args, fmt.Sprintf("--pilosa-cache-size=%s", o.CacheSize))
+	}
+	return args
+}
+
+// GitbaseOptions configure gitbase. Empty or zero values are the defaults of
+// gitbase, which are also used by the daemons started before they could be
+// chosen.
+type GitbaseOptions struct {
+	// Squash enables the squashed tables of gitbase.
+	Squash bool
+	// CacheSize is the size of the cache of git objects in the format used
+	// by docker, like 512m or 4g.
+	CacheSize string
+	// MaxMemory is the memory the joins can use, like 2g.
+	MaxMemory string
+	// ConnTimeout is how long the connections can be idle.
+	ConnTimeout time.Duration
+	// QueryTimeout is how long every query can run before gitbase cancels
+	// it.
+	QueryTimeout time.Duration
+	// MaxConnections is the maximum number of connections open at once.
+	MaxConnections int
+	// Parallelism is the number of repositories gitbase reads at once.
+	Parallelism int
+	// WritableWorkdir mounts the working directory writable instead of
+	// read-only, as gitbase only reads it.
+	WritableWorkdir bool
+	// User and Password are the credentials of the clients of gitbase. The
+	// password is kept in the data directory, never in the labels. Without
+	// them, gitbase accepts the user root with no password.
+	User     string
+	Password string
+	// Metrics enables the metrics endpoint of gitbase, published on the
+	// loopback of the host.
+	Metrics bool
+	// LogLevel is the level of the logs of gitbase, like debug.
+	LogLevel string
+}
+
+func (o GitbaseOptions) labels() map[string]string {
+	return map[string]string{
+		labelGitbaseSquash:    strconv.FormatBool(o.Squash),
+		labelGitbaseCacheSize: o.CacheSize,
+		labelGitbaseMaxMemory: o.MaxMemory,
+		labelGitbaseTimeout:   o.ConnTimeout.String(),
+		labelGitbaseQueryTime: o.QueryTimeout.String(),
+		labelGitbaseMaxConns:  strconv.Itoa(o.MaxConnections),
+		labelGitbaseParallel:  strconv.Itoa(o.Parallelism),
+		labelGitbaseWritable:  strconv.FormatBool(o.WritableWorkdir),
+		labelGitbaseUser:      o.User,
+		labelGitbaseAuth:      strconv.FormatBool(o.Password != ""),
+		labelGitbaseMetrics:   strconv.FormatBool(o.Metrics),
+		labelGitbaseLogLevel:  o.LogLevel,
+	}
+}
+
+// args returns the flags of the daemon with the options.
+func (o GitbaseOptions) args() []string {
+	var args []string
+	if o.Squash {
+		args = append(args, "--gitbase-squash")
+	}
+	if o.CacheSize != "" {
+		args = append(args, fmt.Sprintf("--gitbase-cache-size=%s", o.CacheSize))
+	}
+	if o.MaxMemory != "" {
+		args = append(args, fmt.Sprintf("--gitbase-max-memory=%s", o.MaxMemory))
+	}
+	if o.ConnTimeout > 0 {
+		args = append(args, fmt.Sprintf("--gitbase-conn-timeout=%s", o.ConnTimeout))
+	}
+	if o.QueryTimeout > 0 {
+		args = append(args, fmt.Sprintf("--gitbase-query-timeout=%s", o.QueryTimeout))
+	}
+	if o.MaxConnections > 0 {
+		args = append(args, fmt.Sprintf("--gitbase-max-connections=%d", o.MaxConnections))
+	}
+	if o.Parallelism > 0 {
+		args = append(args, fmt.Sprintf("--gitbase-parallelism=%d", o.Parallelism))
+	}
+	if o.WritableWorkdir {
+		args = append(args, "--writable-workdir")
+	}
+	// The password is given in the environment.
+	if o.User != "" {
+		args = append(args, fmt.Sprintf("--gitbase-user=%s", o.User))
+	}
+	if o.Metrics {
+		args = append(args, "--gitbase-metrics")
+	}
+	if o.LogLevel != "" {
+		args = append(args, fmt.Sprintf("--gitbase-log-level=%s", o.LogLevel))
+	}
+	return args
+}
+
+// Settings returns the settings of gitbase with the options.
+func (o GitbaseOptions) Settings() (components.GitbaseSettings, error) {
+	s := components.GitbaseSettings{
+		Squash:         o.Squash,
+		ConnTimeout:    o.ConnTimeout,
+		QueryTimeout:   o.QueryTimeout,
+		MaxConnections: o.MaxConnections,
+		Parallelism:    o.Parallelism,
+		Metrics:        o.Metrics,
+		LogLevel:       o.LogLevel,
+	}
+	var err error
+	if o.CacheSize != "" {
+		if s.CacheSize, err = units.RAMInBytes(o.CacheSize); err != nil {
+			return s, errors.Wrap(err, "invalid gitbase cache size")
+		}
+	}
+	if o.MaxMemory != "" {
+		if s.MaxMemory, err = units.RAMInBytes(o.MaxMemory); err != nil {
+			return s, errors.Wrap(err, "invalid gitbase max memory")
+		}
+	}
+	return s, nil
+}
+
+// Config is the configuration the daemon is started with.
+type Config struct {
+	Workdir string
+	// Repos are more directories with repositories mounted in gitbase along
+	// with the working directory.
+	Repos []string
+	// WorkdirVolume is the docker volume the working directory is synced
+	// into, mounted in gitbase instead of the directory, for docker hosts
+	// other than this machine. Empty to mount the directory.
+	WorkdirVolume string
+	// Format of the repositories read by gitbase, git or siva. Empty for
+	// daemons started before it could be chosen, which use git.
+	Format string
+	// Gitbase are the options of gitbase.
+	Gitbase GitbaseOptions
+	// Pilosa are the options of pilosa.
+	Pilosa PilosaOptions
+	// Components are the names of the components that can be started. Empty
+	// means all of them.
+	Components []string
+	// DataDir is where the data of the components is kept, the default if
+	// it's empty. See ResolveDataDir.
+	DataDir string
+	// RepoPolicy is how the nested and bare repositories found are treated.
+	RepoPolicy RepoPolicy
+	// Hidden are the paths of the host hidden from gitbase to apply the
+	// policy: the .git directories of nested repositories and the bare
+	// repositories.
+	Hidden []string
+	// Excluded are the patterns of the repositories excluded from gitbase,
+	// given with srcd init --exclude-repo. The repositories they match are
+	// in Hidden.
+	Excluded []string
+	// Images are the references of the images replacing the default ones of
+	// the components, by name, like srcd/gitbase:dev for srcd-cli-gitbase.
+	Images  map[string]string
+	Options Options
+	// Socket is the path of the host of the unix socket the daemon is
+	// served on, empty if it's served on a TCP port. It's only known for
+	// the running daemon.
+	Socket string
+	// TLS is whether the daemon served on a TCP port uses TLS. See Auth.
+	TLS bool
+	// Port is the port of the host the daemon served on a TCP port is
+	// published on. For the running daemon, it's the one it was published
+	// on, otherwise the one configured, 0 to choose it. See Port.
+	Port int
+	// MetricsAddress is the address of the host the metrics of the daemon
+	// are published on, like 127.0.0.1:9090, empty if they are disabled.
+	MetricsAddress string
+	// LogFormat is the format of the logs of the daemon, text or json.
+	// Empty for daemons started before it could be chosen, which use text.
+	LogFormat string
+	// Probes configure how often the daemon probes the components for its
+	// health checks.
+	Probes ProbeOptions
+	// DrainTimeout is how long the daemon gives the calls in flight to
+	// finish when it's stopped, DefaultDrainTimeout if it's 0.
+	DrainTimeout time.Duration
+}
+
+// DefaultDrainTimeout is how long the daemon gives the calls in flight to
+// finish when it's stopped by default.
+const DefaultDrainTimeout = 20 * time.Second
+
+// drainMargin is how much longer than its drain window docker gives the
+// daemon to exit before killing it.
+const drainMargin = 10 * time.Second
+
+// ProbeOptions configure how often the daemon probes the components for its
+// health checks, and how long every probe can take. Zero means the default.
+type ProbeOptions struct {
+	Interval time.Duration
+	Timeout  time.Duration
+}
+
+// Defaults of the daemon for ProbeOptions.
+const (
+	defaultProbeInterval = 15 * time.Second
+	defaultProbeTimeout  = 5 * time.Second
+)
+
+// withDefaults returns the options with the defaults of the daemon for the
+// ones not given.
+func (o ProbeOptions) withDefaults() ProbeOptions {
+	if o.Interval == 0 {
+		o.Interval = defaultProbeInterval
+	}
+	if o.Timeout == 0 {
+		o.Timeout = defaultProbeTimeout
+	}
+	return o
+}
+
+// RepoPolicy is how gitbase treats the nested and bare repositories found in
+// the working directory. By default nested repositories are indexed on their
+// own and bare ones are hidden.
+type RepoPolicy struct {
+	SkipNested  bool
+	IncludeBare bool
+}
+
+func (p RepoPolicy) String() string {
+	nested, bare := "indexed", "hidden"
+	if p.SkipNested {
+		nested = "hidden"
+	}
+	if p.IncludeBare {
+		bare = "indexed"
+	}
+	return fmt.Sprintf("nested repositories %s, bare repositories %s", nested, bare)
+}
+
+// DataDir is the data directory used when the daemon is started on demand by
+// any command, set from the configuration or, if it's not there, the one
+// recorded by the last srcd init. The default if it's empty.
+var DataDir string
+
+// DefaultPort is the port of the host the daemons served on a TCP port are
+// published on when none is configured and it's free.
+const DefaultPort = 4242
+
+// Port is the port of the host the daemons served on a TCP port are created
+// with, set from the configuration. 0 means DefaultPort or, if it's taken, a
+// free one.
+var Port int
+
+// MetricsAddress is the address of the host the metrics of the daemons
+// created are published on, set from the configuration. See
+// ParseMetricsAddress.
+var MetricsAddress string
+
+// ParseMetricsAddress returns the address the metrics are published on given
+// one like 127.0.0.1:9090, :9090 or 9090. Without a host, only localhost can
+// reach them, all the interfaces must be given explicitly with 0.0.0.0.
+// Empty means the metrics are disabled.
+func ParseMetricsAddress(addr string) (string, error) {
+	if addr == "" {
+		return "", nil
+	}
+
+	if !strings.Contains(addr, ":") {
+		addr = ":" + addr
+	}
+
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", err
+	}
+
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return "", fmt.Errorf("invalid port %q, it must be between 1 and 65535", port)
+	}
+
+	if host == "" {
+		host = "127.0.0.1"
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+// LogLevel is the level of the logs of the daemon when it's created, like
+// debug, set from the configuration or the verbosity of the CLI. The default
+// if it's empty. It can be changed later with the SetLogLevel call.
+var LogLevel string
+
+// LogFormat is the format of the logs of the daemons created, text or json,
+// set from the configuration. Text if it's empty.
+var LogFormat string
+
+// Environment variables the daemon reads the level and format of its logs
+// from.
+const (
+	envLogLevel  = "SRCD_LOG_LEVEL"
+	envLogFormat = "SRCD_LOG_FORMAT"
+)
+
+// envRequireNative makes the daemon fail to pull and run the images without
+// a variant for the platform of docker, see docker.RequireNative.
+const envRequireNative = "SRCD_REQUIRE_NATIVE"
+
+// envPlatform are the platforms forced for the images of the components the
+// daemon creates, see components.PlatformsSpec.
+const envPlatform = "SRCD_PLATFORM"
+
+// Environment variables the daemon reads the proxy and the certificates of
+// the CAs of its HTTP clients from, see docker.ConfigureHTTP.
+const (
+	envHTTPProxy = "SRCD_HTTP_PROXY"
+	envCACerts   = "SRCD_CA_CERTS"
+)
+
+// Environment variables the daemon reads the registry mirror and its
+// credentials from, see docker.ConfigureMirror.
+const (
+	envRegistryMirror = "SRCD_REGISTRY_MIRROR"
+	envRegistryAuth   = "SRCD_REGISTRY_AUTH"
 )
 
-func DockerVersion() (string, error) { return docker.Version() }
-func IsRunning() (bool, error)       { return docker.IsRunning(daemonName) }
+// Probes configure the health checks of the daemons created, set from the
+// configuration.
+var Probes ProbeOptions
+
+// DrainTimeout is the drain window of the daemons created, set from the
+// configuration. See Config.DrainTimeout.
+var DrainTimeout time.Duration
+
+// ResolveDataDir returns the absolute path of the given data directory, or
+// the default one, ~/.srcd, if it's empty.
+func ResolveDataDir(dir string) (string, error) {
+	if dir == "" {
+		return dataDirectory()
+	}
+
+	dir, err := homedir.Expand(dir)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Abs(dir)
+}
+
+// dataDirRecord is the file of the default data directory where srcd init
+// records the one it was given, if it's another one, so the daemons created
+// on demand or recreated later keep using it.
+const dataDirRecord = "data-dir"
+
+// RecordedDataDir returns the data directory recorded by the last srcd init,
+// or an empty string if it used the default one.
+func RecordedDataDir() string {
+	def, err := dataDirectory()
+	if err != nil {
+		return ""
+	}
+	return recordedDataDir(def)
+}
+
+func recordedDataDir(def string) string {
+	b, err := ioutil.ReadFile(filepath.Join(def, dataDirRecord))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
+
+// RecordDataDir records the data directory srcd init was given, which must
+// be absolute. The record is removed if it's the default one.
+func RecordDataDir(datadir string) error {
+	def, err := dataDirectory()
+	if err != nil {
+		return err
+	}
+	return recordDataDir(def, datadir)
+}
+
+func recordDataDir(def, datadir string) error {
+	path := filepath.Join(def, dataDirRecord)
+	if datadir == def {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return errors.Wrap(err, "unable to remove the record of the data directory")
+		}
+		return nil
+	}
+
+	if err := os.MkdirAll(def, 0755); err != nil {
+		return errors.Wrap(err, "unable to record the data directory")
+	}
+	return errors.Wrap(ioutil.WriteFile(path, []byte(datadir+"\n"), 0644),
+		"unable to record the data directory")
+}
+
+// volumesDir returns where the docker volumes are kept, or an empty string
+// for the default location of docker, which is used along with the default
+// data directory.
+func volumesDir(datadir string) (string, error) {
+	def, err := dataDirectory()
+	if err != nil {
+		return "", err
+	}
+
+	if datadir == def {
+		return "", nil
+	}
+	return filepath.Join(datadir, "volumes"), nil
+}
+
+// CheckVolumes fails if the existing volumes are not kept where the data
+// directory of the configuration requires, as they would keep being used
+// from the old location.
+func (c *Config) CheckVolumes() error {
+	datadir, err := ResolveDataDir(c.DataDir)
+	if err != nil {
+		return err
+	}
+
+	dir, err := volumesDir(datadir)
+	if err != nil {
+		return err
+	}
+
+	for _, v := range components.Bblfshd.Volumes {
+		var want string
+		if dir != "" {
+			want = filepath.Join(dir, v.Name)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		got, err := docker.VolumeDevice(ctx, v.Name)
+		cancel()
+		if err == docker.ErrNotFound {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		if got != want {
+			return fmt.Errorf("volume %s is kept in %s, not in the data directory %s; "+
+				"use the previous data directory or remove the volume with "+
+				"srcd kill --component bblfshd --all",
+				v.Name, valueOr(got, "the default location of docker"), datadir)
+		}
+	}
+
+	return nil
+}
+
+func valueOr(value, def string) string {
+	if value == "" {
+		return def
+	}
+	return value
+}
+
+// SameDirectories reports whether both configurations have the same working
+// directory, mounted or synced into the same volume, and repositories,
+// including their format, the repository policy, the patterns of the
+// repositories excluded and the paths hidden from gitbase.
+func (c *Config) SameDirectories(other *Config) bool {
+	return c.Workdir == other.Workdir &&
+		c.WorkdirVolume == other.WorkdirVolume &&
+		equalStrings(c.Repos, other.Repos) &&
+		c.format() == other.format() &&
+		c.RepoPolicy == other.RepoPolicy &&
+		equalStrings(c.Excluded, other.Excluded) &&
+		equalStrings(c.Hidden, other.Hidden)
+}
+
+// SameComponents reports whether both configurations enable the same
+// components.
+func (c *Config) SameComponents(other *Config) bool {
+	return equalStrings(c.Components, other.Components)
+}
+
+// ChangedImages returns the names of the components whose images are
+// overridden differently in both configurations, sorted.
+func (c *Config) ChangedImages(other *Config) []string {
+	var names []string
+	for name, ref := range c.Images {
+		if other.Images[name] != ref {
+			names = append(names, name)
+		}
+	}
+
+	for name := range other.Images {
+		if _, ok := c.Images[name]; !ok {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+func (c *Config) logFormat() string {
+	if c.LogFormat == "" {
+		return "text"
+	}
+	return c.LogFormat
+}
+
+// SameLogFormat reports whether both configurations log in the same format.
+func (c *Config) SameLogFormat(other *Config) bool {
+	return c.logFormat() == other.logFormat()
+}
+
+// SamePort reports whether the daemon is published on the port of the other
+// configuration. Any port is when it has none, as a free one is chosen if
+// the default one is taken.
+func (c *Config) SamePort(other *Config) bool {
+	return other.Port == 0 || c.Port == other.Port
+}
+
+// SamePilosa reports whether pilosa is served the same way, with the same
+// memory, with both configurations.
+func (c *Config) SamePilosa(other *Config) bool {
+	return c.Pilosa.EffectivePort() == other.Pilosa.EffectivePort() && c.Pilosa.Expose == other.Pilosa.Expose &&
+		c.Pilosa.Memory == other.Pilosa.Memory && c.Pilosa.CacheSize == other.Pilosa.CacheSize
+}
+
+// SameProbes reports whether both configurations probe the components the
+// same way.
+func (c *Config) SameProbes(other *Config) bool {
+	return c.Probes.withDefaults() == other.Probes.withDefaults()
+}
+
+func (c *Config) drainTimeout() time.Duration {
+	if c.DrainTimeout <= 0 {
+		return DefaultDrainTimeout
+	}
+	return c.DrainTimeout
+}
+
+// SameDrainTimeout reports whether both configurations drain the calls for
+// the same time.
+func (c *Config) SameDrainTimeout(other *Config) bool {
+	return c.drainTimeout() == other.drainTimeout()
+}
+
+// GracePeriod returns how long the daemon is given to shut down when it's
+// stopped: longer than its drain window, so it's not killed draining.
+func (c *Config) GracePeriod() time.Duration {
+	return c.drainTimeout() + drainMargin
+}
+
+// GracePeriod returns how long the daemon running is given to shut down, the
+// default of the component if it's not running.
+func GracePeriod() time.Duration {
+	cfg, err := Running()
+	if err != nil || cfg == nil {
+		return components.Daemon.GracePeriod()
+	}
+	return cfg.GracePeriod()
+}
+
+func (c *Config) format() string {
+	if c.Format == "" {
+		return "git"
+	}
+	return c.Format
+}
+
+func sortedKeys(m map[string]string) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Enabled reports whether the component with the given name can be started.
+func (c *Config) Enabled(name string) bool {
+	if len(c.Components) == 0 {
+		return true
+	}
+
+	for _, cmp := range c.Components {
+		if cmp == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Running returns the configuration of the running daemon, or nil if it's not
+// running. Daemons started by older versions have an empty configuration.
+func Running() (*Config, error) {
+	info, err := docker.Info(components.Daemon.Name)
+	if err == docker.ErrNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var repos []string
+	if v := info.Labels[labelRepos]; v != "" {
+		if err := json.Unmarshal([]byte(v), &repos); err != nil {
+			return nil, errors.Wrap(err, "invalid repositories label in the daemon")
+		}
+	}
+
+	var cmps []string
+	if v := info.Labels[labelComponents]; v != "" {
+		if err := json.Unmarshal([]byte(v), &cmps); err != nil {
+			return nil, errors.Wrap(err, "invalid components label in the daemon")
+		}
+	}
+
+	var images map[string]string
+	if v := info.Labels[labelImages]; v != "" {
+		if err := json.Unmarshal([]byte(v), &images); err != nil {
+			return nil, errors.Wrap(err, "invalid images label in the daemon")
+		}
+	}
+
+	var hidden []string
+	if v := info.Labels[labelHidden]; v != "" {
+		if err := json.Unmarshal([]byte(v), &hidden); err != nil {
+			return nil, errors.Wrap(err, "invalid hidden repositories label in the daemon")
+		}
+	}
+
+	var excluded []string
+	if v := info.Labels[labelExcluded]; v != "" {
+		if err := json.Unmarshal([]byte(v), &excluded); err != nil {
+			return nil, errors.Wrap(err, "invalid excluded repositories label in the daemon")
+		}
+	}
+
+	skipNested, _ := strconv.ParseBool(info.Labels[labelSkipNested])
+	includeBare, _ := strconv.ParseBool(info.Labels[labelIncludeBare])
+	squash, _ := strconv.ParseBool(info.Labels[labelGitbaseSquash])
+	connTimeout, _ := time.ParseDuration(info.Labels[labelGitbaseTimeout])
+	queryTimeout, _ := time.ParseDuration(info.Labels[labelGitbaseQueryTime])
+	maxConns, _ := strconv.Atoi(info.Labels[labelGitbaseMaxConns])
+	parallelism, _ := strconv.Atoi(info.Labels[labelGitbaseParallel])
+	metrics, _ := strconv.ParseBool(info.Labels[labelGitbaseMetrics])
+	// The working directory was writable in gitbase before it could be
+	// chosen, so recreating them mounts it read-only.
+	writable := info.Labels[labelGitbaseWritable] != "false"
+	var password string
+	if info.Labels[labelGitbaseAuth] == "true" {
+		password, err = StoredGitbasePassword(info.Labels[labelDataDir])
+		if err != nil {
+			return nil, err
+		}
+	}
+	maxDrivers, _ := strconv.Atoi(info.Labels[labelBblfshMaxDrivers])
+	pilosaPort, _ := strconv.Atoi(info.Labels[labelPilosaPort])
+	withTLS, _ := strconv.ParseBool(info.Labels[labelTLS])
+	// Daemons started before the probes could be configured don't have
+	// them in their labels, they use the defaults.
+	interval, _ := time.ParseDuration(info.Labels[labelHealthInterval])
+	timeout, _ := time.ParseDuration(info.Labels[labelHealthTimeout])
+	// The ones started before the drain window could be configured use the
+	// default one.
+	drain, _ := time.ParseDuration(info.Labels[labelDrainTimeout])
+	var port int
+	if info.Labels[labelSocket] == "" {
+		port = labelPortOf(info.Labels)
+	}
+	return &Config{
+		Workdir:       info.Labels[labelWorkdir],
+		WorkdirVolume: info.Labels[labelWorkdirVolume],
+		Repos:         repos,
+		Format:        info.Labels[labelFormat],
+		Gitbase: GitbaseOptions{
+			Squash:          squash,
+			CacheSize:       info.Labels[labelGitbaseCacheSize],
+			MaxMemory:       info.Labels[labelGitbaseMaxMemory],
+			ConnTimeout:     connTimeout,
+			QueryTimeout:    queryTimeout,
+			MaxConnections:  maxConns,
+			Parallelism:     parallelism,
+			WritableWorkdir: writable,
+			User:            info.Labels[labelGitbaseUser],
+			Password:        password,
+			Metrics:         metrics,
+			LogLevel:        info.Labels[labelGitbaseLogLevel],
+		},
+		Pilosa: PilosaOptions{
+			Port:      pilosaPort,
+			Expose:    info.Labels[labelPilosaExpose],
+			Memory:    info.Labels[labelPilosaMemory],
+			CacheSize: info.Labels[labelPilosaCacheSize],
+		},
+		Components: cmps,
+		DataDir:    info.Labels[labelDataDir],
+		RepoPolicy: RepoPolicy{
+			SkipNested:  skipNested,
+			IncludeBare: includeBare,
+		},
+		Hidden:   hidden,
+		Excluded: excluded,
+		Images:   images,
+		Options: Options{
+			BblfshMemory:     info.Labels[labelBblfshMemory],
+			BblfshMaxDrivers: maxDrivers,
+		},
+		Socket:         info.Labels[labelSocket],
+		TLS:            withTLS,
+		Port:           port,
+		MetricsAddress: info.Labels[labelMetrics],
+		LogFormat:      info.Labels[labelLogFormat],
+		Probes:         ProbeOptions{Interval: interval, Timeout: timeout},
+		DrainTimeout:   drain,
+	}, nil
+}
+
+func DockerVersion() (string, error) { return docker.Version() }
+func IsRunning() (bool, error)       { return docker.IsRunning(components.Daemon.Name) }
+
+// Kill removes the daemon and the components that depend on the working
+// directory, so they are recreated with the new one.
+func Kill() error {
+	for _, cmp := range components.All {
+		if !components.IsWorkingDirDependant(cmp.Name) {
+			continue
+		}
+
+		if err := docker.Kill(cmp.Name); err != nil && err != docker.ErrNotFound {
+			return err
+		}
+	}
+
+	return docker.Kill(components.Daemon.Name)
+}
+
+// KillAll removes the daemon, all the components, even if they are stopped,
+// and the network connecting them, so everything is started fresh. The
+// volumes and images are kept.
+func KillAll() error {
+	if err := components.RemoveContainers(); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return docker.RemoveNetwork(ctx)
+}
+
+// ResetData removes the data kept by the components between runs: the volume
+// with the drivers installed in bblfshd and the indexes of gitbase and pilosa
+// for the working directory of the configuration, along with the pilosa
+// volume. The containers must be removed first.
+func ResetData(cfg *Config) error {
+	datadir, err := ResolveDataDir(cfg.DataDir)
+	if err != nil {
+		return err
+	}
+
+	dirs := workdirDataDirectories(cfg.Workdir, datadir)
+	if vols, err := volumesDir(datadir); err != nil {
+		return err
+	} else if vols != "" {
+		dirs = append(dirs, filepath.Join(vols, components.BblfshVolume))
+	}
+
+	for _, dir := range dirs {
+		if err := os.RemoveAll(dir); err != nil {
+			return errors.Wrap(err, "unable to remove data directory")
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err = docker.RemoveVolume(ctx, components.BblfshVolume)
+	if err != nil && !client.IsErrNotFound(err) {
+		return errors.Wrap(err, "unable to remove bblfsh volume")
+	}
+
+	err = docker.RemoveVolume(ctx, components.PilosaVolume)
+	if err != nil && !client.IsErrNotFound(err) {
+		return errors.Wrap(err, "unable to remove pilosa volume")
+	}
+	return nil
+}
+
+// KillComponents removes the daemon and the components with the given names,
+// keeping the rest running. It's used when only the images of some
+// components change.
+func KillComponents(names []string) error {
+	for _, name := range names {
+		if err := docker.Kill(name); err != nil && err != docker.ErrNotFound {
+			return err
+		}
+	}
+
+	return docker.Kill(components.Daemon.Name)
+}
+
+// KillBblfshd removes the daemon and bblfshd, keeping the rest of components
+// running. It's used when only the options of bblfshd change.
+func KillBblfshd() error {
+	if err := docker.Kill(components.Bblfshd.Name); err != nil && err != docker.ErrNotFound {
+		return err
+	}
+
+	return docker.Kill(components.Daemon.Name)
+}
+
+// Client will return a new EngineClient to interact with the daemon. If the
+// daemon is not started already, it will start it at the working directory
+// with the default options.
+func Client() (api.EngineClient, error) {
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+
+	if wd, err = TranslatePath(wd); err != nil {
+		return nil, err
+	}
+
+	// The same canonical path init uses, so it's not seen as a different
+	// working directory later.
+	if resolved, err := filepath.EvalSymlinks(wd); err == nil {
+		wd = resolved
+	}
+
+	info, err := start(&Config{
+		Workdir:        wd,
+		DataDir:        DataDir,
+		Images:         components.Overrides(),
+		TLS:            Auth.TLS && !UsesSocket(),
+		Port:           ConfiguredPort(),
+		MetricsAddress: MetricsAddress,
+		LogFormat:      LogFormat,
+		Probes:         Probes,
+		DrainTimeout:   DrainTimeout,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	conn, res, err := connect(info)
+	if err != nil {
+		return nil, checkCrashed(err)
+	}
+
+	if compatible(res) {
+		return api.NewEngineClient(conn), nil
+	}
+
+	if NoRefresh {
+		logrus.Warnf("the daemon %s speaks the protocol %d, not %d like the CLI, "+
+			"its calls could fail; recreate it with srcd init --force", res.Version, res.Protocol, api.ProtocolVersion)
+		return api.NewEngineClient(conn), nil
+	}
+
+	conn.Close()
+	logrus.Infof("the daemon %s speaks the protocol %d, not %d like the CLI; recreating it with %s",
+		res.Version, res.Protocol, api.ProtocolVersion, components.Daemon.Ref())
+	if info, err = refresh(); err != nil {
+		return nil, err
+	}
+
+	conn, res, err = connect(info)
+	if err != nil {
+		return nil, checkCrashed(err)
+	}
+
+	if !compatible(res) {
+		conn.Close()
+		return nil, fmt.Errorf("the daemon recreated with %s speaks the protocol %d, not %d like the CLI; "+
+			"pull the image matching the CLI with docker pull %s, or install the CLI of version %s",
+			components.Daemon.Ref(), res.Protocol, api.ProtocolVersion, components.Daemon.Ref(), res.Version)
+	}
+	return api.NewEngineClient(conn), nil
+}
+
+// RunningClient returns a client of the running daemon, as Client, without
+// starting or recreating it, for the commands that only inspect it.
+func RunningClient() (api.EngineClient, error) {
+	info, err := docker.Info(components.Daemon.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, _, err := connect(info)
+	if err != nil {
+		return nil, err
+	}
+	return api.NewEngineClient(conn), nil
+}
+
+// HealthClient returns a client of the health checks of the running daemon,
+// without checking its version first, so they are cheap to call. It fails
+// with docker.ErrNotFound if there's no daemon.
+func HealthClient() (healthpb.HealthClient, error) {
+	info, err := docker.Info(components.Daemon.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := dial(info)
+	if err != nil {
+		return nil, err
+	}
+	return healthpb.NewHealthClient(conn), nil
+}
+
+// NoRefresh keeps the daemons incompatible with the CLI instead of recreating
+// them, set from --no-daemon-refresh to debug them.
+var NoRefresh bool
+
+// handshakeTimeout is how long the CLI waits for the daemon to answer the
+// version handshake, which includes the time it takes to start listening.
+const handshakeTimeout = 10 * time.Second
+
+func compatible(res *api.VersionResponse) bool {
+	return res.Protocol == api.ProtocolVersion
+}
+
+// connect connects to the daemon running in the container, and returns its
+// answer to the version handshake.
+func connect(info *docker.Container) (*grpc.ClientConn, *api.VersionResponse, error) {
+	conn, err := dial(info)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), handshakeTimeout)
+	defer cancel()
+
+	// The daemon just created may not be listening yet, so the call waits
+	// for it to be.
+	res, err := api.NewEngineClient(conn).Version(ctx, &api.VersionRequest{}, grpc.FailFast(false))
+	if err != nil {
+		conn.Close()
+		return nil, nil, errors.Wrap(err, "could not get the version of the daemon")
+	}
+	return conn, res, nil
+}
+
+// refresh recreates the running daemon, with the same configuration, from the
+// image of the version of the CLI, pulling it first, as the one installed
+// with the same tag may be outdated.
+func refresh() (*docker.Container, error) {
+	cfg, err := Running()
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg == nil {
+		return nil, fmt.Errorf("the daemon stopped before it could be recreated, run srcd init")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	image, tag := components.Daemon.ImageName(), components.Daemon.Tag()
+	if err := docker.Pull(ctx, image, tag); err != nil {
+		return nil, fmt.Errorf("the daemon is not compatible with the CLI and its image %s:%s "+
+			"could not be pulled: %v; check docker can reach the registry and run srcd init --force, "+
+			"or use --no-daemon-refresh to keep the old daemon", image, tag, err)
+	}
+
+	if err := docker.Kill(components.Daemon.Name); err != nil && err != docker.ErrNotFound {
+		return nil, err
+	}
+
+	// The daemons created before the data directory was recorded use the
+	// default one.
+	if cfg.DataDir == "" {
+		cfg.DataDir = DataDir
+	}
+	return start(cfg)
+}
+
+// dial connects to the daemon running in the container, over its socket or
+// TCP port, with its credentials.
+func dial(info *docker.Container) (*grpc.ClientConn, error) {
+	endpoint, err := address(info, socketWait)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []grpc.DialOption{
+		grpc.WithUnaryInterceptor(retryUnaryCall),
+		grpc.WithStreamInterceptor(logStreamCall),
+		grpc.WithBackoffMaxDelay(reconnectMaxDelay),
+	}
+	if endpoint.Network == "unix" {
+		opts = append(opts, grpc.WithInsecure(), grpc.WithDialer(func(path string, timeout time.Duration) (net.Conn, error) {
+			return net.DialTimeout("unix", path, timeout)
+		}))
+	} else {
+		auth, err := tcpCredentials(info, endpoint)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, auth...)
+	}
+
+	logrus.Debugf("connecting to the daemon at %s", endpoint)
+	return grpc.Dial(endpoint.Address, opts...)
+}
+
+// tcpCredentials returns the options to authenticate to the daemon served on
+// a TCP port: its token and, if it uses TLS, its certificate.
+func tcpCredentials(info *docker.Container, endpoint Endpoint) ([]grpc.DialOption, error) {
+	datadir := info.Labels[labelDataDir]
+	if datadir == "" {
+		var err error
+		if datadir, err = ResolveDataDir(DataDir); err != nil {
+			return nil, err
+		}
+	}
+
+	token, fp, err := clientCredentials(datadir, endpoint.TLS)
+	if err != nil {
+		return nil, err
+	}
+
+	var opts []grpc.DialOption
+	if token != "" {
+		opts = append(opts, grpc.WithPerRPCCredentials(tokenCredentials(token)))
+	}
+
+	if !endpoint.TLS {
+		if endpoint.Public {
+			logrus.Warnf("the daemon is served on %s without TLS, anyone who can reach it "+
+				"can use the engine; enable it with daemon.tls: true and srcd init", endpoint)
+		}
+		return append(opts, grpc.WithInsecure()), nil
+	}
+	return append(opts, grpc.WithTransportCredentials(credentials.NewTLS(pinnedTLS(fp)))), nil
+}
 
-func Kill() error {
-	cmps, err := components.List(context.Background(), components.IsWorkingDirDependant)
-	if err != nil {
-		return err
+// Endpoint is where the daemon is served: a unix socket or a TCP address.
+type Endpoint struct {
+	Network string
+	Address string
+	// TLS is whether the TCP address uses TLS.
+	TLS bool
+	// Public is whether the TCP address can be reached from other hosts.
+	Public bool
+}
+
+func (e Endpoint) String() string {
+	if e.Network == "unix" {
+		return "unix://" + e.Address
 	}
+	return e.Address
+}
 
-	for _, cmp := range cmps {
-		if err := docker.Kill(cmp); err != nil {
-			return err
+// address returns where the daemon running in the given container is served.
+// The unix socket is preferred when it exists, falling back to the TCP port
+// of localhost published by the daemons created on Windows or by older
+// versions. A daemon just created may not have created its socket yet, so it's
+// waited for up to wait.
+func address(info *docker.Container, wait time.Duration) (Endpoint, error) {
+	socket := info.Labels[labelSocket]
+	if socket != "" && socketExists(socket) {
+		return Endpoint{Network: "unix", Address: socket}, nil
+	}
+
+	withTLS, _ := strconv.ParseBool(info.Labels[labelTLS])
+	port := labelPortOf(info.Labels)
+	for _, p := range info.Ports {
+		// The metrics may be published too.
+		if int(p.PublicPort) != port || strconv.Itoa(int(p.PrivatePort)) != daemonPort {
+			continue
+		}
+
+		host := remoteDockerHost()
+		if host == "" {
+			host = "127.0.0.1"
 		}
+
+		ip := net.ParseIP(p.IP)
+		return Endpoint{
+			Network: "tcp",
+			Address: net.JoinHostPort(host, strconv.Itoa(int(p.PublicPort))),
+			TLS:     withTLS,
+			Public:  ip == nil || !ip.IsLoopback(),
+		}, nil
+	}
+
+	if socket == "" {
+		return Endpoint{}, fmt.Errorf("the daemon is not served on a socket or a port, recreate it with srcd init")
 	}
 
-	return docker.Kill(daemonName)
+	for deadline := time.Now().Add(wait); time.Now().Before(deadline); {
+		time.Sleep(100 * time.Millisecond)
+		if socketExists(socket) {
+			return Endpoint{Network: "unix", Address: socket}, nil
+		}
+	}
+	return Endpoint{}, fmt.Errorf("the daemon did not create its socket %s, check its logs with srcd logs daemon", socket)
 }
 
-// Client will return a new EngineClient to interact with the daemon. If the
-// daemon is not started already, it will start it at the working directory.
-func Client() (api.EngineClient, error) {
-	wd, err := os.Getwd()
-	if err != nil {
+// RunningEndpoint returns where the running daemon is served, or nil if it's
+// not running.
+func RunningEndpoint() (*Endpoint, error) {
+	info, err := docker.Info(components.Daemon.Name)
+	if err == docker.ErrNotFound {
+		return nil, nil
+	} else if err != nil {
 		return nil, err
 	}
 
-	info, err := start(wd)
+	e, err := address(info, 0)
 	if err != nil {
 		return nil, err
 	}
+	return &e, nil
+}
+
+// ConfiguredPort returns the port of the host the daemons created are
+// published on if they are served on a TCP port, 0 if they are not or it's
+// chosen when they are created.
+func ConfiguredPort() int {
+	if UsesSocket() {
+		return 0
+	}
+	return Port
+}
+
+// labelPortOf returns the port of the host the daemon is published on, from
+// its labels, or the default one for the daemons created before it could be
+// configured.
+func labelPortOf(labels map[string]string) int {
+	if port, err := strconv.Atoi(labels[labelPort]); err == nil && port > 0 {
+		return port
+	}
+	return DefaultPort
+}
+
+// PortReport is where a daemon served on a TCP port is looked for, and where
+// it's actually published.
+type PortReport struct {
+	// Host and Port are where the CLI connects to the daemon.
+	Host string
+	Port int
+	// Published are the ports of the host the port of the container of the
+	// daemon is published on.
+	Published []int
+}
+
+// RunningPort returns where the running daemon is looked for and published,
+// or nil if it's not running or it's served on a unix socket.
+func RunningPort() (*PortReport, error) {
+	info, err := docker.Info(components.Daemon.Name)
+	if err == docker.ErrNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if info.Labels[labelSocket] != "" {
+		return nil, nil
+	}
+
+	r := &PortReport{Host: remoteDockerHost(), Port: labelPortOf(info.Labels)}
+	if r.Host == "" {
+		r.Host = "127.0.0.1"
+	}
+
+	for _, p := range info.Ports {
+		if p.PublicPort != 0 && strconv.Itoa(int(p.PrivatePort)) == daemonPort {
+			r.Published = append(r.Published, int(p.PublicPort))
+		}
+	}
+	return r, nil
+}
+
+// hostPort returns the port of the host to publish a daemon created on. The
+// ports of remote docker hosts can't be checked, so they are used as they
+// are.
+func hostPort(configured int) (int, error) {
+	if remoteDockerHost() != "" {
+		if configured > 0 {
+			return configured, nil
+		}
+		return DefaultPort, nil
+	}
+
+	return choosePort(configured, localPortFree, freeLocalPort)
+}
+
+// choosePort returns the port configured, if it's free, or the default one
+// or, if it's taken, the one picked.
+func choosePort(configured int, free func(port int) bool, pick func() (int, error)) (int, error) {
+	if configured > 0 {
+		if !free(configured) {
+			return 0, fmt.Errorf("the port %d configured for the daemon is taken, "+
+				"choose another one with daemon.port in the config file or --daemon-port", configured)
+		}
+		return configured, nil
+	}
+
+	if free(DefaultPort) {
+		return DefaultPort, nil
+	}
+
+	port, err := pick()
+	if err != nil {
+		return 0, errors.Wrapf(err, "the port %d of the daemon is taken, and no free one was found", DefaultPort)
+	}
+
+	logrus.Warnf("the port %d of the daemon is taken, publishing it on %d instead", DefaultPort, port)
+	return port, nil
+}
+
+func localPortFree(port int) bool {
+	l, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		return false
+	}
+	l.Close()
+	return true
+}
+
+// freeLocalPort returns a port of localhost free now.
+func freeLocalPort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
+
+func socketExists(path string) bool {
+	fi, err := os.Stat(path)
+	return err == nil && fi.Mode()&os.ModeSocket != 0
+}
+
+// socketPath returns the path of the host of the socket of the daemon of the
+// environment using the given data directory. The ones of the environments
+// other than the default one are in a directory named after them.
+func socketPath(datadir string) string {
+	if env := docker.Environment(); env != docker.DefaultEnvironment {
+		return filepath.Join(datadir, "run", env, socketName)
+	}
+	return filepath.Join(datadir, "run", socketName)
+}
+
+// logUnaryCall logs the calls to the daemon at debug level, with how long
+// they took and their request ID, sent to the daemon to log it along with
+// them.
+func logUnaryCall(ctx context.Context, method string, req, reply interface{},
+	cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	ctx, id := withRequestID(ctx)
+	start := time.Now()
+	err := invoker(ctx, method, req, reply, cc, opts...)
+	logrus.Debugf("daemon: %s took %s, request %s, error: %v", method, time.Since(start), id, err)
+	if err != nil {
+		setFailedRequest(id)
+	}
+	return err
+}
 
-	addr := fmt.Sprintf("0.0.0.0:%d", info.Ports[0].PublicPort)
-	// TODO(campoy): add security
-	conn, err := grpc.Dial(addr, grpc.WithInsecure())
+// logStreamCall logs the streaming calls to the daemon at debug level when
+// they are opened, with their request ID.
+func logStreamCall(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn,
+	method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	ctx, id := withRequestID(ctx)
+	logrus.Debugf("daemon: open stream %s, request %s", method, id)
+	s, err := streamer(ctx, desc, cc, method, opts...)
 	if err != nil {
+		setFailedRequest(id)
 		return nil, err
 	}
+	return &requestStream{s, method, id}, nil
+}
 
-	return api.NewEngineClient(conn), nil
+// requestStream remembers the request ID of the stream if it fails.
+type requestStream struct {
+	grpc.ClientStream
+	method string
+	id     string
 }
 
-func Start(workdir string) error {
-	_, err := start(workdir)
+func (s *requestStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err != nil && err != io.EOF {
+		setFailedRequest(s.id)
+		err = lostStreamError(s.method, err)
+	}
 	return err
 }
 
-func start(workdir string) (*docker.Container, error) {
-	homedir, err := homedir.Dir()
+var (
+	failedMu      sync.Mutex
+	failedRequest string
+)
+
+func setFailedRequest(id string) {
+	failedMu.Lock()
+	failedRequest = id
+	failedMu.Unlock()
+}
+
+// FailedRequest returns the request ID of the last call to the daemon that
+// failed, or an empty string if none did. The daemon logs its calls with it.
+func FailedRequest() string {
+	failedMu.Lock()
+	defer failedMu.Unlock()
+	return failedRequest
+}
+
+// withRequestID returns the context sending a new request ID to the daemon,
+// along with the ID of the client.
+func withRequestID(ctx context.Context) (context.Context, string) {
+	ctx = metadata.AppendToOutgoingContext(ctx, api.ClientIDMetadata, clientID)
+	id := newID()
+	if id == "" {
+		return ctx, ""
+	}
+	return metadata.AppendToOutgoingContext(ctx, api.RequestIDMetadata, id), id
+}
+
+// clientID identifies the calls of this process to the daemon, so it takes
+// turns between the clients parsing files.
+var clientID = newID()
+
+// newID returns a random ID, or an empty string if there's no randomness.
+func newID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+// EnsureInstalled pulls the image of the daemon if it's not installed.
+func EnsureInstalled() error {
+	return docker.EnsureInstalled(components.Daemon.Image, components.Daemon.Tag())
+}
+
+// removeOutdated removes the running daemon if it's not running the image
+// expected by the CLI, as happens when the CLI is updated, so it's recreated.
+func removeOutdated() error {
+	info, err := docker.Info(components.Daemon.Name)
+	if err == docker.ErrNotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	id, err := docker.ImageID(ctx, components.Daemon.Ref())
+	if err != nil {
+		return err
+	}
+
+	if info.ImageID == id {
+		return nil
+	}
+
+	logrus.Infof("the daemon is running an outdated image, recreating it with %s", components.Daemon.Ref())
+	return docker.Kill(components.Daemon.Name)
+}
+
+// maxRestarts is how many times docker restarts the daemon after it exits
+// with an error before giving up, which makes it be seen as crashing in a
+// loop.
+const maxRestarts = 3
+
+// crashLogLines is the number of lines of the logs of the daemon in the
+// errors when it keeps crashing.
+const crashLogLines = 20
+
+// recoverStopped starts the daemon again if its container exists but it's not
+// running, as after crashing or after docker is restarted, or removes it to
+// be recreated if it runs an outdated image. It fails if the daemon keeps
+// crashing.
+func recoverStopped() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	info, err := docker.Inspect(ctx, components.Daemon.Name)
+	if err == docker.ErrNotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	// Docker restarts it on its own, with a delay growing every time.
+	for info.State.Restarting && ctx.Err() == nil {
+		time.Sleep(500 * time.Millisecond)
+		if info, err = docker.Inspect(ctx, components.Daemon.Name); err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case info.State.Running:
+		return nil
+	case info.State.Restarting || info.RestartCount >= maxRestarts:
+		return crashLoopError(info.RestartCount, info.State)
+	}
+
+	id, err := docker.ImageID(ctx, components.Daemon.Ref())
+	if err != nil {
+		return err
+	}
+
+	if info.Image != id {
+		logrus.Infof("the daemon stopped %s running an outdated image, recreating it with %s",
+			exitReason(info.State), components.Daemon.Ref())
+		return docker.RemoveContainer(ctx, components.Daemon.Name)
+	}
+
+	// The socket left would be mistaken for the one of the daemon until it
+	// replaces it.
+	if info.Config != nil && info.Config.Labels[labelSocket] != "" {
+		socket := info.Config.Labels[labelSocket]
+		if err := os.Remove(socket); err != nil && !os.IsNotExist(err) {
+			return errors.Wrap(err, "unable to remove the old daemon socket")
+		}
+	}
+
+	logrus.Warnf("the daemon stopped %s, starting it again", exitReason(info.State))
+	if err := docker.StartStopped(ctx, components.Daemon.Name); err != nil {
+		logrus.Infof("could not start the daemon again, recreating it: %v", err)
+		return docker.RemoveContainer(ctx, components.Daemon.Name)
+	}
+	return nil
+}
+
+// exitReason describes why the container with the given state stopped.
+func exitReason(s *types.ContainerState) string {
+	var reason string
+	switch {
+	case s.OOMKilled:
+		reason = "after running out of memory"
+	case s.Error != "":
+		reason = fmt.Sprintf("with the error %q", s.Error)
+	case s.ExitCode != 0:
+		reason = fmt.Sprintf("with the exit code %d", s.ExitCode)
+	default:
+		reason = "cleanly, as when docker is restarted"
+	}
+
+	if at, err := time.Parse(time.RFC3339Nano, s.FinishedAt); err == nil && !at.IsZero() {
+		reason += " at " + at.Local().Format(time.RFC3339)
+	}
+	return reason
+}
+
+// crashLoopError returns the error for the daemon crashing repeatedly, with
+// its last logs.
+func crashLoopError(restarts int, s *types.ContainerState) error {
+	msg := fmt.Sprintf("the daemon keeps crashing, it was restarted %d times and stopped %s; "+
+		"check docker has enough memory and recreate it with srcd init --force", restarts, exitReason(s))
+
+	lines, err := Logs(crashLogLines)
+	if err != nil || len(lines) == 0 {
+		return errors.New(msg)
+	}
+	return fmt.Errorf("%s. Its last logs:\n  %s", msg, strings.Join(lines, "\n  "))
+}
+
+// checkCrashed returns the error for the daemon crashing, if it stopped
+// while the CLI connected to it, or err otherwise.
+func checkCrashed(err error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	info, inspectErr := docker.Inspect(ctx, components.Daemon.Name)
+	if inspectErr != nil || (info.State.Running && !info.State.Restarting) {
+		return err
+	}
+	return crashLoopError(info.RestartCount, info.State)
+}
+
+// Logs returns the given number of lines from the end of the logs of the
+// daemon.
+func Logs(lines int) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return docker.Logs(ctx, components.Daemon.Name, lines)
+}
+
+func Start(cfg *Config) error {
+	_, err := start(cfg)
+	return err
+}
+
+func start(cfg *Config) (*docker.Container, error) {
+	datadir, err := ResolveDataDir(cfg.DataDir)
 	if err != nil {
-		return nil, errors.Wrap(err, "unable to get home dir")
+		return nil, err
+	}
+
+	if err := setupDataDirectory(cfg.Workdir, datadir); err != nil {
+		return nil, err
 	}
 
-	datadir := filepath.Join(homedir, ".srcd")
-	if err := setupDataDirectory(workdir, datadir); err != nil {
+	if err := EnsureInstalled(); err != nil {
 		return nil, err
 	}
 
-	if err := docker.EnsureInstalled(daemonImage, ""); err != nil {
+	if err := removeOutdated(); err != nil {
+		return nil, err
+	}
+
+	if err := recoverStopped(); err != nil {
 		return nil, err
 	}
 
 	return docker.InfoOrStart(
-		daemonName,
-		createDaemon(workdir, datadir),
+		components.Daemon.Name,
+		createDaemon(cfg, datadir),
 	)
 }
 
-func setupDataDirectory(workdir, datadir string) error {
+// dataDirectory returns the directory where the components keep their data.
+func dataDirectory() (string, error) {
+	homedir, err := homedir.Dir()
+	if err != nil {
+		return "", errors.Wrap(err, "unable to get home dir")
+	}
+
+	return filepath.Join(homedir, ".srcd"), nil
+}
+
+// workdirDataDirectories returns the directories with the data of gitbase and
+// pilosa for the given working directory.
+func workdirDataDirectories(workdir, datadir string) []string {
 	hash := sha1.Sum([]byte(workdir))
 	workdirHash := hex.EncodeToString(hash[:])
 
-	paths := [][]string{
-		[]string{datadir, "gitbase", workdirHash},
-		[]string{datadir, "pilosa", workdirHash},
+	return []string{
+		filepath.Join(datadir, "gitbase", workdirHash),
+		filepath.Join(datadir, "pilosa", workdirHash),
+	}
+}
+
+// IndexDirectory returns the directory of the host where gitbase keeps the
+// indexes of the working directory.
+func (c *Config) IndexDirectory() (string, error) {
+	datadir, err := ResolveDataDir(c.DataDir)
+	if err != nil {
+		return "", err
+	}
+	return workdirDataDirectories(c.Workdir, datadir)[0], nil
+}
+
+// WorkdirDirectories returns the directories of the host where gitbase keeps
+// the metadata of the indexes of the working directory and pilosa their data.
+func (c *Config) WorkdirDirectories() (gitbase, pilosa string, err error) {
+	datadir, err := ResolveDataDir(c.DataDir)
+	if err != nil {
+		return "", "", err
+	}
+	dirs := workdirDataDirectories(c.Workdir, datadir)
+	return dirs[0], dirs[1], nil
+}
+
+// VolumeDevice returns the directory of the host the volume with the given
+// name is kept in, in the data directory, or an empty string if it's kept in
+// the default location of docker.
+func (c *Config) VolumeDevice(name string) (string, error) {
+	datadir, err := ResolveDataDir(c.DataDir)
+	if err != nil {
+		return "", err
+	}
+
+	dir, err := volumesDir(datadir)
+	if err != nil || dir == "" {
+		return "", err
+	}
+	return filepath.Join(dir, name), nil
+}
+
+// IndexDirectories returns the directories of the host where gitbase keeps
+// the metadata of its indexes and pilosa keeps their data, of all the
+// working directories, as they all use the same image of pilosa.
+func IndexDirectories(datadir string) (gitbase, pilosa []string, err error) {
+	if gitbase, err = filepath.Glob(filepath.Join(datadir, "gitbase", "*")); err != nil {
+		return nil, nil, err
+	}
+	if pilosa, err = filepath.Glob(filepath.Join(datadir, "pilosa", "*")); err != nil {
+		return nil, nil, err
+	}
+	return gitbase, pilosa, nil
+}
+
+// IndexMetadataDirectory returns the directory where gitbase keeps the
+// metadata of the indexes whose data pilosa keeps in the given directory, one
+// of the ones returned by IndexDirectories.
+func IndexMetadataDirectory(pilosaDir string) string {
+	datadir := filepath.Dir(filepath.Dir(pilosaDir))
+	return filepath.Join(datadir, "gitbase", filepath.Base(pilosaDir))
+}
+
+func setupDataDirectory(workdir, datadir string) error {
+	paths := workdirDataDirectories(workdir, datadir)
+	if vols, err := volumesDir(datadir); err != nil {
+		return err
+	} else if vols != "" {
+		paths = append(paths, filepath.Join(vols, components.BblfshVolume))
 	}
 
 	for _, path := range paths {
-		if err := os.MkdirAll(filepath.Join(path...), 0755); err != nil {
+		if err := os.MkdirAll(path, 0755); err != nil {
 			return errors.Wrap(err, "unable to create data directory")
 		}
 	}
 
+	// Only the user running the engine can reach the socket of the daemon.
+	if UsesSocket() {
+		if err := os.MkdirAll(filepath.Dir(socketPath(datadir)), 0700); err != nil {
+			return errors.Wrap(err, "unable to create the directory of the daemon socket")
+		}
+	}
+
 	return nil
 }
 
-func createDaemon(workdir, datadir string) docker.StartFunc {
+func createDaemon(cfg *Config, datadir string) docker.StartFunc {
 	return func() error {
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
 
 		config := &container.Config{
-			Image:        daemonImage,
-			ExposedPorts: nat.PortSet{"4242": {}},
-			Volumes:      map[string]struct{}{dockerSocket: {}},
+			Image:   components.Daemon.Ref(),
+			Volumes: map[string]struct{}{dockerSocket: {}},
 			Cmd: []string{
-				fmt.Sprintf("--workdir=%s", workdir),
+				fmt.Sprintf("--workdir=%s", cfg.Workdir),
 				fmt.Sprintf("--data=%s", datadir),
 			},
 		}
 
+		opts := cfg.Options
+		config.Labels = opts.labels()
+		config.Labels[labelWorkdir] = cfg.Workdir
+		config.Labels[labelDataDir] = datadir
+
+		// The daemon names the components after the environment too.
+		if env := docker.Environment(); env != docker.DefaultEnvironment {
+			config.Cmd = append(config.Cmd, fmt.Sprintf("--environment=%s", env))
+		}
+
+		vols, err := volumesDir(datadir)
+		if err != nil {
+			return err
+		}
+
+		if vols != "" {
+			config.Cmd = append(config.Cmd, fmt.Sprintf("--volumes-dir=%s", vols))
+		}
+
+		if len(cfg.Repos) > 0 {
+			repos, err := json.Marshal(cfg.Repos)
+			if err != nil {
+				return err
+			}
+			config.Labels[labelRepos] = string(repos)
+		}
+
+		for _, repo := range cfg.Repos {
+			config.Cmd = append(config.Cmd, fmt.Sprintf("--repos=%s", repo))
+		}
+
+		if cfg.WorkdirVolume != "" {
+			config.Labels[labelWorkdirVolume] = cfg.WorkdirVolume
+			config.Cmd = append(config.Cmd, fmt.Sprintf("--workdir-volume=%s", cfg.WorkdirVolume))
+		}
+
+		config.Labels[labelFormat] = cfg.format()
+		config.Cmd = append(config.Cmd, fmt.Sprintf("--format=%s", cfg.format()))
+
+		for k, v := range cfg.Gitbase.labels() {
+			config.Labels[k] = v
+		}
+		config.Cmd = append(config.Cmd, cfg.Gitbase.args()...)
+
+		for k, v := range cfg.Pilosa.labels() {
+			config.Labels[k] = v
+		}
+		config.Cmd = append(config.Cmd, cfg.Pilosa.args()...)
+
+		if cfg.Gitbase.Password != "" {
+			if err := storeGitbasePassword(datadir, cfg.Gitbase.Password); err != nil {
+				return err
+			}
+			config.Env = append(config.Env, envGitbasePassword+"="+cfg.Gitbase.Password)
+		}
+
+		config.Labels[labelSkipNested] = strconv.FormatBool(cfg.RepoPolicy.SkipNested)
+		config.Labels[labelIncludeBare] = strconv.FormatBool(cfg.RepoPolicy.IncludeBare)
+		if len(cfg.Hidden) > 0 {
+			hidden, err := json.Marshal(cfg.Hidden)
+			if err != nil {
+				return err
+			}
+			config.Labels[labelHidden] = string(hidden)
+		}
+		if len(cfg.Excluded) > 0 {
+			excluded, err := json.Marshal(cfg.Excluded)
+			if err != nil {
+				return err
+			}
+			config.Labels[labelExcluded] = string(excluded)
+		}
+
+		for _, path := range cfg.Hidden {
+			config.Cmd = append(config.Cmd, fmt.Sprintf("--hide=%s", path))
+		}
+
+		if len(cfg.Components) > 0 {
+			cmps, err := json.Marshal(cfg.Components)
+			if err != nil {
+				return err
+			}
+			config.Labels[labelComponents] = string(cmps)
+		}
+
+		for _, cmp := range cfg.Components {
+			config.Cmd = append(config.Cmd, fmt.Sprintf("--components=%s", cmp))
+		}
+
+		if len(cfg.Images) > 0 {
+			images, err := json.Marshal(cfg.Images)
+			if err != nil {
+				return err
+			}
+			config.Labels[labelImages] = string(images)
+		}
+
+		for _, name := range sortedKeys(cfg.Images) {
+			config.Cmd = append(config.Cmd, fmt.Sprintf("--image=%s=%s", name, cfg.Images[name]))
+		}
+
+		if opts.BblfshMemory != "" {
+			config.Cmd = append(config.Cmd, fmt.Sprintf("--bblfsh-memory=%s", opts.BblfshMemory))
+		}
+
+		if opts.BblfshMaxDrivers > 0 {
+			config.Cmd = append(config.Cmd, fmt.Sprintf("--bblfsh-max-drivers=%d", opts.BblfshMaxDrivers))
+		}
+
+		if LogLevel != "" {
+			config.Env = append(config.Env, fmt.Sprintf("%s=%s", envLogLevel, LogLevel))
+		}
+
+		config.Labels[labelLogFormat] = cfg.logFormat()
+		config.Env = append(config.Env, fmt.Sprintf("%s=%s", envLogFormat, cfg.logFormat()))
+
+		if docker.RequireNative {
+			config.Env = append(config.Env, envRequireNative+"=true")
+		}
+		if spec := components.PlatformsSpec(); spec != "" {
+			config.Env = append(config.Env, envPlatform+"="+spec)
+		}
+
+		if docker.HTTPProxy != "" {
+			config.Env = append(config.Env, envHTTPProxy+"="+docker.HTTPProxy)
+		}
+		if len(docker.CACerts) > 0 {
+			config.Env = append(config.Env, envCACerts+"="+string(docker.CACerts))
+		}
+		if docker.RegistryMirror != "" {
+			config.Env = append(config.Env, envRegistryMirror+"="+docker.RegistryMirror)
+		}
+		if docker.RegistryAuth != "" {
+			config.Env = append(config.Env, envRegistryAuth+"="+docker.RegistryAuth)
+		}
+
+		probes := cfg.Probes.withDefaults()
+		config.Labels[labelHealthInterval] = probes.Interval.String()
+		config.Labels[labelHealthTimeout] = probes.Timeout.String()
+		config.Cmd = append(config.Cmd,
+			fmt.Sprintf("--health-interval=%s", probes.Interval),
+			fmt.Sprintf("--health-timeout=%s", probes.Timeout))
+
+		// Docker kills the daemon if it doesn't exit in its stop timeout, so
+		// it must be longer than the drain window.
+		drain := cfg.drainTimeout()
+		stopTimeout := int(cfg.GracePeriod() / time.Second)
+		config.Labels[labelDrainTimeout] = drain.String()
+		config.StopTimeout = &stopTimeout
+		config.Cmd = append(config.Cmd, fmt.Sprintf("--drain-timeout=%s", drain))
+
 		host := &container.HostConfig{
-			PortBindings: nat.PortMap{daemonPort: {{HostPort: "4242"}}},
 			Mounts: []mount.Mount{{
 				Type:   mount.TypeBind,
 				Source: dockerSocket,
 				Target: dockerSocket,
 			}},
+			// The CLI starts it again when it stopped for any other
+			// reason, like docker being restarted.
+			RestartPolicy: container.RestartPolicy{
+				Name:              "on-failure",
+				MaximumRetryCount: maxRestarts,
+			},
+		}
+
+		if UsesSocket() {
+			// A socket left by a daemon removed would be mistaken for the
+			// one of the new daemon until it replaces it.
+			socket := socketPath(datadir)
+			if err := os.Remove(socket); err != nil && !os.IsNotExist(err) {
+				return errors.Wrap(err, "unable to remove the old daemon socket")
+			}
+
+			config.Labels[labelSocket] = socket
+			config.Cmd = append(config.Cmd,
+				fmt.Sprintf("--socket=%s", filepath.Join(containerRunDir, socketName)),
+				fmt.Sprintf("--socket-owner=%d:%d", os.Getuid(), os.Getgid()))
+			host.Mounts = append(host.Mounts, mount.Mount{
+				Type:   mount.TypeBind,
+				Source: filepath.Dir(socket),
+				Target: containerRunDir,
+			})
+		} else {
+			creds, err := loadOrCreateCredentials(datadir, cfg.TLS)
+			if err != nil {
+				return err
+			}
+			config.Env = append(config.Env, creds.env()...)
+			config.Labels[labelTLS] = strconv.FormatBool(cfg.TLS)
+
+			// Remote docker hosts are reached from other hosts.
+			ip := "127.0.0.1"
+			if remoteDockerHost() != "" {
+				ip = ""
+			}
+
+			public, err := hostPort(cfg.Port)
+			if err != nil {
+				return err
+			}
+			config.Labels[labelPort] = strconv.Itoa(public)
+
+			port := nat.Port(daemonPort + "/tcp")
+			config.ExposedPorts = nat.PortSet{port: {}}
+			host.PortBindings = nat.PortMap{port: {{HostIP: ip, HostPort: strconv.Itoa(public)}}}
+		}
+
+		if cfg.MetricsAddress != "" {
+			ip, hostPort, err := net.SplitHostPort(cfg.MetricsAddress)
+			if err != nil {
+				return errors.Wrap(err, "invalid address of the metrics")
+			}
+
+			port := nat.Port(metricsPort + "/tcp")
+			if config.ExposedPorts == nil {
+				config.ExposedPorts = nat.PortSet{}
+				host.PortBindings = nat.PortMap{}
+			}
+			config.ExposedPorts[port] = struct{}{}
+			host.PortBindings[port] = []nat.PortBinding{{HostIP: ip, HostPort: hostPort}}
+			config.Labels[labelMetrics] = cfg.MetricsAddress
+			config.Cmd = append(config.Cmd, fmt.Sprintf("--metrics-address=:%s", metricsPort))
 		}
 
-		return docker.Start(ctx, config, host, daemonName)
+		return docker.Start(ctx, config, host, components.Daemon.Name)
 	}
 }
@@ -0,0 +1,273 @@
+package daemon
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/src-d/engine/components"
+)
+
+func TestExitReason(t *testing.T) {
+	testCases := []struct {
+		name     string
+		state    types.ContainerState
+		expected string
+	}{
+		{"oom", types.ContainerState{OOMKilled: true, ExitCode: 137}, "after running out of memory"},
+		{"error", types.ContainerState{Error: "mount failed", ExitCode: 128}, `with the error "mount failed"`},
+		{"exit code", types.ContainerState{ExitCode: 2}, "with the exit code 2"},
+		{"clean", types.ContainerState{}, "cleanly, as when docker is restarted"},
+		{"zero time", types.ContainerState{FinishedAt: "0001-01-01T00:00:00Z"}, "cleanly, as when docker is restarted"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := exitReason(&tc.state); got != tc.expected {
+				t.Errorf("expected: %s, got: %s", tc.expected, got)
+			}
+		})
+	}
+
+	got := exitReason(&types.ContainerState{ExitCode: 1, FinishedAt: "2019-02-01T10:00:00.123Z"})
+	if !strings.HasPrefix(got, "with the exit code 1 at 2019-0") {
+		t.Errorf("expected: the time it stopped, got: %s", got)
+	}
+}
+
+func TestParseMetricsAddress(t *testing.T) {
+	testCases := []struct {
+		addr     string
+		expected string
+		err      bool
+	}{
+		{"", "", false},
+		{"9090", "127.0.0.1:9090", false},
+		{":9090", "127.0.0.1:9090", false},
+		{"0.0.0.0:9090", "0.0.0.0:9090", false},
+		{"192.168.1.2:9100", "192.168.1.2:9100", false},
+		{"localhost:0", "", true},
+		{"foo", "", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.addr, func(t *testing.T) {
+			got, err := ParseMetricsAddress(tc.addr)
+			if tc.err {
+				if err == nil {
+					t.Errorf("expected: an error, got: %s", got)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got != tc.expected {
+				t.Errorf("expected: %s, got: %s", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestChoosePort(t *testing.T) {
+	taken := map[int]bool{DefaultPort: true, 5000: true}
+	free := func(port int) bool { return !taken[port] }
+	pick := func() (int, error) { return 50123, nil }
+
+	testCases := []struct {
+		name       string
+		configured int
+		free       func(int) bool
+		expected   int
+		err        bool
+	}{
+		{"default", 0, func(int) bool { return true }, DefaultPort, false},
+		{"default taken", 0, free, 50123, false},
+		{"configured", 4300, free, 4300, false},
+		{"configured taken", 5000, free, 0, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := choosePort(tc.configured, tc.free, pick)
+			if tc.err != (err != nil) {
+				t.Fatalf("expected error: %v, got: %v", tc.err, err)
+			}
+
+			if got != tc.expected {
+				t.Errorf("expected: %d, got: %d", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestAddressPort(t *testing.T) {
+	testCases := []struct {
+		name     string
+		labels   map[string]string
+		ports    []types.Port
+		expected string
+	}{
+		{
+			"label",
+			map[string]string{labelPort: "4300"},
+			[]types.Port{{IP: "127.0.0.1", PrivatePort: 9090, PublicPort: 9090}, {IP: "127.0.0.1", PrivatePort: 4242, PublicPort: 4300}},
+			"127.0.0.1:4300",
+		},
+		{
+			"default",
+			nil,
+			[]types.Port{{IP: "127.0.0.1", PrivatePort: 4242, PublicPort: 4242}},
+			"127.0.0.1:4242",
+		},
+		{
+			"not published on the label port",
+			map[string]string{labelPort: "4300"},
+			[]types.Port{{IP: "127.0.0.1", PrivatePort: 4242, PublicPort: 4242}},
+			"",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e, err := address(&types.Container{Labels: tc.labels, Ports: tc.ports}, 0)
+			if tc.expected == "" {
+				if err == nil {
+					t.Errorf("expected: an error, got: %s", e)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if e.Address != tc.expected {
+				t.Errorf("expected: %s, got: %s", tc.expected, e.Address)
+			}
+		})
+	}
+}
+
+func TestSamePort(t *testing.T) {
+	running := &Config{Port: 50123}
+	if !running.SamePort(&Config{}) {
+		t.Errorf("expected: any port when none is configured")
+	}
+
+	if running.SamePort(&Config{Port: DefaultPort}) {
+		t.Errorf("expected: another port than the one configured")
+	}
+}
+
+func TestGracePeriod(t *testing.T) {
+	testCases := []struct {
+		drain    time.Duration
+		expected time.Duration
+	}{
+		{0, DefaultDrainTimeout + drainMargin},
+		{time.Minute, time.Minute + drainMargin},
+	}
+
+	for _, tc := range testCases {
+		cfg := &Config{DrainTimeout: tc.drain}
+		if got := cfg.GracePeriod(); got != tc.expected {
+			t.Errorf("expected: %s, got: %s", tc.expected, got)
+		}
+	}
+
+	if !(&Config{}).SameDrainTimeout(&Config{DrainTimeout: DefaultDrainTimeout}) {
+		t.Errorf("expected: the default drain timeout when none is configured")
+	}
+}
+
+func TestIndexMetadataDirectory(t *testing.T) {
+	dir := filepath.Join("home", "user", ".srcd", "pilosa", "abc123")
+	expected := filepath.Join("home", "user", ".srcd", "gitbase", "abc123")
+	if got := IndexMetadataDirectory(dir); got != expected {
+		t.Errorf("expected: %s, got: %s", expected, got)
+	}
+}
+
+func TestSamePilosa(t *testing.T) {
+	running := &Config{}
+	if !running.SamePilosa(&Config{Pilosa: PilosaOptions{Port: components.PilosaDefaultPort}}) {
+		t.Errorf("expected: the default port when none is configured")
+	}
+
+	if running.SamePilosa(&Config{Pilosa: PilosaOptions{Port: 10102}}) {
+		t.Errorf("expected: another port than the one configured")
+	}
+
+	if running.SamePilosa(&Config{Pilosa: PilosaOptions{Expose: "127.0.0.1"}}) {
+		t.Errorf("expected: pilosa exposed when it's not")
+	}
+
+	if running.SamePilosa(&Config{Pilosa: PilosaOptions{Memory: "2g"}}) {
+		t.Errorf("expected: another memory limit than the one configured")
+	}
+
+	if running.SamePilosa(&Config{Pilosa: PilosaOptions{CacheSize: "512m"}}) {
+		t.Errorf("expected: another cache size than the one configured")
+	}
+}
+
+func TestRemoteDockerHost(t *testing.T) {
+	defer os.Setenv("DOCKER_HOST", os.Getenv("DOCKER_HOST"))
+
+	testCases := []struct {
+		host     string
+		expected string
+	}{
+		{"", ""},
+		{"unix:///var/run/docker.sock", ""},
+		{"tcp://127.0.0.1:2375", ""},
+		{"tcp://localhost:2375", ""},
+		{"tcp://192.168.99.100:2376", "192.168.99.100"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.host, func(t *testing.T) {
+			os.Setenv("DOCKER_HOST", tc.host)
+			if got := RemoteDockerHost(); got != tc.expected {
+				t.Errorf("expected: %s, got: %s", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestRecordDataDir(t *testing.T) {
+	def, err := ioutil.TempDir("", "srcd-datadir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(def)
+
+	if dir := recordedDataDir(def); dir != "" {
+		t.Errorf("expected: nothing recorded, got: %s", dir)
+	}
+
+	other := filepath.Join("mnt", "disk", "srcd")
+	if err := recordDataDir(def, other); err != nil {
+		t.Fatal(err)
+	}
+	if dir := recordedDataDir(def); dir != other {
+		t.Errorf("expected: %s, got: %s", other, dir)
+	}
+
+	if err := recordDataDir(def, def); err != nil {
+		t.Fatal(err)
+	}
+	if dir := recordedDataDir(def); dir != "" {
+		t.Errorf("expected: the record removed for the default, got: %s", dir)
+	}
+	if err := recordDataDir(def, def); err != nil {
+		t.Errorf("expected: no error without a record, got: %s", err)
+	}
+}
@@ -0,0 +1,87 @@
+package daemon
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/src-d/engine/components"
+	"github.com/src-d/engine/docker"
+)
+
+// Environment is an environment with containers or volumes of the engine.
+type Environment struct {
+	Name string
+	// Workdir is the working directory of its daemon, empty if it has none.
+	Workdir string
+	// Containers are the names of its containers, and Running the ones of
+	// them running.
+	Containers []string
+	Running    []string
+	// VolumesSize is the disk space used by its volumes in bytes, counting
+	// only the ones with a known size.
+	VolumesSize int64
+}
+
+// Environments returns the environments with containers or volumes of the
+// engine, sorted by name. The default one is always returned.
+func Environments(ctx context.Context) ([]*Environment, error) {
+	usage, err := docker.DiskUsage(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	envs := map[string]*Environment{
+		docker.DefaultEnvironment: {Name: docker.DefaultEnvironment},
+	}
+	get := func(labels map[string]string) *Environment {
+		name := docker.EnvironmentOf(labels)
+		if envs[name] == nil {
+			envs[name] = &Environment{Name: name}
+		}
+		return envs[name]
+	}
+
+	for _, c := range usage.Containers {
+		if len(c.Names) == 0 {
+			continue
+		}
+
+		name := strings.TrimLeft(c.Names[0], "/")
+		if !strings.HasPrefix(name, components.NamePrefix) {
+			continue
+		}
+
+		env := get(c.Labels)
+		env.Containers = append(env.Containers, name)
+		if c.State == "running" {
+			env.Running = append(env.Running, name)
+		}
+
+		// Only the daemon has the working directory in its labels.
+		if workdir := c.Labels[labelWorkdir]; workdir != "" {
+			env.Workdir = workdir
+		}
+	}
+
+	for _, v := range usage.Volumes {
+		if !strings.HasPrefix(v.Name, components.NamePrefix) {
+			continue
+		}
+
+		env := get(v.Labels)
+		if v.UsageData != nil && v.UsageData.Size > 0 {
+			env.VolumesSize += v.UsageData.Size
+		}
+	}
+
+	var result []*Environment
+	for _, env := range envs {
+		sort.Strings(env.Containers)
+		sort.Strings(env.Running)
+		result = append(result, env)
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result, nil
+}
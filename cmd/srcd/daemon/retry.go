@@ -0,0 +1,79 @@
+package daemon
+
+import (
+	"context"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	grpc "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// NoRetry makes the calls to the daemon fail as soon as it's unavailable,
+// instead of retrying the idempotent ones, set from --no-daemon-retry to
+// debug it.
+var NoRetry bool
+
+// The calls retried when the daemon is unavailable are retried up to
+// retryAttempts times, waiting retryBaseDelay before the first retry and
+// twice as long before each of the next ones, about 3 seconds in total.
+const (
+	retryAttempts  = 4
+	retryBaseDelay = 200 * time.Millisecond
+	// reconnectMaxDelay caps the backoff of gRPC reconnecting to the
+	// daemon, so it's reached again as soon as it's back.
+	reconnectMaxDelay = time.Second
+)
+
+// idempotentMethods are the calls that can be sent again when the daemon is
+// unavailable, as they don't change anything, or sending them twice does
+// the same as once. None of the streaming calls can be resumed: the files
+// of a parse stream would be parsed twice or lost, so they fail instead.
+var idempotentMethods = map[string]bool{
+	"/Engine/Version":              true,
+	"/Engine/ValidateQuery":        true,
+	"/Engine/ListDrivers":          true,
+	"/Engine/SetLogLevel":          true,
+	"/grpc.health.v1.Health/Check": true,
+}
+
+// retryDelay returns how long to wait before the given retry, starting at 0.
+func retryDelay(retry int) time.Duration {
+	return retryBaseDelay << uint(retry)
+}
+
+// retryUnaryCall sends again the idempotent calls that failed because the
+// daemon was unavailable, as while it restarts, with an exponential backoff,
+// before giving up with the last error.
+func retryUnaryCall(ctx context.Context, method string, req, reply interface{},
+	cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	for retry := 0; ; retry++ {
+		err := logUnaryCall(ctx, method, req, reply, cc, invoker, opts...)
+		if NoRetry || !idempotentMethods[method] || retry == retryAttempts ||
+			status.Code(err) != codes.Unavailable {
+			return err
+		}
+
+		delay := retryDelay(retry)
+		logrus.Debugf("daemon: %s unavailable, retrying in %s: %v", method, delay, err)
+		t := time.NewTimer(delay)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		}
+	}
+}
+
+// lostStreamError is the error of a stream interrupted because the daemon
+// became unavailable, which can't be resumed.
+func lostStreamError(method string, err error) error {
+	if status.Code(err) != codes.Unavailable {
+		return err
+	}
+	return status.Errorf(codes.Unavailable,
+		"lost the connection to the daemon during %s, which can't be resumed: %s",
+		method, status.Convert(err).Message())
+}
@@ -0,0 +1,88 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	grpc "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestRetryUnaryCall(t *testing.T) {
+	unavailable := status.Error(codes.Unavailable, "connection refused")
+	testCases := []struct {
+		name     string
+		method   string
+		noRetry  bool
+		errs     []error
+		expected int
+		code     codes.Code
+	}{
+		{"ok", "/Engine/Version", false, nil, 1, codes.OK},
+		{"back", "/Engine/Version", false, []error{unavailable}, 2, codes.OK},
+		{"not idempotent", "/Engine/SQL", false, []error{unavailable}, 1, codes.Unavailable},
+		{"disabled", "/Engine/Version", true, []error{unavailable}, 1, codes.Unavailable},
+		{"other error", "/Engine/ListDrivers", false, []error{status.Error(codes.Internal, "boom")}, 1, codes.Internal},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			defer func(old bool) { NoRetry = old }(NoRetry)
+			NoRetry = tc.noRetry
+
+			var calls int
+			invoker := func(ctx context.Context, method string, req, reply interface{},
+				cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+				calls++
+				if calls <= len(tc.errs) {
+					return tc.errs[calls-1]
+				}
+				return nil
+			}
+
+			err := retryUnaryCall(context.Background(), tc.method, nil, nil, nil, invoker)
+			if code := status.Code(err); code != tc.code {
+				t.Errorf("expected: %s, got: %s", tc.code, code)
+			}
+
+			if calls != tc.expected {
+				t.Errorf("expected: %d calls, got: %d", tc.expected, calls)
+			}
+		})
+	}
+}
+
+func TestRetryUnaryCallCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var calls int
+	invoker := func(ctx context.Context, method string, req, reply interface{},
+		cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		calls++
+		cancel()
+		return status.Error(codes.Unavailable, "connection refused")
+	}
+
+	err := retryUnaryCall(ctx, "/Engine/Version", nil, nil, nil, invoker)
+	if status.Code(err) != codes.Unavailable || calls != 1 {
+		t.Errorf("expected: a single unavailable call, got: %d calls, %v", calls, err)
+	}
+}
+
+func TestLostStreamError(t *testing.T) {
+	err := lostStreamError("/Engine/ParseFiles", status.Error(codes.Unavailable, "transport is closing"))
+	if status.Code(err) != codes.Unavailable {
+		t.Errorf("expected: %s, got: %s", codes.Unavailable, status.Code(err))
+	}
+
+	if msg := err.Error(); !strings.Contains(msg, "can't be resumed") || !strings.Contains(msg, "transport is closing") {
+		t.Errorf("expected: the stream not resumable, got: %s", msg)
+	}
+
+	other := fmt.Errorf("invalid message")
+	if got := lostStreamError("/Engine/ParseFiles", other); got != other {
+		t.Errorf("expected: %v, got: %v", other, got)
+	}
+}
@@ -0,0 +1,189 @@
+package daemon
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/docker/docker/api/types"
+	"github.com/src-d/engine/docker"
+)
+
+// Topology is where srcd and docker run when WSL is involved, which decides
+// how the paths of the working directory are translated and whether its
+// mounts cross between Windows and WSL.
+type Topology string
+
+const (
+	// TopologyNative is srcd and docker running without WSL.
+	TopologyNative Topology = "native"
+	// TopologyWindows is srcd for Windows with Docker Desktop running on
+	// its Hyper-V backend, and TopologyWindowsWSL2 on its WSL 2 backend.
+	TopologyWindows     Topology = "windows"
+	TopologyWindowsWSL2 Topology = "windows-wsl2"
+	// TopologyWSLDesktop is srcd for Linux in a WSL distribution with the
+	// docker of Docker Desktop, and TopologyWSL with docker running in the
+	// distribution itself.
+	TopologyWSLDesktop Topology = "wsl-desktop"
+	TopologyWSL        Topology = "wsl"
+)
+
+// wslOSRelease is the release of the kernel, which has microsoft in it in
+// WSL.
+const wslOSRelease = "/proc/sys/kernel/osrelease"
+
+var (
+	// wslPathRegexp matches the paths of the files of a WSL distribution
+	// seen from Windows, like \\wsl$\Ubuntu\home, capturing the distribution
+	// and the path in it.
+	wslPathRegexp = regexp.MustCompile(`(?i)^(?:\\\\|//)wsl(?:\$|\.localhost)[\\/]([^\\/]+)(.*)$`)
+	// drivePathRegexp matches the paths of a Windows drive, like C:\Users,
+	// and mntPathRegexp the ones of a drive mounted in WSL, like
+	// /mnt/c/Users, capturing the drive and the path in it.
+	drivePathRegexp = regexp.MustCompile(`^([A-Za-z]):([\\/].*)?$`)
+	mntPathRegexp   = regexp.MustCompile(`^/mnt/([A-Za-z])(/.*)?$`)
+)
+
+// WSLDistro returns the WSL distribution srcd runs in, and whether it runs
+// in one. The name of the distribution is empty if it's not known.
+func WSLDistro() (string, bool) {
+	if runtime.GOOS != "linux" {
+		return "", false
+	}
+
+	if distro := os.Getenv("WSL_DISTRO_NAME"); distro != "" {
+		return distro, true
+	}
+
+	release, err := ioutil.ReadFile(wslOSRelease)
+	if err != nil || !strings.Contains(strings.ToLower(string(release)), "microsoft") {
+		return "", false
+	}
+	return "", true
+}
+
+var (
+	topologyOnce sync.Once
+	topology     Topology
+)
+
+// DetectTopology returns where srcd and docker run. docker is only asked
+// about itself on Windows or in WSL, once.
+func DetectTopology() Topology {
+	topologyOnce.Do(func() {
+		windows := runtime.GOOS == "windows"
+		_, wsl := WSLDistro()
+		var info *types.Info
+		if windows || wsl {
+			info, _ = docker.SystemInfo()
+		}
+		topology = detectTopology(windows, wsl, info)
+	})
+	return topology
+}
+
+// detectTopology returns the topology of srcd for Windows, or for Linux in
+// WSL, with the docker of the given info, nil if it could not be reached.
+func detectTopology(windows, wsl bool, info *types.Info) Topology {
+	switch {
+	case windows && info != nil && strings.Contains(strings.ToLower(info.KernelVersion), "microsoft"):
+		return TopologyWindowsWSL2
+	case windows:
+		return TopologyWindows
+	case wsl && info != nil && info.OperatingSystem == "Docker Desktop":
+		return TopologyWSLDesktop
+	case wsl:
+		return TopologyWSL
+	default:
+		return TopologyNative
+	}
+}
+
+// Describe returns what the topology is, with the WSL distribution srcd runs
+// in, if known.
+func (t Topology) Describe(distro string) string {
+	in := "a WSL distribution"
+	if distro != "" {
+		in = "the WSL distribution " + distro
+	}
+
+	switch t {
+	case TopologyWindows:
+		return "srcd for Windows with Docker Desktop on its Hyper-V backend"
+	case TopologyWindowsWSL2:
+		return "srcd for Windows with Docker Desktop on its WSL 2 backend"
+	case TopologyWSLDesktop:
+		return "srcd for Linux in " + in + " with Docker Desktop"
+	case TopologyWSL:
+		return "srcd for Linux in " + in + " with docker running in it"
+	default:
+		return "srcd and docker without WSL"
+	}
+}
+
+// TranslatePath translates a path given to srcd from the other side of WSL
+// to one of the side it runs on, the one docker can mount: in WSL, C:\repos
+// is /mnt/c/repos and \\wsl$\Ubuntu\home\repos is /home/repos in Ubuntu, and
+// on Windows, /mnt/c/repos is C:\repos. The other paths are not changed.
+func TranslatePath(dir string) (string, error) {
+	distro, wsl := WSLDistro()
+	return translatePath(dir, runtime.GOOS == "windows", wsl, distro)
+}
+
+// translatePath translates the path for srcd for Windows, or for Linux in
+// the WSL distribution given, if known.
+func translatePath(dir string, windows, wsl bool, distro string) (string, error) {
+	if m := wslPathRegexp.FindStringSubmatch(dir); m != nil {
+		linux := linuxPath(m[2])
+		switch {
+		case windows:
+			return "", fmt.Errorf("%s is in the WSL distribution %s, which Docker Desktop can't mount "+
+				"from Windows; run srcd for Linux in %s with the directory %s", dir, m[1], m[1], linux)
+		case wsl && distro != "" && !strings.EqualFold(m[1], distro):
+			return "", fmt.Errorf("%s is in the WSL distribution %s, not in %s where srcd runs; "+
+				"run srcd in %s with the directory %s", dir, m[1], distro, m[1], linux)
+		case wsl:
+			return linux, nil
+		}
+		return dir, nil
+	}
+
+	if m := drivePathRegexp.FindStringSubmatch(dir); m != nil && wsl {
+		return path.Join("/mnt", strings.ToLower(m[1]), linuxPath(m[2])), nil
+	}
+
+	if m := mntPathRegexp.FindStringSubmatch(dir); m != nil && windows {
+		return strings.ToUpper(m[1]) + `:\` + strings.TrimLeft(strings.Replace(m[2], "/", `\`, -1), `\`), nil
+	}
+
+	return dir, nil
+}
+
+// linuxPath returns the absolute Linux path with the given path with any
+// separators.
+func linuxPath(p string) string {
+	return path.Clean("/" + strings.Replace(p, `\`, "/", -1))
+}
+
+// CrossingWarning returns why mounting the directory into the containers is
+// slow, as it's on the other side of WSL than docker, or an empty string if
+// it's not.
+func CrossingWarning(dir string, t Topology) string {
+	switch {
+	case (t == TopologyWSL || t == TopologyWSLDesktop) && mntPathRegexp.MatchString(dir):
+		return fmt.Sprintf("%s is in the Windows filesystem, which is mounted in WSL with a severe "+
+			"performance penalty, making gitbase many times slower; keep the repositories on the same "+
+			"side as docker, in the filesystem of the distribution, like under /home", dir)
+	case t == TopologyWindowsWSL2 && drivePathRegexp.MatchString(dir):
+		return fmt.Sprintf("%s is in the Windows filesystem, which is mounted in the WSL 2 backend of "+
+			"Docker Desktop with a severe performance penalty, making gitbase many times slower; keep the "+
+			`repositories on the same side as docker, in a WSL distribution like under \\wsl$\Ubuntu\home, `+
+			"and run srcd for Linux there", dir)
+	}
+	return ""
+}
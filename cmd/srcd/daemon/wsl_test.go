@@ -0,0 +1,110 @@
+package daemon
+
+import (
+	"testing"
+
+	"github.com/docker/docker/api/types"
+)
+
+func TestTranslatePath(t *testing.T) {
+	testCases := []struct {
+		name     string
+		dir      string
+		windows  bool
+		wsl      bool
+		distro   string
+		expected string
+		err      string
+	}{
+		{name: "wsl path in wsl", dir: `\\wsl$\Ubuntu\home\me\repos`, wsl: true, distro: "Ubuntu", expected: "/home/me/repos"},
+		{name: "wsl.localhost path in wsl", dir: `\\wsl.localhost\Ubuntu\home\me`, wsl: true, distro: "Ubuntu", expected: "/home/me"},
+		{name: "wsl path with slashes", dir: `//wsl$/ubuntu/home/me/`, wsl: true, distro: "Ubuntu", expected: "/home/me"},
+		{name: "wsl path of unknown distro", dir: `\\wsl$\Debian\srv`, wsl: true, expected: "/srv"},
+		{name: "wsl path of another distro", dir: `\\wsl$\Debian\home\me`, wsl: true, distro: "Ubuntu",
+			err: `\\wsl$\Debian\home\me is in the WSL distribution Debian, not in Ubuntu where srcd runs; run srcd in Debian with the directory /home/me`},
+		{name: "wsl path on windows", dir: `\\wsl$\Ubuntu\home\me\repos`, windows: true,
+			err: `\\wsl$\Ubuntu\home\me\repos is in the WSL distribution Ubuntu, which Docker Desktop can't mount from Windows; run srcd for Linux in Ubuntu with the directory /home/me/repos`},
+		{name: "drive path in wsl", dir: `C:\Users\me\repos`, wsl: true, expected: "/mnt/c/Users/me/repos"},
+		{name: "drive root in wsl", dir: `D:`, wsl: true, expected: "/mnt/d"},
+		{name: "drive path with slashes in wsl", dir: `C:/Users/me`, wsl: true, expected: "/mnt/c/Users/me"},
+		{name: "mnt path on windows", dir: "/mnt/c/Users/me/repos", windows: true, expected: `C:\Users\me\repos`},
+		{name: "mnt root on windows", dir: "/mnt/d", windows: true, expected: `D:\`},
+		{name: "drive path on windows", dir: `C:\Users\me`, windows: true, expected: `C:\Users\me`},
+		{name: "linux path in wsl", dir: "/home/me/repos", wsl: true, expected: "/home/me/repos"},
+		{name: "mnt path in wsl", dir: "/mnt/c/Users", wsl: true, expected: "/mnt/c/Users"},
+		{name: "relative path", dir: "repos", wsl: true, expected: "repos"},
+		{name: "drive path without wsl", dir: `C:\Users`, expected: `C:\Users`},
+		{name: "mnt path without wsl", dir: "/mnt/c/Users", expected: "/mnt/c/Users"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := translatePath(tc.dir, tc.windows, tc.wsl, tc.distro)
+			var errMsg string
+			if err != nil {
+				errMsg = err.Error()
+			}
+			if errMsg != tc.err {
+				t.Fatalf("expected: %s, got: %s", tc.err, errMsg)
+			}
+
+			if err == nil && result != tc.expected {
+				t.Errorf("expected: %s, got: %s", tc.expected, result)
+			}
+		})
+	}
+}
+
+func TestDetectTopology(t *testing.T) {
+	desktop := &types.Info{OperatingSystem: "Docker Desktop", KernelVersion: "5.10.16.3-microsoft-standard-WSL2"}
+	hyperv := &types.Info{OperatingSystem: "Docker Desktop", KernelVersion: "4.19.76-linuxkit"}
+	distro := &types.Info{OperatingSystem: "Ubuntu 20.04.2 LTS", KernelVersion: "5.10.16.3-microsoft-standard-WSL2"}
+
+	testCases := []struct {
+		name     string
+		windows  bool
+		wsl      bool
+		info     *types.Info
+		expected Topology
+	}{
+		{"native", false, false, distro, TopologyNative},
+		{"windows with wsl 2 backend", true, false, desktop, TopologyWindowsWSL2},
+		{"windows with hyper-v backend", true, false, hyperv, TopologyWindows},
+		{"windows without docker", true, false, nil, TopologyWindows},
+		{"wsl with docker desktop", false, true, desktop, TopologyWSLDesktop},
+		{"wsl with docker in the distro", false, true, distro, TopologyWSL},
+		{"wsl without docker", false, true, nil, TopologyWSL},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if result := detectTopology(tc.windows, tc.wsl, tc.info); result != tc.expected {
+				t.Errorf("expected: %s, got: %s", tc.expected, result)
+			}
+		})
+	}
+}
+
+func TestCrossingWarning(t *testing.T) {
+	testCases := []struct {
+		name     string
+		dir      string
+		topology Topology
+		expected bool
+	}{
+		{"wsl in windows filesystem", "/mnt/c/Users/me", TopologyWSL, true},
+		{"wsl desktop in windows filesystem", "/mnt/d/repos", TopologyWSLDesktop, true},
+		{"wsl in distro", "/home/me/repos", TopologyWSLDesktop, false},
+		{"windows wsl 2 backend in drive", `C:\Users\me`, TopologyWindowsWSL2, true},
+		{"windows hyper-v in drive", `C:\Users\me`, TopologyWindows, false},
+		{"native", "/mnt/c/Users/me", TopologyNative, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if result := CrossingWarning(tc.dir, tc.topology); (result != "") != tc.expected {
+				t.Errorf("expected a warning: %v, got: %q", tc.expected, result)
+			}
+		})
+	}
+}
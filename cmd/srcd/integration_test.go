@@ -0,0 +1,132 @@
+//go:build integration
+// +build integration
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// The integration tests run the CLI built from this package against the
+// docker of the environment, creating real containers. They are run with:
+//
+//     go test -tags integration ./cmd/srcd/
+//
+// SRCD_BIN can be given to test another build of the CLI instead.
+
+// integrationPilosaPort is a port other than the default one of pilosa, so
+// gitbase only reaches it if it's given the one chosen.
+const integrationPilosaPort = "10111"
+
+func TestIntegrationPilosaPortIndex(t *testing.T) {
+	srcd, cleanup := buildCLI(t)
+	defer cleanup()
+	workdir := gitRepository(t)
+	defer os.RemoveAll(workdir)
+
+	run(t, srcd, "init", "--force", "--pilosa-port", integrationPilosaPort, workdir)
+	defer run(t, srcd, "stop")
+
+	run(t, srcd, "sql", "index", "create", "repositories", "repository_id",
+		"--index-name", "integration_idx")
+
+	var found bool
+	for _, r := range records(t, run(t, srcd, "sql", "index", "list", "--output-mode", "json")) {
+		if r["type"] == "index" && r["name"] == "integration_idx" {
+			found = true
+			if r["state"] != "ready" {
+				t.Errorf("expected: ready, got: %v", r["state"])
+			}
+		}
+	}
+	if !found {
+		t.Fatalf("expected: integration_idx in the indexes of gitbase")
+	}
+
+	run(t, srcd, "sql", "index", "delete", "integration_idx")
+}
+
+// buildCLI returns the path of the CLI to test, building it unless it's given
+// in SRCD_BIN, and a function removing the one built.
+func buildCLI(t *testing.T) (string, func()) {
+	if bin := os.Getenv("SRCD_BIN"); bin != "" {
+		return bin, func() {}
+	}
+
+	dir, err := ioutil.TempDir("", "srcd-integration")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bin := filepath.Join(dir, "srcd")
+	if out, err := exec.Command("go", "build", "-o", bin, ".").CombinedOutput(); err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("could not build the CLI: %v\n%s", err, out)
+	}
+	return bin, func() { os.RemoveAll(dir) }
+}
+
+// gitRepository returns a working directory with a git repository of one
+// commit.
+func gitRepository(t *testing.T) string {
+	workdir, err := ioutil.TempDir("", "srcd-integration-workdir")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repo := filepath.Join(workdir, "repo")
+	if err := os.MkdirAll(repo, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(repo, "main.go"), []byte("package main\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"add", "main.go"},
+		{"-c", "user.name=srcd", "-c", "user.email=srcd@example.com", "commit", "-q", "-m", "initial"},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = repo
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("could not create the git repository: %v\n%s", err, out)
+		}
+	}
+	return workdir
+}
+
+// run runs the CLI with the given arguments and returns its standard output,
+// failing the test if it exits with an error.
+func run(t *testing.T, srcd string, args ...string) []byte {
+	var stderr bytes.Buffer
+	cmd := exec.Command(srcd, args...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("srcd %v failed: %v\n%s", args, err, stderr.String())
+	}
+	return out
+}
+
+// records returns the records of the output of a command run with
+// --output-mode json.
+func records(t *testing.T, out []byte) []map[string]interface{} {
+	var result []map[string]interface{}
+	s := bufio.NewScanner(bytes.NewReader(out))
+	for s.Scan() {
+		var r map[string]interface{}
+		if err := json.Unmarshal(s.Bytes(), &r); err != nil {
+			t.Fatalf("invalid record %q: %v", s.Text(), err)
+		}
+		result = append(result, r)
+	}
+	return result
+}
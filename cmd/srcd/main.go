@@ -14,8 +14,19 @@
 
 package main
 
-import "github.com/src-d/engine/cmd/srcd/cmd"
+import (
+	"github.com/src-d/engine/cmd/srcd/cmd"
+	"github.com/src-d/engine/components"
+)
+
+// version is set at build time, when the image of the daemon is tagged with
+// it too.
+var version = "undefined"
 
 func main() {
+	if version != "undefined" {
+		components.Daemon.Version = version
+	}
+
 	cmd.Execute()
 }
@@ -0,0 +1,325 @@
+package components
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/src-d/engine/docker"
+)
+
+// BundleManifestName is the name of the manifest of a bundle, its first file.
+const BundleManifestName = "manifest.json"
+
+// bundleFileRegexp matches the names of the files of the images in a bundle.
+var bundleFileRegexp = regexp.MustCompile(`^(images|drivers)/[\w.-]+\.tar$`)
+
+// BundleManifest is what a bundle has: the images of the components and of
+// the drivers of bblfshd, each one saved in a file of the bundle. A bundle is
+// a tarball with the manifest first, followed by the files of the images in
+// its order, the ones of the components before the ones of the drivers.
+type BundleManifest struct {
+	// EngineVersion is the version of the engine that created the bundle,
+	// the one of the image of the daemon in it.
+	EngineVersion string         `json:"engine_version"`
+	Created       time.Time      `json:"created"`
+	Images        []*BundleImage `json:"images"`
+	Drivers       []*BundleImage `json:"drivers"`
+}
+
+// BundleImage is an image in a bundle.
+type BundleImage struct {
+	// Component is the short name of the component of the image, empty for
+	// the drivers.
+	Component string `json:"component,omitempty"`
+	// Language and Version are the ones of a driver.
+	Language string `json:"language,omitempty"`
+	Version  string `json:"version,omitempty"`
+	Ref      string `json:"ref"`
+	// ID is the id of the image, like sha256:..., checked once it's loaded.
+	ID string `json:"id"`
+	// File is the path in the bundle of the tarball of the image written by
+	// docker save, with its size and SHA-256 digest in hex.
+	File   string `json:"file"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// all returns the images of the components and drivers, in the order of
+// their files in the bundle.
+func (m *BundleManifest) all() []*BundleImage {
+	return append(append([]*BundleImage(nil), m.Images...), m.Drivers...)
+}
+
+// Refs returns the references of the images of the components and drivers.
+func (m *BundleManifest) Refs() []string {
+	var refs []string
+	for _, img := range m.all() {
+		refs = append(refs, img.Ref)
+	}
+	return refs
+}
+
+// BundleDriver is a driver of bblfshd to add to a bundle.
+type BundleDriver struct {
+	Language string
+	Version  string
+}
+
+// NewBundleManifest returns the manifest of a bundle with the images of the
+// daemon and all the components, and of the given drivers, with the files
+// they are saved in. Their ids, sizes and digests are filled in by
+// WriteBundle.
+func NewBundleManifest(drivers []BundleDriver) *BundleManifest {
+	m := &BundleManifest{EngineVersion: Daemon.Version}
+	for _, c := range append([]Component{Daemon}, All...) {
+		m.Images = append(m.Images, &BundleImage{
+			Component: c.ShortName(),
+			Ref:       c.Ref(),
+			File:      "images/" + c.ShortName() + ".tar",
+		})
+	}
+
+	for _, d := range drivers {
+		m.Drivers = append(m.Drivers, &BundleImage{
+			Language: d.Language,
+			Version:  d.Version,
+			Ref:      fmt.Sprintf("bblfsh/%s-driver:%s", d.Language, d.Version),
+			File:     "drivers/" + d.Language + ".tar",
+		})
+	}
+	return m
+}
+
+// WriteBundle writes a bundle with the images of the manifest, which must be
+// installed, to w. They are saved first to temporary files in dir, as the
+// bundle starts with their digests, calling progress, if not nil, with each
+// of them before saving it.
+func WriteBundle(ctx context.Context, w io.Writer, m *BundleManifest, dir string, progress func(img *BundleImage)) error {
+	tmp, err := ioutil.TempDir(dir, ".srcd-bundle-")
+	if err != nil {
+		return fmt.Errorf("could not create a temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	files := make(map[*BundleImage]string)
+	for i, img := range m.all() {
+		if progress != nil {
+			progress(img)
+		}
+
+		if img.ID, err = docker.ImageID(ctx, img.Ref); err != nil {
+			return err
+		}
+
+		files[img] = filepath.Join(tmp, fmt.Sprintf("%d.tar", i))
+		if img.Size, img.SHA256, err = saveImage(ctx, img.Ref, files[img]); err != nil {
+			return err
+		}
+	}
+
+	m.Created = time.Now().UTC()
+	return writeBundle(w, m, func(img *BundleImage) (io.ReadCloser, error) {
+		return os.Open(files[img])
+	})
+}
+
+// saveImage saves the image with the given reference to the file with the
+// given path, returning its size and digest.
+func saveImage(ctx context.Context, ref, path string) (size int64, digest string, err error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	cw := &countingWriter{w: io.MultiWriter(f, h)}
+	if err := docker.SaveImage(ctx, ref, cw); err != nil {
+		return 0, "", err
+	}
+	return cw.n, hex.EncodeToString(h.Sum(nil)), f.Close()
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+// writeBundle writes the manifest and then the files of its images, read
+// with open, as a tarball to w.
+func writeBundle(w io.Writer, m *BundleManifest, open func(img *BundleImage) (io.ReadCloser, error)) error {
+	manifest, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not encode the manifest of the bundle: %v", err)
+	}
+
+	tw := tar.NewWriter(w)
+	header := func(name string, size int64) *tar.Header {
+		return &tar.Header{Name: name, Mode: 0644, Size: size, ModTime: m.Created, Typeflag: tar.TypeReg}
+	}
+
+	if err := tw.WriteHeader(header(BundleManifestName, int64(len(manifest)))); err != nil {
+		return err
+	}
+	if _, err := tw.Write(manifest); err != nil {
+		return err
+	}
+
+	for _, img := range m.all() {
+		if err := tw.WriteHeader(header(img.File, img.Size)); err != nil {
+			return err
+		}
+
+		rc, err := open(img)
+		if err != nil {
+			return err
+		}
+
+		_, err = io.Copy(tw, rc)
+		rc.Close()
+		if err != nil {
+			return errors.Wrapf(err, "could not write %s to the bundle", img.Ref)
+		}
+	}
+	return tw.Close()
+}
+
+// VerifyBundle reads the whole bundle in r and returns its manifest, or an
+// error if it's not a bundle or it's incomplete or corrupted: a file of an
+// image is missing or has another size or digest than in the manifest. It's
+// meant to be called before LoadBundle, so nothing is loaded from a broken
+// bundle.
+func VerifyBundle(r io.Reader) (*BundleManifest, error) {
+	tr := tar.NewReader(r)
+	hdr, err := tr.Next()
+	if err == io.EOF || (err == nil && hdr.Name != BundleManifestName) {
+		return nil, fmt.Errorf("not a bundle of the engine: it doesn't start with %s", BundleManifestName)
+	} else if err != nil {
+		return nil, fmt.Errorf("the bundle is corrupted: %v", err)
+	}
+
+	var m BundleManifest
+	if err := json.NewDecoder(tr).Decode(&m); err != nil {
+		return nil, fmt.Errorf("the bundle is corrupted: could not read its manifest: %v", err)
+	}
+
+	files := make(map[string]*BundleImage)
+	for _, img := range m.all() {
+		switch {
+		case !bundleFileRegexp.MatchString(img.File):
+			return nil, fmt.Errorf("the bundle is corrupted: invalid file %q in its manifest", img.File)
+		case files[img.File] != nil:
+			return nil, fmt.Errorf("the bundle is corrupted: %s is twice in its manifest", img.File)
+		}
+		files[img.File] = img
+	}
+
+	seen := make(map[string]bool)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("the bundle is truncated or corrupted: %v", err)
+		}
+
+		img, ok := files[hdr.Name]
+		switch {
+		case !ok:
+			return nil, fmt.Errorf("the bundle is corrupted: %s is not in its manifest", hdr.Name)
+		case seen[hdr.Name]:
+			return nil, fmt.Errorf("the bundle is corrupted: %s is twice in it", hdr.Name)
+		}
+		seen[hdr.Name] = true
+
+		h := sha256.New()
+		n, err := io.Copy(h, tr)
+		if err != nil {
+			return nil, fmt.Errorf("the bundle is truncated or corrupted: could not read %s: %v", hdr.Name, err)
+		}
+
+		if n != img.Size || hex.EncodeToString(h.Sum(nil)) != img.SHA256 {
+			return nil, fmt.Errorf("the bundle is corrupted: %s of %s doesn't have the size and digest of its manifest",
+				hdr.Name, img.Ref)
+		}
+	}
+
+	for _, img := range m.all() {
+		if !seen[img.File] {
+			return nil, fmt.Errorf("the bundle is incomplete: %s of %s is missing", img.File, img.Ref)
+		}
+	}
+	return &m, nil
+}
+
+// LoadBundle loads the images of the components of the bundle in r, verified
+// with VerifyBundle, into docker, checking they have the ids of the manifest,
+// and calls driver with each driver and the content of its file, after all
+// the images are loaded and in the order of the bundle.
+func LoadBundle(ctx context.Context, r io.Reader, m *BundleManifest, progress func(img *BundleImage), driver func(img *BundleImage, r io.Reader) error) error {
+	drivers := make(map[string]*BundleImage)
+	for _, img := range m.Drivers {
+		drivers[img.File] = img
+	}
+
+	images := make(map[string]*BundleImage)
+	for _, img := range m.Images {
+		images[img.File] = img
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("could not read the bundle: %v", err)
+		}
+
+		if img, ok := drivers[hdr.Name]; ok {
+			if err := driver(img, tr); err != nil {
+				return err
+			}
+			continue
+		}
+
+		img, ok := images[hdr.Name]
+		if !ok {
+			continue
+		}
+
+		if progress != nil {
+			progress(img)
+		}
+
+		if err := docker.LoadImage(ctx, tr); err != nil {
+			return errors.Wrapf(err, "could not load %s", img.Ref)
+		}
+
+		id, err := docker.ImageID(ctx, img.Ref)
+		if err != nil {
+			return err
+		}
+
+		if id != img.ID {
+			return fmt.Errorf("%s was loaded with the id %s, not %s like in the manifest of the bundle", img.Ref, id, img.ID)
+		}
+	}
+}
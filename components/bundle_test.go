@@ -0,0 +1,135 @@
+package components
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+// testBundle returns a bundle with an image and a driver with the given
+// contents.
+func testBundle(t *testing.T, image, driver string) ([]byte, *BundleManifest) {
+	digest := func(s string) string {
+		h := sha256.Sum256([]byte(s))
+		return hex.EncodeToString(h[:])
+	}
+
+	m := &BundleManifest{
+		EngineVersion: "v1.0.0",
+		Images: []*BundleImage{{
+			Component: "gitbase",
+			Ref:       "srcd/gitbase:v0.24.0",
+			ID:        "sha256:a",
+			File:      "images/gitbase.tar",
+			Size:      int64(len(image)),
+			SHA256:    digest(image),
+		}},
+		Drivers: []*BundleImage{{
+			Language: "python",
+			Version:  "v2.8.0",
+			Ref:      "bblfsh/python-driver:v2.8.0",
+			ID:       "sha256:b",
+			File:     "drivers/python.tar",
+			Size:     int64(len(driver)),
+			SHA256:   digest(driver),
+		}},
+	}
+
+	contents := map[string]string{"images/gitbase.tar": image, "drivers/python.tar": driver}
+	var buf bytes.Buffer
+	err := writeBundle(&buf, m, func(img *BundleImage) (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewBufferString(contents[img.File])), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes(), m
+}
+
+func TestVerifyBundle(t *testing.T) {
+	valid, _ := testBundle(t, "gitbase image", "python driver")
+
+	// A bundle with a file of the same size but another content than in the
+	// manifest.
+	_, m := testBundle(t, "gitbase image", "python driver")
+	var tampered bytes.Buffer
+	err := writeBundle(&tampered, m, func(img *BundleImage) (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewBufferString("gitbase IMAGE")), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A bundle with a file of the manifest left out.
+	var missing bytes.Buffer
+	tw := tar.NewWriter(&missing)
+	tr := tar.NewReader(bytes.NewReader(valid))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+
+		if hdr.Name == "drivers/python.tar" {
+			continue
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.Copy(tw, tr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var notBundle bytes.Buffer
+	tw = tar.NewWriter(&notBundle)
+	if err := tw.WriteHeader(&tar.Header{Name: "foo", Mode: 0644, Typeflag: tar.TypeReg}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name     string
+		content  []byte
+		expected string
+	}{
+		{"valid", valid, ""},
+		// Cut in the middle of the content of the driver, before the end of
+		// the tarball.
+		{"truncated", valid[:len(valid)-1024-500],
+			"the bundle is truncated or corrupted: could not read drivers/python.tar: unexpected EOF"},
+		{"tampered", tampered.Bytes(),
+			"the bundle is corrupted: images/gitbase.tar of srcd/gitbase:v0.24.0 doesn't have the size and digest of its manifest"},
+		{"missing", missing.Bytes(), "the bundle is incomplete: drivers/python.tar of bblfsh/python-driver:v2.8.0 is missing"},
+		{"not a bundle", notBundle.Bytes(), "not a bundle of the engine: it doesn't start with manifest.json"},
+		{"empty", nil, "not a bundle of the engine: it doesn't start with manifest.json"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m, err := VerifyBundle(bytes.NewReader(tc.content))
+			var result string
+			if err != nil {
+				result = err.Error()
+			}
+			if result != tc.expected {
+				t.Fatalf("expected: %s, got: %s", tc.expected, result)
+			}
+
+			if err == nil && (len(m.Images) != 1 || len(m.Drivers) != 1 || m.EngineVersion != "v1.0.0") {
+				t.Errorf("expected: the manifest of the bundle, got: %+v", m)
+			}
+		})
+	}
+}
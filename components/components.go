@@ -2,8 +2,14 @@ package components
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/docker/docker/api/types"
@@ -23,16 +29,77 @@ type Component struct {
 	Name    string
 	Image   string
 	Version string // only if there's a required version
+	// StopTimeout is how long the component is given to shut down when
+	// stopped, DefaultStopTimeout if it's zero.
+	StopTimeout time.Duration
+	// Volumes are the docker volumes used by the component.
+	Volumes []Volume
+	// Pinned components must keep their version, as newer ones could not
+	// read the data written by it.
+	Pinned bool
 }
 
+// VolumeClass tells how valuable the content of a volume is, which decides
+// whether Purge removes it by default.
+type VolumeClass string
+
 const (
-	BblfshVolume = "srcd-cli-bblfsh-storage"
+	// CacheVolume has content that can be downloaded or computed again, but
+	// at a high cost, like the drivers installed in bblfshd. Purge keeps
+	// them unless asked otherwise.
+	CacheVolume VolumeClass = "cache"
+	// DataVolume has content created by the component.
+	DataVolume VolumeClass = "data"
+	// ScratchVolume has temporary content.
+	ScratchVolume VolumeClass = "scratch"
+	// IndexVolume has the indexes of pilosa, which can take hours to build
+	// again. Purge keeps them unless ResetIndexes is set.
+	IndexVolume VolumeClass = "index"
 )
 
+// VolumeClassLabel is the label of docker volumes with their class, which
+// takes precedence over the class given by the components.
+const VolumeClassLabel = "srcd.volume.class"
+
+// Volume is a docker volume used by a component.
+type Volume struct {
+	Name  string
+	Class VolumeClass
+	// Description of the content of the volume.
+	Description string
+}
+
+// DefaultStopTimeout is how long the components are given to shut down when
+// stopped before being killed, the same as docker.
+const DefaultStopTimeout = 10 * time.Second
+
+// NamePrefix is the prefix of the names of the containers of the components
+// of every environment.
+const NamePrefix = "srcd-cli-"
+
+// prefix is the one of the names of the containers, volumes and network of
+// the environment. See SetEnvironment.
+var prefix = NamePrefix
+
+// BblfshVolume is the volume with the drivers installed in bblfshd.
+var BblfshVolume = "srcd-cli-bblfsh-storage"
+
+// PilosaVolume is the volume with the data of pilosa for the working
+// directory, bound to its directory in the data directory of the engine.
+var PilosaVolume = "srcd-cli-pilosa-data"
+
+// WorkdirVolume is the volume the working directory is synced into when
+// docker runs on another host, mounted in gitbase instead of the directory.
+var WorkdirVolume = "srcd-cli-workdir"
+
 var (
 	Gitbase = Component{
-		Name:  "srcd-cli-gitbase",
-		Image: "srcd/gitbase",
+		Name:        "srcd-cli-gitbase",
+		Image:       "srcd/gitbase",
+		StopTimeout: 30 * time.Second,
+		Volumes: []Volume{
+			{Name: WorkdirVolume, Class: CacheVolume, Description: "synced working directory"},
+		},
 	}
 
 	GitbaseWeb = Component{
@@ -43,6 +110,9 @@ var (
 	Bblfshd = Component{
 		Name:  "srcd-cli-bblfshd",
 		Image: "bblfsh/bblfshd",
+		Volumes: []Volume{
+			{Name: BblfshVolume, Class: CacheVolume, Description: "language drivers"},
+		},
 	}
 
 	BblfshWeb = Component{
@@ -50,10 +120,71 @@ var (
 		Image: "bblfsh/web",
 	}
 
+	// Daemon is the daemon all the commands talk to. Its version is the one
+	// of the CLI it's used by, so it's replaced when the CLI is updated, or
+	// latest for development builds. It's given longer than the 20s it
+	// drains the calls in flight for by default when it's stopped.
+	Daemon = Component{
+		Name:        "srcd-cli-daemon",
+		Image:       "srcd/cli-daemon",
+		StopTimeout: 30 * time.Second,
+	}
+
+	// Pilosa needs time to flush big indexes to disk. Its indexes can't
+	// be read by other versions, it's upgraded with srcd components upgrade
+	// pilosa --to.
 	Pilosa = Component{
-		Name:    "srcd-cli-pilosa",
-		Image:   "pilosa/pilosa",
-		Version: "v0.9.0",
+		Name:        "srcd-cli-pilosa",
+		Image:       "pilosa/pilosa",
+		Version:     "v0.9.0",
+		StopTimeout: time.Minute,
+		Pinned:      true,
+		Volumes: []Volume{
+			{Name: PilosaVolume, Class: IndexVolume, Description: "indexes"},
+		},
+	}
+
+	// WebProxy is in front of the web clients when they are served over
+	// HTTPS or with a token, with a container per web client named after it.
+	// It's not one of All, it's started and stopped along with them.
+	WebProxy = Component{
+		Name:    "srcd-cli-web-proxy",
+		Image:   "nginx",
+		Version: "1.15-alpine",
+		Pinned:  true,
+	}
+
+	// All the components the daemon can start.
+	All []Component
+
+	// requires lists the components each component can't work without.
+	requires map[string][]Component
+
+	workDirDependants []Component
+
+	// aliases are other names of the components, the same as the
+	// subcommands of srcd web starting them.
+	aliases map[string]Component
+)
+
+func init() { link() }
+
+// link sets the lists of the components from them, again when they are
+// renamed.
+func link() {
+	All = []Component{
+		Bblfshd,
+		BblfshWeb,
+		Gitbase,
+		GitbaseWeb,
+		Pilosa,
+	}
+
+	// Gitbase only needs pilosa for indexes, so it can run without it.
+	requires = map[string][]Component{
+		Gitbase.Name:    {Bblfshd},
+		GitbaseWeb.Name: {Gitbase},
+		BblfshWeb.Name:  {Bblfshd},
 	}
 
 	workDirDependants = []Component{
@@ -61,7 +192,538 @@ var (
 		Pilosa,
 		Bblfshd, // does not depend on workdir but it does depend on user dir
 	}
-)
+
+	aliases = map[string]Component{
+		"web-sql":   GitbaseWeb,
+		"web-parse": BblfshWeb,
+	}
+}
+
+// maxEnvironmentName is the longest name of an environment, so the names of
+// its containers are valid host names.
+const maxEnvironmentName = 32
+
+var environmentName = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9-]*$`)
+
+// CheckEnvironmentName validates the name of an environment: letters, digits
+// and dashes, not starting with a dash. Empty is the default environment.
+func CheckEnvironmentName(name string) error {
+	if name == "" || name == docker.DefaultEnvironment {
+		return nil
+	}
+
+	if len(name) > maxEnvironmentName || !environmentName.MatchString(name) {
+		return fmt.Errorf("invalid environment name %q, it must have up to %d letters, "+
+			"digits and dashes, not starting with a dash", name, maxEnvironmentName)
+	}
+	return nil
+}
+
+// SetEnvironment renames the components, their volumes and their network to
+// the ones of the environment with the given name, like srcd-cli-clientA-gitbase
+// for clientA, so they don't interfere with the ones of other environments.
+// The default environment, with an empty name, keeps the names it had before
+// there were environments. The CLI sets it from its flags, and the daemon
+// too, before using any component.
+func SetEnvironment(name string) error {
+	if err := CheckEnvironmentName(name); err != nil {
+		return err
+	}
+
+	if name == "" {
+		name = docker.DefaultEnvironment
+	}
+
+	old := prefix
+	prefix = NamePrefix
+	if name != docker.DefaultEnvironment {
+		prefix += name + "-"
+	}
+
+	rename := func(n string) string { return prefix + strings.TrimPrefix(n, old) }
+	for _, c := range []*Component{&Gitbase, &GitbaseWeb, &Bblfshd, &BblfshWeb, &Daemon, &Pilosa, &WebProxy} {
+		c.Name = rename(c.Name)
+		volumes := make([]Volume, len(c.Volumes))
+		for i, v := range c.Volumes {
+			v.Name = rename(v.Name)
+			volumes[i] = v
+		}
+		c.Volumes = volumes
+	}
+	BblfshVolume = rename(BblfshVolume)
+	PilosaVolume = rename(PilosaVolume)
+	WorkdirVolume = rename(WorkdirVolume)
+	link()
+
+	docker.SetEnvironment(name, prefix+"network")
+	return nil
+}
+
+// Prefix returns the prefix of the names of the containers of the
+// environment, like srcd-cli- or srcd-cli-clientA-.
+func Prefix() string {
+	return prefix
+}
+
+// ShortName returns the name of the component without the prefix of the
+// containers, as given in the command line, like gitbase or bblfsh-web.
+func (c Component) ShortName() string {
+	return strings.TrimPrefix(c.Name, prefix)
+}
+
+// GracePeriod returns how long the component is given to shut down when
+// stopped before being killed.
+func (c Component) GracePeriod() time.Duration {
+	if c.StopTimeout > 0 {
+		return c.StopTimeout
+	}
+	return DefaultStopTimeout
+}
+
+// Requires returns the components the given one can't work without.
+func (c Component) Requires() []Component {
+	return requires[c.Name]
+}
+
+// overrides are the references of the images replacing the default ones of
+// the components, by name. See SetOverrides.
+var overrides = map[string]string{}
+
+// SetOverrides makes the components with the given names run the images with
+// the given references instead of their default ones, like srcd/gitbase:dev
+// for srcd-cli-gitbase. The CLI sets them from its config file, and the
+// daemon from its flags. References without a tag use latest.
+func SetOverrides(refs map[string]string) {
+	overrides = make(map[string]string, len(refs))
+	for name, ref := range refs {
+		image, tag := splitImageID(ref)
+		overrides[name] = image + ":" + tag
+	}
+}
+
+// Overrides returns the references of the images replacing the default ones
+// of the components, by name, including the ones of the versions pinned, so
+// the daemon runs them too.
+func Overrides() map[string]string {
+	refs := make(map[string]string, len(overrides)+len(pins))
+	for name, version := range pins {
+		c, _ := ByName(name)
+		refs[name] = c.Image + ":" + version
+	}
+	for name, ref := range overrides {
+		refs[name] = ref
+	}
+	return refs
+}
+
+// platforms are the platforms forced for the images of the components, by
+// name, and for all of them with an empty name. See SetPlatforms.
+var platforms = map[string]docker.Platform{}
+
+// SetPlatforms makes the components with the given names, or all of them for
+// an empty name, pull and run their images for the given platforms instead of
+// the one of docker, like linux/amd64 for bblfshd on an arm64 host. The CLI
+// sets them from --platform, and the daemon from its flags.
+func SetPlatforms(forced map[string]docker.Platform) {
+	platforms = make(map[string]docker.Platform, len(forced))
+	for name, p := range forced {
+		platforms[name] = p
+	}
+
+	docker.ForcedPlatform = nil
+	if len(platforms) > 0 {
+		docker.ForcedPlatform = imagePlatform
+	}
+}
+
+// ParsePlatforms returns the platforms given like linux/amd64, for all the
+// components, or like bblfshd=linux/amd64, for one, by the name of the
+// components, empty for all of them, as SetPlatforms takes them.
+func ParsePlatforms(items []string) (map[string]docker.Platform, error) {
+	result := make(map[string]docker.Platform)
+	for _, item := range items {
+		var name string
+		value := strings.TrimSpace(item)
+		if value == "" {
+			continue
+		}
+
+		if parts := strings.SplitN(value, "=", 2); len(parts) == 2 {
+			c, ok := ByName(strings.TrimSpace(parts[0]))
+			if !ok {
+				return nil, fmt.Errorf("unknown component %s in %s", parts[0], item)
+			}
+			name, value = c.Name, parts[1]
+		}
+
+		p, err := docker.ParsePlatform(value)
+		if err != nil {
+			return nil, err
+		}
+		result[name] = p
+	}
+	return result, nil
+}
+
+// PlatformsSpec returns the platforms forced, as ParsePlatforms takes them,
+// joined by commas, like linux/arm64,bblfshd=linux/amd64, so the daemon is
+// given them.
+func PlatformsSpec() string {
+	var items []string
+	if p, ok := platforms[""]; ok {
+		items = append(items, p.String())
+	}
+
+	var names []string
+	for name := range platforms {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		c, _ := ByName(name)
+		items = append(items, c.ShortName()+"="+platforms[name].String())
+	}
+	return strings.Join(items, ",")
+}
+
+// Platform returns the platform forced for the component, if there's one.
+func (c Component) Platform() (docker.Platform, bool) {
+	if p, ok := platforms[c.Name]; ok {
+		return p, true
+	}
+	p, ok := platforms[""]
+	return p, ok
+}
+
+// imagePlatform returns the platform forced for the component with the image
+// with the given name, or for all of them if it's not the one of a component.
+func imagePlatform(image string) (docker.Platform, bool) {
+	for _, c := range append([]Component{Daemon}, All...) {
+		if c.ImageName() == image {
+			return c.Platform()
+		}
+	}
+	p, ok := platforms[""]
+	return p, ok
+}
+
+// validatedVersions are the versions of the images of the pinned components
+// the engine is tested with besides their Version, by image, newest last.
+var validatedVersions = map[string][]string{
+	"pilosa/pilosa": {"v0.9.0"},
+}
+
+// ValidatedVersions returns the versions of the image of the component the
+// engine is tested with: its default one and, for the pinned components, the
+// ones it can be upgraded to.
+func (c Component) ValidatedVersions() []string {
+	versions := []string{c.defaultTag()}
+	for _, v := range validatedVersions[c.Image] {
+		if v != c.defaultTag() {
+			versions = append(versions, v)
+		}
+	}
+	return versions
+}
+
+// Validated reports whether the engine is tested with the given version of
+// the image of the component.
+func (c Component) Validated(version string) bool {
+	for _, v := range c.ValidatedVersions() {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
+
+// pins are the versions of the components replacing their default ones, by
+// name. See SetPins.
+var pins = map[string]string{}
+
+// SetPins makes the components with the given names run the given versions
+// of their default images, like v0.24.0 for srcd-cli-gitbase. The CLI sets
+// them from its config file. The components with an override run it instead.
+func SetPins(versions map[string]string) {
+	pins = make(map[string]string, len(versions))
+	for name, version := range versions {
+		pins[name] = version
+	}
+}
+
+// PinnedVersion returns the version the component is pinned to, if there's
+// one and its image is not overridden.
+func (c Component) PinnedVersion() (string, bool) {
+	if _, ok := c.Override(); ok {
+		return "", false
+	}
+
+	version, ok := pins[c.Name]
+	return version, ok
+}
+
+// IsPinned reports whether the component must keep its version, because it's
+// Pinned or its version is pinned.
+func (c Component) IsPinned() bool {
+	_, ok := c.PinnedVersion()
+	return c.Pinned || ok
+}
+
+// Override returns the reference of the image replacing the default one of
+// the component, if there's one.
+func (c Component) Override() (string, bool) {
+	ref, ok := overrides[c.Name]
+	return ref, ok
+}
+
+// ImageName returns the name of the image the component runs, without the
+// tag: the one of its override, if there's one, or Image.
+func (c Component) ImageName() string {
+	if ref, ok := c.Override(); ok {
+		image, _ := splitImageID(ref)
+		return image
+	}
+	return c.Image
+}
+
+// Tag returns the tag of the image of the component: the one of its
+// override, its pinned version, its version or latest.
+func (c Component) Tag() string {
+	if ref, ok := c.Override(); ok {
+		_, tag := splitImageID(ref)
+		return tag
+	}
+	if version, ok := c.PinnedVersion(); ok {
+		return version
+	}
+	return c.defaultTag()
+}
+
+func (c Component) defaultTag() string {
+	if c.Version == "" {
+		return "latest"
+	}
+	return c.Version
+}
+
+// Ref returns the reference of the image of the component with its tag.
+func (c Component) Ref() string {
+	return c.ImageName() + ":" + c.Tag()
+}
+
+// DefaultRef returns the reference of the default image of the component,
+// even if it's overridden.
+func (c Component) DefaultRef() string {
+	return c.Image + ":" + c.defaultTag()
+}
+
+// ByName returns the component with the given name, short name or alias,
+// including the daemon.
+func ByName(name string) (Component, bool) {
+	for _, c := range All {
+		if c.Name == name || c.ShortName() == name {
+			return c, true
+		}
+	}
+
+	if name == Daemon.Name || name == Daemon.ShortName() {
+		return Daemon, true
+	}
+
+	c, ok := aliases[name]
+	return c, ok
+}
+
+// Names returns the short names and aliases the components, including the
+// daemon, can be given by in the command line, sorted.
+func Names() []string {
+	names := []string{Daemon.ShortName()}
+	for _, c := range All {
+		names = append(names, c.ShortName())
+	}
+	for alias := range aliases {
+		names = append(names, alias)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// ByImage returns the component using the image with the given reference,
+// with or without a tag, including the daemon.
+func ByImage(ref string) (Component, bool) {
+	image, _ := splitImageID(ref)
+	for _, c := range append([]Component{Daemon}, All...) {
+		if c.Image == image || c.ImageName() == image {
+			return c, true
+		}
+	}
+	return Component{}, false
+}
+
+// RequiredBy returns the components that can't work without the given one,
+// directly or through others, in the order of All.
+func RequiredBy(c Component) []Component {
+	var result []Component
+	for _, other := range All {
+		if other.Name != c.Name && requiresComponent(other, c) {
+			result = append(result, other)
+		}
+	}
+	return result
+}
+
+// Requirements returns the components the given ones can't work without,
+// directly or through others, every one after the ones it requires, so they
+// can be started in that order. The given ones are left out.
+func Requirements(cs ...Component) []Component {
+	given := make(map[string]bool)
+	for _, c := range cs {
+		given[c.Name] = true
+	}
+
+	var result []Component
+	seen := make(map[string]bool)
+	var visit func(c Component)
+	visit = func(c Component) {
+		for _, r := range c.Requires() {
+			if seen[r.Name] {
+				continue
+			}
+			seen[r.Name] = true
+			visit(r)
+			if !given[r.Name] {
+				result = append(result, r)
+			}
+		}
+	}
+
+	for _, c := range cs {
+		visit(c)
+	}
+	return result
+}
+
+func requiresComponent(c, dep Component) bool {
+	for _, r := range c.Requires() {
+		if r.Name == dep.Name || requiresComponent(r, dep) {
+			return true
+		}
+	}
+	return false
+}
+
+// Enable returns the components to run given the ones requested and the ones
+// to leave out, in the order of All. If none are requested all of them are
+// enabled. The components required by the enabled ones are enabled too,
+// unless they are explicitly left out, which is an error. When all are enabled
+// by default, the ones requiring a component left out are left out too.
+func Enable(names, without []string) ([]Component, error) {
+	disabled := make(map[string]bool)
+	for _, name := range without {
+		c, ok := ByName(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown component %s", name)
+		}
+
+		if c.Name == Daemon.Name {
+			return nil, fmt.Errorf("the daemon can't be disabled")
+		}
+		disabled[c.Name] = true
+	}
+
+	enabled := make(map[string]bool)
+	var enable func(c Component, requiredBy *Component) error
+	enable = func(c Component, requiredBy *Component) error {
+		if disabled[c.Name] {
+			if requiredBy != nil {
+				return fmt.Errorf("%s requires %s, which can't be disabled",
+					requiredBy.ShortName(), c.ShortName())
+			}
+			return nil
+		}
+
+		if enabled[c.Name] {
+			return nil
+		}
+
+		enabled[c.Name] = true
+		for _, dep := range c.Requires() {
+			if err := enable(dep, &c); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var requested []Component
+	if len(names) == 0 {
+		for _, c := range All {
+			if available(c, disabled) {
+				requested = append(requested, c)
+			}
+		}
+	} else {
+		for _, name := range names {
+			c, ok := ByName(name)
+			if !ok {
+				return nil, fmt.Errorf("unknown component %s", name)
+			}
+
+			if c.Name == Daemon.Name {
+				continue
+			}
+
+			if disabled[c.Name] {
+				return nil, fmt.Errorf("%s can't be both enabled and disabled", c.ShortName())
+			}
+			requested = append(requested, c)
+		}
+	}
+
+	for _, c := range requested {
+		if err := enable(c, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	var result []Component
+	for _, c := range All {
+		if enabled[c.Name] {
+			result = append(result, c)
+		}
+	}
+
+	if len(result) == 0 {
+		return nil, fmt.Errorf("all the components are disabled")
+	}
+	return result, nil
+}
+
+// DisabledMessage returns the message for using a component disabled on init,
+// telling the value of --components to re-run it with to enable the component.
+func DisabledMessage(c Component, enable string) string {
+	return fmt.Sprintf("%s is disabled; re-run init with --components %s to enable it",
+		c.ShortName(), enable)
+}
+
+// available reports whether neither the component nor the ones it requires
+// are disabled.
+func available(c Component, disabled map[string]bool) bool {
+	if disabled[c.Name] {
+		return false
+	}
+
+	for _, dep := range c.Requires() {
+		if !available(dep, disabled) {
+			return false
+		}
+	}
+	return true
+}
 
 type FilterFunc func(string) bool
 
@@ -109,7 +771,7 @@ func List(ctx context.Context, filters ...FilterFunc) ([]string, error) {
 			continue
 		}
 
-		if isSrcdComponent(img.RepoTags[0]) {
+		if isComponentImage(img.RepoTags[0]) {
 			res = append(res, img.RepoTags[0])
 		}
 	}
@@ -123,18 +785,82 @@ func List(ctx context.Context, filters ...FilterFunc) ([]string, error) {
 
 var ErrNotSrcd = fmt.Errorf("not srcd component")
 
-// Install installs a new component.
+// Install installs a new component. Images outside the srcd namespaces can
+// only be installed if they override the one of a component.
 func Install(ctx context.Context, id string) error {
-	if !isSrcdComponent(id) {
+	if !isComponentImage(id) {
 		return ErrNotSrcd
 	}
+	warnOverride(id)
 
 	image, version := splitImageID(id)
 	return docker.Pull(ctx, image, version)
 }
 
+// maxConcurrentPulls is the number of images pulled at the same time by
+// InstallAll.
+const maxConcurrentPulls = 3
+
+// InstallResult is the result of installing one of the images of InstallAll.
+type InstallResult struct {
+	// Ref is the reference of the image with its tag, latest if none was
+	// given.
+	Ref string
+	// UpToDate is true if the image was already installed, so it was not
+	// pulled.
+	UpToDate bool
+	Err      error
+}
+
+// InstallAll installs the images with the given references concurrently,
+// skipping the ones already installed, and calling progress, if not nil, with
+// the bytes downloaded of each of them, from several goroutines. If any of
+// the references is not of a component, ErrNotSrcd is returned before pulling
+// anything. The results are in the order of the references.
+func InstallAll(ctx context.Context, refs []string, progress func(ref string, done, total int64)) ([]InstallResult, error) {
+	for _, ref := range refs {
+		if !isComponentImage(ref) {
+			return nil, errors.Wrapf(ErrNotSrcd, "can't install %s", ref)
+		}
+	}
+
+	for _, ref := range refs {
+		warnOverride(ref)
+	}
+
+	results := make([]InstallResult, len(refs))
+	sem := make(chan struct{}, maxConcurrentPulls)
+	var wg sync.WaitGroup
+	for i, ref := range refs {
+		image, version := splitImageID(ref)
+		results[i].Ref = image + ":" + version
+
+		wg.Add(1)
+		go func(r *InstallResult) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			installed, err := docker.IsInstalled(ctx, image, version)
+			if err != nil || installed {
+				r.UpToDate, r.Err = installed, err
+				return
+			}
+
+			var fn func(done, total int64)
+			if progress != nil {
+				fn = func(done, total int64) { progress(r.Ref, done, total) }
+			}
+			r.Err = docker.PullWithProgress(ctx, image, version, fn)
+		}(&results[i])
+	}
+
+	wg.Wait()
+	return results, nil
+}
+
 func IsInstalled(ctx context.Context, id string) (bool, error) {
-	if !isSrcdComponent(id) {
+	if !isComponentImage(id) {
 		return false, ErrNotSrcd
 	}
 
@@ -142,97 +868,483 @@ func IsInstalled(ctx context.Context, id string) (bool, error) {
 	return docker.IsInstalled(ctx, image, version)
 }
 
-func Purge() error {
-	logrus.Info("removing containers...")
-	if err := removeContainers(); err != nil {
-		return errors.Wrap(err, "unable to remove all containers")
-	}
+// PurgePlan lists the resources of the engine removed by Purge.
+type PurgePlan struct {
+	Containers []string        `json:"containers"`
+	Volumes    []PurgeResource `json:"volumes"`
+	Images     []PurgeResource `json:"images"`
+	// Kept are the cache and index volumes that are not removed.
+	Kept []PurgeResource `json:"kept"`
+	// Shared are the images that are not removed as they are used by the
+	// containers of other environments, with them in the description.
+	Shared []PurgeResource `json:"shared"`
+}
 
-	logrus.Info("removing volumes...")
+// PurgeResource is a volume or image to remove along with the disk space it
+// uses in bytes, or -1 if it's unknown.
+type PurgeResource struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+	// Description of the content of volumes, if it's known.
+	Description string `json:"description,omitempty"`
+	// Path is the directory of the host the volume is bound to, if it's kept
+	// in a custom data directory.
+	Path string `json:"path,omitempty"`
+	// Class of volumes, which tells how to remove them when they are kept.
+	Class VolumeClass `json:"-"`
+}
 
-	if err := removeVolumes(); err != nil {
-		return errors.Wrap(err, "unable to remove volumes")
+// MarshalJSON encodes the resource with null for the fields not known, instead
+// of leaving them out or using -1 for the size.
+func (r PurgeResource) MarshalJSON() ([]byte, error) {
+	var size *int64
+	if r.Size >= 0 {
+		size = &r.Size
 	}
 
-	logrus.Info("removing images...")
+	return json.Marshal(struct {
+		Name        string  `json:"name"`
+		Size        *int64  `json:"size"`
+		Description *string `json:"description"`
+		Path        *string `json:"path"`
+	}{r.Name, size, nullString(r.Description), nullString(r.Path)})
+}
 
-	if err := removeImages(); err != nil {
-		return errors.Wrap(err, "unable to remove all images")
+// Empty reports whether there's nothing to remove.
+func (p *PurgePlan) Empty() bool {
+	return len(p.Containers) == 0 && len(p.Volumes) == 0 && len(p.Images) == 0
+}
+
+// Size returns the disk space reclaimed by removing the volumes and images,
+// counting only the ones with a known size.
+func (p *PurgePlan) Size() int64 {
+	var size int64
+	for _, rs := range [][]PurgeResource{p.Volumes, p.Images} {
+		for _, r := range rs {
+			if r.Size > 0 {
+				size += r.Size
+			}
+		}
 	}
+	return size
+}
 
-	return nil
+// PurgeOptions select the resources of the engine removed by Purge. If no
+// type of resource is selected all of them are.
+type PurgeOptions struct {
+	Containers bool
+	Volumes    bool
+	Images     bool
+	// Caches selects the cache volumes too, which are kept otherwise.
+	Caches bool
+	// ResetIndexes selects the index volumes too, which are kept otherwise,
+	// even with Caches.
+	ResetIndexes bool
+	// Component restricts the resources to the ones of a component.
+	Component *Component
+	// AllEnvironments selects the resources of every environment, instead
+	// of only the ones of the environment of the components.
+	AllEnvironments bool
 }
 
-func removeContainers() error {
-	cs, err := docker.List()
+func (o PurgeOptions) all() bool {
+	return !o.Containers && !o.Volumes && !o.Images
+}
+
+// Plan returns what Purge would remove given the options, without removing
+// anything. Cache volumes are kept unless Caches is set, and index volumes
+// unless ResetIndexes is. Volumes and images can't be removed while there are
+// containers using them, so those containers are removed too. The images are
+// shared by the environments, so the ones used by the containers of other
+// environments are kept unless AllEnvironments is set.
+func Plan(ctx context.Context, opts PurgeOptions) (*PurgePlan, error) {
+	usage, err := docker.DiskUsage(ctx)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	for _, c := range cs {
+	all := opts.all()
+	plan := &PurgePlan{
+		Containers: []string{},
+		Volumes:    []PurgeResource{},
+		Images:     []PurgeResource{},
+		Kept:       []PurgeResource{},
+		Shared:     []PurgeResource{},
+	}
+
+	volumes := make(map[string]bool)
+	if all || opts.Volumes {
+		for _, v := range usage.Volumes {
+			if !isFromEngine(v.Name, v.Labels, opts.AllEnvironments) ||
+				(opts.Component != nil && !opts.Component.ownsVolume(v.Name)) {
+				continue
+			}
+
+			r := volumeResource(v)
+			if (r.Class == CacheVolume && !opts.Caches) || (r.Class == IndexVolume && !opts.ResetIndexes) {
+				plan.Kept = append(plan.Kept, r)
+				continue
+			}
+
+			plan.Volumes = append(plan.Volumes, r)
+			volumes[v.Name] = true
+		}
+	}
+
+	// others are the environments using every image, besides this one.
+	others := make(map[string][]string)
+	if !opts.AllEnvironments {
+		for _, c := range usage.Containers {
+			if len(c.Names) == 0 || !isFromEngine(strings.TrimLeft(c.Names[0], "/"), c.Labels, true) {
+				continue
+			}
+
+			if env := docker.EnvironmentOf(c.Labels); !docker.InEnvironment(c.Labels) &&
+				!stringInSlice(others[c.ImageID], env) {
+				others[c.ImageID] = append(others[c.ImageID], env)
+			}
+		}
+	}
+
+	images := make(map[string]bool)
+	if all || opts.Images {
+		for _, img := range usage.Images {
+			if len(img.RepoTags) == 0 || !isComponentImage(img.RepoTags[0]) {
+				continue
+			}
+
+			if opts.Component != nil && !opts.Component.ownsImage(img.RepoTags[0]) {
+				continue
+			}
+
+			if envs := others[img.ID]; len(envs) > 0 {
+				sort.Strings(envs)
+				plan.Shared = append(plan.Shared, PurgeResource{
+					Name:        img.RepoTags[0],
+					Size:        img.Size,
+					Description: strings.Join(envs, ", "),
+				})
+				continue
+			}
+
+			plan.Images = append(plan.Images, PurgeResource{Name: img.RepoTags[0], Size: img.Size})
+			images[img.ID] = true
+		}
+	}
+
+	for _, c := range usage.Containers {
 		if len(c.Names) == 0 {
 			continue
 		}
 
 		name := strings.TrimLeft(c.Names[0], "/")
-		if isFromEngine(name) {
-			logrus.Infof("removing container %s", name)
+		if !isFromEngine(name, c.Labels, opts.AllEnvironments) {
+			continue
+		}
 
-			if err := docker.Kill(name); err != nil {
-				return err
-			}
+		switch {
+		case (all || opts.Containers) && (opts.Component == nil || opts.Component.Name == name):
+		case images[c.ImageID]:
+			logrus.Infof("container %s must be removed too, as it uses an image to remove", name)
+		case usesVolume(c, volumes):
+			logrus.Infof("container %s must be removed too, as it uses a volume to remove", name)
+		default:
+			continue
 		}
+
+		plan.Containers = append(plan.Containers, name)
 	}
 
-	return nil
+	sort.Strings(plan.Containers)
+	sort.Slice(plan.Volumes, func(i, j int) bool { return plan.Volumes[i].Name < plan.Volumes[j].Name })
+	sort.Slice(plan.Images, func(i, j int) bool { return plan.Images[i].Name < plan.Images[j].Name })
+	sort.Slice(plan.Kept, func(i, j int) bool { return plan.Kept[i].Name < plan.Kept[j].Name })
+	sort.Slice(plan.Shared, func(i, j int) bool { return plan.Shared[i].Name < plan.Shared[j].Name })
+	return plan, nil
 }
 
-func removeVolumes() error {
-	vols, err := docker.ListVolumes(context.Background())
+// volumeResource returns the volume with its size, content and class, the
+// one of its label if it has it. The size of the volumes bound to a directory
+// of the host is the one of the directory, as docker only knows it while
+// they are mounted.
+func volumeResource(v *docker.Volume) PurgeResource {
+	size := int64(-1)
+	if v.UsageData != nil {
+		size = v.UsageData.Size
+	}
+
+	vol := volumeByName(v.Name)
+	if class, ok := v.Labels[VolumeClassLabel]; ok {
+		vol.Class = VolumeClass(class)
+	}
+
+	path := docker.BindDevice(v)
+	if path != "" {
+		if s, err := directorySize(path); err == nil {
+			size = s
+		}
+	}
+
+	return PurgeResource{
+		Name:        v.Name,
+		Size:        size,
+		Description: vol.Description,
+		Path:        path,
+		Class:       vol.Class,
+	}
+}
+
+// directorySize returns the size in bytes of the files in the directory.
+func directorySize(path string) (int64, error) {
+	var size int64
+	err := filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
+// VolumeUsage returns the volumes of the components of the environment with
+// the disk space they use.
+func VolumeUsage(ctx context.Context) ([]PurgeResource, error) {
+	usage, err := docker.DiskUsage(ctx)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	for _, vol := range vols {
-		if isFromEngine(vol.Name) {
-			logrus.Infof("removing volume %s", vol.Name)
+	vols := []PurgeResource{}
+	for _, v := range usage.Volumes {
+		if isFromEngine(v.Name, v.Labels, false) {
+			vols = append(vols, volumeResource(v))
+		}
+	}
+	sort.Slice(vols, func(i, j int) bool { return vols[i].Name < vols[j].Name })
+	return vols, nil
+}
 
-			if err := docker.RemoveVolume(context.Background(), vol.Name); err != nil {
-				return err
+func usesVolume(c *docker.Container, volumes map[string]bool) bool {
+	for _, m := range c.Mounts {
+		if volumes[m.Name] {
+			return true
+		}
+	}
+	return false
+}
+
+// ownsVolume reports whether the volume with the given name belongs to the
+// component.
+func (c Component) ownsVolume(name string) bool {
+	for _, v := range c.Volumes {
+		if v.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// volumeByName returns the volume of any component with the given name, or a
+// data volume if none has it.
+func volumeByName(name string) Volume {
+	for _, c := range All {
+		for _, v := range c.Volumes {
+			if v.Name == name {
+				return v
 			}
 		}
 	}
+	return Volume{Name: name, Class: DataVolume}
+}
 
-	return nil
+// ownsImage reports whether the image with the given id belongs to the
+// component.
+func (c Component) ownsImage(id string) bool {
+	image, _ := splitImageID(id)
+	return image == c.Image || image == c.ImageName()
 }
 
-func removeImages() error {
-	cmps, err := List(context.Background())
-	if err != nil {
-		return errors.Wrap(err, "unable to list images")
+// Purge removes the resources in the plan, first the containers, so the
+// volumes and images are not in use, then the volumes and the images.
+func Purge(plan *PurgePlan) error {
+	logrus.Info("removing containers...")
+	for _, name := range plan.Containers {
+		if err := removeContainer(name); err != nil {
+			return errors.Wrap(err, "unable to remove all containers")
+		}
 	}
 
-	for _, cmp := range cmps {
-		logrus.Infof("removing image %s", cmp)
+	logrus.Info("removing volumes...")
+	for _, vol := range plan.Volumes {
+		logrus.Infof("removing volume %s", vol.Name)
+		if err := docker.RemoveVolume(context.Background(), vol.Name); err != nil {
+			return errors.Wrap(err, "unable to remove volumes")
+		}
+
+		// The content of bound volumes is left in the host by docker. Only
+		// the directories created by the engine, named after the volume or
+		// with the indexes of pilosa, are removed.
+		if vol.Path != "" && (filepath.Base(vol.Path) == vol.Name || vol.Class == IndexVolume) {
+			if err := os.RemoveAll(vol.Path); err != nil {
+				logrus.Warnf("could not remove the content of volume %s in %s: %v",
+					vol.Name, vol.Path, err)
+			}
+		}
+	}
+
+	logrus.Info("removing images...")
+	for _, img := range plan.Images {
+		logrus.Infof("removing image %s", img.Name)
 
 		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Minute)
-		defer cancel()
-		if err := docker.RemoveImage(ctx, cmp); err != nil {
+		err := docker.RemoveImage(ctx, img.Name)
+		cancel()
+		if err != nil {
+			return errors.Wrap(err, "unable to remove all images")
+		}
+	}
+
+	return nil
+}
+
+// UninstallOptions select what Uninstall removes along with the images of the
+// components.
+type UninstallOptions struct {
+	// Volumes removes the volumes of the components too, including the
+	// caches and the indexes.
+	Volumes bool
+	// Force stops the containers running the images to remove. Without it,
+	// Uninstall refuses to remove them.
+	Force bool
+}
+
+// UninstallPlan returns what Uninstall would remove of the given components,
+// or of all of them if none is given: their images, the containers using
+// them, and their volumes if asked to.
+func UninstallPlan(ctx context.Context, cmps []Component, opts UninstallOptions) (*PurgePlan, error) {
+	purge := PurgeOptions{Images: true, Volumes: opts.Volumes, Caches: opts.Volumes, ResetIndexes: opts.Volumes}
+	if len(cmps) == 0 {
+		return Plan(ctx, purge)
+	}
+
+	plan := &PurgePlan{
+		Containers: []string{},
+		Volumes:    []PurgeResource{},
+		Images:     []PurgeResource{},
+		Kept:       []PurgeResource{},
+		Shared:     []PurgeResource{},
+	}
+	for _, c := range cmps {
+		c := c
+		purge.Component = &c
+		p, err := Plan(ctx, purge)
+		if err != nil {
+			return nil, err
+		}
+
+		plan.Containers = append(plan.Containers, p.Containers...)
+		plan.Volumes = append(plan.Volumes, p.Volumes...)
+		plan.Images = append(plan.Images, p.Images...)
+		plan.Kept = append(plan.Kept, p.Kept...)
+		plan.Shared = append(plan.Shared, p.Shared...)
+	}
+
+	sort.Strings(plan.Containers)
+	return plan, nil
+}
+
+// ErrInUse is returned by Uninstall when the images to remove are used by
+// running containers.
+var ErrInUse = errors.New("images in use by running containers")
+
+// Uninstall removes what's in the plan returned by UninstallPlan. It returns
+// ErrInUse if any of the containers to remove is running, unless Force is
+// given, which stops them first, with their grace period to shut down.
+func Uninstall(ctx context.Context, plan *PurgePlan, opts UninstallOptions) error {
+	var running []string
+	for _, name := range plan.Containers {
+		ok, err := docker.IsRunning(name)
+		if err != nil {
 			return err
 		}
+
+		if ok {
+			running = append(running, name)
+		}
+	}
+
+	if len(running) > 0 && !opts.Force {
+		return errors.Wrap(ErrInUse, strings.Join(running, ", "))
+	}
+
+	for _, name := range running {
+		grace := DefaultStopTimeout
+		if c, ok := ByName(name); ok {
+			grace = c.GracePeriod()
+		}
+
+		logrus.Infof("stopping %s", name)
+		stopCtx, cancel := context.WithTimeout(ctx, grace+time.Minute)
+		_, err := docker.Stop(stopCtx, name, grace)
+		cancel()
+		if err != nil && err != docker.ErrNotFound {
+			return errors.Wrapf(err, "could not stop %s", name)
+		}
+	}
+
+	return Purge(plan)
+}
+
+// RemoveContainers removes all the containers of the environment, including
+// the daemon, keeping their images and volumes.
+func RemoveContainers() error {
+	cs, err := docker.List()
+	if err != nil {
+		return err
+	}
+
+	for _, c := range cs {
+		if len(c.Names) == 0 {
+			continue
+		}
+
+		name := strings.TrimLeft(c.Names[0], "/")
+		if isFromEngine(name, c.Labels, false) {
+			if err := removeContainer(name); err != nil {
+				return err
+			}
+		}
 	}
 
 	return nil
 }
 
+func removeContainer(name string) error {
+	logrus.Infof("removing container %s", name)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// It could be gone already, if it was stopped before.
+	err := docker.RemoveContainer(ctx, name)
+	if client.IsErrNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// splitImageID splits the reference of an image into its name and tag,
+// latest if it has none. The name can have the port of a registry, like
+// localhost:5000/srcd/gitbase.
 func splitImageID(id string) (image, version string) {
-	parts := strings.Split(id, ":")
-	image = parts[0]
-	version = "latest"
-	if len(parts) > 1 {
-		version = parts[1]
+	i := strings.LastIndex(id, ":")
+	if i < 0 || strings.Contains(id[i+1:], "/") {
+		return id, "latest"
 	}
-	return
+	return id[:i], id[i+1:]
 }
 
 func stringInSlice(slice []string, str string) bool {
@@ -249,6 +1361,49 @@ func isSrcdComponent(id string) bool {
 	return stringInSlice(srcdNamespaces, namespace)
 }
 
-func isFromEngine(name string) bool {
-	return strings.HasPrefix(name, "srcd-cli-")
+// InSrcdNamespace reports whether the image with the given reference is in
+// the namespaces of the images of the components, like srcd or bblfsh.
+func InSrcdNamespace(ref string) bool {
+	return isSrcdComponent(ref)
+}
+
+// isComponentImage reports whether the image is in the srcd namespaces or
+// overrides the one of a component.
+func isComponentImage(id string) bool {
+	return isSrcdComponent(id) || overrideOf(id) != nil
+}
+
+// overrideOf returns the component whose image is overridden by the one with
+// the given reference, nil if there's none.
+func overrideOf(id string) *Component {
+	image, tag := splitImageID(id)
+	for _, c := range append([]Component{Daemon}, All...) {
+		if ref, ok := c.Override(); ok && ref == image+":"+tag {
+			return &c
+		}
+	}
+	return nil
+}
+
+// warnOverride warns about installing an image outside the srcd namespaces
+// overriding the one of a component.
+func warnOverride(id string) {
+	if c := overrideOf(id); c != nil && !isSrcdComponent(id) {
+		logrus.Warnf("%s is not a srcd image, installing it as it overrides the image of %s", id, c.ShortName())
+	}
+}
+
+// isFromEngine reports whether the container or volume with the given name
+// and labels is one of the engine: of any environment with all, or of the
+// one of the components otherwise.
+func isFromEngine(name string, labels map[string]string, all bool) bool {
+	return strings.HasPrefix(name, NamePrefix) && (all || docker.InEnvironment(labels))
+}
+
+// nullString returns nil for empty strings, encoded as null in JSON.
+func nullString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
 }
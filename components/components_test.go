@@ -0,0 +1,360 @@
+package components
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/src-d/engine/docker"
+)
+
+func TestEnable(t *testing.T) {
+	testCases := []struct {
+		name     string
+		names    []string
+		without  []string
+		expected string
+		err      string
+	}{
+		{"all", nil, nil, "bblfshd,bblfsh-web,gitbase,gitbase-web,pilosa", ""},
+		{"without pilosa", nil, []string{"pilosa"}, "bblfshd,bblfsh-web,gitbase,gitbase-web", ""},
+		{"without gitbase", nil, []string{"gitbase"}, "bblfshd,bblfsh-web,pilosa", ""},
+		{"dependencies", []string{"gitbase-web"}, nil, "bblfshd,gitbase,gitbase-web", ""},
+		{"full names", []string{"srcd-cli-bblfshd"}, nil, "bblfshd", ""},
+		{"optional dependency", []string{"gitbase", "pilosa"}, nil, "bblfshd,gitbase,pilosa", ""},
+		{"required dependency", []string{"gitbase-web"}, []string{"gitbase"}, "", "gitbase-web requires gitbase, which can't be disabled"},
+		{"both", []string{"gitbase"}, []string{"gitbase"}, "", "gitbase can't be both enabled and disabled"},
+		{"unknown", []string{"mysql"}, nil, "", "unknown component mysql"},
+		{"none", nil, []string{"bblfshd", "pilosa"}, "", "all the components are disabled"},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			cmps, err := Enable(tt.names, tt.without)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("expected error: %s, got: %v", tt.err, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var names []string
+			for _, c := range cmps {
+				names = append(names, c.ShortName())
+			}
+
+			result := strings.Join(names, ",")
+			if result != tt.expected {
+				t.Errorf("expected: %s, got: %s", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestRequirements(t *testing.T) {
+	testCases := []struct {
+		names    []string
+		expected string
+	}{
+		{[]string{"gitbase-web"}, "bblfshd,gitbase"},
+		{[]string{"gitbase-web", "bblfsh-web"}, "bblfshd,gitbase"},
+		{[]string{"bblfsh-web"}, "bblfshd"},
+		{[]string{"gitbase", "gitbase-web"}, "bblfshd"},
+		{[]string{"pilosa"}, ""},
+	}
+
+	for _, tt := range testCases {
+		t.Run(strings.Join(tt.names, ","), func(t *testing.T) {
+			var cs []Component
+			for _, name := range tt.names {
+				c, ok := ByName(name)
+				if !ok {
+					t.Fatalf("unknown component %s", name)
+				}
+				cs = append(cs, c)
+			}
+
+			var names []string
+			for _, c := range Requirements(cs...) {
+				names = append(names, c.ShortName())
+			}
+
+			result := strings.Join(names, ",")
+			if result != tt.expected {
+				t.Errorf("expected: %s, got: %s", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestRequiredBy(t *testing.T) {
+	testCases := []struct {
+		name     string
+		expected string
+	}{
+		{"bblfshd", "bblfsh-web,gitbase,gitbase-web"},
+		{"gitbase", "gitbase-web"},
+		{"web-sql", ""},
+		{"pilosa", ""},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			c, ok := ByName(tt.name)
+			if !ok {
+				t.Fatalf("unknown component %s", tt.name)
+			}
+
+			var names []string
+			for _, c := range RequiredBy(c) {
+				names = append(names, c.ShortName())
+			}
+
+			result := strings.Join(names, ",")
+			if result != tt.expected {
+				t.Errorf("expected: %s, got: %s", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestInstallAllRejectsUnknownImages(t *testing.T) {
+	_, err := InstallAll(context.Background(), []string{"srcd/gitbase", "mysql:5.7"}, nil)
+	if errors.Cause(err) != ErrNotSrcd {
+		t.Errorf("expected: %v, got: %v", ErrNotSrcd, err)
+	}
+}
+
+func TestSplitImageID(t *testing.T) {
+	testCases := []struct {
+		id    string
+		image string
+		tag   string
+	}{
+		{"srcd/gitbase", "srcd/gitbase", "latest"},
+		{"srcd/gitbase:dev-mybranch", "srcd/gitbase", "dev-mybranch"},
+		{"localhost:5000/fork/gitbase", "localhost:5000/fork/gitbase", "latest"},
+		{"localhost:5000/fork/gitbase:x", "localhost:5000/fork/gitbase", "x"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.id, func(t *testing.T) {
+			image, tag := splitImageID(tc.id)
+			if image != tc.image || tag != tc.tag {
+				t.Errorf("expected: %s %s, got: %s %s", tc.image, tc.tag, image, tag)
+			}
+		})
+	}
+}
+
+func TestOverrides(t *testing.T) {
+	defer SetOverrides(nil)
+	SetOverrides(map[string]string{Gitbase.Name: "localhost:5000/fork/gitbase"})
+
+	if got := Gitbase.Ref(); got != "localhost:5000/fork/gitbase:latest" {
+		t.Errorf("expected: %s, got: %s", "localhost:5000/fork/gitbase:latest", got)
+	}
+
+	if got := Gitbase.DefaultRef(); got != "srcd/gitbase:latest" {
+		t.Errorf("expected: %s, got: %s", "srcd/gitbase:latest", got)
+	}
+
+	if got := Pilosa.Ref(); got != "pilosa/pilosa:v0.9.0" {
+		t.Errorf("expected: %s, got: %s", "pilosa/pilosa:v0.9.0", got)
+	}
+
+	if c, ok := ByImage("localhost:5000/fork/gitbase:latest"); !ok || c.Name != Gitbase.Name {
+		t.Errorf("expected the override to be the image of gitbase, got: %v", c.Name)
+	}
+
+	if !isComponentImage("localhost:5000/fork/gitbase") {
+		t.Errorf("expected the override to be the image of a component")
+	}
+
+	if isComponentImage("localhost:5000/fork/gitbase:other") {
+		t.Errorf("expected other tags of the override not to be images of components")
+	}
+}
+
+func TestPins(t *testing.T) {
+	defer SetPins(nil)
+	defer SetOverrides(nil)
+	SetPins(map[string]string{Gitbase.Name: "v0.24.0", Bblfshd.Name: "v2.14.0"})
+	SetOverrides(map[string]string{Bblfshd.Name: "localhost:5000/fork/bblfshd:dev"})
+
+	if got := Gitbase.Ref(); got != "srcd/gitbase:v0.24.0" {
+		t.Errorf("expected: %s, got: %s", "srcd/gitbase:v0.24.0", got)
+	}
+
+	if !Gitbase.IsPinned() || GitbaseWeb.IsPinned() || !Pilosa.IsPinned() {
+		t.Errorf("expected only gitbase and pilosa to be pinned")
+	}
+
+	// The override replaces the pinned version.
+	if _, ok := Bblfshd.PinnedVersion(); ok {
+		t.Errorf("expected no version pinned for bblfshd, as its image is overridden")
+	}
+
+	refs := Overrides()
+	expected := map[string]string{
+		Gitbase.Name: "srcd/gitbase:v0.24.0",
+		Bblfshd.Name: "localhost:5000/fork/bblfshd:dev",
+	}
+	if len(refs) != len(expected) {
+		t.Fatalf("expected: %v, got: %v", expected, refs)
+	}
+	for name, ref := range expected {
+		if refs[name] != ref {
+			t.Errorf("expected: %s, got: %s", ref, refs[name])
+		}
+	}
+}
+
+func TestParsePlatforms(t *testing.T) {
+	testCases := []struct {
+		name     string
+		items    []string
+		expected string
+		err      string
+	}{
+		{"none", nil, "", ""},
+		{"all", []string{"linux/amd64"}, "linux/amd64", ""},
+		{"one", []string{"bblfshd=linux/amd64"}, "bblfshd=linux/amd64", ""},
+		{"mixed", []string{" gitbase = linux/arm64", "LINUX/ARM64", "bblfshd=linux/amd64"},
+			"linux/arm64,bblfshd=linux/amd64,gitbase=linux/arm64", ""},
+		{"unknown component", []string{"mysql=linux/amd64"}, "", "unknown component mysql in mysql=linux/amd64"},
+		{"unknown platform", []string{"linux/s390x"}, "",
+			`invalid platform "linux/s390x": it must be linux/amd64 or linux/arm64`},
+	}
+
+	defer SetPlatforms(nil)
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			platforms, err := ParsePlatforms(tc.items)
+			var errMsg string
+			if err != nil {
+				errMsg = err.Error()
+			}
+			if errMsg != tc.err {
+				t.Fatalf("expected: %s, got: %s", tc.err, errMsg)
+			}
+			if err != nil {
+				return
+			}
+
+			SetPlatforms(platforms)
+			if result := PlatformsSpec(); result != tc.expected {
+				t.Errorf("expected: %s, got: %s", tc.expected, result)
+			}
+		})
+	}
+}
+
+func TestPlatforms(t *testing.T) {
+	defer SetPlatforms(nil)
+	defer SetOverrides(nil)
+	amd64 := docker.Platform{OS: "linux", Architecture: "amd64"}
+	arm64 := docker.Platform{OS: "linux", Architecture: "arm64"}
+	SetOverrides(map[string]string{Bblfshd.Name: "localhost:5000/fork/bblfshd:dev"})
+
+	SetPlatforms(map[string]docker.Platform{Bblfshd.Name: amd64})
+	if p, ok := docker.ForcedPlatform("localhost:5000/fork/bblfshd"); !ok || p != amd64 {
+		t.Errorf("expected the override of bblfshd to be pulled for %s, got: %s (%v)", amd64, p, ok)
+	}
+	if _, ok := docker.ForcedPlatform(Gitbase.Image); ok {
+		t.Errorf("expected no platform forced for gitbase")
+	}
+
+	SetPlatforms(map[string]docker.Platform{"": arm64, Bblfshd.Name: amd64})
+	if p, ok := Gitbase.Platform(); !ok || p != arm64 {
+		t.Errorf("expected gitbase to run for %s, got: %s (%v)", arm64, p, ok)
+	}
+	if p, ok := docker.ForcedPlatform("alpine"); !ok || p != arm64 {
+		t.Errorf("expected other images to be pulled for %s, got: %s (%v)", arm64, p, ok)
+	}
+
+	SetPlatforms(nil)
+	if docker.ForcedPlatform != nil {
+		t.Errorf("expected no platforms forced")
+	}
+}
+
+func TestSetEnvironment(t *testing.T) {
+	if err := SetEnvironment("clientA"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetEnvironment("")
+
+	testCases := []struct {
+		name     string
+		result   string
+		expected string
+	}{
+		{"component", Gitbase.Name, "srcd-cli-clientA-gitbase"},
+		{"short name", Gitbase.ShortName(), "gitbase"},
+		{"volume", BblfshVolume, "srcd-cli-clientA-bblfsh-storage"},
+		{"pilosa volume", Pilosa.Volumes[0].Name, "srcd-cli-clientA-pilosa-data"},
+		{"environment", docker.Environment(), "clientA"},
+		{"requirement", requires[GitbaseWeb.Name][0].Name, "srcd-cli-clientA-gitbase"},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.result != tt.expected {
+				t.Errorf("expected: %s, got: %s", tt.expected, tt.result)
+			}
+		})
+	}
+
+	if err := SetEnvironment(""); err != nil {
+		t.Fatal(err)
+	}
+
+	if Gitbase.Name != "srcd-cli-gitbase" {
+		t.Errorf("expected: srcd-cli-gitbase, got: %s", Gitbase.Name)
+	}
+}
+
+func TestCheckEnvironmentName(t *testing.T) {
+	testCases := []struct {
+		name  string
+		valid bool
+	}{
+		{"", true},
+		{"default", true},
+		{"clientA", true},
+		{"client-a-2", true},
+		{"-client", false},
+		{"client_a", false},
+		{"client.a", false},
+		{strings.Repeat("a", 33), false},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckEnvironmentName(tt.name)
+			if (err == nil) != tt.valid {
+				t.Errorf("expected valid: %v, got error: %v", tt.valid, err)
+			}
+		})
+	}
+}
+
+func TestValidatedVersions(t *testing.T) {
+	if !Pilosa.Validated("v0.9.0") {
+		t.Errorf("expected: pilosa v0.9.0 validated")
+	}
+
+	if Pilosa.Validated("v1.2.0") {
+		t.Errorf("expected: pilosa v1.2.0 not validated")
+	}
+
+	if got := Gitbase.ValidatedVersions(); len(got) != 1 || got[0] != Gitbase.defaultTag() {
+		t.Errorf("expected: %s, got: %v", Gitbase.defaultTag(), got)
+	}
+}
@@ -0,0 +1,497 @@
+package components
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	units "github.com/docker/go-units"
+	"github.com/src-d/engine/docker"
+)
+
+// ComposeVersion is the version of the format of the compose files exported,
+// the first one with the names of the networks and volumes.
+const ComposeVersion = "3.5"
+
+// ComposePasswordVar is the variable of the compose files exported with the
+// password of gitbase, so it's only written to their .env.
+const ComposePasswordVar = "SRCD_GITBASE_PASSWORD"
+
+// ComposeFile is a docker-compose file running the components as the engine
+// does, without the daemon.
+type ComposeFile struct {
+	Version  string                     `yaml:"version"`
+	Services map[string]*ComposeService `yaml:"services"`
+	Networks map[string]*ComposeNetwork `yaml:"networks,omitempty"`
+	Volumes  map[string]*ComposeVolume  `yaml:"volumes,omitempty"`
+}
+
+// ComposeService is the service of a component in a compose file.
+type ComposeService struct {
+	// Image has the tag and, if it was pulled, the digest of the image.
+	Image           string              `yaml:"image"`
+	ContainerName   string              `yaml:"container_name"`
+	Entrypoint      []string            `yaml:"entrypoint,omitempty"`
+	Command         []string            `yaml:"command,omitempty"`
+	Environment     []string            `yaml:"environment,omitempty"`
+	Ports           []string            `yaml:"ports,omitempty"`
+	Volumes         []string            `yaml:"volumes,omitempty"`
+	Tmpfs           []string            `yaml:"tmpfs,omitempty"`
+	Networks        []string            `yaml:"networks,omitempty"`
+	DependsOn       []string            `yaml:"depends_on,omitempty"`
+	Privileged      bool                `yaml:"privileged,omitempty"`
+	Restart         string              `yaml:"restart,omitempty"`
+	StopGracePeriod string              `yaml:"stop_grace_period,omitempty"`
+	Healthcheck     *ComposeHealthcheck `yaml:"healthcheck,omitempty"`
+	Deploy          *ComposeDeploy      `yaml:"deploy,omitempty"`
+}
+
+// ComposeHealthcheck is the health check of a service.
+type ComposeHealthcheck struct {
+	Test     []string `yaml:"test,omitempty"`
+	Interval string   `yaml:"interval,omitempty"`
+	Timeout  string   `yaml:"timeout,omitempty"`
+	Retries  int      `yaml:"retries,omitempty"`
+	Disable  bool     `yaml:"disable,omitempty"`
+}
+
+// ComposeDeploy has the resource limits of a service, which docker-compose
+// applies with --compatibility.
+type ComposeDeploy struct {
+	Resources ComposeResources `yaml:"resources"`
+}
+
+// ComposeResources are the resources of a service.
+type ComposeResources struct {
+	Limits ComposeLimits `yaml:"limits"`
+}
+
+// ComposeLimits are the limits of the memory and CPUs of a service.
+type ComposeLimits struct {
+	Memory string `yaml:"memory,omitempty"`
+	CPUs   string `yaml:"cpus,omitempty"`
+}
+
+// ComposeNetwork is a network of a compose file, with the name of the one of
+// the engine.
+type ComposeNetwork struct {
+	Name string `yaml:"name"`
+}
+
+// ComposeVolume is a named volume of a compose file, with the name of the one
+// of the engine, bound to a directory of the host if the engine's is.
+type ComposeVolume struct {
+	Name       string            `yaml:"name"`
+	Driver     string            `yaml:"driver,omitempty"`
+	DriverOpts map[string]string `yaml:"driver_opts,omitempty"`
+}
+
+// ComposeVariable is a variable of a compose file, with its value in the .env
+// next to it.
+type ComposeVariable struct {
+	Name  string
+	Value string
+}
+
+// Compose is a compose file exported, along with the values of its variables.
+type Compose struct {
+	File      *ComposeFile
+	Variables []ComposeVariable
+	// Warnings are what the compose file doesn't do like the engine.
+	Warnings []string
+}
+
+// ExportCompose returns the compose file running the components as their
+// containers do, which must be running. The directories of the host given,
+// like the working directory, are replaced with their variables in the paths
+// mounted, and any other directory of the host with a variable of its own.
+func ExportCompose(ctx context.Context, cs []Component, dirs []ComposeVariable) (*Compose, error) {
+	e := newComposeExport(cs, dirs)
+	for _, c := range cs {
+		info, img, err := inspectRunning(ctx, c)
+		if err != nil {
+			return nil, err
+		}
+
+		devices := make(map[string]string)
+		for _, m := range info.HostConfig.Mounts {
+			if m.Type != mount.TypeVolume {
+				continue
+			}
+
+			device, err := docker.VolumeDevice(ctx, m.Source)
+			if err != nil {
+				return nil, err
+			}
+			devices[m.Source] = device
+		}
+
+		e.add(c, info, img, devices)
+	}
+	return e.compose(), nil
+}
+
+// inspectRunning returns the container of the component and its image, which
+// must be running to be exported.
+func inspectRunning(ctx context.Context, c Component) (*types.ContainerJSON, *types.ImageInspect, error) {
+	info, err := docker.Inspect(ctx, c.Name)
+	if err == docker.ErrNotFound || (err == nil && !info.State.Running) {
+		return nil, nil, fmt.Errorf("%s is not running, so how it runs is unknown", c.ShortName())
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	img, err := docker.InspectImage(ctx, info.Image)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not inspect the image of %s: %v", c.ShortName(), err)
+	}
+	return info, img, nil
+}
+
+// composeExport builds the compose file of the components from their
+// containers.
+type composeExport struct {
+	file      *ComposeFile
+	exported  map[string]bool
+	dirs      []ComposeVariable
+	others    []ComposeVariable
+	password  string
+	warnings  []string
+	variables map[string]bool
+}
+
+func newComposeExport(cs []Component, dirs []ComposeVariable) *composeExport {
+	e := &composeExport{
+		file: &ComposeFile{
+			Version:  ComposeVersion,
+			Services: make(map[string]*ComposeService),
+			Networks: make(map[string]*ComposeNetwork),
+			Volumes:  make(map[string]*ComposeVolume),
+		},
+		exported:  make(map[string]bool),
+		dirs:      dirs,
+		variables: make(map[string]bool),
+	}
+	for _, c := range cs {
+		e.exported[c.Name] = true
+	}
+	return e
+}
+
+// add adds the service of the component with the given container and image,
+// and the devices of the volumes it mounts, empty for the regular ones.
+func (e *composeExport) add(c Component, info *types.ContainerJSON, img *types.ImageInspect, devices map[string]string) {
+	if c.Name == Gitbase.Name {
+		e.password = gitbasePassword(info)
+	}
+
+	s := &ComposeService{
+		Image:           imageWithDigest(info.Config.Image, img),
+		ContainerName:   c.Name,
+		Privileged:      info.HostConfig.Privileged,
+		StopGracePeriod: c.GracePeriod().String(),
+		Healthcheck:     composeHealthcheck(info.Config.Healthcheck),
+	}
+
+	var imageCmd, imageEntrypoint []string
+	if img.Config != nil {
+		imageCmd, imageEntrypoint = img.Config.Cmd, img.Config.Entrypoint
+	}
+	if !sameStrings(info.Config.Entrypoint, imageEntrypoint) {
+		s.Entrypoint = escapeAll(info.Config.Entrypoint)
+	}
+	if !sameStrings(info.Config.Cmd, imageCmd) {
+		s.Command = escapeAll(info.Config.Cmd)
+	}
+	s.Environment = escapeAll(ownEnv(info, img))
+
+	for port, bindings := range info.HostConfig.PortBindings {
+		for _, b := range bindings {
+			p := b.HostPort + ":" + string(port)
+			if b.HostIP != "" {
+				p = b.HostIP + ":" + p
+			}
+			s.Ports = append(s.Ports, p)
+		}
+	}
+	sort.Strings(s.Ports)
+
+	for _, m := range info.HostConfig.Mounts {
+		source := m.Source
+		switch m.Type {
+		case mount.TypeBind:
+			source = e.hostPath(m.Source)
+		case mount.TypeVolume:
+			e.file.Volumes[m.Source] = e.volume(m.Source, devices[m.Source])
+		default:
+			e.warnings = append(e.warnings, fmt.Sprintf("the %s mount of %s at %s is left out", m.Type, c.ShortName(), m.Target))
+			continue
+		}
+
+		v := source + ":" + m.Target
+		if m.ReadOnly {
+			v += ":ro"
+		}
+		s.Volumes = append(s.Volumes, v)
+	}
+
+	for path, opts := range info.HostConfig.Tmpfs {
+		if opts != "" {
+			path += ":" + opts
+		}
+		s.Tmpfs = append(s.Tmpfs, path)
+	}
+	sort.Strings(s.Tmpfs)
+
+	if info.NetworkSettings != nil {
+		for name := range info.NetworkSettings.Networks {
+			if name == "bridge" {
+				continue
+			}
+			s.Networks = append(s.Networks, name)
+			e.file.Networks[name] = &ComposeNetwork{Name: name}
+		}
+		sort.Strings(s.Networks)
+	}
+
+	for _, dep := range composeDependencies(c) {
+		if e.exported[dep.Name] {
+			s.DependsOn = append(s.DependsOn, dep.ShortName())
+		}
+	}
+
+	if p := info.HostConfig.RestartPolicy; p.Name != "" && p.Name != "no" {
+		s.Restart = p.Name
+		if p.Name == "on-failure" && p.MaximumRetryCount > 0 {
+			s.Restart += ":" + strconv.Itoa(p.MaximumRetryCount)
+		}
+	}
+
+	var limits ComposeLimits
+	if memory := info.HostConfig.Memory; memory > 0 {
+		limits.Memory = composeBytes(memory)
+	}
+	if cpus := info.HostConfig.NanoCPUs; cpus > 0 {
+		limits.CPUs = strconv.FormatFloat(float64(cpus)/1e9, 'f', -1, 64)
+	}
+	if limits != (ComposeLimits{}) {
+		s.Deploy = &ComposeDeploy{Resources: ComposeResources{Limits: limits}}
+	}
+
+	if (c.Name == GitbaseWeb.Name || c.Name == BblfshWeb.Name) && len(s.Ports) == 0 {
+		e.warnings = append(e.warnings, fmt.Sprintf("%s is served through its proxy with TLS or a token, "+
+			"which is not exported, so it's not published", c.ShortName()))
+	}
+
+	e.file.Services[c.ShortName()] = s
+}
+
+// composeDependencies returns the components the service of the given one
+// depends on: the ones it requires, and pilosa for gitbase.
+func composeDependencies(c Component) []Component {
+	deps := c.Requires()
+	if c.Name == Gitbase.Name {
+		deps = append(deps, Pilosa)
+	}
+	return deps
+}
+
+// compose returns the compose file built, with the values of its variables:
+// the ones of the directories given used, the other directories of the host
+// and the password of gitbase.
+func (e *composeExport) compose() *Compose {
+	result := &Compose{File: e.file, Warnings: e.warnings}
+	for _, v := range e.dirs {
+		if e.variables[v.Name] {
+			result.Variables = append(result.Variables, v)
+		}
+	}
+	result.Variables = append(result.Variables, e.others...)
+
+	if e.password != "" {
+		result.Variables = append(result.Variables, ComposeVariable{ComposePasswordVar, e.password})
+		password, variable := escapeCompose(e.password), "${"+ComposePasswordVar+"}"
+		for _, s := range e.file.Services {
+			hidePassword(s.Command, password, variable)
+			hidePassword(s.Environment, password, variable)
+		}
+	}
+	return result
+}
+
+// gitbasePassword returns the password of gitbase the container runs with,
+// empty if it has none.
+func gitbasePassword(info *types.ContainerJSON) string {
+	var password string
+	for _, env := range info.Config.Env {
+		if kv := strings.SplitN(env, "=", 2); len(kv) == 2 && kv[0] == GitbasePasswordEnv {
+			password = kv[1]
+		}
+	}
+	return password
+}
+
+// ownEnv returns the variables of the environment of the container that
+// don't come from its image.
+func ownEnv(info *types.ContainerJSON, img *types.ImageInspect) []string {
+	fromImage := make(map[string]bool)
+	if img.Config != nil {
+		for _, env := range img.Config.Env {
+			fromImage[env] = true
+		}
+	}
+
+	var env []string
+	for _, e := range info.Config.Env {
+		if !fromImage[e] {
+			env = append(env, e)
+		}
+	}
+	return env
+}
+
+// hidePassword replaces the password of gitbase in the values, escaped as
+// they are, with the variable where it's given to gitbase and its clients: in
+// its environment variable, its flag, and the DSN of gitbase-web.
+func hidePassword(values []string, password, variable string) {
+	for i, v := range values {
+		for _, prefix := range []string{GitbasePasswordEnv + "=", "--password="} {
+			if v == prefix+password {
+				values[i] = prefix + variable
+			}
+		}
+
+		if strings.Contains(v, "@tcp(") {
+			values[i] = strings.Replace(values[i], ":"+password+"@tcp(", ":"+variable+"@tcp(", 1)
+		}
+	}
+}
+
+// hostPath returns the path of the host with the variable of the innermost
+// directory given it's in, or with a new variable if it's in none.
+func (e *composeExport) hostPath(path string) string {
+	best := -1
+	for i, v := range e.dirs {
+		if within(path, v.Value) && (best < 0 || len(v.Value) > len(e.dirs[best].Value)) {
+			best = i
+		}
+	}
+
+	if best < 0 {
+		for _, v := range e.others {
+			if v.Value == path {
+				return "${" + v.Name + "}"
+			}
+		}
+
+		name := fmt.Sprintf("SRCD_PATH_%d", len(e.others)+1)
+		e.others = append(e.others, ComposeVariable{name, path})
+		return "${" + name + "}"
+	}
+
+	v := e.dirs[best]
+	e.variables[v.Name] = true
+	rel, _ := filepath.Rel(v.Value, path)
+	if rel == "." {
+		return "${" + v.Name + "}"
+	}
+	return "${" + v.Name + "}/" + filepath.ToSlash(rel)
+}
+
+// volume returns the named volume, bound to the directory of the host with
+// its variable if it's bound to one.
+func (e *composeExport) volume(name, device string) *ComposeVolume {
+	v := &ComposeVolume{Name: name}
+	if device != "" {
+		v.Driver = "local"
+		v.DriverOpts = map[string]string{"type": "none", "o": "bind", "device": e.hostPath(device)}
+	}
+	return v
+}
+
+// within reports whether the path is the directory or is in it.
+func within(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// imageWithDigest returns the reference of the image with its tag and, if it
+// was pulled, its digest, so the same image is run.
+func imageWithDigest(ref string, img *types.ImageInspect) string {
+	image, _ := splitImageID(ref)
+	for _, d := range img.RepoDigests {
+		if i := strings.Index(d, "@"); i >= 0 && d[:i] == image {
+			return ref + d[i:]
+		}
+	}
+	return ref
+}
+
+// composeHealthcheck returns the health check of the container, nil if it has
+// none.
+func composeHealthcheck(h *container.HealthConfig) *ComposeHealthcheck {
+	if h == nil || len(h.Test) == 0 {
+		return nil
+	}
+
+	if h.Test[0] == "NONE" {
+		return &ComposeHealthcheck{Disable: true}
+	}
+
+	return &ComposeHealthcheck{
+		Test:     escapeAll(h.Test),
+		Interval: durationOrEmpty(h.Interval),
+		Timeout:  durationOrEmpty(h.Timeout),
+		Retries:  h.Retries,
+	}
+}
+
+// composeBytes returns the number of bytes in the units of compose, in MiB if
+// it's a whole number of them.
+func composeBytes(n int64) string {
+	if n%units.MiB == 0 {
+		return fmt.Sprintf("%dM", n/units.MiB)
+	}
+	return fmt.Sprintf("%db", n)
+}
+
+func durationOrEmpty(d time.Duration) string {
+	if d == 0 {
+		return ""
+	}
+	return d.String()
+}
+
+// escapeCompose escapes the dollar signs of a value of a compose file.
+func escapeCompose(v string) string {
+	return strings.Replace(v, "$", "$$", -1)
+}
+
+// escapeAll escapes the values, so compose doesn't take the dollar signs in
+// them for variables.
+func escapeAll(values []string) []string {
+	var result []string
+	for _, v := range values {
+		result = append(result, escapeCompose(v))
+	}
+	return result
+}
+
+func sameStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,164 @@
+package components
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/go-connections/nat"
+)
+
+func composeContainer(config *container.Config, host *container.HostConfig) *types.ContainerJSON {
+	return &types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{HostConfig: host},
+		Config:            config,
+		NetworkSettings: &types.NetworkSettings{Networks: map[string]*network.EndpointSettings{
+			"srcd-cli-network": {},
+			"bridge":           {},
+		}},
+	}
+}
+
+func TestComposeExport(t *testing.T) {
+	dirs := []ComposeVariable{
+		{"SRCD_WORKDIR", "/home/user/repos"},
+		{"SRCD_DATA_DIR", "/home/user/.srcd"},
+	}
+	e := newComposeExport([]Component{Gitbase, Pilosa}, dirs)
+
+	gitbase := composeContainer(
+		&container.Config{
+			Image: "srcd/gitbase:v0.24.0",
+			Env:   []string{"PATH=/bin", "GITBASE_PASSWORD=pa$s", "BBLFSH_ENDPOINT=srcd-cli-bblfshd:9432"},
+			Cmd:   []string{"server", "--password=pa$s"},
+			Healthcheck: &container.HealthConfig{
+				Test:     []string{"CMD", "gitbase", "ping"},
+				Interval: 5 * time.Second,
+				Retries:  3,
+			},
+		},
+		&container.HostConfig{
+			PortBindings: nat.PortMap{"3306/tcp": {{HostIP: "127.0.0.1", HostPort: "3306"}}},
+			Mounts: []mount.Mount{
+				{Type: mount.TypeBind, Source: "/home/user/repos", Target: "/opt/repos", ReadOnly: true},
+				{Type: mount.TypeBind, Source: "/home/user/.srcd/gitbase/indexes", Target: "/var/lib/gitbase/index"},
+				{Type: mount.TypeBind, Source: "/etc/ssl", Target: "/etc/ssl"},
+				{Type: mount.TypeVolume, Source: "srcd-cli-gitbase-cache", Target: "/cache"},
+			},
+			RestartPolicy: container.RestartPolicy{Name: "on-failure", MaximumRetryCount: 3},
+			Resources:     container.Resources{Memory: 512 * 1024 * 1024, NanoCPUs: 1500000000},
+		},
+	)
+	gitbaseImage := &types.ImageInspect{
+		RepoDigests: []string{"srcd/gitbase@sha256:abc"},
+		Config:      &container.Config{Env: []string{"PATH=/bin"}, Cmd: []string{"server"}},
+	}
+	e.add(Gitbase, gitbase, gitbaseImage, map[string]string{"srcd-cli-gitbase-cache": "/home/user/.srcd/cache"})
+
+	pilosa := composeContainer(
+		&container.Config{Image: "pilosa/pilosa:v1.3.0", Cmd: []string{"server"}},
+		&container.HostConfig{},
+	)
+	pilosaImage := &types.ImageInspect{Config: &container.Config{Cmd: []string{"server"}}}
+	e.add(Pilosa, pilosa, pilosaImage, nil)
+
+	result := e.compose()
+
+	s := result.File.Services["gitbase"]
+	if s == nil {
+		t.Fatalf("expected a gitbase service, got: %v", result.File.Services)
+	}
+
+	expectedImage := "srcd/gitbase:v0.24.0@sha256:abc"
+	if s.Image != expectedImage {
+		t.Errorf("expected: %s, got: %s", expectedImage, s.Image)
+	}
+
+	checkStrings := func(name string, expected, got []string) {
+		if !reflect.DeepEqual(expected, got) {
+			t.Errorf("%s: expected: %v, got: %v", name, expected, got)
+		}
+	}
+
+	checkStrings("environment", []string{
+		"GITBASE_PASSWORD=${SRCD_GITBASE_PASSWORD}",
+		"BBLFSH_ENDPOINT=srcd-cli-bblfshd:9432",
+	}, s.Environment)
+	checkStrings("command", []string{"server", "--password=${SRCD_GITBASE_PASSWORD}"}, s.Command)
+	checkStrings("ports", []string{"127.0.0.1:3306:3306/tcp"}, s.Ports)
+	checkStrings("volumes", []string{
+		"${SRCD_WORKDIR}:/opt/repos:ro",
+		"${SRCD_DATA_DIR}/gitbase/indexes:/var/lib/gitbase/index",
+		"${SRCD_PATH_1}:/etc/ssl",
+		"srcd-cli-gitbase-cache:/cache",
+	}, s.Volumes)
+	checkStrings("networks", []string{"srcd-cli-network"}, s.Networks)
+	checkStrings("depends_on", []string{"pilosa"}, s.DependsOn)
+
+	if s.Restart != "on-failure:3" {
+		t.Errorf("expected: %s, got: %s", "on-failure:3", s.Restart)
+	}
+
+	expectedLimits := ComposeLimits{Memory: "512M", CPUs: "1.5"}
+	if s.Deploy == nil || s.Deploy.Resources.Limits != expectedLimits {
+		t.Errorf("expected: %v, got: %v", expectedLimits, s.Deploy)
+	}
+
+	expectedHealthcheck := &ComposeHealthcheck{Test: []string{"CMD", "gitbase", "ping"}, Interval: "5s", Retries: 3}
+	if !reflect.DeepEqual(expectedHealthcheck, s.Healthcheck) {
+		t.Errorf("expected: %v, got: %v", expectedHealthcheck, s.Healthcheck)
+	}
+
+	expectedVolume := &ComposeVolume{
+		Name:       "srcd-cli-gitbase-cache",
+		Driver:     "local",
+		DriverOpts: map[string]string{"type": "none", "o": "bind", "device": "${SRCD_DATA_DIR}/cache"},
+	}
+	if v := result.File.Volumes["srcd-cli-gitbase-cache"]; !reflect.DeepEqual(expectedVolume, v) {
+		t.Errorf("expected: %v, got: %v", expectedVolume, v)
+	}
+
+	p := result.File.Services["pilosa"]
+	if p == nil || p.Command != nil || p.Deploy != nil || p.Restart != "" {
+		t.Errorf("expected pilosa with the defaults of its image, got: %+v", p)
+	}
+
+	expectedVariables := []ComposeVariable{
+		{"SRCD_WORKDIR", "/home/user/repos"},
+		{"SRCD_DATA_DIR", "/home/user/.srcd"},
+		{"SRCD_PATH_1", "/etc/ssl"},
+		{"SRCD_GITBASE_PASSWORD", "pa$s"},
+	}
+	if !reflect.DeepEqual(expectedVariables, result.Variables) {
+		t.Errorf("expected: %v, got: %v", expectedVariables, result.Variables)
+	}
+}
+
+func TestHostPath(t *testing.T) {
+	e := newComposeExport(nil, []ComposeVariable{
+		{"SRCD_DATA_DIR", "/home/user/.srcd"},
+		{"SRCD_WORKDIR", "/home/user/.srcd/repos"},
+	})
+
+	testCases := []struct {
+		path     string
+		expected string
+	}{
+		{"/home/user/.srcd", "${SRCD_DATA_DIR}"},
+		{"/home/user/.srcd/gitbase", "${SRCD_DATA_DIR}/gitbase"},
+		{"/home/user/.srcd/repos/a", "${SRCD_WORKDIR}/a"},
+		{"/home/user/.srcdx", "${SRCD_PATH_1}"},
+		{"/tmp", "${SRCD_PATH_2}"},
+		{"/home/user/.srcdx", "${SRCD_PATH_1}"},
+	}
+
+	for _, tc := range testCases {
+		if got := e.hostPath(tc.path); got != tc.expected {
+			t.Errorf("%s: expected: %s, got: %s", tc.path, tc.expected, got)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package components
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Address is where a component running can be connected to.
+type Address struct {
+	Component string `json:"component"`
+	// Description says what the address is for, like gitbase DSN.
+	Description string `json:"description"`
+	Address     string `json:"address"`
+}
+
+// Addresses returns the addresses of the host ports published by the
+// components running, on the given docker host or on this machine if it's
+// empty, and the unix socket of the daemon, if it's served on one.
+func Addresses(statuses []*Status, dockerHost, socket string) []Address {
+	result := []Address{}
+	for _, s := range statuses {
+		if s.State != StateRunning {
+			continue
+		}
+
+		if s.Name == Daemon.ShortName() && socket != "" {
+			result = append(result, Address{s.Name, "daemon gRPC", "unix://" + socket})
+		}
+
+		// The loopback of a remote docker host is only reached through a
+		// tunnel from this machine.
+		ip, name := "127.0.0.1", "localhost"
+		tunnel := dockerHost != "" && IsLoopback(s.hostIP)
+		if dockerHost != "" && !tunnel {
+			ip = URLHost(s.hostIP, dockerHost)
+			name = ip
+		}
+
+		for _, p := range s.Ports {
+			host := strings.SplitN(p, "->", 2)[0]
+			a := Address{Component: s.Name, Address: ip + ":" + host}
+			switch s.Name {
+			case Gitbase.ShortName():
+				// The password is never shown.
+				user := s.user
+				if user == "" {
+					user = DefaultGitbaseUser
+				}
+				a.Description = "gitbase DSN"
+				a.Address = fmt.Sprintf("%s@tcp(%s:%s)/gitbase", user, ip, host)
+			case GitbaseWeb.ShortName(), BblfshWeb.ShortName():
+				a.Description = "web UI, " + BindDescription(s.hostIP)
+				scheme := "http"
+				if s.tls {
+					scheme = "https"
+				}
+				a.Address = fmt.Sprintf("%s://%s:%s%s", scheme, URLHost(s.hostIP, name), host, s.basePath)
+			case Daemon.ShortName():
+				a.Description = "daemon gRPC"
+			case Bblfshd.ShortName():
+				a.Description = "bblfshd gRPC"
+			case Pilosa.ShortName():
+				a.Description = "pilosa HTTP"
+				a.Address = fmt.Sprintf("http://%s:%s", ip, host)
+			default:
+				a.Description = s.Name
+			}
+
+			if tunnel {
+				a.Description += fmt.Sprintf(" of %s, tunnel it with ssh -L %s:%s:%s %s",
+					dockerHost, host, s.hostIP, host, dockerHost)
+			}
+			result = append(result, a)
+		}
+	}
+	return result
+}
+
+// Unhealthy returns the names of the components required that are not
+// healthy, in the order of the statuses.
+func Unhealthy(statuses []*Status, required func(name string) bool) []string {
+	var result []string
+	for _, s := range statuses {
+		if required(s.Name) && !s.Healthy() {
+			result = append(result, s.Name)
+		}
+	}
+	return result
+}
+
+// UnmetRequirement is a component running while some of the ones it requires
+// are not.
+type UnmetRequirement struct {
+	Name string
+	// Stopped are the names of the components required not running.
+	Stopped []string
+}
+
+// UnmetRequirements returns the components running while the ones they
+// require are not, in the order of the statuses.
+func UnmetRequirements(statuses []*Status) []UnmetRequirement {
+	state := make(map[string]string, len(statuses))
+	for _, s := range statuses {
+		state[s.Name] = s.State
+	}
+
+	var result []UnmetRequirement
+	for _, s := range statuses {
+		c, ok := ByName(s.Name)
+		if !ok || s.State != StateRunning {
+			continue
+		}
+
+		var stopped []string
+		for _, dep := range c.Requires() {
+			if state[dep.ShortName()] != StateRunning {
+				stopped = append(stopped, dep.ShortName())
+			}
+		}
+
+		if len(stopped) > 0 {
+			result = append(result, UnmetRequirement{s.Name, stopped})
+		}
+	}
+	return result
+}
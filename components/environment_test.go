@@ -0,0 +1,101 @@
+package components
+
+import (
+	"fmt"
+	"testing"
+)
+
+func runningStatus(c Component, ports ...string) *Status {
+	return &Status{Name: c.ShortName(), State: StateRunning, Health: HealthNone, Ports: ports}
+}
+
+func stoppedStatus(c Component) *Status {
+	return &Status{Name: c.ShortName(), State: StateStopped, Health: HealthNone}
+}
+
+func TestAddresses(t *testing.T) {
+	statuses := []*Status{
+		runningStatus(Daemon, "4242->4242/tcp"),
+		runningStatus(Gitbase, "3306->3306/tcp"),
+		runningStatus(GitbaseWeb, "8080->8080/tcp"),
+		stoppedStatus(BblfshWeb),
+	}
+
+	expected := []Address{
+		{"daemon", "daemon gRPC", "127.0.0.1:4242"},
+		{"gitbase", "gitbase DSN", "root@tcp(127.0.0.1:3306)/gitbase"},
+		{GitbaseWeb.ShortName(), "web UI, exposed on every interface", "http://localhost:8080"},
+	}
+
+	got := Addresses(statuses, "", "")
+	if fmt.Sprint(got) != fmt.Sprint(expected) {
+		t.Errorf("expected: %v, got: %v", expected, got)
+	}
+
+	withUser := runningStatus(Gitbase, "3306->3306/tcp")
+	withUser.user = "analyst"
+	expected = []Address{{"gitbase", "gitbase DSN", "analyst@tcp(127.0.0.1:3306)/gitbase"}}
+	got = Addresses([]*Status{withUser}, "", "")
+	if fmt.Sprint(got) != fmt.Sprint(expected) {
+		t.Errorf("expected: %v, got: %v", expected, got)
+	}
+
+	loopback := runningStatus(BblfshWeb, "8081->8080/tcp")
+	loopback.hostIP = "127.0.0.1"
+	exposed := runningStatus(GitbaseWeb, "8080->8080/tcp")
+	exposed.hostIP = "192.168.1.10"
+	exposed.basePath = "/engine/sql"
+	expected = []Address{
+		{BblfshWeb.ShortName(), "web UI, on 127.0.0.1 only", "http://localhost:8081"},
+		{GitbaseWeb.ShortName(), "web UI, exposed on 192.168.1.10", "http://192.168.1.10:8080/engine/sql"},
+	}
+	got = Addresses([]*Status{loopback, exposed}, "", "")
+	if fmt.Sprint(got) != fmt.Sprint(expected) {
+		t.Errorf("expected: %v, got: %v", expected, got)
+	}
+
+	expected = []Address{{"daemon", "daemon gRPC", "unix:///home/user/.srcd/run/daemon.sock"}}
+	got = Addresses([]*Status{runningStatus(Daemon)}, "", "/home/user/.srcd/run/daemon.sock")
+	if fmt.Sprint(got) != fmt.Sprint(expected) {
+		t.Errorf("expected: %v, got: %v", expected, got)
+	}
+
+	remoteGitbase := runningStatus(Gitbase, "3306->3306/tcp")
+	remoteGitbase.hostIP = "0.0.0.0"
+	expected = []Address{
+		{"gitbase", "gitbase DSN", "root@tcp(build.example.com:3306)/gitbase"},
+		{BblfshWeb.ShortName(), "web UI, on 127.0.0.1 only of build.example.com, " +
+			"tunnel it with ssh -L 8081:127.0.0.1:8081 build.example.com", "http://localhost:8081"},
+	}
+	got = Addresses([]*Status{remoteGitbase, loopback}, "build.example.com", "")
+	if fmt.Sprint(got) != fmt.Sprint(expected) {
+		t.Errorf("expected: %v, got: %v", expected, got)
+	}
+}
+
+func TestUnmetRequirements(t *testing.T) {
+	testCases := []struct {
+		name     string
+		statuses []*Status
+		expected string
+	}{
+		{"all running", []*Status{
+			runningStatus(Bblfshd), runningStatus(Pilosa), runningStatus(Gitbase), runningStatus(BblfshWeb),
+		}, "[]"},
+		{"stopped", []*Status{
+			stoppedStatus(Bblfshd), runningStatus(Pilosa), runningStatus(Gitbase), runningStatus(BblfshWeb),
+		}, "[{gitbase [bblfshd]} {bblfsh-web [bblfshd]}]"},
+		{"not running", []*Status{
+			stoppedStatus(Bblfshd), stoppedStatus(Gitbase), stoppedStatus(BblfshWeb),
+		}, "[]"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := fmt.Sprint(UnmetRequirements(tc.statuses))
+			if got != tc.expected {
+				t.Errorf("expected: %s, got: %s", tc.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,283 @@
+package components
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	units "github.com/docker/go-units"
+)
+
+// GitbaseReposPath is where the directories with repositories are mounted in
+// gitbase.
+const GitbaseReposPath = "/opt/repos"
+
+// RepoMount is a directory of the host with repositories mounted in gitbase.
+type RepoMount struct {
+	Host      string `json:"host"`
+	Container string `json:"container"`
+}
+
+// RepoMounts returns where the working directory and the other directories
+// with repositories are mounted in gitbase. The working directory alone is
+// mounted at GitbaseReposPath, while with more directories each one is in a
+// subdirectory of it named after the directory. Directories with the same
+// name get a numeric suffix in the order they are given, the first one not
+// taken by any other directory.
+func RepoMounts(workdir string, repos []string) []RepoMount {
+	if len(repos) == 0 {
+		return []RepoMount{{Host: workdir, Container: GitbaseReposPath}}
+	}
+
+	used := make(map[string]bool)
+	var mounts []RepoMount
+	for _, dir := range append([]string{workdir}, repos...) {
+		// The paths are the ones of the host, which can be a Windows one.
+		sep := "/"
+		if !strings.HasPrefix(dir, "/") {
+			sep = "\\"
+		}
+
+		parts := strings.Split(strings.TrimRight(dir, sep), sep)
+		name := parts[len(parts)-1]
+		if name == "" || strings.HasSuffix(name, ":") {
+			name = "root"
+		}
+
+		unique := name
+		for n := 2; used[unique]; n++ {
+			unique = fmt.Sprintf("%s-%d", name, n)
+		}
+		used[unique] = true
+
+		mounts = append(mounts, RepoMount{Host: dir, Container: GitbaseReposPath + "/" + unique})
+	}
+	return mounts
+}
+
+// Variables of the environment of gitbase set from its settings.
+const (
+	// GitbaseSquashEnv enables the squashed tables, which run the joins of
+	// the tables of gitbase in gitbase itself instead of in the SQL engine.
+	GitbaseSquashEnv = "GITBASE_UNSTABLE_SQUASH_ENABLE"
+	// GitbaseCacheSizeEnv is the size of the cache of git objects in MB.
+	GitbaseCacheSizeEnv = "GITBASE_CACHESIZE_MB"
+	// GitbaseMaxMemoryEnv is the memory the joins can use in MB before
+	// they are spilled to disk.
+	GitbaseMaxMemoryEnv = "MAX_MEMORY"
+	// GitbaseConnTimeoutEnv is how long the connections can be idle in
+	// seconds.
+	GitbaseConnTimeoutEnv = "GITBASE_CONNTIMEOUT"
+	// GitbaseQueryTimeoutEnv is how long every query can run in seconds.
+	GitbaseQueryTimeoutEnv = "GITBASE_QUERY_TIMEOUT"
+	// GitbaseMaxConnectionsEnv is the maximum number of connections open at
+	// once.
+	GitbaseMaxConnectionsEnv = "GITBASE_MAX_CONNECTIONS"
+	// GitbaseParallelismEnv is the number of repositories read at once
+	// when scanning them and by every query.
+	GitbaseParallelismEnv = "GITBASE_PARALLELISM"
+	// GitbaseMetricsPortEnv is the port of the container gitbase serves its
+	// metrics on, not served if it's not set.
+	GitbaseMetricsPortEnv = "GITBASE_METRICS_PORT"
+	// GitbaseLogLevelEnv is the level of the logs, info if it's not set.
+	GitbaseLogLevelEnv = "GITBASE_LOG_LEVEL"
+	// GitbaseUserEnv and GitbasePasswordEnv are the credentials the clients
+	// connect with.
+	GitbaseUserEnv     = "GITBASE_USER"
+	GitbasePasswordEnv = "GITBASE_PASSWORD"
+)
+
+// DefaultGitbaseUser is the user the clients of gitbase connect with when
+// none is chosen, which has no password.
+const DefaultGitbaseUser = "root"
+
+// GitbaseLogLevels are the levels of the logs of gitbase, from the least
+// detailed.
+var GitbaseLogLevels = []string{"error", "warn", "info", "debug", "trace"}
+
+// DefaultGitbaseLogLevel is the level of the logs of gitbase when none is
+// chosen.
+const DefaultGitbaseLogLevel = "info"
+
+// GitbaseSettings are the settings of gitbase, given in the variables of its
+// environment. Zero values are the defaults of gitbase.
+type GitbaseSettings struct {
+	// Squash enables the squashed tables. Gitbase has them off by default.
+	Squash bool
+	// CacheSize is the size of the cache of git objects in bytes.
+	CacheSize int64
+	// MaxMemory is the memory the joins can use in bytes.
+	MaxMemory int64
+	// ConnTimeout is how long the connections can be idle.
+	ConnTimeout time.Duration
+	// QueryTimeout is how long every query can run before gitbase cancels
+	// it.
+	QueryTimeout time.Duration
+	// MaxConnections is the maximum number of connections open at once.
+	MaxConnections int
+	// Parallelism is the number of repositories read at once.
+	Parallelism int
+	// Metrics serves the metrics of gitbase on GitbaseMetricsPort.
+	Metrics bool
+	// LogLevel is the level of the logs, one of GitbaseLogLevels.
+	LogLevel string
+}
+
+// Env returns the variables of the environment of gitbase with the settings.
+// The sizes are rounded down to MB and the timeout to seconds, as gitbase
+// reads them.
+func (s GitbaseSettings) Env() []string {
+	env := []string{fmt.Sprintf("%s=%t", GitbaseSquashEnv, s.Squash)}
+	if s.CacheSize > 0 {
+		env = append(env, fmt.Sprintf("%s=%d", GitbaseCacheSizeEnv, s.CacheSize/units.MiB))
+	}
+	if s.MaxMemory > 0 {
+		env = append(env, fmt.Sprintf("%s=%d", GitbaseMaxMemoryEnv, s.MaxMemory/units.MiB))
+	}
+	if s.ConnTimeout > 0 {
+		env = append(env, fmt.Sprintf("%s=%d", GitbaseConnTimeoutEnv, int64(s.ConnTimeout/time.Second)))
+	}
+	if s.QueryTimeout > 0 {
+		env = append(env, fmt.Sprintf("%s=%d", GitbaseQueryTimeoutEnv, int64(s.QueryTimeout/time.Second)))
+	}
+	if s.MaxConnections > 0 {
+		env = append(env, fmt.Sprintf("%s=%d", GitbaseMaxConnectionsEnv, s.MaxConnections))
+	}
+	if s.Parallelism > 0 {
+		env = append(env, fmt.Sprintf("%s=%d", GitbaseParallelismEnv, s.Parallelism))
+	}
+	if s.Metrics {
+		env = append(env, fmt.Sprintf("%s=%d", GitbaseMetricsPortEnv, GitbaseMetricsPort))
+	}
+	if s.LogLevel != "" {
+		env = append(env, fmt.Sprintf("%s=%s", GitbaseLogLevelEnv, s.LogLevel))
+	}
+	return env
+}
+
+// ParseGitbaseEnv returns the settings of a gitbase container from the
+// variables of its environment. The invalid ones are left as the defaults,
+// as gitbase does.
+func ParseGitbaseEnv(env []string) GitbaseSettings {
+	var s GitbaseSettings
+	for _, e := range env {
+		kv := strings.SplitN(e, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+
+		n, _ := strconv.ParseInt(kv[1], 10, 64)
+		switch kv[0] {
+		case GitbaseSquashEnv:
+			s.Squash, _ = strconv.ParseBool(kv[1])
+		case GitbaseCacheSizeEnv:
+			s.CacheSize = n * units.MiB
+		case GitbaseMaxMemoryEnv:
+			s.MaxMemory = n * units.MiB
+		case GitbaseConnTimeoutEnv:
+			s.ConnTimeout = time.Duration(n) * time.Second
+		case GitbaseQueryTimeoutEnv:
+			s.QueryTimeout = time.Duration(n) * time.Second
+		case GitbaseMaxConnectionsEnv:
+			s.MaxConnections = int(n)
+		case GitbaseParallelismEnv:
+			s.Parallelism = int(n)
+		case GitbaseMetricsPortEnv:
+			s.Metrics = n > 0
+		case GitbaseLogLevelEnv:
+			s.LogLevel = kv[1]
+		}
+	}
+	return s
+}
+
+// Map returns the settings as shown to people, like squash: off or
+// cache-size: 512MiB, with default for the ones not set.
+func (s GitbaseSettings) Map() map[string]string {
+	size := func(n int64) string {
+		if n <= 0 {
+			return "default"
+		}
+		return units.BytesSize(float64(n))
+	}
+
+	timeout := func(d time.Duration) string {
+		if d <= 0 {
+			return "default"
+		}
+		return ShortDuration(d)
+	}
+
+	number := func(n int) string {
+		if n <= 0 {
+			return "default"
+		}
+		return strconv.Itoa(n)
+	}
+
+	logLevel := "default"
+	if s.LogLevel != "" {
+		logLevel = s.LogLevel
+	}
+
+	return map[string]string{
+		"squash":          OnOff(s.Squash),
+		"cache-size":      size(s.CacheSize),
+		"max-memory":      size(s.MaxMemory),
+		"conn-timeout":    timeout(s.ConnTimeout),
+		"query-timeout":   timeout(s.QueryTimeout),
+		"max-connections": number(s.MaxConnections),
+		"parallelism":     number(s.Parallelism),
+		"metrics":         OnOff(s.Metrics),
+		"log-level":       logLevel,
+	}
+}
+
+// OnOff returns on or off for the settings shown to people, like the squashed
+// tables of gitbase.
+func OnOff(on bool) string {
+	if on {
+		return "on"
+	}
+	return "off"
+}
+
+// ShortDuration returns the duration shown to people, without the zero
+// minutes and seconds, like 10m instead of 10m0s.
+func ShortDuration(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
+
+// WorkdirMode returns how the working directory is mounted in gitbase, as
+// shown to people: read-only, the default, or writable.
+func WorkdirMode(writable bool) string {
+	if writable {
+		return "writable"
+	}
+	return "read-only"
+}
+
+// GitbaseContainerSettings returns the settings of the gitbase container
+// with the given details: the ones of its environment, and workdir-mount with
+// how the directories with repositories are mounted.
+func GitbaseContainerSettings(info *types.ContainerJSON) map[string]string {
+	var writable bool
+	for _, m := range info.Mounts {
+		if m.Destination == GitbaseReposPath || strings.HasPrefix(m.Destination, GitbaseReposPath+"/") {
+			writable = writable || m.RW
+		}
+	}
+
+	settings := ParseGitbaseEnv(info.Config.Env).Map()
+	settings["workdir-mount"] = WorkdirMode(writable)
+	return settings
+}
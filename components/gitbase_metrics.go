@@ -0,0 +1,141 @@
+package components
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+)
+
+// GitbaseMetricsPort is the port of the container of gitbase its metrics are
+// served on, in the text format of Prometheus, when they are enabled.
+const GitbaseMetricsPort = 2112
+
+// Metrics exported by gitbase that are scraped.
+const (
+	gitbaseActiveQueriesMetric = "gitbase_queries_active"
+	gitbaseSlowQueriesMetric   = "gitbase_queries_slow_total"
+	gitbaseCacheHitsMetric     = "gitbase_cache_hits_total"
+	gitbaseCacheMissesMetric   = "gitbase_cache_misses_total"
+)
+
+// GitbaseMetrics are the metrics of gitbase used to troubleshoot how fast
+// the queries are.
+type GitbaseMetrics struct {
+	ActiveQueries int64 `json:"active_queries"`
+	SlowQueries   int64 `json:"slow_queries"`
+	// CacheHitRatio is the fraction of the git objects read from the cache,
+	// nil until the cache is used.
+	CacheHitRatio *float64 `json:"cache_hit_ratio"`
+}
+
+// GitbaseMetricsAddress returns the address of the host the metrics of the
+// gitbase container with the given details are published on, or false if
+// they are not enabled.
+func GitbaseMetricsAddress(info *types.ContainerJSON) (string, bool) {
+	if !ParseGitbaseEnv(info.Config.Env).Metrics {
+		return "", false
+	}
+	return hostAddress(info, GitbaseMetricsPort, "")
+}
+
+// hostAddress returns the address of the host the given port of the
+// container with the given details is published on, or false if it's not,
+// reaching the ports published on every interface at dockerHost, or at the
+// loopback if it's empty.
+func hostAddress(info *types.ContainerJSON, private int, dockerHost string) (string, bool) {
+	if info.NetworkSettings == nil {
+		return "", false
+	}
+
+	for port, bindings := range info.NetworkSettings.Ports {
+		if port.Int() != private {
+			continue
+		}
+
+		for _, b := range bindings {
+			ip := b.HostIP
+			if ip == "" || ip == "0.0.0.0" {
+				ip = "127.0.0.1"
+				if dockerHost != "" {
+					ip = dockerHost
+				}
+			}
+			return net.JoinHostPort(ip, b.HostPort), true
+		}
+	}
+	return "", false
+}
+
+// ScrapeGitbaseMetrics gets the metrics of gitbase served on the given
+// address.
+func ScrapeGitbaseMetrics(ctx context.Context, addr string) (*GitbaseMetrics, error) {
+	req, err := http.NewRequest("GET", "http://"+addr+"/metrics", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("could not get the metrics of gitbase: %v", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("could not get the metrics of gitbase: %s", res.Status)
+	}
+	return parseGitbaseMetrics(res.Body)
+}
+
+// parseGitbaseMetrics reads the metrics used from the text format of
+// Prometheus, adding up the series of every metric.
+func parseGitbaseMetrics(r io.Reader) (*GitbaseMetrics, error) {
+	values := make(map[string]float64)
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// The labels can have spaces, the value is after the last brace.
+		name, rest := line, ""
+		if i := strings.IndexAny(line, "{ "); i >= 0 {
+			name, rest = line[:i], line[i:]
+		}
+		if i := strings.LastIndex(rest, "}"); i >= 0 {
+			rest = rest[i+1:]
+		}
+
+		fields := strings.Fields(rest)
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("invalid metric line %q", line)
+		}
+
+		v, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value of metric %s: %v", name, err)
+		}
+		values[name] += v
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	m := &GitbaseMetrics{
+		ActiveQueries: int64(values[gitbaseActiveQueriesMetric]),
+		SlowQueries:   int64(values[gitbaseSlowQueriesMetric]),
+	}
+	hits, misses := values[gitbaseCacheHitsMetric], values[gitbaseCacheMissesMetric]
+	if hits+misses > 0 {
+		ratio := hits / (hits + misses)
+		m.CacheHitRatio = &ratio
+	}
+	return m, nil
+}
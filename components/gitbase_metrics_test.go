@@ -0,0 +1,71 @@
+package components
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/go-connections/nat"
+)
+
+func TestParseGitbaseMetrics(t *testing.T) {
+	text := `# HELP gitbase_queries_active Queries running.
+# TYPE gitbase_queries_active gauge
+gitbase_queries_active 2
+gitbase_queries_slow_total{table="commits"} 3
+gitbase_queries_slow_total{table="files, blobs"} 4
+gitbase_cache_hits_total 90
+gitbase_cache_misses_total 10
+go_goroutines 42
+`
+
+	m, err := parseGitbaseMetrics(strings.NewReader(text))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if m.ActiveQueries != 2 || m.SlowQueries != 7 {
+		t.Errorf("expected: 2 active and 7 slow queries, got: %d and %d", m.ActiveQueries, m.SlowQueries)
+	}
+
+	if m.CacheHitRatio == nil || *m.CacheHitRatio != 0.9 {
+		t.Errorf("expected: 0.9, got: %v", m.CacheHitRatio)
+	}
+
+	m, err = parseGitbaseMetrics(strings.NewReader("gitbase_queries_active 0\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if m.CacheHitRatio != nil {
+		t.Errorf("expected: no cache hit ratio, got: %v", *m.CacheHitRatio)
+	}
+
+	if _, err := parseGitbaseMetrics(strings.NewReader("gitbase_queries_active lots\n")); err == nil {
+		t.Errorf("expected an error for an invalid value")
+	}
+}
+
+func TestGitbaseMetricsAddress(t *testing.T) {
+	info := &types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{},
+		Config:            &container.Config{Env: []string{"GITBASE_METRICS_PORT=2112"}},
+		NetworkSettings: &types.NetworkSettings{NetworkSettingsBase: types.NetworkSettingsBase{
+			Ports: nat.PortMap{
+				"3306/tcp": {{HostIP: "0.0.0.0", HostPort: "3306"}},
+				"2112/tcp": {{HostIP: "127.0.0.1", HostPort: "32768"}},
+			},
+		}},
+	}
+
+	addr, ok := GitbaseMetricsAddress(info)
+	if !ok || addr != "127.0.0.1:32768" {
+		t.Errorf("expected: 127.0.0.1:32768, got: %s %t", addr, ok)
+	}
+
+	info.Config.Env = nil
+	if addr, ok := GitbaseMetricsAddress(info); ok {
+		t.Errorf("expected: disabled metrics, got: %s", addr)
+	}
+}
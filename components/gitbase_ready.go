@@ -0,0 +1,118 @@
+package components
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/go-sql-driver/mysql"
+)
+
+// GitbasePort is the port of the container of gitbase it accepts the
+// connections of the MySQL clients on.
+const GitbasePort = 3306
+
+// GitbaseDSN returns the data source name to connect to gitbase at the given
+// address, with the given credentials.
+func GitbaseDSN(addr, user, password string) string {
+	cfg := mysql.Config{
+		User:                 user,
+		Passwd:               password,
+		Net:                  "tcp",
+		Addr:                 addr,
+		AllowNativePasswords: true,
+		MaxAllowedPacket:     32 * (2 << 10),
+	}
+	return cfg.FormatDSN()
+}
+
+// GitbaseAddress returns the address of the host the port of the gitbase
+// container with the given details is published on, or false if it's not.
+// The port published on every interface is reached at the given docker
+// host, or at the loopback if it's empty.
+func GitbaseAddress(info *types.ContainerJSON, dockerHost string) (string, bool) {
+	return hostAddress(info, GitbasePort, dockerHost)
+}
+
+// ProbeGitbase checks whether gitbase at the given address is ready: it
+// accepts connections and answers SELECT 1 through the MySQL protocol with
+// the given credentials. While it loads the repositories it only does the
+// former.
+func ProbeGitbase(ctx context.Context, addr, user, password string) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return fmt.Errorf("gitbase doesn't accept connections: %v", err)
+	}
+	conn.Close()
+
+	db, err := sql.Open("mysql", GitbaseDSN(addr, user, password))
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var one int
+	if err := db.QueryRowContext(ctx, "SELECT 1").Scan(&one); err != nil {
+		return fmt.Errorf("gitbase doesn't answer queries yet: %v", err)
+	}
+	return nil
+}
+
+// GitbaseProbeInterval is how long WaitForGitbase waits between probes.
+var GitbaseProbeInterval = 500 * time.Millisecond
+
+// WaitForGitbase calls probe until gitbase is ready or ctx is done, calling
+// retry with the error of every probe failing. It returns the last one if
+// ctx is done first.
+func WaitForGitbase(ctx context.Context, probe func(context.Context) error, retry func(error)) error {
+	for {
+		err := probe(ctx)
+		if err == nil {
+			return nil
+		}
+
+		if retry != nil {
+			retry(err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(GitbaseProbeInterval):
+		}
+	}
+}
+
+// gitbaseProgressRegexp matches the lines of the logs of gitbase telling how
+// many repositories it loaded, like scanned 3124/8000 repositories.
+var gitbaseProgressRegexp = regexp.MustCompile(`(\d+)\s*/\s*(\d+) repositor`)
+
+// gitbaseMsgRegexp matches the message of a line of the logs of gitbase.
+var gitbaseMsgRegexp = regexp.MustCompile(`msg="((?:[^"\\]|\\.)*)"`)
+
+// GitbaseStartupProgress returns how far gitbase is loading the repositories
+// from the last line of the given ones of its logs mentioning them, like
+// scanned 3124/8000 repositories, or false if none does.
+func GitbaseStartupProgress(lines []string) (string, bool) {
+	for i := len(lines) - 1; i >= 0; i-- {
+		line := lines[i]
+		if m := gitbaseProgressRegexp.FindStringSubmatch(line); m != nil {
+			return fmt.Sprintf("scanned %s/%s repositories", m[1], m[2]), true
+		}
+
+		if !strings.Contains(line, "repositor") {
+			continue
+		}
+
+		if m := gitbaseMsgRegexp.FindStringSubmatch(line); m != nil {
+			return m[1], true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,96 @@
+package components
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/go-connections/nat"
+)
+
+func TestGitbaseAddress(t *testing.T) {
+	info := &types.ContainerJSON{
+		NetworkSettings: &types.NetworkSettings{NetworkSettingsBase: types.NetworkSettingsBase{
+			Ports: nat.PortMap{"3306/tcp": {{HostIP: "0.0.0.0", HostPort: "3307"}}},
+		}},
+	}
+
+	addr, ok := GitbaseAddress(info, "")
+	if !ok || addr != "127.0.0.1:3307" {
+		t.Errorf("expected: 127.0.0.1:3307, got: %s %t", addr, ok)
+	}
+
+	addr, ok = GitbaseAddress(info, "build.example.com")
+	if !ok || addr != "build.example.com:3307" {
+		t.Errorf("expected: build.example.com:3307, got: %s %t", addr, ok)
+	}
+
+	info.NetworkSettings = nil
+	if addr, ok := GitbaseAddress(info, ""); ok {
+		t.Errorf("expected: no address, got: %s", addr)
+	}
+}
+
+func TestGitbaseStartupProgress(t *testing.T) {
+	testCases := []struct {
+		name     string
+		lines    []string
+		expected string
+	}{
+		{"none", []string{`level=info msg="server started"`}, ""},
+		{
+			"count",
+			[]string{
+				`level=info msg="scanned 100/8000 repositories"`,
+				`level=info msg="scanned 3124/8000 repositories"`,
+				`level=debug msg="cache initialized"`,
+			},
+			"scanned 3124/8000 repositories",
+		},
+		{
+			"message",
+			[]string{`time="2019-01-01T00:00:00Z" level=info msg="loading repositories" path=/opt/repos`},
+			"loading repositories",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, ok := GitbaseStartupProgress(tc.lines)
+			if ok != (tc.expected != "") || got != tc.expected {
+				t.Errorf("expected: %s, got: %s", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestWaitForGitbase(t *testing.T) {
+	defer func(interval time.Duration) { GitbaseProbeInterval = interval }(GitbaseProbeInterval)
+	GitbaseProbeInterval = time.Millisecond
+
+	var probes, retries int
+	probe := func(context.Context) error {
+		probes++
+		if probes < 3 {
+			return errors.New("not ready")
+		}
+		return nil
+	}
+
+	err := WaitForGitbase(context.Background(), probe, func(error) { retries++ })
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if probes != 3 || retries != 2 {
+		t.Errorf("expected: 3 probes and 2 retries, got: %d and %d", probes, retries)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err = WaitForGitbase(ctx, func(context.Context) error { return errors.New("not ready") }, nil)
+	if err == nil || err.Error() != "not ready" {
+		t.Errorf("expected: not ready, got: %v", err)
+	}
+}
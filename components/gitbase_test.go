@@ -0,0 +1,158 @@
+package components
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+)
+
+func TestGitbaseSettingsEnv(t *testing.T) {
+	testCases := []struct {
+		name     string
+		settings GitbaseSettings
+		expected string
+	}{
+		{"defaults", GitbaseSettings{}, "GITBASE_UNSTABLE_SQUASH_ENABLE=false"},
+		{"squash", GitbaseSettings{Squash: true}, "GITBASE_UNSTABLE_SQUASH_ENABLE=true"},
+		{
+			"all",
+			GitbaseSettings{CacheSize: 4 << 30, MaxMemory: 1536 << 20, ConnTimeout: 90 * time.Second,
+				QueryTimeout: 10 * time.Minute, MaxConnections: 20, Parallelism: 8, Metrics: true, LogLevel: "debug"},
+			"GITBASE_UNSTABLE_SQUASH_ENABLE=false GITBASE_CACHESIZE_MB=4096 MAX_MEMORY=1536 GITBASE_CONNTIMEOUT=90 " +
+				"GITBASE_QUERY_TIMEOUT=600 GITBASE_MAX_CONNECTIONS=20 GITBASE_PARALLELISM=8 GITBASE_METRICS_PORT=2112 " +
+				"GITBASE_LOG_LEVEL=debug",
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			env := tt.settings.Env()
+			result := strings.Join(env, " ")
+			if result != tt.expected {
+				t.Errorf("expected: %s, got: %s", tt.expected, result)
+			}
+
+			parsed := ParseGitbaseEnv(append([]string{"PATH=/bin"}, env...))
+			if parsed != tt.settings {
+				t.Errorf("expected: %+v, got: %+v", tt.settings, parsed)
+			}
+		})
+	}
+}
+
+func TestGitbaseSettingsMap(t *testing.T) {
+	m := ParseGitbaseEnv([]string{"GITBASE_CACHESIZE_MB=512", "GITBASE_UNSTABLE_SQUASH_ENABLE=yes", "GITBASE_QUERY_TIMEOUT=600"}).Map()
+	expected := map[string]string{
+		"squash":          "off",
+		"cache-size":      "512MiB",
+		"max-memory":      "default",
+		"conn-timeout":    "default",
+		"query-timeout":   "10m",
+		"max-connections": "default",
+		"parallelism":     "default",
+		"metrics":         "off",
+		"log-level":       "default",
+	}
+
+	for k, v := range expected {
+		if m[k] != v {
+			t.Errorf("expected: %s: %s, got: %s: %s", k, v, k, m[k])
+		}
+	}
+}
+
+func TestShortDuration(t *testing.T) {
+	testCases := []struct {
+		duration time.Duration
+		expected string
+	}{
+		{10 * time.Minute, "10m"},
+		{time.Hour, "1h"},
+		{90 * time.Minute, "1h30m"},
+		{time.Hour + time.Second, "1h0m1s"},
+		{45 * time.Second, "45s"},
+		{0, "0s"},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.expected, func(t *testing.T) {
+			if s := ShortDuration(tt.duration); s != tt.expected {
+				t.Errorf("expected: %s, got: %s", tt.expected, s)
+			}
+		})
+	}
+}
+
+func TestGitbaseContainerSettings(t *testing.T) {
+	testCases := []struct {
+		name     string
+		mounts   []types.MountPoint
+		expected string
+	}{
+		{"read-only", []types.MountPoint{
+			{Destination: "/var/lib/gitbase/index", RW: true},
+			{Destination: "/opt/repos", RW: false},
+		}, "read-only"},
+		{"writable", []types.MountPoint{{Destination: "/opt/repos", RW: true}}, "writable"},
+		{"with repos", []types.MountPoint{
+			{Destination: "/opt/repos/work", RW: true},
+			{Destination: "/opt/repos/other", RW: false},
+		}, "writable"},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			info := &types.ContainerJSON{
+				Config: &container.Config{Env: []string{"GITBASE_UNSTABLE_SQUASH_ENABLE=true"}},
+				Mounts: tt.mounts,
+			}
+
+			settings := GitbaseContainerSettings(info)
+			if settings["workdir-mount"] != tt.expected {
+				t.Errorf("expected: %s, got: %s", tt.expected, settings["workdir-mount"])
+			}
+			if settings["squash"] != "on" {
+				t.Errorf("expected: on, got: %s", settings["squash"])
+			}
+		})
+	}
+}
+
+func TestRepoMounts(t *testing.T) {
+	mounts := RepoMounts("/home/me/work", []string{
+		"/mnt/data/oss/",
+		"/mnt/backup/work",
+		"C:\\\\Repos",
+		"/",
+		"/srv/work-2",
+		"/srv/old/work",
+	})
+
+	expected := []RepoMount{
+		{"/home/me/work", "/opt/repos/work"},
+		{"/mnt/data/oss/", "/opt/repos/oss"},
+		{"/mnt/backup/work", "/opt/repos/work-2"},
+		{"C:\\\\Repos", "/opt/repos/Repos"},
+		{"/", "/opt/repos/root"},
+		{"/srv/work-2", "/opt/repos/work-2-2"},
+		{"/srv/old/work", "/opt/repos/work-3"},
+	}
+
+	if len(mounts) != len(expected) {
+		t.Fatalf("expected %d mounts, got %d", len(expected), len(mounts))
+	}
+
+	for i, m := range mounts {
+		if m != expected[i] {
+			t.Errorf("expected: %v, got: %v", expected[i], m)
+		}
+	}
+
+	mounts = RepoMounts("/home/me/work", nil)
+	if len(mounts) != 1 || mounts[0] != (RepoMount{"/home/me/work", "/opt/repos"}) {
+		t.Errorf("expected: the working directory at /opt/repos, got: %v", mounts)
+	}
+}
@@ -0,0 +1,166 @@
+package components
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"github.com/src-d/engine/docker"
+)
+
+// Image is an image of a component, installed or not. Fields not known are
+// null in JSON, never left out.
+type Image struct {
+	// Component is the short name of the component using the image, nil
+	// for other images of the organizations of the components.
+	Component *string `json:"component"`
+	Image     string  `json:"image"`
+	Tag       string  `json:"tag"`
+	Installed bool    `json:"installed"`
+	// Digest is the one in Docker Hub, nil if the image was not pulled.
+	Digest *string `json:"digest"`
+	// Size and Created are nil if the image is not installed.
+	Size    *int64     `json:"size"`
+	Created *time.Time `json:"created"`
+	// Running is true if a container of the engine is running it.
+	Running bool `json:"running"`
+	// StartedAt is when the container running it was started, nil if
+	// there's none.
+	StartedAt *time.Time `json:"started_at"`
+	// Ports are the ports published by the containers running it, like
+	// 3306->3306/tcp.
+	Ports []string `json:"ports"`
+}
+
+// Uptime returns how long the container running the image has been running,
+// zero if there's none.
+func (i *Image) Uptime() time.Duration {
+	if i.StartedAt == nil {
+		return 0
+	}
+	return time.Since(*i.StartedAt)
+}
+
+// Images returns the images of the components installed, joined with the
+// containers of the engine running them, along with the ones of the
+// components not installed, sorted by image and tag.
+func Images(ctx context.Context) ([]*Image, error) {
+	c, err := client.NewEnvClient()
+	if err != nil {
+		return nil, err
+	}
+
+	imgs, err := c.ImageList(ctx, types.ImageListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("could not list components: %v", err)
+	}
+
+	containers, err := docker.List()
+	if err != nil {
+		return nil, fmt.Errorf("could not list containers: %v", err)
+	}
+
+	var result []*Image
+	installed := make(map[string]bool)
+	for _, img := range imgs {
+		for _, ref := range img.RepoTags {
+			if !isComponentImage(ref) {
+				continue
+			}
+
+			installed[ref] = true
+			i := installedImage(img, ref)
+			for _, cnt := range containers {
+				if cnt.ImageID == img.ID && cnt.State == "running" && isFromEngine(containerName(cnt), cnt.Labels, false) {
+					addContainer(ctx, i, cnt)
+				}
+			}
+			result = append(result, i)
+		}
+	}
+
+	for _, cmp := range append([]Component{Daemon}, All...) {
+		if !installed[cmp.Ref()] {
+			result = append(result, &Image{
+				Component: componentOf(cmp.ImageName()),
+				Image:     cmp.ImageName(),
+				Tag:       cmp.Tag(),
+			})
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Image != result[j].Image {
+			return result[i].Image < result[j].Image
+		}
+		return result[i].Tag < result[j].Tag
+	})
+	return result, nil
+}
+
+func installedImage(img types.ImageSummary, ref string) *Image {
+	image, tag := splitImageID(ref)
+	created := time.Unix(img.Created, 0).UTC()
+	size := img.Size
+	i := &Image{
+		Component: componentOf(image),
+		Image:     image,
+		Tag:       tag,
+		Installed: true,
+		Size:      &size,
+		Created:   &created,
+	}
+
+	for _, d := range img.RepoDigests {
+		if strings.HasPrefix(d, image+"@") {
+			digest := strings.TrimPrefix(d, image+"@")
+			i.Digest = &digest
+		}
+	}
+	return i
+}
+
+// addContainer adds the state of a container running the image.
+func addContainer(ctx context.Context, i *Image, c docker.Container) {
+	i.Running = true
+	for _, p := range c.Ports {
+		if p.PublicPort != 0 {
+			i.Ports = append(i.Ports, fmt.Sprintf("%d->%d/%s", p.PublicPort, p.PrivatePort, p.Type))
+		}
+	}
+	sort.Strings(i.Ports)
+
+	// The list of containers doesn't say when they were started.
+	info, err := docker.Inspect(ctx, c.ID)
+	if err != nil {
+		return
+	}
+
+	started, err := time.Parse(time.RFC3339Nano, info.State.StartedAt)
+	if err == nil && (i.StartedAt == nil || started.Before(*i.StartedAt)) {
+		i.StartedAt = &started
+	}
+}
+
+// componentOf returns the short name of the component using the image, or nil
+// if there's none.
+func componentOf(image string) *string {
+	for _, c := range append([]Component{Daemon}, All...) {
+		if c.Image == image || c.ImageName() == image {
+			name := c.ShortName()
+			return &name
+		}
+	}
+	return nil
+}
+
+func containerName(c docker.Container) string {
+	if len(c.Names) == 0 {
+		return ""
+	}
+	return strings.TrimPrefix(c.Names[0], "/")
+}
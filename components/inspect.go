@@ -0,0 +1,206 @@
+package components
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/src-d/engine/docker"
+)
+
+// Inspection has the details of the image and the container of a component,
+// with everything docker knows about them that's useful to debug it. The
+// values of the environment variables that look like credentials, like the
+// token of the daemon, are redacted.
+type Inspection struct {
+	Name string `json:"name" yaml:"name"`
+	// Image is nil if it's not installed.
+	Image *ImageDetails `json:"image" yaml:"image"`
+	// Container is nil if there's none.
+	Container *ContainerDetails `json:"container" yaml:"container"`
+	// Settings are the ones of the engine the container runs with, like
+	// squash or cache-size for gitbase, empty for the components without
+	// any.
+	Settings map[string]string `json:"settings,omitempty" yaml:"settings,omitempty"`
+}
+
+// ImageDetails are the details of the image of a component.
+type ImageDetails struct {
+	Ref          string            `json:"ref" yaml:"ref"`
+	ID           string            `json:"id" yaml:"id"`
+	Digests      []string          `json:"digests" yaml:"digests"`
+	Created      string            `json:"created" yaml:"created"`
+	Size         int64             `json:"size" yaml:"size"`
+	Architecture string            `json:"architecture" yaml:"architecture"`
+	Os           string            `json:"os" yaml:"os"`
+	Entrypoint   []string          `json:"entrypoint" yaml:"entrypoint"`
+	Cmd          []string          `json:"cmd" yaml:"cmd"`
+	Env          []string          `json:"env" yaml:"env"`
+	Labels       map[string]string `json:"labels" yaml:"labels"`
+}
+
+// ContainerDetails are the details of the container of a component.
+type ContainerDetails struct {
+	ID           string            `json:"id" yaml:"id"`
+	Name         string            `json:"name" yaml:"name"`
+	Image        string            `json:"image" yaml:"image"`
+	ImageID      string            `json:"image_id" yaml:"image_id"`
+	Created      string            `json:"created" yaml:"created"`
+	State        string            `json:"state" yaml:"state"`
+	StartedAt    string            `json:"started_at" yaml:"started_at"`
+	FinishedAt   string            `json:"finished_at" yaml:"finished_at"`
+	ExitCode     int               `json:"exit_code" yaml:"exit_code"`
+	Error        string            `json:"error" yaml:"error"`
+	OOMKilled    bool              `json:"oom_killed" yaml:"oom_killed"`
+	RestartCount int               `json:"restart_count" yaml:"restart_count"`
+	Cmd          []string          `json:"cmd" yaml:"cmd"`
+	Env          []string          `json:"env" yaml:"env"`
+	Labels       map[string]string `json:"labels" yaml:"labels"`
+	Mounts       []MountDetails    `json:"mounts" yaml:"mounts"`
+	Networks     []NetworkDetails  `json:"networks" yaml:"networks"`
+	Ports        []string          `json:"ports" yaml:"ports"`
+	// Health is nil if the container has no health check.
+	Health *HealthDetails `json:"health" yaml:"health"`
+}
+
+// MountDetails is a volume or directory mounted in a container.
+type MountDetails struct {
+	Type        string `json:"type" yaml:"type"`
+	Name        string `json:"name" yaml:"name"`
+	Source      string `json:"source" yaml:"source"`
+	Destination string `json:"destination" yaml:"destination"`
+	RW          bool   `json:"rw" yaml:"rw"`
+}
+
+// NetworkDetails is a network a container is connected to.
+type NetworkDetails struct {
+	Name      string   `json:"name" yaml:"name"`
+	IPAddress string   `json:"ip_address" yaml:"ip_address"`
+	Aliases   []string `json:"aliases" yaml:"aliases"`
+}
+
+// HealthDetails is the state of the health check of a container, with the
+// results of its last runs.
+type HealthDetails struct {
+	Status        string         `json:"status" yaml:"status"`
+	FailingStreak int            `json:"failing_streak" yaml:"failing_streak"`
+	Log           []HealthResult `json:"log" yaml:"log"`
+}
+
+// HealthResult is the result of a run of a health check.
+type HealthResult struct {
+	Start    time.Time `json:"start" yaml:"start"`
+	End      time.Time `json:"end" yaml:"end"`
+	ExitCode int       `json:"exit_code" yaml:"exit_code"`
+	Output   string    `json:"output" yaml:"output"`
+}
+
+// Inspect returns the details of the image and the container of the
+// component. The image is the one of its container, if it exists, or the one
+// it would be created with otherwise.
+func Inspect(ctx context.Context, c Component) (*Inspection, error) {
+	result := &Inspection{Name: c.ShortName()}
+
+	ref := c.Ref()
+	info, err := docker.Inspect(ctx, c.Name)
+	switch {
+	case err == docker.ErrNotFound:
+	case err != nil:
+		return nil, err
+	default:
+		result.Container = containerDetails(info)
+		ref = info.Config.Image
+		switch c.Name {
+		case Gitbase.Name:
+			result.Settings = GitbaseContainerSettings(info)
+		case Pilosa.Name:
+			result.Settings = PilosaContainerSettings(info)
+		}
+	}
+
+	img, err := docker.InspectImage(ctx, ref)
+	switch {
+	case err == docker.ErrImageNotFound:
+	case err != nil:
+		return nil, err
+	default:
+		result.Image = &ImageDetails{
+			Ref:          ref,
+			ID:           img.ID,
+			Digests:      img.RepoDigests,
+			Created:      img.Created,
+			Size:         img.Size,
+			Architecture: img.Architecture,
+			Os:           img.Os,
+		}
+
+		if img.Config != nil {
+			result.Image.Entrypoint = img.Config.Entrypoint
+			result.Image.Cmd = img.Config.Cmd
+			result.Image.Env = docker.RedactEnv(img.Config.Env)
+			result.Image.Labels = img.Config.Labels
+		}
+	}
+
+	return result, nil
+}
+
+func containerDetails(info *types.ContainerJSON) *ContainerDetails {
+	d := &ContainerDetails{
+		ID:           info.ID,
+		Name:         info.Name[1:],
+		Image:        info.Config.Image,
+		ImageID:      info.Image,
+		Created:      info.Created,
+		RestartCount: info.RestartCount,
+		Cmd:          info.Config.Cmd,
+		Env:          docker.RedactEnv(info.Config.Env),
+		Labels:       info.Config.Labels,
+	}
+
+	if s := info.State; s != nil {
+		d.State = s.Status
+		d.StartedAt = s.StartedAt
+		d.FinishedAt = s.FinishedAt
+		d.ExitCode = s.ExitCode
+		d.Error = s.Error
+		d.OOMKilled = s.OOMKilled
+
+		if s.Health != nil {
+			d.Health = &HealthDetails{Status: s.Health.Status, FailingStreak: s.Health.FailingStreak}
+			for _, r := range s.Health.Log {
+				d.Health.Log = append(d.Health.Log, HealthResult{
+					Start: r.Start, End: r.End, ExitCode: r.ExitCode, Output: r.Output,
+				})
+			}
+		}
+	}
+
+	for _, m := range info.Mounts {
+		d.Mounts = append(d.Mounts, MountDetails{
+			Type:        string(m.Type),
+			Name:        m.Name,
+			Source:      m.Source,
+			Destination: m.Destination,
+			RW:          m.RW,
+		})
+	}
+
+	if info.NetworkSettings != nil {
+		for name, n := range info.NetworkSettings.Networks {
+			d.Networks = append(d.Networks, NetworkDetails{Name: name, IPAddress: n.IPAddress, Aliases: n.Aliases})
+		}
+		sort.Slice(d.Networks, func(i, j int) bool { return d.Networks[i].Name < d.Networks[j].Name })
+
+		for port, bindings := range info.NetworkSettings.Ports {
+			for _, b := range bindings {
+				d.Ports = append(d.Ports, fmt.Sprintf("%s->%s", b.HostPort, port))
+			}
+		}
+		sort.Strings(d.Ports)
+	}
+
+	return d
+}
@@ -0,0 +1,632 @@
+package components
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/go-connections/nat"
+	units "github.com/docker/go-units"
+)
+
+// Labels of the kubernetes objects exported. K8sInstanceLabel has the name of
+// the container of the component, and selects its pods.
+const (
+	K8sNameLabel     = "app.kubernetes.io/name"
+	K8sInstanceLabel = "app.kubernetes.io/instance"
+	K8sPartOfLabel   = "app.kubernetes.io/part-of"
+	K8sPartOf        = "srcd-engine"
+)
+
+// K8sPasswordKey is the key of the secret with the password of gitbase in
+// the kubernetes manifests exported, named by K8sPasswordSecret.
+const K8sPasswordKey = "password"
+
+// K8sPasswordSecret returns the name of the secret with the password of
+// gitbase in the kubernetes manifests exported, which is not exported.
+func K8sPasswordSecret() string {
+	return Gitbase.Name + "-password"
+}
+
+// K8sOptions are the options of the kubernetes manifests exported.
+type K8sOptions struct {
+	// Namespace of all the objects.
+	Namespace string
+	// StorageClass of the persistent volume claims, the default one of the
+	// cluster if it's empty.
+	StorageClass string
+	// StorageSize is the size requested by every persistent volume claim,
+	// like 10Gi.
+	StorageSize string
+	// Workdir and DataDir are the working and data directories of the
+	// engine. The directories of the host mounted in them are in the
+	// volumes of the repositories and the cache of the components.
+	Workdir string
+	DataDir string
+}
+
+// K8sManifest is a file of the kubernetes manifests exported, with the
+// objects of a component in the order they are applied.
+type K8sManifest struct {
+	Name    string
+	Objects []*K8sObject
+}
+
+// K8sExport is the kubernetes manifests exported.
+type K8sExport struct {
+	Manifests []K8sManifest
+	// Password is whether the password of gitbase is read from the secret
+	// of K8sPasswordSecret, which must be created.
+	Password bool
+	// Warnings are what the manifests don't do like the engine.
+	Warnings []string
+}
+
+// K8sObject is an object of kubernetes. Data is only for the config maps,
+// and Spec is a *K8sServiceSpec, *K8sWorkloadSpec or *K8sClaimSpec.
+type K8sObject struct {
+	APIVersion string            `yaml:"apiVersion,omitempty"`
+	Kind       string            `yaml:"kind,omitempty"`
+	Metadata   K8sMetadata       `yaml:"metadata"`
+	Data       map[string]string `yaml:"data,omitempty"`
+	Spec       interface{}       `yaml:"spec,omitempty"`
+}
+
+// K8sMetadata is the metadata of an object of kubernetes.
+type K8sMetadata struct {
+	Name      string            `yaml:"name,omitempty"`
+	Namespace string            `yaml:"namespace,omitempty"`
+	Labels    map[string]string `yaml:"labels,omitempty"`
+}
+
+// K8sServiceSpec is the spec of a service.
+type K8sServiceSpec struct {
+	ClusterIP string            `yaml:"clusterIP,omitempty"`
+	Selector  map[string]string `yaml:"selector"`
+	Ports     []K8sServicePort  `yaml:"ports"`
+}
+
+// K8sServicePort is a port of a service.
+type K8sServicePort struct {
+	Name       string `yaml:"name"`
+	Port       int    `yaml:"port"`
+	TargetPort int    `yaml:"targetPort"`
+	Protocol   string `yaml:"protocol"`
+}
+
+// K8sWorkloadSpec is the spec of a deployment or a stateful set.
+type K8sWorkloadSpec struct {
+	Replicas             int            `yaml:"replicas"`
+	ServiceName          string         `yaml:"serviceName,omitempty"`
+	Selector             K8sSelector    `yaml:"selector"`
+	Strategy             *K8sStrategy   `yaml:"strategy,omitempty"`
+	Template             K8sPodTemplate `yaml:"template"`
+	VolumeClaimTemplates []*K8sObject   `yaml:"volumeClaimTemplates,omitempty"`
+}
+
+// K8sSelector selects the pods of a workload.
+type K8sSelector struct {
+	MatchLabels map[string]string `yaml:"matchLabels"`
+}
+
+// K8sStrategy is how a deployment replaces its pods.
+type K8sStrategy struct {
+	Type string `yaml:"type"`
+}
+
+// K8sPodTemplate is the template of the pods of a workload.
+type K8sPodTemplate struct {
+	Metadata K8sMetadata `yaml:"metadata"`
+	Spec     K8sPodSpec  `yaml:"spec"`
+}
+
+// K8sPodSpec is the spec of a pod.
+type K8sPodSpec struct {
+	TerminationGracePeriodSeconds int64          `yaml:"terminationGracePeriodSeconds,omitempty"`
+	Containers                    []K8sContainer `yaml:"containers"`
+	Volumes                       []K8sVolume    `yaml:"volumes,omitempty"`
+}
+
+// K8sContainer is a container of a pod.
+type K8sContainer struct {
+	Name            string              `yaml:"name"`
+	Image           string              `yaml:"image"`
+	Command         []string            `yaml:"command,omitempty"`
+	Args            []string            `yaml:"args,omitempty"`
+	EnvFrom         []K8sEnvFrom        `yaml:"envFrom,omitempty"`
+	Env             []K8sEnv            `yaml:"env,omitempty"`
+	Ports           []K8sContainerPort  `yaml:"ports,omitempty"`
+	VolumeMounts    []K8sVolumeMount    `yaml:"volumeMounts,omitempty"`
+	Resources       *K8sResources       `yaml:"resources,omitempty"`
+	ReadinessProbe  *K8sProbe           `yaml:"readinessProbe,omitempty"`
+	SecurityContext *K8sSecurityContext `yaml:"securityContext,omitempty"`
+}
+
+// K8sEnvFrom sets the environment of a container from a config map.
+type K8sEnvFrom struct {
+	ConfigMapRef K8sRef `yaml:"configMapRef"`
+}
+
+// K8sRef is a reference to another object by name.
+type K8sRef struct {
+	Name string `yaml:"name"`
+}
+
+// K8sEnv is a variable of the environment of a container, with its value or
+// read from a secret.
+type K8sEnv struct {
+	Name      string        `yaml:"name"`
+	Value     string        `yaml:"value,omitempty"`
+	ValueFrom *K8sEnvSource `yaml:"valueFrom,omitempty"`
+}
+
+// K8sEnvSource is where the value of a variable is read from.
+type K8sEnvSource struct {
+	SecretKeyRef K8sKeyRef `yaml:"secretKeyRef"`
+}
+
+// K8sKeyRef is a key of a secret.
+type K8sKeyRef struct {
+	Name string `yaml:"name"`
+	Key  string `yaml:"key"`
+}
+
+// K8sContainerPort is a port of a container.
+type K8sContainerPort struct {
+	Name          string `yaml:"name"`
+	ContainerPort int    `yaml:"containerPort"`
+	Protocol      string `yaml:"protocol"`
+}
+
+// K8sVolumeMount is where a volume of the pod is mounted in a container.
+type K8sVolumeMount struct {
+	Name      string `yaml:"name"`
+	MountPath string `yaml:"mountPath"`
+	SubPath   string `yaml:"subPath,omitempty"`
+	ReadOnly  bool   `yaml:"readOnly,omitempty"`
+}
+
+// K8sResources are the resources requested by a container and its limits.
+type K8sResources struct {
+	Requests map[string]string `yaml:"requests,omitempty"`
+	Limits   map[string]string `yaml:"limits,omitempty"`
+}
+
+// K8sProbe is the readiness probe of a container, running a command or
+// connecting to a port.
+type K8sProbe struct {
+	Exec             *K8sExec      `yaml:"exec,omitempty"`
+	TCPSocket        *K8sTCPSocket `yaml:"tcpSocket,omitempty"`
+	PeriodSeconds    int           `yaml:"periodSeconds,omitempty"`
+	TimeoutSeconds   int           `yaml:"timeoutSeconds,omitempty"`
+	FailureThreshold int           `yaml:"failureThreshold,omitempty"`
+}
+
+// K8sExec is the command of a probe.
+type K8sExec struct {
+	Command []string `yaml:"command"`
+}
+
+// K8sTCPSocket is the port of a probe.
+type K8sTCPSocket struct {
+	Port int `yaml:"port"`
+}
+
+// K8sSecurityContext is the security context of a container.
+type K8sSecurityContext struct {
+	Privileged bool `yaml:"privileged"`
+}
+
+// K8sVolume is a volume of a pod, a persistent volume claim or an empty
+// directory.
+type K8sVolume struct {
+	Name                  string       `yaml:"name"`
+	PersistentVolumeClaim *K8sClaimRef `yaml:"persistentVolumeClaim,omitempty"`
+	EmptyDir              *K8sEmptyDir `yaml:"emptyDir,omitempty"`
+}
+
+// K8sClaimRef is the persistent volume claim of a volume.
+type K8sClaimRef struct {
+	ClaimName string `yaml:"claimName"`
+}
+
+// K8sEmptyDir is an empty directory of a pod, in memory with Memory.
+type K8sEmptyDir struct {
+	Medium string `yaml:"medium,omitempty"`
+}
+
+// K8sClaimSpec is the spec of a persistent volume claim.
+type K8sClaimSpec struct {
+	AccessModes      []string     `yaml:"accessModes"`
+	StorageClassName string       `yaml:"storageClassName,omitempty"`
+	Resources        K8sResources `yaml:"resources"`
+}
+
+// ExportK8s returns the kubernetes manifests running the components as their
+// containers do, which must be running: a manifest with the namespace, then
+// one per component in the given order, with its config map, persistent
+// volume claims, service and deployment, or stateful set for pilosa. The
+// password of gitbase is read from a secret, which is not exported.
+func ExportK8s(ctx context.Context, cs []Component, opts K8sOptions) (*K8sExport, error) {
+	e := newK8sExport(opts)
+	for _, c := range cs {
+		info, img, err := inspectRunning(ctx, c)
+		if err != nil {
+			return nil, err
+		}
+		e.add(c, info, img)
+	}
+	return e.result, nil
+}
+
+// k8sExport builds the kubernetes manifests of the components from their
+// containers.
+type k8sExport struct {
+	opts     K8sOptions
+	result   *K8sExport
+	password string
+}
+
+func newK8sExport(opts K8sOptions) *k8sExport {
+	e := &k8sExport{opts: opts, result: &K8sExport{}}
+	e.result.Manifests = append(e.result.Manifests, K8sManifest{
+		Name: "namespace",
+		Objects: []*K8sObject{{
+			APIVersion: "v1",
+			Kind:       "Namespace",
+			Metadata: K8sMetadata{
+				Name:   opts.Namespace,
+				Labels: map[string]string{K8sPartOfLabel: K8sPartOf},
+			},
+		}},
+	})
+	return e
+}
+
+// add adds the manifest of the component with the given container and image.
+// Gitbase must be added before the components using its password.
+func (e *k8sExport) add(c Component, info *types.ContainerJSON, img *types.ImageInspect) {
+	if c.Name == Gitbase.Name {
+		e.password = gitbasePassword(info)
+	}
+
+	labels := map[string]string{
+		K8sNameLabel:     c.ShortName(),
+		K8sInstanceLabel: c.Name,
+		K8sPartOfLabel:   K8sPartOf,
+	}
+	selector := map[string]string{K8sInstanceLabel: c.Name}
+	meta := func(name string) K8sMetadata {
+		return K8sMetadata{Name: name, Namespace: e.opts.Namespace, Labels: labels}
+	}
+
+	ctr := K8sContainer{
+		Name:  c.ShortName(),
+		Image: imageWithDigest(info.Config.Image, img),
+	}
+
+	var imageCmd, imageEntrypoint []string
+	if img.Config != nil {
+		imageCmd, imageEntrypoint = img.Config.Cmd, img.Config.Entrypoint
+	}
+	// The command of kubernetes replaces the entrypoint of the image, and
+	// drops its cmd along with it, as docker does.
+	if !sameStrings(info.Config.Entrypoint, imageEntrypoint) {
+		ctr.Command = escapeAllK8s(info.Config.Entrypoint)
+		ctr.Args = escapeAllK8s(info.Config.Cmd)
+	} else if !sameStrings(info.Config.Cmd, imageCmd) {
+		ctr.Args = escapeAllK8s(info.Config.Cmd)
+	}
+
+	config := make(map[string]string)
+	hidden := e.password != "" && e.hidePassword(ctr.Args)
+	for _, env := range ownEnv(info, img) {
+		kv := strings.SplitN(env, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+
+		switch value := []string{escapeK8s(kv[1])}; {
+		case kv[0] == GitbasePasswordEnv && kv[1] != "":
+			hidden = true
+		case e.password != "" && e.hidePassword(value):
+			hidden = true
+			ctr.Env = append(ctr.Env, K8sEnv{Name: kv[0], Value: value[0]})
+		default:
+			config[kv[0]] = kv[1]
+		}
+	}
+
+	// The variables with the password refer to it, so it comes first.
+	if hidden {
+		e.result.Password = true
+		ctr.Env = append([]K8sEnv{{
+			Name: GitbasePasswordEnv,
+			ValueFrom: &K8sEnvSource{
+				SecretKeyRef: K8sKeyRef{Name: K8sPasswordSecret(), Key: K8sPasswordKey},
+			},
+		}}, ctr.Env...)
+	}
+
+	var objects []*K8sObject
+	if len(config) > 0 {
+		objects = append(objects, &K8sObject{APIVersion: "v1", Kind: "ConfigMap", Metadata: meta(c.Name), Data: config})
+		ctr.EnvFrom = []K8sEnvFrom{{ConfigMapRef: K8sRef{Name: c.Name}}}
+	}
+
+	service := &K8sServiceSpec{Selector: selector}
+	for _, p := range containerPorts(info) {
+		name := fmt.Sprintf("%s-%d", p.Proto(), p.Int())
+		protocol := strings.ToUpper(p.Proto())
+		ctr.Ports = append(ctr.Ports, K8sContainerPort{Name: name, ContainerPort: p.Int(), Protocol: protocol})
+		service.Ports = append(service.Ports, K8sServicePort{Name: name, Port: p.Int(), TargetPort: p.Int(), Protocol: protocol})
+	}
+
+	stateful := c.Name == Pilosa.Name
+	pod := K8sPodSpec{TerminationGracePeriodSeconds: int64(c.GracePeriod() / time.Second)}
+	var claims []*K8sObject
+	claimed := make(map[string]bool)
+	claim := func(name string) {
+		if claimed[name] {
+			return
+		}
+		claimed[name] = true
+
+		claims = append(claims, &K8sObject{
+			APIVersion: "v1",
+			Kind:       "PersistentVolumeClaim",
+			Metadata:   meta(name),
+			Spec:       e.claimSpec(),
+		})
+		volume := K8sVolume{Name: name, PersistentVolumeClaim: &K8sClaimRef{ClaimName: name}}
+		if !stateful {
+			pod.Volumes = append(pod.Volumes, volume)
+		}
+	}
+
+	for _, m := range info.HostConfig.Mounts {
+		vm := K8sVolumeMount{MountPath: m.Target, ReadOnly: m.ReadOnly}
+		switch m.Type {
+		case mount.TypeVolume:
+			vm.Name = m.Source
+		case mount.TypeBind:
+			name, subPath, ok := e.claimOf(c, m.Source)
+			if !ok {
+				e.warn("the directory %s mounted in %s at %s is not in the working or data directory, it's left out",
+					m.Source, c.ShortName(), m.Target)
+				continue
+			}
+			vm.Name, vm.SubPath = name, subPath
+		default:
+			e.warn("the %s mount of %s at %s is left out", m.Type, c.ShortName(), m.Target)
+			continue
+		}
+
+		claim(vm.Name)
+		ctr.VolumeMounts = append(ctr.VolumeMounts, vm)
+	}
+
+	var tmpfs []string
+	for path := range info.HostConfig.Tmpfs {
+		tmpfs = append(tmpfs, path)
+	}
+	sort.Strings(tmpfs)
+	for i, path := range tmpfs {
+		name := fmt.Sprintf("tmpfs-%d", i+1)
+		pod.Volumes = append(pod.Volumes, K8sVolume{Name: name, EmptyDir: &K8sEmptyDir{Medium: "Memory"}})
+		ctr.VolumeMounts = append(ctr.VolumeMounts, K8sVolumeMount{
+			Name:      name,
+			MountPath: path,
+			ReadOnly:  hasOption(info.HostConfig.Tmpfs[path], "ro"),
+		})
+	}
+
+	ctr.Resources = k8sResources(c, info)
+	ctr.ReadinessProbe = k8sProbe(info.Config.Healthcheck, ctr.Ports)
+	if info.HostConfig.Privileged {
+		ctr.SecurityContext = &K8sSecurityContext{Privileged: true}
+	}
+
+	if c.Name == GitbaseWeb.Name || c.Name == BblfshWeb.Name {
+		if info.Config.Labels[WebTLSLabel] != "" || info.Config.Labels[WebAuthLabel] != "" {
+			e.warn("%s is served through its proxy with TLS or a token, which is not exported, "+
+				"so its service serves it without them", c.ShortName())
+		}
+	}
+
+	pod.Containers = []K8sContainer{ctr}
+	workload := &K8sWorkloadSpec{
+		Replicas: 1,
+		Selector: K8sSelector{MatchLabels: selector},
+		Template: K8sPodTemplate{Metadata: K8sMetadata{Labels: labels}, Spec: pod},
+	}
+
+	kind := "Deployment"
+	switch {
+	case stateful:
+		// The service of a stateful set gives its pods their names.
+		kind = "StatefulSet"
+		workload.ServiceName = c.Name
+		service.ClusterIP = "None"
+		for _, cl := range claims {
+			cl.APIVersion, cl.Kind, cl.Metadata.Namespace = "", "", ""
+		}
+		workload.VolumeClaimTemplates = claims
+		claims = nil
+	case len(claims) > 0:
+		// The volumes can only be mounted by a pod at once.
+		workload.Strategy = &K8sStrategy{Type: "Recreate"}
+	}
+
+	objects = append(objects, claims...)
+	if len(service.Ports) > 0 {
+		objects = append(objects, &K8sObject{APIVersion: "v1", Kind: "Service", Metadata: meta(c.Name), Spec: service})
+	}
+	objects = append(objects, &K8sObject{APIVersion: "apps/v1", Kind: kind, Metadata: meta(c.Name), Spec: workload})
+
+	e.result.Manifests = append(e.result.Manifests, K8sManifest{Name: c.ShortName(), Objects: objects})
+}
+
+// hidePassword replaces the password of gitbase in the values, escaped for
+// kubernetes, with a reference to its variable, reporting whether it did.
+func (e *k8sExport) hidePassword(values []string) bool {
+	before := append([]string(nil), values...)
+	hidePassword(values, escapeK8s(e.password), "$("+GitbasePasswordEnv+")")
+	return !sameStrings(before, values)
+}
+
+// claimOf returns the persistent volume claim with the directory of the
+// host, and its path in it: the one of the repositories of the component for
+// the working directory, or the one of its cache for the data directory,
+// whichever is the innermost.
+func (e *k8sExport) claimOf(c Component, path string) (name, subPath string, ok bool) {
+	dirs := []struct{ dir, claim string }{
+		{e.opts.Workdir, c.Name + "-repositories"},
+		{e.opts.DataDir, c.Name + "-cache"},
+	}
+	sort.SliceStable(dirs, func(i, j int) bool { return len(dirs[i].dir) > len(dirs[j].dir) })
+
+	for _, d := range dirs {
+		if d.dir == "" || !within(path, d.dir) {
+			continue
+		}
+
+		rel, _ := filepath.Rel(d.dir, path)
+		if rel == "." {
+			rel = ""
+		}
+		return d.claim, filepath.ToSlash(rel), true
+	}
+	return "", "", false
+}
+
+func (e *k8sExport) claimSpec() *K8sClaimSpec {
+	return &K8sClaimSpec{
+		AccessModes:      []string{"ReadWriteOnce"},
+		StorageClassName: e.opts.StorageClass,
+		Resources:        K8sResources{Requests: map[string]string{"storage": e.opts.StorageSize}},
+	}
+}
+
+func (e *k8sExport) warn(format string, args ...interface{}) {
+	e.result.Warnings = append(e.result.Warnings, fmt.Sprintf(format, args...))
+}
+
+// containerPorts returns the ports the container serves on, exposed or
+// published, sorted.
+func containerPorts(info *types.ContainerJSON) []nat.Port {
+	seen := make(map[nat.Port]bool)
+	for p := range info.Config.ExposedPorts {
+		seen[p] = true
+	}
+	for p := range info.HostConfig.PortBindings {
+		seen[p] = true
+	}
+
+	var ports []nat.Port
+	for p := range seen {
+		ports = append(ports, p)
+	}
+	sort.Slice(ports, func(i, j int) bool {
+		if ports[i].Int() != ports[j].Int() {
+			return ports[i].Int() < ports[j].Int()
+		}
+		return ports[i].Proto() < ports[j].Proto()
+	})
+	return ports
+}
+
+// k8sResources returns the resources of the container: the memory it's
+// limited to, requested too, or for gitbase the memory of its cache and
+// joins, and the CPUs it's limited to.
+func k8sResources(c Component, info *types.ContainerJSON) *K8sResources {
+	r := &K8sResources{Requests: make(map[string]string), Limits: make(map[string]string)}
+	if memory := info.HostConfig.Memory; memory > 0 {
+		r.Requests["memory"] = k8sBytes(memory)
+		r.Limits["memory"] = k8sBytes(memory)
+	} else if c.Name == Gitbase.Name {
+		s := ParseGitbaseEnv(info.Config.Env)
+		if memory := s.CacheSize + s.MaxMemory; memory > 0 {
+			r.Requests["memory"] = k8sBytes(memory)
+		}
+	}
+
+	if cpus := info.HostConfig.NanoCPUs; cpus > 0 {
+		r.Limits["cpu"] = fmt.Sprintf("%dm", cpus/1e6)
+	}
+
+	if len(r.Requests) == 0 && len(r.Limits) == 0 {
+		return nil
+	}
+	return r
+}
+
+// k8sProbe returns the readiness probe running the health check of the
+// container or, if it has none, connecting to its first port. It returns
+// nil for the containers without either.
+func k8sProbe(h *container.HealthConfig, ports []K8sContainerPort) *K8sProbe {
+	if h != nil && len(h.Test) > 0 && h.Test[0] != "NONE" {
+		p := &K8sProbe{
+			PeriodSeconds:    int(h.Interval / time.Second),
+			TimeoutSeconds:   int(h.Timeout / time.Second),
+			FailureThreshold: h.Retries,
+		}
+
+		switch h.Test[0] {
+		case "CMD":
+			p.Exec = &K8sExec{Command: escapeAllK8s(h.Test[1:])}
+		case "CMD-SHELL":
+			p.Exec = &K8sExec{Command: []string{"/bin/sh", "-c", escapeK8s(strings.Join(h.Test[1:], " "))}}
+		}
+
+		if p.Exec != nil {
+			return p
+		}
+	}
+
+	for _, port := range ports {
+		if port.Protocol == "TCP" {
+			return &K8sProbe{TCPSocket: &K8sTCPSocket{Port: port.ContainerPort}}
+		}
+	}
+	return nil
+}
+
+// k8sBytes returns the number of bytes as a quantity of kubernetes, in Mi if
+// it's a whole number of them.
+func k8sBytes(n int64) string {
+	if n%units.MiB == 0 {
+		return fmt.Sprintf("%dMi", n/units.MiB)
+	}
+	return fmt.Sprint(n)
+}
+
+// escapeK8s escapes the references to variables of kubernetes in a value of
+// the command, the arguments or the environment of a container.
+func escapeK8s(v string) string {
+	return strings.Replace(v, "$(", "$$(", -1)
+}
+
+func escapeAllK8s(values []string) []string {
+	var result []string
+	for _, v := range values {
+		result = append(result, escapeK8s(v))
+	}
+	return result
+}
+
+// hasOption reports whether the comma-separated options have the given one.
+func hasOption(options, option string) bool {
+	for _, o := range strings.Split(options, ",") {
+		if o == option {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,203 @@
+package components
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/go-connections/nat"
+)
+
+func TestK8sExport(t *testing.T) {
+	e := newK8sExport(K8sOptions{
+		Namespace:   "srcd",
+		StorageSize: "10Gi",
+		Workdir:     "/home/user/repos",
+		DataDir:     "/home/user/.srcd",
+	})
+
+	e.add(Gitbase, composeContainer(
+		&container.Config{
+			Image:        "srcd/gitbase:v0.24.0",
+			Env:          []string{"PATH=/bin", "GITBASE_PASSWORD=pa$(s)", "MAX_MEMORY=512", "GITBASE_CACHESIZE_MB=256"},
+			Cmd:          []string{"server", "--password=pa$(s)"},
+			ExposedPorts: nat.PortSet{"3306/tcp": {}},
+			Healthcheck: &container.HealthConfig{
+				Test:     []string{"CMD-SHELL", "gitbase ping"},
+				Interval: 5 * time.Second,
+				Retries:  3,
+			},
+		},
+		&container.HostConfig{
+			Mounts: []mount.Mount{
+				{Type: mount.TypeBind, Source: "/home/user/repos", Target: "/opt/repos", ReadOnly: true},
+				{Type: mount.TypeBind, Source: "/home/user/.srcd/gitbase/abc", Target: "/var/lib/gitbase/index"},
+				{Type: mount.TypeBind, Source: "/etc/ssl", Target: "/etc/ssl"},
+			},
+			Tmpfs: map[string]string{"/opt/repos/a/.git": "ro"},
+		},
+	), &types.ImageInspect{Config: &container.Config{Env: []string{"PATH=/bin"}, Cmd: []string{"server"}}})
+
+	e.add(GitbaseWeb, composeContainer(
+		&container.Config{
+			Image:        "srcd/gitbase-web:v0.6.0",
+			Env:          []string{"GITBASEPG_DB_CONNECTION=root:pa$(s)@tcp(srcd-cli-gitbase:3306)/none"},
+			ExposedPorts: nat.PortSet{"8080/tcp": {}},
+			Labels:       map[string]string{WebAuthLabel: "abc"},
+		},
+		&container.HostConfig{},
+	), &types.ImageInspect{})
+
+	e.add(Pilosa, composeContainer(
+		&container.Config{Image: "pilosa/pilosa:v0.9.0", ExposedPorts: nat.PortSet{"10101/tcp": {}}},
+		&container.HostConfig{
+			Mounts:    []mount.Mount{{Type: mount.TypeVolume, Source: PilosaVolume, Target: "/data"}},
+			Resources: container.Resources{Memory: 1024 * 1024 * 1024, NanoCPUs: 500000000},
+		},
+	), &types.ImageInspect{})
+
+	result := e.result
+	var names []string
+	for _, m := range result.Manifests {
+		names = append(names, m.Name)
+	}
+	expectedNames := []string{"namespace", "gitbase", "gitbase-web", "pilosa"}
+	if !reflect.DeepEqual(expectedNames, names) {
+		t.Fatalf("expected: %v, got: %v", expectedNames, names)
+	}
+
+	kinds := func(objects []*K8sObject) []string {
+		var result []string
+		for _, o := range objects {
+			result = append(result, o.Kind+"/"+o.Metadata.Name)
+		}
+		return result
+	}
+
+	gitbase := result.Manifests[1].Objects
+	expectedKinds := []string{
+		"ConfigMap/srcd-cli-gitbase",
+		"PersistentVolumeClaim/srcd-cli-gitbase-repositories",
+		"PersistentVolumeClaim/srcd-cli-gitbase-cache",
+		"Service/srcd-cli-gitbase",
+		"Deployment/srcd-cli-gitbase",
+	}
+	if got := kinds(gitbase); !reflect.DeepEqual(expectedKinds, got) {
+		t.Errorf("expected: %v, got: %v", expectedKinds, got)
+	}
+
+	expectedConfig := map[string]string{"MAX_MEMORY": "512", "GITBASE_CACHESIZE_MB": "256"}
+	if !reflect.DeepEqual(expectedConfig, gitbase[0].Data) {
+		t.Errorf("expected: %v, got: %v", expectedConfig, gitbase[0].Data)
+	}
+
+	deployment := gitbase[4].Spec.(*K8sWorkloadSpec)
+	if deployment.Strategy == nil || deployment.Strategy.Type != "Recreate" {
+		t.Errorf("expected the Recreate strategy, got: %v", deployment.Strategy)
+	}
+
+	c := deployment.Template.Spec.Containers[0]
+	secret := K8sEnv{Name: GitbasePasswordEnv, ValueFrom: &K8sEnvSource{
+		SecretKeyRef: K8sKeyRef{Name: K8sPasswordSecret(), Key: K8sPasswordKey},
+	}}
+	if !reflect.DeepEqual([]K8sEnv{secret}, c.Env) {
+		t.Errorf("expected: %v, got: %v", []K8sEnv{secret}, c.Env)
+	}
+
+	expectedArgs := []string{"server", "--password=$(GITBASE_PASSWORD)"}
+	if !reflect.DeepEqual(expectedArgs, c.Args) {
+		t.Errorf("expected: %v, got: %v", expectedArgs, c.Args)
+	}
+
+	expectedMounts := []K8sVolumeMount{
+		{Name: "srcd-cli-gitbase-repositories", MountPath: "/opt/repos", ReadOnly: true},
+		{Name: "srcd-cli-gitbase-cache", MountPath: "/var/lib/gitbase/index", SubPath: "gitbase/abc"},
+		{Name: "tmpfs-1", MountPath: "/opt/repos/a/.git", ReadOnly: true},
+	}
+	if !reflect.DeepEqual(expectedMounts, c.VolumeMounts) {
+		t.Errorf("expected: %v, got: %v", expectedMounts, c.VolumeMounts)
+	}
+
+	expectedResources := &K8sResources{Requests: map[string]string{"memory": "768Mi"}, Limits: map[string]string{}}
+	if !reflect.DeepEqual(expectedResources, c.Resources) {
+		t.Errorf("expected: %v, got: %v", expectedResources, c.Resources)
+	}
+
+	expectedProbe := &K8sProbe{
+		Exec:             &K8sExec{Command: []string{"/bin/sh", "-c", "gitbase ping"}},
+		PeriodSeconds:    5,
+		FailureThreshold: 3,
+	}
+	if !reflect.DeepEqual(expectedProbe, c.ReadinessProbe) {
+		t.Errorf("expected: %v, got: %v", expectedProbe, c.ReadinessProbe)
+	}
+
+	web := result.Manifests[2].Objects
+	webContainer := web[len(web)-1].Spec.(*K8sWorkloadSpec).Template.Spec.Containers[0]
+	expectedEnv := []K8sEnv{secret, {
+		Name:  "GITBASEPG_DB_CONNECTION",
+		Value: "root:$(GITBASE_PASSWORD)@tcp(srcd-cli-gitbase:3306)/none",
+	}}
+	if !reflect.DeepEqual(expectedEnv, webContainer.Env) {
+		t.Errorf("expected: %v, got: %v", expectedEnv, webContainer.Env)
+	}
+
+	expectedProbe = &K8sProbe{TCPSocket: &K8sTCPSocket{Port: 8080}}
+	if !reflect.DeepEqual(expectedProbe, webContainer.ReadinessProbe) {
+		t.Errorf("expected: %v, got: %v", expectedProbe, webContainer.ReadinessProbe)
+	}
+
+	pilosa := result.Manifests[3].Objects
+	expectedKinds = []string{"Service/srcd-cli-pilosa", "StatefulSet/srcd-cli-pilosa"}
+	if got := kinds(pilosa); !reflect.DeepEqual(expectedKinds, got) {
+		t.Errorf("expected: %v, got: %v", expectedKinds, got)
+	}
+
+	if ip := pilosa[0].Spec.(*K8sServiceSpec).ClusterIP; ip != "None" {
+		t.Errorf("expected: %s, got: %s", "None", ip)
+	}
+
+	set := pilosa[1].Spec.(*K8sWorkloadSpec)
+	if len(set.VolumeClaimTemplates) != 1 || set.VolumeClaimTemplates[0].Metadata.Name != PilosaVolume {
+		t.Errorf("expected a claim template %s, got: %v", PilosaVolume, set.VolumeClaimTemplates)
+	}
+
+	expectedResources = &K8sResources{
+		Requests: map[string]string{"memory": "1024Mi"},
+		Limits:   map[string]string{"memory": "1024Mi", "cpu": "500m"},
+	}
+	if r := set.Template.Spec.Containers[0].Resources; !reflect.DeepEqual(expectedResources, r) {
+		t.Errorf("expected: %v, got: %v", expectedResources, r)
+	}
+
+	if !result.Password {
+		t.Errorf("expected the password to be read from the secret")
+	}
+
+	expectedWarnings := []string{
+		"the directory /etc/ssl mounted in gitbase at /etc/ssl is not in the working or data directory, it's left out",
+		"gitbase-web is served through its proxy with TLS or a token, which is not exported, so its service serves it without them",
+	}
+	if !reflect.DeepEqual(expectedWarnings, result.Warnings) {
+		t.Errorf("expected: %v, got: %v", expectedWarnings, result.Warnings)
+	}
+}
+
+func TestK8sBytes(t *testing.T) {
+	testCases := []struct {
+		n        int64
+		expected string
+	}{
+		{512 * 1024 * 1024, "512Mi"},
+		{1000, "1000"},
+	}
+
+	for _, tc := range testCases {
+		if got := k8sBytes(tc.n); got != tc.expected {
+			t.Errorf("expected: %s, got: %s", tc.expected, got)
+		}
+	}
+}
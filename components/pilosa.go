@@ -0,0 +1,102 @@
+package components
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/go-units"
+)
+
+// PilosaDefaultPort is the port pilosa is served on when none is configured.
+const PilosaDefaultPort = 10101
+
+// Environment variables of the containers telling where pilosa is served.
+const (
+	// PilosaBindEnv is the one of pilosa with the address it listens on.
+	PilosaBindEnv = "PILOSA_BIND"
+	// GitbasePilosaEnv is the one of gitbase with the address of pilosa.
+	GitbasePilosaEnv = "PILOSA_ENDPOINT"
+	// PilosaCacheSizeEnv is the one of pilosa with the size of its caches,
+	// in MiB.
+	PilosaCacheSizeEnv = "PILOSA_CACHE_SIZE"
+)
+
+// PilosaDisabledEndpoint is the address of pilosa gitbase is given when
+// pilosa is disabled. It never resolves, so creating an index fails at once
+// with an error naming it instead of waiting for pilosa.
+const PilosaDisabledEndpoint = "pilosa-disabled.invalid:10101"
+
+// PilosaBind returns the address pilosa listens on in its container with the
+// given port, on every interface so gitbase can reach it through the network
+// of the components.
+func PilosaBind(port int) string {
+	return net.JoinHostPort("0.0.0.0", strconv.Itoa(port))
+}
+
+// PilosaEndpoint returns the address gitbase reaches pilosa served on the
+// given port on, through the network of the components.
+func PilosaEndpoint(port int) string {
+	return net.JoinHostPort(Pilosa.Name, strconv.Itoa(port))
+}
+
+// ParsePilosaExpose returns the address of the host pilosa is published on
+// given --expose-pilosa, like 127.0.0.1 or 0.0.0.0 for every interface.
+// Empty means it's not published.
+func ParsePilosaExpose(value string) (string, error) {
+	return ParseExposeAddress(value)
+}
+
+// ProbePilosa checks pilosa served on the given address answers at its status
+// endpoint, which it only does once it has loaded its indexes.
+func ProbePilosa(ctx context.Context, addr string) error {
+	req, err := http.NewRequest("GET", "http://"+addr+"/status", nil)
+	if err != nil {
+		return err
+	}
+
+	res, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("could not get the status of pilosa: %v", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("could not get the status of pilosa: %s", res.Status)
+	}
+	return nil
+}
+
+// PilosaSettings returns the settings of pilosa with the given memory limit
+// and cache size in bytes, 0 for none and its default, like memory: 2GiB.
+func PilosaSettings(memory, cacheSize int64) map[string]string {
+	settings := map[string]string{"memory": "none", "cache-size": "default"}
+	if memory > 0 {
+		settings["memory"] = units.BytesSize(float64(memory))
+	}
+	if cacheSize > 0 {
+		settings["cache-size"] = units.BytesSize(float64(cacheSize))
+	}
+	return settings
+}
+
+// PilosaContainerSettings returns the settings the container of pilosa with
+// the given details runs with.
+func PilosaContainerSettings(info *types.ContainerJSON) map[string]string {
+	var memory, cacheSize int64
+	if info.ContainerJSONBase != nil && info.HostConfig != nil {
+		memory = info.HostConfig.Memory
+	}
+	for _, kv := range info.Config.Env {
+		if v := strings.TrimPrefix(kv, PilosaCacheSizeEnv+"="); v != kv {
+			if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+				cacheSize = n * units.MiB
+			}
+		}
+	}
+	return PilosaSettings(memory, cacheSize)
+}
@@ -0,0 +1,39 @@
+package components
+
+import (
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+)
+
+func TestPilosaContainerSettings(t *testing.T) {
+	testCases := []struct {
+		name      string
+		memory    int64
+		env       []string
+		memoryExp string
+		cacheExp  string
+	}{
+		{"defaults", 0, nil, "none", "default"},
+		{"limited", 2 << 30, []string{"PILOSA_BIND=0.0.0.0:10101", "PILOSA_CACHE_SIZE=512"}, "2GiB", "512MiB"},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			info := &types.ContainerJSON{
+				ContainerJSONBase: &types.ContainerJSONBase{HostConfig: &container.HostConfig{}},
+				Config:            &container.Config{Env: tt.env},
+			}
+			info.HostConfig.Memory = tt.memory
+
+			settings := PilosaContainerSettings(info)
+			if settings["memory"] != tt.memoryExp {
+				t.Errorf("expected: %s, got: %s", tt.memoryExp, settings["memory"])
+			}
+			if settings["cache-size"] != tt.cacheExp {
+				t.Errorf("expected: %s, got: %s", tt.cacheExp, settings["cache-size"])
+			}
+		})
+	}
+}
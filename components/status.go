@@ -0,0 +1,220 @@
+package components
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/src-d/engine/docker"
+)
+
+// States of the containers of the components.
+const (
+	StateRunning    = "running"
+	StateStopped    = "stopped"
+	StateNotCreated = "not created"
+	// StateDisabled is the one of the components disabled on init, not
+	// running.
+	StateDisabled = "disabled"
+)
+
+// HealthNone is the health of the components without a health check or not
+// running. Otherwise, it's the one reported by docker: healthy, unhealthy or
+// starting.
+const HealthNone = "-"
+
+// statusLogLines is the number of lines of logs in the detail of a status.
+const statusLogLines = 5
+
+// Status describes the state of a component. Fields not known, or not filled,
+// are null in JSON, never left out.
+type Status struct {
+	Name      string `json:"name"`
+	Image     string `json:"image"`
+	Installed bool   `json:"installed"`
+	State     string `json:"state"`
+	// Tag is the one of the image of the container, or the one that would
+	// be used to create it.
+	Tag string `json:"tag"`
+	// Override is the reference of the image replacing the default one of
+	// the component, nil if there's none.
+	Override *string `json:"override"`
+	// PinnedVersion is the version the component is pinned to instead of
+	// its default one, nil if there's none.
+	PinnedVersion *string `json:"pinned_version"`
+	// Platform is the one of the image of the container, like linux/amd64,
+	// nil if it's not created or it was created without it, and Emulated
+	// whether it's not the one of docker, so it runs emulated.
+	Platform *string `json:"platform"`
+	Emulated bool    `json:"emulated"`
+	// StartedAt is nil if the component is not running.
+	StartedAt *time.Time `json:"started_at"`
+	// Ports are the ports published on the host, like 8080->80/tcp.
+	Ports  []string `json:"ports"`
+	Health string   `json:"health"`
+
+	// The rest is only filled in the detail of a status.
+	Mounts       []string `json:"mounts"`
+	Env          []string `json:"env"`
+	RestartCount int      `json:"restart_count"`
+	Logs         []string `json:"logs"`
+
+	// hostIP is the address of the host the ports are published on, empty
+	// if they are not.
+	hostIP string
+	// tls is whether the web client is served over HTTPS by its proxy, whose
+	// ports are the ones of the web client.
+	tls bool
+	// basePath is the one the web client is served under, empty for the
+	// root.
+	basePath string
+	// user is the one the clients of gitbase connect with, empty for the
+	// default one and the other components.
+	user string
+}
+
+// Healthy reports whether the component is running and not reported
+// unhealthy, or still starting, by its health check.
+func (s *Status) Healthy() bool {
+	return s.State == StateRunning && (s.Health == HealthNone || s.Health == types.Healthy)
+}
+
+// Uptime returns how long the component has been running, zero if it's not.
+func (s *Status) Uptime() time.Duration {
+	if s.StartedAt == nil {
+		return 0
+	}
+	return time.Since(*s.StartedAt)
+}
+
+// ignoredEnv are the environment variables of the containers that say nothing
+// about the configuration of the components, left out of their status.
+var ignoredEnv = map[string]bool{
+	"PATH":     true,
+	"HOME":     true,
+	"HOSTNAME": true,
+	"TERM":     true,
+}
+
+// statusEnv returns the environment of a container shown in its status,
+// without the ignored variables and with the secrets, like the password of
+// gitbase or the token of the daemon, redacted.
+func statusEnv(env []string) []string {
+	var result []string
+	for _, e := range docker.RedactEnv(env) {
+		if !ignoredEnv[strings.SplitN(e, "=", 2)[0]] {
+			result = append(result, e)
+		}
+	}
+	return result
+}
+
+// GetStatus returns the status of the component. With detail, the mounts, the
+// environment, the restart count and the last lines of the logs of its
+// container are included.
+func GetStatus(ctx context.Context, c Component, detail bool) (*Status, error) {
+	installed, err := docker.IsInstalled(ctx, c.ImageName(), c.Tag())
+	if err != nil {
+		return nil, fmt.Errorf("could not check if %s is installed: %v", c.ShortName(), err)
+	}
+
+	status := &Status{
+		Name:      c.ShortName(),
+		Image:     c.ImageName(),
+		Installed: installed,
+		State:     StateNotCreated,
+		Tag:       c.Tag(),
+		Health:    HealthNone,
+	}
+
+	if ref, ok := c.Override(); ok {
+		status.Override = &ref
+	}
+	if version, ok := c.PinnedVersion(); ok {
+		status.PinnedVersion = &version
+	}
+
+	info, err := docker.Inspect(ctx, c.Name)
+	if err == docker.ErrNotFound {
+		return status, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	_, status.Tag = splitImageID(info.Config.Image)
+	if p := info.Config.Labels[docker.PlatformLabel]; p != "" {
+		status.Platform = &p
+		if host, err := docker.HostPlatform(ctx); err == nil {
+			status.Emulated = !docker.PlatformOfLabel(p).Runs(host)
+		}
+	}
+	status.State = StateStopped
+	if info.State.Running {
+		status.State = StateRunning
+		if t, err := time.Parse(time.RFC3339Nano, info.State.StartedAt); err == nil {
+			status.StartedAt = &t
+		}
+
+		if info.State.Health != nil {
+			status.Health = info.State.Health.Status
+		}
+	}
+
+	if c.Name == Gitbase.Name {
+		for _, env := range info.Config.Env {
+			if kv := strings.SplitN(env, "=", 2); len(kv) == 2 && kv[0] == GitbaseUserEnv {
+				status.user = kv[1]
+			}
+		}
+	}
+
+	isWeb := c.Name == GitbaseWeb.Name || c.Name == BblfshWeb.Name
+	if isWeb {
+		status.basePath = info.Config.Labels[WebBasePathLabel]
+	}
+
+	ports := info.NetworkSettings.Ports
+	if isWeb && info.Config.Labels[WebTLSLabel] != "" {
+		status.tls = true
+		ports = nil
+		if proxy, err := docker.Inspect(ctx, WebProxyName(c.Name)); err == nil && proxy.State.Running {
+			ports = proxy.NetworkSettings.Ports
+		}
+	}
+
+	for port, bindings := range ports {
+		for _, b := range bindings {
+			status.Ports = append(status.Ports, fmt.Sprintf("%s->%s", b.HostPort, port))
+			status.hostIP = b.HostIP
+		}
+	}
+	sort.Strings(status.Ports)
+
+	if !detail {
+		return status, nil
+	}
+
+	status.RestartCount = info.RestartCount
+	for _, m := range info.Mounts {
+		source := m.Source
+		if m.Name != "" {
+			source = m.Name
+		}
+
+		mode := "ro"
+		if m.RW {
+			mode = "rw"
+		}
+		status.Mounts = append(status.Mounts, fmt.Sprintf("%s:%s:%s", source, m.Destination, mode))
+	}
+
+	status.Env = statusEnv(info.Config.Env)
+	status.Logs, err = docker.Logs(ctx, c.Name, statusLogLines)
+	if err != nil {
+		return nil, err
+	}
+	return status, nil
+}
@@ -0,0 +1,102 @@
+package components
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/src-d/engine/docker"
+)
+
+// Update tells whether there's a newer image of a component published than
+// the one installed.
+type Update struct {
+	Component Component
+	// Local is the digest of the image installed, empty if it's not
+	// installed.
+	Local string
+	// Remote is the digest of the image published, or the one installed
+	// if it's the variant of one of its platforms.
+	Remote string
+}
+
+// Available reports whether the image published is not the one installed.
+// Components not installed have no update, they are installed when needed.
+func (u *Update) Available() bool {
+	return u.Local != "" && u.Local != u.Remote
+}
+
+// MarshalJSON encodes the update with the name, image and tag of the
+// component. Digests not known are null.
+func (u *Update) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Name      string  `json:"name"`
+		Image     string  `json:"image"`
+		Tag       string  `json:"tag"`
+		Pinned    bool    `json:"pinned"`
+		Local     *string `json:"local_digest"`
+		Remote    *string `json:"remote_digest"`
+		Available bool    `json:"available"`
+	}{
+		u.Component.ShortName(), u.Component.ImageName(), u.Component.Tag(), u.Component.Pinned,
+		nullString(u.Local), nullString(u.Remote), u.Available(),
+	})
+}
+
+// CheckUpdates compares the images installed of the given components with the
+// ones published with the same tag.
+func CheckUpdates(ctx context.Context, cmps []Component) ([]*Update, error) {
+	var updates []*Update
+	for _, c := range cmps {
+		local, err := docker.ImageDigest(ctx, c.ImageName(), c.Tag())
+		if err != nil {
+			return nil, err
+		}
+
+		remote, err := docker.RemoteDigest(ctx, c.ImageName(), c.Tag())
+		if err != nil {
+			return nil, fmt.Errorf("could not check updates of %s: %v", c.ShortName(), err)
+		}
+
+		u := &Update{Component: c, Local: local, Remote: remote}
+		if u.Available() {
+			u.Remote = platformDigest(ctx, c, local, remote)
+		}
+		updates = append(updates, u)
+	}
+	return updates, nil
+}
+
+// platformDigest returns the digest installed if it's the one of a platform
+// of the list published, as the images without a variant for the platform of
+// docker are pulled by the digest of the one for docker.FallbackPlatform.
+// Otherwise it returns the digest published.
+func platformDigest(ctx context.Context, c Component, local, remote string) string {
+	m, err := docker.RemoteManifestOf(ctx, c.ImageName(), c.Tag())
+	if err != nil || m.Digest != remote {
+		return remote
+	}
+
+	for _, p := range m.Platforms {
+		if p.Digest == local {
+			return local
+		}
+	}
+	return remote
+}
+
+// Upgrade pulls the image published of the component, calling progress, if
+// not nil, with the bytes downloaded. It returns the id of the image replaced,
+// empty if there was none. Its container is not recreated.
+func Upgrade(ctx context.Context, c Component, progress func(done, total int64)) (string, error) {
+	old, _ := docker.ImageID(ctx, c.Ref())
+	if err := docker.PullWithProgress(ctx, c.ImageName(), c.Tag(), progress); err != nil {
+		return "", err
+	}
+
+	id, err := docker.ImageID(ctx, c.Ref())
+	if err != nil || id == old {
+		return "", err
+	}
+	return old, nil
+}
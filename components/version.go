@@ -0,0 +1,79 @@
+package components
+
+import (
+	"context"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/src-d/engine/docker"
+)
+
+// Version has the versions of the image installed of a component and of the
+// one its container is running, which differ after pulling a newer one.
+type Version struct {
+	Name  string `json:"name"`
+	Image string `json:"image"`
+	// Installed is nil if the image is not installed.
+	Installed *ImageVersion `json:"installed"`
+	// Running is nil if the component is not running.
+	Running *ImageVersion `json:"running"`
+	// PinnedVersion is the version the component is pinned to instead of
+	// its default one, nil if there's none.
+	PinnedVersion *string `json:"pinned_version"`
+}
+
+// ImageVersion is the version of an image, its tag and its digest in Docker
+// Hub, nil if it was not pulled.
+type ImageVersion struct {
+	Tag    string  `json:"tag"`
+	Digest *string `json:"digest"`
+}
+
+// GetVersion returns the versions of the component.
+func GetVersion(ctx context.Context, c Component) (*Version, error) {
+	v := &Version{Name: c.ShortName(), Image: c.ImageName()}
+	if version, ok := c.PinnedVersion(); ok {
+		v.PinnedVersion = &version
+	}
+
+	img, err := docker.InspectImage(ctx, c.Ref())
+	switch {
+	case err == docker.ErrImageNotFound:
+	case err != nil:
+		return nil, err
+	default:
+		v.Installed = imageVersion(img, c.ImageName(), c.Tag())
+	}
+
+	info, err := docker.Inspect(ctx, c.Name)
+	if err == docker.ErrNotFound || (err == nil && !info.State.Running) {
+		return v, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	image, tag := splitImageID(info.Config.Image)
+	img, err = docker.InspectImage(ctx, info.Image)
+	switch {
+	case err == docker.ErrImageNotFound:
+		// The image was removed while the container was running.
+		v.Running = &ImageVersion{Tag: tag}
+	case err != nil:
+		return nil, err
+	default:
+		v.Running = imageVersion(img, image, tag)
+	}
+
+	return v, nil
+}
+
+func imageVersion(img *types.ImageInspect, image, tag string) *ImageVersion {
+	v := &ImageVersion{Tag: tag}
+	for _, d := range img.RepoDigests {
+		if strings.HasPrefix(d, image+"@") {
+			v.Digest = nullString(strings.TrimPrefix(d, image+"@"))
+			break
+		}
+	}
+	return v
+}
@@ -0,0 +1,301 @@
+package components
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+)
+
+// WebPortLabel is the label of the containers of the web clients with the
+// port of the host they were asked to be published on, empty when docker
+// chose it, so they are created again when another one is asked for.
+const WebPortLabel = "srcd.web.port"
+
+// WebBindLabel is the label of the containers of the web clients with the
+// address of the host they are published on. The ones created before they
+// were bound to the loopback by default don't have it.
+const WebBindLabel = "srcd.web.bind"
+
+// WebTLSLabel is the label of the containers of the web clients, and of the
+// proxies in front of them, with the fingerprint of the certificate they are
+// served with over HTTPS, empty or missing when they are served over HTTP.
+// They are created again when it changes, as when TLS is turned on or off.
+const WebTLSLabel = "srcd.web.tls"
+
+// WebAuthLabel is like WebTLSLabel with the fingerprint of the token the
+// requests to the web client must have, empty or missing without one.
+const WebAuthLabel = "srcd.web.auth"
+
+// WebTokenParam is the parameter of the URLs of the web clients with the token
+// the requests must have, kept by the browser in the cookie of the same name
+// after the first visit.
+const WebTokenParam = "srcd_token"
+
+// WebProxyPort is the port of the containers of the proxies of the web
+// clients they serve on.
+const WebProxyPort = 8000
+
+// Environment variables of the containers of the proxies of the web clients
+// with their certificate and key in PEM, and their configuration of nginx.
+const (
+	WebTLSCertEnv     = "SRCD_TLS_CERT"
+	WebTLSKeyEnv      = "SRCD_TLS_KEY"
+	WebProxyConfigEnv = "SRCD_NGINX_CONF"
+)
+
+// WebProxyName returns the name of the container of the proxy in front of the
+// web client with the given name, serving it over HTTPS or checking its
+// token.
+func WebProxyName(name string) string {
+	return name + "-proxy"
+}
+
+// SecretFingerprint returns the fingerprint of the certificate in PEM, or of
+// the token, the web clients are served with, the SHA-256 of it in hex, or
+// an empty string without one, so it can be recorded in a label.
+func SecretFingerprint(secret string) string {
+	if secret == "" {
+		return ""
+	}
+
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// WebProxyConfig returns the configuration of nginx in front of the web client
+// served at the given address of the network of the engine, terminating TLS
+// with the certificate and key written from the environment if withTLS is
+// true, and rejecting the requests without the token, if it's not empty, in
+// WebTokenParam, its cookie or an Authorization header. The responses are
+// streamed, as the web clients can send large results.
+func WebProxyConfig(upstream string, withTLS bool, token string) string {
+	var lines []string
+	listen := fmt.Sprintf("    listen %d;", WebProxyPort)
+	if withTLS {
+		listen = fmt.Sprintf("    listen %d ssl;", WebProxyPort)
+	}
+
+	if token != "" {
+		lines = append(lines,
+			"map $cookie_"+WebTokenParam+" $srcd_cookie_ok {",
+			"    default 0;",
+			`    "`+token+`" 1;`,
+			"}",
+			"map $http_authorization $srcd_header_ok {",
+			"    default $srcd_cookie_ok;",
+			`    "Bearer `+token+`" 1;`,
+			"}",
+			"map $arg_"+WebTokenParam+" $srcd_authorized {",
+			"    default $srcd_header_ok;",
+			`    "`+token+`" 1;`,
+			"}",
+			"map $arg_"+WebTokenParam+" $srcd_set_cookie {",
+			`    default "";`,
+			`    "`+token+`" "`+webTokenCookie(token, withTLS)+`";`,
+			"}",
+		)
+	}
+
+	lines = append(lines, "server {", listen)
+	if withTLS {
+		lines = append(lines,
+			"    ssl_certificate /etc/nginx/cert.pem;",
+			"    ssl_certificate_key /etc/nginx/key.pem;",
+		)
+	}
+
+	lines = append(lines,
+		"    client_max_body_size 0;",
+		"    location / {",
+	)
+	if token != "" {
+		lines = append(lines,
+			"        if ($srcd_authorized = 0) {",
+			"            return 401;",
+			"        }",
+			"        add_header Set-Cookie $srcd_set_cookie;",
+		)
+	}
+
+	scheme := "http"
+	if withTLS {
+		scheme = "https"
+	}
+	lines = append(lines,
+		"        proxy_pass http://"+upstream+";",
+		"        proxy_http_version 1.1;",
+		"        proxy_buffering off;",
+		"        proxy_request_buffering off;",
+		"        proxy_set_header Host $http_host;",
+		"        proxy_set_header X-Forwarded-Proto "+scheme+";",
+		"        proxy_set_header Upgrade $http_upgrade;",
+		"        proxy_set_header Connection $http_connection;",
+		"        proxy_read_timeout 1h;",
+		"    }",
+		"}",
+	)
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// webTokenCookie returns the cookie the browser keeps the token of the web
+// client in, only sent by it to the web client itself.
+func webTokenCookie(token string, secure bool) string {
+	cookie := WebTokenParam + "=" + token + "; Path=/; HttpOnly; SameSite=Strict"
+	if secure {
+		cookie += "; Secure"
+	}
+	return cookie
+}
+
+// WebProxyCmd is the command of the containers of the proxies, writing the
+// files nginx reads from their environment before starting it, the
+// certificate and key only if they are given.
+var WebProxyCmd = []string{"sh", "-c", `if [ -n "$` + WebTLSCertEnv + `" ]; then ` +
+	`printf '%s' "$` + WebTLSCertEnv + `" > /etc/nginx/cert.pem && ` +
+	`printf '%s' "$` + WebTLSKeyEnv + `" > /etc/nginx/key.pem && chmod 600 /etc/nginx/key.pem; fi && ` +
+	`printf '%s' "$` + WebProxyConfigEnv + `" > /etc/nginx/conf.d/default.conf && ` +
+	`exec nginx -g 'daemon off;'`}
+
+// WebBasePathLabel is the label of the containers of the web clients, and of
+// their proxies, with the path they are served under behind a reverse proxy,
+// empty for the root.
+const WebBasePathLabel = "srcd.web.base-path"
+
+// WebBasePath is how a web client is told the path it's served under: in the
+// environment variable Env, honored by the versions of its image since Since.
+type WebBasePath struct {
+	Env   string
+	Since string
+}
+
+// webBasePaths are the ones of the web clients that can be served under a
+// base path, by image. The bblfsh web client has absolute paths to its assets
+// in every version.
+var webBasePaths = map[string]WebBasePath{
+	"srcd/gitbase-web": {Env: "GITBASEPG_BASE_PATH", Since: "v0.7.0"},
+}
+
+// WebBasePath returns how the web client is told the path it's served under
+// behind a reverse proxy, or false if no version of it can be.
+func (c Component) WebBasePath() (WebBasePath, bool) {
+	b, ok := webBasePaths[c.Image]
+	return b, ok
+}
+
+// WebDefaultBind is the address of the host the web clients are published on
+// unless they are exposed, so only this machine reaches them.
+const WebDefaultBind = "127.0.0.1"
+
+// ParseExposeAddress returns the address of the host a component is
+// published on given the value of an --expose flag, like 127.0.0.1 or
+// 0.0.0.0 for every interface. Empty means it's not exposed.
+func ParseExposeAddress(value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+
+	if net.ParseIP(value) == nil {
+		return "", fmt.Errorf("invalid address %q, it must be an IP of the host like 127.0.0.1", value)
+	}
+	return value, nil
+}
+
+// IsLoopback reports whether the address of the host is only reached from
+// this machine.
+func IsLoopback(addr string) bool {
+	ip := net.ParseIP(addr)
+	return ip != nil && ip.IsLoopback()
+}
+
+// URLHost returns the host to reach a port published on the given address
+// of the host, given the host docker runs on: the address itself if it's a
+// specific one, or the host of docker for the loopback and every interface.
+func URLHost(bind, dockerHost string) string {
+	if bind == "" || bind == "0.0.0.0" || bind == "::" || IsLoopback(bind) {
+		return dockerHost
+	}
+	return bind
+}
+
+// BindDescription says who reaches a port published on the given address of
+// the host.
+func BindDescription(bind string) string {
+	switch {
+	case bind == "" || bind == "0.0.0.0" || bind == "::":
+		return "exposed on every interface"
+	case IsLoopback(bind):
+		return "on " + bind + " only"
+	default:
+		return "exposed on " + bind
+	}
+}
+
+// WebPort returns the port of the host the container of a web client was
+// asked to be published on, from its labels, or false if docker chose it.
+func WebPort(c *types.Container) (int, bool) {
+	port, err := strconv.Atoi(c.Labels[WebPortLabel])
+	return port, err == nil && port > 0
+}
+
+// WebURL returns the URL of the web client with the given container, given
+// the host docker runs on, localhost when it's this machine, or the address
+// it's published on when it's a specific one of the host: at the port of its
+// labels, or at the one docker published it on if it chose it, or false if
+// it's not published. It's an https one if it's served with TLS, and it has
+// the base path of the web client, if any.
+func WebURL(c *types.Container, host string) (string, bool) {
+	host = URLHost(c.Labels[WebBindLabel], host)
+	scheme := "http"
+	if c.Labels[WebTLSLabel] != "" {
+		scheme = "https"
+	}
+
+	base := c.Labels[WebBasePathLabel]
+	if port, ok := WebPort(c); ok {
+		return fmt.Sprintf("%s://%s:%d%s", scheme, host, port, base), true
+	}
+
+	for _, p := range c.Ports {
+		if p.PublicPort != 0 {
+			return fmt.Sprintf("%s://%s:%d%s", scheme, host, p.PublicPort, base), true
+		}
+	}
+	return "", false
+}
+
+// webProbeClient checks the web clients served over HTTPS without verifying
+// their certificate, which is usually self-signed, as it only checks they
+// serve their page.
+var webProbeClient = &http.Client{
+	Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	},
+}
+
+// ProbeWebClient checks the web client at the URL serves its page, so the
+// browser isn't opened onto an error while it's starting.
+func ProbeWebClient(ctx context.Context, url string) error {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return err
+	}
+
+	res, err := webProbeClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+
+	if res.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("the web client answered %s", res.Status)
+	}
+	return nil
+}
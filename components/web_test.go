@@ -0,0 +1,47 @@
+package components
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWebProxyConfig(t *testing.T) {
+	testCases := []struct {
+		name    string
+		withTLS bool
+		token   string
+		has     []string
+		hasNot  []string
+	}{
+		{"tls", true, "",
+			[]string{"listen 8000 ssl;", "ssl_certificate /etc/nginx/cert.pem;", "proxy_buffering off;"},
+			[]string{"return 401;"}},
+		{"token", false, "abc",
+			[]string{"listen 8000;", `"abc" 1;`, `"Bearer abc" 1;`, "return 401;", "add_header Set-Cookie $srcd_set_cookie;"},
+			[]string{"ssl_certificate", "; Secure"}},
+		{"both", true, "abc",
+			[]string{"listen 8000 ssl;", "return 401;", "HttpOnly; SameSite=Strict; Secure"},
+			nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			conf := WebProxyConfig("srcd-cli-gitbase-web:8080", tc.withTLS, tc.token)
+			if !strings.Contains(conf, "proxy_pass http://srcd-cli-gitbase-web:8080;") {
+				t.Errorf("expected the address of the web client in:\n%s", conf)
+			}
+
+			for _, s := range tc.has {
+				if !strings.Contains(conf, s) {
+					t.Errorf("expected %q in:\n%s", s, conf)
+				}
+			}
+
+			for _, s := range tc.hasNot {
+				if strings.Contains(conf, s) {
+					t.Errorf("unexpected %q in:\n%s", s, conf)
+				}
+			}
+		})
+	}
+}
@@ -1,10 +1,15 @@
 package docker
 
 import (
+	"archive/tar"
+	"bufio"
 	"context"
+	"encoding/binary"
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"path"
 	"strings"
 	"time"
 
@@ -37,6 +42,83 @@ func Version() (string, error) {
 	return ping.APIVersion, nil
 }
 
+// ServerVersion returns the version of the docker daemon, like 18.09.1,
+// unlike Version that returns the one of its API.
+func ServerVersion() (string, error) {
+	c, err := client.NewEnvClient()
+	if err != nil {
+		return "", errors.Wrap(err, "could not create docker client")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	v, err := c.ServerVersion(ctx)
+	if err != nil {
+		return "", errors.Wrap(err, "could not get docker version")
+	}
+
+	return v.Version, nil
+}
+
+// SecurityOptions returns the security options of the docker daemon, like
+// name=userns when it runs with user namespaces or name=rootless.
+func SecurityOptions() ([]string, error) {
+	c, err := client.NewEnvClient()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create docker client")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	info, err := c.Info(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not get docker info")
+	}
+
+	return info.SecurityOptions, nil
+}
+
+// RootDir returns the directory where the docker daemon keeps the images and
+// volumes, in the virtual machine running it on Docker Desktop.
+func RootDir() (string, error) {
+	c, err := client.NewEnvClient()
+	if err != nil {
+		return "", errors.Wrap(err, "could not create docker client")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	info, err := c.Info(ctx)
+	if err != nil {
+		return "", errors.Wrap(err, "could not get docker info")
+	}
+
+	return info.DockerRootDir, nil
+}
+
+// SystemInfo returns everything the docker daemon reports about itself and
+// the host it runs on, like docker info.
+func SystemInfo() (*types.Info, error) {
+	c, err := client.NewEnvClient()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create docker client")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	logCall("get docker info")
+	info, err := c.Info(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not get docker info")
+	}
+
+	return &info, nil
+}
+
 var ErrNotFound = errors.New("container not found")
 
 type Container = types.Container
@@ -50,6 +132,7 @@ func Info(name string) (*Container, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
 	defer cancel()
 
+	logCall("list containers looking for %s", name)
 	cs, err := c.ContainerList(ctx, types.ContainerListOptions{})
 	if err != nil {
 		return nil, errors.Wrap(err, "could not list containers")
@@ -65,12 +148,31 @@ func Info(name string) (*Container, error) {
 	return nil, ErrNotFound
 }
 
+// Inspect returns the details of the container with the given name, running
+// or not, or ErrNotFound if there's none.
+func Inspect(ctx context.Context, name string) (*types.ContainerJSON, error) {
+	c, err := client.NewEnvClient()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create docker client")
+	}
+
+	logCall("inspect container %s", name)
+	info, err := c.ContainerInspect(ctx, name)
+	if client.IsErrNotFound(err) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "could not inspect container %s", name)
+	}
+	return &info, nil
+}
+
 func List() ([]Container, error) {
 	c, err := client.NewEnvClient()
 	if err != nil {
 		return nil, errors.Wrap(err, "could not create docker client")
 	}
 
+	logCall("list all containers")
 	return c.ContainerList(context.Background(), types.ContainerListOptions{All: true})
 }
 
@@ -96,9 +198,43 @@ func Kill(name string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
 	defer cancel()
 
+	logChange("remove container %s", name)
 	return c.ContainerRemove(ctx, info.ID, types.ContainerRemoveOptions{Force: true})
 }
 
+// Stop stops the running container with the given name and removes it,
+// keeping its volumes. The container is given the grace period to shut down
+// after being asked to, and then it's killed, which is reported by returning
+// killed as true. With no grace period it's killed right away, which is not
+// reported.
+func Stop(ctx context.Context, name string, grace time.Duration) (killed bool, err error) {
+	info, err := Info(name)
+	if err != nil {
+		return false, err
+	}
+
+	c, err := client.NewEnvClient()
+	if err != nil {
+		return false, errors.Wrap(err, "could not create docker client")
+	}
+
+	if grace > 0 {
+		logChange("stop container %s with a grace period of %s", name, grace)
+		if err := c.ContainerKill(ctx, info.ID, "SIGTERM"); err != nil {
+			return false, errors.Wrapf(err, "could not stop %s", name)
+		}
+
+		waitCtx, cancel := context.WithTimeout(ctx, grace)
+		_, err := c.ContainerWait(waitCtx, info.ID)
+		cancel()
+		killed = err != nil
+	}
+
+	logChange("remove container %s, killed: %v", name, killed)
+	err = c.ContainerRemove(ctx, info.ID, types.ContainerRemoveOptions{Force: true})
+	return killed, err
+}
+
 // IsInstalled checks whether an image is installed or not. If version is
 // empty, it will check that any version is installed, otherwise it will check
 // that the given version is installed.
@@ -111,6 +247,7 @@ func IsInstalled(ctx context.Context, image, version string) (bool, error) {
 	ctx, cancel := context.WithTimeout(ctx, time.Second)
 	defer cancel()
 
+	logCall("list images looking for %s:%s", image, version)
 	imgs, err := c.ImageList(ctx, types.ImageListOptions{})
 	if err != nil {
 		return false, errors.Wrap(err, "could not list images")
@@ -129,7 +266,7 @@ func IsInstalled(ctx context.Context, image, version string) (bool, error) {
 		} else {
 			id := image + ":" + version
 			if id == i.RepoTags[0] {
-				return true, nil
+				return installedFor(ctx, c, image, i.ID), nil
 			}
 		}
 	}
@@ -137,8 +274,53 @@ func IsInstalled(ctx context.Context, image, version string) (bool, error) {
 	return false, nil
 }
 
-// Pull an image from docker hub with a specific version.
+// ImageID returns the id of the installed image with the given reference,
+// like srcd/gitbase:latest.
+func ImageID(ctx context.Context, ref string) (string, error) {
+	c, err := client.NewEnvClient()
+	if err != nil {
+		return "", errors.Wrap(err, "could not create docker client")
+	}
+
+	img, _, err := c.ImageInspectWithRaw(ctx, ref)
+	if err != nil {
+		return "", errors.Wrapf(err, "could not inspect image %s", ref)
+	}
+	return img.ID, nil
+}
+
+// ErrImageNotFound is returned when an image is not installed.
+var ErrImageNotFound = errors.New("image not found")
+
+// InspectImage returns the details of the image installed with the given
+// reference, or ErrImageNotFound if it's not installed.
+func InspectImage(ctx context.Context, ref string) (*types.ImageInspect, error) {
+	c, err := client.NewEnvClient()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create docker client")
+	}
+
+	img, _, err := c.ImageInspectWithRaw(ctx, ref)
+	if client.IsErrNotFound(err) {
+		return nil, ErrImageNotFound
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "could not inspect image %s", ref)
+	}
+	return &img, nil
+}
+
+// Pull an image from docker hub, or RegistryMirror, with a specific version.
 func Pull(ctx context.Context, image, version string) error {
+	return PullWithProgress(ctx, image, version, nil)
+}
+
+// OnPull, if not nil, is called after every pull with the reference of the
+// image, how long it took and its error, for the metrics of the daemon.
+var OnPull func(ref string, took time.Duration, err error)
+
+// PullWithProgress pulls an image like Pull, calling progress, if not nil,
+// with the bytes downloaded so far of the layers seen and their total size.
+func PullWithProgress(ctx context.Context, image, version string, progress func(done, total int64)) (err error) {
 	c, err := client.NewEnvClient()
 	if err != nil {
 		return errors.Wrap(err, "could not create docker client")
@@ -148,14 +330,135 @@ func Pull(ctx context.Context, image, version string) error {
 	defer cancel()
 
 	id := image + ":" + version
-	rc, err := c.ImagePull(ctx, id, types.ImagePullOptions{})
+	if OnPull != nil {
+		start := time.Now()
+		defer func() { OnPull(id, time.Since(start), err) }()
+	}
+
+	ref, err := platformRef(ctx, image, version)
+	if err != nil {
+		return err
+	}
+
+	var opts types.ImagePullOptions
+	if isMirrored(image) {
+		opts.RegistryAuth = RegistryAuth
+	}
+
+	logChange("pull image %s", ref)
+	rc, err := c.ImagePull(ctx, ref, opts)
 	if err != nil {
 		return errors.Wrap(err, fmt.Sprintf("could not pull image %q", id))
 	}
+	defer rc.Close()
+
+	// The image pulled by the digest of its platform, or from the mirror, is
+	// given the tag, and the one of the mirror removed, so it's only known
+	// by its name in Docker Hub.
+	if ref != id {
+		defer func() {
+			if err == nil {
+				logChange("tag image %s as %s", ref, id)
+				err = errors.Wrapf(c.ImageTag(ctx, ref, id), "could not tag image %s", id)
+			}
+			if err == nil && !strings.Contains(ref, "@") {
+				logChange("untag image %s", ref)
+				_, err = c.ImageRemove(ctx, ref, types.ImageRemoveOptions{})
+				err = errors.Wrapf(err, "could not untag image %s", ref)
+			}
+		}()
+	}
 
-	io.Copy(ioutil.Discard, rc)
+	if progress == nil {
+		_, err = io.Copy(ioutil.Discard, rc)
+		return err
+	}
 
-	return rc.Close()
+	type layer struct{ done, total int64 }
+	layers := make(map[string]layer)
+	dec := json.NewDecoder(rc)
+	for {
+		var msg struct {
+			ID             string `json:"id"`
+			Status         string `json:"status"`
+			Error          string `json:"error"`
+			ProgressDetail struct {
+				Current int64 `json:"current"`
+				Total   int64 `json:"total"`
+			} `json:"progressDetail"`
+		}
+		if err := dec.Decode(&msg); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return errors.Wrap(err, fmt.Sprintf("could not pull image %q", id))
+		}
+
+		if msg.Error != "" {
+			return fmt.Errorf("could not pull image %q: %s", id, msg.Error)
+		}
+
+		switch msg.Status {
+		case "Downloading":
+			layers[msg.ID] = layer{msg.ProgressDetail.Current, msg.ProgressDetail.Total}
+		case "Download complete":
+			l := layers[msg.ID]
+			layers[msg.ID] = layer{l.total, l.total}
+		default:
+			continue
+		}
+
+		var done, total int64
+		for _, l := range layers {
+			done += l.done
+			total += l.total
+		}
+		progress(done, total)
+	}
+}
+
+// PullDigest pulls the image with the given digest, like sha256:..., from
+// docker hub, or RegistryMirror, and tags it with the version, so the version
+// is that very image even if its tag was moved since.
+func PullDigest(ctx context.Context, image, version, digest string) error {
+	c, err := client.NewEnvClient()
+	if err != nil {
+		return errors.Wrap(err, "could not create docker client")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Minute)
+	defer cancel()
+
+	var opts types.ImagePullOptions
+	if isMirrored(image) {
+		opts.RegistryAuth = RegistryAuth
+	}
+
+	id := image + ":" + version
+	ref := MirrorImage(image) + "@" + digest
+	logChange("pull image %s", ref)
+	rc, err := c.ImagePull(ctx, ref, opts)
+	if err != nil {
+		return errors.Wrapf(err, "could not pull image %q", ref)
+	}
+	defer rc.Close()
+
+	if _, err := io.Copy(ioutil.Discard, rc); err != nil {
+		return errors.Wrapf(err, "could not pull image %q", ref)
+	}
+
+	logChange("tag image %s as %s", ref, id)
+	return errors.Wrapf(c.ImageTag(ctx, ref, id), "could not tag image %s", id)
+}
+
+// RepoDigest returns the digest, like sha256:..., the image installed was
+// pulled by, or an empty string if it was built or loaded.
+func RepoDigest(img *types.ImageInspect) string {
+	for _, d := range img.RepoDigests {
+		if i := strings.LastIndex(d, "@"); i >= 0 {
+			return d[i+1:]
+		}
+	}
+	return ""
 }
 
 // EnsureInstalled checks whether an image is installed or not. If version is
@@ -204,7 +507,23 @@ func WithSharedDirectory(hostPath, containerPath string) ConfigOption {
 	return withVolume(mount.TypeBind, hostPath, containerPath)
 }
 
+// WithReadOnlySharedDirectory shares a directory of the host that can't be
+// written from the container.
+func WithReadOnlySharedDirectory(hostPath, containerPath string) ConfigOption {
+	return withMount(mount.TypeBind, hostPath, containerPath, true)
+}
+
+// WithReadOnlyVolume mounts the volume with the given name so that it can't
+// be written from the container.
+func WithReadOnlyVolume(name, containerPath string) ConfigOption {
+	return withMount(mount.TypeVolume, name, containerPath, true)
+}
+
 func withVolume(typ mount.Type, hostPath, containerPath string) ConfigOption {
+	return withMount(typ, hostPath, containerPath, false)
+}
+
+func withMount(typ mount.Type, hostPath, containerPath string, readOnly bool) ConfigOption {
 	return func(cfg *container.Config, hc *container.HostConfig) {
 		if cfg.Volumes == nil {
 			cfg.Volumes = make(map[string]struct{})
@@ -213,14 +532,44 @@ func withVolume(typ mount.Type, hostPath, containerPath string) ConfigOption {
 		cfg.Volumes[hostPath] = struct{}{}
 
 		hc.Mounts = append(hc.Mounts, mount.Mount{
-			Type:   typ,
-			Source: hostPath,
-			Target: containerPath,
+			Type:     typ,
+			Source:   hostPath,
+			Target:   containerPath,
+			ReadOnly: readOnly,
 		})
 	}
 }
 
+// WithTmpfs mounts an empty temporary file system at the path of the
+// container, hiding what's there, like a directory of a shared directory.
+func WithTmpfs(containerPath string) ConfigOption {
+	return func(cfg *container.Config, hc *container.HostConfig) {
+		if hc.Tmpfs == nil {
+			hc.Tmpfs = make(map[string]string)
+		}
+		hc.Tmpfs[containerPath] = "ro"
+	}
+}
+
+// WithPort publishes the private port of the container on the public port of
+// the host, or on one chosen by docker if it's not positive.
 func WithPort(publicPort, privatePort int) ConfigOption {
+	return withPort("", publicPort, privatePort)
+}
+
+// WithLoopbackPort is like WithPort, publishing the port on the loopback
+// interface of the host only, so it can't be reached from other hosts.
+func WithLoopbackPort(publicPort, privatePort int) ConfigOption {
+	return withPort("127.0.0.1", publicPort, privatePort)
+}
+
+// WithHostPort is like WithPort, publishing the port on the interface of the
+// host with the given IP only, every one of them with 0.0.0.0.
+func WithHostPort(hostIP string, publicPort, privatePort int) ConfigOption {
+	return withPort(hostIP, publicPort, privatePort)
+}
+
+func withPort(hostIP string, publicPort, privatePort int) ConfigOption {
 	return func(cfg *container.Config, hc *container.HostConfig) {
 		if cfg.ExposedPorts == nil {
 			cfg.ExposedPorts = make(nat.PortSet)
@@ -230,15 +579,49 @@ func WithPort(publicPort, privatePort int) ConfigOption {
 			hc.PortBindings = make(nat.PortMap)
 		}
 
+		var public string
+		if publicPort > 0 {
+			public = fmt.Sprint(publicPort)
+		}
+
 		port := nat.Port(fmt.Sprint(privatePort))
 		cfg.ExposedPorts[port] = struct{}{}
 		hc.PortBindings[port] = append(
 			hc.PortBindings[port],
-			nat.PortBinding{HostPort: fmt.Sprint(publicPort)},
+			nat.PortBinding{HostIP: hostIP, HostPort: public},
 		)
 	}
 }
 
+// WithLabel adds the label to the container.
+func WithLabel(key, value string) ConfigOption {
+	return func(cfg *container.Config, hc *container.HostConfig) {
+		if cfg.Labels == nil {
+			cfg.Labels = make(map[string]string)
+		}
+		cfg.Labels[key] = value
+	}
+}
+
+// WithRestartPolicy makes docker start the container again when it exits
+// with an error, up to maxRetries times in a row.
+func WithRestartPolicy(maxRetries int) ConfigOption {
+	return func(cfg *container.Config, hc *container.HostConfig) {
+		hc.RestartPolicy = container.RestartPolicy{
+			Name:              "on-failure",
+			MaximumRetryCount: maxRetries,
+		}
+	}
+}
+
+// WithMemoryLimit limits the memory of the container to the given number of
+// bytes. A limit of 0 means no limit.
+func WithMemoryLimit(bytes int64) ConfigOption {
+	return func(cfg *container.Config, hc *container.HostConfig) {
+		hc.Memory = bytes
+	}
+}
+
 // WithCmd appends arguments to the cmd arguments.
 func WithCmd(args ...string) ConfigOption {
 	return func(cfg *container.Config, hc *container.HostConfig) {
@@ -273,11 +656,22 @@ func Start(ctx context.Context, config *container.Config, host *container.HostCo
 		return errors.Wrap(err, "could not create docker client")
 	}
 
+	platform, err := checkImagePlatform(ctx, c, config.Image)
+	if err != nil {
+		return err
+	}
+
+	config.Labels = withEnvironmentLabel(config.Labels)
+	if platform != "" {
+		config.Labels[PlatformLabel] = platform
+	}
+	logChange(createSpec(name, config, host))
 	res, err := c.ContainerCreate(ctx, config, host, &network.NetworkingConfig{}, name)
 	if err != nil {
 		return errors.Wrapf(err, "could not create container %s", name)
 	}
 
+	logChange("start container %s with id %s", name, res.ID)
 	if err := c.ContainerStart(ctx, res.ID, types.ContainerStartOptions{}); err != nil {
 		if err := c.ContainerRemove(ctx, res.ID, types.ContainerRemoveOptions{Force: true}); err != nil {
 			logrus.Errorf("could not remove container after failing to create it")
@@ -292,7 +686,48 @@ func Start(ctx context.Context, config *container.Config, host *container.HostCo
 	return errors.Wrapf(err, "could not connect to network")
 }
 
-func CreateVolume(ctx context.Context, name string) error {
+// RemoveContainer removes the container with the given name, running or not.
+func RemoveContainer(ctx context.Context, name string) error {
+	c, err := client.NewEnvClient()
+	if err != nil {
+		return errors.Wrap(err, "could not create docker client")
+	}
+
+	logChange("remove container %s", name)
+	return c.ContainerRemove(ctx, name, types.ContainerRemoveOptions{Force: true})
+}
+
+// StartStopped starts again the existing container with the given name, as
+// it was created, after it stopped.
+func StartStopped(ctx context.Context, name string) error {
+	c, err := client.NewEnvClient()
+	if err != nil {
+		return errors.Wrap(err, "could not create docker client")
+	}
+
+	logChange("start stopped container %s", name)
+	if err := c.ContainerStart(ctx, name, types.ContainerStartOptions{}); err != nil {
+		return errors.Wrapf(err, "could not start container %s", name)
+	}
+	return nil
+}
+
+// DiskUsage returns the containers, volumes and images with the disk space
+// they use.
+func DiskUsage(ctx context.Context) (types.DiskUsage, error) {
+	c, err := client.NewEnvClient()
+	if err != nil {
+		return types.DiskUsage{}, errors.Wrap(err, "could not create docker client")
+	}
+
+	usage, err := c.DiskUsage(ctx)
+	return usage, errors.Wrap(err, "could not get disk usage")
+}
+
+// CreateVolume creates the volume with the given name and labels if it
+// doesn't exist. If a device is given, the volume is a bind mount of that
+// directory of the host, so its content is kept there.
+func CreateVolume(ctx context.Context, name, device string, labels map[string]string) error {
 	c, err := client.NewEnvClient()
 	if err != nil {
 		return errors.Wrap(err, "could not create docker client")
@@ -303,10 +738,49 @@ func CreateVolume(ctx context.Context, name string) error {
 		return nil
 	}
 
-	_, err = c.VolumeCreate(ctx, volume.VolumesCreateBody{Name: name})
+	body := volume.VolumesCreateBody{Name: name, Labels: withEnvironmentLabel(labels)}
+	if device != "" {
+		body.Driver = "local"
+		body.DriverOpts = map[string]string{
+			"type":   "none",
+			"o":      "bind",
+			"device": device,
+		}
+	}
+
+	logChange("create volume %s bound to %q", name, device)
+	_, err = c.VolumeCreate(ctx, body)
 	return err
 }
 
+// VolumeDevice returns the directory of the host the volume is bound to, or
+// an empty string if it's a regular volume. It returns ErrNotFound if the
+// volume doesn't exist.
+func VolumeDevice(ctx context.Context, name string) (string, error) {
+	c, err := client.NewEnvClient()
+	if err != nil {
+		return "", errors.Wrap(err, "could not create docker client")
+	}
+
+	v, err := c.VolumeInspect(ctx, name)
+	if client.IsErrNotFound(err) {
+		return "", ErrNotFound
+	} else if err != nil {
+		return "", errors.Wrapf(err, "could not inspect volume %s", name)
+	}
+
+	return BindDevice(&v), nil
+}
+
+// BindDevice returns the directory of the host the volume is bound to, or an
+// empty string if it's a regular volume.
+func BindDevice(v *Volume) string {
+	if v.Options["o"] != "bind" {
+		return ""
+	}
+	return v.Options["device"]
+}
+
 type Volume = types.Volume
 
 func ListVolumes(ctx context.Context) ([]*Volume, error) {
@@ -329,6 +803,7 @@ func RemoveVolume(ctx context.Context, id string) error {
 		return errors.Wrap(err, "could not create docker client")
 	}
 
+	logChange("remove volume %s", id)
 	return c.VolumeRemove(ctx, id, true)
 }
 
@@ -338,13 +813,536 @@ func RemoveImage(ctx context.Context, id string) error {
 		return errors.Wrap(err, "could not create docker client")
 	}
 
+	logChange("remove image %s", id)
 	_, err = c.ImageRemove(ctx, id, types.ImageRemoveOptions{Force: true})
 	return err
 }
 
-func connectToNetwork(ctx context.Context, containerID string) error {
-	const networkName = "srcd-cli-network"
+// SaveImage writes the image installed with the given reference to w as a
+// tarball, the one of docker save, which LoadImage loads along with its tag.
+func SaveImage(ctx context.Context, ref string, w io.Writer) error {
+	c, err := client.NewEnvClient()
+	if err != nil {
+		return errors.Wrap(err, "could not create docker client")
+	}
+
+	logCall("save image %s", ref)
+	rc, err := c.ImageSave(ctx, []string{ref})
+	if err != nil {
+		return errors.Wrapf(err, "could not save image %s", ref)
+	}
+	defer rc.Close()
+
+	if _, err := io.Copy(w, rc); err != nil {
+		return errors.Wrapf(err, "could not save image %s", ref)
+	}
+	return nil
+}
+
+// LoadImage loads the images of a tarball written by SaveImage, with their
+// tags.
+func LoadImage(ctx context.Context, r io.Reader) error {
+	c, err := client.NewEnvClient()
+	if err != nil {
+		return errors.Wrap(err, "could not create docker client")
+	}
+
+	logChange("load image")
+	resp, err := c.ImageLoad(ctx, r, true)
+	if err != nil {
+		return errors.Wrap(err, "could not load image")
+	}
+	defer resp.Body.Close()
+
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var msg struct {
+			Error string `json:"error"`
+		}
+		if err := dec.Decode(&msg); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return errors.Wrap(err, "could not load image")
+		}
+
+		if msg.Error != "" {
+			return fmt.Errorf("could not load image: %s", msg.Error)
+		}
+	}
+}
+
+// CopyToContainer extracts the tarball content into the directory dir of the
+// container with the given name.
+func CopyToContainer(ctx context.Context, name, dir string, content io.Reader) error {
+	c, err := client.NewEnvClient()
+	if err != nil {
+		return errors.Wrap(err, "could not create docker client")
+	}
+
+	logChange("copy to %s:%s", name, dir)
+	err = c.CopyToContainer(ctx, name, dir, content, types.CopyToContainerOptions{})
+	return errors.Wrapf(err, "could not copy to %s", name)
+}
+
+// volumeCopyPath is where the volumes are mounted in the containers created
+// to copy their files.
+const volumeCopyPath = "/srcd-volume"
+
+// volumeMount mounts the volume with the given name in volumeCopyPath.
+func volumeMount(name string) mount.Mount {
+	return mount.Mount{Type: mount.TypeVolume, Source: name, Target: volumeCopyPath}
+}
+
+// directoryMount mounts the directory of the host at dir in volumeCopyPath.
+func directoryMount(dir string) mount.Mount {
+	return mount.Mount{Type: mount.TypeBind, Source: dir, Target: volumeCopyPath}
+}
+
+// describeMount returns what's mounted by m for the logs and errors, like
+// volume srcd-cli-workdir.
+func describeMount(m mount.Mount) string {
+	if m.Type == mount.TypeBind {
+		return "directory " + m.Source
+	}
+	return "volume " + m.Source
+}
+
+// withVolumeContainer calls f with the id of a container created, not
+// started, from the given image, which must be installed, with the given
+// mount of a volume or a directory in volumeCopyPath, removing it after. The
+// container runs cmd if it's started.
+func withVolumeContainer(ctx context.Context, c *client.Client, m mount.Mount, image string, cmd []string, f func(id string) error) error {
+	config := &container.Config{Image: image, Labels: withEnvironmentLabel(nil), Entrypoint: cmd}
+	host := &container.HostConfig{Mounts: []mount.Mount{m}}
+
+	logChange("create container of %s to copy %s", image, describeMount(m))
+	res, err := c.ContainerCreate(ctx, config, host, &network.NetworkingConfig{}, "")
+	if err != nil {
+		return errors.Wrapf(err, "could not create a container to copy %s", describeMount(m))
+	}
+	defer func() {
+		logChange("remove container %s", res.ID)
+		if err := c.ContainerRemove(ctx, res.ID, types.ContainerRemoveOptions{Force: true}); err != nil {
+			logrus.Errorf("could not remove the container copying %s: %v", describeMount(m), err)
+		}
+	}()
+
+	return f(res.ID)
+}
+
+// CopyFromVolume calls f with a tarball with the files of the volume with the
+// given name, with their paths relative to it, read through a container of
+// the given image, which must be installed, as the volume may not be kept in
+// a directory of the host.
+func CopyFromVolume(ctx context.Context, name, image string, f func(tr *tar.Reader) error) error {
+	return copyFromMount(ctx, volumeMount(name), image, f)
+}
+
+// CopyFromDirectory calls f with a tarball with the files of the directory of
+// the host at dir, with their paths relative to it, read through a container
+// of the given image, which must be installed, as the files written by the
+// containers may only be readable by root.
+func CopyFromDirectory(ctx context.Context, dir, image string, f func(tr *tar.Reader) error) error {
+	return copyFromMount(ctx, directoryMount(dir), image, f)
+}
+
+func copyFromMount(ctx context.Context, m mount.Mount, image string, f func(tr *tar.Reader) error) error {
+	c, err := client.NewEnvClient()
+	if err != nil {
+		return errors.Wrap(err, "could not create docker client")
+	}
+
+	return withVolumeContainer(ctx, c, m, image, nil, func(id string) error {
+		logCall("copy from %s", describeMount(m))
+		rc, _, err := c.CopyFromContainer(ctx, id, volumeCopyPath)
+		if err != nil {
+			return errors.Wrapf(err, "could not copy from %s", describeMount(m))
+		}
+		defer rc.Close()
+
+		pr, pw := io.Pipe()
+		go func() {
+			pw.CloseWithError(stripTarPrefix(tar.NewReader(rc), tar.NewWriter(pw), path.Base(volumeCopyPath)+"/"))
+		}()
+		defer pr.Close()
+
+		return f(tar.NewReader(pr))
+	})
+}
+
+// stripTarPrefix copies the entries of tr to tw without the given prefix in
+// their names, leaving out the one of the prefix itself.
+func stripTarPrefix(tr *tar.Reader, tw *tar.Writer, prefix string) error {
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return tw.Close()
+		} else if err != nil {
+			return err
+		}
+
+		name := strings.TrimPrefix(hdr.Name, prefix)
+		if name == "" || name == strings.TrimSuffix(prefix, "/") {
+			continue
+		}
+
+		hdr.Name = name
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := io.Copy(tw, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// CopyToVolume extracts the tarball content into the volume with the given
+// name, through a container of the given image, which must be installed.
+func CopyToVolume(ctx context.Context, name, image string, content io.Reader) error {
+	c, err := client.NewEnvClient()
+	if err != nil {
+		return errors.Wrap(err, "could not create docker client")
+	}
+
+	return withVolumeContainer(ctx, c, volumeMount(name), image, nil, func(id string) error {
+		logChange("copy to volume %s", name)
+		err := c.CopyToContainer(ctx, id, volumeCopyPath, content, types.CopyToContainerOptions{})
+		return errors.Wrapf(err, "could not copy to volume %s", name)
+	})
+}
+
+// ReadFromVolume returns the content of the file of the volume with the given
+// name at the given path, relative to it, read through a container of the
+// given image, which must be installed.
+func ReadFromVolume(ctx context.Context, name, image, file string) ([]byte, error) {
+	c, err := client.NewEnvClient()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create docker client")
+	}
+
+	var content []byte
+	err = withVolumeContainer(ctx, c, volumeMount(name), image, nil, func(id string) error {
+		logCall("read %s from volume %s", file, name)
+		rc, _, err := c.CopyFromContainer(ctx, id, path.Join(volumeCopyPath, file))
+		if err != nil {
+			return errors.Wrapf(err, "could not read %s from volume %s", file, name)
+		}
+		defer rc.Close()
 
+		tr := tar.NewReader(rc)
+		if _, err := tr.Next(); err != nil {
+			return errors.Wrapf(err, "could not read %s from volume %s", file, name)
+		}
+
+		content, err = ioutil.ReadAll(tr)
+		return errors.Wrapf(err, "could not read %s from volume %s", file, name)
+	})
+	return content, err
+}
+
+// volumeRemoveBatch is how many paths are removed by every container run by
+// RemoveFromVolume, to keep its command line short.
+const volumeRemoveBatch = 500
+
+// RemoveFromVolume removes the files and directories of the volume with the
+// given name at the given paths, relative to it, running rm in containers of
+// the given image, which must be installed and have it.
+func RemoveFromVolume(ctx context.Context, name, image string, paths []string) error {
+	for len(paths) > 0 {
+		n := len(paths)
+		if n > volumeRemoveBatch {
+			n = volumeRemoveBatch
+		}
+
+		cmd := []string{"rm", "-rf", "--"}
+		for _, p := range paths[:n] {
+			cmd = append(cmd, path.Join(volumeCopyPath, path.Clean("/"+p)))
+		}
+
+		if err := runInVolume(ctx, volumeMount(name), image, cmd); err != nil {
+			return err
+		}
+		paths = paths[n:]
+	}
+	return nil
+}
+
+// EmptyVolume removes all the content of the volume with the given name,
+// running rm in a container of the given image, which must be installed and
+// have sh and rm.
+func EmptyVolume(ctx context.Context, name, image string) error {
+	return runInVolume(ctx, volumeMount(name), image, emptyCmd)
+}
+
+// EmptyDirectory removes all the content of the directory of the host at
+// dir, keeping it, running rm in a container of the given image, which must
+// be installed and have sh and rm, as the files written by the containers
+// may only be removable by root.
+func EmptyDirectory(ctx context.Context, dir, image string) error {
+	return runInVolume(ctx, directoryMount(dir), image, emptyCmd)
+}
+
+// emptyCmd removes all the content of volumeCopyPath, its hidden files too.
+var emptyCmd = []string{"sh", "-c", fmt.Sprintf("rm -rf %[1]s/* %[1]s/.[!.]* %[1]s/..?*", volumeCopyPath)}
+
+// runInVolume runs cmd in a container of the given image with the given
+// mount of a volume or a directory in volumeCopyPath, waiting for it to exit
+// and failing if its exit code is not 0.
+func runInVolume(ctx context.Context, m mount.Mount, image string, cmd []string) error {
+	c, err := client.NewEnvClient()
+	if err != nil {
+		return errors.Wrap(err, "could not create docker client")
+	}
+
+	return withVolumeContainer(ctx, c, m, image, cmd, func(id string) error {
+		logChange("run %s in %s", cmd[0], describeMount(m))
+		if err := c.ContainerStart(ctx, id, types.ContainerStartOptions{}); err != nil {
+			return errors.Wrapf(err, "could not run %s in %s", cmd[0], describeMount(m))
+		}
+
+		code, err := c.ContainerWait(ctx, id)
+		if err != nil {
+			return errors.Wrapf(err, "could not run %s in %s", cmd[0], describeMount(m))
+		}
+		if code != 0 {
+			return fmt.Errorf("%s in %s exited with code %d", cmd[0], describeMount(m), code)
+		}
+		return nil
+	})
+}
+
+// Exec runs the command in the container with the given name and waits for
+// it to exit, failing if its exit code is not 0.
+func Exec(ctx context.Context, name string, cmd ...string) error {
+	c, err := client.NewEnvClient()
+	if err != nil {
+		return errors.Wrap(err, "could not create docker client")
+	}
+
+	logChange("exec %s in %s", strings.Join(cmd, " "), name)
+	exec, err := c.ContainerExecCreate(ctx, name, types.ExecConfig{Cmd: cmd})
+	if err != nil {
+		return errors.Wrapf(err, "could not run %s in %s", cmd[0], name)
+	}
+
+	if err := c.ContainerExecStart(ctx, exec.ID, types.ExecStartCheck{Detach: true}); err != nil {
+		return errors.Wrapf(err, "could not run %s in %s", cmd[0], name)
+	}
+
+	for {
+		info, err := c.ContainerExecInspect(ctx, exec.ID)
+		if err != nil {
+			return errors.Wrapf(err, "could not run %s in %s", cmd[0], name)
+		}
+
+		if !info.Running {
+			if info.ExitCode != 0 {
+				return fmt.Errorf("%s exited with code %d in %s", cmd[0], info.ExitCode, name)
+			}
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+// Logs returns the last lines of the logs of the container with the given
+// name, both from its standard output and error.
+func Logs(ctx context.Context, name string, lines int) ([]string, error) {
+	c, err := client.NewEnvClient()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create docker client")
+	}
+
+	rc, err := c.ContainerLogs(ctx, name, types.ContainerLogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Tail:       fmt.Sprint(lines),
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not get logs of %s", name)
+	}
+	defer rc.Close()
+
+	content, err := ioutil.ReadAll(rc)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not read logs of %s", name)
+	}
+
+	text := strings.TrimRight(string(demuxLogs(content)), "\n")
+	if text == "" {
+		return nil, nil
+	}
+	return strings.Split(text, "\n"), nil
+}
+
+// LogsOptions select the logs streamed by StreamLogs.
+type LogsOptions struct {
+	// Follow keeps streaming the new logs until the context is done.
+	Follow bool
+	// Tail is the number of lines from the end to start with, or all.
+	Tail string
+	// Since is the Unix timestamp of the oldest logs shown, all if it's
+	// empty.
+	Since      string
+	Timestamps bool
+}
+
+// StreamLogs writes the logs of the container with the given name to w, both
+// from its standard output and error, until there are no more or, following
+// them, the context is done.
+func StreamLogs(ctx context.Context, name string, opts LogsOptions, w io.Writer) error {
+	c, err := client.NewEnvClient()
+	if err != nil {
+		return errors.Wrap(err, "could not create docker client")
+	}
+
+	rc, err := c.ContainerLogs(ctx, name, types.ContainerLogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Follow:     opts.Follow,
+		Tail:       opts.Tail,
+		Since:      opts.Since,
+		Timestamps: opts.Timestamps,
+	})
+	if client.IsErrNotFound(err) {
+		return ErrNotFound
+	} else if err != nil {
+		return errors.Wrapf(err, "could not get logs of %s", name)
+	}
+	defer rc.Close()
+
+	err = demuxStream(w, bufio.NewReader(rc))
+	if err != nil && ctx.Err() == nil {
+		return errors.Wrapf(err, "could not read logs of %s", name)
+	}
+	return nil
+}
+
+// Stats are the resources used by a container, as reported by docker stats.
+type Stats = types.StatsJSON
+
+// StreamStats calls f with the resources used by the container with the
+// given name, about every second if stream is true or once otherwise, until
+// the container stops or the context is done. It returns ErrNotFound if
+// there's no container with the name.
+func StreamStats(ctx context.Context, name string, stream bool, f func(*Stats)) error {
+	c, err := client.NewEnvClient()
+	if err != nil {
+		return errors.Wrap(err, "could not create docker client")
+	}
+
+	logCall("get stats of container %s", name)
+	res, err := c.ContainerStats(ctx, name, stream)
+	if client.IsErrNotFound(err) {
+		return ErrNotFound
+	} else if err != nil {
+		return errors.Wrapf(err, "could not get stats of %s", name)
+	}
+	defer res.Body.Close()
+
+	dec := json.NewDecoder(res.Body)
+	for {
+		var s Stats
+		if err := dec.Decode(&s); err == io.EOF || ctx.Err() != nil {
+			return nil
+		} else if err != nil {
+			return errors.Wrapf(err, "could not read stats of %s", name)
+		}
+
+		// The stats of containers not running are empty.
+		if s.Read.IsZero() {
+			return nil
+		}
+
+		f(&s)
+		if !stream {
+			return nil
+		}
+	}
+}
+
+// demuxStream copies the frames of logs read from r to w without their
+// headers, like demuxLogs, as they are read. Logs without headers are copied
+// as they are.
+func demuxStream(w io.Writer, r *bufio.Reader) error {
+	const headerSize = 8
+
+	header, err := r.Peek(headerSize)
+	if err == io.EOF {
+		_, err = io.Copy(w, r)
+		return err
+	} else if err != nil {
+		return err
+	}
+
+	if header[0] > 2 || header[1] != 0 || header[2] != 0 || header[3] != 0 {
+		_, err = io.Copy(w, r)
+		return err
+	}
+
+	header = make([]byte, headerSize)
+	for {
+		if _, err := io.ReadFull(r, header); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		size := int64(binary.BigEndian.Uint32(header[4:]))
+		if _, err := io.CopyN(w, r, size); err != nil {
+			return err
+		}
+	}
+}
+
+// demuxLogs strips the headers docker adds to every frame of the logs of
+// containers without a TTY, which tell the stream the frame belongs to and its
+// size. Logs without headers are returned as they are.
+func demuxLogs(content []byte) []byte {
+	const headerSize = 8
+
+	var result []byte
+	for rest := content; len(rest) > 0; {
+		if len(rest) < headerSize || rest[0] > 2 || rest[1] != 0 || rest[2] != 0 || rest[3] != 0 {
+			return content
+		}
+
+		size := int(binary.BigEndian.Uint32(rest[4:headerSize]))
+		if len(rest) < headerSize+size {
+			return content
+		}
+
+		result = append(result, rest[headerSize:headerSize+size]...)
+		rest = rest[headerSize+size:]
+	}
+
+	return result
+}
+
+// RemoveNetwork removes the network the containers are connected to, if it
+// exists. It fails if any container is still connected to it.
+func RemoveNetwork(ctx context.Context) error {
+	c, err := client.NewEnvClient()
+	if err != nil {
+		return errors.Wrap(err, "could not create docker client")
+	}
+
+	if _, err := c.NetworkInspect(ctx, networkName); client.IsErrNetworkNotFound(err) {
+		return nil
+	} else if err != nil {
+		return errors.Wrap(err, "could not inspect network")
+	}
+
+	logChange("remove network %s", networkName)
+	return errors.Wrap(c.NetworkRemove(ctx, networkName), "could not remove network")
+}
+
+func connectToNetwork(ctx context.Context, containerID string) error {
 	c, err := client.NewEnvClient()
 	if err != nil {
 		return errors.Wrap(err, "could not create docker client")
@@ -353,10 +1351,11 @@ func connectToNetwork(ctx context.Context, containerID string) error {
 	if _, err := c.NetworkInspect(ctx, networkName); err != nil {
 		logrus.Infof("couldn't find network %s: %v", networkName, err)
 		logrus.Infof("creating it now")
-		_, err = c.NetworkCreate(ctx, networkName, types.NetworkCreate{})
+		_, err = c.NetworkCreate(ctx, networkName, types.NetworkCreate{Labels: withEnvironmentLabel(nil)})
 		if err != nil {
 			return errors.Wrap(err, "could not create network")
 		}
 	}
+	logChange("connect container %s to network %s", containerID, networkName)
 	return c.NetworkConnect(ctx, networkName, containerID, nil)
 }
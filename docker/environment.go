@@ -0,0 +1,57 @@
+package docker
+
+// EnvironmentLabel is the label of the containers, volumes and networks
+// created with the name of the environment they belong to.
+const EnvironmentLabel = "srcd.environment"
+
+// DefaultEnvironment is the environment of the resources created when none
+// is chosen, and of the ones created before there were environments, which
+// don't have the label.
+const DefaultEnvironment = "default"
+
+var (
+	// environment is the one the resources created belong to. See
+	// SetEnvironment.
+	environment = DefaultEnvironment
+	// networkName is the name of the network all the containers are
+	// connected to.
+	networkName = "srcd-cli-network"
+)
+
+// SetEnvironment makes the containers, volumes and networks created belong to
+// the environment with the given name, and the containers be connected to the
+// network with the given name.
+func SetEnvironment(name, network string) {
+	environment = name
+	networkName = network
+}
+
+// Environment returns the name of the environment the resources created
+// belong to.
+func Environment() string {
+	return environment
+}
+
+// EnvironmentOf returns the name of the environment of the resource with the
+// given labels.
+func EnvironmentOf(labels map[string]string) string {
+	if name := labels[EnvironmentLabel]; name != "" {
+		return name
+	}
+	return DefaultEnvironment
+}
+
+// InEnvironment reports whether the resource with the given labels belongs to
+// the environment of the resources created.
+func InEnvironment(labels map[string]string) bool {
+	return EnvironmentOf(labels) == environment
+}
+
+// withEnvironmentLabel returns the labels with the one of the environment.
+func withEnvironmentLabel(labels map[string]string) map[string]string {
+	if labels == nil {
+		labels = make(map[string]string)
+	}
+	labels[EnvironmentLabel] = environment
+	return labels
+}
@@ -0,0 +1,53 @@
+package docker
+
+import (
+	"context"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+	"github.com/pkg/errors"
+)
+
+// ContainerEvent is a change of the state of a container reported by docker,
+// like start, die or health_status: healthy.
+type ContainerEvent struct {
+	// Name is the name of the container, without the leading slash.
+	Name   string
+	Action string
+	// ExitCode is the one the container exited with in die events, empty in
+	// the rest.
+	ExitCode string
+}
+
+// WatchContainers calls f with the events of the containers of the
+// environment whose name has the given prefix, as docker reports them, until
+// the context is done, when it returns nil, or docker can't be reached.
+func WatchContainers(ctx context.Context, prefix string, f func(ContainerEvent)) error {
+	c, err := client.NewEnvClient()
+	if err != nil {
+		return errors.Wrap(err, "could not create docker client")
+	}
+
+	logCall("watch events of containers %s*", prefix)
+	args := filters.NewArgs()
+	args.Add("type", events.ContainerEventType)
+	msgs, errs := c.Events(ctx, types.EventsOptions{Filters: args})
+	for {
+		select {
+		case m := <-msgs:
+			name := strings.TrimPrefix(m.Actor.Attributes["name"], "/")
+			// The attributes of the events have the labels of the container.
+			if strings.HasPrefix(name, prefix) && InEnvironment(m.Actor.Attributes) {
+				f(ContainerEvent{Name: name, Action: m.Action, ExitCode: m.Actor.Attributes["exitCode"]})
+			}
+		case err := <-errs:
+			if ctx.Err() != nil {
+				return nil
+			}
+			return errors.Wrap(err, "could not watch the events of docker")
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package docker
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"github.com/pkg/errors"
+)
+
+// HTTPProxy and CACerts are the proxy and the certificates in PEM of the CAs
+// given to ConfigureHTTP, which the daemon created is given too.
+var (
+	HTTPProxy string
+	CACerts   []byte
+)
+
+// defaultTransport is http.DefaultTransport before it's replaced by
+// ConfigureHTTP.
+var defaultTransport = http.DefaultTransport.(*http.Transport)
+
+// ConfigureHTTP makes the HTTP clients of the engine, the ones using
+// http.DefaultTransport like the ones of the registry, the update check and
+// the discovery of the drivers, use the given proxy for the hosts outside the
+// engine, and trust the CAs with the given certificates along with the ones
+// of the system, as needed behind a proxy intercepting TLS. Without a proxy,
+// the one of HTTPS_PROXY is used. The proxy and CAs of docker itself, used to
+// pull the images, are configured in docker.
+func ConfigureHTTP(proxy string, caCerts []byte) error {
+	t := defaultTransport.Clone()
+	if proxy != "" {
+		u, err := ParseProxy(proxy)
+		if err != nil {
+			return err
+		}
+		t.Proxy = proxyOutsideEngine(u)
+	}
+
+	if len(caCerts) > 0 {
+		pool, err := certPool(caCerts)
+		if err != nil {
+			return err
+		}
+		t.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+
+	HTTPProxy, CACerts = proxy, caCerts
+	http.DefaultTransport = t
+	return nil
+}
+
+// ParseProxy returns the URL of the proxy given, like http://proxy:3128.
+func ParseProxy(proxy string) (*url.URL, error) {
+	u, err := url.Parse(proxy)
+	switch {
+	case err != nil:
+		return nil, fmt.Errorf("invalid proxy %q: %v", proxy, err)
+	case u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "socks5":
+		return nil, fmt.Errorf("invalid proxy %q: it must be an http://, https:// or socks5:// URL", proxy)
+	case u.Host == "":
+		return nil, fmt.Errorf("invalid proxy %q: it has no host", proxy)
+	}
+	return u, nil
+}
+
+// proxyOutsideEngine returns the proxy function of the transports, sending
+// the requests to the hosts outside the engine through the proxy with the
+// given URL. The ones to localhost, IPs or single-label names, like the names
+// of the containers of the components, are sent directly.
+func proxyOutsideEngine(u *url.URL) func(*http.Request) (*url.URL, error) {
+	return func(req *http.Request) (*url.URL, error) {
+		host := req.URL.Hostname()
+		if host == "localhost" || net.ParseIP(host) != nil || !strings.Contains(host, ".") {
+			return nil, nil
+		}
+		return u, nil
+	}
+}
+
+// certPool returns the CAs of the system along with the ones with the given
+// certificates in PEM.
+func certPool(certs []byte) (*x509.CertPool, error) {
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+
+	if !pool.AppendCertsFromPEM(certs) {
+		return nil, errors.New("no certificate found in the CA bundle, it must have certificates in PEM")
+	}
+	return pool, nil
+}
+
+// TLSHosts returns the hosts the engine reaches with TLS: the registry and
+// auth of Docker Hub, or the registry mirror if there's one, and the API of
+// GitHub, for the releases and drivers.
+func TLSHosts() []string {
+	if RegistryMirror != "" {
+		return []string{mirrorHost(RegistryMirror), "api.github.com"}
+	}
+	return []string{"registry-1.docker.io", "auth.docker.io", "api.github.com"}
+}
+
+// TLSProbe is what's found connecting with TLS to a host, through the proxy
+// of ConfigureHTTP if there's one.
+type TLSProbe struct {
+	Host string
+	// Issuer is the issuer of the certificate of the host, its CA or the
+	// one of a proxy intercepting TLS.
+	Issuer string
+	// SystemTrusted is true if the CAs of the system trust the certificate,
+	// and Trusted if they do along with the ones of ConfigureHTTP.
+	SystemTrusted bool
+	Trusted       bool
+	// Err is why the host could not be reached.
+	Err error
+}
+
+// ProbeTLS connects with TLS to the host and tells who issued its certificate
+// and whether it's trusted, without failing if it's not.
+func ProbeTLS(ctx context.Context, host string) TLSProbe {
+	p := TLSProbe{Host: host}
+	var chain []*x509.Certificate
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.TLSClientConfig = &tls.Config{
+		InsecureSkipVerify: true,
+		VerifyPeerCertificate: func(raw [][]byte, _ [][]*x509.Certificate) error {
+			for _, c := range raw {
+				cert, err := x509.ParseCertificate(c)
+				if err != nil {
+					return err
+				}
+				chain = append(chain, cert)
+			}
+			return nil
+		},
+	}
+	defer t.CloseIdleConnections()
+
+	req, err := http.NewRequest(http.MethodHead, "https://"+host+"/", nil)
+	if err != nil {
+		p.Err = err
+		return p
+	}
+
+	resp, err := (&http.Client{Transport: t}).Do(req.WithContext(ctx))
+	if err != nil {
+		p.Err = err
+		return p
+	}
+	resp.Body.Close()
+
+	if len(chain) == 0 {
+		p.Err = errors.New("no certificate received")
+		return p
+	}
+
+	leaf := chain[0]
+	p.Issuer = leaf.Issuer.CommonName
+	if len(leaf.Issuer.Organization) > 0 {
+		p.Issuer = fmt.Sprintf("%s (%s)", leaf.Issuer.CommonName, leaf.Issuer.Organization[0])
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, c := range chain[1:] {
+		intermediates.AddCert(c)
+	}
+
+	verify := func(roots *x509.CertPool) bool {
+		_, err := leaf.Verify(x509.VerifyOptions{DNSName: host, Roots: roots, Intermediates: intermediates})
+		return err == nil
+	}
+
+	system, err := x509.SystemCertPool()
+	if err != nil {
+		system = x509.NewCertPool()
+	}
+	p.SystemTrusted = verify(system)
+	p.Trusted = p.SystemTrusted
+	if !p.Trusted && len(CACerts) > 0 {
+		if pool, err := certPool(CACerts); err == nil {
+			p.Trusted = verify(pool)
+		}
+	}
+	return p
+}
+
+// SearchHub makes docker search Docker Hub, which it does itself, with its
+// own proxy and CAs, as it does to pull the images.
+func SearchHub(ctx context.Context) error {
+	c, err := client.NewEnvClient()
+	if err != nil {
+		return errors.Wrap(err, "could not create docker client")
+	}
+
+	logCall("search images srcd/cli-daemon")
+	_, err = c.ImageSearch(ctx, "srcd/cli-daemon", types.ImageSearchOptions{Limit: 1})
+	return err
+}
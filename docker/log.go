@@ -0,0 +1,85 @@
+package docker
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/sirupsen/logrus"
+)
+
+// Verbose makes the functions of the package log every call to the docker API
+// at debug level. Otherwise only the ones changing containers, images, volumes
+// or networks are logged.
+var Verbose bool
+
+// logChange logs a call to the docker API changing something.
+func logChange(format string, args ...interface{}) {
+	logrus.Debugf("docker: "+format, args...)
+}
+
+// logCall logs a call to the docker API only reading something.
+func logCall(format string, args ...interface{}) {
+	if Verbose {
+		logrus.Debugf("docker: "+format, args...)
+	}
+}
+
+// sensitiveEnv matches the names of the environment variables whose values
+// are redacted in the logs, like MYSQL_PASSWORD, REGISTRY_TOKEN or the TLS
+// certificate and key of the daemon.
+var sensitiveEnv = regexp.MustCompile(`(?i)(PASSWORD|PASSWD|SECRET|TOKEN|AUTH|CREDENTIAL|KEY|CERT)`)
+
+// redactedValue replaces the sensitive values in the logs.
+const redactedValue = "[redacted]"
+
+// RedactEnv returns the environment variables, like KEY=value, with the
+// values of the sensitive ones replaced.
+func RedactEnv(env []string) []string {
+	result := make([]string, len(env))
+	for i, e := range env {
+		parts := strings.SplitN(e, "=", 2)
+		if len(parts) == 2 && sensitiveEnv.MatchString(parts[0]) {
+			e = parts[0] + "=" + redactedValue
+		}
+		result[i] = e
+	}
+	return result
+}
+
+// createSpec describes the container to create for the logs.
+func createSpec(name string, config *container.Config, host *container.HostConfig) string {
+	spec := fmt.Sprintf("image=%s cmd=%q env=%q", config.Image, []string(config.Cmd), RedactEnv(config.Env))
+	if len(config.Entrypoint) > 0 {
+		spec += fmt.Sprintf(" entrypoint=%q", []string(config.Entrypoint))
+	}
+
+	if host != nil {
+		var mounts []string
+		for _, m := range host.Mounts {
+			mode := "rw"
+			if m.ReadOnly {
+				mode = "ro"
+			}
+			mounts = append(mounts, fmt.Sprintf("%s:%s:%s", m.Source, m.Target, mode))
+		}
+		mounts = append(mounts, host.Binds...)
+
+		var ports []string
+		for port, bindings := range host.PortBindings {
+			for _, b := range bindings {
+				ports = append(ports, fmt.Sprintf("%s->%s", b.HostPort, port))
+			}
+		}
+		sort.Strings(ports)
+
+		spec += fmt.Sprintf(" mounts=%q ports=%q", mounts, ports)
+		if host.Resources.Memory > 0 {
+			spec += fmt.Sprintf(" memory=%d", host.Resources.Memory)
+		}
+	}
+
+	return fmt.Sprintf("create container %s: %s", name, spec)
+}
@@ -0,0 +1,264 @@
+package docker
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	homedir "github.com/mitchellh/go-homedir"
+	"github.com/pkg/errors"
+)
+
+// RegistryMirror is the registry, with the path the images of Docker Hub are
+// mirrored under, like registry.corp/dockerhub, the images of Docker Hub are
+// pulled from instead, set with ConfigureMirror. Once pulled they are tagged
+// with their names in Docker Hub, the ones the engine matches and labels, so
+// the mirror is only seen when pulling. Empty to pull from Docker Hub.
+var RegistryMirror string
+
+// RegistryAuth is the encoded credentials of the mirror, as the API of
+// docker takes them, empty if it has none.
+var RegistryAuth string
+
+// ConfigureMirror makes the images of Docker Hub be pulled from the given
+// mirror, with the given encoded credentials, or else the ones of the mirror
+// in the config file of docker, written by docker login.
+func ConfigureMirror(mirror, auth string) error {
+	if mirror == "" {
+		RegistryMirror, RegistryAuth = "", ""
+		return nil
+	}
+
+	m, err := ParseMirror(mirror)
+	if err != nil {
+		return err
+	}
+
+	if auth == "" {
+		auth = dockerConfigAuth(mirrorHost(m))
+	}
+
+	RegistryMirror, RegistryAuth = m, auth
+	return nil
+}
+
+// ParseMirror returns the mirror given, like registry.corp/dockerhub, without
+// a scheme or trailing slashes.
+func ParseMirror(mirror string) (string, error) {
+	m := strings.TrimRight(strings.TrimPrefix(mirror, "https://"), "/")
+	if strings.Contains(m, "://") {
+		return "", fmt.Errorf("invalid registry mirror %q: it must be a registry reached with https", mirror)
+	}
+
+	host := mirrorHost(m)
+	if host == "" || !(strings.ContainsAny(host, ".:") || host == "localhost") {
+		return "", fmt.Errorf("invalid registry mirror %q: it must start with the host of the registry, like registry.corp/dockerhub", mirror)
+	}
+	return m, nil
+}
+
+// mirrorHost returns the host of the registry of the mirror.
+func mirrorHost(mirror string) string {
+	return strings.SplitN(mirror, "/", 2)[0]
+}
+
+// dockerHubRepo returns the repository in Docker Hub of the image, like
+// library/alpine for alpine.
+func dockerHubRepo(image string) string {
+	repo := strings.TrimPrefix(image, "docker.io/")
+	if !strings.Contains(repo, "/") {
+		repo = "library/" + repo
+	}
+	return repo
+}
+
+// MirrorImage returns the name the image is pulled by: the one in the mirror
+// of the images of Docker Hub, or the given one if there's no mirror or it's
+// not in Docker Hub.
+func MirrorImage(image string) string {
+	if RegistryMirror == "" || !inDockerHub(image) {
+		return image
+	}
+	return RegistryMirror + "/" + dockerHubRepo(image)
+}
+
+// isMirrored reports whether the image is pulled from the mirror.
+func isMirrored(image string) bool {
+	return MirrorImage(image) != image
+}
+
+// registryRepo returns the URL of the registry the digests and manifests of
+// the image are asked to, Docker Hub or the mirror, and its repository there.
+func registryRepo(image string) (registry, repo string) {
+	if !isMirrored(image) {
+		return registryURL, dockerHubRepo(image)
+	}
+
+	parts := strings.SplitN(MirrorImage(image), "/", 2)
+	return "https://" + parts[0], parts[1]
+}
+
+// registryAuthorization returns the Authorization header of the requests to
+// pull the repository of the registry, empty if they don't need one.
+func registryAuthorization(ctx context.Context, registry, repo string) (string, error) {
+	if registry == registryURL {
+		token, err := registryToken(ctx, repo)
+		if err != nil {
+			return "", err
+		}
+		return "Bearer " + token, nil
+	}
+	return mirrorAuthorization(ctx, registry, repo)
+}
+
+// mirrorAuthorization returns the Authorization header of the requests to
+// the mirror, following the challenge of its API to the credentials of
+// RegistryAuth, if any.
+func mirrorAuthorization(ctx context.Context, registry, repo string) (string, error) {
+	req, err := http.NewRequest(http.MethodGet, registry+"/v2/", nil)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", errors.Wrapf(err, "could not reach the registry mirror %s", RegistryMirror)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		return "", nil
+	} else if resp.StatusCode != http.StatusUnauthorized {
+		return "", fmt.Errorf("could not reach the registry mirror %s: %s", RegistryMirror, resp.Status)
+	}
+
+	user, password := decodeRegistryAuth(RegistryAuth)
+	scheme, params := parseChallenge(resp.Header.Get("WWW-Authenticate"))
+	switch {
+	case strings.EqualFold(scheme, "basic") && user != "":
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+password)), nil
+	case strings.EqualFold(scheme, "bearer") && params["realm"] != "":
+		// Handled below.
+	default:
+		return "", fmt.Errorf("could not authenticate to the registry mirror %s: "+
+			"it needs credentials, give them with docker login %s", RegistryMirror, mirrorHost(RegistryMirror))
+	}
+
+	q := url.Values{}
+	q.Set("scope", fmt.Sprintf("repository:%s:pull", repo))
+	if params["service"] != "" {
+		q.Set("service", params["service"])
+	}
+	if req, err = http.NewRequest(http.MethodGet, params["realm"]+"?"+q.Encode(), nil); err != nil {
+		return "", err
+	}
+	if user != "" {
+		req.SetBasicAuth(user, password)
+	}
+
+	resp, err = http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", errors.Wrapf(err, "could not authenticate to the registry mirror %s", RegistryMirror)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("could not authenticate to the registry mirror %s: %s", RegistryMirror, resp.Status)
+	}
+
+	var body struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", errors.Wrapf(err, "could not read the token of the registry mirror %s", RegistryMirror)
+	}
+	if body.Token == "" {
+		body.Token = body.AccessToken
+	}
+	return "Bearer " + body.Token, nil
+}
+
+// parseChallenge returns the scheme and parameters of a WWW-Authenticate
+// header, like Bearer realm="https://auth.corp/token",service="registry".
+func parseChallenge(header string) (string, map[string]string) {
+	params := make(map[string]string)
+	parts := strings.SplitN(strings.TrimSpace(header), " ", 2)
+	if len(parts) == 2 {
+		for _, p := range strings.Split(parts[1], ",") {
+			kv := strings.SplitN(strings.TrimSpace(p), "=", 2)
+			if len(kv) == 2 {
+				params[strings.ToLower(kv[0])] = strings.Trim(kv[1], `"`)
+			}
+		}
+	}
+	return parts[0], params
+}
+
+// dockerConfigAuth returns the encoded credentials of the registry with the
+// given host in the config file of docker, empty if there are none. The ones
+// kept by credential helpers can't be read.
+func dockerConfigAuth(host string) string {
+	dir := os.Getenv("DOCKER_CONFIG")
+	if dir == "" {
+		home, err := homedir.Dir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".docker")
+	}
+
+	content, err := ioutil.ReadFile(filepath.Join(dir, "config.json"))
+	if err != nil {
+		return ""
+	}
+
+	var config struct {
+		Auths map[string]struct {
+			Auth string `json:"auth"`
+		} `json:"auths"`
+	}
+	if err := json.Unmarshal(content, &config); err != nil {
+		return ""
+	}
+
+	for _, key := range []string{host, "https://" + host} {
+		decoded, err := base64.StdEncoding.DecodeString(config.Auths[key].Auth)
+		if err != nil || !strings.Contains(string(decoded), ":") {
+			continue
+		}
+
+		parts := strings.SplitN(string(decoded), ":", 2)
+		return encodeRegistryAuth(types.AuthConfig{Username: parts[0], Password: parts[1], ServerAddress: host})
+	}
+	return ""
+}
+
+// encodeRegistryAuth encodes the credentials as the API of docker takes them.
+func encodeRegistryAuth(auth types.AuthConfig) string {
+	content, _ := json.Marshal(auth)
+	return base64.URLEncoding.EncodeToString(content)
+}
+
+// decodeRegistryAuth returns the user and password of the encoded
+// credentials, empty if there are none.
+func decodeRegistryAuth(encoded string) (user, password string) {
+	content, err := base64.URLEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", ""
+	}
+
+	var auth types.AuthConfig
+	if err := json.Unmarshal(content, &auth); err != nil {
+		return "", ""
+	}
+	return auth.Username, auth.Password
+}
@@ -0,0 +1,431 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Platform is the OS and architecture an image is built for, or docker runs
+// on, like linux/arm64.
+type Platform struct {
+	OS           string `json:"os"`
+	Architecture string `json:"architecture"`
+	Variant      string `json:"variant,omitempty"`
+}
+
+func (p Platform) String() string {
+	s := p.OS + "/" + p.Architecture
+	if p.Variant != "" {
+		s += "/" + p.Variant
+	}
+	return s
+}
+
+// Runs reports whether an image for the platform p runs natively on the
+// given one, that is, their OS and architecture are the same, and so are
+// their variants if both are known.
+func (p Platform) Runs(other Platform) bool {
+	return p.OS == other.OS && p.Architecture == other.Architecture &&
+		(p.Variant == "" || other.Variant == "" || p.Variant == other.Variant)
+}
+
+// FallbackPlatform is the platform of the images pulled when an image has
+// none for the platform of docker, which docker runs emulated, if it can.
+var FallbackPlatform = Platform{OS: "linux", Architecture: "amd64"}
+
+// RequireNative makes the pulls and the containers created fail when their
+// image has no variant for the platform of docker, instead of using the one
+// of FallbackPlatform.
+var RequireNative bool
+
+// PlatformLabel is the label of the containers created with the platform of
+// their image, like linux/amd64.
+const PlatformLabel = "srcd.platform"
+
+// PlatformOfLabel returns the platform of the value of PlatformLabel.
+func PlatformOfLabel(label string) Platform {
+	parts := strings.SplitN(label, "/", 3)
+	p := Platform{OS: parts[0]}
+	if len(parts) > 1 {
+		p.Architecture = parts[1]
+	}
+	if len(parts) > 2 {
+		p.Variant = parts[2]
+	}
+	return p
+}
+
+// ForcedPlatform, if not nil, returns the platform the images with the given
+// name are pulled and their containers created for instead of the one of
+// docker, and false if it's not forced. See components.SetPlatforms.
+var ForcedPlatform func(image string) (Platform, bool)
+
+// forcedPlatform returns the platform forced for the image, if any.
+func forcedPlatform(image string) (Platform, bool) {
+	if ForcedPlatform == nil {
+		return Platform{}, false
+	}
+	return ForcedPlatform(image)
+}
+
+// SupportedPlatforms are the platforms that can be forced, the ones the
+// images of the components are published for.
+var SupportedPlatforms = []Platform{
+	{OS: "linux", Architecture: "amd64"},
+	{OS: "linux", Architecture: "arm64"},
+}
+
+// ParsePlatform returns the platform given like linux/amd64, one of
+// SupportedPlatforms.
+func ParsePlatform(s string) (Platform, error) {
+	var names []string
+	for _, p := range SupportedPlatforms {
+		if p.String() == strings.ToLower(strings.TrimSpace(s)) {
+			return p, nil
+		}
+		names = append(names, p.String())
+	}
+	return Platform{}, fmt.Errorf("invalid platform %q: it must be %s", s, strings.Join(names, " or "))
+}
+
+// NoNativeImageError is returned when an image has no variant for the
+// platform of docker, and it's required or there's no fallback, or for the
+// platform forced.
+type NoNativeImageError struct {
+	Ref       string
+	Host      Platform
+	Available []Platform
+	// Forced is whether Host is the platform forced instead of the one of
+	// docker.
+	Forced bool
+}
+
+func (e *NoNativeImageError) Error() string {
+	var available []string
+	for _, p := range e.Available {
+		available = append(available, p.String())
+	}
+
+	which := "the platform of docker"
+	if e.Forced {
+		which = "the platform given with --platform"
+	}
+	return fmt.Sprintf("%s has no image for %s, %s, only for %s",
+		e.Ref, e.Host, which, strings.Join(available, ", "))
+}
+
+var (
+	hostPlatformMu sync.Mutex
+	hostPlatform   *Platform
+)
+
+// HostPlatform returns the platform docker runs on, the one of the images it
+// runs natively. It's asked to docker once.
+func HostPlatform(ctx context.Context) (Platform, error) {
+	hostPlatformMu.Lock()
+	defer hostPlatformMu.Unlock()
+	if hostPlatform != nil {
+		return *hostPlatform, nil
+	}
+
+	c, err := client.NewEnvClient()
+	if err != nil {
+		return Platform{}, errors.Wrap(err, "could not create docker client")
+	}
+
+	info, err := c.Info(ctx)
+	if err != nil {
+		return Platform{}, errors.Wrap(err, "could not get docker info")
+	}
+
+	p := Platform{OS: info.OSType}
+	p.Architecture, p.Variant = NormalizeArchitecture(info.Architecture)
+	hostPlatform = &p
+	return p, nil
+}
+
+// NormalizeArchitecture returns the architecture and variant of the images,
+// like arm64, for the architecture reported by the kernel, like aarch64.
+func NormalizeArchitecture(arch string) (architecture, variant string) {
+	switch arch {
+	case "x86_64", "x86-64", "amd64":
+		return "amd64", ""
+	case "aarch64", "arm64":
+		return "arm64", ""
+	case "armv7l", "armhf":
+		return "arm", "v7"
+	case "armv6l", "armel":
+		return "arm", "v6"
+	case "i386", "i686", "386":
+		return "386", ""
+	default:
+		return arch, ""
+	}
+}
+
+// ImagePlatform returns the platform the image installed is built for.
+func ImagePlatform(img *types.ImageInspect) Platform {
+	arch, variant := NormalizeArchitecture(img.Architecture)
+	return Platform{OS: img.Os, Architecture: arch, Variant: variant}
+}
+
+// platformRef returns the reference to pull the image with the given tag for
+// the platform of docker, in RegistryMirror if there's one. With a variant
+// for it, or when it can't be told, like for the images outside Docker Hub,
+// it's the tag itself, as docker pulls the variant of its own platform.
+// Otherwise it's the digest of the one for FallbackPlatform, with a warning,
+// unless RequireNative is set. With a platform forced for the image, it's
+// the digest of the variant for it, failing if there's none.
+func platformRef(ctx context.Context, image, tag string) (string, error) {
+	id := image + ":" + tag
+	forced, isForced := forcedPlatform(image)
+	if !inDockerHub(image) {
+		if isForced {
+			logrus.Warnf("the platforms of %s can't be known outside Docker Hub, "+
+				"pulling it for the platform of docker instead of %s", id, forced)
+		}
+		return id, nil
+	}
+
+	pulled := MirrorImage(image) + ":" + tag
+
+	host, err := HostPlatform(ctx)
+	switch {
+	case err != nil && isForced:
+		return "", err
+	case err != nil:
+		logrus.Debugf("could not get the platform of docker, pulling %s for it: %v", id, err)
+		return pulled, nil
+	}
+
+	if isForced {
+		if err := ValidatePlatform(ctx, forced); err != nil {
+			return "", err
+		}
+	}
+
+	m, err := RemoteManifestOf(ctx, image, tag)
+	switch {
+	case err != nil && isForced && !forced.Runs(host):
+		return "", errors.Wrapf(err, "could not get the platforms of %s to pull it for %s", id, forced)
+	case err != nil:
+		logrus.Debugf("could not get the platforms of %s, pulling it for %s: %v", id, host, err)
+		return pulled, nil
+	}
+
+	if isForced {
+		return forcedRef(m, image, tag, host, forced)
+	}
+
+	selected, native, ok := m.Select(host)
+	switch {
+	case native:
+		return pulled, nil
+	case !ok || RequireNative:
+		return "", &NoNativeImageError{Ref: id, Host: host, Available: m.platforms()}
+	}
+
+	logrus.Warnf("%s has no image for %s, the platform of docker, using the one for %s, "+
+		"which runs emulated and slower; give --require-native to fail instead", id, host, selected.Platform)
+
+	// Docker pulls the only manifest of the tag whatever its platform, but
+	// not one of a list without its own.
+	if selected.Digest == m.Digest {
+		return pulled, nil
+	}
+	return MirrorImage(image) + "@" + selected.Digest, nil
+}
+
+// forcedRef returns the reference to pull the image with the given tag and
+// manifest for the platform forced: the tag if docker pulls that variant
+// anyway, or else the digest of the one for it.
+func forcedRef(m *RemoteManifest, image, tag string, host, forced Platform) (string, error) {
+	selected, ok := m.find(forced)
+	switch {
+	case !ok:
+		return "", &NoNativeImageError{Ref: image + ":" + tag, Host: forced, Available: m.platforms(), Forced: true}
+	case selected.Digest == m.Digest || forced.Runs(host):
+		return MirrorImage(image) + ":" + tag, nil
+	}
+
+	logrus.Debugf("pulling %s:%s for %s, given with --platform, which runs emulated", image, tag, forced)
+	return MirrorImage(image) + "@" + selected.Digest, nil
+}
+
+// checkImagePlatform checks the image of a container to be created is for the
+// platform of docker, warning if it's not, or failing with RequireNative, or
+// for the platform forced, failing if it's not, and returns its platform,
+// empty if it can't be known. The API of docker the engine uses has no
+// platform for the containers, so they are always created from the image
+// with the tag, pulled for the platform by PullWithProgress.
+func checkImagePlatform(ctx context.Context, c *client.Client, ref string) (string, error) {
+	img, _, err := c.ImageInspectWithRaw(ctx, ref)
+	if err != nil {
+		return "", nil
+	}
+
+	p := ImagePlatform(&img)
+	if forced, ok := forcedPlatform(imageName(ref)); ok {
+		if !p.Runs(forced) {
+			return "", fmt.Errorf("the image %s is for %s, not %s, the platform given with --platform; "+
+				"install it again with srcd components install %s", ref, p, forced, ref)
+		}
+		return p.String(), nil
+	}
+
+	host, err := HostPlatform(ctx)
+	if err != nil || p.Runs(host) {
+		return p.String(), nil
+	}
+
+	if RequireNative {
+		return "", &NoNativeImageError{Ref: ref, Host: host, Available: []Platform{p}}
+	}
+	logrus.Warnf("the image %s is for %s, not %s, the platform of docker; it runs emulated and slower", ref, p, host)
+	return p.String(), nil
+}
+
+// installedFor reports whether the image installed with the given id runs on
+// the platform forced for the image with the given name, if any.
+func installedFor(ctx context.Context, c *client.Client, image, id string) bool {
+	forced, ok := forcedPlatform(image)
+	if !ok {
+		return true
+	}
+
+	img, _, err := c.ImageInspectWithRaw(ctx, id)
+	return err == nil && ImagePlatform(&img).Runs(forced)
+}
+
+// imageName returns the name of the image of the reference, without its tag
+// or digest.
+func imageName(ref string) string {
+	if i := strings.Index(ref, "@"); i >= 0 {
+		ref = ref[:i]
+	}
+	if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") {
+		ref = ref[:i]
+	}
+	return ref
+}
+
+// binfmtDir is where the kernel lists the interpreters of the binaries of
+// other architectures, like the emulators of qemu.
+const binfmtDir = "/proc/sys/fs/binfmt_misc"
+
+// kernelArchitectures are the names the kernel gives to the architectures of
+// the images, as in the names of the emulators of qemu, like qemu-aarch64.
+var kernelArchitectures = map[string]string{
+	"amd64": "x86_64",
+	"arm64": "aarch64",
+}
+
+var (
+	validatedMu sync.Mutex
+	validated   = make(map[Platform]error)
+)
+
+// ValidatePlatform checks docker can run the images for the platform, once,
+// warning about the caveats of its image store. See checkPlatformSupport.
+func ValidatePlatform(ctx context.Context, p Platform) error {
+	validatedMu.Lock()
+	defer validatedMu.Unlock()
+	if err, ok := validated[p]; ok {
+		return err
+	}
+
+	host, err := HostPlatform(ctx)
+	if err != nil {
+		return err
+	}
+
+	info, err := SystemInfo()
+	if err != nil {
+		return err
+	}
+
+	warning, err := checkPlatformSupport(info, host, p, hasEmulator)
+	if warning != "" {
+		logrus.Warn(warning)
+	}
+	validated[p] = err
+	return err
+}
+
+// hasEmulator reports whether the kernel runs the binaries of the given
+// architecture with an emulator, true if it can't be told, like when docker
+// runs elsewhere.
+func hasEmulator(arch string) bool {
+	if _, err := os.Stat(binfmtDir); err != nil {
+		return true
+	}
+
+	name, ok := kernelArchitectures[arch]
+	if !ok {
+		return true
+	}
+
+	matches, _ := filepath.Glob(filepath.Join(binfmtDir, "qemu-"+name+"*"))
+	return len(matches) > 0
+}
+
+// checkPlatformSupport checks docker, with the given info and platform, can
+// run the images for the platform p, and returns a warning about it if any.
+// Other architectures than the one of docker need emulators: Docker Desktop
+// has them, the rest of the hosts need them registered in the kernel, which
+// emulator reports. With the classic image store of docker a tag has a
+// single platform, so the images for p replace the ones installed for docker,
+// while the containerd one keeps the content of both.
+func checkPlatformSupport(info *types.Info, host, p Platform, emulator func(arch string) bool) (string, error) {
+	if info.OSType != "" && info.OSType != p.OS {
+		return "", fmt.Errorf("docker runs %s containers, it can't run the images for %s", info.OSType, p)
+	}
+
+	if p.Runs(host) {
+		return "", nil
+	}
+
+	if info.OperatingSystem != "Docker Desktop" && !emulator(p.Architecture) {
+		return "", fmt.Errorf("docker can't run the images for %s on %s without an emulator; register the ones "+
+			"of qemu with docker run --privileged --rm tonistiigi/binfmt --install %s", p, host, p.Architecture)
+	}
+
+	if !containerdStore(info) {
+		return fmt.Sprintf("the images for %s, given with --platform, run emulated and slower, and replace "+
+			"the ones installed for %s, the platform of docker, as its image store keeps a single platform "+
+			"per tag; going back to %s pulls them again", p, host, host), nil
+	}
+	return fmt.Sprintf("the images for %s, given with --platform, run emulated and slower", p), nil
+}
+
+// containerdStore reports whether docker keeps its images in the image store
+// of containerd instead of the classic one.
+func containerdStore(info *types.Info) bool {
+	for _, s := range info.DriverStatus {
+		if s[0] == "driver-type" && s[1] == "io.containerd.snapshotter.v1" {
+			return true
+		}
+	}
+	return false
+}
+
+// inDockerHub reports whether the image is published in Docker Hub, that is,
+// its name doesn't start with the host of another registry.
+func inDockerHub(image string) bool {
+	i := strings.Index(image, "/")
+	if i < 0 {
+		return true
+	}
+
+	host := image[:i]
+	return host == "docker.io" || !(strings.ContainsAny(host, ".:") || host == "localhost")
+}
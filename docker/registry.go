@@ -0,0 +1,240 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/docker/docker/client"
+	"github.com/pkg/errors"
+)
+
+// Docker Hub endpoints used to get the digests of the images published, which
+// the docker daemon can't be asked for.
+var (
+	registryURL  = "https://registry-1.docker.io"
+	registryAuth = "https://auth.docker.io/token"
+)
+
+// manifestTypes are the media types of the manifests accepted, manifest lists
+// first, as those are the ones whose digests docker keeps when an image
+// published for several platforms is pulled.
+var manifestTypes = []string{
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+// RemoteDigest returns the digest of the image with the given tag published
+// in Docker Hub, or in RegistryMirror if there's one.
+func RemoteDigest(ctx context.Context, image, tag string) (string, error) {
+	registry, repo := registryRepo(image)
+	authorization, err := registryAuthorization(ctx, registry, repo)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequest(http.MethodHead,
+		fmt.Sprintf("%s/v2/%s/manifests/%s", registry, repo, tag), nil)
+	if err != nil {
+		return "", err
+	}
+
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	req.Header.Set("Accept", strings.Join(manifestTypes, ", "))
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", errors.Wrapf(err, "could not get manifest of %s:%s", image, tag)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("could not get manifest of %s:%s: %s", image, tag, resp.Status)
+	}
+
+	digest := resp.Header.Get("Docker-Content-Digest")
+	if digest == "" {
+		return "", fmt.Errorf("no digest in the manifest of %s:%s", image, tag)
+	}
+	return digest, nil
+}
+
+// RemoteManifest is the manifest published of an image with a tag, a list
+// with a manifest per platform or a single one.
+type RemoteManifest struct {
+	// Digest is the one of the list, or of the single manifest.
+	Digest    string
+	Platforms []PlatformManifest
+}
+
+// PlatformManifest is the manifest of an image for a platform.
+type PlatformManifest struct {
+	Platform Platform
+	Digest   string
+}
+
+// Select returns the manifest for the given platform, reporting it's native,
+// or if there's none the one for FallbackPlatform. ok is false if there's
+// neither.
+func (m *RemoteManifest) Select(host Platform) (selected PlatformManifest, native, ok bool) {
+	if p, ok := m.find(host); ok {
+		return p, true, true
+	}
+
+	p, ok := m.find(FallbackPlatform)
+	return p, false, ok
+}
+
+// find returns the manifest that runs natively on the given platform, if
+// there's one.
+func (m *RemoteManifest) find(platform Platform) (PlatformManifest, bool) {
+	for _, p := range m.Platforms {
+		if p.Platform.Runs(platform) {
+			return p, true
+		}
+	}
+	return PlatformManifest{}, false
+}
+
+func (m *RemoteManifest) platforms() []Platform {
+	var result []Platform
+	for _, p := range m.Platforms {
+		result = append(result, p.Platform)
+	}
+	return result
+}
+
+// RemoteManifestOf returns the manifest of the image with the given tag
+// published in Docker Hub, or in RegistryMirror if there's one, with the
+// platforms it's published for. The platform of a single manifest is read
+// from the config of the image.
+func RemoteManifestOf(ctx context.Context, image, tag string) (*RemoteManifest, error) {
+	registry, repo := registryRepo(image)
+	authorization, err := registryAuthorization(ctx, registry, repo)
+	if err != nil {
+		return nil, err
+	}
+
+	var body struct {
+		MediaType string `json:"mediaType"`
+		Manifests []struct {
+			Digest   string   `json:"digest"`
+			Platform Platform `json:"platform"`
+		} `json:"manifests"`
+		Config struct {
+			Digest string `json:"digest"`
+		} `json:"config"`
+	}
+	digest, err := registryGet(ctx, authorization, fmt.Sprintf("%s/v2/%s/manifests/%s", registry, repo, tag),
+		strings.Join(manifestTypes, ", "), &body)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not get manifest of %s:%s", image, tag)
+	}
+
+	m := &RemoteManifest{Digest: digest}
+	if body.MediaType == manifestTypes[0] {
+		for _, p := range body.Manifests {
+			m.Platforms = append(m.Platforms, PlatformManifest{Platform: p.Platform, Digest: p.Digest})
+		}
+		return m, nil
+	}
+
+	var config Platform
+	if _, err := registryGet(ctx, authorization, fmt.Sprintf("%s/v2/%s/blobs/%s", registry, repo, body.Config.Digest),
+		"", &config); err != nil {
+		return nil, errors.Wrapf(err, "could not get the config of %s:%s", image, tag)
+	}
+	config.Architecture, config.Variant = NormalizeArchitecture(config.Architecture)
+	m.Platforms = []PlatformManifest{{Platform: config, Digest: digest}}
+	return m, nil
+}
+
+// registryGet decodes the JSON at the URL of the registry into v, returning
+// the digest of the content if there's one.
+func registryGet(ctx context.Context, authorization, u, accept string, v interface{}) (string, error) {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return "", err
+	}
+
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s", resp.Status)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return "", err
+	}
+	return resp.Header.Get("Docker-Content-Digest"), nil
+}
+
+// registryToken returns an anonymous token to pull the given repository.
+func registryToken(ctx context.Context, repo string) (string, error) {
+	q := url.Values{}
+	q.Set("service", "registry.docker.io")
+	q.Set("scope", fmt.Sprintf("repository:%s:pull", repo))
+	req, err := http.NewRequest(http.MethodGet, registryAuth+"?"+q.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", errors.Wrap(err, "could not authenticate to docker hub")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("could not authenticate to docker hub: %s", resp.Status)
+	}
+
+	var body struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", errors.Wrap(err, "could not read docker hub token")
+	}
+	return body.Token, nil
+}
+
+// ImageDigest returns the digest in Docker Hub, or in RegistryMirror, of the
+// installed image with the given tag, or an empty string if it's not
+// installed or it was not pulled.
+func ImageDigest(ctx context.Context, image, tag string) (string, error) {
+	c, err := client.NewEnvClient()
+	if err != nil {
+		return "", errors.Wrap(err, "could not create docker client")
+	}
+
+	ref := image + ":" + tag
+	img, _, err := c.ImageInspectWithRaw(ctx, ref)
+	if client.IsErrNotFound(err) {
+		return "", nil
+	} else if err != nil {
+		return "", errors.Wrapf(err, "could not inspect image %s", ref)
+	}
+
+	for _, d := range img.RepoDigests {
+		for _, name := range []string{image, MirrorImage(image)} {
+			if strings.HasPrefix(d, name+"@") {
+				return strings.TrimPrefix(d, name+"@"), nil
+			}
+		}
+	}
+	return "", nil
+}